@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"golang-restaurant-management/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// idempotencyKey returns the request's Idempotency-Key header, or nil when it was not sent
+func idempotencyKey(c *gin.Context) (*string, error) {
+	key := strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+	if key == "" {
+		return nil, nil
+	}
+	if len(key) > 255 {
+		return nil, errors.New("the Idempotency-Key header must be at most 255 characters")
+	}
+	return &key, nil
+}
+
+// invoiceByIdempotencyKey returns the invoice created with the given Idempotency-Key, if any
+func invoiceByIdempotencyKey(ctx context.Context, key *string) (models.Invoice, bool, error) {
+	var invoice models.Invoice
+	if key == nil {
+		return invoice, false, nil
+	}
+	err := invoiceCollection.FindOne(ctx, bson.M{"idempotency_key": *key}).Decode(&invoice)
+	if err == mongo.ErrNoDocuments {
+		return invoice, false, nil
+	}
+	return invoice, err == nil, err
+}
+
+// activeInvoices returns the invoices that still bill any of the orders, that is every invoice
+// that was not voided, split children excepted. Invoices created before active_order_ids was
+// introduced are matched on their order_id and order_ids.
+func activeInvoices(ctx context.Context, orderIds []string) ([]models.Invoice, error) {
+	cursor, err := invoiceCollection.Find(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"active_order_ids": bson.M{"$in": orderIds}},
+			bson.M{"active_order_ids": nil, "parent_invoice_id": nil, "order_id": bson.M{"$in": orderIds}},
+			bson.M{"active_order_ids": nil, "parent_invoice_id": nil, "order_ids": bson.M{"$in": orderIds}},
+		},
+		"payment_status": bson.M{"$ne": "VOID"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var invoices []models.Invoice
+	if err = cursor.All(ctx, &invoices); err != nil {
+		return nil, err
+	}
+	return invoices, nil
+}
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var analyticsEventCollection *mongo.Collection = database.OpenCollection(database.Client, "analyticsEvent")
+
+// maxAnalyticsBatch is the largest number of events accepted in one request
+const maxAnalyticsBatch = 500
+
+type AnalyticsBatch struct {
+	Events []models.AnalyticsEvent `json:"events" validate:"required,min=1,max=500,dive"`
+}
+
+// IngestAnalyticsEvents stores a batch of client telemetry. Only ANALYTICS_SAMPLE_PERCENT percent
+// of the events are kept (default 100), which keeps the averages unbiased while bounding storage.
+func IngestAnalyticsEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var batch AnalyticsBatch
+		if err := c.BindJSON(&batch); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(batch.Events) > maxAnalyticsBatch {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "too many events in one batch"})
+			return
+		}
+		if validationErr := validate.Struct(batch); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		samplePercent := envInt("ANALYTICS_SAMPLE_PERCENT", 100)
+		receivedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		documents := []interface{}{}
+		for _, event := range batch.Events {
+			if samplePercent < 100 && rand.Intn(100) >= samplePercent {
+				continue
+			}
+
+			event.ID = primitive.NewObjectID()
+			event.Event_id = event.ID.Hex()
+			event.User_id = c.GetString("uid")
+			if deviceId := c.GetString("device_id"); deviceId != "" {
+				event.Device_id = &deviceId
+			}
+			// Client clocks cannot be trusted for retention, and events from the future are clamped
+			if event.Occurred_at.IsZero() || event.Occurred_at.After(receivedAt) {
+				event.Occurred_at = receivedAt
+			}
+			event.Received_at = receivedAt
+			documents = append(documents, event)
+		}
+
+		if len(documents) > 0 {
+			if _, err := analyticsEventCollection.InsertMany(ctx, documents); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "analytics events were not stored"})
+				return
+			}
+		}
+		c.JSON(http.StatusAccepted, gin.H{"received": len(batch.Events), "stored": len(documents)})
+	}
+}
+
+type OrderEntryTime struct {
+	User_id    string  `json:"user_id"`
+	Orders     int     `json:"orders"`
+	Average_ms float64 `json:"average_ms"`
+	Fastest_ms int64   `json:"fastest_ms"`
+	Slowest_ms int64   `json:"slowest_ms"`
+}
+
+// GetOrderEntryTimes reports the average order-entry time (ORDER_SENT duration) per server.
+// The optional from/to query parameters (RFC3339) limit the period, by default the last 7 days.
+func GetOrderEntryTimes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		to := time.Now()
+		from := to.AddDate(0, 0, -7)
+		if value := c.Query("from"); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC3339 timestamp"})
+				return
+			}
+			from = parsed
+		}
+		if value := c.Query("to"); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC3339 timestamp"})
+				return
+			}
+			to = parsed
+		}
+
+		matchStage := bson.D{{"$match", bson.D{
+			{"name", "ORDER_SENT"},
+			{"duration_ms", bson.D{{"$ne", nil}}},
+			{"occurred_at", bson.D{{"$gte", from}, {"$lt", to}}},
+		}}}
+		groupStage := bson.D{{"$group", bson.D{
+			{"_id", "$user_id"},
+			{"orders", bson.D{{"$sum", 1}}},
+			{"average_ms", bson.D{{"$avg", "$duration_ms"}}},
+			{"fastest_ms", bson.D{{"$min", "$duration_ms"}}},
+			{"slowest_ms", bson.D{{"$max", "$duration_ms"}}},
+		}}}
+		projectStage := bson.D{{"$project", bson.D{
+			{"_id", 0},
+			{"user_id", "$_id"},
+			{"orders", 1},
+			{"average_ms", 1},
+			{"fastest_ms", 1},
+			{"slowest_ms", 1},
+		}}}
+		sortStage := bson.D{{"$sort", bson.D{{"average_ms", 1}}}}
+
+		result, err := analyticsEventCollection.Aggregate(ctx, mongo.Pipeline{matchStage, groupStage, projectStage, sortStage})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating order entry times"})
+			return
+		}
+
+		entryTimes := []OrderEntryTime{}
+		if err = result.All(ctx, &entryTimes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating order entry times"})
+			return
+		}
+		c.JSON(http.StatusOK, entryTimes)
+	}
+}
@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// notArchived matches the foods and menus that are not archived
+var notArchived = bson.E{"deleted_at", nil}
+
+// includeArchived reports whether a listing was asked to include archived foods and menus
+func includeArchived(c *gin.Context) bool {
+	return c.Query("include_archived") == "true"
+}
+
+// ArchiveFood archives a food instead of deleting it, so the orders and invoices that reference it
+// keep their name and price. Archived foods are left out of listings and can no longer be ordered.
+func ArchiveFood() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		foodId := c.Param("food_id")
+		var food models.Food
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
+		if food.Deleted_at != nil {
+			c.JSON(http.StatusOK, gin.H{"food_id": foodId, "deleted_at": food.Deleted_at})
+			return
+		}
+
+		version, err := nextMenuVersion(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "food item could not be archived"})
+			return
+		}
+		deletedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		_, err = foodCollection.UpdateOne(
+			ctx,
+			bson.D{{"food_id", foodId}, notArchived},
+			bson.D{{"$set", bson.D{{"deleted_at", deletedAt}, {"version", version}, {"updated_at", deletedAt}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "food item could not be archived"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"food_id": foodId, "deleted_at": deletedAt})
+	}
+}
+
+// RestoreFood puts an archived food back on its menu. Foods of an archived menu are restored with the menu.
+func RestoreFood() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		foodId := c.Param("food_id")
+		var food models.Food
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
+		if food.Deleted_at == nil {
+			c.JSON(http.StatusOK, gin.H{"food_id": foodId, "deleted_at": nil})
+			return
+		}
+		if food.Menu_id != nil {
+			count, err := menuCollection.CountDocuments(ctx, bson.D{{"menu_id", *food.Menu_id}, notArchived})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the menu"})
+				return
+			}
+			if count == 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "the food's menu is archived; restore the menu first"})
+				return
+			}
+		}
+
+		version, err := nextMenuVersion(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "food item could not be restored"})
+			return
+		}
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		_, err = foodCollection.UpdateOne(
+			ctx,
+			bson.M{"food_id": foodId},
+			bson.D{{"$set", bson.D{{"deleted_at", nil}, {"version", version}, {"updated_at", updatedAt}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "food item could not be restored"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"food_id": foodId, "deleted_at": nil})
+	}
+}
+
+// ArchiveMenu archives a menu together with its foods and discards its draft
+func ArchiveMenu() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		menuId := c.Param("menu_id")
+		var menu models.Menu
+		if err := menuCollection.FindOne(ctx, bson.M{"menu_id": menuId}).Decode(&menu); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu was not found"})
+			return
+		}
+		if menu.Deleted_at != nil {
+			c.JSON(http.StatusOK, gin.H{"menu_id": menuId, "deleted_at": menu.Deleted_at})
+			return
+		}
+
+		version, err := nextMenuVersion(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu could not be archived"})
+			return
+		}
+		deletedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		archive := bson.D{{"$set", bson.D{{"deleted_at", deletedAt}, {"version", version}, {"updated_at", deletedAt}}}}
+
+		// The foods are archived first, so a failure leaves the menu to be archived again
+		if _, err = foodCollection.UpdateMany(ctx, bson.D{{"menu_id", menuId}, notArchived}, archive); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu could not be archived"})
+			return
+		}
+		if _, err = menuDraftCollection.DeleteOne(ctx, bson.M{"menu_id": menuId}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu could not be archived"})
+			return
+		}
+		_, err = menuCollection.UpdateOne(
+			ctx,
+			bson.D{{"menu_id", menuId}, notArchived},
+			bson.D{{"$set", bson.D{{"deleted_at", deletedAt}, {"has_draft", false}, {"version", version}, {"updated_at", deletedAt}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu could not be archived"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"menu_id": menuId, "deleted_at": deletedAt})
+	}
+}
+
+// RestoreMenu puts an archived menu back, with the foods that were archived together with it.
+// Foods archived on their own before the menu stay archived.
+func RestoreMenu() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		menuId := c.Param("menu_id")
+		var menu models.Menu
+		if err := menuCollection.FindOne(ctx, bson.M{"menu_id": menuId}).Decode(&menu); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu was not found"})
+			return
+		}
+		if menu.Deleted_at == nil {
+			c.JSON(http.StatusOK, gin.H{"menu_id": menuId, "deleted_at": nil})
+			return
+		}
+
+		version, err := nextMenuVersion(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu could not be restored"})
+			return
+		}
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		restore := bson.D{{"$set", bson.D{{"deleted_at", nil}, {"version", version}, {"updated_at", updatedAt}}}}
+
+		if _, err = foodCollection.UpdateMany(ctx, bson.M{"menu_id": menuId, "deleted_at": menu.Deleted_at}, restore); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu could not be restored"})
+			return
+		}
+		if _, err = menuCollection.UpdateOne(ctx, bson.M{"menu_id": menuId}, restore); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu could not be restored"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"menu_id": menuId, "deleted_at": nil})
+	}
+}
@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// invoiceNetSales is the net sales of an invoice: its subtotal less discounts, refunds and the tax included
+// in tax inclusive prices
+var invoiceNetSales = bson.D{{"$subtract", bson.A{"$subtotal", bson.D{{"$add", bson.A{
+	"$discount_total",
+	bson.D{{"$ifNull", bson.A{"$refunded_amount", 0}}},
+	bson.D{{"$cond", bson.A{"$prices_include_tax", "$tax_total", 0}}},
+}}}}}}
+
+type AverageCheckFigures struct {
+	Orders            int          `json:"orders" bson:"orders"`
+	Net_sales         models.Money `json:"net_sales" bson:"net_sales"`
+	Average_check     models.Money `json:"average_check" bson:"-"`
+	Covers            int          `json:"covers" bson:"covers"`
+	Dine_in_sales     models.Money `json:"dine_in_sales" bson:"dine_in_sales"`
+	Revenue_per_cover models.Money `json:"revenue_per_cover" bson:"-"`
+}
+
+// add adds the figures of another period
+func (figures *AverageCheckFigures) add(other AverageCheckFigures) {
+	figures.Orders += other.Orders
+	figures.Net_sales += other.Net_sales
+	figures.Covers += other.Covers
+	figures.Dine_in_sales += other.Dine_in_sales
+}
+
+// average sets the average check and the revenue per cover
+func (figures *AverageCheckFigures) average() {
+	if figures.Orders > 0 {
+		figures.Average_check = models.Money(math.Round(float64(figures.Net_sales) / float64(figures.Orders)))
+	}
+	if figures.Covers > 0 {
+		figures.Revenue_per_cover = models.Money(math.Round(float64(figures.Dine_in_sales) / float64(figures.Covers)))
+	}
+}
+
+type AverageCheckPeriod struct {
+	Period              string `json:"period" bson:"_id"`
+	AverageCheckFigures `bson:",inline"`
+}
+
+type AverageCheckReport struct {
+	From        time.Time            `json:"from"`
+	To          time.Time            `json:"to"`
+	Group_by    string               `json:"group_by"`
+	Location_id *string              `json:"location_id"`
+	Totals      AverageCheckFigures  `json:"totals"`
+	Periods     []AverageCheckPeriod `json:"periods"`
+}
+
+// aggregateAverageCheckPeriods runs a pipeline whose output are average check figures per period
+func aggregateAverageCheckPeriods(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline) ([]AverageCheckPeriod, error) {
+	result, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var periods []AverageCheckPeriod
+	err = result.All(ctx, &periods)
+	return periods, err
+}
+
+// GetAverageCheck reports the average spend per order and per cover per day, week or month (group_by,
+// default day): the optional from/to query parameters (RFC3339), by default the last 30 days, optionally
+// of one location. The average check is the net sales of the invoices created in a period over the orders
+// they bill; the revenue per cover is the net sales of dine-in orders over the guests seated in the period.
+func GetAverageCheck() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		from, to, err := reportPeriod(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		groupBy := c.DefaultQuery("group_by", "day")
+		format, ok := salesPeriodFormats[groupBy]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be day, week or month"})
+			return
+		}
+		settings, err := loadSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the settings"})
+			return
+		}
+		startHour := defaultBusinessDayStartHour
+		if settings.Business_day_start_hour != nil {
+			startHour = *settings.Business_day_start_hour
+		}
+		now := time.Now()
+
+		report := AverageCheckReport{From: from, To: to, Group_by: groupBy, Periods: []AverageCheckPeriod{}}
+		invoiceMatch := bson.D{
+			{"created_at", bson.D{{"$gte", from}, {"$lt", to}}},
+			{"payment_status", bson.D{{"$in", bson.A{"PENDING", "PAID", "REFUNDED"}}}},
+		}
+		seatingPipeline := mongo.Pipeline{bson.D{{"$match", bson.D{{"seated_at", bson.D{{"$gte", from}, {"$lt", to}}}}}}}
+		if locationId := c.Query("location_id"); locationId != "" {
+			report.Location_id = &locationId
+			invoiceMatch = append(invoiceMatch, bson.E{"location_id", locationId})
+			// Seatings have no location of their own, so they are filtered by their table's
+			seatingPipeline = append(seatingPipeline,
+				bson.D{{"$lookup", bson.D{{"from", "table"}, {"localField", "table_id"}, {"foreignField", "table_id"}, {"as", "table"}}}},
+				bson.D{{"$match", bson.D{{"table.location_id", locationId}}}},
+			)
+		}
+
+		// Consolidated invoices bill several orders and split invoices share theirs, so orders are counted once
+		billedOrders := bson.D{{"$cond", bson.A{
+			bson.D{{"$gt", bson.A{bson.D{{"$size", bson.D{{"$ifNull", bson.A{"$order_ids", bson.A{}}}}}}, 0}}},
+			"$order_ids",
+			bson.A{"$order_id"},
+		}}}
+		// Orders without a channel are dine-in orders
+		dineIn := bson.D{{"$eq", bson.A{bson.D{{"$ifNull", bson.A{bson.D{{"$arrayElemAt", bson.A{"$order.channel", 0}}}, "DINE_IN"}}}, "DINE_IN"}}}
+		invoices, err := aggregateAverageCheckPeriods(ctx, invoiceCollection, mongo.Pipeline{
+			bson.D{{"$match", invoiceMatch}},
+			bson.D{{"$lookup", bson.D{{"from", "order"}, {"localField", "order_id"}, {"foreignField", "order_id"}, {"as", "order"}}}},
+			bson.D{{"$group", bson.D{
+				{"_id", salesPeriodKey("created_at", format, startHour, now)},
+				{"orders", bson.D{{"$push", billedOrders}}},
+				{"net_sales", bson.D{{"$sum", invoiceNetSales}}},
+				{"dine_in_sales", bson.D{{"$sum", bson.D{{"$cond", bson.A{dineIn, invoiceNetSales, 0}}}}}},
+			}}},
+			bson.D{{"$addFields", bson.D{{"orders", bson.D{{"$size", bson.D{{"$reduce", bson.D{
+				{"input", "$orders"},
+				{"initialValue", bson.A{}},
+				{"in", bson.D{{"$setUnion", bson.A{"$$value", "$$this"}}}},
+			}}}}}}}}},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating invoice totals"})
+			return
+		}
+
+		seatingPipeline = append(seatingPipeline, bson.D{{"$group", bson.D{
+			{"_id", salesPeriodKey("seated_at", format, startHour, now)},
+			{"covers", bson.D{{"$sum", "$guests"}}},
+		}}})
+		seatings, err := aggregateAverageCheckPeriods(ctx, seatingCollection, seatingPipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while counting covers"})
+			return
+		}
+
+		periods := map[string]*AverageCheckPeriod{}
+		for _, rows := range [][]AverageCheckPeriod{invoices, seatings} {
+			for _, row := range rows {
+				period, ok := periods[row.Period]
+				if !ok {
+					period = &AverageCheckPeriod{Period: row.Period}
+					periods[row.Period] = period
+				}
+				period.add(row.AverageCheckFigures)
+				report.Totals.add(row.AverageCheckFigures)
+			}
+		}
+		for _, period := range periods {
+			period.average()
+			report.Periods = append(report.Periods, *period)
+		}
+		report.Totals.average()
+		sort.Slice(report.Periods, func(i, j int) bool { return report.Periods[i].Period < report.Periods[j].Period })
+
+		c.JSON(http.StatusOK, report)
+	}
+}
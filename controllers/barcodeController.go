@@ -0,0 +1,243 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// BarcodeView is an inventory item resolved from one of its barcodes
+type BarcodeView struct {
+	InventoryItemView
+	Code          string  `json:"code"`
+	Pack_quantity float64 `json:"pack_quantity"`
+}
+
+type BarcodeReceiptRequest struct {
+	// Packs is the number of packages received, 1 when omitted
+	Packs       *float64   `json:"packs" validate:"omitempty,gt=0"`
+	Location_id *string    `json:"location_id"`
+	Unit_cost   *float64   `json:"unit_cost" validate:"omitempty,min=0"`
+	Expires_at  *time.Time `json:"expires_at"`
+	Lot_number  *string    `json:"lot_number" validate:"omitempty,max=50"`
+}
+
+type BarcodeCountRequest struct {
+	Barcode *string `json:"barcode" validate:"required"`
+
+	// Packs is the number of packages counted with the scan, 1 when omitted
+	Packs *float64 `json:"packs" validate:"omitempty,gt=0"`
+}
+
+// checkBarcodes checks that an item lists each barcode once and that no other item uses them
+func checkBarcodes(ctx context.Context, barcodes []models.InventoryBarcode, inventoryItemId string) error {
+	codes := []string{}
+	listed := map[string]bool{}
+	for _, barcode := range barcodes {
+		if listed[barcode.Code] {
+			return fmt.Errorf("barcode %s is listed twice", barcode.Code)
+		}
+		listed[barcode.Code] = true
+		codes = append(codes, barcode.Code)
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	var other models.InventoryItem
+	err := inventoryItemCollection.FindOne(ctx, bson.M{"barcodes.code": bson.M{"$in": codes}, "inventory_item_id": bson.M{"$ne": inventoryItemId}}).Decode(&other)
+	if err == nil {
+		return fmt.Errorf("a barcode is already used by %s", *other.Name)
+	}
+	return nil
+}
+
+// resolveBarcode finds the inventory item with a barcode and the quantity one scan of it stands for
+func resolveBarcode(ctx context.Context, code string) (models.InventoryItem, float64, error) {
+	var item models.InventoryItem
+	if err := inventoryItemCollection.FindOne(ctx, bson.M{"barcodes.code": code}).Decode(&item); err != nil {
+		return item, 0, err
+	}
+	packQuantity := 1.0
+	for _, barcode := range item.Barcodes {
+		if barcode.Code == code && barcode.Pack_quantity != nil {
+			packQuantity = *barcode.Pack_quantity
+		}
+	}
+	return item, packQuantity, nil
+}
+
+// GetBarcode resolves a scanned barcode to its inventory item and on-hand quantity
+func GetBarcode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		code := c.Param("code")
+		item, packQuantity, err := resolveBarcode(ctx, code)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no inventory item has barcode " + code})
+			return
+		}
+		levels, err := stockLevels(ctx, []string{item.Inventory_item_id}, c.Query("location_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating stock levels"})
+			return
+		}
+		c.JSON(http.StatusOK, BarcodeView{
+			InventoryItemView: InventoryItemView{InventoryItem: item, On_hand: levels[item.Inventory_item_id]},
+			Code:              code,
+			Pack_quantity:     packQuantity,
+		})
+	}
+}
+
+// ReceiveBarcode records a delivery of the scanned packages as a RECEIPT of their item
+func ReceiveBarcode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request BarcodeReceiptRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		code := c.Param("code")
+		item, packQuantity, err := resolveBarcode(ctx, code)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no inventory item has barcode " + code})
+			return
+		}
+		if item.Perishable != nil && *item.Perishable && request.Expires_at == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at is required to receive a perishable item"})
+			return
+		}
+
+		packs := 1.0
+		if request.Packs != nil {
+			packs = *request.Packs
+		}
+		movementType := "RECEIPT"
+		quantity := toFixed(packs*packQuantity, 3)
+		reason := "scanned barcode " + code
+		movement := models.InventoryMovement{
+			Inventory_item_id: &item.Inventory_item_id,
+			Location_id:       request.Location_id,
+			Type:              &movementType,
+			Quantity:          &quantity,
+			Unit_cost:         request.Unit_cost,
+			Reason:            &reason,
+			Expires_at:        request.Expires_at,
+			Lot_number:        request.Lot_number,
+			Created_by:        c.GetString("uid"),
+		}
+		if err := recordInventoryMovement(ctx, &movement); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, movement)
+	}
+}
+
+// ScanStockCount adds the scanned packages to the counted quantity of their item on an open count. The
+// first scan of an item sets its expected quantity, like recording its count by hand does.
+func ScanStockCount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request BarcodeCountRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		item, packQuantity, err := resolveBarcode(ctx, *request.Barcode)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no inventory item has barcode " + *request.Barcode})
+			return
+		}
+
+		stockCountId := c.Param("stock_count_id")
+		var count models.StockCount
+		if err := stockCountCollection.FindOne(ctx, bson.M{"stock_count_id": stockCountId}).Decode(&count); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "stock count was not found"})
+			return
+		}
+		if count.Status != "OPEN" {
+			c.JSON(http.StatusConflict, gin.H{"error": "the stock count is " + count.Status})
+			return
+		}
+		onCount := false
+		for _, line := range count.Lines {
+			onCount = onCount || line.Inventory_item_id == item.Inventory_item_id
+		}
+		if !onCount {
+			c.JSON(http.StatusBadRequest, gin.H{"error": *item.Name + " is not part of the count"})
+			return
+		}
+
+		packs := 1.0
+		if request.Packs != nil {
+			packs = *request.Packs
+		}
+		quantity := toFixed(packs*packQuantity, 3)
+		countedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		countedBy := c.GetString("uid")
+
+		locationId := ""
+		if count.Location_id != nil {
+			locationId = *count.Location_id
+		}
+		levels, err := stockLevels(ctx, []string{item.Inventory_item_id}, locationId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating stock levels"})
+			return
+		}
+		result, err := stockCountCollection.UpdateOne(
+			ctx,
+			bson.M{"stock_count_id": stockCountId, "status": "OPEN", "lines": bson.M{"$elemMatch": bson.M{"inventory_item_id": item.Inventory_item_id, "counted_quantity": nil}}},
+			bson.D{{"$set", bson.D{
+				{"lines.$.counted_quantity", quantity},
+				{"lines.$.expected_quantity", levels[item.Inventory_item_id]},
+				{"lines.$.counted_by", countedBy},
+				{"lines.$.counted_at", countedAt},
+			}}},
+		)
+		if err == nil && result.MatchedCount == 0 {
+			result, err = stockCountCollection.UpdateOne(
+				ctx,
+				bson.M{"stock_count_id": stockCountId, "status": "OPEN", "lines.inventory_item_id": item.Inventory_item_id},
+				bson.D{
+					{"$inc", bson.D{{"lines.$.counted_quantity", quantity}}},
+					{"$set", bson.D{{"lines.$.counted_by", countedBy}, {"lines.$.counted_at", countedAt}}},
+				},
+			)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the count could not be recorded"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "the stock count was closed in the meantime"})
+			return
+		}
+
+		stockCountCollection.FindOne(ctx, bson.M{"stock_count_id": stockCountId}).Decode(&count)
+		c.JSON(http.StatusOK, count)
+	}
+}
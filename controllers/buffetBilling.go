@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// findBuffetPlan returns the settings' buffet plan with the given code
+func findBuffetPlan(settings models.Settings, code string) (models.BuffetPlan, bool) {
+	for _, plan := range settings.Buffet_plans {
+		if plan.Code == code {
+			return plan, true
+		}
+	}
+	return models.BuffetPlan{}, false
+}
+
+// applyBuffetBilling checks a new order's buffet plan and fills in the guests it is charged for.
+// Guests default to the table's Number_of_guests, charged as adults. An order joining a table
+// session that is already billed as a buffet continues that buffet: its guests have been charged
+// on the first order, so further rounds only add extras.
+func applyBuffetBilling(ctx context.Context, order *models.Order) error {
+	var sessionBuffet models.Order
+	if order.Session_id != nil {
+		err := orderCollection.FindOne(ctx, bson.M{"session_id": *order.Session_id, "billing_mode": "BUFFET"}).Decode(&sessionBuffet)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+	}
+	joinsBuffet := sessionBuffet.Buffet_plan != nil
+
+	if order.Billing_mode == nil {
+		if !joinsBuffet {
+			return nil
+		}
+		mode := "BUFFET"
+		order.Billing_mode = &mode
+		order.Buffet_plan = sessionBuffet.Buffet_plan
+	}
+	if *order.Billing_mode != "BUFFET" {
+		return nil
+	}
+
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		return err
+	}
+	if order.Buffet_plan == nil {
+		return fmt.Errorf("buffet_plan is required for buffet orders")
+	}
+	if _, ok := findBuffetPlan(settings, *order.Buffet_plan); !ok {
+		return fmt.Errorf("buffet plan %s does not exist", *order.Buffet_plan)
+	}
+
+	if order.Buffet_guests != nil {
+		return nil
+	}
+	if joinsBuffet && *sessionBuffet.Buffet_plan == *order.Buffet_plan {
+		order.Buffet_guests = &models.BuffetGuests{}
+		return nil
+	}
+
+	var table models.Table
+	if order.Table_id == nil || tableCollection.FindOne(ctx, bson.M{"table_id": *order.Table_id}).Decode(&table) != nil || table.Number_of_guests == nil {
+		return fmt.Errorf("buffet_guests is required when the table's number of guests is unknown")
+	}
+	order.Buffet_guests = &models.BuffetGuests{Adults: *table.Number_of_guests}
+	return nil
+}
+
+// buffetLines returns the per-head charges of a buffet order, one line per price tier with guests
+func buffetLines(order models.Order, settings models.Settings) []models.InvoiceBuffetLine {
+	if order.Billing_mode == nil || *order.Billing_mode != "BUFFET" || order.Buffet_plan == nil || order.Buffet_guests == nil {
+		return nil
+	}
+	plan, ok := findBuffetPlan(settings, *order.Buffet_plan)
+	if !ok {
+		return nil
+	}
+
+	childPrice, seniorPrice := plan.Adult_price, plan.Adult_price
+	if plan.Child_price != nil {
+		childPrice = *plan.Child_price
+	}
+	if plan.Senior_price != nil {
+		seniorPrice = *plan.Senior_price
+	}
+
+	var lines []models.InvoiceBuffetLine
+	for _, tier := range []struct {
+		name   string
+		guests int
+		price  models.Money
+	}{
+		{"ADULT", order.Buffet_guests.Adults, plan.Adult_price},
+		{"CHILD", order.Buffet_guests.Children, childPrice},
+		{"SENIOR", order.Buffet_guests.Seniors, seniorPrice},
+	} {
+		if tier.guests <= 0 {
+			continue
+		}
+		lines = append(lines, models.InvoiceBuffetLine{
+			Order_id:   order.Order_id,
+			Plan:       plan.Code,
+			Plan_name:  plan.Name,
+			Tier:       tier.name,
+			Guests:     tier.guests,
+			Unit_price: tier.price,
+			Amount:     tier.price * models.Money(tier.guests),
+		})
+	}
+	return lines
+}
+
+// buffetIncludedItems returns the order items covered by their buffet order's per-head price,
+// i.e. the foods of the plan's included menus. foods caches the foods already looked up.
+func buffetIncludedItems(ctx context.Context, orders []models.Order, orderItems []models.OrderItem, settings models.Settings, foods map[string]models.Food) (map[string]bool, error) {
+	includedMenus := map[string]map[string]bool{}
+	for _, order := range orders {
+		if order.Billing_mode == nil || *order.Billing_mode != "BUFFET" || order.Buffet_plan == nil {
+			continue
+		}
+		if plan, ok := findBuffetPlan(settings, *order.Buffet_plan); ok {
+			includedMenus[order.Order_id] = map[string]bool{}
+			for _, menuId := range plan.Included_menu_ids {
+				includedMenus[order.Order_id][menuId] = true
+			}
+		}
+	}
+
+	included := map[string]bool{}
+	if len(includedMenus) == 0 {
+		return included, nil
+	}
+	for _, orderItem := range orderItems {
+		menus := includedMenus[orderItem.Order_id]
+		if len(menus) == 0 || orderItem.Food_id == nil {
+			continue
+		}
+		food, ok := foods[*orderItem.Food_id]
+		if !ok {
+			if err := foodCollection.FindOne(ctx, bson.M{"food_id": *orderItem.Food_id}).Decode(&food); err != nil && err != mongo.ErrNoDocuments {
+				return nil, err
+			}
+			foods[*orderItem.Food_id] = food
+		}
+		if food.Menu_id != nil && menus[*food.Menu_id] {
+			included[orderItem.Order_item_id] = true
+		}
+	}
+	return included, nil
+}
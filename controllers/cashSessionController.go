@@ -0,0 +1,334 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var cashSessionCollection *mongo.Collection = database.OpenCollection(database.Client, "cashSession")
+
+type CloseCashSessionRequest struct {
+	Counted_cash *models.Money `json:"counted_cash" validate:"required,min=0"`
+	Notes        *string       `json:"notes" validate:"omitempty,max=500"`
+}
+
+// OpenCashSession opens a drawer with its float for the calling cashier, who can only have one open drawer
+func OpenCashSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var session models.CashSession
+		if err := c.BindJSON(&session); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(session); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		userId := c.GetString("uid")
+		open, err := cashSessionCollection.CountDocuments(ctx, bson.M{"opened_by": userId, "status": "OPEN"})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking open drawers"})
+			return
+		}
+		if open > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "you already have an open drawer, close it first"})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		session.ID = primitive.NewObjectID()
+		session.Cash_session_id = session.ID.Hex()
+		session.Status = "OPEN"
+		session.Movements = []models.CashMovement{}
+		session.Opened_by = userId
+		session.Opened_at = now
+		session.Cash_sales, session.Cash_refunds, session.Paid_in_total, session.Paid_out_total, session.Expected_cash, session.Over_short = 0, 0, 0, 0, 0, 0
+		session.Counted_cash = nil
+		session.Closing_notes = nil
+		session.Closed_by = nil
+		session.Closed_at = nil
+
+		// The partial unique index on opened_by rejects a drawer opened concurrently by the same cashier
+		if _, err := cashSessionCollection.InsertOne(ctx, session); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "you already have an open drawer, close it first"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "drawer could not be opened"})
+			return
+		}
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+func GetCashSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		if locationId := c.Query("location_id"); locationId != "" {
+			filter["location_id"] = locationId
+		}
+
+		opts := options.Find().SetSort(bson.D{{"opened_at", -1}})
+		cursor, err := cashSessionCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing cash sessions"})
+			return
+		}
+		sessions := []models.CashSession{}
+		if err = cursor.All(ctx, &sessions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing cash sessions"})
+			return
+		}
+		c.JSON(http.StatusOK, sessions)
+	}
+}
+
+// GetCashSession returns a cash session; the amounts of an open session are calculated up to now
+func GetCashSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var session models.CashSession
+		if err := cashSessionCollection.FindOne(ctx, bson.M{"cash_session_id": c.Param("cash_session_id")}).Decode(&session); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cash session was not found"})
+			return
+		}
+		if session.Status == "OPEN" {
+			if err := calculateCashSession(ctx, &session); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating the cash session"})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+// RecordCashMovement records cash paid into or out of an open drawer
+func RecordCashMovement() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var movement models.CashMovement
+		if err := c.BindJSON(&movement); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(movement); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		movement.Recorded_by = c.GetString("uid")
+		movement.Recorded_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		result, err := cashSessionCollection.UpdateOne(
+			ctx,
+			bson.M{"cash_session_id": c.Param("cash_session_id"), "status": "OPEN"},
+			bson.D{{"$push", bson.D{{"movements", movement}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "cash movement could not be recorded"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cash session was not found or is already closed"})
+			return
+		}
+		c.JSON(http.StatusOK, movement)
+	}
+}
+
+// CloseCashSession closes a drawer with the cash counted in it and reports how much it is over or short
+func CloseCashSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request CloseCashSessionRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var session models.CashSession
+		if err := cashSessionCollection.FindOne(ctx, bson.M{"cash_session_id": c.Param("cash_session_id")}).Decode(&session); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cash session was not found"})
+			return
+		}
+		if session.Status != "OPEN" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cash session is already closed"})
+			return
+		}
+
+		// The session is closed first, so no cash payment can be added to it while it is being counted
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		closedBy := c.GetString("uid")
+		result, err := cashSessionCollection.UpdateOne(
+			ctx,
+			bson.M{"cash_session_id": session.Cash_session_id, "status": "OPEN"},
+			bson.D{{"$set", bson.D{{"status", "CLOSED"}, {"closed_by", closedBy}, {"closed_at", now}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "cash session could not be closed"})
+			return
+		}
+		if result.ModifiedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "cash session was closed concurrently"})
+			return
+		}
+
+		if err := calculateCashSession(ctx, &session); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating the cash session"})
+			return
+		}
+		session.Status = "CLOSED"
+		session.Closed_by = &closedBy
+		session.Closed_at = &now
+		session.Counted_cash = request.Counted_cash
+		session.Over_short = *request.Counted_cash - session.Expected_cash
+		session.Closing_notes = request.Notes
+
+		_, err = cashSessionCollection.UpdateOne(
+			ctx,
+			bson.M{"cash_session_id": session.Cash_session_id},
+			bson.D{{"$set", bson.D{
+				{"cash_sales", session.Cash_sales},
+				{"cash_refunds", session.Cash_refunds},
+				{"paid_in_total", session.Paid_in_total},
+				{"paid_out_total", session.Paid_out_total},
+				{"expected_cash", session.Expected_cash},
+				{"counted_cash", session.Counted_cash},
+				{"over_short", session.Over_short},
+				{"closing_notes", session.Closing_notes},
+			}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "cash count could not be recorded"})
+			return
+		}
+
+		if session.Over_short != 0 {
+			settings, _ := loadSettings(ctx)
+			message := "Drawer closed " + formatMoney(session.Over_short, settings) + " against the expected " + formatMoney(session.Expected_cash, settings)
+			notifyManagers(ctx, "CASH_OVER_SHORT", "Cash drawer over/short", message, session.Cash_session_id)
+		}
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+// calculateCashSession works out the session's cash sales and refunds, paid-ins and paid-outs and the cash expected in the drawer
+func calculateCashSession(ctx context.Context, session *models.CashSession) error {
+	cursor, err := invoiceCollection.Find(ctx, bson.M{"cash_session_id": session.Cash_session_id, "payment_status": bson.M{"$in": bson.A{"PAID", "REFUNDED"}}})
+	if err != nil {
+		return err
+	}
+	var invoices []models.Invoice
+	if err = cursor.All(ctx, &invoices); err != nil {
+		return err
+	}
+
+	// Refunds are paid back in cash up to what was paid in cash; the rest went back to gift cards or deposits
+	session.Cash_sales, session.Cash_refunds = 0, 0
+	for _, invoice := range invoices {
+		amountDue := invoiceAmountDue(invoice)
+		session.Cash_sales += amountDue
+		if invoice.Refunded_amount < amountDue {
+			session.Cash_refunds += invoice.Refunded_amount
+		} else {
+			session.Cash_refunds += amountDue
+		}
+	}
+
+	session.Paid_in_total, session.Paid_out_total = 0, 0
+	for _, movement := range session.Movements {
+		if movement.Type == "PAID_IN" {
+			session.Paid_in_total += movement.Amount
+		} else {
+			session.Paid_out_total += movement.Amount
+		}
+	}
+
+	var float models.Money
+	if session.Opening_float != nil {
+		float = *session.Opening_float
+	}
+	session.Expected_cash = float + session.Cash_sales - session.Cash_refunds + session.Paid_in_total - session.Paid_out_total
+	return nil
+}
+
+// isCashPayment reports whether a payment method is cash: CASH, or a configured method of type CASH
+func isCashPayment(settings models.Settings, method string) bool {
+	for _, paymentMethod := range settingsPaymentMethods(settings) {
+		if paymentMethod.Code == method {
+			return paymentMethod.Type == "CASH"
+		}
+	}
+	return method == "CASH"
+}
+
+// assignCashSession links an invoice just paid in cash to the drawer the cash went into: the open
+// session of the cashier who took the payment, or else the only open session at the invoice's location.
+// Failures are logged rather than returned, as the payment itself has been recorded.
+func assignCashSession(ctx context.Context, invoice models.Invoice, userId string) {
+	if invoice.Payment_method == nil || invoice.Cash_session_id != nil {
+		return
+	}
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		log.Println("failed to load settings for the cash session:", err)
+		return
+	}
+	if !isCashPayment(settings, *invoice.Payment_method) {
+		return
+	}
+
+	var session models.CashSession
+	err = cashSessionCollection.FindOne(ctx, bson.M{"opened_by": userId, "status": "OPEN"}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		cursor, findErr := cashSessionCollection.Find(ctx, bson.M{"location_id": invoice.Location_id, "status": "OPEN"})
+		if findErr != nil {
+			log.Println("failed to find the open cash sessions:", findErr)
+			return
+		}
+		var sessions []models.CashSession
+		if findErr = cursor.All(ctx, &sessions); findErr != nil || len(sessions) != 1 {
+			log.Println("cash payment of invoice", invoice.Invoice_id, "could not be assigned to a drawer")
+			return
+		}
+		session, err = sessions[0], nil
+	}
+	if err != nil {
+		log.Println("failed to find the open cash session:", err)
+		return
+	}
+
+	_, err = invoiceCollection.UpdateOne(ctx, bson.M{"invoice_id": invoice.Invoice_id, "cash_session_id": nil}, bson.D{{"$set", bson.D{{"cash_session_id", session.Cash_session_id}}}})
+	if err != nil {
+		log.Println("failed to assign the cash session:", err)
+	}
+}
@@ -0,0 +1,240 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var categoryCollection *mongo.Collection = database.OpenCollection(database.Client, "category")
+
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// categorySlug turns a category name or slug into its lower case, dash separated form
+func categorySlug(value string) string {
+	return strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(value), "-"), "-")
+}
+
+func GetCategories() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := categoryCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{"sort_order", 1}, {"name", 1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing categories"})
+			return
+		}
+		categories := []models.Category{}
+		if err = result.All(ctx, &categories); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing categories"})
+			return
+		}
+		c.JSON(http.StatusOK, categories)
+	}
+}
+
+func GetCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var category models.Category
+		if err := categoryCollection.FindOne(ctx, bson.M{"category_id": c.Param("category_id")}).Decode(&category); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "category was not found"})
+			return
+		}
+		c.JSON(http.StatusOK, category)
+	}
+}
+
+func CreateCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var category models.Category
+
+		if err := c.BindJSON(&category); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(category); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		slug := *category.Name
+		if category.Slug != nil {
+			slug = *category.Slug
+		}
+		slug = categorySlug(slug)
+		if len(slug) < 2 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "slug must have at least 2 letters or digits"})
+			return
+		}
+		category.Slug = &slug
+		if category.Sort_order == nil {
+			sortOrder := 0
+			category.Sort_order = &sortOrder
+		}
+
+		category.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		category.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		category.ID = primitive.NewObjectID()
+		category.Category_id = category.ID.Hex()
+
+		_, insertErr := categoryCollection.InsertOne(ctx, category)
+		if mongo.IsDuplicateKeyError(insertErr) {
+			c.JSON(http.StatusConflict, gin.H{"error": "a category with this slug already exists"})
+			return
+		}
+		if insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "category was not created"})
+			return
+		}
+		c.JSON(http.StatusOK, category)
+	}
+}
+
+func UpdateCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var category models.Category
+		categoryId := c.Param("category_id")
+
+		if err := c.BindJSON(&category); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var updateObj primitive.D
+
+		if category.Name != nil {
+			if validationErr := validate.Var(*category.Name, "min=2,max=50"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "name must be between 2 and 50 characters"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"name", category.Name})
+		}
+
+		if category.Slug != nil {
+			slug := categorySlug(*category.Slug)
+			if len(slug) < 2 || len(slug) > 50 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "slug must be between 2 and 50 letters or digits"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"slug", slug})
+		}
+
+		if category.Description != nil {
+			if validationErr := validate.Var(*category.Description, "max=250"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "description must be at most 250 characters"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"description", category.Description})
+		}
+
+		if category.Sort_order != nil {
+			if *category.Sort_order < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "sort_order cannot be negative"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"sort_order", category.Sort_order})
+		}
+
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{"updated_at", updatedAt})
+
+		result, err := categoryCollection.UpdateOne(ctx, bson.M{"category_id": categoryId}, bson.D{{"$set", updateObj}})
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "a category with this slug already exists"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "category update failed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "category was not found"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// DeleteCategory removes a category that no food belongs to anymore
+func DeleteCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		categoryId := c.Param("category_id")
+
+		count, err := foodCollection.CountDocuments(ctx, bson.M{"category_id": categoryId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the category's foods"})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "category still has foods, move them to another category first"})
+			return
+		}
+
+		result, err := categoryCollection.DeleteOne(ctx, bson.M{"category_id": categoryId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "category could not be deleted"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "category was not found"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// validateFoodCategory checks that a food's category exists; an empty category_id is accepted
+// on updates, to take the food out of its category
+func validateFoodCategory(ctx context.Context, categoryId *string) error {
+	if categoryId == nil || *categoryId == "" {
+		return nil
+	}
+	count, err := categoryCollection.CountDocuments(ctx, bson.M{"category_id": *categoryId})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("category was not found")
+	}
+	return nil
+}
+
+// normalizeFoodTags stores tags trimmed and lower case, without duplicates, so filters match
+// however staff typed them
+func normalizeFoodTags(tags []string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
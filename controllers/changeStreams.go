@@ -0,0 +1,261 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// changeStreamCollections are the collections watched for the realtime clients: orders, order items and
+// tables are pushed over the WebSocket, kitchen events wake the kitchen streams
+var changeStreamCollections = bson.A{"order", "orderItem", "table", "kitchenEvent"}
+
+// realtimeHiddenFields are never pushed, like they are never returned by the API
+var realtimeHiddenFields = map[string]bool{
+	"qr_code_secret":      true,
+	"active_table_number": true,
+}
+
+// changeStreamsRunning is set while changes reach the realtime clients through a change stream. Instances
+// then leave the changes they make to the stream rather than also publishing them directly; while the
+// stream is down they publish them again, so changes made meanwhile may be pushed twice once it resumes.
+var changeStreamsRunning int32
+
+func changeStreamsActive() bool {
+	return atomic.LoadInt32(&changeStreamsRunning) == 1
+}
+
+// changeStreamEvent is a change stream document
+type changeStreamEvent struct {
+	OperationType string `bson:"operationType"`
+	Ns            struct {
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey struct {
+		ID interface{} `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument      bson.M `bson:"fullDocument"`
+	UpdateDescription struct {
+		UpdatedFields bson.M   `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+	ClusterTime primitive.Timestamp `bson:"clusterTime"`
+}
+
+// documentId returns the id of the changed document, which is the hex of its _id
+func (change changeStreamEvent) documentId() string {
+	if id, ok := change.DocumentKey.ID.(primitive.ObjectID); ok {
+		return id.Hex()
+	}
+	return fmt.Sprint(change.DocumentKey.ID)
+}
+
+// fullDocumentString returns a string field of the changed document, or "" when it is not known
+func (change changeStreamEvent) fullDocumentString(field string) string {
+	value, _ := change.FullDocument[field].(string)
+	return value
+}
+
+// StartChangeStreams pushes the changes to orders, order items and tables to the realtime clients of
+// this instance, whichever instance made them (or a tool writing to the database directly), and wakes
+// the kitchen and pickup board streams as soon as other instances change them. This is what lets several
+// instances run behind a load balancer.
+// Change streams need MongoDB to run as a replica set; without one, or with REALTIME_CHANGE_STREAMS=off,
+// each instance only pushes the changes it makes itself.
+func StartChangeStreams() {
+	if strings.ToLower(os.Getenv("REALTIME_CHANGE_STREAMS")) == "off" {
+		log.Println("change streams: disabled, realtime clients only get the changes made by this instance")
+		return
+	}
+	stream, err := watchChanges(nil)
+	if err != nil {
+		log.Println("change streams: not available, realtime clients only get the changes made by this instance:", err)
+		return
+	}
+	atomic.StoreInt32(&changeStreamsRunning, 1)
+
+	go func() {
+		for {
+			resumeToken := followChanges(stream)
+			atomic.StoreInt32(&changeStreamsRunning, 0)
+			for {
+				time.Sleep(5 * time.Second)
+				stream, err = watchChanges(resumeToken)
+				if err == nil {
+					atomic.StoreInt32(&changeStreamsRunning, 1)
+					break
+				}
+				// Changes older than the oplog cannot be resumed from; clients reload when they reconnect
+				var commandErr mongo.CommandError
+				if errors.As(err, &commandErr) && (commandErr.Code == 280 || commandErr.Code == 286) {
+					log.Println("change streams: changes were missed, starting over:", err)
+					resumeToken = nil
+					continue
+				}
+				log.Println("change streams: error occured while reconnecting:", err)
+			}
+		}
+	}()
+}
+
+// watchChanges opens the change stream, after resumeToken when it is set
+func watchChanges(resumeToken bson.Raw) (*mongo.ChangeStream, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{{{"$match", bson.D{
+		{"ns.coll", bson.D{{"$in", changeStreamCollections}}},
+		{"operationType", bson.D{{"$in", bson.A{"insert", "update", "replace", "delete"}}}},
+	}}}}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeToken != nil {
+		opts.SetResumeAfter(resumeToken)
+	}
+	return orderCollection.Database().Watch(ctx, pipeline, opts)
+}
+
+// followChanges handles the changes of a stream until it fails and returns where to resume from
+func followChanges(stream *mongo.ChangeStream) bson.Raw {
+	defer stream.Close(context.Background())
+	for stream.Next(context.Background()) {
+		var change changeStreamEvent
+		if err := stream.Decode(&change); err != nil {
+			log.Println("change streams: error occured while decoding a change:", err)
+			continue
+		}
+		handleChange(change)
+	}
+	log.Println("change streams: stream stopped, reconnecting:", stream.Err())
+	return stream.ResumeToken()
+}
+
+func handleChange(change changeStreamEvent) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	switch change.Ns.Coll {
+	case "kitchenEvent":
+		notifyKitchenStreams()
+	case "order":
+		notifyPickupBoards()
+		broadcastOrderEvents(ctx, orderChangeEvents(change)...)
+	case "orderItem":
+		broadcastOrderEvents(ctx, orderItemChangeEvents(change)...)
+	case "table":
+		if !orderEvents.connected() {
+			return
+		}
+		for _, event := range tableChangeEvents(change) {
+			orderEvents.publish(event)
+		}
+	}
+}
+
+// changedFieldEvents turns an update into an event per changed field, of type statusType for the status
+// and otherType for the other fields. updated_at is left out, every update sets it.
+func changedFieldEvents(change changeStreamEvent, event RealtimeEvent, statusType string, otherType string) []RealtimeEvent {
+	fields := []string{}
+	for field := range change.UpdateDescription.UpdatedFields {
+		fields = append(fields, field)
+	}
+	fields = append(fields, change.UpdateDescription.RemovedFields...)
+	sort.Strings(fields)
+
+	events := []RealtimeEvent{}
+	for _, field := range fields {
+		if field == "updated_at" || realtimeHiddenFields[strings.SplitN(field, ".", 2)[0]] {
+			continue
+		}
+		fieldEvent := event
+		name := field
+		fieldEvent.Field = &name
+		fieldEvent.Value = change.UpdateDescription.UpdatedFields[field]
+		fieldEvent.Type = otherType
+		if field == "status" {
+			fieldEvent.Type = statusType
+		}
+		events = append(events, fieldEvent)
+	}
+	return events
+}
+
+// orderChangeEvents names order changes like the order history does
+func orderChangeEvents(change changeStreamEvent) []RealtimeEvent {
+	event := RealtimeEvent{Order_id: change.documentId(), At: time.Unix(int64(change.ClusterTime.T), 0).UTC()}
+	switch change.OperationType {
+	case "insert":
+		event.Type = "ORDER_CREATED"
+	case "update":
+		return changedFieldEvents(change, event, "ORDER_STATUS_CHANGED", "ORDER_UPDATED")
+	case "replace":
+		event.Type = "ORDER_UPDATED"
+	case "delete":
+		event.Type = "ORDER_DELETED"
+	}
+	return []RealtimeEvent{event}
+}
+
+// orderItemChangeEvents names order item changes like the order history does. Deleted items no longer
+// say which order they belonged to, so only clients not following a single order get their removal.
+func orderItemChangeEvents(change changeStreamEvent) []RealtimeEvent {
+	orderItemId := change.documentId()
+	event := RealtimeEvent{
+		Order_id:      change.fullDocumentString("order_id"),
+		Order_item_id: &orderItemId,
+		At:            time.Unix(int64(change.ClusterTime.T), 0).UTC(),
+	}
+	switch change.OperationType {
+	case "insert":
+		event.Type = "ITEM_ADDED"
+	case "update":
+		events := changedFieldEvents(change, event, "STATUS_CHANGED", "ITEM_UPDATED")
+		for i := range events {
+			if events[i].Type == "STATUS_CHANGED" && events[i].Value == "VOIDED" {
+				events[i].Type = "ITEM_VOIDED"
+			}
+		}
+		return events
+	case "replace":
+		event.Type = "ITEM_UPDATED"
+	case "delete":
+		event.Type = "ITEM_REMOVED"
+	}
+	return []RealtimeEvent{event}
+}
+
+// tableChangeEvents turns table changes into events of the tables topic
+func tableChangeEvents(change changeStreamEvent) []RealtimeEvent {
+	tableId := change.documentId()
+	event := RealtimeEvent{Topic: "tables", Table_id: &tableId, At: time.Unix(int64(change.ClusterTime.T), 0).UTC()}
+	if locationId := change.fullDocumentString("location_id"); locationId != "" {
+		event.Location_id = &locationId
+	}
+	events := []RealtimeEvent{event}
+	switch change.OperationType {
+	case "insert":
+		events[0].Type = "TABLE_CREATED"
+	case "update":
+		events = changedFieldEvents(change, event, "TABLE_STATUS_CHANGED", "TABLE_UPDATED")
+	case "replace":
+		events[0].Type = "TABLE_UPDATED"
+	case "delete":
+		events[0].Type = "TABLE_DELETED"
+	}
+	for i := range events {
+		if events[i].Field != nil && realtimePiiField(*events[i].Field) {
+			events[i].Value = nil
+		}
+	}
+	return events
+}
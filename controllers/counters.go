@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var counterCollection *mongo.Collection = database.OpenCollection(database.Client, "counter")
+
+type counter struct {
+	Value int64 `bson:"value"`
+}
+
+// nextCounter atomically increments the named counter and returns its new value.
+// Counters start at 1 the first time they are used.
+func nextCounter(ctx context.Context, name string) (int64, error) {
+	var result counter
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	err := counterCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": name},
+		bson.D{{"$inc", bson.D{{"value", 1}}}},
+		opts,
+	).Decode(&result)
+	return result.Value, err
+}
+
+// currentCounter returns the value of the named counter without changing it (0 if never used)
+func currentCounter(ctx context.Context, name string) (int64, error) {
+	var result counter
+	err := counterCollection.FindOne(ctx, bson.M{"_id": name}).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	return result.Value, err
+}
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// defaultServicePeriods are used when the settings do not configure service_periods
+var defaultServicePeriods = []models.ServicePeriod{
+	{Name: "LUNCH", Start: "04:00", End: "16:00"},
+	{Name: "DINNER", Start: "16:00", End: "04:00"},
+}
+
+// maxCoversReportDays bounds the number of days of a covers report
+const maxCoversReportDays = 366
+
+type CoversCount struct {
+	Parties            int `json:"parties"`
+	Covers             int `json:"covers"`
+	Walk_in_covers     int `json:"walk_in_covers"`
+	Reservation_covers int `json:"reservation_covers"`
+}
+
+// add counts a seated party
+func (count *CoversCount) add(seating models.Seating) {
+	count.Parties++
+	count.Covers += seating.Guests
+	if seating.Party_source == "RESERVATION" {
+		count.Reservation_covers += seating.Guests
+	} else {
+		count.Walk_in_covers += seating.Guests
+	}
+}
+
+type CoversPeriod struct {
+	Name string `json:"name"`
+	CoversCount
+}
+
+type CoversDay struct {
+	Business_date string `json:"business_date"`
+	CoversCount
+	Periods []CoversPeriod `json:"periods"`
+}
+
+type CoversReport struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	CoversCount
+	Periods []CoversPeriod `json:"periods"`
+	Days    []CoversDay    `json:"days"`
+}
+
+// servicePeriodAt returns the index of the service period a moment falls in, or -1 when it falls in none
+func servicePeriodAt(periods []models.ServicePeriod, at time.Time) int {
+	minute := at.Hour()*60 + at.Minute()
+	for i, period := range periods {
+		start, end := minutesOfDay(period.Start), minutesOfDay(period.End)
+		if start < 0 || end < 0 {
+			continue
+		}
+		if (start < end && minute >= start && minute < end) || (start > end && (minute >= start || minute < end)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// newCoversPeriods returns an empty count for each service period, and OTHER for parties seated outside them
+func newCoversPeriods(periods []models.ServicePeriod) []CoversPeriod {
+	counts := []CoversPeriod{}
+	for _, period := range periods {
+		counts = append(counts, CoversPeriod{Name: period.Name})
+	}
+	return append(counts, CoversPeriod{Name: "OTHER"})
+}
+
+// GetCovers reports the covers (guests seated) per business day from from to to (YYYY-MM-DD, by default
+// the last 7 days), split into walk-in and reservation covers and by service period
+func GetCovers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		settings, err := loadSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the settings"})
+			return
+		}
+		now := time.Now()
+		today, _ := time.ParseInLocation("2006-01-02", businessDate(settings, now), now.Location())
+		from, to := today.AddDate(0, 0, -6), today
+		if value := c.Query("from"); value != "" {
+			if from, err = time.ParseInLocation("2006-01-02", value, now.Location()); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "from must be in YYYY-MM-DD format"})
+				return
+			}
+		}
+		if value := c.Query("to"); value != "" {
+			if to, err = time.ParseInLocation("2006-01-02", value, now.Location()); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "to must be in YYYY-MM-DD format"})
+				return
+			}
+		}
+		if to.Before(from) || to.Sub(from) >= maxCoversReportDays*24*time.Hour {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to, and the report can cover at most 366 days"})
+			return
+		}
+
+		periods := settings.Service_periods
+		if len(periods) == 0 {
+			periods = defaultServicePeriods
+		}
+		report := CoversReport{From: from.Format("2006-01-02"), To: to.Format("2006-01-02"), Periods: newCoversPeriods(periods), Days: []CoversDay{}}
+		days := map[string]int{}
+		for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+			days[day.Format("2006-01-02")] = len(report.Days)
+			report.Days = append(report.Days, CoversDay{Business_date: day.Format("2006-01-02"), Periods: newCoversPeriods(periods)})
+		}
+
+		// Business days start at business_day_start_hour, so the last day runs into the next morning
+		startHour := defaultBusinessDayStartHour
+		if settings.Business_day_start_hour != nil {
+			startHour = *settings.Business_day_start_hour
+		}
+		offset := time.Duration(startHour) * time.Hour
+		cursor, err := seatingCollection.Find(ctx, bson.M{"seated_at": bson.M{"$gte": from.Add(offset), "$lt": to.AddDate(0, 0, 1).Add(offset)}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing seatings"})
+			return
+		}
+		var seatings []models.Seating
+		if err = cursor.All(ctx, &seatings); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing seatings"})
+			return
+		}
+
+		for _, seating := range seatings {
+			seatedAt := seating.Seated_at.In(now.Location())
+			i, ok := days[businessDate(settings, seatedAt)]
+			if !ok {
+				continue
+			}
+			period := servicePeriodAt(periods, seatedAt)
+			if period < 0 {
+				period = len(periods)
+			}
+			report.add(seating)
+			report.Periods[period].add(seating)
+			report.Days[i].add(seating)
+			report.Days[i].Periods[period].add(seating)
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
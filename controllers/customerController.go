@@ -0,0 +1,487 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var customerCollection *mongo.Collection = database.OpenCollection(database.Client, "customer")
+
+// CustomerStats are a customer's visits and spend, calculated from their linked orders and invoices
+type CustomerStats struct {
+	Visits         int          `json:"visits" bson:"visits"`
+	Lifetime_spend models.Money `json:"lifetime_spend" bson:"lifetime_spend"`
+	Average_spend  models.Money `json:"average_spend" bson:"-"`
+	First_visit    *time.Time   `json:"first_visit" bson:"first_visit"`
+	Last_visit     *time.Time   `json:"last_visit" bson:"last_visit"`
+}
+
+type CustomerSegmentEntry struct {
+	models.Customer
+	CustomerStats
+}
+
+type CustomerVisit struct {
+	Order_id       string       `json:"order_id"`
+	Order_number   int          `json:"order_number"`
+	Channel        *string      `json:"channel"`
+	Location_id    *string      `json:"location_id"`
+	Status         *string      `json:"status"`
+	Created_at     time.Time    `json:"created_at"`
+	Invoice_id     *string      `json:"invoice_id"`
+	Invoice_number *string      `json:"invoice_number"`
+	Payment_status *string      `json:"payment_status"`
+	Spend          models.Money `json:"spend"`
+}
+
+type CustomerFavorite struct {
+	Food_id  string `json:"food_id" bson:"_id"`
+	Name     string `json:"name" bson:"name"`
+	Quantity int    `json:"quantity" bson:"quantity"`
+}
+
+type CustomerHistory struct {
+	Customer  models.Customer    `json:"customer"`
+	Stats     CustomerStats      `json:"stats"`
+	Favorites []CustomerFavorite `json:"favorites"`
+	Visits    []CustomerVisit    `json:"visits"`
+}
+
+// customerSpend is what a guest paid on an invoice: its grand total less refunds
+var customerSpend = bson.D{{"$subtract", bson.A{"$grand_total", bson.D{{"$ifNull", bson.A{"$refunded_amount", 0}}}}}}
+
+// customerStats calculates the visits and spend of customers, all customers with a linked order when ids is
+// nil. Voided orders are not visits; spend counts the paid invoices of the linked orders.
+func customerStats(ctx context.Context, ids []string) (map[string]*CustomerStats, error) {
+	orderMatch := bson.D{{"customer_id", bson.D{{"$ne", nil}}}, {"status", bson.D{{"$ne", "VOIDED"}}}}
+	invoiceMatch := bson.D{{"order.customer_id", bson.D{{"$ne", nil}}}}
+	if ids != nil {
+		orderMatch[0] = bson.E{"customer_id", bson.D{{"$in", ids}}}
+		invoiceMatch[0] = bson.E{"order.customer_id", bson.D{{"$in", ids}}}
+	}
+
+	var rows []struct {
+		Customer_id   string `bson:"_id"`
+		CustomerStats `bson:",inline"`
+	}
+	result, err := orderCollection.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{"$match", orderMatch}},
+		bson.D{{"$group", bson.D{
+			{"_id", "$customer_id"},
+			{"visits", bson.D{{"$sum", 1}}},
+			{"first_visit", bson.D{{"$min", "$created_at"}}},
+			{"last_visit", bson.D{{"$max", "$created_at"}}},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = result.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	stats := map[string]*CustomerStats{}
+	for i := range rows {
+		stats[rows[i].Customer_id] = &rows[i].CustomerStats
+	}
+
+	rows = nil
+	result, err = invoiceCollection.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{"$match", bson.D{{"payment_status", bson.D{{"$in", bson.A{"PAID", "REFUNDED"}}}}}}},
+		bson.D{{"$lookup", bson.D{{"from", "order"}, {"localField", "order_id"}, {"foreignField", "order_id"}, {"as", "order"}}}},
+		bson.D{{"$match", invoiceMatch}},
+		bson.D{{"$group", bson.D{
+			{"_id", bson.D{{"$arrayElemAt", bson.A{"$order.customer_id", 0}}}},
+			{"lifetime_spend", bson.D{{"$sum", customerSpend}}},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = result.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if customer, ok := stats[row.Customer_id]; ok {
+			customer.Lifetime_spend = row.Lifetime_spend
+		}
+	}
+	for _, customer := range stats {
+		if customer.Visits > 0 {
+			customer.Average_spend = customer.Lifetime_spend / models.Money(customer.Visits)
+		}
+	}
+	return stats, nil
+}
+
+// checkCustomer verifies that an order is linked to an existing customer
+func checkCustomer(ctx context.Context, customerId string) error {
+	count, err := customerCollection.CountDocuments(ctx, bson.M{"customer_id": customerId})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("customer was not found")
+	}
+	return nil
+}
+
+// GetCustomers lists the customers, optionally matching a search on their name, phone or email (q)
+func GetCustomers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if q := strings.TrimSpace(c.Query("q")); q != "" {
+			pattern := bson.M{"$regex": regexp.QuoteMeta(q), "$options": "i"}
+			filter["$or"] = bson.A{bson.M{"customer_name": pattern}, bson.M{"customer_phone": pattern}, bson.M{"customer_email": pattern}}
+		}
+		opts := options.Find().SetSort(bson.D{{"customer_name", 1}}).SetLimit(100)
+		cursor, err := customerCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing customers"})
+			return
+		}
+		customers := []models.Customer{}
+		if err = cursor.All(ctx, &customers); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing customers"})
+			return
+		}
+		maskedJSON(c, http.StatusOK, customers)
+	}
+}
+
+func GetCustomer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var customer models.Customer
+		if err := customerCollection.FindOne(ctx, bson.M{"customer_id": c.Param("customer_id")}).Decode(&customer); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "customer was not found"})
+			return
+		}
+		maskedJSON(c, http.StatusOK, customer)
+	}
+}
+
+func CreateCustomer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var customer models.Customer
+		if err := c.BindJSON(&customer); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(customer); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		customer.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		customer.Updated_at = customer.Created_at
+		customer.ID = primitive.NewObjectID()
+		customer.Customer_id = customer.ID.Hex()
+
+		// The unique index on customer_phone rejects a second customer with the same phone number
+		if _, err := customerCollection.InsertOne(ctx, customer); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "a customer with this phone number already exists"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "customer was not created"})
+			return
+		}
+		maskedJSON(c, http.StatusOK, customer)
+	}
+}
+
+func UpdateCustomer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var customer models.Customer
+		if err := c.BindJSON(&customer); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.StructExcept(customer, "Customer_name"); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var updateObj primitive.D
+		if customer.Customer_name != nil {
+			if validationErr := validate.Var(*customer.Customer_name, "min=2,max=100"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"customer_name", customer.Customer_name})
+		}
+		if customer.Customer_phone != nil {
+			updateObj = append(updateObj, bson.E{"customer_phone", customer.Customer_phone})
+		}
+		if customer.Customer_email != nil {
+			updateObj = append(updateObj, bson.E{"customer_email", customer.Customer_email})
+		}
+		if customer.Notes != nil {
+			updateObj = append(updateObj, bson.E{"notes", customer.Notes})
+		}
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{"updated_at", updatedAt})
+
+		var updated models.Customer
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		err := customerCollection.FindOneAndUpdate(ctx, bson.M{"customer_id": c.Param("customer_id")}, bson.D{{"$set", updateObj}}, opts).Decode(&updated)
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "a customer with this phone number already exists"})
+			return
+		}
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "customer was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "customer update failed"})
+			return
+		}
+		maskedJSON(c, http.StatusOK, updated)
+	}
+}
+
+// GetCustomerHistory returns a customer's visits and spend, their most ordered foods and their latest
+// visits (limit, default 50) with what they spent on each
+func GetCustomerHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		limit := 50
+		if c.Query("limit") != "" {
+			value, err := strconv.Atoi(c.Query("limit"))
+			if err != nil || value < 1 || value > 500 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+				return
+			}
+			limit = value
+		}
+
+		history := CustomerHistory{Favorites: []CustomerFavorite{}, Visits: []CustomerVisit{}}
+		customerId := c.Param("customer_id")
+		if err := customerCollection.FindOne(ctx, bson.M{"customer_id": customerId}).Decode(&history.Customer); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "customer was not found"})
+			return
+		}
+		stats, err := customerStats(ctx, []string{customerId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating the customer's spend"})
+			return
+		}
+		if customer, ok := stats[customerId]; ok {
+			history.Stats = *customer
+		}
+
+		opts := options.Find().SetSort(bson.D{{"created_at", -1}}).SetLimit(int64(limit))
+		cursor, err := orderCollection.Find(ctx, bson.M{"customer_id": customerId}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the customer's orders"})
+			return
+		}
+		var orders []models.Order
+		if err = cursor.All(ctx, &orders); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the customer's orders"})
+			return
+		}
+		orderIds := []string{}
+		for _, order := range orders {
+			orderIds = append(orderIds, order.Order_id)
+		}
+
+		// Split invoices are billed through their parts and void ones were never paid
+		cursor, err = invoiceCollection.Find(ctx, bson.M{"order_id": bson.M{"$in": orderIds}, "payment_status": bson.M{"$nin": bson.A{"SPLIT", "VOID"}}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the customer's invoices"})
+			return
+		}
+		var invoices []models.Invoice
+		if err = cursor.All(ctx, &invoices); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the customer's invoices"})
+			return
+		}
+		invoiced := map[string]models.Invoice{}
+		for _, invoice := range invoices {
+			invoiced[invoice.Order_id] = invoice
+		}
+
+		for _, order := range orders {
+			visit := CustomerVisit{
+				Order_id:     order.Order_id,
+				Order_number: order.Order_number,
+				Channel:      order.Channel,
+				Location_id:  order.Location_id,
+				Status:       order.Status,
+				Created_at:   order.Created_at,
+			}
+			if invoice, ok := invoiced[order.Order_id]; ok {
+				visit.Invoice_id = &invoice.Invoice_id
+				visit.Invoice_number = &invoice.Invoice_number
+				visit.Payment_status = invoice.Payment_status
+				if invoice.Payment_status != nil && *invoice.Payment_status != "PENDING" {
+					visit.Spend = invoice.Grand_total - invoice.Refunded_amount
+				}
+			}
+			history.Visits = append(history.Visits, visit)
+		}
+
+		result, err := orderItemCollection.Aggregate(ctx, mongo.Pipeline{
+			bson.D{{"$lookup", bson.D{{"from", "order"}, {"localField", "order_id"}, {"foreignField", "order_id"}, {"as", "order"}}}},
+			bson.D{{"$match", bson.D{{"order.customer_id", customerId}, {"status", bson.D{{"$ne", "VOIDED"}}}, {"food_id", bson.D{{"$ne", nil}}}}}},
+			bson.D{{"$lookup", bson.D{{"from", "food"}, {"localField", "food_id"}, {"foreignField", "food_id"}, {"as", "food"}}}},
+			bson.D{{"$unwind", "$food"}},
+			bson.D{{"$group", bson.D{{"_id", "$food_id"}, {"name", bson.D{{"$first", "$food.name"}}}, {"quantity", bson.D{{"$sum", 1}}}}}},
+			bson.D{{"$sort", bson.D{{"quantity", -1}, {"name", 1}}}},
+			bson.D{{"$limit", 5}},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while finding the customer's favorites"})
+			return
+		}
+		if err = result.All(ctx, &history.Favorites); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while finding the customer's favorites"})
+			return
+		}
+
+		maskedJSON(c, http.StatusOK, history)
+	}
+}
+
+// GetCustomerSegment finds the customers matching a segment, to target offers: min_visits, max_visits,
+// min_spend and max_spend (lifetime spend in major units), last_visit_after and last_visit_before
+// (RFC3339). Customers are sorted by lifetime_spend (default), visits or last_visit, descending; limit
+// is the number of customers returned (default 100).
+func GetCustomerSegment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		bounds := map[string]float64{}
+		for _, name := range []string{"min_visits", "max_visits", "min_spend", "max_spend"} {
+			if value := c.Query(name); value != "" {
+				parsed, err := strconv.ParseFloat(value, 64)
+				if err != nil || parsed < 0 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a positive number"})
+					return
+				}
+				bounds[name] = parsed
+			}
+		}
+		visits := map[string]time.Time{}
+		for _, name := range []string{"last_visit_after", "last_visit_before"} {
+			if value := c.Query(name); value != "" {
+				parsed, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be an RFC3339 timestamp"})
+					return
+				}
+				visits[name] = parsed
+			}
+		}
+		sortBy := c.DefaultQuery("sort", "lifetime_spend")
+		if sortBy != "lifetime_spend" && sortBy != "visits" && sortBy != "last_visit" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be lifetime_spend, visits or last_visit"})
+			return
+		}
+		limit := 100
+		if c.Query("limit") != "" {
+			value, err := strconv.Atoi(c.Query("limit"))
+			if err != nil || value < 1 || value > 1000 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+				return
+			}
+			limit = value
+		}
+
+		stats, err := customerStats(ctx, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating customer spend"})
+			return
+		}
+		matches := func(customer CustomerStats) bool {
+			if value, ok := bounds["min_visits"]; ok && float64(customer.Visits) < value {
+				return false
+			}
+			if value, ok := bounds["max_visits"]; ok && float64(customer.Visits) > value {
+				return false
+			}
+			if value, ok := bounds["min_spend"]; ok && customer.Lifetime_spend < models.MoneyFromFloat(value) {
+				return false
+			}
+			if value, ok := bounds["max_spend"]; ok && customer.Lifetime_spend > models.MoneyFromFloat(value) {
+				return false
+			}
+			if value, ok := visits["last_visit_after"]; ok && (customer.Last_visit == nil || !customer.Last_visit.After(value)) {
+				return false
+			}
+			if value, ok := visits["last_visit_before"]; ok && customer.Last_visit != nil && !customer.Last_visit.Before(value) {
+				return false
+			}
+			return true
+		}
+
+		// Customers without a visit only match segments that do not ask for visits or spend
+		cursor, err := customerCollection.Find(ctx, bson.M{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing customers"})
+			return
+		}
+		var customers []models.Customer
+		if err = cursor.All(ctx, &customers); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing customers"})
+			return
+		}
+		segment := []CustomerSegmentEntry{}
+		for _, customer := range customers {
+			entry := CustomerSegmentEntry{Customer: customer}
+			if customer, ok := stats[customer.Customer_id]; ok {
+				entry.CustomerStats = *customer
+			}
+			if matches(entry.CustomerStats) {
+				segment = append(segment, entry)
+			}
+		}
+
+		sort.SliceStable(segment, func(i, j int) bool {
+			switch sortBy {
+			case "visits":
+				return segment[i].Visits > segment[j].Visits
+			case "last_visit":
+				if segment[i].Last_visit == nil || segment[j].Last_visit == nil {
+					return segment[j].Last_visit == nil && segment[i].Last_visit != nil
+				}
+				return segment[i].Last_visit.After(*segment[j].Last_visit)
+			}
+			return segment[i].Lifetime_spend > segment[j].Lifetime_spend
+		})
+		if len(segment) > limit {
+			segment = segment[:limit]
+		}
+		maskedJSON(c, http.StatusOK, segment)
+	}
+}
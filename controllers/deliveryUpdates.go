@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/models"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// sendDeliveryUpdate texts the guest of a DELIVERY order about its progress: DELIVERY_DISPATCHED once
+// all its items were handed over, DELIVERY_ETA_CHANGED when it is expected at another time than promised.
+// Orders of other channels and orders without a customer_phone are skipped.
+func sendDeliveryUpdate(ctx context.Context, order models.Order, messageType string) {
+	if order.Channel == nil || *order.Channel != "DELIVERY" || order.Customer_phone == nil || *order.Customer_phone == "" {
+		return
+	}
+
+	var body string
+	switch messageType {
+	case "DELIVERY_DISPATCHED":
+		body = fmt.Sprintf("Your order #%d is on its way!", order.Order_number)
+		if order.Delivery_eta != nil {
+			body = fmt.Sprintf("Your order #%d is on its way and should arrive around %s.", order.Order_number, order.Delivery_eta.Local().Format("15:04"))
+		}
+	case "DELIVERY_ETA_CHANGED":
+		if order.Delivery_eta == nil {
+			return
+		}
+		body = fmt.Sprintf("Your order #%d is now expected around %s. Sorry for the change!", order.Order_number, order.Delivery_eta.Local().Format("15:04"))
+	default:
+		return
+	}
+	queueMessage(ctx, "SMS", *order.Customer_phone, "", body, messageType, order.Order_id)
+}
+
+// sendDeliveryStatusUpdate texts the guest of a DELIVERY order whose status changed, when the new
+// status is one guests are told about
+func sendDeliveryStatusUpdate(ctx context.Context, orderId string, status string) {
+	if status != "DELIVERED" {
+		return
+	}
+	var order models.Order
+	if err := orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order); err != nil {
+		log.Println("failed to load the order of a delivery update:", err)
+		return
+	}
+	sendDeliveryUpdate(ctx, order, "DELIVERY_DISPATCHED")
+}
@@ -0,0 +1,326 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"golang-restaurant-management/database"
+	helper "golang-restaurant-management/helpers"
+	"golang-restaurant-management/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var deviceCollection *mongo.Collection = database.OpenCollection(database.Client, "device")
+
+var devicePairingCollection *mongo.Collection = database.OpenCollection(database.Client, "devicePairing")
+
+// pairingCodeAlphabet leaves out characters that are easily confused on kiosk screens (0/O, 1/I, 5/S, ...)
+const pairingCodeAlphabet = "ACDEFGHJKLMNPQRTUVWXY3479"
+
+const pairingCodeLifetime = 10 * time.Minute
+
+// deviceScopes lists the requests each type of device token may make, as a method and a path where
+// ":name" matches any one segment and a trailing "*" matches the rest of the path
+var deviceScopes = map[string][]string{
+	"KDS": {
+		"GET /orderItems/*",
+		"GET /orderItems-order/:order_id",
+		"GET /orders/*",
+		"POST /orderItems/:orderItem_id/bump",
+		"POST /orderItems/:orderItem_id/recall",
+		"POST /orderItems/:orderItem_id/serve",
+		"GET /kitchen/*",
+		"GET /ws",
+	},
+	// Table tablets show the menu and let guests order for their table
+	"TABLE_TABLET": {
+		"GET /menus/*",
+		"GET /categories/*",
+		"GET /foods/*",
+		"GET /search/*",
+		"POST /orders",
+		"GET /orders/:order_id",
+		"POST /orderItems",
+		"GET /orderItems/:orderItem_id",
+		"GET /orderItems-order/:order_id",
+	},
+	// Scales at a weighing station add weighed items to orders and re-weigh them
+	"SCALE": {
+		"GET /foods/*",
+		"POST /orderItems",
+		"PATCH /orderItems/:orderItem_id",
+	},
+}
+
+var errTabletOtherTable = errors.New("a table tablet can only order for and see the orders of its own table")
+
+// checkTabletTable checks that a table tablet's request is for an order on the tablet's table, or on the
+// combined table it is part of. Requests from users and other devices are not restricted.
+func checkTabletTable(ctx context.Context, c *gin.Context, tableId *string) error {
+	deviceId := c.GetString("device_id")
+	if deviceId == "" {
+		return nil
+	}
+	var device models.Device
+	if err := deviceCollection.FindOne(ctx, bson.M{"device_id": deviceId}).Decode(&device); err != nil {
+		return errors.New("device was not found")
+	}
+	if device.Device_type != "TABLE_TABLET" {
+		return nil
+	}
+	if device.Table_id == nil || tableId == nil {
+		return errTabletOtherTable
+	}
+	if *tableId == *device.Table_id {
+		return nil
+	}
+	var table models.Table
+	if err := tableCollection.FindOne(ctx, bson.M{"table_id": *device.Table_id}).Decode(&table); err == nil && table.Combined_into != nil && *table.Combined_into == *tableId {
+		return nil
+	}
+	return errTabletOtherTable
+}
+
+// RequestDevicePairing is called by an unpaired device; it returns the short code to display
+// and the secret the device needs to collect its token once a manager has confirmed the code
+func RequestDevicePairing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var pairing models.DevicePairing
+
+		if err := c.BindJSON(&pairing); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(pairing); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		// Codes only need to be unique among pairings that are still pending
+		var code string
+		for attempt := 0; attempt < 5 && code == ""; attempt++ {
+			candidate, err := helper.RandomCode(6, pairingCodeAlphabet)
+			if err != nil {
+				break
+			}
+			count, err := devicePairingCollection.CountDocuments(ctx, bson.M{"code": candidate, "status": "PENDING", "expires_at": bson.M{"$gt": now}})
+			if err == nil && count == 0 {
+				code = candidate
+			}
+		}
+		secret, err := helper.RandomToken(16)
+		if code == "" || err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "pairing code could not be generated"})
+			return
+		}
+
+		pairing.ID = primitive.NewObjectID()
+		pairing.Pairing_id = pairing.ID.Hex()
+		pairing.Code = code
+		pairing.Poll_secret = secret
+		pairing.Status = "PENDING"
+		pairing.Device_id = nil
+		pairing.Created_at = now
+		pairing.Expires_at = now.Add(pairingCodeLifetime)
+
+		if _, err := devicePairingCollection.InsertOne(ctx, pairing); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "pairing was not created"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"pairing_id":  pairing.Pairing_id,
+			"code":        pairing.Code,
+			"poll_secret": pairing.Poll_secret,
+			"expires_at":  pairing.Expires_at,
+		})
+	}
+}
+
+// GetDevicePairing is polled by the device with its X-Pairing-Secret header. The first poll after
+// a manager confirmed the code returns the device token; the token is handed out only once.
+func GetDevicePairing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		pairingId := c.Param("pairing_id")
+		secret := c.GetHeader("X-Pairing-Secret")
+		if secret == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing pairing secret"})
+			return
+		}
+
+		var pairing models.DevicePairing
+		if err := devicePairingCollection.FindOne(ctx, bson.M{"pairing_id": pairingId, "poll_secret": secret}).Decode(&pairing); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "pairing was not found"})
+			return
+		}
+
+		switch pairing.Status {
+		case "PENDING":
+			if time.Now().After(pairing.Expires_at) {
+				c.JSON(http.StatusGone, gin.H{"error": "pairing code has expired, request a new one"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"status": "PENDING", "expires_at": pairing.Expires_at})
+			return
+		case "CLAIMED":
+			c.JSON(http.StatusGone, gin.H{"error": "the device token was already collected"})
+			return
+		}
+
+		var device models.Device
+		if err := deviceCollection.FindOne(ctx, bson.M{"device_id": pairing.Device_id, "revoked_at": nil}).Decode(&device); err != nil {
+			c.JSON(http.StatusGone, gin.H{"error": "the paired device was revoked"})
+			return
+		}
+
+		result, err := devicePairingCollection.UpdateOne(ctx, bson.M{"pairing_id": pairingId, "status": "CONFIRMED"}, bson.D{{"$set", bson.D{{"status", "CLAIMED"}}}})
+		if err != nil || result.ModifiedCount == 0 {
+			c.JSON(http.StatusGone, gin.H{"error": "the device token was already collected"})
+			return
+		}
+
+		validFor := time.Duration(envInt("DEVICE_TOKEN_DAYS", 90)) * 24 * time.Hour
+		token, err := helper.GenerateDeviceToken(device.Device_id, deviceScopes[device.Device_type], validFor)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "device token could not be generated"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "CLAIMED", "device_id": device.Device_id, "token": token})
+	}
+}
+
+type DevicePairingConfirmation struct {
+	Code     *string `json:"code" validate:"required"`
+	Name     *string `json:"name" validate:"required,min=2,max=100"`
+	Table_id *string `json:"table_id"`
+}
+
+// ConfirmDevicePairing is called by a manager with the code shown on the device
+func ConfirmDevicePairing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var confirmation DevicePairingConfirmation
+
+		if err := c.BindJSON(&confirmation); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(confirmation); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		code := strings.ToUpper(strings.TrimSpace(*confirmation.Code))
+
+		var pairing models.DevicePairing
+		err := devicePairingCollection.FindOne(ctx, bson.M{"code": code, "status": "PENDING", "expires_at": bson.M{"$gt": now}}).Decode(&pairing)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "pairing code was not found or has expired"})
+			return
+		}
+
+		if *pairing.Device_type == "TABLE_TABLET" {
+			if confirmation.Table_id == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "a table_id is required to pair a table tablet"})
+				return
+			}
+			count, err := tableCollection.CountDocuments(ctx, bson.M{"table_id": confirmation.Table_id})
+			if err != nil || count == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "table was not found"})
+				return
+			}
+		}
+
+		var device models.Device
+		device.ID = primitive.NewObjectID()
+		device.Device_id = device.ID.Hex()
+		device.Device_type = *pairing.Device_type
+		device.Name = *confirmation.Name
+		device.Table_id = confirmation.Table_id
+		device.Paired_by = c.GetString("uid")
+		device.Created_at = now
+
+		// The device exists before the pairing is confirmed, so the device's poll always finds it
+		if _, err := deviceCollection.InsertOne(ctx, device); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "device was not created"})
+			return
+		}
+
+		result, err := devicePairingCollection.UpdateOne(
+			ctx,
+			bson.M{"pairing_id": pairing.Pairing_id, "status": "PENDING"},
+			bson.D{{"$set", bson.D{{"status", "CONFIRMED"}, {"device_id", device.Device_id}}}},
+		)
+		if err != nil || result.ModifiedCount == 0 {
+			deviceCollection.DeleteOne(ctx, bson.M{"device_id": device.Device_id})
+			c.JSON(http.StatusConflict, gin.H{"error": "pairing was already confirmed"})
+			return
+		}
+		c.JSON(http.StatusOK, device)
+	}
+}
+
+func GetDevices() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if c.Query("include_revoked") != "true" {
+			filter["revoked_at"] = nil
+		}
+
+		opts := options.Find().SetSort(bson.D{{"created_at", -1}})
+		result, err := deviceCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing devices"})
+			return
+		}
+
+		var devices []models.Device
+		if err = result.All(ctx, &devices); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing devices"})
+			return
+		}
+		c.JSON(http.StatusOK, devices)
+	}
+}
+
+func RevokeDevice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		deviceId := c.Param("device_id")
+		revokedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		result, err := deviceCollection.UpdateOne(ctx, bson.M{"device_id": deviceId, "revoked_at": nil}, bson.D{{"$set", bson.D{{"revoked_at", revokedAt}}}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "device could not be revoked"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "device was not found or is already revoked"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
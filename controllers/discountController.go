@@ -0,0 +1,439 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var discountCollection *mongo.Collection = database.OpenCollection(database.Client, "discount")
+
+func GetDiscounts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if c.Query("active") == "true" {
+			filter["active"] = bson.M{"$ne": false}
+		}
+
+		result, err := discountCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{"created_at", -1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing discounts"})
+			return
+		}
+		allDiscounts := []models.Discount{}
+		if err = result.All(ctx, &allDiscounts); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing discounts"})
+			return
+		}
+		c.JSON(http.StatusOK, allDiscounts)
+	}
+}
+
+func GetDiscount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var discount models.Discount
+		if err := discountCollection.FindOne(ctx, bson.M{"discount_id": c.Param("discount_id")}).Decode(&discount); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "discount was not found"})
+			return
+		}
+		c.JSON(http.StatusOK, discount)
+	}
+}
+
+func CreateDiscount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var discount models.Discount
+
+		if err := c.BindJSON(&discount); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		validationErr := validate.Struct(discount)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if msg := checkDiscount(discount); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		if discount.Code != nil {
+			code := strings.ToUpper(*discount.Code)
+			discount.Code = &code
+		}
+		if discount.Active == nil {
+			active := true
+			discount.Active = &active
+		}
+		discount.Usage_count = 0
+		discount.Created_by = c.GetString("uid")
+		discount.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		discount.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		discount.ID = primitive.NewObjectID()
+		discount.Discount_id = discount.ID.Hex()
+
+		_, insertErr := discountCollection.InsertOne(ctx, discount)
+		if mongo.IsDuplicateKeyError(insertErr) {
+			c.JSON(http.StatusConflict, gin.H{"error": "a discount with this code already exists"})
+			return
+		}
+		if insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "discount was not created"})
+			return
+		}
+		c.JSON(http.StatusOK, discount)
+	}
+}
+
+func UpdateDiscount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var discount models.Discount
+		var existing models.Discount
+		discountId := c.Param("discount_id")
+
+		if err := c.BindJSON(&discount); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := discountCollection.FindOne(ctx, bson.M{"discount_id": discountId}).Decode(&existing); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "discount was not found"})
+			return
+		}
+
+		var updateObj primitive.D
+
+		if discount.Name != nil {
+			existing.Name = discount.Name
+			updateObj = append(updateObj, bson.E{"name", discount.Name})
+		}
+		if discount.Value != nil {
+			existing.Value = discount.Value
+			updateObj = append(updateObj, bson.E{"value", discount.Value})
+		}
+		if discount.Food_ids != nil {
+			existing.Food_ids = discount.Food_ids
+			updateObj = append(updateObj, bson.E{"food_ids", discount.Food_ids})
+		}
+		if discount.Valid_from != nil {
+			existing.Valid_from = discount.Valid_from
+			updateObj = append(updateObj, bson.E{"valid_from", discount.Valid_from})
+		}
+		if discount.Valid_until != nil {
+			existing.Valid_until = discount.Valid_until
+			updateObj = append(updateObj, bson.E{"valid_until", discount.Valid_until})
+		}
+		if discount.Usage_limit != nil {
+			existing.Usage_limit = discount.Usage_limit
+			updateObj = append(updateObj, bson.E{"usage_limit", discount.Usage_limit})
+		}
+		if discount.Active != nil {
+			existing.Active = discount.Active
+			updateObj = append(updateObj, bson.E{"active", discount.Active})
+		}
+
+		// Type, scope and code identify what guests were offered, so they cannot change
+		validationErr := validate.Struct(existing)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if msg := checkDiscount(existing); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{"updated_at", updatedAt})
+
+		result, err := discountCollection.UpdateOne(ctx, bson.M{"discount_id": discountId}, bson.D{{"$set", updateObj}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "discount update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// checkDiscount validates the rules that span several discount fields
+func checkDiscount(discount models.Discount) string {
+	if *discount.Type == "PERCENTAGE" && *discount.Value > 1 {
+		return "percentage discounts are given as a fraction, e.g. 0.1 for 10%"
+	}
+	if *discount.Scope == "ITEM" && len(discount.Food_ids) == 0 {
+		return "item discounts need at least one food_id"
+	}
+	if discount.Valid_from != nil && discount.Valid_until != nil && !discount.Valid_until.After(*discount.Valid_from) {
+		return "valid_until must be after valid_from"
+	}
+	return ""
+}
+
+type ApplyDiscountRequest struct {
+	Discount_id *string `json:"discount_id"`
+	Code        *string `json:"code"`
+}
+
+// ApplyDiscount applies a discount (by discount_id) or coupon (by code) to a pending invoice and
+// recalculates its totals. The discount's validity window and usage limit are checked here.
+func ApplyDiscount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request ApplyDiscountRequest
+		var invoice models.Invoice
+		var discount models.Discount
+
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := bson.M{"active": bson.M{"$ne": false}}
+		switch {
+		case request.Discount_id != nil:
+			filter["discount_id"] = *request.Discount_id
+		case request.Code != nil:
+			filter["code"] = strings.ToUpper(*request.Code)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "discount_id or code is required"})
+			return
+		}
+		if err := discountCollection.FindOne(ctx, filter).Decode(&discount); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "discount was not found or is not active"})
+			return
+		}
+
+		now := time.Now()
+		if (discount.Valid_from != nil && now.Before(*discount.Valid_from)) || (discount.Valid_until != nil && !now.Before(*discount.Valid_until)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "discount is not valid at this time"})
+			return
+		}
+
+		invoiceId := c.Param("invoice_id")
+		if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoiceId}).Decode(&invoice); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
+		if !invoiceRecalculable(invoice) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "discounts can only be applied to draft invoices"})
+			return
+		}
+		for _, applied := range invoice.Applied_discounts {
+			if applied.Discount_id == discount.Discount_id {
+				c.JSON(http.StatusConflict, gin.H{"error": "discount is already applied to this invoice"})
+				return
+			}
+		}
+
+		// Reserve a use of the discount before applying it, so limited coupons cannot be over-used
+		reserved, err := discountCollection.UpdateOne(
+			ctx,
+			bson.M{"discount_id": discount.Discount_id, "$or": bson.A{
+				bson.M{"usage_limit": nil},
+				bson.M{"$expr": bson.M{"$lt": bson.A{"$usage_count", "$usage_limit"}}},
+			}},
+			bson.D{{"$inc", bson.D{{"usage_count", 1}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "discount could not be applied"})
+			return
+		}
+		if reserved.ModifiedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "discount has reached its usage limit"})
+			return
+		}
+
+		appliedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		applied := models.AppliedDiscount{
+			Discount_id: discount.Discount_id,
+			Name:        *discount.Name,
+			Code:        discount.Code,
+			Applied_by:  c.GetString("uid"),
+			Applied_at:  appliedAt,
+		}
+		invoice.Applied_discounts = append(invoice.Applied_discounts, applied)
+
+		err = saveInvoiceTotals(ctx, &invoice, bson.M{"applied_discounts.discount_id": bson.M{"$ne": discount.Discount_id}})
+		if err != nil {
+			discountCollection.UpdateOne(ctx, bson.M{"discount_id": discount.Discount_id}, bson.D{{"$inc", bson.D{{"usage_count", -1}}}})
+			c.JSON(http.StatusConflict, gin.H{"error": "discount could not be applied, please retry"})
+			return
+		}
+
+		recordOrderRevisions(ctx, applied.Applied_by, orderRevision{orderId: invoice.Order_id, action: "DISCOUNT_APPLIED", field: "discount", newValue: invoice.Applied_discounts[len(invoice.Applied_discounts)-1]})
+		maskedJSON(c, http.StatusOK, invoice)
+	}
+}
+
+// RemoveDiscount takes a discount off a pending invoice and releases its use
+func RemoveDiscount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var invoice models.Invoice
+		invoiceId := c.Param("invoice_id")
+		discountId := c.Param("discount_id")
+
+		if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoiceId}).Decode(&invoice); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
+		if !invoiceRecalculable(invoice) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "discounts can only be removed from draft invoices"})
+			return
+		}
+
+		var removed *models.AppliedDiscount
+		var remaining []models.AppliedDiscount
+		for i, applied := range invoice.Applied_discounts {
+			if applied.Discount_id == discountId {
+				removed = &invoice.Applied_discounts[i]
+				continue
+			}
+			remaining = append(remaining, applied)
+		}
+		if removed == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "discount is not applied to this invoice"})
+			return
+		}
+		invoice.Applied_discounts = remaining
+
+		if err := saveInvoiceTotals(ctx, &invoice, bson.M{"applied_discounts.discount_id": discountId}); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "discount could not be removed, please retry"})
+			return
+		}
+		discountCollection.UpdateOne(ctx, bson.M{"discount_id": discountId, "usage_count": bson.M{"$gt": 0}}, bson.D{{"$inc", bson.D{{"usage_count", -1}}}})
+
+		recordOrderRevisions(ctx, c.GetString("uid"), orderRevision{orderId: invoice.Order_id, action: "DISCOUNT_REMOVED", field: "discount", oldValue: *removed})
+		maskedJSON(c, http.StatusOK, invoice)
+	}
+}
+
+// saveInvoiceTotals recalculates the totals of a draft invoice and stores them together with its discounts
+// and any extra fields. condition is added to the update filter; it returns an error if the invoice no
+// longer matches it.
+func saveInvoiceTotals(ctx context.Context, invoice *models.Invoice, condition bson.M, extra ...bson.E) error {
+	if err := calculateInvoiceTotals(ctx, invoice); err != nil {
+		return err
+	}
+	invoice.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	filter := bson.M{"invoice_id": invoice.Invoice_id, "payment_status": "PENDING", "invoice_status": bson.M{"$ne": "FINALIZED"}}
+	for key, value := range condition {
+		filter[key] = value
+	}
+
+	set := bson.D{
+		{"applied_discounts", invoice.Applied_discounts},
+		{"discount_total", invoice.Discount_total},
+		{"subtotal", invoice.Subtotal},
+		{"buffet_lines", invoice.Buffet_lines},
+		{"buffet_total", invoice.Buffet_total},
+		{"tax_lines", invoice.Tax_lines},
+		{"tax_total", invoice.Tax_total},
+		{"prices_include_tax", invoice.Prices_include_tax},
+		{"service_charge", invoice.Service_charge},
+		{"service_charge_lines", invoice.Service_charge_lines},
+		{"guests", invoice.Guests},
+		{"grand_total", invoice.Grand_total},
+		{"updated_at", invoice.Updated_at},
+	}
+	result, err := invoiceCollection.UpdateOne(ctx, filter, bson.D{{"$set", append(set, extra...)}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// appliedDiscountDefinitions loads the discounts applied to an invoice, by discount_id
+func appliedDiscountDefinitions(ctx context.Context, applied []models.AppliedDiscount) (map[string]models.Discount, error) {
+	discounts := map[string]models.Discount{}
+
+	var ids []string
+	for _, discount := range applied {
+		ids = append(ids, discount.Discount_id)
+	}
+	cursor, err := discountCollection.Find(ctx, bson.M{"discount_id": bson.M{"$in": ids}})
+	if err != nil {
+		return discounts, err
+	}
+	var found []models.Discount
+	if err = cursor.All(ctx, &found); err != nil {
+		return discounts, err
+	}
+	for _, discount := range found {
+		discounts[discount.Discount_id] = discount
+	}
+	return discounts, nil
+}
+
+// discountAmount is what a discount takes off the given billed items
+func discountAmount(discount models.Discount, orderItems []models.OrderItem) models.Money {
+	foods := map[string]bool{}
+	for _, foodId := range discount.Food_ids {
+		foods[foodId] = true
+	}
+
+	// A FIXED discount's value is an amount in major units
+	fixed := models.MoneyFromFloat(*discount.Value)
+
+	var base models.Money
+	matched := 0
+	for _, orderItem := range orderItems {
+		if *discount.Scope == "ITEM" && (orderItem.Food_id == nil || !foods[*orderItem.Food_id]) {
+			continue
+		}
+		// A fixed item discount never takes more than the item's price
+		if *discount.Scope == "ITEM" && *discount.Type == "FIXED" {
+			if fixed < *orderItem.Unit_price {
+				base += fixed
+			} else {
+				base += *orderItem.Unit_price
+			}
+		} else {
+			base += *orderItem.Unit_price
+		}
+		matched++
+	}
+	if matched == 0 {
+		return 0
+	}
+
+	switch {
+	case *discount.Type == "PERCENTAGE":
+		return base.Mul(*discount.Value)
+	case *discount.Scope == "ITEM":
+		return base
+	case fixed < base:
+		return fixed
+	default:
+		return base
+	}
+}
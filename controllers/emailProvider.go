@@ -0,0 +1,275 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	helper "golang-restaurant-management/helpers"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// outgoingEmail is an email handed to an email provider
+type outgoingEmail struct {
+	to      string
+	subject string
+	text    string
+	// html is the HTML version of the email, sent alongside the text when it is set
+	html string
+}
+
+// emailProvider sends emails. The provider is chosen with EMAIL_PROVIDER.
+type emailProvider interface {
+	// Name identifies the provider on the messages it sent
+	Name() string
+	// Send hands an email to the provider and returns the provider's id for it
+	Send(ctx context.Context, email outgoingEmail) (string, error)
+}
+
+// loadEmailProvider returns the configured email provider, or nil when EMAIL_PROVIDER is not set, in
+// which case emails stay queued
+func loadEmailProvider() (emailProvider, error) {
+	provider := strings.ToLower(os.Getenv("EMAIL_PROVIDER"))
+	if provider == "" {
+		return nil, nil
+	}
+	if provider == "log" {
+		return logEmailProvider{}, nil
+	}
+
+	from := mail.Address{Name: os.Getenv("EMAIL_FROM_NAME"), Address: os.Getenv("EMAIL_FROM")}
+	if from.Address == "" {
+		return nil, errors.New("EMAIL_FROM is required")
+	}
+	switch provider {
+	case "smtp":
+		smtpProvider := smtpEmailProvider{
+			host:     os.Getenv("SMTP_HOST"),
+			port:     os.Getenv("SMTP_PORT"),
+			username: os.Getenv("SMTP_USERNAME"),
+			password: os.Getenv("SMTP_PASSWORD"),
+			from:     from,
+		}
+		if smtpProvider.host == "" {
+			return nil, errors.New("SMTP_HOST is required")
+		}
+		if smtpProvider.port == "" {
+			smtpProvider.port = "587"
+		}
+		return smtpProvider, nil
+	case "sendgrid":
+		sendgrid := sendgridEmailProvider{apiKey: os.Getenv("SENDGRID_API_KEY"), apiUrl: os.Getenv("SENDGRID_API_URL"), from: from}
+		if sendgrid.apiKey == "" {
+			return nil, errors.New("SENDGRID_API_KEY is required")
+		}
+		if sendgrid.apiUrl == "" {
+			sendgrid.apiUrl = "https://api.sendgrid.com"
+		}
+		return sendgrid, nil
+	default:
+		return nil, fmt.Errorf("unknown EMAIL_PROVIDER %q, use smtp, sendgrid or log", provider)
+	}
+}
+
+// logEmailProvider writes emails to the log instead of sending them, for development
+type logEmailProvider struct{}
+
+func (logEmailProvider) Name() string {
+	return "log"
+}
+
+func (logEmailProvider) Send(ctx context.Context, email outgoingEmail) (string, error) {
+	log.Printf("email to %s: %s\n%s", email.to, email.subject, email.text)
+	return fmt.Sprintf("log-%d", time.Now().UnixNano()), nil
+}
+
+// smtpEmailProvider sends emails through an SMTP server: with implicit TLS on port 465, otherwise
+// upgraded with STARTTLS when the server offers it
+type smtpEmailProvider struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     mail.Address
+}
+
+func (smtpEmailProvider) Name() string {
+	return "smtp"
+}
+
+func (provider smtpEmailProvider) Send(ctx context.Context, email outgoingEmail) (string, error) {
+	token, err := helper.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	messageId := fmt.Sprintf("<%s@%s>", token, provider.host)
+	message, err := mimeEmail(provider.from, email, messageId)
+	if err != nil {
+		return "", err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(30 * time.Second)
+	}
+	address := net.JoinHostPort(provider.host, provider.port)
+	dialer := &net.Dialer{Deadline: deadline}
+	var conn net.Conn
+	if provider.port == "465" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: provider.host})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return "", err
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, provider.host)
+	if err != nil {
+		conn.Close()
+		return "", err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: provider.host}); err != nil {
+			return "", err
+		}
+	}
+	if provider.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", provider.username, provider.password, provider.host)); err != nil {
+			return "", err
+		}
+	}
+	if err := client.Mail(provider.from.Address); err != nil {
+		return "", err
+	}
+	if err := client.Rcpt(email.to); err != nil {
+		return "", err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write(message); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	return messageId, client.Quit()
+}
+
+// mimeEmail builds the MIME message of an email: the text alone, or the text and HTML versions as
+// multipart/alternative, both quoted-printable
+func mimeEmail(from mail.Address, email outgoingEmail, messageId string) ([]byte, error) {
+	to, err := mail.ParseAddress(email.to)
+	if err != nil {
+		return nil, err
+	}
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", from.String())
+	fmt.Fprintf(&message, "To: %s\r\n", to.String())
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Message-ID: %s\r\n", messageId)
+	message.WriteString("MIME-Version: 1.0\r\n")
+
+	part := func(contentType string, body string) {
+		fmt.Fprintf(&message, "Content-Type: %s; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n", contentType)
+		writer := quotedprintable.NewWriter(&message)
+		writer.Write([]byte(body))
+		writer.Close()
+		message.WriteString("\r\n")
+	}
+	if email.html == "" {
+		part("text/plain", email.text)
+		return message.Bytes(), nil
+	}
+
+	boundary, err := helper.RandomToken(12)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(&message, "--%s\r\n", boundary)
+	part("text/plain", email.text)
+	fmt.Fprintf(&message, "--%s\r\n", boundary)
+	part("text/html", email.html)
+	fmt.Fprintf(&message, "--%s--\r\n", boundary)
+	return message.Bytes(), nil
+}
+
+// sendgridEmailProvider sends emails with the SendGrid v3 Mail Send API
+type sendgridEmailProvider struct {
+	apiKey string
+	apiUrl string
+	from   mail.Address
+}
+
+func (sendgridEmailProvider) Name() string {
+	return "sendgrid"
+}
+
+func (provider sendgridEmailProvider) Send(ctx context.Context, email outgoingEmail) (string, error) {
+	type address struct {
+		Email string `json:"email"`
+		Name  string `json:"name,omitempty"`
+	}
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	contents := []content{{"text/plain", email.text}}
+	if email.html != "" {
+		contents = append(contents, content{"text/html", email.html})
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"personalizations": []map[string]interface{}{{"to": []address{{Email: email.to}}}},
+		"from":             address{Email: provider.from.Address, Name: provider.from.Name},
+		"subject":          email.subject,
+		"content":          contents,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(provider.apiUrl, "/")+"/v3/mail/send", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Authorization", "Bearer "+provider.apiKey)
+	request.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		var result struct {
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		json.NewDecoder(response.Body).Decode(&result)
+		reasons := []string{}
+		for _, sendgridErr := range result.Errors {
+			reasons = append(reasons, sendgridErr.Message)
+		}
+		return "", fmt.Errorf("SendGrid answered %d: %s", response.StatusCode, strings.Join(reasons, "; "))
+	}
+	return response.Header.Get("X-Message-Id"), nil
+}
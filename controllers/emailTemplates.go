@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"golang-restaurant-management/models"
+	"html/template"
+	texttemplate "text/template"
+)
+
+// emailTemplate renders an email: its subject and text with text/template, its HTML version with
+// html/template, so the values shown are escaped
+type emailTemplate struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *template.Template
+}
+
+// welcomeEmailView is what the welcome email is rendered with
+type welcomeEmailView struct {
+	First_name string
+}
+
+// passwordResetEmailView is what the password reset email is rendered with
+type passwordResetEmailView struct {
+	First_name      string
+	Reset_url       string
+	Expires_minutes int
+}
+
+// reservationEmailView is what the reservation confirmation email is rendered with
+type reservationEmailView struct {
+	Customer_name string
+	Party_size    int
+	When          string
+	Confirm_url   string
+	Cancel_url    string
+}
+
+// emailTemplates are the transactional emails, by name
+var emailTemplates = map[string]emailTemplate{
+	"welcome": {
+		subject: texttemplate.Must(texttemplate.New("subject").Parse(`Welcome aboard, {{.First_name}}`)),
+		text: texttemplate.Must(texttemplate.New("text").Parse(`Hi {{.First_name}},
+
+Your staff account has been created. Sign in with this email address and the password you chose.
+A manager will give you the role you need.
+`)),
+		html: template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+<p>Hi {{.First_name}},</p>
+<p>Your staff account has been created. Sign in with this email address and the password you chose.
+A manager will give you the role you need.</p>
+</body>
+</html>
+`)),
+	},
+	"password_reset": {
+		subject: texttemplate.Must(texttemplate.New("subject").Parse(`Reset your password`)),
+		text: texttemplate.Must(texttemplate.New("text").Parse(`Hi {{.First_name}},
+
+Someone asked to reset the password of your account. Choose a new password here:
+{{.Reset_url}}
+
+The link works once and expires in {{.Expires_minutes}} minutes. If you did not ask for it, ignore this email.
+`)),
+		html: template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+<p>Hi {{.First_name}},</p>
+<p>Someone asked to reset the password of your account.</p>
+<p><a href="{{.Reset_url}}">Choose a new password</a></p>
+<p>The link works once and expires in {{.Expires_minutes}} minutes. If you did not ask for it, ignore this email.</p>
+</body>
+</html>
+`)),
+	},
+	"invoice": {
+		subject: texttemplate.Must(texttemplate.New("subject").Parse(`{{.Title}} {{.Invoice_number}}`)),
+		text: texttemplate.Must(texttemplate.New("text").Parse(`{{.Title}} {{.Invoice_number}}
+{{.Date}}
+
+{{range .Lines}}{{.Description}}: {{.Amount}}
+{{end}}{{range .Totals}}{{.Description}}: {{.Amount}}
+{{end}}
+{{if .Paid}}Paid in full. Thank you for your visit!{{else}}Amount due: {{.Payment_due}}{{end}}
+{{if .Proforma}}Pro forma, this is not a tax invoice.
+{{end}}`)),
+		html: invoiceEmailTemplate,
+	},
+	"reservation_confirmation": {
+		subject: texttemplate.Must(texttemplate.New("subject").Parse(`Your reservation for {{.Party_size}} on {{.When}}`)),
+		text: texttemplate.Must(texttemplate.New("text").Parse(`Hi {{.Customer_name}},
+
+Your table for {{.Party_size}} on {{.When}} is booked.
+
+Confirm: {{.Confirm_url}}
+Cancel: {{.Cancel_url}}
+`)),
+		html: template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+<p>Hi {{.Customer_name}},</p>
+<p>Your table for {{.Party_size}} on <strong>{{.When}}</strong> is booked.</p>
+<p><a href="{{.Confirm_url}}">Confirm</a> &middot; <a href="{{.Cancel_url}}">Cancel</a></p>
+</body>
+</html>
+`)),
+	},
+}
+
+// renderEmail renders a template's subject, text and HTML versions
+func renderEmail(name string, data interface{}) (string, string, string, error) {
+	emailTemplate, ok := emailTemplates[name]
+	if !ok {
+		return "", "", "", fmt.Errorf("unknown email template %q", name)
+	}
+	var subject, text, html bytes.Buffer
+	if err := emailTemplate.subject.Execute(&subject, data); err != nil {
+		return "", "", "", err
+	}
+	if err := emailTemplate.text.Execute(&text, data); err != nil {
+		return "", "", "", err
+	}
+	if err := emailTemplate.html.Execute(&html, data); err != nil {
+		return "", "", "", err
+	}
+	return subject.String(), text.String(), html.String(), nil
+}
+
+// queueTemplatedEmail renders a template and queues the email, recording the template on the message
+func queueTemplatedEmail(ctx context.Context, to string, name string, data interface{}, messageType string, referenceId string) (models.OutboundMessage, error) {
+	subject, text, html, err := renderEmail(name, data)
+	if err != nil {
+		return models.OutboundMessage{}, err
+	}
+	message := newOutboundMessage("EMAIL", to, subject, text, messageType, referenceId)
+	message.Html = html
+	message.Template = &name
+	if _, err := outboundMessageCollection.InsertOne(ctx, message); err != nil {
+		return message, err
+	}
+	go sendQueuedMessage(message)
+	return message, nil
+}
@@ -0,0 +1,248 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// exceptionTypes are the kinds of exceptions the loss prevention report lists
+var exceptionTypes = []string{"DISCOUNT", "COMP", "ITEM_VOID", "INVOICE_VOID"}
+
+type ExceptionEntry struct {
+	Type               string       `json:"type" bson:"type"`
+	At                 time.Time    `json:"at" bson:"at"`
+	Amount             models.Money `json:"amount" bson:"amount"`
+	Reason             *string      `json:"reason" bson:"reason"`
+	Item               *string      `json:"item,omitempty" bson:"item"`
+	Employee_id        *string      `json:"employee_id" bson:"employee_id"`
+	Employee_name      string       `json:"employee_name" bson:"-"`
+	Authorized_by      *string      `json:"authorized_by" bson:"authorized_by"`
+	Authorized_by_name string       `json:"authorized_by_name" bson:"-"`
+	Server_id          *string      `json:"server_id" bson:"server_id"`
+	Order_id           *string      `json:"order_id" bson:"order_id"`
+	Invoice_id         *string      `json:"invoice_id,omitempty" bson:"invoice_id"`
+	Order_item_id      *string      `json:"order_item_id,omitempty" bson:"order_item_id"`
+}
+
+// exceptionQuery is a pipeline listing exceptions from one collection
+type exceptionQuery struct {
+	collection *mongo.Collection
+	pipeline   mongo.Pipeline
+}
+
+type ExceptionTotal struct {
+	Type   string       `json:"type"`
+	Count  int          `json:"count"`
+	Amount models.Money `json:"amount"`
+}
+
+type ExceptionsReport struct {
+	From        time.Time        `json:"from"`
+	To          time.Time        `json:"to"`
+	Type        *string          `json:"type"`
+	Employee_id *string          `json:"employee_id"`
+	Location_id *string          `json:"location_id"`
+	Totals      []ExceptionTotal `json:"totals"`
+	Exceptions  []ExceptionEntry `json:"exceptions"`
+}
+
+// GetExceptions lists the discounts, comps and voids of a period, the standard loss prevention report:
+// the optional from/to query parameters (RFC3339), by default the last 30 days. Comps are discounts
+// taking 100% off; item voids count for their item's price and invoice voids for the invoice's grand
+// total. Optional filters are type, location_id and employee_id, which matches the exceptions an employee
+// made as well as those on the orders they served. Exceptions are listed latest first, with totals per type.
+func GetExceptions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		from, to, err := reportPeriod(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		report := ExceptionsReport{From: from, To: to, Totals: []ExceptionTotal{}, Exceptions: []ExceptionEntry{}}
+		types := map[string]bool{}
+		for _, exceptionType := range exceptionTypes {
+			types[exceptionType] = true
+		}
+		if value := c.Query("type"); value != "" {
+			if !types[value] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "type must be DISCOUNT, COMP, ITEM_VOID or INVOICE_VOID"})
+				return
+			}
+			report.Type = &value
+		}
+
+		period := bson.D{{"$gte", from}, {"$lt", to}}
+		invoiceMatch := bson.D{}
+		itemLocation := bson.D{}
+		if locationId := c.Query("location_id"); locationId != "" {
+			report.Location_id = &locationId
+			invoiceMatch = append(invoiceMatch, bson.E{"location_id", locationId})
+			itemLocation = append(itemLocation, bson.E{"order.location_id", locationId})
+		}
+		// Every pipeline ends with its exceptions, the server of their order and the employee filter
+		lookupOrder := bson.D{{"$lookup", bson.D{{"from", "order"}, {"localField", "order_id"}, {"foreignField", "order_id"}, {"as", "order"}}}}
+		orderServer := bson.D{{"$arrayElemAt", bson.A{"$order.server_id", 0}}}
+		employeeMatch := bson.D{{"$match", bson.D{}}}
+		if employeeId := c.Query("employee_id"); employeeId != "" {
+			report.Employee_id = &employeeId
+			employeeMatch = bson.D{{"$match", bson.D{{"$or", bson.A{bson.D{{"employee_id", employeeId}}, bson.D{{"server_id", employeeId}}}}}}}
+		}
+
+		var pipelines []exceptionQuery
+		wanted := func(exceptionTypes ...string) bool {
+			for _, exceptionType := range exceptionTypes {
+				if report.Type == nil || *report.Type == exceptionType {
+					return true
+				}
+			}
+			return false
+		}
+
+		if wanted("DISCOUNT", "COMP") {
+			// Comps are discounts taking everything off: a percentage of 1
+			comp := bson.D{{"$and", bson.A{
+				bson.D{{"$eq", bson.A{bson.D{{"$arrayElemAt", bson.A{"$discount.type", 0}}}, "PERCENTAGE"}}},
+				bson.D{{"$gte", bson.A{bson.D{{"$arrayElemAt", bson.A{"$discount.value", 0}}}, 1}}},
+			}}}
+			match := append(bson.D{{"applied_discounts.applied_at", period}, {"payment_status", bson.D{{"$ne", "VOID"}}}}, invoiceMatch...)
+			pipeline := mongo.Pipeline{
+				bson.D{{"$match", match}},
+				bson.D{{"$unwind", "$applied_discounts"}},
+				bson.D{{"$match", bson.D{{"applied_discounts.applied_at", period}}}},
+				bson.D{{"$lookup", bson.D{{"from", "discount"}, {"localField", "applied_discounts.discount_id"}, {"foreignField", "discount_id"}, {"as", "discount"}}}},
+				lookupOrder,
+				bson.D{{"$project", bson.D{
+					{"type", bson.D{{"$cond", bson.A{comp, "COMP", "DISCOUNT"}}}},
+					{"at", "$applied_discounts.applied_at"},
+					{"amount", "$applied_discounts.amount"},
+					{"reason", "$applied_discounts.name"},
+					{"employee_id", "$applied_discounts.applied_by"},
+					{"server_id", orderServer},
+					{"order_id", "$order_id"},
+					{"invoice_id", "$invoice_id"},
+				}}},
+			}
+			if report.Type != nil {
+				pipeline = append(pipeline, bson.D{{"$match", bson.D{{"type", *report.Type}}}})
+			}
+			pipelines = append(pipelines, exceptionQuery{invoiceCollection, append(pipeline, employeeMatch)})
+		}
+
+		if wanted("ITEM_VOID") {
+			pipeline := mongo.Pipeline{
+				bson.D{{"$match", bson.D{{"status", "VOIDED"}, {"voided_at", period}}}},
+				lookupOrder,
+				bson.D{{"$match", itemLocation}},
+				bson.D{{"$lookup", bson.D{{"from", "food"}, {"localField", "food_id"}, {"foreignField", "food_id"}, {"as", "food"}}}},
+				bson.D{{"$project", bson.D{
+					{"type", bson.D{{"$literal", "ITEM_VOID"}}},
+					{"at", "$voided_at"},
+					{"amount", bson.D{{"$ifNull", bson.A{"$unit_price", 0}}}},
+					{"reason", "$void_reason"},
+					{"item", bson.D{{"$arrayElemAt", bson.A{"$food.name", 0}}}},
+					{"employee_id", "$voided_by"},
+					{"server_id", orderServer},
+					{"order_id", "$order_id"},
+					{"order_item_id", "$order_item_id"},
+				}}},
+				employeeMatch,
+			}
+			pipelines = append(pipelines, exceptionQuery{orderItemCollection, pipeline})
+		}
+
+		if wanted("INVOICE_VOID") {
+			// Invoices can only be voided by managers, who authorize the void themselves
+			match := append(bson.D{{"payment_status", "VOID"}, {"voided_at", period}}, invoiceMatch...)
+			pipeline := mongo.Pipeline{
+				bson.D{{"$match", match}},
+				lookupOrder,
+				bson.D{{"$project", bson.D{
+					{"type", bson.D{{"$literal", "INVOICE_VOID"}}},
+					{"at", "$voided_at"},
+					{"amount", "$grand_total"},
+					{"reason", "$void_reason"},
+					{"employee_id", "$voided_by"},
+					{"authorized_by", "$voided_by"},
+					{"server_id", orderServer},
+					{"order_id", "$order_id"},
+					{"invoice_id", "$invoice_id"},
+				}}},
+				employeeMatch,
+			}
+			pipelines = append(pipelines, exceptionQuery{invoiceCollection, pipeline})
+		}
+
+		for _, query := range pipelines {
+			result, err := query.collection.Aggregate(ctx, query.pipeline)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing exceptions"})
+				return
+			}
+			var entries []ExceptionEntry
+			if err = result.All(ctx, &entries); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing exceptions"})
+				return
+			}
+			report.Exceptions = append(report.Exceptions, entries...)
+		}
+
+		userIds := []string{}
+		for _, entry := range report.Exceptions {
+			for _, userId := range []*string{entry.Employee_id, entry.Authorized_by} {
+				if userId != nil {
+					userIds = append(userIds, *userId)
+				}
+			}
+		}
+		cursor, err := userCollection.Find(ctx, bson.M{"user_id": bson.M{"$in": userIds}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the employees"})
+			return
+		}
+		var users []models.User
+		if err = cursor.All(ctx, &users); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the employees"})
+			return
+		}
+		names := map[string]string{}
+		for _, user := range users {
+			names[user.User_id] = *user.First_name + " " + *user.Last_name
+		}
+
+		totals := map[string]*ExceptionTotal{}
+		for _, exceptionType := range exceptionTypes {
+			if report.Type == nil || *report.Type == exceptionType {
+				totals[exceptionType] = &ExceptionTotal{Type: exceptionType}
+			}
+		}
+		for i := range report.Exceptions {
+			entry := &report.Exceptions[i]
+			if entry.Employee_id != nil {
+				entry.Employee_name = names[*entry.Employee_id]
+			}
+			if entry.Authorized_by != nil {
+				entry.Authorized_by_name = names[*entry.Authorized_by]
+			}
+			totals[entry.Type].Count++
+			totals[entry.Type].Amount += entry.Amount
+		}
+		for _, exceptionType := range exceptionTypes {
+			if total, ok := totals[exceptionType]; ok {
+				report.Totals = append(report.Totals, *total)
+			}
+		}
+		sort.SliceStable(report.Exceptions, func(i, j int) bool { return report.Exceptions[i].At.After(report.Exceptions[j].At) })
+
+		c.JSON(http.StatusOK, report)
+	}
+}
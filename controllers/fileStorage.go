@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"golang-restaurant-management/database"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+// errFileNotFound is returned by file storages for keys they do not hold
+var errFileNotFound = errors.New("file was not found")
+
+// fileStorage stores uploaded files, such as food images, under slash separated keys
+type fileStorage interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// newFileStorage returns the storage configured by FILE_STORAGE: "local" (default) keeps files in the
+// FILE_STORAGE_DIR directory (default "uploads"), "gridfs" keeps them in MongoDB, so that every
+// instance of the API serves the same files
+func newFileStorage() (fileStorage, error) {
+	switch os.Getenv("FILE_STORAGE") {
+	case "", "local":
+		dir := os.Getenv("FILE_STORAGE_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		return localFileStorage{dir: dir}, nil
+	case "gridfs":
+		bucket, err := gridfs.NewBucket(database.Client.Database("restaurant"))
+		if err != nil {
+			return nil, err
+		}
+		return gridFSFileStorage{bucket: bucket}, nil
+	default:
+		return nil, fmt.Errorf("unknown file storage %s", os.Getenv("FILE_STORAGE"))
+	}
+}
+
+// validFileKey reports whether a key stays inside the storage, so keys taken from request paths
+// cannot reach other files
+func validFileKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, "/") && path.Clean(key) == key && !strings.HasPrefix(key, "..")
+}
+
+// localFileStorage keeps files in a directory of the server
+type localFileStorage struct {
+	dir string
+}
+
+// Put writes the file next to its final name first, so readers never see a partly written file
+func (s localFileStorage) Put(ctx context.Context, key string, data []byte) error {
+	if !validFileKey(key) {
+		return fmt.Errorf("invalid file key %s", key)
+	}
+	name := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(name+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+func (s localFileStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	if !validFileKey(key) {
+		return nil, errFileNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil, errFileNotFound
+	}
+	return data, err
+}
+
+// gridFSFileStorage keeps files in the fs.files and fs.chunks collections, named by their key
+type gridFSFileStorage struct {
+	bucket *gridfs.Bucket
+}
+
+func (s gridFSFileStorage) Put(ctx context.Context, key string, data []byte) error {
+	if !validFileKey(key) {
+		return fmt.Errorf("invalid file key %s", key)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.bucket.SetWriteDeadline(deadline)
+	}
+	_, err := s.bucket.UploadFromStream(key, bytes.NewReader(data))
+	return err
+}
+
+// Get returns the latest revision of the file
+func (s gridFSFileStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	if !validFileKey(key) {
+		return nil, errFileNotFound
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.bucket.SetReadDeadline(deadline)
+	}
+	var data bytes.Buffer
+	_, err := s.bucket.DownloadToStreamByName(key, &data)
+	if err == gridfs.ErrFileNotFound {
+		return nil, errFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
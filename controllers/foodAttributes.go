@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"golang-restaurant-management/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// normalizeFoodFlags stores allergens and dietary flags trimmed and upper case, without duplicates.
+// An empty list stays an empty list, since it declares the food free of allergens.
+func normalizeFoodFlags(flags []string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, flag := range flags {
+		flag = strings.ToUpper(strings.TrimSpace(flag))
+		if flag == "" || seen[flag] {
+			continue
+		}
+		seen[flag] = true
+		normalized = append(normalized, flag)
+	}
+	return normalized
+}
+
+// queryFoodFlags reads a comma separated list of allergens or dietary flags from the query
+func queryFoodFlags(c *gin.Context, name string) []string {
+	value := c.Query(name)
+	if value == "" {
+		return nil
+	}
+	return normalizeFoodFlags(strings.Split(value, ","))
+}
+
+// foodAttributeFilter builds the food filter for the dietary and allergen_free query parameters:
+// dietary=VEGAN,HALAL keeps foods with all of the flags, and allergen_free=NUTS,GLUTEN keeps foods
+// whose allergens were declared and include none of them
+func foodAttributeFilter(c *gin.Context) (bson.D, error) {
+	filter := bson.D{}
+	query := models.Food{Dietary_flags: queryFoodFlags(c, "dietary"), Allergens: queryFoodFlags(c, "allergen_free")}
+	if err := validate.StructPartial(query, "Dietary_flags", "Allergens"); err != nil {
+		return nil, err
+	}
+	if len(query.Dietary_flags) > 0 {
+		filter = append(filter, bson.E{"dietary_flags", bson.M{"$all": query.Dietary_flags}})
+	}
+	if len(query.Allergens) > 0 {
+		filter = append(filter, bson.E{"allergens", bson.M{"$type": "array", "$nin": query.Allergens}})
+	}
+	return filter, nil
+}
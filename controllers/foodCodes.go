@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// errDuplicateSku is returned when another food already uses a SKU
+var errDuplicateSku = errors.New("sku is already used by another food")
+
+// normalizeFoodSku stores SKUs trimmed and upper case, so scanned and typed codes match
+func normalizeFoodSku(sku string) string {
+	return strings.ToUpper(strings.TrimSpace(sku))
+}
+
+// checkFoodSku reports whether a SKU is free for the given food ("" for a new food). The unique index
+// on sku still catches two foods taking the same SKU at once.
+func checkFoodSku(ctx context.Context, sku *string, foodId string) error {
+	if sku == nil || *sku == "" {
+		return nil
+	}
+	count, err := foodCollection.CountDocuments(ctx, bson.M{"sku": *sku, "food_id": bson.M{"$ne": foodId}})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errDuplicateSku
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -42,7 +43,42 @@ func GetFoods() gin.HandlerFunc {
 		startIndex := (page - 1) * recordPerPage
 		startIndex, err = strconv.Atoi(c.Query("startIndex"))
 
-		matchStage := bson.D{{"$match", bson.D{{}}}}
+		// Foods can be filtered by category (slug or category_id), tag, dietary flags and allergens
+		filter, err := foodAttributeFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			defer cancel()
+			return
+		}
+		if value := c.Query("category"); value != "" {
+			var category models.Category
+			err := categoryCollection.FindOne(ctx, bson.M{"$or": bson.A{bson.M{"slug": categorySlug(value)}, bson.M{"category_id": value}}}).Decode(&category)
+			if err != nil && err != mongo.ErrNoDocuments {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing food items"})
+				defer cancel()
+				return
+			}
+			if category.Category_id != "" {
+				value = category.Category_id
+			}
+			filter = append(filter, bson.E{"category_id", value})
+		}
+		if tag := c.Query("tag"); tag != "" {
+			filter = append(filter, bson.E{"tags", strings.ToLower(strings.TrimSpace(tag))})
+		}
+		if menuId := c.Query("menu_id"); menuId != "" {
+			filter = append(filter, bson.E{"menu_id", menuId})
+		}
+		if sku := c.Query("sku"); sku != "" {
+			filter = append(filter, bson.E{"sku", normalizeFoodSku(sku)})
+		}
+		if !includeArchived(c) {
+			filter = append(filter, notArchived)
+		}
+
+		// Foods are listed per menu in their display order
+		matchStage := bson.D{{"$match", filter}}
+		sortStage := bson.D{{"$sort", bson.D{{"menu_id", 1}, {"_position", 1}, {"name", 1}}}}
 		groupStage := bson.D{{"$group", bson.D{{"_id", bson.D{{"_id", "null"}}}, {"total_count", bson.D{{"$sum", 1}}}, {"data", bson.D{{"$push", "$$ROOT"}}}}}}
 		projectStage := bson.D{
 			{
@@ -53,15 +89,36 @@ func GetFoods() gin.HandlerFunc {
 				}}}
 
 		result, err := foodCollection.Aggregate(ctx, mongo.Pipeline{
-			matchStage, groupStage, projectStage})
+			matchStage, foodPositionStage, sortStage, groupStage, projectStage})
 		defer cancel()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing food items"})
 		}
-		var allFoods []bson.M
+		// Decoded into models.Food so prices are returned in major units
+		var allFoods []struct {
+			Total_count int           `json:"total_count"`
+			Food_items  []models.Food `json:"food_items"`
+		}
 		if err = result.All(ctx, &allFoods); err != nil {
 			log.Fatal(err)
 		}
+		// Nothing is grouped when no food matches the filters
+		if len(allFoods) == 0 {
+			c.JSON(http.StatusOK, gin.H{"total_count": 0, "food_items": []models.Food{}})
+			return
+		}
+		accepted, base, err := requestLanguages(ctx, c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing food items"})
+			return
+		}
+		for i := range allFoods[0].Food_items {
+			localizeFood(&allFoods[0].Food_items[i], accepted, base)
+		}
+		if err := costFoods(ctx, allFoods[0].Food_items); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while costing food items"})
+			return
+		}
 		c.JSON(http.StatusOK, allFoods[0])
 	}
 }
@@ -76,8 +133,20 @@ func GetFood() gin.HandlerFunc {
 		defer cancel()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the food item"})
+			return
+		}
+		accepted, base, err := requestLanguages(ctx, c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the food item"})
+			return
+		}
+		localizeFood(&food, accepted, base)
+		foods := []models.Food{food}
+		if err := costFoods(ctx, foods); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while costing the food item"})
+			return
 		}
-		c.JSON(http.StatusOK, food)
+		c.JSON(http.StatusOK, foods[0])
 	}
 }
 
@@ -91,27 +160,48 @@ func CreateFood() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-
-		validationErr := validate.Struct(food)
-		if validationErr != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+		if err := checkNewFood(ctx, &food); err == errDuplicateSku {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 		err := menuCollection.FindOne(ctx, bson.M{"menu_id": food.Menu_id}).Decode(&menu)
 		defer cancel()
 		if err != nil {
 			msg := fmt.Sprintf("menu was not found")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		if menu.Deleted_at != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "menu is archived"})
 			return
 		}
 		food.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		food.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		food.ID = primitive.NewObjectID()
 		food.Food_id = food.ID.Hex()
-		var num = toFixed(*food.Price, 2)
-		food.Price = &num
+		// New foods are shown last on their menu unless given a position
+		if food.Sort_order == nil {
+			sortOrder, err := nextFoodSortOrder(ctx, *food.Menu_id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Food item was not created"})
+				return
+			}
+			food.Sort_order = &sortOrder
+		}
+		food.Version, err = nextMenuVersion(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Food item was not created"})
+			return
+		}
 
 		result, insertErr := foodCollection.InsertOne(ctx, food)
+		if mongo.IsDuplicateKeyError(insertErr) {
+			c.JSON(http.StatusConflict, gin.H{"error": errDuplicateSku.Error()})
+			return
+		}
 		if insertErr != nil {
 			msg := fmt.Sprintf("Food item was not created")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
@@ -122,6 +212,60 @@ func CreateFood() gin.HandlerFunc {
 	}
 }
 
+// checkNewFood normalizes and validates a complete food, as it is created or replaced in a menu draft
+func checkNewFood(ctx context.Context, food *models.Food) error {
+	if food.Allergens != nil {
+		food.Allergens = normalizeFoodFlags(food.Allergens)
+	}
+	if food.Dietary_flags != nil {
+		food.Dietary_flags = normalizeFoodFlags(food.Dietary_flags)
+	}
+	if food.Sku != nil {
+		sku := normalizeFoodSku(*food.Sku)
+		food.Sku = &sku
+		if sku == "" {
+			food.Sku = nil
+		}
+	}
+
+	if err := validate.Struct(*food); err != nil {
+		return err
+	}
+	if err := validateFoodTranslations(food.Translations); err != nil {
+		return err
+	}
+	if err := validateFoodOptionGroups(food.Option_groups); err != nil {
+		return err
+	}
+	if err := validateRelatedItems(ctx, food.Food_id, food.Related_items); err != nil {
+		return err
+	}
+	if err := validateFoodPricing(*food); err != nil {
+		return err
+	}
+	if err := validateTaxClass(ctx, food.Tax_class); err != nil {
+		return err
+	}
+	if err := validateFoodCategory(ctx, food.Category_id); err != nil {
+		return err
+	}
+	if err := checkFoodSku(ctx, food.Sku, food.Food_id); err != nil {
+		return err
+	}
+	if food.Category_id != nil && *food.Category_id == "" {
+		food.Category_id = nil
+	}
+	if food.Tags != nil {
+		food.Tags = normalizeFoodTags(food.Tags)
+	}
+	food.Station = normalizeFoodStation(food.Station)
+	// Foods are archived with DELETE /foods/:food_id
+	food.Deleted_at = nil
+	// Prices are scheduled with PUT /foods/:food_id/scheduled-price
+	food.Scheduled_price = nil
+	return nil
+}
+
 func round(num float64) int {
 	return int(num + math.Copysign(0.5, num))
 }
@@ -144,6 +288,13 @@ func UpdateFood() gin.HandlerFunc {
 			return
 		}
 
+		// Prices and costs are changed by managers, like scheduled prices; other staff can edit the rest
+		changesPrices := food.Price != nil || food.Size_prices != nil || food.Price_per_unit != nil || food.Option_groups != nil || food.Cost != nil
+		if role := c.GetString("role"); changesPrices && role != "MANAGER" && role != "ADMIN" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only managers can change the prices and costs of a food"})
+			return
+		}
+
 		var updateObj primitive.D
 
 		if food.Name != nil {
@@ -151,28 +302,235 @@ func UpdateFood() gin.HandlerFunc {
 		}
 
 		if food.Price != nil {
+			if *food.Price < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "price cannot be negative"})
+				return
+			}
 			updateObj = append(updateObj, bson.E{"price", food.Price})
 		}
 
+		// An image URL set by hand has no thumbnail
 		if food.Food_image != nil {
-			updateObj = append(updateObj, bson.E{"food_image", food.Food_image})
+			updateObj = append(updateObj, bson.E{"food_image", food.Food_image}, bson.E{"thumbnail_image", nil})
+		}
+
+		// An empty map of size prices sells the food at its price in every size again
+		if food.Size_prices != nil {
+			if validationErr := validate.StructPartial(food, "Size_prices"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+				return
+			}
+			if len(food.Size_prices) == 0 {
+				updateObj = append(updateObj, bson.E{"size_prices", nil})
+			} else {
+				updateObj = append(updateObj, bson.E{"size_prices", food.Size_prices})
+			}
+		}
+
+		// An empty SKU removes the food's SKU
+		if food.Sku != nil {
+			sku := normalizeFoodSku(*food.Sku)
+			if sku == "" {
+				updateObj = append(updateObj, bson.E{"sku", nil})
+			} else {
+				if validationErr := validate.Var(sku, "max=30,excludesall=0x20"); validationErr != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "sku must be at most 30 characters, without spaces"})
+					return
+				}
+				if err := checkFoodSku(ctx, &sku, foodId); err != nil {
+					c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+					return
+				}
+				updateObj = append(updateObj, bson.E{"sku", sku})
+			}
+		}
+
+		if food.Kitchen_name != nil {
+			if validationErr := validate.Var(food.Kitchen_name, "max=30"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "kitchen_name must be at most 30 characters"})
+				return
+			}
+			// An empty kitchen name shows the food's name on tickets again
+			if strings.TrimSpace(*food.Kitchen_name) == "" {
+				updateObj = append(updateObj, bson.E{"kitchen_name", nil})
+			} else {
+				updateObj = append(updateObj, bson.E{"kitchen_name", strings.TrimSpace(*food.Kitchen_name)})
+			}
+		}
+
+		if food.Image_alt_text != nil {
+			if validationErr := validate.Var(food.Image_alt_text, "max=250"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "image_alt_text must be at most 250 characters"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"image_alt_text", food.Image_alt_text})
+		}
+
+		if food.Description != nil {
+			if validationErr := validate.Struct(food.Description); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"description", food.Description})
+		}
+
+		// An empty map of translations removes them all
+		if food.Translations != nil {
+			if err := validateFoodTranslations(food.Translations); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"translations", food.Translations})
+		}
+
+		// An empty list of related items removes them all
+		if food.Related_items != nil {
+			if err := validateRelatedItems(ctx, foodId, food.Related_items); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"related_items", food.Related_items})
+		}
+
+		// An empty list of option groups removes them all
+		if food.Option_groups != nil {
+			if err := validateFoodOptionGroups(food.Option_groups); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"option_groups", food.Option_groups})
+		}
+
+		if food.Tax_class != nil {
+			if err := validateTaxClass(ctx, food.Tax_class); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			// An empty tax class puts the food back on the default tax rates
+			if *food.Tax_class == "" {
+				updateObj = append(updateObj, bson.E{"tax_class", nil})
+			} else {
+				updateObj = append(updateObj, bson.E{"tax_class", food.Tax_class})
+			}
+		}
+
+		if food.Category_id != nil {
+			if err := validateFoodCategory(ctx, food.Category_id); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			// An empty category takes the food out of its category
+			if *food.Category_id == "" {
+				updateObj = append(updateObj, bson.E{"category_id", nil})
+			} else {
+				updateObj = append(updateObj, bson.E{"category_id", food.Category_id})
+			}
+		}
+
+		if food.Station != nil {
+			if validationErr := validate.Var(*food.Station, "max=30"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "station must be at most 30 characters"})
+				return
+			}
+			// An empty station takes the food off its station
+			updateObj = append(updateObj, bson.E{"station", normalizeFoodStation(food.Station)})
+		}
+
+		if food.Tags != nil {
+			if validationErr := validate.Var(food.Tags, "max=20,dive,min=1,max=30"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "a food can have at most 20 tags of at most 30 characters"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"tags", normalizeFoodTags(food.Tags)})
+		}
+
+		if food.Allergens != nil || food.Dietary_flags != nil {
+			if food.Allergens != nil {
+				food.Allergens = normalizeFoodFlags(food.Allergens)
+				updateObj = append(updateObj, bson.E{"allergens", food.Allergens})
+			}
+			if food.Dietary_flags != nil {
+				food.Dietary_flags = normalizeFoodFlags(food.Dietary_flags)
+				updateObj = append(updateObj, bson.E{"dietary_flags", food.Dietary_flags})
+			}
+			if validationErr := validate.StructPartial(food, "Allergens", "Dietary_flags"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+				return
+			}
+		}
+
+		if food.Sort_order != nil {
+			if *food.Sort_order < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "sort_order cannot be negative"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"sort_order", food.Sort_order})
+		}
+
+		if food.Cost != nil {
+			if *food.Cost < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "cost cannot be negative"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"cost", food.Cost})
+		}
+
+		if food.Unit_of_measure != nil || food.Price_per_unit != nil {
+			if validationErr := validate.StructPartial(food, "Unit_of_measure", "Price_per_unit"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+				return
+			}
+			// The unit and price per unit are checked together with what is already stored
+			var existingFood models.Food
+			foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&existingFood)
+			if food.Unit_of_measure != nil {
+				existingFood.Unit_of_measure = food.Unit_of_measure
+				updateObj = append(updateObj, bson.E{"unit_of_measure", food.Unit_of_measure})
+			}
+			if food.Price_per_unit != nil {
+				existingFood.Price_per_unit = food.Price_per_unit
+				updateObj = append(updateObj, bson.E{"price_per_unit", food.Price_per_unit})
+			}
+			if err := validateFoodPricing(existingFood); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 		}
 
 		if food.Menu_id != nil {
 			err := menuCollection.FindOne(ctx, bson.M{"menu_id": food.Menu_id}).Decode(&menu)
 			defer cancel()
 			if err != nil {
-				msg := fmt.Sprintf("message:Menu was not found")
-				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				msg := fmt.Sprintf("menu was not found")
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
 				return
 			}
-			updateObj = append(updateObj, bson.E{"menu", food.Price})
+			if menu.Deleted_at != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": "menu is archived"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"menu_id", food.Menu_id})
+		}
+
+		// The prices before the change are kept for the price history
+		var previousFood models.Food
+		pricesChanged := food.Price != nil || food.Price_per_unit != nil || food.Size_prices != nil
+		if pricesChanged {
+			foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&previousFood)
+		}
+
+		version, err := nextMenuVersion(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "foot item update failed"})
+			return
 		}
+		updateObj = append(updateObj, bson.E{"version", version})
 
 		food.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		updateObj = append(updateObj, bson.E{"updated_at", food.Updated_at})
 
-		upsert := true
+		// Updating a food that does not exist must not create a partial food without a menu
+		upsert := false
 		filter := bson.M{"food_id": foodId}
 
 		opt := options.UpdateOptions{
@@ -188,11 +546,35 @@ func UpdateFood() gin.HandlerFunc {
 			&opt,
 		)
 
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": errDuplicateSku.Error()})
+			return
+		}
 		if err != nil {
 			msg := fmt.Sprint("foot item update failed")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			return
 		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
+		if pricesChanged {
+			updatedFood := previousFood
+			if food.Price != nil {
+				updatedFood.Price = food.Price
+			}
+			if food.Price_per_unit != nil {
+				updatedFood.Price_per_unit = food.Price_per_unit
+			}
+			if food.Size_prices != nil {
+				updatedFood.Size_prices = food.Size_prices
+			}
+			if food.Menu_id != nil {
+				updatedFood.Menu_id = food.Menu_id
+			}
+			recordFoodPriceChanges(ctx, "UPDATE", c.GetString("uid"), foodPriceChanges(previousFood, updatedFood))
+		}
 		c.JSON(http.StatusOK, result)
 	}
 }
@@ -0,0 +1,193 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// defaultMinFoodMarginPercent is the gross margin foods should make when the settings do not configure one
+const defaultMinFoodMarginPercent = 60.0
+
+// minFoodMarginPercent returns the gross margin foods should make on their price
+func minFoodMarginPercent(settings models.Settings) float64 {
+	if settings.Min_food_margin_percent != nil {
+		return *settings.Min_food_margin_percent
+	}
+	return defaultMinFoodMarginPercent
+}
+
+// recipeCosts returns the cost of one portion of the given foods from their recipes, at the latest unit
+// costs of the ingredients. Foods without a recipe, or with an ingredient that has no cost, are left out.
+func recipeCosts(ctx context.Context, foodIds []string) (map[string]models.Money, error) {
+	costs := map[string]models.Money{}
+	if len(foodIds) == 0 {
+		return costs, nil
+	}
+	cursor, err := recipeCollection.Find(ctx, bson.M{"food_id": bson.M{"$in": foodIds}})
+	if err != nil {
+		return nil, err
+	}
+	var recipes []models.Recipe
+	if err = cursor.All(ctx, &recipes); err != nil {
+		return nil, err
+	}
+
+	var itemIds []string
+	for _, recipe := range recipes {
+		for _, ingredient := range recipe.Ingredients {
+			itemIds = append(itemIds, *ingredient.Inventory_item_id)
+		}
+	}
+	cursor, err = inventoryItemCollection.Find(ctx, bson.M{"inventory_item_id": bson.M{"$in": itemIds}})
+	if err != nil {
+		return nil, err
+	}
+	var items []models.InventoryItem
+	if err = cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	unitCosts := map[string]float64{}
+	for _, item := range items {
+		if item.Unit_cost != nil {
+			unitCosts[item.Inventory_item_id] = *item.Unit_cost
+		}
+	}
+
+	for _, recipe := range recipes {
+		var total float64
+		costed := true
+		for _, ingredient := range recipe.Ingredients {
+			unitCost, ok := unitCosts[*ingredient.Inventory_item_id]
+			if !ok {
+				costed = false
+				break
+			}
+			total += *ingredient.Quantity * unitCost
+		}
+		if costed {
+			costs[recipe.Food_id] = models.MoneyFromFloat(total)
+		}
+	}
+	return costs, nil
+}
+
+// foodMarginPercent returns the share of a price left after a cost, in percent
+func foodMarginPercent(price models.Money, cost models.Money) float64 {
+	if price <= 0 {
+		return 0
+	}
+	return toFixed(float64(price-cost)/float64(price)*100, 2)
+}
+
+// foodCost returns the cost of a food for margins: the theoretical cost of its recipe from costs,
+// or else its recorded Cost. It is nil when the food has neither.
+func foodCost(food models.Food, costs map[string]models.Money) *models.Money {
+	if theoretical, ok := costs[food.Food_id]; ok {
+		return &theoretical
+	}
+	return food.Cost
+}
+
+// costFoods sets the theoretical cost and the margin of foods, from their recipe or else from their Cost
+func costFoods(ctx context.Context, foods []models.Food) error {
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		return err
+	}
+	var foodIds []string
+	for _, food := range foods {
+		foodIds = append(foodIds, food.Food_id)
+	}
+	costs, err := recipeCosts(ctx, foodIds)
+	if err != nil {
+		return err
+	}
+
+	minMargin := minFoodMarginPercent(settings)
+	for i := range foods {
+		food := &foods[i]
+		cost := food.Cost
+		if theoretical, ok := costs[food.Food_id]; ok {
+			food.Theoretical_cost = &theoretical
+			cost = &theoretical
+		}
+		if cost == nil || food.Price == nil {
+			continue
+		}
+		margin := *food.Price - *cost
+		marginPercent := foodMarginPercent(*food.Price, *cost)
+		food.Margin = &margin
+		food.Margin_percent = &marginPercent
+		food.Low_margin = marginPercent < minMargin
+	}
+	return nil
+}
+
+// checkFoodMargins alerts managers about the foods whose margin fell below the minimum because the unit
+// cost of an ingredient changed from oldUnitCost (nil when it had none) to newUnitCost. Foods already
+// below the minimum before the change are not reported again.
+func checkFoodMargins(ctx context.Context, item models.InventoryItem, oldUnitCost *float64, newUnitCost float64) error {
+	if oldUnitCost != nil && newUnitCost <= *oldUnitCost {
+		return nil
+	}
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		return err
+	}
+	minMargin := minFoodMarginPercent(settings)
+
+	cursor, err := recipeCollection.Find(ctx, bson.M{"ingredients.inventory_item_id": item.Inventory_item_id})
+	if err != nil {
+		return err
+	}
+	var recipes []models.Recipe
+	if err = cursor.All(ctx, &recipes); err != nil {
+		return err
+	}
+	quantities := map[string]float64{}
+	var foodIds []string
+	for _, recipe := range recipes {
+		for _, ingredient := range recipe.Ingredients {
+			if *ingredient.Inventory_item_id == item.Inventory_item_id {
+				quantities[recipe.Food_id] += *ingredient.Quantity
+			}
+		}
+		foodIds = append(foodIds, recipe.Food_id)
+	}
+	costs, err := recipeCosts(ctx, foodIds)
+	if err != nil {
+		return err
+	}
+
+	cursor, err = foodCollection.Find(ctx, bson.D{{"food_id", bson.M{"$in": foodIds}}, notArchived})
+	if err != nil {
+		return err
+	}
+	var foods []models.Food
+	if err = cursor.All(ctx, &foods); err != nil {
+		return err
+	}
+	for _, food := range foods {
+		cost, ok := costs[food.Food_id]
+		if !ok || food.Price == nil {
+			continue
+		}
+		margin := foodMarginPercent(*food.Price, cost)
+		if margin >= minMargin {
+			continue
+		}
+		if oldUnitCost != nil {
+			oldCost := cost - models.MoneyFromFloat(quantities[food.Food_id]*(newUnitCost-*oldUnitCost))
+			if foodMarginPercent(*food.Price, oldCost) < minMargin {
+				continue
+			}
+		}
+		notifyManagers(ctx, "FOOD_MARGIN_LOW", "Food margin below target",
+			fmt.Sprintf("The margin of %s fell to %.1f%% (target %.1f%%) after the cost of %s changed", *food.Name, margin, minMargin, *item.Name),
+			food.Food_id)
+	}
+	return nil
+}
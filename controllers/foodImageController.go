@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	// maxFoodImageBytes is the largest image file accepted for upload
+	maxFoodImageBytes = 10 << 20
+	// maxFoodImagePixels guards against small files that decode to huge images
+	maxFoodImagePixels = 40000000
+	// foodImageSize and foodThumbnailSize are the longest side of the stored images, in pixels
+	foodImageSize     = 1200
+	foodThumbnailSize = 300
+)
+
+// imageUrl returns the public URL a stored image is served at. The base URL is taken from
+// PUBLIC_BASE_URL (default http://localhost:8000).
+func imageUrl(key string) string {
+	baseUrl := os.Getenv("PUBLIC_BASE_URL")
+	if baseUrl == "" {
+		baseUrl = "http://localhost:8000"
+	}
+	return fmt.Sprintf("%s/public/images/%s", baseUrl, key)
+}
+
+// resizeImage scales an image down so its longest side is at most size pixels, averaging the source
+// pixels each target pixel covers. The image is flattened on white, as JPEG has no transparency.
+// Images that are already small enough are only flattened.
+func resizeImage(src image.Image, size int) *image.RGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	targetWidth, targetHeight := width, height
+	if width >= height && width > size {
+		targetWidth, targetHeight = size, height*size/width
+	} else if height > width && height > size {
+		targetWidth, targetHeight = width*size/height, size
+	}
+	if targetWidth < 1 {
+		targetWidth = 1
+	}
+	if targetHeight < 1 {
+		targetHeight = 1
+	}
+
+	flat := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, bounds.Min, draw.Over)
+	if targetWidth == width && targetHeight == height {
+		return flat
+	}
+
+	// Each target pixel covers at least one source pixel, as images are only scaled down
+	dst := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+	for y := 0; y < targetHeight; y++ {
+		y0, y1 := y*height/targetHeight, (y+1)*height/targetHeight
+		for x := 0; x < targetWidth; x++ {
+			x0, x1 := x*width/targetWidth, (x+1)*width/targetWidth
+			var r, g, b, count int
+			for sy := y0; sy < y1; sy++ {
+				offset := flat.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(flat.Pix[offset])
+					g += int(flat.Pix[offset+1])
+					b += int(flat.Pix[offset+2])
+					offset += 4
+					count++
+				}
+			}
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / count)
+			dst.Pix[offset+1] = uint8(g / count)
+			dst.Pix[offset+2] = uint8(b / count)
+			dst.Pix[offset+3] = 255
+		}
+	}
+	return dst
+}
+
+// encodeFoodImage resizes an image and encodes it as JPEG
+func encodeFoodImage(src image.Image, size int) ([]byte, error) {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, resizeImage(src, size), &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return encoded.Bytes(), nil
+}
+
+// UploadFoodImage stores the image of a food, uploaded as the "image" field of a multipart form
+// (JPEG, PNG or GIF). A display image and a thumbnail are generated and the food's food_image and
+// thumbnail_image are set to their URLs. The file names are derived from the image's content, so
+// the URLs never change meaning and can be cached indefinitely.
+func UploadFoodImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		foodId := c.Param("food_id")
+		count, err := foodCollection.CountDocuments(ctx, bson.M{"food_id": foodId})
+		if err != nil || count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxFoodImageBytes+1<<20)
+		fileHeader, err := c.FormFile("image")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the image must be sent as the image field of a multipart form, at most 10 MB"})
+			return
+		}
+		if fileHeader.Size > maxFoodImageBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "the image must be at most 10 MB"})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the image could not be read"})
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the image could not be read"})
+			return
+		}
+
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "the image must be a JPEG, PNG or GIF file"})
+			return
+		}
+		if config.Width*config.Height > maxFoodImagePixels {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the image has too many pixels"})
+			return
+		}
+		src, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "the image must be a JPEG, PNG or GIF file"})
+			return
+		}
+
+		display, err := encodeFoodImage(src, foodImageSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the image could not be processed"})
+			return
+		}
+		thumbnail, err := encodeFoodImage(src, foodThumbnailSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the image could not be processed"})
+			return
+		}
+
+		storage, err := newFileStorage()
+		if err != nil {
+			log.Println("file storage is not available:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "image storage is not configured"})
+			return
+		}
+		sum := sha256.Sum256(data)
+		name := hex.EncodeToString(sum[:8])
+		displayKey := fmt.Sprintf("foods/%s/%s.jpg", foodId, name)
+		thumbnailKey := fmt.Sprintf("foods/%s/%s_thumb.jpg", foodId, name)
+		if err := storage.Put(ctx, displayKey, display); err != nil {
+			log.Println("failed to store food image:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the image could not be stored"})
+			return
+		}
+		if err := storage.Put(ctx, thumbnailKey, thumbnail); err != nil {
+			log.Println("failed to store food thumbnail:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the image could not be stored"})
+			return
+		}
+
+		version, err := nextMenuVersion(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "food item update failed"})
+			return
+		}
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		foodImage, thumbnailImage := imageUrl(displayKey), imageUrl(thumbnailKey)
+		_, err = foodCollection.UpdateOne(
+			ctx,
+			bson.M{"food_id": foodId},
+			bson.D{{"$set", bson.D{{"food_image", foodImage}, {"thumbnail_image", thumbnailImage}, {"version", version}, {"updated_at", updatedAt}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "food item update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"food_id": foodId, "food_image": foodImage, "thumbnail_image": thumbnailImage})
+	}
+}
+
+// GetImage serves a stored image. Image files never change once stored, so they are cached for a year.
+func GetImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		key := strings.TrimPrefix(c.Param("key"), "/")
+		etag := `"` + key + `"`
+		if c.GetHeader("If-None-Match") == etag {
+			c.Status(http.StatusNotModified)
+			return
+		}
+
+		storage, err := newFileStorage()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "image storage is not configured"})
+			return
+		}
+		data, err := storage.Get(ctx, key)
+		if err == errFileNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "image was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the image"})
+			return
+		}
+
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		c.Header("ETag", etag)
+		c.Data(http.StatusOK, http.DetectContentType(data), data)
+	}
+}
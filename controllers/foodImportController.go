@@ -0,0 +1,356 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/models"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// maxFoodImportBytes is the largest spreadsheet accepted for a food import
+	maxFoodImportBytes = 5 << 20
+	// maxFoodImportRows is the most foods a single import can create
+	maxFoodImportRows = 2000
+	// foodImportBatchSize is the number of foods inserted at a time
+	foodImportBatchSize = 100
+)
+
+// foodImportColumns are the columns a food import understands. List cells (tags, ingredients,
+// allergens, dietary_flags) separate their values with commas or semicolons.
+var foodImportColumns = map[string]bool{
+	"name": true, "price": true, "menu_id": true, "category": true, "tags": true,
+	"description": true, "ingredients": true, "allergens": true, "dietary_flags": true,
+	"cost": true, "tax_class": true, "food_image": true, "image_alt_text": true,
+	"unit_of_measure": true, "price_per_unit": true, "price_s": true, "price_m": true, "price_l": true,
+	"sort_order": true, "sku": true, "kitchen_name": true,
+}
+
+type FoodImportRowError struct {
+	Row   int    `json:"row"`
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+type FoodImportResult struct {
+	Dry_run  bool                 `json:"dry_run"`
+	Rows     int                  `json:"rows"`
+	Imported int                  `json:"imported"`
+	Failed   int                  `json:"failed"`
+	Food_ids []string             `json:"food_ids"`
+	Errors   []FoodImportRowError `json:"errors"`
+}
+
+// splitImportList splits a list cell on commas and semicolons, dropping empty values
+func splitImportList(cell string) []string {
+	values := []string{}
+	for _, value := range strings.FieldsFunc(cell, func(r rune) bool { return r == ',' || r == ';' }) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// parseImportMoney reads an amount in major units, as prices are typed in the spreadsheet
+func parseImportMoney(column string, cell string) (*models.Money, error) {
+	var amount models.Money
+	if err := amount.UnmarshalJSON([]byte(strings.TrimSpace(cell))); err != nil {
+		return nil, fmt.Errorf("%s: %v", column, err)
+	}
+	return &amount, nil
+}
+
+// foodImportRow builds the food described by a spreadsheet row
+func foodImportRow(columns []string, row []string) (models.Food, error) {
+	var food models.Food
+	for i, column := range columns {
+		if i >= len(row) || column == "" {
+			continue
+		}
+		cell := strings.TrimSpace(row[i])
+		if cell == "" {
+			continue
+		}
+
+		var err error
+		switch column {
+		case "name":
+			food.Name = &cell
+		case "price":
+			food.Price, err = parseImportMoney(column, cell)
+		case "menu_id":
+			food.Menu_id = &cell
+		case "category":
+			food.Category_id = &cell
+		case "tags":
+			food.Tags = splitImportList(cell)
+		case "description":
+			if food.Description == nil {
+				food.Description = &models.FoodDescription{}
+			}
+			food.Description.Summary = &cell
+		case "ingredients":
+			if food.Description == nil {
+				food.Description = &models.FoodDescription{}
+			}
+			food.Description.Ingredients = splitImportList(cell)
+		case "allergens":
+			food.Allergens = splitImportList(cell)
+		case "dietary_flags":
+			food.Dietary_flags = splitImportList(cell)
+		case "cost":
+			food.Cost, err = parseImportMoney(column, cell)
+		case "tax_class":
+			food.Tax_class = &cell
+		case "food_image":
+			food.Food_image = &cell
+		case "image_alt_text":
+			food.Image_alt_text = &cell
+		case "unit_of_measure":
+			unit := strings.ToUpper(cell)
+			food.Unit_of_measure = &unit
+		case "price_per_unit":
+			food.Price_per_unit, err = parseImportMoney(column, cell)
+		case "price_s", "price_m", "price_l":
+			var price *models.Money
+			if price, err = parseImportMoney(column, cell); err == nil {
+				if food.Size_prices == nil {
+					food.Size_prices = map[string]models.Money{}
+				}
+				food.Size_prices[strings.ToUpper(strings.TrimPrefix(column, "price_"))] = *price
+			}
+		case "sku":
+			food.Sku = &cell
+		case "kitchen_name":
+			food.Kitchen_name = &cell
+		case "sort_order":
+			var sortOrder int
+			if sortOrder, err = strconv.Atoi(cell); err != nil {
+				err = fmt.Errorf("sort_order must be a whole number")
+			}
+			food.Sort_order = &sortOrder
+		}
+		if err != nil {
+			return food, err
+		}
+	}
+	return food, nil
+}
+
+// ImportFoods creates foods from a spreadsheet (CSV or XLSX, first sheet) uploaded as the "file" field
+// of a multipart form. The first row names the columns (see foodImportColumns); each other row is a
+// food, validated as in POST /foods. Rows without a menu_id go to the menu_id query parameter's menu,
+// and the category column takes a category slug or id. Valid rows are inserted in batches and the
+// rows that fail are reported with their row number; with dry_run=true nothing is inserted.
+func ImportFoods() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxFoodImportBytes+1<<20)
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the spreadsheet must be sent as the file field of a multipart form, at most 5 MB"})
+			return
+		}
+		if fileHeader.Size > maxFoodImportBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "the spreadsheet must be at most 5 MB"})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the spreadsheet could not be read"})
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the spreadsheet could not be read"})
+			return
+		}
+
+		rows, err := readSpreadsheet(data, maxFoodImportRows+1)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(rows) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the spreadsheet is empty"})
+			return
+		}
+
+		columns := make([]string, len(rows[0]))
+		seen := map[string]bool{}
+		for i, header := range rows[0] {
+			column := strings.ToLower(strings.Join(strings.Fields(header), "_"))
+			if column == "" {
+				continue
+			}
+			if !foodImportColumns[column] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown column %q", header)})
+				return
+			}
+			if seen[column] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("column %q appears more than once", header)})
+				return
+			}
+			seen[column] = true
+			columns[i] = column
+		}
+		if !seen["name"] || !seen["price"] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the spreadsheet must have name and price columns"})
+			return
+		}
+		defaultMenuId := c.Query("menu_id")
+		if !seen["menu_id"] && defaultMenuId == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a menu_id column or query parameter is required"})
+			return
+		}
+
+		result := FoodImportResult{Dry_run: c.Query("dry_run") == "true", Food_ids: []string{}, Errors: []FoodImportRowError{}}
+		menus := map[string]error{}
+		categories := map[string]string{}
+		nextSortOrder := map[string]int{}
+		skus := map[string]int{}
+		var foods []interface{}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		for i, row := range rows[1:] {
+			if strings.TrimSpace(strings.Join(row, "")) == "" {
+				continue
+			}
+			result.Rows++
+			rowNumber := i + 2
+
+			food, err := foodImportRow(columns, row)
+			if err == nil && food.Menu_id == nil && defaultMenuId != "" {
+				food.Menu_id = &defaultMenuId
+			}
+			if err == nil && food.Category_id != nil {
+				err = resolveImportCategory(ctx, categories, food.Category_id)
+			}
+			if err == nil {
+				err = checkNewFood(ctx, &food)
+			}
+			if err == nil {
+				err = checkImportMenu(ctx, menus, *food.Menu_id)
+			}
+			if err == nil && food.Sku != nil {
+				if row, ok := skus[*food.Sku]; ok {
+					err = fmt.Errorf("sku %s is also used on row %d", *food.Sku, row)
+				} else {
+					skus[*food.Sku] = rowNumber
+				}
+			}
+			if err != nil {
+				name := ""
+				if food.Name != nil {
+					name = *food.Name
+				}
+				result.Errors = append(result.Errors, FoodImportRowError{Row: rowNumber, Name: name, Error: err.Error()})
+				continue
+			}
+
+			// Imported foods are added at the end of their menu, in the order of the rows
+			if food.Sort_order == nil {
+				sortOrder, ok := nextSortOrder[*food.Menu_id]
+				if !ok {
+					if sortOrder, err = nextFoodSortOrder(ctx, *food.Menu_id); err != nil {
+						c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while importing foods"})
+						return
+					}
+				}
+				food.Sort_order = &sortOrder
+				nextSortOrder[*food.Menu_id] = sortOrder + 1
+			}
+			food.ID = primitive.NewObjectID()
+			food.Food_id = food.ID.Hex()
+			food.Created_at = now
+			food.Updated_at = now
+			foods = append(foods, food)
+		}
+		result.Failed = len(result.Errors)
+
+		if result.Dry_run || len(foods) == 0 {
+			c.JSON(http.StatusOK, result)
+			return
+		}
+
+		version, err := nextMenuVersion(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while importing foods"})
+			return
+		}
+		for start := 0; start < len(foods); start += foodImportBatchSize {
+			end := start + foodImportBatchSize
+			if end > len(foods) {
+				end = len(foods)
+			}
+			batch := foods[start:end]
+			for i := range batch {
+				food := batch[i].(models.Food)
+				food.Version = version
+				batch[i] = food
+			}
+			if _, err := foodCollection.InsertMany(ctx, batch); err != nil {
+				// The foods of earlier batches are kept; the response says which were created
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while importing foods", "imported": result.Imported, "food_ids": result.Food_ids})
+				return
+			}
+			for _, food := range batch {
+				result.Food_ids = append(result.Food_ids, food.(models.Food).Food_id)
+			}
+			result.Imported += len(batch)
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// resolveImportCategory replaces a category slug with its category_id, so staff can type "starters"
+func resolveImportCategory(ctx context.Context, categories map[string]string, categoryId *string) error {
+	value := *categoryId
+	if resolved, ok := categories[value]; ok {
+		*categoryId = resolved
+		return nil
+	}
+	var category models.Category
+	err := categoryCollection.FindOne(ctx, bson.M{"$or": bson.A{bson.M{"slug": categorySlug(value)}, bson.M{"category_id": value}}}).Decode(&category)
+	if err == mongo.ErrNoDocuments {
+		return fmt.Errorf("category %s was not found", value)
+	}
+	if err != nil {
+		return err
+	}
+	categories[value] = category.Category_id
+	*categoryId = category.Category_id
+	return nil
+}
+
+// checkImportMenu checks that foods can be added to a menu, remembering the outcome for later rows
+func checkImportMenu(ctx context.Context, menus map[string]error, menuId string) error {
+	if err, ok := menus[menuId]; ok {
+		return err
+	}
+	var menu models.Menu
+	err := menuCollection.FindOne(ctx, bson.M{"menu_id": menuId}, options.FindOne().SetProjection(bson.M{"deleted_at": 1})).Decode(&menu)
+	if err == mongo.ErrNoDocuments {
+		err = fmt.Errorf("menu %s was not found", menuId)
+	} else if err != nil {
+		return err
+	} else if menu.Deleted_at != nil {
+		err = fmt.Errorf("menu %s is archived", menuId)
+	}
+	menus[menuId] = err
+	return err
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"fmt"
+	"golang-restaurant-management/models"
+	"strings"
+)
+
+// validateFoodOptionGroups checks a food's option groups: names are unique (ignoring case) within the
+// food and within each group, and each group's selection rules can be met with its options
+func validateFoodOptionGroups(groups []models.FoodOptionGroup) error {
+	if err := validate.Var(groups, "omitempty,max=20,dive"); err != nil {
+		return err
+	}
+	groupNames := map[string]bool{}
+	for _, group := range groups {
+		if groupNames[strings.ToLower(group.Name)] {
+			return fmt.Errorf("option group %s is listed twice", group.Name)
+		}
+		groupNames[strings.ToLower(group.Name)] = true
+
+		optionNames := map[string]bool{}
+		for _, option := range group.Options {
+			if optionNames[strings.ToLower(option.Name)] {
+				return fmt.Errorf("option %s is listed twice in option group %s", option.Name, group.Name)
+			}
+			optionNames[strings.ToLower(option.Name)] = true
+		}
+		if group.Min_select > group.Max_select {
+			return fmt.Errorf("min_select of option group %s cannot be above its max_select", group.Name)
+		}
+		if group.Max_select > len(group.Options) {
+			return fmt.Errorf("max_select of option group %s cannot be above its number of options", group.Name)
+		}
+	}
+	return nil
+}
+
+// selectFoodOptions checks the options chosen for an order item against the food's option groups and
+// returns them as stored: with the group's and option's own names and the option's price, in the order
+// of the food's groups and options. It also returns the options' total price.
+func selectFoodOptions(food models.Food, chosen []models.OrderItemOption) ([]models.OrderItemOption, models.Money, error) {
+	selected := map[string]map[string]bool{}
+	for _, choice := range chosen {
+		found := false
+		for _, group := range food.Option_groups {
+			if !strings.EqualFold(group.Name, choice.Group) {
+				continue
+			}
+			for _, option := range group.Options {
+				if strings.EqualFold(option.Name, choice.Option) {
+					found = true
+					if selected[group.Name] == nil {
+						selected[group.Name] = map[string]bool{}
+					}
+					if selected[group.Name][option.Name] {
+						return nil, 0, fmt.Errorf("%s is chosen twice for %s", option.Name, *food.Name)
+					}
+					selected[group.Name][option.Name] = true
+				}
+			}
+		}
+		if !found {
+			return nil, 0, fmt.Errorf("%s has no option %s in %s", *food.Name, choice.Option, choice.Group)
+		}
+	}
+
+	options := []models.OrderItemOption{}
+	var total models.Money
+	for _, group := range food.Option_groups {
+		count := len(selected[group.Name])
+		if count < group.Min_select {
+			if group.Min_select == 1 {
+				return nil, 0, fmt.Errorf("choose a %s for %s", strings.ToLower(group.Name), *food.Name)
+			}
+			return nil, 0, fmt.Errorf("choose at least %d of %s for %s", group.Min_select, strings.ToLower(group.Name), *food.Name)
+		}
+		if count > group.Max_select {
+			return nil, 0, fmt.Errorf("choose at most %d of %s for %s", group.Max_select, strings.ToLower(group.Name), *food.Name)
+		}
+		for _, option := range group.Options {
+			if selected[group.Name][option.Name] {
+				options = append(options, models.OrderItemOption{Group: group.Name, Option: option.Name, Price: option.Price})
+				total += option.Price
+			}
+		}
+	}
+	if len(options) == 0 {
+		return nil, 0, nil
+	}
+	return options, total, nil
+}
+
+// orderItemOptionNames lists an order item's options for tickets and receipts, e.g. "Hot, Rice"
+func orderItemOptionNames(options []models.OrderItemOption) string {
+	names := []string{}
+	for _, option := range options {
+		names = append(names, option.Option)
+	}
+	return strings.Join(names, ", ")
+}
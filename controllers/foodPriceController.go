@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var foodPriceChangeCollection *mongo.Collection = database.OpenCollection(database.Client, "foodPriceChange")
+
+// foodPriceChanges compares the prices of a food before and after a change: its price, its price per
+// unit and each of its size prices. A price that was added or removed has a null old or new price.
+func foodPriceChanges(before models.Food, after models.Food) []models.FoodPriceChange {
+	var changes []models.FoodPriceChange
+	compare := func(field string, oldPrice *models.Money, newPrice *models.Money) {
+		if oldPrice == nil && newPrice == nil {
+			return
+		}
+		if oldPrice != nil && newPrice != nil && *oldPrice == *newPrice {
+			return
+		}
+		changes = append(changes, models.FoodPriceChange{Food_id: after.Food_id, Menu_id: after.Menu_id, Field: field, Old_price: oldPrice, New_price: newPrice})
+	}
+	sizePrice := func(prices map[string]models.Money, size string) *models.Money {
+		if price, ok := prices[size]; ok {
+			return &price
+		}
+		return nil
+	}
+
+	compare("price", before.Price, after.Price)
+	compare("price_per_unit", before.Price_per_unit, after.Price_per_unit)
+	for _, size := range []string{"S", "M", "L"} {
+		compare("size_prices."+size, sizePrice(before.Size_prices, size), sizePrice(after.Size_prices, size))
+	}
+	return changes
+}
+
+// recordFoodPriceChanges appends entries to the price history. Like the order history it is best effort:
+// a failure is logged but never fails the change that triggered it.
+func recordFoodPriceChanges(ctx context.Context, source string, changedBy string, changes []models.FoodPriceChange) {
+	if len(changes) == 0 {
+		return
+	}
+	if changedBy == "" {
+		changedBy = "system"
+	}
+
+	createdAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	documents := []interface{}{}
+	for _, change := range changes {
+		change.ID = primitive.NewObjectID()
+		change.Price_change_id = change.ID.Hex()
+		change.Source = source
+		change.Changed_by = changedBy
+		change.Created_at = createdAt
+		documents = append(documents, change)
+	}
+
+	if _, err := foodPriceChangeCollection.InsertMany(ctx, documents); err != nil {
+		log.Println("failed to record food price history:", err)
+	}
+}
+
+// GetFoodPriceHistory lists the price changes of a food, latest first, with its price scheduled next
+func GetFoodPriceHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		foodId := c.Param("food_id")
+		var food models.Food
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
+
+		opts := options.Find().SetSort(bson.D{{"created_at", -1}, {"_id", -1}})
+		cursor, err := foodPriceChangeCollection.Find(ctx, bson.M{"food_id": foodId}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the price history"})
+			return
+		}
+		changes := []models.FoodPriceChange{}
+		if err = cursor.All(ctx, &changes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the price history"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"food_id": foodId, "price": food.Price, "scheduled_price": food.Scheduled_price, "changes": changes})
+	}
+}
+
+// GetPriceChanges lists the price changes of all foods in a period, oldest first, for audits: the
+// optional from/to query parameters (RFC3339), by default the last 30 days, and menu_id
+func GetPriceChanges() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		to := time.Now()
+		from := to.AddDate(0, 0, -30)
+		if value := c.Query("from"); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC3339 timestamp"})
+				return
+			}
+			from = parsed
+		}
+		if value := c.Query("to"); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC3339 timestamp"})
+				return
+			}
+			to = parsed
+		}
+		if !from.Before(to) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+			return
+		}
+
+		filter := bson.M{"created_at": bson.M{"$gte": from, "$lt": to}}
+		if menuId := c.Query("menu_id"); menuId != "" {
+			filter["menu_id"] = menuId
+		}
+		opts := options.Find().SetSort(bson.D{{"created_at", 1}, {"_id", 1}})
+		cursor, err := foodPriceChangeCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing price changes"})
+			return
+		}
+		changes := []models.FoodPriceChange{}
+		if err = cursor.All(ctx, &changes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing price changes"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "changes": changes})
+	}
+}
+
+// ScheduleFoodPrice sets the price a food will have from a future date on, replacing any price
+// scheduled before. The scheduled price job applies it once the date has passed.
+func ScheduleFoodPrice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var scheduledPrice models.ScheduledPrice
+		if err := c.BindJSON(&scheduledPrice); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(scheduledPrice); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if !scheduledPrice.Effective_at.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "effective_at must be in the future"})
+			return
+		}
+		scheduledPrice.Scheduled_by = c.GetString("uid")
+
+		foodId := c.Param("food_id")
+		var food models.Food
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
+		if food.Deleted_at != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "food is archived"})
+			return
+		}
+
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		_, err := foodCollection.UpdateOne(
+			ctx,
+			bson.M{"food_id": foodId},
+			bson.D{{"$set", bson.D{{"scheduled_price", scheduledPrice}, {"updated_at", updatedAt}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the price could not be scheduled"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"food_id": foodId, "price": food.Price, "scheduled_price": scheduledPrice})
+	}
+}
+
+// CancelScheduledFoodPrice removes the price scheduled for a food
+func CancelScheduledFoodPrice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		foodId := c.Param("food_id")
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		result, err := foodCollection.UpdateOne(
+			ctx,
+			bson.M{"food_id": foodId},
+			bson.D{{"$set", bson.D{{"scheduled_price", nil}, {"updated_at", updatedAt}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the scheduled price could not be cancelled"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"food_id": foodId, "scheduled_price": nil})
+	}
+}
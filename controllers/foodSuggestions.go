@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/models"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// suggestionLookbackDays is how far back orders are looked at for foods ordered together
+const suggestionLookbackDays = 90
+
+// maxSuggestionOrders bounds how many of the latest orders with a food are looked at
+const maxSuggestionOrders = 1000
+
+type FoodSuggestion struct {
+	Food_id string       `json:"food_id"`
+	Name    string       `json:"name"`
+	Price   models.Money `json:"price"`
+	Menu_id *string      `json:"menu_id"`
+
+	// Source is PAIRING for the food's related items and ORDERED_TOGETHER for foods found in its orders
+	Source string `json:"source"`
+
+	// Attach_rate is the share of the food's recent orders that also had the suggested food, in percent
+	Attach_rate float64 `json:"attach_rate"`
+}
+
+// validateRelatedItems checks that a food's related items are other foods that exist, each listed once
+func validateRelatedItems(ctx context.Context, foodId string, relatedItems []string) error {
+	if err := validate.Var(relatedItems, "omitempty,max=10,dive,required"); err != nil {
+		return fmt.Errorf("a food can have at most 10 related items")
+	}
+	listed := map[string]bool{}
+	for _, relatedId := range relatedItems {
+		if relatedId == foodId {
+			return fmt.Errorf("a food cannot be related to itself")
+		}
+		if listed[relatedId] {
+			return fmt.Errorf("related item %s is listed twice", relatedId)
+		}
+		listed[relatedId] = true
+	}
+	if len(relatedItems) == 0 {
+		return nil
+	}
+	count, err := foodCollection.CountDocuments(ctx, bson.M{"food_id": bson.M{"$in": relatedItems}})
+	if err != nil {
+		return err
+	}
+	if int(count) != len(relatedItems) {
+		return fmt.Errorf("related items must be existing foods")
+	}
+	return nil
+}
+
+// foodsOrderedWith counts, among the latest orders of the last 90 days that had a food, how many also
+// had each other food. It returns the counts by food_id and the number of orders looked at.
+func foodsOrderedWith(ctx context.Context, foodId string) (map[string]int, int, error) {
+	since := time.Now().AddDate(0, 0, -suggestionLookbackDays)
+	notVoided := bson.E{"status", bson.D{{"$ne", "VOIDED"}}}
+
+	cursor, err := orderItemCollection.Aggregate(ctx, mongo.Pipeline{
+		{{"$match", bson.D{{"food_id", foodId}, {"created_at", bson.D{{"$gte", since}}}, notVoided}}},
+		{{"$group", bson.D{{"_id", "$order_id"}, {"created_at", bson.D{{"$max", "$created_at"}}}}}},
+		{{"$sort", bson.D{{"created_at", -1}}}},
+		{{"$limit", maxSuggestionOrders}},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	var orders []struct {
+		Order_id string `bson:"_id"`
+	}
+	if err = cursor.All(ctx, &orders); err != nil {
+		return nil, 0, err
+	}
+	if len(orders) == 0 {
+		return map[string]int{}, 0, nil
+	}
+	orderIds := []string{}
+	for _, order := range orders {
+		orderIds = append(orderIds, order.Order_id)
+	}
+
+	// Foods ordered more than once in the same order are counted once
+	cursor, err = orderItemCollection.Aggregate(ctx, mongo.Pipeline{
+		{{"$match", bson.D{{"order_id", bson.D{{"$in", orderIds}}}, {"food_id", bson.D{{"$ne", foodId}}}, notVoided}}},
+		{{"$group", bson.D{{"_id", bson.D{{"order_id", "$order_id"}, {"food_id", "$food_id"}}}}}},
+		{{"$group", bson.D{{"_id", "$_id.food_id"}, {"orders", bson.D{{"$sum", 1}}}}}},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	var counts []struct {
+		Food_id string `bson:"_id"`
+		Orders  int    `bson:"orders"`
+	}
+	if err = cursor.All(ctx, &counts); err != nil {
+		return nil, 0, err
+	}
+	together := map[string]int{}
+	for _, count := range counts {
+		together[count.Food_id] = count.Orders
+	}
+	return together, len(orders), nil
+}
+
+// GetFoodSuggestions returns the foods to suggest with a food for upselling, at most limit (default 5,
+// at most 20): its related items first, in the order given, then the foods most often ordered together
+// with it. Archived foods and foods without a price are left out.
+func GetFoodSuggestions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		limit := 5
+		if value := c.Query("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > 20 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 20"})
+				return
+			}
+			limit = parsed
+		}
+
+		foodId := c.Param("food_id")
+		var food models.Food
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
+
+		together, orderCount, err := foodsOrderedWith(ctx, foodId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while looking up orders"})
+			return
+		}
+
+		candidateIds := append([]string{}, food.Related_items...)
+		for candidateId := range together {
+			candidateIds = append(candidateIds, candidateId)
+		}
+		cursor, err := foodCollection.Find(ctx, bson.D{{"food_id", bson.D{{"$in", candidateIds}}}, {"price", bson.D{{"$ne", nil}}}, notArchived})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing food items"})
+			return
+		}
+		var candidates []models.Food
+		if err = cursor.All(ctx, &candidates); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing food items"})
+			return
+		}
+		accepted, base, err := requestLanguages(ctx, c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing food items"})
+			return
+		}
+		candidatesById := map[string]models.Food{}
+		for _, candidate := range candidates {
+			localizeFood(&candidate, accepted, base)
+			candidatesById[candidate.Food_id] = candidate
+		}
+
+		suggestion := func(candidate models.Food, source string) FoodSuggestion {
+			item := FoodSuggestion{Food_id: candidate.Food_id, Name: foodName(candidate), Price: *candidate.Price, Menu_id: candidate.Menu_id, Source: source}
+			if orderCount > 0 {
+				item.Attach_rate = toFixed(float64(together[candidate.Food_id])/float64(orderCount)*100, 2)
+			}
+			return item
+		}
+
+		suggestions := []FoodSuggestion{}
+		suggested := map[string]bool{}
+		for _, relatedId := range food.Related_items {
+			if candidate, ok := candidatesById[relatedId]; ok && len(suggestions) < limit {
+				suggestions = append(suggestions, suggestion(candidate, "PAIRING"))
+				suggested[relatedId] = true
+			}
+		}
+
+		var orderedTogether []FoodSuggestion
+		for candidateId := range together {
+			if candidate, ok := candidatesById[candidateId]; ok && !suggested[candidateId] {
+				orderedTogether = append(orderedTogether, suggestion(candidate, "ORDERED_TOGETHER"))
+			}
+		}
+		sort.Slice(orderedTogether, func(i, j int) bool {
+			if orderedTogether[i].Attach_rate != orderedTogether[j].Attach_rate {
+				return orderedTogether[i].Attach_rate > orderedTogether[j].Attach_rate
+			}
+			return orderedTogether[i].Name < orderedTogether[j].Name
+		})
+		for _, item := range orderedTogether {
+			if len(suggestions) >= limit {
+				break
+			}
+			suggestions = append(suggestions, item)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"food_id": foodId, "orders": orderCount, "suggestions": suggestions})
+	}
+}
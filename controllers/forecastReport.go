@@ -0,0 +1,251 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/models"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ForecastItem struct {
+	Food_id  string  `json:"food_id"`
+	Name     string  `json:"name"`
+	Quantity float64 `json:"quantity"`
+}
+
+type ForecastDay struct {
+	Date          string         `json:"date"`
+	Weekday       string         `json:"weekday"`
+	Covers        float64        `json:"covers"`
+	Booked_covers int            `json:"booked_covers"`
+	Items         []ForecastItem `json:"items"`
+}
+
+type ForecastReport struct {
+	History_from time.Time     `json:"history_from"`
+	History_to   time.Time     `json:"history_to"`
+	Weeks        int           `json:"weeks"`
+	Location_id  *string       `json:"location_id"`
+	Days         []ForecastDay `json:"days"`
+}
+
+// forecastQueryInt reads an optional integer query parameter within bounds
+func forecastQueryInt(c *gin.Context, name string, fallback int, min int, max int) (int, error) {
+	if c.Query(name) == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(c.Query(name))
+	if err != nil || value < min || value > max {
+		return 0, fmt.Errorf("%s must be between %d and %d", name, min, max)
+	}
+	return value, nil
+}
+
+// weekdayForecast projects a daily figure for a day from the same weekday of the past weeks before today,
+// weighting recent weeks more: the last week counts weeks times, the oldest once. Days without history
+// count as zero, so weekdays the restaurant is closed forecast nothing.
+func weekdayForecast(history map[string]float64, today time.Time, day time.Time, weeks int) float64 {
+	offset := (int(today.Weekday()) - int(day.Weekday()) + 7) % 7
+	if offset == 0 {
+		offset = 7
+	}
+	var total, weights float64
+	for week := 0; week < weeks; week++ {
+		weight := float64(weeks - week)
+		total += weight * history[today.AddDate(0, 0, -offset-7*week).Format("2006-01-02")]
+		weights += weight
+	}
+	return toFixed(total/weights, 1)
+}
+
+// GetForecast projects the covers and the demand for the best selling foods of the coming days (days,
+// default 7, at most 28, starting today) from a weighted moving average of the same weekday over the past
+// weeks (weeks, default 4, at most 12), to plan prep lists and schedules. Days are business days. The
+// guests of the reservations booked for a day are given alongside as booked_covers. Optional filters are
+// location_id and limit, the number of foods forecast (default 20).
+func GetForecast() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		days, err := forecastQueryInt(c, "days", 7, 1, 28)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		weeks, err := forecastQueryInt(c, "weeks", 4, 1, 12)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		limit, err := forecastQueryInt(c, "limit", 20, 1, 200)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		settings, err := loadSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the settings"})
+			return
+		}
+		startHour := defaultBusinessDayStartHour
+		if settings.Business_day_start_hour != nil {
+			startHour = *settings.Business_day_start_hour
+		}
+		now := time.Now()
+		today, _ := time.ParseInLocation("2006-01-02", businessDate(settings, now), now.Location())
+		// Business days start at the start hour, so the history ends where today's business day starts
+		dayStart := func(day time.Time) time.Time {
+			return day.Add(time.Duration(startHour) * time.Hour)
+		}
+		format := salesPeriodFormats["day"]
+
+		report := ForecastReport{
+			History_from: dayStart(today.AddDate(0, 0, -7*weeks)),
+			History_to:   dayStart(today),
+			Weeks:        weeks,
+			Days:         []ForecastDay{},
+		}
+		history := bson.D{{"$gte", report.History_from}, {"$lt", report.History_to}}
+		upcoming := bson.D{{"$gte", dayStart(today)}, {"$lt", dayStart(today.AddDate(0, 0, days))}}
+		seatingPipeline := mongo.Pipeline{bson.D{{"$match", bson.D{{"seated_at", history}}}}}
+		itemPipeline := mongo.Pipeline{bson.D{{"$match", bson.D{
+			{"created_at", history},
+			{"status", bson.D{{"$ne", "VOIDED"}}},
+			{"food_id", bson.D{{"$ne", nil}}},
+		}}}}
+		reservationPipeline := mongo.Pipeline{bson.D{{"$match", bson.D{
+			{"reservation_time", upcoming},
+			{"status", bson.D{{"$in", bson.A{"BOOKED", "CONFIRMED"}}}},
+		}}}}
+		if locationId := c.Query("location_id"); locationId != "" {
+			report.Location_id = &locationId
+			// Seatings and reservations have no location of their own, so they are filtered by their table's
+			// and order items by their order's; reservations without a table cannot be placed
+			lookupTable := bson.D{{"$lookup", bson.D{{"from", "table"}, {"localField", "table_id"}, {"foreignField", "table_id"}, {"as", "table"}}}}
+			seatingPipeline = append(seatingPipeline, lookupTable, bson.D{{"$match", bson.D{{"table.location_id", locationId}}}})
+			reservationPipeline = append(reservationPipeline, lookupTable, bson.D{{"$match", bson.D{{"table.location_id", locationId}}}})
+			itemPipeline = append(itemPipeline,
+				bson.D{{"$lookup", bson.D{{"from", "order"}, {"localField", "order_id"}, {"foreignField", "order_id"}, {"as", "order"}}}},
+				bson.D{{"$match", bson.D{{"order.location_id", locationId}}}},
+			)
+		}
+
+		var rows []struct {
+			Id struct {
+				Day     string `bson:"day"`
+				Food_id string `bson:"food_id"`
+			} `bson:"_id"`
+			Quantity float64 `bson:"quantity"`
+		}
+		aggregate := func(collection *mongo.Collection, pipeline mongo.Pipeline) error {
+			rows = nil
+			result, err := collection.Aggregate(ctx, pipeline)
+			if err != nil {
+				return err
+			}
+			return result.All(ctx, &rows)
+		}
+
+		seatingPipeline = append(seatingPipeline, bson.D{{"$group", bson.D{
+			{"_id", bson.D{{"day", salesPeriodKey("seated_at", format, startHour, now)}}},
+			{"quantity", bson.D{{"$sum", "$guests"}}},
+		}}})
+		if err := aggregate(seatingCollection, seatingPipeline); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while counting covers"})
+			return
+		}
+		covers := map[string]float64{}
+		for _, row := range rows {
+			covers[row.Id.Day] = row.Quantity
+		}
+
+		reservationPipeline = append(reservationPipeline, bson.D{{"$group", bson.D{
+			{"_id", bson.D{{"day", salesPeriodKey("reservation_time", format, startHour, now)}}},
+			{"quantity", bson.D{{"$sum", "$party_size"}}},
+		}}})
+		if err := aggregate(reservationCollection, reservationPipeline); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while counting reservations"})
+			return
+		}
+		booked := map[string]int{}
+		for _, row := range rows {
+			booked[row.Id.Day] = int(row.Quantity)
+		}
+
+		itemPipeline = append(itemPipeline, bson.D{{"$group", bson.D{
+			{"_id", bson.D{{"day", salesPeriodKey("created_at", format, startHour, now)}, {"food_id", "$food_id"}}},
+			{"quantity", bson.D{{"$sum", 1}}},
+		}}})
+		if err := aggregate(orderItemCollection, itemPipeline); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating food sales"})
+			return
+		}
+		sold := map[string]map[string]float64{}
+		totals := map[string]float64{}
+		for _, row := range rows {
+			if sold[row.Id.Food_id] == nil {
+				sold[row.Id.Food_id] = map[string]float64{}
+			}
+			sold[row.Id.Food_id][row.Id.Day] = row.Quantity
+			totals[row.Id.Food_id] += row.Quantity
+		}
+		foodIds := []string{}
+		for foodId := range totals {
+			foodIds = append(foodIds, foodId)
+		}
+		sort.Slice(foodIds, func(i, j int) bool {
+			if totals[foodIds[i]] != totals[foodIds[j]] {
+				return totals[foodIds[i]] > totals[foodIds[j]]
+			}
+			return foodIds[i] < foodIds[j]
+		})
+		if len(foodIds) > limit {
+			foodIds = foodIds[:limit]
+		}
+
+		names := map[string]string{}
+		cursor, err := foodCollection.Find(ctx, bson.M{"food_id": bson.M{"$in": foodIds}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the foods"})
+			return
+		}
+		var foods []models.Food
+		if err = cursor.All(ctx, &foods); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the foods"})
+			return
+		}
+		for _, food := range foods {
+			names[food.Food_id] = foodName(food)
+		}
+
+		for i := 0; i < days; i++ {
+			day := today.AddDate(0, 0, i)
+			date := day.Format("2006-01-02")
+			forecast := ForecastDay{
+				Date:          date,
+				Weekday:       day.Weekday().String(),
+				Covers:        weekdayForecast(covers, today, day, weeks),
+				Booked_covers: booked[date],
+				Items:         []ForecastItem{},
+			}
+			for _, foodId := range foodIds {
+				quantity := weekdayForecast(sold[foodId], today, day, weeks)
+				if quantity > 0 {
+					forecast.Items = append(forecast.Items, ForecastItem{Food_id: foodId, Name: names[foodId], Quantity: quantity})
+				}
+			}
+			sort.SliceStable(forecast.Items, func(i, j int) bool { return forecast.Items[i].Quantity > forecast.Items[j].Quantity })
+			report.Days = append(report.Days, forecast)
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
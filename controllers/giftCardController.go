@@ -0,0 +1,359 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"golang-restaurant-management/database"
+	helper "golang-restaurant-management/helpers"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var giftCardCollection *mongo.Collection = database.OpenCollection(database.Client, "giftCard")
+
+var giftCardTransactionCollection *mongo.Collection = database.OpenCollection(database.Client, "giftCardTransaction")
+
+// giftCardCodeLength is the number of characters in a gift card code, drawn from pairingCodeAlphabet
+const giftCardCodeLength = 12
+
+var errGiftCardBalanceChanged = errors.New("gift card balance changed concurrently")
+
+type GiftCardRequest struct {
+	Amount     models.Money `json:"amount" validate:"required,gt=0"`
+	Expires_at *time.Time   `json:"expires_at"`
+}
+
+// maxGiftCardAmount is the largest amount a card can be issued or reloaded with, in major units
+const maxGiftCardAmount = 100000
+
+type RedeemGiftCardRequest struct {
+	Code   string        `json:"code" validate:"required"`
+	Amount *models.Money `json:"amount" validate:"omitempty,gt=0"`
+}
+
+// IssueGiftCard creates a new gift card with a random code and the given balance
+func IssueGiftCard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request GiftCardRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if request.Amount > models.MoneyFromFloat(maxGiftCardAmount) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "amount is more than the gift card limit"})
+			return
+		}
+
+		var giftCard models.GiftCard
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		giftCard.Initial_balance = request.Amount
+		giftCard.Balance = giftCard.Initial_balance
+		giftCard.Status = "ACTIVE"
+		giftCard.Expires_at = request.Expires_at
+		giftCard.Issued_by = c.GetString("uid")
+		giftCard.Created_at = now
+		giftCard.Updated_at = now
+
+		// The unique code index rejects the rare collision, in which case a new code is drawn
+		var err error
+		for attempt := 0; attempt < 5; attempt++ {
+			giftCard.ID = primitive.NewObjectID()
+			giftCard.Gift_card_id = giftCard.ID.Hex()
+			giftCard.Code, err = helper.RandomCode(giftCardCodeLength, pairingCodeAlphabet)
+			if err != nil {
+				break
+			}
+			if _, err = giftCardCollection.InsertOne(ctx, giftCard); !mongo.IsDuplicateKeyError(err) {
+				break
+			}
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "gift card was not issued"})
+			return
+		}
+
+		recordGiftCardTransaction(ctx, giftCard, "ISSUE", giftCard.Balance, nil, giftCard.Issued_by)
+		c.JSON(http.StatusOK, giftCard)
+	}
+}
+
+// GetGiftCardBalance looks a card up by its code
+func GetGiftCardBalance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		giftCard, err := findGiftCard(ctx, c.Param("code"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "gift card was not found"})
+			return
+		}
+		settings, err := loadSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the settings"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"gift_card_id":      giftCard.Gift_card_id,
+			"balance":           giftCard.Balance,
+			"formatted_balance": formatMoney(giftCard.Balance, settings),
+			"currency":          settingsCurrency(settings),
+			"status":            giftCard.Status,
+			"expires_at":        giftCard.Expires_at,
+		})
+	}
+}
+
+func GetGiftCardTransactions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		giftCard, err := findGiftCard(ctx, c.Param("code"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "gift card was not found"})
+			return
+		}
+
+		opts := options.Find().SetSort(bson.D{{"created_at", 1}})
+		result, err := giftCardTransactionCollection.Find(ctx, bson.M{"gift_card_id": giftCard.Gift_card_id}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing gift card transactions"})
+			return
+		}
+		transactions := []models.GiftCardTransaction{}
+		if err = result.All(ctx, &transactions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing gift card transactions"})
+			return
+		}
+		c.JSON(http.StatusOK, transactions)
+	}
+}
+
+// ReloadGiftCard adds the given amount to an active card
+func ReloadGiftCard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request GiftCardRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if request.Amount > models.MoneyFromFloat(maxGiftCardAmount) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "amount is more than the gift card limit"})
+			return
+		}
+
+		giftCard, err := findGiftCard(ctx, c.Param("code"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "gift card was not found"})
+			return
+		}
+		if giftCard.Status != "ACTIVE" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "gift card is not active"})
+			return
+		}
+
+		giftCard, err = adjustGiftCardBalance(ctx, giftCard.Gift_card_id, request.Amount)
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "gift card could not be reloaded, please retry"})
+			return
+		}
+		recordGiftCardTransaction(ctx, giftCard, "RELOAD", request.Amount, nil, c.GetString("uid"))
+		c.JSON(http.StatusOK, giftCard)
+	}
+}
+
+// RedeemGiftCard pays (part of) a pending invoice with a gift card. Without an amount, as much of the
+// remaining amount due as the card's balance allows is paid. When nothing is left to pay the invoice
+// becomes PAID with the GIFT_CARD payment method.
+func RedeemGiftCard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request RedeemGiftCardRequest
+		var invoice models.Invoice
+
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		invoiceId := c.Param("invoice_id")
+		if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoiceId}).Decode(&invoice); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
+		if invoice.Payment_status == nil || *invoice.Payment_status != "PENDING" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only pending invoices can be paid"})
+			return
+		}
+		due := invoiceAmountDue(invoice)
+		if due <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "nothing is left to pay on this invoice"})
+			return
+		}
+
+		giftCard, err := findGiftCard(ctx, request.Code)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "gift card was not found"})
+			return
+		}
+		if giftCard.Status != "ACTIVE" || (giftCard.Expires_at != nil && !time.Now().Before(*giftCard.Expires_at)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "gift card is not active or has expired"})
+			return
+		}
+
+		amount := giftCard.Balance
+		if due < amount {
+			amount = due
+		}
+		if request.Amount != nil {
+			amount = *request.Amount
+			if amount > due {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "amount is more than the amount due"})
+				return
+			}
+		}
+		if amount <= 0 || amount > giftCard.Balance {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "gift card balance is too low"})
+			return
+		}
+
+		giftCard, err = adjustGiftCardBalance(ctx, giftCard.Gift_card_id, -amount)
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "gift card balance changed, please retry"})
+			return
+		}
+		invoiceRef := invoice.Invoice_id
+		transaction := recordGiftCardTransaction(ctx, giftCard, "REDEEM", -amount, &invoiceRef, c.GetString("uid"))
+
+		// Record the payment on the invoice; the gift_card_total condition protects against a
+		// concurrent redemption, in which case the card is credited back
+		payment := models.GiftCardPayment{Gift_card_id: giftCard.Gift_card_id, Transaction_id: transaction.Transaction_id, Amount: amount}
+		paidTotal := invoice.Gift_card_total + amount
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		set := bson.D{{"gift_card_total", paidTotal}, {"updated_at", now}}
+		fullyPaid := paidTotal+invoice.Deposit_total >= invoice.Grand_total
+		if fullyPaid {
+			set = append(set, bson.E{"payment_status", "PAID"}, bson.E{"payment_method", "GIFT_CARD"}, bson.E{"paid_at", now})
+			if !invoiceFinalized(invoice) {
+				set = append(set, bson.E{"invoice_status", "FINALIZED"}, bson.E{"finalized_by", c.GetString("uid")}, bson.E{"finalized_at", now})
+			}
+		}
+		result, err := invoiceCollection.UpdateOne(
+			ctx,
+			bson.M{"invoice_id": invoiceId, "payment_status": "PENDING", "gift_card_total": invoice.Gift_card_total},
+			bson.D{{"$set", set}, {"$push", bson.D{{"gift_card_payments", payment}}}},
+		)
+		if err != nil || result.ModifiedCount == 0 {
+			if refunded, err := adjustGiftCardBalance(ctx, giftCard.Gift_card_id, amount); err == nil {
+				recordGiftCardTransaction(ctx, refunded, "REVERSAL", amount, &invoiceRef, c.GetString("uid"))
+			} else {
+				log.Println("failed to reverse gift card redemption", transaction.Transaction_id, ":", err)
+			}
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice was changed concurrently, please retry"})
+			return
+		}
+
+		status := "PENDING"
+		if fullyPaid {
+			status = "PAID"
+			closeInvoiceOrdersIfSettled(ctx, invoice, c.GetString("uid"))
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"invoice_id":     invoiceId,
+			"amount":         amount,
+			"amount_due":     invoice.Grand_total - paidTotal - invoice.Deposit_total,
+			"payment_status": status,
+			"card_balance":   giftCard.Balance,
+		})
+	}
+}
+
+func findGiftCard(ctx context.Context, code string) (models.GiftCard, error) {
+	var giftCard models.GiftCard
+	err := giftCardCollection.FindOne(ctx, bson.M{"code": strings.ToUpper(strings.TrimSpace(code))}).Decode(&giftCard)
+	return giftCard, err
+}
+
+// adjustGiftCardBalance changes a card's balance by delta and returns the updated card.
+// The update only succeeds if the balance is still the one it was computed from, so concurrent
+// redemptions can never spend the same balance twice; it is retried a few times on contention.
+func adjustGiftCardBalance(ctx context.Context, giftCardId string, delta models.Money) (models.GiftCard, error) {
+	var giftCard models.GiftCard
+
+	for attempt := 0; attempt < 3; attempt++ {
+		if err := giftCardCollection.FindOne(ctx, bson.M{"gift_card_id": giftCardId}).Decode(&giftCard); err != nil {
+			return giftCard, err
+		}
+		balance := giftCard.Balance + delta
+		if balance < 0 {
+			return giftCard, errors.New("gift card balance is too low")
+		}
+
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		result, err := giftCardCollection.UpdateOne(
+			ctx,
+			bson.M{"gift_card_id": giftCardId, "balance": giftCard.Balance, "status": "ACTIVE"},
+			bson.D{{"$set", bson.D{{"balance", balance}, {"updated_at", updatedAt}}}},
+		)
+		if err != nil {
+			return giftCard, err
+		}
+		if result.ModifiedCount > 0 {
+			giftCard.Balance = balance
+			giftCard.Updated_at = updatedAt
+			return giftCard, nil
+		}
+	}
+	return giftCard, errGiftCardBalanceChanged
+}
+
+// recordGiftCardTransaction appends a balance change to the card's ledger.
+// Failures are logged, the card's balance itself has already been updated.
+func recordGiftCardTransaction(ctx context.Context, giftCard models.GiftCard, transactionType string, amount models.Money, invoiceId *string, createdBy string) models.GiftCardTransaction {
+	var transaction models.GiftCardTransaction
+
+	transaction.ID = primitive.NewObjectID()
+	transaction.Transaction_id = transaction.ID.Hex()
+	transaction.Gift_card_id = giftCard.Gift_card_id
+	transaction.Type = transactionType
+	transaction.Amount = amount
+	transaction.Balance_after = giftCard.Balance
+	transaction.Invoice_id = invoiceId
+	transaction.Created_by = createdBy
+	transaction.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	if _, err := giftCardTransactionCollection.InsertOne(ctx, transaction); err != nil {
+		log.Println("failed to record gift card transaction:", err)
+	}
+	return transaction
+}
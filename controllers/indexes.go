@@ -0,0 +1,306 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureIndexes creates the indexes the controllers rely on for uniqueness guarantees and data retention.
+// Creating an index that already exists is a no-op, so this is safe to run on every start.
+func EnsureIndexes() {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	indexes := map[*mongo.Collection][]mongo.IndexModel{
+		paymentEventCollection: {
+			{Keys: bson.D{{"event_id", 1}}, Options: options.Index().SetUnique(true)},
+		},
+		// Menu snapshots look up documents changed after a version
+		foodCollection: {
+			{Keys: bson.D{{"version", 1}}},
+			// Food listings are filtered by category and tag
+			{Keys: bson.D{{"category_id", 1}}},
+			{Keys: bson.D{{"tags", 1}}},
+			{Keys: bson.D{{"dietary_flags", 1}}},
+			// SKUs identify foods at the POS
+			{
+				Keys:    bson.D{{"sku", 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"sku": bson.M{"$type": "string"}}),
+			},
+			// Search ranks name matches above tag and description matches
+			{
+				Keys:    bson.D{{"name", "text"}, {"tags", "text"}, {"description.summary", "text"}, {"description.ingredients", "text"}},
+				Options: options.Index().SetName("food_search").SetWeights(bson.D{{"name", 10}, {"tags", 5}, {"description.summary", 2}, {"description.ingredients", 2}}),
+			},
+		},
+		// Price history is listed per food and by period
+		foodPriceChangeCollection: {
+			{Keys: bson.D{{"food_id", 1}, {"created_at", -1}}},
+			{Keys: bson.D{{"created_at", 1}}},
+		},
+		// Suggestions look up the recent orders of a food
+		orderItemCollection: {
+			{Keys: bson.D{{"food_id", 1}, {"created_at", -1}}},
+		},
+		// One stock count can be open at a time per location
+		stockCountCollection: {
+			{
+				Keys:    bson.D{{"location_id", 1}, {"status", 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"status": "OPEN"}),
+			},
+		},
+		// A barcode resolves to a single inventory item
+		inventoryItemCollection: {
+			{
+				Keys:    bson.D{{"barcodes.code", 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"barcodes.code": bson.M{"$type": "string"}}),
+			},
+		},
+		// Stock going out is taken from an item's batches at a location, the first to expire first
+		inventoryBatchCollection: {
+			{Keys: bson.D{{"inventory_item_id", 1}, {"location_id", 1}, {"expires_at", 1}}},
+			{Keys: bson.D{{"expires_at", 1}}},
+		},
+		// Reorder suggestions look up the suppliers selling an item
+		supplierCollection: {
+			{Keys: bson.D{{"prices.inventory_item_id", 1}}},
+		},
+		// A food has at most one recipe
+		recipeCollection: {
+			{Keys: bson.D{{"food_id", 1}}, Options: options.Index().SetUnique(true)},
+		},
+		// A menu has at most one draft, and its versions are numbered
+		menuDraftCollection: {
+			{Keys: bson.D{{"menu_id", 1}}, Options: options.Index().SetUnique(true)},
+		},
+		menuVersionCollection: {
+			{Keys: bson.D{{"menu_id", 1}, {"number", 1}}, Options: options.Index().SetUnique(true)},
+		},
+		// A phone number belongs to one customer
+		// Every collection has one export watermark
+		exportWatermarkCollection: {
+			{Keys: bson.D{{"collection", 1}}, Options: options.Index().SetUnique(true)},
+		},
+		customerCollection: {
+			{
+				Keys:    bson.D{{"customer_phone", 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"customer_phone": bson.M{"$type": "string"}}),
+			},
+		},
+		// Category slugs identify categories in food filters
+		categoryCollection: {
+			{Keys: bson.D{{"slug", 1}}, Options: options.Index().SetUnique(true)},
+		},
+		menuCollection: {
+			{Keys: bson.D{{"version", 1}}},
+			{
+				Keys:    bson.D{{"name", "text"}, {"category", "text"}},
+				Options: options.Index().SetName("menu_search").SetWeights(bson.D{{"name", 10}, {"category", 5}}),
+			},
+		},
+		// Order numbers are unique per location and business day
+		orderCollection: {
+			{
+				Keys:    bson.D{{"location_id", 1}, {"business_date", 1}, {"order_number", 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"order_number": bson.M{"$gt": 0}}),
+			},
+			// The pickup board reads today's orders by status
+			{Keys: bson.D{{"business_date", 1}, {"status", 1}}},
+			// Provider orders are created at most once
+			{
+				Keys:    bson.D{{"external_reference", 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"external_reference": bson.M{"$type": "string"}}),
+			},
+			// New orders join the session of their table's open orders
+			{Keys: bson.D{{"table_id", 1}, {"closed_at", 1}}},
+			{Keys: bson.D{{"session_id", 1}}},
+			// Customer history lists a customer's orders
+			{Keys: bson.D{{"customer_id", 1}, {"created_at", -1}}},
+		},
+		// Session invoices are found by any of the orders they bill. Invoice numbers are unique;
+		// invoices created before numbering was introduced have none. An order has at most one
+		// active invoice, and an Idempotency-Key creates at most one invoice
+		invoiceCollection: {
+			{Keys: bson.D{{"order_ids", 1}}},
+			{
+				Keys:    bson.D{{"active_order_ids", 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"active_order_ids": bson.M{"$type": "string"}}),
+			},
+			{
+				Keys:    bson.D{{"idempotency_key", 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"idempotency_key": bson.M{"$type": "string"}}),
+			},
+			{Keys: bson.D{{"cash_session_id", 1}}},
+			// Each location numbers its own invoices, so numbers are only unique per location
+			{
+				Keys:    bson.D{{"location_id", 1}, {"invoice_number", 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"invoice_number": bson.M{"$gt": ""}}),
+			},
+		},
+		// A vendor invoice is stored once per supplier and invoice number
+		vendorInvoiceCollection: {
+			{
+				Keys:    bson.D{{"supplier_name", 1}, {"invoice_number", 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{Keys: bson.D{{"status", 1}}},
+		},
+		// The room charge reconciliation report reads postings by date and status
+		roomChargePostingCollection: {
+			{Keys: bson.D{{"invoice_id", 1}}},
+			{Keys: bson.D{{"created_at", 1}}},
+			{Keys: bson.D{{"status", 1}}},
+		},
+		invoiceNumberGapCollection: {
+			{Keys: bson.D{{"location_id", 1}, {"invoice_number", 1}}},
+		},
+		// Invoice deliveries look up the status of their queued emails, delivery status callbacks look up
+		// messages by the provider's id, and the delivery job the messages still queued
+		outboundMessageCollection: {
+			{Keys: bson.D{{"message_id", 1}}},
+			{Keys: bson.D{{"provider", 1}, {"provider_message_id", 1}}},
+			{Keys: bson.D{{"channel", 1}, {"status", 1}, {"created_at", 1}}},
+		},
+		providerMenuMappingCollection: {
+			{Keys: bson.D{{"provider", 1}, {"provider_item_id", 1}}, Options: options.Index().SetUnique(true)},
+		},
+		// A cashier has at most one open drawer; cash sales are totalled per session
+		cashSessionCollection: {
+			{
+				Keys:    bson.D{{"opened_by", 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"status": "OPEN"}),
+			},
+		},
+		// Deposits are looked up by their reservation when the guests' invoice is created
+		prepaymentCollection: {
+			{Keys: bson.D{{"reservation_id", 1}, {"status", 1}}},
+		},
+		// Credit notes are listed per invoice and by date for sales report reversals
+		creditNoteCollection: {
+			{Keys: bson.D{{"invoice_id", 1}}},
+			{Keys: bson.D{{"created_at", 1}}},
+			{Keys: bson.D{{"credit_note_number", 1}}, Options: options.Index().SetUnique(true)},
+			// A refund made at the payment provider is credited once
+			{
+				Keys:    bson.D{{"provider_refund_id", 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"provider_refund_id": bson.M{"$type": "string"}}),
+			},
+		},
+		// Coupon codes are unique; discounts without a code are not indexed
+		discountCollection: {
+			{
+				Keys:    bson.D{{"code", 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"code": bson.M{"$type": "string"}}),
+			},
+		},
+		giftCardCollection: {
+			{Keys: bson.D{{"code", 1}}, Options: options.Index().SetUnique(true)},
+		},
+		giftCardTransactionCollection: {
+			{Keys: bson.D{{"gift_card_id", 1}, {"created_at", 1}}},
+		},
+		// Analytics events expire after ANALYTICS_RETENTION_DAYS
+		analyticsEventCollection: {
+			{Keys: bson.D{{"received_at", 1}}, Options: options.Index().SetExpireAfterSeconds(int32(envInt("ANALYTICS_RETENTION_DAYS", 30) * 24 * 60 * 60))},
+			{Keys: bson.D{{"name", 1}, {"occurred_at", 1}}},
+		},
+		sectionAssignmentCollection: {
+			{Keys: bson.D{{"starts_at", 1}, {"ends_at", 1}}},
+			{Keys: bson.D{{"server_id", 1}, {"starts_at", 1}}},
+		},
+		seatingCollection: {
+			{Keys: bson.D{{"table_id", 1}, {"cleared_at", 1}}},
+			{Keys: bson.D{{"server_id", 1}, {"seated_at", 1}}},
+			{Keys: bson.D{{"seated_at", 1}}},
+		},
+		// Table numbers are unique per location among the tables not deleted
+		tableCollection: {
+			{
+				Keys:    bson.D{{"location_id", 1}, {"active_table_number", 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"active_table_number": bson.M{"$gt": 0}}),
+			},
+		},
+		waitlistCollection: {
+			{Keys: bson.D{{"status", 1}, {"created_at", 1}}},
+			{Keys: bson.D{{"status_token", 1}}, Options: options.Index().SetUnique(true)},
+		},
+		// Reset links are looked up by their token and counted per user
+		passwordResetCollection: {
+			{Keys: bson.D{{"token_hash", 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{"user_id", 1}, {"created_at", -1}}},
+		},
+		// Verification codes are counted per number and expire a day after they were sent
+		oneTimeCodeCollection: {
+			{Keys: bson.D{{"phone", 1}, {"created_at", -1}}},
+			{Keys: bson.D{{"requested_ip", 1}, {"created_at", -1}}},
+			{Keys: bson.D{{"created_at", 1}}, Options: options.Index().SetExpireAfterSeconds(24 * 60 * 60)},
+		},
+		// Kitchen events are numbered once and expire after KITCHEN_EVENT_RETENTION_HOURS
+		kitchenEventCollection: {
+			{Keys: bson.D{{"sequence", 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{"created_at", 1}}, Options: options.Index().SetExpireAfterSeconds(int32(envInt("KITCHEN_EVENT_RETENTION_HOURS", 24) * 60 * 60))},
+		},
+		// A user has one preferences document, read for every notification sent to them
+		notificationPreferencesCollection: {
+			{Keys: bson.D{{"user_id", 1}}, Options: options.Index().SetUnique(true)},
+		},
+		// Notifications are sent to each user and listed per recipient, newest first
+		notificationCollection: {
+			{Keys: bson.D{{"recipient_id", 1}, {"created_at", -1}}},
+		},
+	}
+
+	// Tables saved before table numbers were unique get their active number first
+	_, err := tableCollection.UpdateMany(
+		ctx,
+		bson.M{"active_table_number": nil, "deleted_at": nil, "table_number": bson.M{"$gt": 0}, "combined_table_ids.0": bson.M{"$exists": false}},
+		mongo.Pipeline{{{"$set", bson.D{{"active_table_number", "$table_number"}}}}},
+	)
+	if err != nil {
+		log.Println("failed to set the active table numbers:", err)
+	}
+
+	// Indexes replaced by others are dropped, so their constraints no longer apply
+	obsoleteIndexes := map[*mongo.Collection][]string{
+		invoiceCollection: {"invoice_number_1"},
+	}
+	for collection, names := range obsoleteIndexes {
+		for _, name := range names {
+			_, err := collection.Indexes().DropOne(ctx, name)
+			var commandErr mongo.CommandError
+			if err != nil && !(errors.As(err, &commandErr) && (commandErr.Code == 26 || commandErr.Code == 27)) {
+				log.Println("failed to drop index", name, "on", collection.Name(), ":", err)
+			}
+		}
+	}
+
+	// An index cannot be created again with another expiry, so the expiry of existing TTL indexes is
+	// changed in place when their retention setting changed
+	for collection, indexModels := range indexes {
+		for _, indexModel := range indexModels {
+			if indexModel.Options == nil || indexModel.Options.ExpireAfterSeconds == nil {
+				continue
+			}
+			err := collection.Database().RunCommand(ctx, bson.D{
+				{"collMod", collection.Name()},
+				{"index", bson.D{{"keyPattern", indexModel.Keys}, {"expireAfterSeconds", *indexModel.Options.ExpireAfterSeconds}}},
+			}).Err()
+			var commandErr mongo.CommandError
+			if err != nil && !(errors.As(err, &commandErr) && (commandErr.Code == 26 || commandErr.Code == 27)) {
+				log.Println("failed to update the expiry of an index on", collection.Name(), ":", err)
+			}
+		}
+	}
+
+	for collection, indexModels := range indexes {
+		if _, err := collection.Indexes().CreateMany(ctx, indexModels); err != nil {
+			log.Println("failed to create indexes on", collection.Name(), ":", err)
+		}
+	}
+}
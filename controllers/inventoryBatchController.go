@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var inventoryBatchCollection *mongo.Collection = database.OpenCollection(database.Client, "inventoryBatch")
+
+// ExpiringBatch is a batch that expires soon, with what it is worth
+type ExpiringBatch struct {
+	models.InventoryBatch
+	Name    string   `json:"name"`
+	Unit    string   `json:"unit"`
+	Value   *float64 `json:"value"`
+	Expired bool     `json:"expired"`
+}
+
+// applyMovementBatches keeps the batches in step with a movement before it is recorded. Stock coming in
+// with an expiry date becomes a new batch and stock coming back goes to the batches the movement names;
+// stock of a perishable item going out is taken from its batches at the location, the first to expire first.
+func applyMovementBatches(ctx context.Context, movement *models.InventoryMovement) error {
+	quantity := *movement.Quantity
+
+	if movement.Expires_at != nil {
+		if quantity < 0 {
+			return errors.New("only stock coming in can have an expiry date")
+		}
+		batch := models.InventoryBatch{
+			ID:                 primitive.NewObjectID(),
+			Inventory_item_id:  *movement.Inventory_item_id,
+			Location_id:        movement.Location_id,
+			Lot_number:         movement.Lot_number,
+			Expires_at:         *movement.Expires_at,
+			Received_quantity:  quantity,
+			Remaining_quantity: quantity,
+			Movement_id:        movement.Movement_id,
+			Created_at:         movement.Created_at,
+		}
+		batch.Inventory_batch_id = batch.ID.Hex()
+		if _, err := inventoryBatchCollection.InsertOne(ctx, batch); err != nil {
+			return err
+		}
+		movement.Batches = []models.MovementBatch{{Inventory_batch_id: batch.Inventory_batch_id, Quantity: quantity}}
+		return nil
+	}
+
+	if quantity > 0 {
+		for _, batch := range movement.Batches {
+			_, err := inventoryBatchCollection.UpdateOne(
+				ctx,
+				bson.M{"inventory_batch_id": batch.Inventory_batch_id},
+				bson.D{{"$inc", bson.D{{"remaining_quantity", batch.Quantity}}}},
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	movement.Batches = nil
+	var item models.InventoryItem
+	if err := inventoryItemCollection.FindOne(ctx, bson.M{"inventory_item_id": movement.Inventory_item_id}).Decode(&item); err != nil {
+		return err
+	}
+	if item.Perishable == nil || !*item.Perishable {
+		return nil
+	}
+
+	result, err := inventoryBatchCollection.Find(
+		ctx,
+		bson.M{"inventory_item_id": movement.Inventory_item_id, "location_id": movement.Location_id, "remaining_quantity": bson.M{"$gt": 0}},
+		options.Find().SetSort(bson.D{{"expires_at", 1}, {"created_at", 1}}),
+	)
+	if err != nil {
+		return err
+	}
+	var batches []models.InventoryBatch
+	if err = result.All(ctx, &batches); err != nil {
+		return err
+	}
+	// Stock beyond what the batches hold was received without an expiry date and is not tracked
+	needed := -quantity
+	for _, batch := range batches {
+		if needed <= 0 {
+			break
+		}
+		take := toFixed(math.Min(needed, batch.Remaining_quantity), 3)
+		if take <= 0 {
+			continue
+		}
+		updated, err := inventoryBatchCollection.UpdateOne(
+			ctx,
+			bson.M{"inventory_batch_id": batch.Inventory_batch_id, "remaining_quantity": bson.M{"$gte": take}},
+			bson.D{{"$inc", bson.D{{"remaining_quantity", -take}}}},
+		)
+		if err != nil {
+			return err
+		}
+		if updated.MatchedCount == 0 {
+			continue
+		}
+		movement.Batches = append(movement.Batches, models.MovementBatch{Inventory_batch_id: batch.Inventory_batch_id, Quantity: -take})
+		needed -= take
+	}
+	return nil
+}
+
+// takenBatches returns what the movements matching filter took from each batch, as the quantities that
+// give it back
+func takenBatches(ctx context.Context, filter bson.M) ([]models.MovementBatch, error) {
+	filter["quantity"] = bson.M{"$lt": 0}
+	result, err := inventoryMovementCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var movements []models.InventoryMovement
+	if err = result.All(ctx, &movements); err != nil {
+		return nil, err
+	}
+	var batches []models.MovementBatch
+	for _, movement := range movements {
+		for _, batch := range movement.Batches {
+			batches = append(batches, models.MovementBatch{Inventory_batch_id: batch.Inventory_batch_id, Quantity: -batch.Quantity})
+		}
+	}
+	return batches, nil
+}
+
+// GetInventoryItemBatches lists the batches of an item that are not used up, the first to expire first
+func GetInventoryItemBatches() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{"inventory_item_id": c.Param("inventory_item_id"), "remaining_quantity": bson.M{"$gt": 0}}
+		if locationId := c.Query("location_id"); locationId != "" {
+			filter["location_id"] = locationId
+		}
+		result, err := inventoryBatchCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{"expires_at", 1}, {"created_at", 1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing batches"})
+			return
+		}
+		batches := []models.InventoryBatch{}
+		if err = result.All(ctx, &batches); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing batches"})
+			return
+		}
+		c.JSON(http.StatusOK, batches)
+	}
+}
+
+// GetExpiringBatches lists the batches that have expired or expire within the next days, the first to
+// expire first, so they are used or written off before they spoil
+func GetExpiringBatches() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		days := 3
+		if c.Query("days") != "" {
+			value, err := strconv.Atoi(c.Query("days"))
+			if err != nil || value < 0 || value > 90 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 0 and 90"})
+				return
+			}
+			days = value
+		}
+
+		now := time.Now()
+		filter := bson.M{"remaining_quantity": bson.M{"$gt": 0}, "expires_at": bson.M{"$lte": now.AddDate(0, 0, days)}}
+		if locationId := c.Query("location_id"); locationId != "" {
+			filter["location_id"] = locationId
+		}
+		result, err := inventoryBatchCollection.Find(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing batches"})
+			return
+		}
+		var batches []models.InventoryBatch
+		if err = result.All(ctx, &batches); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing batches"})
+			return
+		}
+
+		ids := []string{}
+		for _, batch := range batches {
+			ids = append(ids, batch.Inventory_item_id)
+		}
+		result, err = inventoryItemCollection.Find(ctx, bson.M{"inventory_item_id": bson.M{"$in": ids}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing inventory items"})
+			return
+		}
+		var items []models.InventoryItem
+		if err = result.All(ctx, &items); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing inventory items"})
+			return
+		}
+		itemsById := map[string]models.InventoryItem{}
+		for _, item := range items {
+			itemsById[item.Inventory_item_id] = item
+		}
+
+		expiring := []ExpiringBatch{}
+		for _, batch := range batches {
+			entry := ExpiringBatch{InventoryBatch: batch, Expired: !batch.Expires_at.After(now)}
+			if item, ok := itemsById[batch.Inventory_item_id]; ok {
+				entry.Name, entry.Unit = *item.Name, *item.Unit
+				if item.Unit_cost != nil {
+					value := toFixed(batch.Remaining_quantity**item.Unit_cost, 2)
+					entry.Value = &value
+				}
+			}
+			expiring = append(expiring, entry)
+		}
+		sort.SliceStable(expiring, func(i, j int) bool { return expiring[i].Expires_at.Before(expiring[j].Expires_at) })
+		c.JSON(http.StatusOK, expiring)
+	}
+}
@@ -0,0 +1,368 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var inventoryItemCollection *mongo.Collection = database.OpenCollection(database.Client, "inventoryItem")
+
+var inventoryMovementCollection *mongo.Collection = database.OpenCollection(database.Client, "inventoryMovement")
+
+type InventoryItemView struct {
+	models.InventoryItem `bson:",inline"`
+	On_hand              float64 `json:"on_hand"`
+}
+
+func GetInventoryItems() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := inventoryItemCollection.Find(ctx, bson.M{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing inventory items"})
+			return
+		}
+
+		var items []models.InventoryItem
+		if err = result.All(ctx, &items); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing inventory items"})
+			return
+		}
+
+		var ids []string
+		for _, item := range items {
+			ids = append(ids, item.Inventory_item_id)
+		}
+		levels, err := stockLevels(ctx, ids, c.Query("location_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating stock levels"})
+			return
+		}
+
+		views := []InventoryItemView{}
+		for _, item := range items {
+			views = append(views, InventoryItemView{InventoryItem: item, On_hand: levels[item.Inventory_item_id]})
+		}
+		c.JSON(http.StatusOK, views)
+	}
+}
+
+func GetInventoryItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		inventoryItemId := c.Param("inventory_item_id")
+		var item models.InventoryItem
+
+		if err := inventoryItemCollection.FindOne(ctx, bson.M{"inventory_item_id": inventoryItemId}).Decode(&item); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "inventory item was not found"})
+			return
+		}
+
+		levels, err := stockLevels(ctx, []string{inventoryItemId}, c.Query("location_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating stock levels"})
+			return
+		}
+		c.JSON(http.StatusOK, InventoryItemView{InventoryItem: item, On_hand: levels[inventoryItemId]})
+	}
+}
+
+func CreateInventoryItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var item models.InventoryItem
+
+		if err := c.BindJSON(&item); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(item)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		if err := checkBarcodes(ctx, item.Barcodes, ""); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		item.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		item.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		item.ID = primitive.NewObjectID()
+		item.Inventory_item_id = item.ID.Hex()
+
+		result, insertErr := inventoryItemCollection.InsertOne(ctx, item)
+		if insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "inventory item was not created"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// UpdateInventoryItem renames an inventory item or changes its unit cost, barcodes, perishability, par
+// level or reorder point. The unit can only change while the item has no movements, since the ledger's
+// quantities are recorded in it.
+func UpdateInventoryItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		inventoryItemId := c.Param("inventory_item_id")
+		var item models.InventoryItem
+		if err := c.BindJSON(&item); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var updateObj primitive.D
+		if item.Name != nil {
+			if len(*item.Name) < 2 || len(*item.Name) > 100 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "name must be 2 to 100 characters"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"name", item.Name})
+		}
+		if item.Unit != nil {
+			if *item.Unit == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unit cannot be empty"})
+				return
+			}
+			movements, err := inventoryMovementCollection.CountDocuments(ctx, bson.M{"inventory_item_id": inventoryItemId})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the item's movements"})
+				return
+			}
+			if movements > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "the unit of an item with movements cannot change"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"unit", item.Unit})
+		}
+		if item.Unit_cost != nil {
+			if *item.Unit_cost < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unit_cost cannot be negative"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"unit_cost", item.Unit_cost})
+		}
+		if item.Barcodes != nil {
+			if validationErr := validate.Var(item.Barcodes, "max=20,dive"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+				return
+			}
+			if err := checkBarcodes(ctx, item.Barcodes, inventoryItemId); err != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"barcodes", item.Barcodes})
+		}
+		if item.Perishable != nil {
+			updateObj = append(updateObj, bson.E{"perishable", item.Perishable})
+		}
+		if item.Par_level != nil {
+			if *item.Par_level < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "par_level cannot be negative"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"par_level", item.Par_level})
+		}
+		if item.Reorder_point != nil {
+			if *item.Reorder_point < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "reorder_point cannot be negative"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"reorder_point", item.Reorder_point})
+		}
+
+		item.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{"updated_at", item.Updated_at})
+
+		var existing models.InventoryItem
+		if err := inventoryItemCollection.FindOne(ctx, bson.M{"inventory_item_id": inventoryItemId}).Decode(&existing); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "inventory item was not found"})
+			return
+		}
+		result, err := inventoryItemCollection.UpdateOne(ctx, bson.M{"inventory_item_id": inventoryItemId}, bson.D{{"$set", updateObj}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "inventory item update failed"})
+			return
+		}
+		if item.Unit_cost != nil {
+			if item.Name != nil {
+				existing.Name = item.Name
+			}
+			if err := checkFoodMargins(ctx, existing, existing.Unit_cost, *item.Unit_cost); err != nil {
+				log.Println("failed to check the food margins after the cost of", inventoryItemId, "changed:", err)
+			}
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+func GetInventoryMovements() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if inventoryItemId := c.Param("inventory_item_id"); inventoryItemId != "" {
+			filter["inventory_item_id"] = inventoryItemId
+		} else if inventoryItemId := c.Query("inventory_item_id"); inventoryItemId != "" {
+			filter["inventory_item_id"] = inventoryItemId
+		}
+		if movementType := c.Query("type"); movementType != "" {
+			filter["type"] = movementType
+		}
+		if locationId := c.Query("location_id"); locationId != "" {
+			filter["location_id"] = locationId
+		}
+
+		opts := options.Find().SetSort(bson.D{{"created_at", 1}, {"_id", 1}})
+		result, err := inventoryMovementCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing inventory movements"})
+			return
+		}
+
+		var movements []models.InventoryMovement
+		if err = result.All(ctx, &movements); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing inventory movements"})
+			return
+		}
+		c.JSON(http.StatusOK, movements)
+	}
+}
+
+func CreateInventoryMovement() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var movement models.InventoryMovement
+
+		if err := c.BindJSON(&movement); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(movement)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		// Any staff member can book deliveries; stock taken out or corrected by hand is on managers
+		if role := c.GetString("role"); *movement.Type != "RECEIPT" && role != "MANAGER" && role != "ADMIN" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only managers can record " + *movement.Type + " movements"})
+			return
+		}
+
+		var item models.InventoryItem
+		if err := inventoryItemCollection.FindOne(ctx, bson.M{"inventory_item_id": movement.Inventory_item_id}).Decode(&item); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "inventory item was not found"})
+			return
+		}
+		if *movement.Type == "RECEIPT" && item.Perishable != nil && *item.Perishable && movement.Expires_at == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at is required to receive a perishable item"})
+			return
+		}
+
+		// Only the server decides which batches a movement uses
+		movement.Batches = nil
+		movement.Created_by = c.GetString("uid")
+		if err := recordInventoryMovement(ctx, &movement); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, movement)
+	}
+}
+
+// recordInventoryMovement normalises the sign of a movement from its type, updates the batches it uses and
+// appends it to the ledger
+func recordInventoryMovement(ctx context.Context, movement *models.InventoryMovement) error {
+	quantity := *movement.Quantity
+	if quantity == 0 {
+		return errors.New("quantity cannot be zero")
+	}
+
+	switch *movement.Type {
+	case "RECEIPT":
+		quantity = math.Abs(quantity)
+	case "DEPLETION", "WASTE":
+		quantity = -math.Abs(quantity)
+	}
+	movement.Quantity = &quantity
+
+	if (*movement.Type == "WASTE" || *movement.Type == "ADJUSTMENT") && (movement.Reason == nil || *movement.Reason == "") {
+		return errors.New("a reason is required for " + *movement.Type + " movements")
+	}
+
+	if movement.Created_by == "" {
+		movement.Created_by = "system"
+	}
+	movement.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	movement.ID = primitive.NewObjectID()
+	movement.Movement_id = movement.ID.Hex()
+
+	if err := applyMovementBatches(ctx, movement); err != nil {
+		return err
+	}
+
+	_, err := inventoryMovementCollection.InsertOne(ctx, movement)
+	return err
+}
+
+// stockLevels derives the current on-hand quantity of the given inventory items from the ledger, at a
+// location or, when locationId is empty, at all locations together
+func stockLevels(ctx context.Context, inventoryItemIds []string, locationId string) (map[string]float64, error) {
+	levels := map[string]float64{}
+	if len(inventoryItemIds) == 0 {
+		return levels, nil
+	}
+
+	match := bson.D{{"inventory_item_id", bson.D{{"$in", inventoryItemIds}}}}
+	if locationId != "" {
+		match = append(match, bson.E{"location_id", locationId})
+	}
+	matchStage := bson.D{{"$match", match}}
+	groupStage := bson.D{{"$group", bson.D{{"_id", "$inventory_item_id"}, {"on_hand", bson.D{{"$sum", "$quantity"}}}}}}
+
+	result, err := inventoryMovementCollection.Aggregate(ctx, mongo.Pipeline{matchStage, groupStage})
+	if err != nil {
+		return levels, err
+	}
+
+	var rows []struct {
+		Id      string  `bson:"_id"`
+		On_hand float64 `bson:"on_hand"`
+	}
+	if err = result.All(ctx, &rows); err != nil {
+		return levels, err
+	}
+	for _, row := range rows {
+		levels[row.Id] = row.On_hand
+	}
+	return levels, nil
+}
@@ -13,18 +13,36 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type InvoiceViewFormat struct {
-	Invoice_id       string
-	Payment_method   string
-	Order_id         string
-	Payment_status   *string
-	Payment_due      interface{}
-	Table_number     interface{}
-	Payment_due_date time.Time
-	Order_details    interface{}
+	Invoice_id           string
+	Invoice_number       string
+	Payment_method       string
+	Order_id             string
+	Session_id           *string
+	Order_ids            []string
+	Order_number         interface{}
+	Payment_status       *string
+	Payment_due          models.Money
+	Table_number         interface{}
+	Payment_due_date     time.Time
+	Order_details        interface{}
+	Subtotal             models.Money
+	Buffet_lines         []models.InvoiceBuffetLine
+	Buffet_total         models.Money
+	Applied_discounts    []models.AppliedDiscount
+	Discount_total       models.Money
+	Tax_lines            []models.InvoiceTaxLine
+	Tax_total            models.Money
+	Prices_include_tax   bool
+	Service_charge       models.Money
+	Service_charge_lines []models.InvoiceServiceChargeLine
+	Tip                  *models.Money
+	Grand_total          models.Money
+	Deposit_total        models.Money
+	Currency             string
+	Formatted            map[string]string
 }
 
 var invoiceCollection *mongo.Collection = database.OpenCollection(database.Client, "invoice")
@@ -33,17 +51,22 @@ func GetInvoices() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 
-		result, err := invoiceCollection.Find(context.TODO(), bson.M{})
+		filter := bson.M{}
+		if locationId := c.Query("location_id"); locationId != "" {
+			filter["location_id"] = locationId
+		}
+		result, err := invoiceCollection.Find(context.TODO(), filter)
 		defer cancel()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing invoice items"})
 		}
 
-		var allInvoices []bson.M
+		// Decoded into models.Invoice so amounts are returned in major units
+		var allInvoices []models.Invoice
 		if err = result.All(ctx, &allInvoices); err != nil {
 			log.Fatal(err)
 		}
-		c.JSON(http.StatusOK, allInvoices)
+		maskedJSON(c, http.StatusOK, allInvoices)
 	}
 }
 
@@ -64,6 +87,8 @@ func GetInvoice() gin.HandlerFunc {
 
 		allOrderItems, err := ItemsByOrder(invoice.Order_id)
 		invoiceView.Order_id = invoice.Order_id
+		invoiceView.Session_id = invoice.Session_id
+		invoiceView.Order_ids = invoice.Order_ids
 		invoiceView.Payment_due_date = invoice.Payment_due_date
 
 		invoiceView.Payment_method = "null"
@@ -72,12 +97,69 @@ func GetInvoice() gin.HandlerFunc {
 		}
 
 		invoiceView.Invoice_id = invoice.Invoice_id
+		invoiceView.Invoice_number = invoice.Invoice_number
 		invoiceView.Payment_status = *&invoice.Payment_status
-		invoiceView.Payment_due = allOrderItems[0]["payment_due"]
-		invoiceView.Table_number = allOrderItems[0]["table_number"]
-		invoiceView.Order_details = allOrderItems[0]["order_items"]
+		invoiceView.Payment_due = invoiceAmountDue(invoice)
+		if len(allOrderItems) > 0 {
+			invoiceView.Table_number = allOrderItems[0]["table_number"]
+			invoiceView.Order_number = allOrderItems[0]["order_number"]
+			invoiceView.Order_details = allOrderItems[0]["order_items"]
+		}
+
+		// A session invoice lists the items of all the session's orders
+		if len(invoice.Order_ids) > 1 {
+			details := primitive.A{}
+			for _, orderId := range invoice.Order_ids {
+				orderItems, err := ItemsByOrder(orderId)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing invoice item"})
+					return
+				}
+				if len(orderItems) > 0 {
+					if items, ok := orderItems[0]["order_items"].(primitive.A); ok {
+						details = append(details, items...)
+					}
+				}
+			}
+			invoiceView.Order_details = details
+		}
+
+		invoiceView.Subtotal = invoice.Subtotal
+		invoiceView.Buffet_lines = invoice.Buffet_lines
+		invoiceView.Buffet_total = invoice.Buffet_total
+		invoiceView.Applied_discounts = invoice.Applied_discounts
+		invoiceView.Discount_total = invoice.Discount_total
+		invoiceView.Tax_lines = invoice.Tax_lines
+		invoiceView.Tax_total = invoice.Tax_total
+		invoiceView.Prices_include_tax = invoice.Prices_include_tax
+		invoiceView.Service_charge = invoice.Service_charge
+		invoiceView.Service_charge_lines = invoice.Service_charge_lines
+		invoiceView.Tip = invoice.Tip
+		invoiceView.Grand_total = invoice.Grand_total
+		invoiceView.Deposit_total = invoice.Deposit_total
+
+		// Amounts formatted for display in the restaurant's currency and locale
+		settings, err := loadSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the settings"})
+			return
+		}
+		invoiceView.Currency = settingsCurrency(settings)
+		invoiceView.Formatted = map[string]string{
+			"subtotal":       formatMoney(invoice.Subtotal, settings),
+			"buffet_total":   formatMoney(invoice.Buffet_total, settings),
+			"discount_total": formatMoney(invoice.Discount_total, settings),
+			"tax_total":      formatMoney(invoice.Tax_total, settings),
+			"service_charge": formatMoney(invoice.Service_charge, settings),
+			"grand_total":    formatMoney(invoice.Grand_total, settings),
+			"deposit_total":  formatMoney(invoice.Deposit_total, settings),
+			"payment_due":    formatMoney(invoiceView.Payment_due, settings),
+		}
+		if invoice.Tip != nil {
+			invoiceView.Formatted["tip"] = formatMoney(*invoice.Tip, settings)
+		}
 
-		c.JSON(http.StatusOK, invoiceView)
+		maskedJSON(c, http.StatusOK, invoiceView)
 	}
 }
 
@@ -100,6 +182,49 @@ func CreateInvoice() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			return
 		}
+
+		// A create call retried by the POS returns the invoice of the first call
+		key, err := idempotencyKey(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if existing, found, err := invoiceByIdempotencyKey(ctx, key); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking existing invoices"})
+			return
+		} else if found {
+			if existing.Order_id != invoice.Order_id || existing.Session_id != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for another invoice"})
+				return
+			}
+			maskedJSON(c, http.StatusOK, existing)
+			return
+		}
+
+		// An order has only one active invoice: creating it again returns the existing one, and an
+		// order billed on a session invoice must not be billed again on its own
+		billed, err := activeInvoices(ctx, []string{invoice.Order_id})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking existing invoices"})
+			return
+		}
+		if len(billed) > 0 {
+			if billed[0].Session_id != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": "order is already billed on a session invoice"})
+				return
+			}
+			maskedJSON(c, http.StatusOK, billed[0])
+			return
+		}
+		invoice.Session_id = nil
+		invoice.Order_ids = nil
+		invoice.Active_order_ids = []string{invoice.Order_id}
+		invoice.Idempotency_key = key
+		draft := "DRAFT"
+		invoice.Invoice_status = &draft
+		invoice.Finalized_by = nil
+		invoice.Finalized_at = nil
+
 		status := "PENDING"
 		if invoice.Payment_status == nil {
 			invoice.Payment_status = &status
@@ -116,9 +241,47 @@ func CreateInvoice() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
 			return
 		}
+		if err := checkPaymentMethod(ctx, invoice.Payment_method, invoice.Payment_details); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Discounts are only applied through the discount endpoints, which check their validity
+		invoice.Applied_discounts = nil
+		if err := calculateInvoiceTotals(ctx, &invoice); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating invoice totals"})
+			return
+		}
+
+		// Reservation deposits are credited when the invoice is created
+		invoice.Deposit_payments = nil
+		invoice.Deposit_total = 0
+		if err := applyReservationDeposits(ctx, &invoice, []models.Order{order}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while applying the reservation deposit"})
+			return
+		}
+
+		invoice.Location_id = order.Location_id
+		if err := assignInvoiceNumber(ctx, &invoice); err != nil {
+			releaseDepositPayments(ctx, invoice)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "invoice number could not be assigned"})
+			return
+		}
 
 		result, insertErr := invoiceCollection.InsertOne(ctx, invoice)
 		if insertErr != nil {
+			releaseDepositPayments(ctx, invoice)
+			// A concurrent call created the order's invoice first
+			if mongo.IsDuplicateKeyError(insertErr) {
+				recordInvoiceNumberGap(ctx, invoice, "invoice was created concurrently")
+				if billed, err := activeInvoices(ctx, []string{invoice.Order_id}); err == nil && len(billed) > 0 {
+					c.JSON(http.StatusOK, billed[0])
+					return
+				}
+				c.JSON(http.StatusConflict, gin.H{"error": "order is already invoiced"})
+				return
+			}
+			recordInvoiceNumberGap(ctx, invoice, "invoice could not be saved")
 			msg := fmt.Sprintf("invoice item was not created")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			return
@@ -149,16 +312,121 @@ func UpdateInvoice() gin.HandlerFunc {
 			updateObj = append(updateObj, bson.E{"payment_method", invoice.Payment_method})
 		}
 
+		if invoice.Payment_details != nil {
+			updateObj = append(updateObj, bson.E{"payment_details", invoice.Payment_details})
+		}
+
 		if invoice.Payment_status != nil {
 			updateObj = append(updateObj, bson.E{"payment_status", invoice.Payment_status})
 		}
 
+		validationErr := validate.Var(invoice.Tip, "omitempty,min=0")
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tip cannot be negative"})
+			return
+		}
+
+		// Amounts are recalculated from the order on every update of an unpaid invoice,
+		// so items added or voided after the invoice was created are reflected
+		var existingInvoice models.Invoice
+		if err := invoiceCollection.FindOne(ctx, filter).Decode(&existingInvoice); err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the invoice"})
+			return
+		}
+
+		// A split invoice is settled through its child invoices
+		if existingInvoice.Payment_status != nil && *existingInvoice.Payment_status == "SPLIT" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invoice has been split, update its split invoices instead"})
+			return
+		}
+		if invoice.Payment_status != nil && *invoice.Payment_status == "SPLIT" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "use the split endpoint to split an invoice"})
+			return
+		}
+
+		// Paid invoices are final: they are corrected through refunds and credit notes
+		if existingInvoice.Payment_status != nil && (*existingInvoice.Payment_status == "PAID" || *existingInvoice.Payment_status == "REFUNDED") {
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice has been paid and can no longer be changed"})
+			return
+		}
+		if existingInvoice.Payment_status != nil && *existingInvoice.Payment_status == "VOID" {
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice has been voided and can no longer be changed"})
+			return
+		}
+		if invoice.Payment_status != nil && *invoice.Payment_status == "VOID" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "use the void endpoint to void an invoice"})
+			return
+		}
+
+		// The amounts of a finalized invoice are fixed
+		if invoiceFinalized(existingInvoice) && invoice.Tip != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the tip can only be changed while the invoice is a draft"})
+			return
+		}
+
+		// Room charges are paid by the PMS acknowledgment
+		if invoice.Payment_method != nil && *invoice.Payment_method == "ROOM_CHARGE" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "use the room charge endpoint to charge an invoice to a room"})
+			return
+		}
+		if existingInvoice.Room_charge_posting_id != nil && (invoice.Payment_method != nil || invoice.Payment_status != nil) {
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice is being charged to a room"})
+			return
+		}
+
+		// Details sent on their own complete the payment method already on the invoice
+		if invoice.Payment_method != nil || invoice.Payment_details != nil {
+			method := invoice.Payment_method
+			if method == nil {
+				method = existingInvoice.Payment_method
+			}
+			if err := checkPaymentMethod(ctx, method, invoice.Payment_details); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if invoiceRecalculable(existingInvoice) {
+			if invoice.Tip == nil {
+				invoice.Tip = existingInvoice.Tip
+			}
+			totals := existingInvoice
+			totals.Tip = invoice.Tip
+			if err := calculateInvoiceTotals(ctx, &totals); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating invoice totals"})
+				return
+			}
+			updateObj = append(updateObj,
+				bson.E{"subtotal", totals.Subtotal},
+				bson.E{"buffet_lines", totals.Buffet_lines},
+				bson.E{"buffet_total", totals.Buffet_total},
+				bson.E{"applied_discounts", totals.Applied_discounts},
+				bson.E{"discount_total", totals.Discount_total},
+				bson.E{"tax_lines", totals.Tax_lines},
+				bson.E{"tax_total", totals.Tax_total},
+				bson.E{"prices_include_tax", totals.Prices_include_tax},
+				bson.E{"service_charge", totals.Service_charge},
+				bson.E{"service_charge_lines", totals.Service_charge_lines},
+				bson.E{"guests", totals.Guests},
+				bson.E{"tip", totals.Tip},
+				bson.E{"grand_total", totals.Grand_total},
+			)
+		}
+
 		invoice.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		updateObj = append(updateObj, bson.E{"updated_at", invoice.Updated_at})
 
-		upsert := true
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
+		// Paying a draft finalizes it with the totals calculated above
+		newlyPaid := invoice.Payment_status != nil && *invoice.Payment_status == "PAID"
+		if newlyPaid {
+			updateObj = append(updateObj, bson.E{"paid_at", invoice.Updated_at})
+			if !invoiceFinalized(existingInvoice) {
+				updateObj = append(updateObj, bson.E{"invoice_status", "FINALIZED"}, bson.E{"finalized_by", c.GetString("uid")}, bson.E{"finalized_at", invoice.Updated_at})
+			}
 		}
 
 		status := "PENDING"
@@ -166,14 +434,15 @@ func UpdateInvoice() gin.HandlerFunc {
 			invoice.Payment_status = &status
 		}
 
+		// The status is checked again on write, so a payment, void or split made since the invoice
+		// was read is not overwritten
 		result, err := invoiceCollection.UpdateOne(
 			ctx,
-			filter,
+			bson.M{"invoice_id": invoiceId, "payment_status": bson.M{"$nin": bson.A{"PAID", "REFUNDED", "VOID", "SPLIT"}}},
 			bson.D{
 
 				{"$set", updateObj},
 			},
-			&opt,
 		)
 		if err != nil {
 			msg := fmt.Sprintf("invoice item update failed")
@@ -181,6 +450,21 @@ func UpdateInvoice() gin.HandlerFunc {
 			return
 		}
 
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice was paid, voided or split meanwhile and can no longer be changed"})
+			return
+		}
+
+		if *invoice.Payment_status == "PAID" {
+			var paidInvoice models.Invoice
+			if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoiceId}).Decode(&paidInvoice); err == nil {
+				closeInvoiceOrdersIfSettled(ctx, paidInvoice, c.GetString("uid"))
+				if newlyPaid {
+					assignCashSession(ctx, paidInvoice, c.GetString("uid"))
+				}
+			}
+		}
+
 		defer cancel()
 		c.JSON(http.StatusOK, result)
 	}
@@ -0,0 +1,316 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/models"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type InvoiceEmailRequest struct {
+	Email *string `json:"email" validate:"omitempty,email"`
+}
+
+// invoiceEmailLine is a line of the emailed invoice, with its amount formatted for display
+type invoiceEmailLine struct {
+	Description string
+	Amount      string
+}
+
+// invoiceEmailView is what the invoice email template is rendered with
+type invoiceEmailView struct {
+	Title          string
+	Invoice_number string
+	Date           string
+	Lines          []invoiceEmailLine
+	Totals         []invoiceEmailLine
+	Payment_due    string
+	Paid           bool
+	Proforma       bool
+}
+
+var invoiceEmailTemplate = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+<h2>{{.Title}} {{.Invoice_number}}</h2>
+<p>{{.Date}}</p>
+<table cellpadding="4" style="border-collapse: collapse; min-width: 320px;">
+{{range .Lines}}<tr><td>{{.Description}}</td><td align="right">{{.Amount}}</td></tr>
+{{end}}<tr><td colspan="2"><hr></td></tr>
+{{range .Totals}}<tr><td>{{.Description}}</td><td align="right">{{.Amount}}</td></tr>
+{{end}}</table>
+{{if .Paid}}<p>Paid in full. Thank you for your visit!</p>{{else}}<p><strong>Amount due: {{.Payment_due}}</strong></p>{{end}}
+{{if .Proforma}}<p><em>Pro forma, this is not a tax invoice.</em></p>{{end}}
+</body>
+</html>
+`))
+
+// SendInvoice emails an invoice, or a receipt once it is paid, to the customer. The address is the
+// one in the request, or else the one the invoice was last sent to or the order's customer_email.
+// The email is queued in the outbound messages and the delivery is recorded on the invoice.
+func SendInvoice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request InvoiceEmailRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var invoice models.Invoice
+		if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": c.Param("invoice_id")}).Decode(&invoice); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
+		if invoice.Payment_status != nil && *invoice.Payment_status == "SPLIT" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invoice has been split, send its split invoices instead"})
+			return
+		}
+
+		to := request.Email
+		if to == nil {
+			to = invoice.Customer_email
+		}
+		if to == nil {
+			var order models.Order
+			if err := orderCollection.FindOne(ctx, bson.M{"order_id": invoice.Order_id}).Decode(&order); err == nil {
+				to = order.Customer_email
+			}
+		}
+		if to == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email is required, no address is stored for this invoice"})
+			return
+		}
+
+		settings, err := loadSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the settings"})
+			return
+		}
+		view, err := invoiceEmail(ctx, invoice, settings)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while preparing the invoice"})
+			return
+		}
+		kind := "INVOICE"
+		if view.Paid {
+			kind = "RECEIPT"
+		}
+		message, err := queueTemplatedEmail(ctx, *to, "invoice", view, "INVOICE_"+kind, invoice.Invoice_id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "invoice email could not be queued"})
+			return
+		}
+
+		delivery := models.InvoiceDelivery{
+			Message_id: message.Message_id,
+			To:         *to,
+			Kind:       kind,
+			Status:     message.Status,
+			Sent_by:    c.GetString("uid"),
+			Queued_at:  message.Created_at,
+		}
+		_, err = invoiceCollection.UpdateOne(
+			ctx,
+			bson.M{"invoice_id": invoice.Invoice_id},
+			bson.D{
+				{"$set", bson.D{{"customer_email", *to}}},
+				{"$push", bson.D{{"email_deliveries", delivery}}},
+			},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "invoice delivery could not be recorded"})
+			return
+		}
+		maskedJSON(c, http.StatusOK, delivery)
+	}
+}
+
+// GetInvoiceDeliveries lists the emails sent for an invoice, with their current delivery status
+func GetInvoiceDeliveries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var invoice models.Invoice
+		if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": c.Param("invoice_id")}).Decode(&invoice); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
+
+		deliveries, err := refreshInvoiceDeliveries(ctx, invoice)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking deliveries"})
+			return
+		}
+		maskedJSON(c, http.StatusOK, deliveries)
+	}
+}
+
+// refreshInvoiceDeliveries copies the delivery status of the invoice's queued emails onto the invoice
+func refreshInvoiceDeliveries(ctx context.Context, invoice models.Invoice) ([]models.InvoiceDelivery, error) {
+	deliveries := invoice.Email_deliveries
+	if deliveries == nil {
+		deliveries = []models.InvoiceDelivery{}
+	}
+
+	changed := false
+	for i, delivery := range deliveries {
+		// Emails are retried until they are sent or failed for good
+		if delivery.Status == "SENT" || delivery.Status == "DELIVERED" || delivery.Status == "FAILED" {
+			continue
+		}
+		var message models.OutboundMessage
+		err := outboundMessageCollection.FindOne(ctx, bson.M{"message_id": delivery.Message_id}).Decode(&message)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if message.Status != delivery.Status {
+			deliveries[i].Status = message.Status
+			deliveries[i].Sent_at = message.Sent_at
+			changed = true
+		}
+	}
+
+	if changed {
+		_, err := invoiceCollection.UpdateOne(ctx, bson.M{"invoice_id": invoice.Invoice_id}, bson.D{{"$set", bson.D{{"email_deliveries", deliveries}}}})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return deliveries, nil
+}
+
+// invoiceEmail lists the invoice's items, buffet charges and totals for the email
+func invoiceEmail(ctx context.Context, invoice models.Invoice, settings models.Settings) (invoiceEmailView, error) {
+	var view invoiceEmailView
+	view.Paid = invoice.Payment_status != nil && *invoice.Payment_status == "PAID"
+	view.Title = "Invoice"
+	if view.Paid {
+		view.Title = "Receipt"
+	}
+	view.Invoice_number = invoice.Invoice_number
+	view.Date = invoice.Created_at.Format("2 January 2006")
+	if invoice.Paid_at != nil {
+		view.Date = invoice.Paid_at.Format("2 January 2006")
+	}
+
+	cursor, err := orderItemCollection.Find(ctx, bson.M{"order_id": bson.M{"$in": invoiceOrderIds(invoice)}})
+	if err != nil {
+		return view, err
+	}
+	var orderItems []models.OrderItem
+	if err = cursor.All(ctx, &orderItems); err != nil {
+		return view, err
+	}
+	orderCursor, err := orderCollection.Find(ctx, bson.M{"order_id": bson.M{"$in": invoiceOrderIds(invoice)}})
+	if err != nil {
+		return view, err
+	}
+	var orders []models.Order
+	if err = orderCursor.All(ctx, &orders); err != nil {
+		return view, err
+	}
+	foods := map[string]models.Food{}
+	included, err := buffetIncludedItems(ctx, orders, orderItems, settings, foods)
+	if err != nil {
+		return view, err
+	}
+
+	for _, line := range invoice.Buffet_lines {
+		view.Lines = append(view.Lines, invoiceEmailLine{
+			Description: fmt.Sprintf("%s, %d × %s (%s)", line.Plan_name, line.Guests, strings.ToLower(line.Tier), formatMoney(line.Unit_price, settings)),
+			Amount:      formatMoney(line.Amount, settings),
+		})
+	}
+
+	split := map[string]bool{}
+	for _, orderItemId := range invoice.Split_items {
+		split[orderItemId] = true
+	}
+	for _, orderItem := range orderItems {
+		if orderItemStatus(orderItem) == "VOIDED" || orderItem.Unit_price == nil || (len(split) > 0 && !split[orderItem.Order_item_id]) {
+			continue
+		}
+		description := "Item"
+		if orderItem.Food_id != nil {
+			food, ok := foods[*orderItem.Food_id]
+			if !ok {
+				if err := foodCollection.FindOne(ctx, bson.M{"food_id": *orderItem.Food_id}).Decode(&food); err != nil && err != mongo.ErrNoDocuments {
+					return view, err
+				}
+				foods[*orderItem.Food_id] = food
+			}
+			if food.Name != nil {
+				description = *food.Name
+			}
+		}
+		if orderItem.Quantity != nil {
+			description += " (" + *orderItem.Quantity + ")"
+		}
+		if len(orderItem.Options) > 0 {
+			description += ": " + orderItemOptionNames(orderItem.Options)
+		}
+		amount := formatMoney(*orderItem.Unit_price, settings)
+		if included[orderItem.Order_item_id] {
+			amount = "included"
+		}
+		view.Lines = append(view.Lines, invoiceEmailLine{Description: description, Amount: amount})
+	}
+
+	view.Totals = append(view.Totals, invoiceEmailLine{"Subtotal", formatMoney(invoice.Subtotal, settings)})
+	for _, discount := range invoice.Applied_discounts {
+		view.Totals = append(view.Totals, invoiceEmailLine{discount.Name, formatMoney(-discount.Amount, settings)})
+	}
+	for _, tax := range invoice.Tax_lines {
+		description := fmt.Sprintf("%s (%g%%)", tax.Name, tax.Rate*100)
+		if taxClass, ok := findTaxClass(settings, tax.Tax_class); ok {
+			description = fmt.Sprintf("%s on %s (%g%%)", tax.Name, taxClass.Name, tax.Rate*100)
+		}
+		if invoice.Prices_include_tax {
+			description += ", included"
+		}
+		view.Totals = append(view.Totals, invoiceEmailLine{description, formatMoney(tax.Amount, settings)})
+	}
+	for _, line := range invoice.Service_charge_lines {
+		view.Totals = append(view.Totals, invoiceEmailLine{fmt.Sprintf("%s (%g%%)", line.Name, line.Rate*100), formatMoney(line.Amount, settings)})
+	}
+	if len(invoice.Service_charge_lines) == 0 && invoice.Service_charge > 0 {
+		view.Totals = append(view.Totals, invoiceEmailLine{"Service charge", formatMoney(invoice.Service_charge, settings)})
+	}
+	if invoice.Tip != nil && *invoice.Tip > 0 {
+		view.Totals = append(view.Totals, invoiceEmailLine{"Tip", formatMoney(*invoice.Tip, settings)})
+	}
+	view.Totals = append(view.Totals, invoiceEmailLine{"Total", formatMoney(invoice.Grand_total, settings)})
+	if invoice.Gift_card_total > 0 {
+		view.Totals = append(view.Totals, invoiceEmailLine{"Paid by gift card", formatMoney(-invoice.Gift_card_total, settings)})
+	}
+	if invoice.Deposit_total > 0 {
+		view.Totals = append(view.Totals, invoiceEmailLine{"Deposit paid", formatMoney(-invoice.Deposit_total, settings)})
+	}
+	view.Payment_due = formatMoney(invoiceAmountDue(invoice), settings)
+	return view, nil
+}
+
+// invoiceEmailText is the plain text version of the invoice email
+func invoiceEmailText(view invoiceEmailView) string {
+	var text strings.Builder
+	emailTemplates["invoice"].text.Execute(&text, view)
+	return text.String()
+}
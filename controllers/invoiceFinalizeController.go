@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"golang-restaurant-management/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// invoiceFinalized reports whether an invoice's amounts are fixed: it was finalized for payment, or it
+// has been paid. Invoices created before the DRAFT/FINALIZED lifecycle are drafts until they are paid.
+func invoiceFinalized(invoice models.Invoice) bool {
+	if invoice.Invoice_status != nil && *invoice.Invoice_status == "FINALIZED" {
+		return true
+	}
+	return invoice.Payment_status != nil && (*invoice.Payment_status == "PAID" || *invoice.Payment_status == "REFUNDED")
+}
+
+// orderItemsLocked reports whether the items of an order can no longer change, because an invoice billing
+// the order has been finalized or paid. Voided invoices do not lock their orders.
+func orderItemsLocked(ctx context.Context, orderId string) (bool, error) {
+	count, err := invoiceCollection.CountDocuments(ctx, bson.M{
+		"$and": bson.A{
+			bson.M{"$or": bson.A{bson.M{"order_id": orderId}, bson.M{"order_ids": orderId}}},
+			bson.M{"$or": bson.A{bson.M{"invoice_status": "FINALIZED"}, bson.M{"payment_status": bson.M{"$in": bson.A{"PAID", "REFUNDED"}}}}},
+		},
+		"payment_status": bson.M{"$ne": "VOID"},
+	})
+	return count > 0, err
+}
+
+// FinalizeInvoice settles a draft invoice for payment: its totals are calculated one last time and then
+// fixed, and the items of its orders can no longer change
+func FinalizeInvoice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var invoice models.Invoice
+		if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": c.Param("invoice_id")}).Decode(&invoice); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
+		if invoice.Payment_status == nil || *invoice.Payment_status != "PENDING" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only pending invoices can be finalized"})
+			return
+		}
+		if invoiceFinalized(invoice) {
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice is already finalized"})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		finalizedBy := c.GetString("uid")
+		finalized := bson.D{{"invoice_status", "FINALIZED"}, {"finalized_by", finalizedBy}, {"finalized_at", now}}
+		if invoiceRecalculable(invoice) {
+			err := saveInvoiceTotals(ctx, &invoice, bson.M{"room_charge_posting_id": nil}, finalized...)
+			if err != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": "invoice could not be finalized, please retry"})
+				return
+			}
+		} else {
+			// Evenly split invoices keep their share of the parent
+			result, err := invoiceCollection.UpdateOne(
+				ctx,
+				bson.M{"invoice_id": invoice.Invoice_id, "payment_status": "PENDING", "invoice_status": bson.M{"$ne": "FINALIZED"}},
+				bson.D{{"$set", append(finalized, bson.E{"updated_at", now})}},
+			)
+			if err != nil || result.MatchedCount == 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "invoice could not be finalized, please retry"})
+				return
+			}
+		}
+
+		status := "FINALIZED"
+		invoice.Invoice_status = &status
+		invoice.Finalized_by = &finalizedBy
+		invoice.Finalized_at = &now
+		maskedJSON(c, http.StatusOK, invoice)
+	}
+}
+
+// GetInvoicePrecheck renders the pre-check of an invoice for the waiter to print and hand to the guest:
+// the bill as it currently stands, marked as pro forma while the invoice is a draft. It is returned as
+// HTML, or as plain text for receipt printers with format=text.
+func GetInvoicePrecheck() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var invoice models.Invoice
+		if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": c.Param("invoice_id")}).Decode(&invoice); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
+		if invoice.Payment_status == nil || *invoice.Payment_status != "PENDING" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pre-checks can only be printed for pending invoices"})
+			return
+		}
+
+		// A draft shows the items ordered up to now
+		if invoiceRecalculable(invoice) {
+			if err := calculateInvoiceTotals(ctx, &invoice); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating invoice totals"})
+				return
+			}
+		}
+
+		settings, err := loadSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the settings"})
+			return
+		}
+		view, err := invoiceEmail(ctx, invoice, settings)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while preparing the pre-check"})
+			return
+		}
+		view.Date = time.Now().Format("2 January 2006 15:04")
+		if !invoiceFinalized(invoice) {
+			view.Title = "Pre-check"
+			view.Proforma = true
+		}
+
+		if c.Query("format") == "text" {
+			c.String(http.StatusOK, invoiceEmailText(view))
+			return
+		}
+		var html bytes.Buffer
+		if err := invoiceEmailTemplate.Execute(&html, view); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while preparing the pre-check"})
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", html.Bytes())
+	}
+}
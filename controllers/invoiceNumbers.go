@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var invoiceNumberGapCollection *mongo.Collection = database.OpenCollection(database.Client, "invoiceNumberGap")
+
+// defaultInvoiceNumberPrefix is used when the settings do not configure invoice_number_prefix
+const defaultInvoiceNumberPrefix = "INV"
+
+// assignInvoiceNumber gives a new invoice the next number of its location's sequence for the
+// current year, e.g. INV-2024-000123. The counter is incremented atomically, so concurrent
+// invoices never share a number; a number that ends up unused must be passed to recordInvoiceNumberGap.
+func assignInvoiceNumber(ctx context.Context, invoice *models.Invoice) error {
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		return err
+	}
+
+	if invoice.Location_id == nil {
+		var order models.Order
+		if err := orderCollection.FindOne(ctx, bson.M{"order_id": invoice.Order_id}).Decode(&order); err == nil {
+			invoice.Location_id = order.Location_id
+		}
+	}
+	location := "default"
+	if invoice.Location_id != nil {
+		location = *invoice.Location_id
+	}
+
+	// Invoices issued after midnight but before the business day starts belong to the previous day
+	year := businessDate(settings, time.Now())[:4]
+	value, err := nextCounter(ctx, fmt.Sprintf("invoice_number:%s:%s", location, year))
+	if err != nil {
+		return err
+	}
+
+	prefix := defaultInvoiceNumberPrefix
+	if settings.Invoice_number_prefix != nil {
+		prefix = *settings.Invoice_number_prefix
+	}
+	invoice.Invoice_number = fmt.Sprintf("%s-%s-%06d", prefix, year, value)
+	return nil
+}
+
+// recordInvoiceNumberGap keeps track of a number that was assigned but not used, so the sequence
+// can be accounted for. Failures are logged, since the invoice itself has already failed.
+func recordInvoiceNumberGap(ctx context.Context, invoice models.Invoice, reason string) {
+	if invoice.Invoice_number == "" {
+		return
+	}
+
+	var gap models.InvoiceNumberGap
+	gap.ID = primitive.NewObjectID()
+	gap.Invoice_number = invoice.Invoice_number
+	gap.Location_id = invoice.Location_id
+	gap.Reason = reason
+	gap.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	if _, err := invoiceNumberGapCollection.InsertOne(ctx, gap); err != nil {
+		log.Println("failed to record invoice number gap", invoice.Invoice_number, ":", err)
+	}
+}
+
+// GetInvoiceNumberGaps lists the invoice numbers that were skipped, optionally for one location
+func GetInvoiceNumberGaps() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if location := c.Query("location_id"); location != "" {
+			filter["location_id"] = location
+		}
+
+		opts := options.Find().SetSort(bson.D{{"invoice_number", 1}})
+		result, err := invoiceNumberGapCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing invoice number gaps"})
+			return
+		}
+		gaps := []models.InvoiceNumberGap{}
+		if err = result.All(ctx, &gaps); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing invoice number gaps"})
+			return
+		}
+		c.JSON(http.StatusOK, gaps)
+	}
+}
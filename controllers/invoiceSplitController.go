@@ -0,0 +1,316 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type InvoiceSplitRequest struct {
+	Type   string     `json:"type" validate:"required,eq=ITEMS|eq=EVEN"`
+	Parts  int        `json:"parts" validate:"omitempty,min=2,max=50"`
+	Groups [][]string `json:"groups"`
+}
+
+// SplitInvoice replaces a pending invoice with child invoices, either one per group of order
+// items ("ITEMS"; items left out of every group are billed together on one extra invoice) or
+// N equal shares ("EVEN"). The parent is marked SPLIT and its order closes only when every
+// child invoice is PAID.
+func SplitInvoice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request InvoiceSplitRequest
+		var parent models.Invoice
+
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		invoiceId := c.Param("invoice_id")
+		if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoiceId}).Decode(&parent); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
+		if parent.Payment_status == nil || *parent.Payment_status != "PENDING" || parent.Parent_invoice_id != nil || invoiceFinalized(parent) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only draft, unsplit invoices can be split"})
+			return
+		}
+
+		if parent.Deposit_total > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invoices with a reservation deposit cannot be split"})
+			return
+		}
+		if parent.Gift_card_total > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invoices paid in part with a gift card cannot be split"})
+			return
+		}
+
+		// Bring the parent up to date so the shares add up to what is currently owed
+		if err := calculateInvoiceTotals(ctx, &parent); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating invoice totals"})
+			return
+		}
+
+		var children []models.Invoice
+		var err error
+		if request.Type == "EVEN" {
+			if request.Parts < 2 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "parts must be at least 2 for an even split"})
+				return
+			}
+			children = evenSplitInvoices(parent, request.Parts)
+		} else {
+			if len(parent.Applied_discounts) > 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "remove the discounts before splitting by items, then apply them to the split invoices"})
+				return
+			}
+			if parent.Buffet_total > 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invoices with buffet charges can only be split evenly"})
+				return
+			}
+			children, err = itemSplitInvoices(ctx, parent, request.Groups)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		// Claim the parent first, so two terminals cannot split the same bill twice
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		result, err := invoiceCollection.UpdateOne(
+			ctx,
+			bson.M{"invoice_id": invoiceId, "payment_status": "PENDING"},
+			bson.D{{"$set", bson.D{{"payment_status", "SPLIT"}, {"updated_at", updatedAt}}}},
+		)
+		if err != nil || result.ModifiedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice was changed concurrently, please retry"})
+			return
+		}
+
+		// Every child invoice is a bill of its own and gets its own number
+		documents := []interface{}{}
+		for i := range children {
+			if err := assignInvoiceNumber(ctx, &children[i]); err != nil {
+				for _, child := range children[:i] {
+					recordInvoiceNumberGap(ctx, child, "split invoices could not be numbered")
+				}
+				invoiceCollection.UpdateOne(ctx, bson.M{"invoice_id": invoiceId}, bson.D{{"$set", bson.D{{"payment_status", "PENDING"}}}})
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "invoice number could not be assigned"})
+				return
+			}
+			documents = append(documents, children[i])
+		}
+		if _, err := invoiceCollection.InsertMany(ctx, documents); err != nil {
+			for _, child := range children {
+				recordInvoiceNumberGap(ctx, child, "split invoices could not be saved")
+			}
+			invoiceCollection.UpdateOne(ctx, bson.M{"invoice_id": invoiceId}, bson.D{{"$set", bson.D{{"payment_status", "PENDING"}}}})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "split invoices were not created"})
+			return
+		}
+		c.JSON(http.StatusOK, children)
+	}
+}
+
+func GetInvoiceSplits() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		invoiceId := c.Param("invoice_id")
+		result, err := invoiceCollection.Find(ctx, bson.M{"parent_invoice_id": invoiceId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing split invoices"})
+			return
+		}
+
+		var children []models.Invoice
+		if err = result.All(ctx, &children); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing split invoices"})
+			return
+		}
+		c.JSON(http.StatusOK, children)
+	}
+}
+
+// newSplitInvoice creates an unsaved pending child invoice of parent
+func newSplitInvoice(parent models.Invoice, splitType string, index int, count int) models.Invoice {
+	var child models.Invoice
+	status := "PENDING"
+
+	child.ID = primitive.NewObjectID()
+	child.Invoice_id = child.ID.Hex()
+	child.Order_id = parent.Order_id
+	child.Order_ids = parent.Order_ids
+	child.Location_id = parent.Location_id
+	child.Session_id = parent.Session_id
+	child.Payment_status = &status
+	draft := "DRAFT"
+	child.Invoice_status = &draft
+	child.Payment_due_date = parent.Payment_due_date
+	child.Parent_invoice_id = &parent.Invoice_id
+	child.Split_type = &splitType
+	child.Split_index = index
+	child.Split_count = count
+	child.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	child.Updated_at = child.Created_at
+	return child
+}
+
+// evenSplitInvoices divides every amount of the parent into parts equal shares.
+// Leftover minor units are put on the last share so the shares add up exactly, and each
+// child's totals are the sum of its own shares.
+func evenSplitInvoices(parent models.Invoice, parts int) []models.Invoice {
+	subtotals := parent.Subtotal.Allocate(parts)
+	discounts := parent.Discount_total.Allocate(parts)
+	serviceCharges := parent.Service_charge.Allocate(parts)
+	var tips []models.Money
+	if parent.Tip != nil {
+		tips = parent.Tip.Allocate(parts)
+	}
+	taxableAmounts := make([][]models.Money, len(parent.Tax_lines))
+	taxAmounts := make([][]models.Money, len(parent.Tax_lines))
+	for j, line := range parent.Tax_lines {
+		taxableAmounts[j] = line.Taxable_amount.Allocate(parts)
+		taxAmounts[j] = line.Amount.Allocate(parts)
+	}
+
+	var children []models.Invoice
+	for i := 0; i < parts; i++ {
+		child := newSplitInvoice(parent, "EVEN", i+1, parts)
+		child.Subtotal = subtotals[i]
+		child.Discount_total = discounts[i]
+		child.Service_charge = serviceCharges[i]
+		child.Tax_lines = []models.InvoiceTaxLine{}
+		for j, line := range parent.Tax_lines {
+			child.Tax_lines = append(child.Tax_lines, models.InvoiceTaxLine{
+				Name:           line.Name,
+				Tax_class:      line.Tax_class,
+				Rate:           line.Rate,
+				Taxable_amount: taxableAmounts[j][i],
+				Amount:         taxAmounts[j][i],
+			})
+			child.Tax_total += taxAmounts[j][i]
+		}
+		var tip models.Money
+		if parent.Tip != nil {
+			tip = tips[i]
+			child.Tip = &tip
+		}
+		child.Prices_include_tax = parent.Prices_include_tax
+		child.Grand_total = child.Subtotal - child.Discount_total + child.Service_charge + tip
+		if !child.Prices_include_tax {
+			child.Grand_total += child.Tax_total
+		}
+		children = append(children, child)
+	}
+	return children
+}
+
+// itemSplitInvoices creates one child invoice per group of order item ids. Every item may only be
+// in one group; billable items not in any group are billed together on an extra child invoice.
+func itemSplitInvoices(ctx context.Context, parent models.Invoice, groups [][]string) ([]models.Invoice, error) {
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("at least one group of order items is required")
+	}
+
+	cursor, err := orderItemCollection.Find(ctx, bson.M{"order_id": bson.M{"$in": invoiceOrderIds(parent)}})
+	if err != nil {
+		return nil, err
+	}
+	var orderItems []models.OrderItem
+	if err = cursor.All(ctx, &orderItems); err != nil {
+		return nil, err
+	}
+
+	billable := map[string]bool{}
+	for _, orderItem := range orderItems {
+		if orderItemStatus(orderItem) != "VOIDED" {
+			billable[orderItem.Order_item_id] = true
+		}
+	}
+
+	assigned := map[string]bool{}
+	for _, group := range groups {
+		if len(group) == 0 {
+			return nil, fmt.Errorf("split groups cannot be empty")
+		}
+		for _, orderItemId := range group {
+			if !billable[orderItemId] {
+				return nil, fmt.Errorf("order item %s is not a billable item of this order", orderItemId)
+			}
+			if assigned[orderItemId] {
+				return nil, fmt.Errorf("order item %s is in more than one group", orderItemId)
+			}
+			assigned[orderItemId] = true
+		}
+	}
+
+	var remaining []string
+	for _, orderItem := range orderItems {
+		if billable[orderItem.Order_item_id] && !assigned[orderItem.Order_item_id] {
+			remaining = append(remaining, orderItem.Order_item_id)
+		}
+	}
+	if len(remaining) > 0 {
+		groups = append(groups, remaining)
+	}
+	if len(groups) < 2 {
+		return nil, fmt.Errorf("a split needs at least two invoices")
+	}
+
+	var children []models.Invoice
+	for i, group := range groups {
+		child := newSplitInvoice(parent, "ITEMS", i+1, len(groups))
+		child.Split_items = group
+		if err := calculateInvoiceTotals(ctx, &child); err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+
+	// The tip is shared in proportion to what each child bills
+	if parent.Tip != nil {
+		subtotals := make([]models.Money, len(children))
+		for i, child := range children {
+			subtotals[i] = child.Subtotal
+		}
+		tips := parent.Tip.AllocateByWeights(subtotals)
+		for i := range children {
+			tip := tips[i]
+			children[i].Tip = &tip
+			children[i].Grand_total += tip
+		}
+	}
+	return children, nil
+}
+
+// closeOrderIfSettled closes an order as PAID once every invoice billing it is paid.
+// Split parents are skipped, since their children carry the amounts owed, and so are voided invoices.
+func closeOrderIfSettled(ctx context.Context, orderId string, changedBy string) error {
+	unpaid, err := invoiceCollection.CountDocuments(ctx, bson.M{
+		"$or":            bson.A{bson.M{"order_id": orderId}, bson.M{"order_ids": orderId}},
+		"payment_status": bson.M{"$nin": bson.A{"PAID", "SPLIT", "VOID"}},
+	})
+	if err != nil {
+		return err
+	}
+	if unpaid > 0 {
+		return nil
+	}
+	_, err = closeOrder(ctx, orderId, "PAID", changedBy)
+	return err
+}
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// invoiceRecalculable reports whether an invoice's amounts may still be recalculated from its order.
+// Finalized and paid invoices are final, split parents are replaced by their children, and evenly split
+// children carry a fixed share of the parent. An invoice being charged to a room keeps the amount sent to the PMS.
+func invoiceRecalculable(invoice models.Invoice) bool {
+	if invoiceFinalized(invoice) {
+		return false
+	}
+	if invoice.Payment_status != nil && (*invoice.Payment_status == "SPLIT" || *invoice.Payment_status == "VOID") {
+		return false
+	}
+	if invoice.Room_charge_posting_id != nil {
+		return false
+	}
+	return invoice.Split_type == nil || *invoice.Split_type != "EVEN"
+}
+
+// invoiceAmountDue is what is left to pay on an invoice after its gift card payments and reservation deposits
+func invoiceAmountDue(invoice models.Invoice) models.Money {
+	return invoice.Grand_total - invoice.Gift_card_total - invoice.Deposit_total
+}
+
+// invoicePaymentStatus is an invoice's payment status, or "" when it has none
+func invoicePaymentStatus(invoice models.Invoice) string {
+	if invoice.Payment_status == nil {
+		return ""
+	}
+	return *invoice.Payment_status
+}
+
+// calculateInvoiceTotals fills in the server-calculated amounts of an invoice from its order's
+// items (every order's items for a session invoice), the tax configuration and the service charge rules:
+// each item is taxed with its food's tax class, in the configured tax mode. Any amounts sent by the
+// client are overwritten.
+// Only the tip is taken from the invoice as provided.
+func calculateInvoiceTotals(ctx context.Context, invoice *models.Invoice) error {
+	cursor, err := orderItemCollection.Find(ctx, bson.M{"order_id": bson.M{"$in": invoiceOrderIds(*invoice)}})
+	if err != nil {
+		return err
+	}
+	var orderItems []models.OrderItem
+	if err = cursor.All(ctx, &orderItems); err != nil {
+		return err
+	}
+
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		return err
+	}
+
+	// An invoice split by items only bills its own share of the order
+	billed := map[string]bool{}
+	for _, orderItemId := range invoice.Split_items {
+		billed[orderItemId] = true
+	}
+
+	// Buffet orders are charged per guest; items from the buffet's menus are included in that price
+	orderCursor, err := orderCollection.Find(ctx, bson.M{"order_id": bson.M{"$in": invoiceOrderIds(*invoice)}})
+	if err != nil {
+		return err
+	}
+	var orders []models.Order
+	if err = orderCursor.All(ctx, &orders); err != nil {
+		return err
+	}
+	foods := map[string]models.Food{}
+	included, err := buffetIncludedItems(ctx, orders, orderItems, settings, foods)
+	if err != nil {
+		return err
+	}
+
+	// Items are taxed according to their food's tax class
+	classAmounts := map[string]models.Money{}
+	var subtotal models.Money
+	var billedItems []models.OrderItem
+	for _, orderItem := range orderItems {
+		if orderItemStatus(orderItem) == "VOIDED" || orderItem.Unit_price == nil || included[orderItem.Order_item_id] {
+			continue
+		}
+		if len(billed) > 0 && !billed[orderItem.Order_item_id] {
+			continue
+		}
+		class, err := orderItemTaxClass(ctx, orderItem, foods)
+		if err != nil {
+			return err
+		}
+		classAmounts[class] += *orderItem.Unit_price
+		subtotal += *orderItem.Unit_price
+		billedItems = append(billedItems, orderItem)
+	}
+
+	// Items split invoices bill their own items only, the per-head charges stay with unsplit invoices
+	invoice.Buffet_lines = nil
+	invoice.Buffet_total = 0
+	if len(billed) == 0 {
+		for _, order := range orders {
+			for _, line := range buffetLines(order, settings) {
+				invoice.Buffet_lines = append(invoice.Buffet_lines, line)
+				invoice.Buffet_total += line.Amount
+				classAmounts[""] += line.Amount
+				// Order-wide discounts apply to the per-head charges as well; they have no food, so
+				// item discounts do not
+				amount := line.Amount
+				billedItems = append(billedItems, models.OrderItem{Order_id: line.Order_id, Unit_price: &amount})
+			}
+		}
+	}
+	invoice.Subtotal = subtotal + invoice.Buffet_total
+
+	// Discounts are recalculated from their definitions, so they follow items being added or voided.
+	// Together they never take more than the subtotal.
+	invoice.Discount_total = 0
+	if len(invoice.Applied_discounts) > 0 {
+		discounts, err := appliedDiscountDefinitions(ctx, invoice.Applied_discounts)
+		if err != nil {
+			return err
+		}
+		remaining := invoice.Subtotal
+		for i, applied := range invoice.Applied_discounts {
+			var amount models.Money
+			if discount, ok := discounts[applied.Discount_id]; ok {
+				amount = discountAmount(discount, billedItems)
+				if amount > remaining {
+					amount = remaining
+				}
+			}
+			invoice.Applied_discounts[i].Amount = amount
+			invoice.Discount_total += amount
+			remaining -= amount
+		}
+	}
+	taxable := invoice.Subtotal - invoice.Discount_total
+
+	invoice.Tax_lines, invoice.Tax_total = calculateTaxLines(settings, classAmounts, invoice.Discount_total)
+	invoice.Prices_include_tax = pricesIncludeTax(settings)
+
+	invoice.Guests, err = invoicePartySize(ctx, orders)
+	if err != nil {
+		return err
+	}
+	invoice.Service_charge_lines, invoice.Service_charge = calculateServiceCharges(settings, orders, invoice.Guests, taxable)
+
+	var tip models.Money
+	if invoice.Tip != nil {
+		tip = *invoice.Tip
+	}
+
+	invoice.Grand_total = taxable + invoice.Service_charge + tip
+	if !invoice.Prices_include_tax {
+		invoice.Grand_total += invoice.Tax_total
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type VoidInvoiceRequest struct {
+	Reason string `json:"reason" validate:"required,max=250"`
+}
+
+// VoidInvoice cancels an unpaid invoice. The invoice is kept with its number and marked VOID with the
+// reason, so the numbering has no gap and the cancellation can be audited; its orders can be billed again.
+func VoidInvoice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request VoidInvoiceRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		invoiceId := c.Param("invoice_id")
+		var invoice models.Invoice
+		if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoiceId}).Decode(&invoice); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
+		if invoice.Payment_status == nil || *invoice.Payment_status != "PENDING" {
+			c.JSON(http.StatusConflict, gin.H{"error": "only unpaid invoices can be voided, paid invoices are refunded"})
+			return
+		}
+		if invoice.Parent_invoice_id != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a split invoice cannot be voided on its own"})
+			return
+		}
+		if invoice.Room_charge_posting_id != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice is being charged to a room"})
+			return
+		}
+		if invoice.Gift_card_total > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice has gift card payments"})
+			return
+		}
+
+		// Only a still unpaid invoice is voided, in case it was paid in the meantime
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		voidedBy := c.GetString("uid")
+		result, err := invoiceCollection.UpdateOne(
+			ctx,
+			bson.M{"invoice_id": invoiceId, "payment_status": "PENDING", "room_charge_posting_id": nil, "gift_card_total": invoice.Gift_card_total},
+			bson.D{{"$set", bson.D{
+				{"payment_status", "VOID"},
+				{"active_order_ids", nil},
+				{"void_reason", request.Reason},
+				{"voided_by", voidedBy},
+				{"voided_at", now},
+				{"updated_at", now},
+			}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "invoice could not be voided"})
+			return
+		}
+		if result.ModifiedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice was changed concurrently"})
+			return
+		}
+
+		// Its reservation deposits are credited on the invoice that replaces it
+		releaseDepositPayments(ctx, invoice)
+
+		// The coupons of a voided invoice were never used
+		for _, applied := range invoice.Applied_discounts {
+			discountCollection.UpdateOne(ctx, bson.M{"discount_id": applied.Discount_id, "usage_count": bson.M{"$gt": 0}}, bson.D{{"$inc", bson.D{{"usage_count", -1}}}})
+		}
+
+		var changes []orderRevision
+		for _, orderId := range invoiceOrderIds(invoice) {
+			changes = append(changes, orderRevision{orderId: orderId, action: "INVOICE_VOIDED", field: "invoice", oldValue: invoice.Invoice_number, newValue: request.Reason})
+		}
+		recordOrderRevisions(ctx, voidedBy, changes...)
+
+		status := "VOID"
+		invoice.Payment_status = &status
+		invoice.Active_order_ids = nil
+		invoice.Void_reason = &request.Reason
+		invoice.Voided_by = &voidedBy
+		invoice.Voided_at = &now
+		invoice.Updated_at = now
+		maskedJSON(c, http.StatusOK, invoice)
+	}
+}
@@ -0,0 +1,383 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var kitchenEventCollection *mongo.Collection = database.OpenCollection(database.Client, "kitchenEvent")
+
+// kitchenOpenStatuses are the statuses of the items shown on kitchen screens
+var kitchenOpenStatuses = bson.A{"QUEUED", "COOKING", "READY", nil}
+
+// kitchenGapWait is how long a stream waits for an event numbered before one it already sees: events are
+// numbered before they are saved, so another instance may still be saving it
+const kitchenGapWait = 5 * time.Second
+
+// kitchenSignal wakes the kitchen streams of this instance when it records events, or when change streams
+// see events recorded by other instances; streams also check for new events every KITCHEN_STREAM_POLL_SECONDS
+var kitchenSignal = struct {
+	sync.Mutex
+	changed chan struct{}
+}{changed: make(chan struct{})}
+
+// kitchenEventsChanged returns a channel closed the next time this instance records kitchen events
+func kitchenEventsChanged() <-chan struct{} {
+	kitchenSignal.Lock()
+	defer kitchenSignal.Unlock()
+	return kitchenSignal.changed
+}
+
+func notifyKitchenStreams() {
+	kitchenSignal.Lock()
+	defer kitchenSignal.Unlock()
+	close(kitchenSignal.changed)
+	kitchenSignal.changed = make(chan struct{})
+}
+
+// normalizeFoodStation stores stations trimmed and upper case, nil when empty
+func normalizeFoodStation(station *string) *string {
+	if station == nil {
+		return nil
+	}
+	normalized := strings.ToUpper(strings.TrimSpace(*station))
+	if normalized == "" {
+		return nil
+	}
+	return &normalized
+}
+
+// kitchenEventType is the ticket event an order history entry causes, "" for changes the kitchen does not see
+func kitchenEventType(change orderRevision) string {
+	if change.orderItemId == "" {
+		return ""
+	}
+	switch change.action {
+	case "ITEM_ADDED":
+		return "TICKET_NEW"
+	case "ITEM_UPDATED":
+		return "TICKET_UPDATED"
+	case "ITEM_RECALLED":
+		return "TICKET_RECALLED"
+	case "ITEM_VOIDED":
+		return "TICKET_VOIDED"
+	case "ITEM_REMOVED":
+		return "TICKET_REMOVED"
+	case "STATUS_CHANGED":
+		if change.newValue == "DELIVERED" {
+			return "TICKET_SERVED"
+		}
+		return "TICKET_BUMPED"
+	}
+	return ""
+}
+
+// kitchenTicketDetails loads the orders and foods of order items, to describe their tickets
+func kitchenTicketDetails(ctx context.Context, orderItems []models.OrderItem) (map[string]models.Order, map[string]models.Food, error) {
+	orderIds, foodIds := []string{}, []string{}
+	for _, orderItem := range orderItems {
+		orderIds = append(orderIds, orderItem.Order_id)
+		if orderItem.Food_id != nil {
+			foodIds = append(foodIds, *orderItem.Food_id)
+		}
+	}
+	orders, foods := map[string]models.Order{}, map[string]models.Food{}
+
+	cursor, err := orderCollection.Find(ctx, bson.M{"order_id": bson.M{"$in": orderIds}})
+	if err != nil {
+		return nil, nil, err
+	}
+	var foundOrders []models.Order
+	if err = cursor.All(ctx, &foundOrders); err != nil {
+		return nil, nil, err
+	}
+	for _, order := range foundOrders {
+		orders[order.Order_id] = order
+	}
+
+	cursor, err = foodCollection.Find(ctx, bson.M{"food_id": bson.M{"$in": foodIds}})
+	if err != nil {
+		return nil, nil, err
+	}
+	var foundFoods []models.Food
+	if err = cursor.All(ctx, &foundFoods); err != nil {
+		return nil, nil, err
+	}
+	for _, food := range foundFoods {
+		foods[food.Food_id] = food
+	}
+	return orders, foods, nil
+}
+
+// kitchenTicket describes the ticket of an order item as a kitchen event
+func kitchenTicket(orderItem models.OrderItem, orders map[string]models.Order, foods map[string]models.Food) models.KitchenEvent {
+	order := orders[orderItem.Order_id]
+	ticket := models.KitchenEvent{
+		Order_item_id: orderItem.Order_item_id,
+		Order_id:      orderItem.Order_id,
+		Order_number:  order.Order_number,
+		Table_id:      order.Table_id,
+		Location_id:   order.Location_id,
+		Food_id:       orderItem.Food_id,
+		Quantity:      orderItem.Quantity,
+		Options:       orderItem.Options,
+		Status:        orderItemStatus(orderItem),
+		Created_at:    orderItem.Created_at,
+	}
+	if orderItem.Food_id != nil {
+		food := foods[*orderItem.Food_id]
+		ticket.Food_name = foodName(food)
+		ticket.Station = food.Station
+	}
+	return ticket
+}
+
+// recordKitchenEvents turns the order history entries of items into numbered kitchen events and wakes the
+// kitchen streams. Like the history, events are best effort: a failure is logged and the change stands.
+func recordKitchenEvents(ctx context.Context, changedBy string, createdAt time.Time, changes []orderRevision) {
+	orderItemIds := []string{}
+	for _, change := range changes {
+		if kitchenEventType(change) != "" {
+			orderItemIds = append(orderItemIds, change.orderItemId)
+		}
+	}
+	if len(orderItemIds) == 0 {
+		return
+	}
+
+	cursor, err := orderItemCollection.Find(ctx, bson.M{"order_item_id": bson.M{"$in": orderItemIds}})
+	if err != nil {
+		log.Println("failed to record kitchen events:", err)
+		return
+	}
+	var orderItems []models.OrderItem
+	if err = cursor.All(ctx, &orderItems); err != nil {
+		log.Println("failed to record kitchen events:", err)
+		return
+	}
+	// Removed items are gone, their history entry keeps what they were
+	for _, change := range changes {
+		if removed, ok := change.oldValue.(models.OrderItem); ok && change.action == "ITEM_REMOVED" {
+			orderItems = append(orderItems, removed)
+		}
+	}
+	byId := map[string]models.OrderItem{}
+	for _, orderItem := range orderItems {
+		byId[orderItem.Order_item_id] = orderItem
+	}
+	orders, foods, err := kitchenTicketDetails(ctx, orderItems)
+	if err != nil {
+		log.Println("failed to record kitchen events:", err)
+		return
+	}
+
+	// A change to several fields of an item is a single update of its ticket
+	seen := map[string]bool{}
+	documents := []interface{}{}
+	for _, change := range changes {
+		eventType := kitchenEventType(change)
+		orderItem, ok := byId[change.orderItemId]
+		if eventType == "" || !ok || seen[eventType+change.orderItemId] {
+			continue
+		}
+		seen[eventType+change.orderItemId] = true
+
+		sequence, err := nextCounter(ctx, "kitchen_event")
+		if err != nil {
+			log.Println("failed to record kitchen events:", err)
+			return
+		}
+		event := kitchenTicket(orderItem, orders, foods)
+		event.ID = primitive.NewObjectID()
+		event.Sequence = sequence
+		event.Type = eventType
+		event.Changed_by = changedBy
+		event.Created_at = createdAt
+		documents = append(documents, event)
+	}
+	if len(documents) == 0 {
+		return
+	}
+	if _, err := kitchenEventCollection.InsertMany(ctx, documents); err != nil {
+		log.Println("failed to record kitchen events:", err)
+		return
+	}
+	notifyKitchenStreams()
+}
+
+// kitchenTicketFilter reports whether a ticket belongs on a screen: tickets of foods without a station
+// are shown on every station
+func kitchenTicketFilter(station string, locationId string) func(ticket models.KitchenEvent) bool {
+	return func(ticket models.KitchenEvent) bool {
+		if station != "" && ticket.Station != nil && *ticket.Station != station {
+			return false
+		}
+		if locationId != "" && (ticket.Location_id == nil || *ticket.Location_id != locationId) {
+			return false
+		}
+		return true
+	}
+}
+
+// openKitchenTickets lists the tickets of the items still being prepared or waiting to be served, oldest
+// first, leaving out the items of closed orders
+func openKitchenTickets(ctx context.Context, wanted func(ticket models.KitchenEvent) bool) ([]models.KitchenEvent, error) {
+	var openOrders []models.Order
+	cursor, err := orderCollection.Find(ctx, bson.M{"closed_at": nil, "created_at": bson.M{"$gte": time.Now().AddDate(0, 0, -1)}})
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &openOrders); err != nil {
+		return nil, err
+	}
+	orderIds := []string{}
+	for _, order := range openOrders {
+		orderIds = append(orderIds, order.Order_id)
+	}
+
+	opts := options.Find().SetSort(bson.D{{"created_at", 1}, {"_id", 1}})
+	cursor, err = orderItemCollection.Find(ctx, bson.M{"order_id": bson.M{"$in": orderIds}, "status": bson.M{"$in": kitchenOpenStatuses}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var orderItems []models.OrderItem
+	if err = cursor.All(ctx, &orderItems); err != nil {
+		return nil, err
+	}
+	orders, foods, err := kitchenTicketDetails(ctx, orderItems)
+	if err != nil {
+		return nil, err
+	}
+	tickets := []models.KitchenEvent{}
+	for _, orderItem := range orderItems {
+		if ticket := kitchenTicket(orderItem, orders, foods); wanted(ticket) {
+			ticket.Type = "TICKET_OPEN"
+			tickets = append(tickets, ticket)
+		}
+	}
+	return tickets, nil
+}
+
+// writeKitchenEvent writes a server-sent event with its id, so browsers send it back as Last-Event-ID
+// when they reconnect
+func writeKitchenEvent(w io.Writer, id int64, name string, data interface{}) {
+	encoded, _ := json.Marshal(data)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, name, encoded)
+}
+
+// StreamKitchen streams the kitchen tickets of a station (station, all stations when omitted; optional
+// location_id) as server-sent events, for browser kitchen displays that cannot use WebSockets. A new
+// screen first gets a "snapshot" event with the open tickets, then a "ticket" event for every new ticket,
+// bump, recall, update, serve, void or removal. Every event has an id; a screen reconnecting with the
+// Last-Event-ID header (or the last_event_id query parameter) gets the events it missed, or a new snapshot
+// when they are no longer kept (KITCHEN_EVENT_RETENTION_HOURS).
+func StreamKitchen() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		station := strings.ToUpper(strings.TrimSpace(c.Query("station")))
+		wanted := kitchenTicketFilter(station, c.Query("location_id"))
+		poll := time.Duration(envInt("KITCHEN_STREAM_POLL_SECONDS", 2)) * time.Second
+
+		lastEventId := c.GetHeader("Last-Event-ID")
+		if lastEventId == "" {
+			lastEventId = c.Query("last_event_id")
+		}
+		last, err := strconv.ParseInt(lastEventId, 10, 64)
+		resume := err == nil && last >= 0
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+
+		ticker := time.NewTicker(poll)
+		defer ticker.Stop()
+
+		snapshot := !resume
+		first := true
+		idle := time.Now()
+
+		c.Stream(func(w io.Writer) bool {
+			if !first {
+				select {
+				case <-c.Request.Context().Done():
+					return false
+				case <-ticker.C:
+				case <-kitchenEventsChanged():
+				}
+			}
+			first = false
+
+			var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			// Events missed while away may have expired; the screen then starts over from a snapshot
+			if resume {
+				resume = false
+				var oldest models.KitchenEvent
+				err := kitchenEventCollection.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.D{{"sequence", 1}})).Decode(&oldest)
+				if err == nil && oldest.Sequence > last+1 {
+					snapshot = true
+				}
+			}
+			if snapshot {
+				current, err := currentCounter(ctx, "kitchen_event")
+				if err != nil {
+					c.SSEvent("error", gin.H{"error": "kitchen tickets are temporarily unavailable"})
+					return true
+				}
+				tickets, err := openKitchenTickets(ctx, wanted)
+				if err != nil {
+					c.SSEvent("error", gin.H{"error": "kitchen tickets are temporarily unavailable"})
+					return true
+				}
+				snapshot = false
+				last = current
+				writeKitchenEvent(w, last, "snapshot", gin.H{"tickets": tickets})
+				idle = time.Now()
+				return true
+			}
+
+			opts := options.Find().SetSort(bson.D{{"sequence", 1}}).SetLimit(500)
+			cursor, err := kitchenEventCollection.Find(ctx, bson.M{"sequence": bson.M{"$gt": last}}, opts)
+			if err != nil {
+				return true
+			}
+			var events []models.KitchenEvent
+			if err = cursor.All(ctx, &events); err != nil {
+				return true
+			}
+			for _, event := range events {
+				if event.Sequence != last+1 && time.Since(event.Created_at) < kitchenGapWait {
+					break
+				}
+				last = event.Sequence
+				if wanted(event) {
+					writeKitchenEvent(w, event.Sequence, "ticket", event)
+					idle = time.Now()
+				}
+			}
+
+			// Keep idle connections open through proxies with a comment line about every 30 seconds
+			if time.Since(idle) >= 30*time.Second {
+				idle = time.Now()
+				io.WriteString(w, ": keep-alive\n\n")
+			}
+			return true
+		})
+	}
+}
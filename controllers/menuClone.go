@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MenuCloneRequest struct {
+	// Name is the new menu's name; by default the original's name with " (copy)"
+	Name *string `json:"name" validate:"omitempty,min=1,max=100"`
+
+	// Include_foods copies the menu's foods too (default true)
+	Include_foods *bool `json:"include_foods"`
+
+	// Start_Date and End_Date are the new menu's dates; the original's dates are not copied
+	Start_Date *time.Time `json:"start_date"`
+	End_Date   *time.Time `json:"end_date"`
+}
+
+// CloneMenu copies a menu, and by default its foods, into a new unpublished menu, e.g. to start this
+// season's menu from last year's. Copies get new ids, the original's dates are cleared and foods keep
+// their order, prices and images but not their SKU, which must stay unique. Archived foods are not copied.
+func CloneMenu() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request MenuCloneRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.BindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if request.Start_Date != nil && request.End_Date != nil && !request.Start_Date.Before(*request.End_Date) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start_date must be before end_date"})
+			return
+		}
+
+		var menu models.Menu
+		if err := menuCollection.FindOne(ctx, bson.M{"menu_id": c.Param("menu_id")}).Decode(&menu); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu was not found"})
+			return
+		}
+		originalId := menu.Menu_id
+
+		version, err := nextMenuVersion(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu could not be cloned"})
+			return
+		}
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var foods []interface{}
+		if request.Include_foods == nil || *request.Include_foods {
+			cursor, err := foodCollection.Find(ctx, bson.D{{"menu_id", originalId}, notArchived})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the menu's foods"})
+				return
+			}
+			var originals []models.Food
+			if err = cursor.All(ctx, &originals); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the menu's foods"})
+				return
+			}
+			for _, food := range originals {
+				food.ID = primitive.NewObjectID()
+				food.Food_id = food.ID.Hex()
+				food.Sku = nil
+				food.Scheduled_price = nil
+				food.Created_at = now
+				food.Updated_at = now
+				food.Version = version
+				foods = append(foods, food)
+			}
+		}
+
+		menu.ID = primitive.NewObjectID()
+		menu.Menu_id = menu.ID.Hex()
+		if request.Name != nil {
+			menu.Name = *request.Name
+		} else {
+			menu.Name = menu.Name + " (copy)"
+		}
+		menu.Start_Date = request.Start_Date
+		menu.End_Date = request.End_Date
+		menu.Status = "DRAFT"
+		menu.Published_at = nil
+		menu.Published_number = 0
+		menu.Has_draft = false
+		menu.Deleted_at = nil
+		menu.Created_at = now
+		menu.Updated_at = now
+		menu.Version = version
+
+		if _, err := menuCollection.InsertOne(ctx, menu); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu could not be cloned"})
+			return
+		}
+		for i := range foods {
+			food := foods[i].(models.Food)
+			food.Menu_id = &menu.Menu_id
+			foods[i] = food
+		}
+		if len(foods) > 0 {
+			// A partial copy is removed, so the clone can simply be retried
+			if _, err := foodCollection.InsertMany(ctx, foods); err != nil {
+				foodCollection.DeleteMany(ctx, bson.M{"menu_id": menu.Menu_id})
+				menuCollection.DeleteOne(ctx, bson.M{"menu_id": menu.Menu_id})
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "menu could not be cloned"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"menu_id": menu.Menu_id, "cloned_from": originalId, "name": menu.Name, "foods": len(foods)})
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"golang-restaurant-management/models"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -18,17 +20,47 @@ import (
 
 var menuCollection *mongo.Collection = database.OpenCollection(database.Client, "menu")
 
+// GetMenus lists the menus; with active=true only the menus served right now, within their
+// Start_Date and End_Date and one of their dayparts
 func GetMenus() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-		result, err := menuCollection.Find(context.TODO(), bson.M{})
+		active := c.Query("active") == "true"
+		now := time.Now()
+		filter := bson.M{}
+		if active {
+			filter = availableMenuFilter(now)
+		}
+		if !includeArchived(c) {
+			filter["deleted_at"] = nil
+		}
+		result, err := menuCollection.Find(context.TODO(), filter)
 		defer cancel()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the menu items"})
+			return
 		}
-		var allMenus []bson.M
-		if err = result.All(ctx, &allMenus); err != nil {
-			log.Fatal(err)
+		accepted, base, err := requestLanguages(ctx, c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the menu items"})
+			return
+		}
+		allMenus := []bson.M{}
+		for result.Next(ctx) {
+			var menu models.Menu
+			var document bson.M
+			if err = result.Decode(&menu); err != nil {
+				log.Fatal(err)
+			}
+			if active && !menuServedAt(menu, now) {
+				continue
+			}
+			if err = result.Decode(&document); err != nil {
+				log.Fatal(err)
+			}
+			localizeMenu(&menu, accepted, base)
+			document["name"], document["category"] = menu.Name, menu.Category
+			allMenus = append(allMenus, document)
 		}
 		c.JSON(http.StatusOK, allMenus)
 	}
@@ -40,15 +72,67 @@ func GetMenu() gin.HandlerFunc {
 		menuId := c.Param("menu_id")
 		var menu models.Menu
 
-		err := foodCollection.FindOne(ctx, bson.M{"menu_id": menuId}).Decode(&menu)
+		err := menuCollection.FindOne(ctx, bson.M{"menu_id": menuId}).Decode(&menu)
 		defer cancel()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the menu"})
+			return
+		}
+		accepted, base, err := requestLanguages(ctx, c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the menu"})
+			return
 		}
+		localizeMenu(&menu, accepted, base)
 		c.JSON(http.StatusOK, menu)
 	}
 }
 
+// GetMenuFoods lists a menu's foods in display order; archived foods only with include_archived=true
+func GetMenuFoods() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		menuId := c.Param("menu_id")
+		count, err := menuCollection.CountDocuments(ctx, bson.M{"menu_id": menuId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the menu"})
+			return
+		}
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu was not found"})
+			return
+		}
+
+		filter := bson.D{{"menu_id", menuId}}
+		if !includeArchived(c) {
+			filter = append(filter, notArchived)
+		}
+		cursor, err := foodCollection.Find(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing food items"})
+			return
+		}
+		foods := []models.Food{}
+		if err = cursor.All(ctx, &foods); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing food items"})
+			return
+		}
+		sortFoodsByPosition(foods)
+
+		accepted, base, err := requestLanguages(ctx, c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing food items"})
+			return
+		}
+		for i := range foods {
+			localizeFood(&foods[i], accepted, base)
+		}
+		c.JSON(http.StatusOK, foods)
+	}
+}
+
 func CreateMenu() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var menu models.Menu
@@ -64,11 +148,25 @@ func CreateMenu() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
 			return
 		}
+		if err := validateMenuTranslations(menu.Translations); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
 		menu.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		menu.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		menu.ID = primitive.NewObjectID()
 		menu.Menu_id = menu.ID.Hex()
+		menu.Status = "DRAFT"
+		menu.Published_number = 0
+		menu.Has_draft = false
+
+		var err error
+		menu.Version, err = nextMenuVersion(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Menu item was not created"})
+			return
+		}
 
 		result, insertErr := menuCollection.InsertOne(ctx, menu)
 		if insertErr != nil {
@@ -97,7 +195,7 @@ func UpdateMenu() gin.HandlerFunc {
 		}
 
 		menuId := c.Param("menu_id")
-		filter := bson.M{"manuu_id": menuId}
+		filter := bson.M{"menu_id": menuId}
 
 		var updateObj primitive.D
 
@@ -111,39 +209,317 @@ func UpdateMenu() gin.HandlerFunc {
 
 			updateObj = append(updateObj, bson.E{"start_date", menu.Start_Date})
 			updateObj = append(updateObj, bson.E{"end_date", menu.End_Date})
+		}
 
-			if menu.Name != "" {
-				updateObj = append(updateObj, bson.E{"name", menu.Name})
+		if menu.Name != "" {
+			updateObj = append(updateObj, bson.E{"name", menu.Name})
+		}
+		if menu.Category != "" {
+			updateObj = append(updateObj, bson.E{"category", menu.Category})
+		}
+
+		// An empty list of dayparts serves the menu all day again
+		if menu.Dayparts != nil {
+			if validationErr := validateDayparts(menu.Dayparts); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+				defer cancel()
+				return
 			}
-			if menu.Category != "" {
-				updateObj = append(updateObj, bson.E{"name", menu.Category})
+			updateObj = append(updateObj, bson.E{"dayparts", menu.Dayparts})
+		}
+
+		// An empty map of translations removes them all
+		if menu.Translations != nil {
+			if err := validateMenuTranslations(menu.Translations); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				defer cancel()
+				return
 			}
+			updateObj = append(updateObj, bson.E{"translations", menu.Translations})
+		}
 
-			menu.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-			updateObj = append(updateObj, bson.E{"updated_at", menu.Updated_at})
+		if len(updateObj) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+			defer cancel()
+			return
+		}
+
+		version, err := nextMenuVersion(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Menu update failed"})
+			defer cancel()
+			return
+		}
+		updateObj = append(updateObj, bson.E{"version", version})
+
+		menu.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{"updated_at", menu.Updated_at})
+
+		// Updating a menu that does not exist must not create a partial menu
+		upsert := false
+
+		opt := options.UpdateOptions{
+			Upsert: &upsert,
+		}
+
+		result, err := menuCollection.UpdateOne(
+			ctx,
+			filter,
+			bson.D{
+				{"$set", updateObj},
+			},
+			&opt,
+		)
+
+		if err != nil {
+			msg := "Menu update failed"
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			defer cancel()
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu was not found"})
+			defer cancel()
+			return
+		}
+
+		defer cancel()
+		c.JSON(http.StatusOK, result)
+	}
+}
 
-			upsert := true
+// menuVersionCounter is the counter bumped on every food or menu write
+const menuVersionCounter = "menu_version"
 
-			opt := options.UpdateOptions{
-				Upsert: &upsert,
+// menuVersionSettle is how long a write has to save its document after taking its menu version. Versions
+// are taken before documents are saved, so a snapshot only reports versions taken at least this long ago.
+const menuVersionSettle = 10 * time.Second
+
+// nextMenuVersion returns a new, strictly increasing menu version for a food or menu write. When the last
+// 1000 versions were taken is kept on the counter, for snapshots to tell which ones have settled.
+func nextMenuVersion(ctx context.Context) (int64, error) {
+	var result counter
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := counterCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": menuVersionCounter},
+		mongo.Pipeline{
+			{{"$set", bson.D{{"value", bson.D{{"$add", bson.A{bson.D{{"$ifNull", bson.A{"$value", 0}}}, 1}}}}}}},
+			{{"$set", bson.D{{"taken", bson.D{{"$slice", bson.A{
+				bson.D{{"$concatArrays", bson.A{bson.D{{"$ifNull", bson.A{"$taken", bson.A{}}}}, bson.A{bson.D{{"version", "$value"}, {"at", time.Now()}}}}}},
+				-1000,
+			}}}}}}},
+		},
+		opts,
+	).Decode(&result)
+	return result.Value, err
+}
+
+// settledMenuVersion returns the latest menu version up to which every write has had menuVersionSettle
+// to save its document: the version before the oldest one taken more recently
+func settledMenuVersion(ctx context.Context) (int64, error) {
+	var versions struct {
+		Value int64 `bson:"value"`
+		Taken []struct {
+			Version int64     `bson:"version"`
+			At      time.Time `bson:"at"`
+		} `bson:"taken"`
+	}
+	err := counterCollection.FindOne(ctx, bson.M{"_id": menuVersionCounter}).Decode(&versions)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-menuVersionSettle)
+	for _, taken := range versions.Taken {
+		if taken.At.After(cutoff) {
+			return taken.Version - 1, nil
+		}
+	}
+	return versions.Value, nil
+}
+
+type MenuSnapshot struct {
+	Version       int64         `json:"version"`
+	Since_version int64         `json:"since_version"`
+	Full          bool          `json:"full"`
+	Menus         []bson.M      `json:"menus"`
+	Foods         []models.Food `json:"foods"`
+}
+
+// GetMenuSnapshot returns the menus and foods that changed after the client's cached
+// since_version, together with the current version to send next time.
+// Without since_version (or when it is ahead of the server) the full menu is returned.
+func GetMenuSnapshot() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var sinceVersion int64
+		if value := c.Query("since_version"); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "since_version must be a non-negative number"})
+				return
 			}
+			sinceVersion = parsed
+		}
+
+		// Only versions whose writes have settled are reported: a document with a later version, still
+		// being saved, is then sent on the next sync rather than missed. Documents already saved with a
+		// later version are sent now and again next time.
+		version, err := settledMenuVersion(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the menu version"})
+			return
+		}
+		if sinceVersion > version {
+			sinceVersion = 0
+		}
+
+		snapshot := MenuSnapshot{Version: version, Since_version: sinceVersion, Full: sinceVersion == 0}
+		filter := bson.M{}
+		if !snapshot.Full {
+			filter = bson.M{"version": bson.M{"$gt": sinceVersion}}
+		}
+		projection := options.Find().SetProjection(bson.M{"_id": 0})
+
+		menus, err := menuCollection.Find(ctx, filter, projection)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the menu items"})
+			return
+		}
+		snapshot.Menus = []bson.M{}
+		if err = menus.All(ctx, &snapshot.Menus); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the menu items"})
+			return
+		}
+
+		foods, err := foodCollection.Find(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing food items"})
+			return
+		}
+		snapshot.Foods = []models.Food{}
+		if err = foods.All(ctx, &snapshot.Foods); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing food items"})
+			return
+		}
+
+		c.JSON(http.StatusOK, snapshot)
+	}
+}
+
+type MenuPublishWarning struct {
+	Food_id string `json:"food_id"`
+	Name    string `json:"name"`
+	Warning string `json:"warning"`
+}
+
+// PublishMenu makes a menu visible on the public menu. The pending changes of the menu's draft are
+// applied first, and a snapshot of the menu and its foods is kept as a new version. Publishing is not
+// blocked by missing accessibility data, but foods whose image has no alt text are returned as warnings.
+func PublishMenu() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		menuId := c.Param("menu_id")
+
+		var menu models.Menu
+		if err := menuCollection.FindOne(ctx, bson.M{"menu_id": menuId}).Decode(&menu); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu was not found"})
+			return
+		}
+		if menu.Deleted_at != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "menu is archived"})
+			return
+		}
+
+		version, err := nextMenuVersion(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Menu update failed"})
+			return
+		}
+		publishedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 
-			result, err := menuCollection.UpdateOne(
-				ctx,
-				filter,
-				bson.D{
-					{"$set", updateObj},
-				},
-				&opt,
+		draft, hasDraft, err := findMenuDraft(ctx, menuId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the menu draft"})
+			return
+		}
+		update := bson.D{{"published_at", publishedAt}, {"status", "PUBLISHED"}, {"has_draft", false}, {"version", version}, {"updated_at", publishedAt}}
+		if hasDraft {
+			if err := applyMenuDraftFoods(ctx, draft, version, publishedAt, c.GetString("uid")); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "the menu draft could not be published, please retry"})
+				return
+			}
+			update = append(update,
+				bson.E{"name", draft.Menu.Name},
+				bson.E{"category", draft.Menu.Category},
+				bson.E{"start_date", draft.Menu.Start_Date},
+				bson.E{"end_date", draft.Menu.End_Date},
+				bson.E{"dayparts", draft.Menu.Dayparts},
 			)
+		}
 
-			if err != nil {
-				msg := "Menu update failed"
-				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		err = menuCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"menu_id": menuId},
+			bson.D{{"$set", update}, {"$inc", bson.D{{"published_number", 1}}}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&menu)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Menu update failed"})
+			return
+		}
+		if hasDraft {
+			// A draft changed while it was being published is kept, with the changes made since
+			result, err := menuDraftCollection.DeleteOne(ctx, bson.M{"menu_id": menuId, "updated_at": draft.Updated_at})
+			if err == nil && result.DeletedCount == 0 {
+				menuCollection.UpdateOne(ctx, bson.M{"menu_id": menuId}, bson.D{{"$set", bson.D{{"has_draft", true}}}})
 			}
+		}
 
-			defer cancel()
-			c.JSON(http.StatusOK, result)
+		if err := saveMenuVersion(ctx, menu, c.GetString("uid")); err != nil {
+			log.Println("failed to save version", menu.Published_number, "of menu", menuId, ":", err)
+		}
+
+		warnings, err := menuAccessibilityWarnings(ctx, menuId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the menu"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"menu_id": menuId, "published_at": publishedAt, "published_number": menu.Published_number, "warnings": warnings})
+	}
+}
+
+// menuAccessibilityWarnings lists the foods of a menu that are missing accessibility data
+func menuAccessibilityWarnings(ctx context.Context, menuId string) ([]MenuPublishWarning, error) {
+	warnings := []MenuPublishWarning{}
+
+	cursor, err := foodCollection.Find(ctx, bson.D{{"menu_id", menuId}, notArchived})
+	if err != nil {
+		return warnings, err
+	}
+	var foods []models.Food
+	if err = cursor.All(ctx, &foods); err != nil {
+		return warnings, err
+	}
+
+	for _, food := range foods {
+		name := ""
+		if food.Name != nil {
+			name = *food.Name
+		}
+		if food.Food_image != nil && *food.Food_image != "" && (food.Image_alt_text == nil || strings.TrimSpace(*food.Image_alt_text) == "") {
+			warnings = append(warnings, MenuPublishWarning{Food_id: food.Food_id, Name: name, Warning: "image has no alt text"})
+		}
+		if food.Description == nil || food.Description.Summary == nil {
+			warnings = append(warnings, MenuPublishWarning{Food_id: food.Food_id, Name: name, Warning: "food has no description"})
 		}
 	}
+	return warnings, nil
 }
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"golang-restaurant-management/models"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// availableMenuFilter matches the menus whose Start_Date and End_Date include the moment
+func availableMenuFilter(at time.Time) bson.M {
+	return bson.M{
+		"$and": bson.A{
+			bson.M{"$or": bson.A{bson.M{"start_date": nil}, bson.M{"start_date": bson.M{"$lte": at}}}},
+			bson.M{"$or": bson.A{bson.M{"end_date": nil}, bson.M{"end_date": bson.M{"$gt": at}}}},
+		},
+	}
+}
+
+// validateDayparts validates the dayparts of a menu update. Partial validation of a menu does not
+// descend into its dayparts, so each one is validated on its own.
+func validateDayparts(dayparts []models.MenuDaypart) error {
+	if err := validate.Var(dayparts, "max=10"); err != nil {
+		return err
+	}
+	for _, daypart := range dayparts {
+		if err := validate.Struct(daypart); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// minutesOfDay parses an HH:MM time into minutes after midnight
+func minutesOfDay(value string) int {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return -1
+	}
+	return parsed.Hour()*60 + parsed.Minute()
+}
+
+// daypartCovers reports whether a daypart is open at a moment. A window running past midnight
+// belongs to the day it opens on, so its early morning part is checked against the previous day.
+func daypartCovers(daypart models.MenuDaypart, at time.Time) bool {
+	start, end := minutesOfDay(daypart.Start), minutesOfDay(daypart.End)
+	if start < 0 || end < 0 {
+		return false
+	}
+	minute := at.Hour()*60 + at.Minute()
+
+	day := at
+	if start < end {
+		if minute < start || minute >= end {
+			return false
+		}
+	} else if minute < end {
+		day = at.AddDate(0, 0, -1)
+	} else if minute < start {
+		return false
+	}
+
+	if len(daypart.Days) == 0 {
+		return true
+	}
+	weekday := strings.ToUpper(day.Weekday().String()[:3])
+	for _, d := range daypart.Days {
+		if d == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// menuServedAt reports whether a menu is served at a moment: within its Start_Date and End_Date and,
+// when it has dayparts, within one of them
+func menuServedAt(menu models.Menu, at time.Time) bool {
+	if menu.Start_Date != nil && menu.Start_Date.After(at) {
+		return false
+	}
+	if menu.End_Date != nil && !menu.End_Date.After(at) {
+		return false
+	}
+	if len(menu.Dayparts) == 0 {
+		return true
+	}
+	for _, daypart := range menu.Dayparts {
+		if daypartCovers(daypart, at) {
+			return true
+		}
+	}
+	return false
+}
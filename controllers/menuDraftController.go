@@ -0,0 +1,410 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var menuDraftCollection *mongo.Collection = database.OpenCollection(database.Client, "menuDraft")
+
+var menuVersionCollection *mongo.Collection = database.OpenCollection(database.Client, "menuVersion")
+
+// findMenuDraft returns the draft of a menu, if it has one
+func findMenuDraft(ctx context.Context, menuId string) (models.MenuDraft, bool, error) {
+	var draft models.MenuDraft
+	err := menuDraftCollection.FindOne(ctx, bson.M{"menu_id": menuId}).Decode(&draft)
+	if err == mongo.ErrNoDocuments {
+		return draft, false, nil
+	}
+	return draft, err == nil, err
+}
+
+// saveMenuDraft stores a changed draft, unless it was changed by someone else since it was loaded
+func saveMenuDraft(ctx context.Context, draft *models.MenuDraft, set bson.D) (bool, error) {
+	updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	if !updatedAt.After(draft.Updated_at) {
+		updatedAt = draft.Updated_at.Add(time.Second)
+	}
+	result, err := menuDraftCollection.UpdateOne(
+		ctx,
+		bson.M{"menu_id": draft.Menu_id, "updated_at": draft.Updated_at},
+		bson.D{{"$set", append(set, bson.E{"updated_at", updatedAt})}},
+	)
+	if err != nil {
+		return false, err
+	}
+	draft.Updated_at = updatedAt
+	return result.MatchedCount > 0, nil
+}
+
+// CreateMenuDraft starts a draft of a menu, from its live name, category, dates and dayparts
+func CreateMenuDraft() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		menuId := c.Param("menu_id")
+		var menu models.Menu
+		if err := menuCollection.FindOne(ctx, bson.M{"menu_id": menuId}).Decode(&menu); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu was not found"})
+			return
+		}
+		if menu.Deleted_at != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "menu is archived"})
+			return
+		}
+
+		var draft models.MenuDraft
+		draft.ID = primitive.NewObjectID()
+		draft.Menu_id = menuId
+		draft.Menu = menu
+		draft.Foods = []models.Food{}
+		draft.Created_by = c.GetString("uid")
+		draft.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		draft.Updated_at = draft.Created_at
+
+		_, insertErr := menuDraftCollection.InsertOne(ctx, draft)
+		if mongo.IsDuplicateKeyError(insertErr) {
+			c.JSON(http.StatusConflict, gin.H{"error": "menu already has a draft"})
+			return
+		}
+		if insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu draft was not created"})
+			return
+		}
+		menuCollection.UpdateOne(ctx, bson.M{"menu_id": menuId}, bson.D{{"$set", bson.D{{"has_draft", true}}}})
+		c.JSON(http.StatusOK, draft)
+	}
+}
+
+func GetMenuDraft() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		draft, found, err := findMenuDraft(ctx, c.Param("menu_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the menu draft"})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu has no draft"})
+			return
+		}
+		c.JSON(http.StatusOK, draft)
+	}
+}
+
+// UpdateMenuDraft changes the name, category, dates or dayparts the menu will have once published
+func UpdateMenuDraft() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var menu models.Menu
+		if err := c.BindJSON(&menu); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		draft, found, err := findMenuDraft(ctx, c.Param("menu_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the menu draft"})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu has no draft"})
+			return
+		}
+
+		if menu.Name != "" {
+			draft.Menu.Name = menu.Name
+		}
+		if menu.Category != "" {
+			draft.Menu.Category = menu.Category
+		}
+		if menu.Start_Date != nil {
+			draft.Menu.Start_Date = menu.Start_Date
+		}
+		if menu.End_Date != nil {
+			draft.Menu.End_Date = menu.End_Date
+		}
+		if menu.Dayparts != nil {
+			draft.Menu.Dayparts = menu.Dayparts
+		}
+		if validationErr := validate.StructPartial(draft.Menu, "Name", "Category"); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if validationErr := validateDayparts(draft.Menu.Dayparts); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if draft.Menu.Start_Date != nil && draft.Menu.End_Date != nil && !draft.Menu.End_Date.After(*draft.Menu.Start_Date) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end_date must be after start_date"})
+			return
+		}
+
+		saved, err := saveMenuDraft(ctx, &draft, bson.D{{"menu", draft.Menu}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu draft update failed"})
+			return
+		}
+		if !saved {
+			c.JSON(http.StatusConflict, gin.H{"error": "menu draft was changed concurrently, please retry"})
+			return
+		}
+		c.JSON(http.StatusOK, draft)
+	}
+}
+
+// SaveMenuDraftFood adds a new food to a menu's draft (POST) or sets how one of its foods will be
+// once published (PUT). The complete food is sent and validated as on creation.
+func SaveMenuDraftFood() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		menuId := c.Param("menu_id")
+		foodId := c.Param("food_id")
+
+		var food models.Food
+		if err := c.BindJSON(&food); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		food.Menu_id = &menuId
+		if err := checkNewFood(ctx, &food); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		draft, found, err := findMenuDraft(ctx, menuId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the menu draft"})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu has no draft"})
+			return
+		}
+
+		index := -1
+		if foodId == "" {
+			// New foods get their id now, they are created when the draft is published
+			food.ID = primitive.NewObjectID()
+			food.Food_id = food.ID.Hex()
+			food.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		} else {
+			for i, draftFood := range draft.Foods {
+				if draftFood.Food_id == foodId {
+					index = i
+					food.ID = draftFood.ID
+					food.Created_at = draftFood.Created_at
+				}
+			}
+			if index < 0 {
+				var liveFood models.Food
+				if err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId, "menu_id": menuId}).Decode(&liveFood); err != nil {
+					c.JSON(http.StatusNotFound, gin.H{"error": "food was not found on this menu"})
+					return
+				}
+				food.ID = liveFood.ID
+				food.Created_at = liveFood.Created_at
+			}
+			food.Food_id = foodId
+		}
+		food.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		if index < 0 {
+			draft.Foods = append(draft.Foods, food)
+		} else {
+			draft.Foods[index] = food
+		}
+
+		saved, err := saveMenuDraft(ctx, &draft, bson.D{{"foods", draft.Foods}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu draft update failed"})
+			return
+		}
+		if !saved {
+			c.JSON(http.StatusConflict, gin.H{"error": "menu draft was changed concurrently, please retry"})
+			return
+		}
+		c.JSON(http.StatusOK, draft)
+	}
+}
+
+// RemoveMenuDraftFood drops a food's pending change from the draft: a changed food stays as it is
+// live, and a new food is not created
+func RemoveMenuDraftFood() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		draft, found, err := findMenuDraft(ctx, c.Param("menu_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the menu draft"})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu has no draft"})
+			return
+		}
+
+		foods := []models.Food{}
+		for _, food := range draft.Foods {
+			if food.Food_id != c.Param("food_id") {
+				foods = append(foods, food)
+			}
+		}
+		if len(foods) == len(draft.Foods) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food has no change in the draft"})
+			return
+		}
+		draft.Foods = foods
+
+		saved, err := saveMenuDraft(ctx, &draft, bson.D{{"foods", draft.Foods}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu draft update failed"})
+			return
+		}
+		if !saved {
+			c.JSON(http.StatusConflict, gin.H{"error": "menu draft was changed concurrently, please retry"})
+			return
+		}
+		c.JSON(http.StatusOK, draft)
+	}
+}
+
+// DiscardMenuDraft throws away a menu's draft; the live menu is not changed
+func DiscardMenuDraft() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		menuId := c.Param("menu_id")
+		result, err := menuDraftCollection.DeleteOne(ctx, bson.M{"menu_id": menuId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu draft could not be discarded"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu has no draft"})
+			return
+		}
+		menuCollection.UpdateOne(ctx, bson.M{"menu_id": menuId}, bson.D{{"$set", bson.D{{"has_draft", false}}}})
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// applyMenuDraftFoods writes the draft's foods to the live menu: changed foods are replaced and new
+// foods are created. Publishing again after a failure is safe, foods already created are skipped.
+// Price changes are recorded in the price history as made by the staff member publishing.
+func applyMenuDraftFoods(ctx context.Context, draft models.MenuDraft, version int64, publishedAt time.Time, publishedBy string) error {
+	for _, food := range draft.Foods {
+		food.Version = version
+		food.Updated_at = publishedAt
+
+		// Foods archived since they were drafted stay archived
+		filter := bson.D{{"food_id", food.Food_id}, notArchived}
+		var liveFood models.Food
+		err := foodCollection.FindOne(ctx, filter).Decode(&liveFood)
+		if err == nil {
+			// Prices are scheduled on the live food, not in drafts
+			food.Scheduled_price = liveFood.Scheduled_price
+			result, err := foodCollection.ReplaceOne(ctx, filter, food)
+			if err != nil {
+				return err
+			}
+			if result.MatchedCount > 0 {
+				recordFoodPriceChanges(ctx, "DRAFT_PUBLISHED", publishedBy, foodPriceChanges(liveFood, food))
+				continue
+			}
+		} else if err != mongo.ErrNoDocuments {
+			return err
+		}
+		food.Created_at = publishedAt
+		if _, err := foodCollection.InsertOne(ctx, food); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveMenuVersion keeps a snapshot of a menu as just published, with all its foods
+func saveMenuVersion(ctx context.Context, menu models.Menu, publishedBy string) error {
+	cursor, err := foodCollection.Find(ctx, bson.D{{"menu_id", menu.Menu_id}, notArchived})
+	if err != nil {
+		return err
+	}
+	foods := []models.Food{}
+	if err = cursor.All(ctx, &foods); err != nil {
+		return err
+	}
+
+	var version models.MenuVersion
+	version.ID = primitive.NewObjectID()
+	version.Menu_version_id = version.ID.Hex()
+	version.Menu_id = menu.Menu_id
+	version.Number = menu.Published_number
+	version.Menu = menu
+	version.Foods = foods
+	version.Published_by = publishedBy
+	version.Published_at = *menu.Published_at
+
+	_, err = menuVersionCollection.InsertOne(ctx, version)
+	return err
+}
+
+// GetMenuVersions lists the published versions of a menu, latest first, without their foods
+func GetMenuVersions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		opts := options.Find().SetSort(bson.D{{"number", -1}}).SetProjection(bson.M{"foods": 0})
+		cursor, err := menuVersionCollection.Find(ctx, bson.M{"menu_id": c.Param("menu_id")}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing menu versions"})
+			return
+		}
+		versions := []models.MenuVersion{}
+		if err = cursor.All(ctx, &versions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing menu versions"})
+			return
+		}
+		c.JSON(http.StatusOK, versions)
+	}
+}
+
+// GetMenuVersion returns a published version of a menu with its foods as they were then
+func GetMenuVersion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		number, err := strconv.Atoi(c.Param("number"))
+		if err != nil || number < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "version number must be a positive number"})
+			return
+		}
+		var version models.MenuVersion
+		err = menuVersionCollection.FindOne(ctx, bson.M{"menu_id": c.Param("menu_id"), "number": number}).Decode(&version)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu version was not found"})
+			return
+		}
+		c.JSON(http.StatusOK, version)
+	}
+}
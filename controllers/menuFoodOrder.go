@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MenuReorderRequest struct {
+	Food_ids []string `json:"food_ids" validate:"required,min=1,dive,required"`
+}
+
+// foodPositionStage adds the _position field foods are sorted by, putting foods without a
+// sort_order after the others (MongoDB sorts missing values first)
+var foodPositionStage = bson.D{{"$addFields", bson.D{{"_position", bson.D{{"$ifNull", bson.A{"$sort_order", int64(1) << 62}}}}}}}
+
+// sortFoodsByPosition orders foods by sort_order, then name; foods without a sort_order come last
+func sortFoodsByPosition(foods []models.Food) {
+	sort.SliceStable(foods, func(i, j int) bool {
+		a, b := foods[i].Sort_order, foods[j].Sort_order
+		if a != nil && b != nil && *a != *b {
+			return *a < *b
+		}
+		if (a == nil) != (b == nil) {
+			return a != nil
+		}
+		return foodName(foods[i]) < foodName(foods[j])
+	})
+}
+
+func foodName(food models.Food) string {
+	if food.Name == nil {
+		return ""
+	}
+	return *food.Name
+}
+
+// nextFoodSortOrder returns the position after the last food of a menu, where new foods are added
+func nextFoodSortOrder(ctx context.Context, menuId string) (int, error) {
+	var last models.Food
+	err := foodCollection.FindOne(
+		ctx,
+		bson.M{"menu_id": menuId, "sort_order": bson.M{"$type": "number"}},
+		options.FindOne().SetSort(bson.M{"sort_order": -1}),
+	).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return *last.Sort_order + 1, nil
+}
+
+// ReorderMenuFoods sets the display order of a menu's foods to the order of food_ids. Foods of the
+// menu that are not listed keep their relative order after the listed ones.
+func ReorderMenuFoods() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request MenuReorderRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		menuId := c.Param("menu_id")
+		count, err := menuCollection.CountDocuments(ctx, bson.D{{"menu_id", menuId}, notArchived})
+		if err != nil || count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu was not found"})
+			return
+		}
+
+		cursor, err := foodCollection.Find(ctx, bson.D{{"menu_id", menuId}, notArchived})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the menu's foods"})
+			return
+		}
+		var foods []models.Food
+		if err = cursor.All(ctx, &foods); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the menu's foods"})
+			return
+		}
+		sortFoodsByPosition(foods)
+
+		listed := map[string]bool{}
+		for _, foodId := range request.Food_ids {
+			if listed[foodId] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "food " + foodId + " is listed more than once"})
+				return
+			}
+			listed[foodId] = true
+		}
+		inMenu := map[string]bool{}
+		for _, food := range foods {
+			inMenu[food.Food_id] = true
+		}
+		var unknown []string
+		for _, foodId := range request.Food_ids {
+			if !inMenu[foodId] {
+				unknown = append(unknown, foodId)
+			}
+		}
+		if len(unknown) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "foods are not on this menu: " + strings.Join(unknown, ", ")})
+			return
+		}
+
+		order := append([]string{}, request.Food_ids...)
+		for _, food := range foods {
+			if !listed[food.Food_id] {
+				order = append(order, food.Food_id)
+			}
+		}
+
+		version, err := nextMenuVersion(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu reorder failed"})
+			return
+		}
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		var writes []mongo.WriteModel
+		for position, foodId := range order {
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"food_id": foodId, "menu_id": menuId}).
+				SetUpdate(bson.D{{"$set", bson.D{{"sort_order", position}, {"version", version}, {"updated_at", updatedAt}}}}))
+		}
+		if _, err = foodCollection.BulkWrite(ctx, writes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu reorder failed"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"menu_id": menuId, "food_ids": order, "version": version})
+	}
+}
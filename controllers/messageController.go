@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var outboundMessageCollection *mongo.Collection = database.OpenCollection(database.Client, "outboundMessage")
+
+func GetOutboundMessages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		if referenceId := c.Query("reference_id"); referenceId != "" {
+			filter["reference_id"] = referenceId
+		}
+		if channel := c.Query("channel"); channel != "" {
+			filter["channel"] = channel
+		}
+		if messageType := c.Query("type"); messageType != "" {
+			filter["type"] = messageType
+		}
+
+		opts := options.Find().SetSort(bson.D{{"created_at", -1}})
+		result, err := outboundMessageCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing messages"})
+			return
+		}
+
+		var messages []models.OutboundMessage
+		if err = result.All(ctx, &messages); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing messages"})
+			return
+		}
+		maskedJSON(c, http.StatusOK, messages)
+	}
+}
+
+// RetryOutboundMessage queues a FAILED message again, e.g. once the provider's outage is over or the
+// guest's address was corrected. The message is tried again as many times as a new one.
+func RetryOutboundMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		createdAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		var message models.OutboundMessage
+		err := outboundMessageCollection.FindOneAndUpdate(
+			ctx,
+			// Verification codes are masked once sent, guests request a new code instead
+			bson.M{"message_id": c.Param("message_id"), "status": "FAILED", "type": bson.M{"$ne": "OTP"}},
+			bson.D{{"$set", bson.D{{"status", "QUEUED"}, {"attempts", 0}, {"error", nil}, {"next_attempt_at", nil}, {"created_at", createdAt}}}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&message)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "message was not found, has not failed or is a verification code"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while queueing the message"})
+			return
+		}
+		go sendQueuedMessage(message)
+		maskedJSON(c, http.StatusOK, message)
+	}
+}
+
+// queueMessage stores a guest-facing message for delivery. Failures are logged rather than returned.
+// Text messages are sent right away in the background when an SMS provider is configured.
+func queueMessage(ctx context.Context, channel string, to string, subject string, body string, messageType string, referenceId string) {
+	message := newOutboundMessage(channel, to, subject, body, messageType, referenceId)
+	if _, err := outboundMessageCollection.InsertOne(ctx, message); err != nil {
+		log.Println("failed to queue message:", err)
+		return
+	}
+	go sendQueuedMessage(message)
+}
+
+func newOutboundMessage(channel string, to string, subject string, body string, messageType string, referenceId string) models.OutboundMessage {
+	var message models.OutboundMessage
+
+	message.ID = primitive.NewObjectID()
+	message.Message_id = message.ID.Hex()
+	message.Channel = channel
+	message.To = to
+	message.Subject = subject
+	message.Body = body
+	message.Type = messageType
+	message.Reference_id = referenceId
+	message.Status = "QUEUED"
+	message.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	return message
+}
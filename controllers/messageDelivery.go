@@ -0,0 +1,280 @@
+package controller
+
+import (
+	"context"
+	"crypto/hmac"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// smsStatusCallback returns the URL the provider reports delivery statuses to, "" for providers
+// without status callbacks. The base URL is taken from PUBLIC_BASE_URL (default http://localhost:8000).
+func smsStatusCallback(provider smsProvider) string {
+	if provider.Name() != "twilio" {
+		return ""
+	}
+	baseUrl := os.Getenv("PUBLIC_BASE_URL")
+	if baseUrl == "" {
+		baseUrl = "http://localhost:8000"
+	}
+	return baseUrl + "/webhooks/sms/twilio"
+}
+
+// messageSender hands messages of a channel to the provider configured for it
+type messageSender struct {
+	provider string
+	send     func(ctx context.Context, message models.OutboundMessage) (string, error)
+}
+
+// loadMessageSender returns the sender of a channel, or nil when no provider is configured for it
+func loadMessageSender(channel string) (*messageSender, error) {
+	switch channel {
+	case "SMS":
+		provider, err := loadSMSProvider()
+		if err != nil || provider == nil {
+			return nil, err
+		}
+		return &messageSender{provider.Name(), func(ctx context.Context, message models.OutboundMessage) (string, error) {
+			return provider.Send(ctx, message.To, message.Body, smsStatusCallback(provider))
+		}}, nil
+	case "EMAIL":
+		provider, err := loadEmailProvider()
+		if err != nil || provider == nil {
+			return nil, err
+		}
+		return &messageSender{provider.Name(), func(ctx context.Context, message models.OutboundMessage) (string, error) {
+			return provider.Send(ctx, outgoingEmail{to: message.To, subject: message.Subject, text: message.Body, html: message.Html})
+		}}, nil
+	}
+	return nil, nil
+}
+
+// messageRetryPolicy returns how many times a message of a channel is tried, and how long it may wait
+// to be sent: a late text is useless, a late email still worth sending
+func messageRetryPolicy(channel string) (int, time.Duration) {
+	if channel == "EMAIL" {
+		return envInt("EMAIL_MAX_ATTEMPTS", 5), time.Duration(envInt("EMAIL_MAX_AGE_HOURS", 24)) * time.Hour
+	}
+	return envInt("SMS_MAX_ATTEMPTS", 3), time.Duration(envInt("SMS_MAX_AGE_MINUTES", 60)) * time.Minute
+}
+
+// deliverMessage hands a queued message to the provider. The message is claimed first, so it is sent
+// once even when the delivery job and the request that queued it try at the same time. A failed message
+// is queued again, to be retried after 1, 4, 9... minutes, until it has been tried as often as its
+// channel allows.
+func deliverMessage(ctx context.Context, sender *messageSender, message models.OutboundMessage) error {
+	result, err := outboundMessageCollection.UpdateOne(
+		ctx,
+		bson.M{"message_id": message.Message_id, "status": "QUEUED"},
+		bson.D{
+			{"$set", bson.D{{"status", "SENDING"}, {"provider", sender.provider}}},
+			{"$inc", bson.D{{"attempts", 1}}},
+		},
+	)
+	if err != nil || result.MatchedCount == 0 {
+		return err
+	}
+
+	providerMessageId, sendErr := sender.send(ctx, message)
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	attempts := message.Attempts + 1
+
+	var set bson.D
+	final := true
+	if sendErr != nil {
+		status, retry := "FAILED", now
+		if maxAttempts, _ := messageRetryPolicy(message.Channel); attempts < maxAttempts {
+			status, final = "QUEUED", false
+			retry = now.Add(time.Duration(attempts*attempts) * time.Minute)
+		}
+		set = bson.D{{"status", status}, {"error", sendErr.Error()}, {"next_attempt_at", retry}}
+	} else {
+		set = bson.D{{"status", "SENT"}, {"provider_message_id", providerMessageId}, {"sent_at", now}, {"error", nil}, {"next_attempt_at", nil}}
+	}
+	// Codes are only readable until they are sent
+	if final && message.Type == "OTP" {
+		set = append(set, bson.E{"body", "Your verification code is ******"})
+	}
+	_, err = outboundMessageCollection.UpdateOne(ctx, bson.M{"message_id": message.Message_id, "status": "SENDING"}, bson.D{{"$set", set}})
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// sendQueuedMessage sends a message right after it was queued, when a provider is configured for its
+// channel. Messages that cannot be sent now are retried by the message delivery job.
+func sendQueuedMessage(message models.OutboundMessage) {
+	sender, err := loadMessageSender(message.Channel)
+	if err != nil {
+		log.Println("failed to send message:", err)
+		return
+	}
+	if sender == nil {
+		return
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := deliverMessage(ctx, sender, message); err != nil {
+		log.Println("failed to send message:", err)
+	}
+}
+
+// messageChannels are the channels the message delivery job sends
+var messageChannels = []string{"SMS", "EMAIL"}
+
+// StartMessageDeliveryJob starts a background job sending the messages still queued, e.g. because the
+// provider could not be reached when they were queued.
+// It is configured through environment variables:
+//   - SMS_PROVIDER, EMAIL_PROVIDER: the providers; the job only sends the channels with a provider
+//   - MESSAGE_DELIVERY_CHECK_SECONDS: how often the job runs (default 30)
+//   - SMS_MAX_AGE_MINUTES, EMAIL_MAX_AGE_HOURS: messages not sent by then are failed (default 60 minutes for
+//     texts, as they would arrive too late, 24 hours for emails)
+func StartMessageDeliveryJob() {
+	senders := map[string]*messageSender{}
+	for _, channel := range messageChannels {
+		sender, err := loadMessageSender(channel)
+		if err != nil {
+			log.Println("message delivery job:", err)
+			continue
+		}
+		if sender != nil {
+			senders[channel] = sender
+		}
+	}
+	if len(senders) == 0 {
+		return
+	}
+	interval := envInt("MESSAGE_DELIVERY_CHECK_SECONDS", 30)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			for channel, sender := range senders {
+				runMessageDelivery(channel, sender)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func runMessageDelivery(channel string, sender *messageSender) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	_, maxAge := messageRetryPolicy(channel)
+
+	_, err := outboundMessageCollection.UpdateMany(
+		ctx,
+		bson.M{"channel": channel, "status": "QUEUED", "created_at": bson.M{"$lt": now.Add(-maxAge)}},
+		bson.D{{"$set", bson.D{{"status", "FAILED"}, {"error", "expired before it could be sent"}}}},
+	)
+	if err != nil {
+		log.Println("message delivery job: message update failed:", err)
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{"created_at", 1}}).SetLimit(100)
+	filter := bson.M{
+		"channel": channel,
+		"status":  "QUEUED",
+		"$or":     bson.A{bson.M{"next_attempt_at": nil}, bson.M{"next_attempt_at": bson.M{"$lte": now}}},
+	}
+	cursor, err := outboundMessageCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println("message delivery job: message lookup failed:", err)
+		return
+	}
+	var messages []models.OutboundMessage
+	if err = cursor.All(ctx, &messages); err != nil {
+		log.Println("message delivery job: message lookup failed:", err)
+		return
+	}
+	for _, message := range messages {
+		if err := deliverMessage(ctx, sender, message); err != nil {
+			log.Println("message delivery job: message", message.Message_id, "could not be sent:", err)
+		}
+	}
+}
+
+// TwilioStatusWebhook records the delivery statuses Twilio reports for the text messages sent with it.
+// Requests must carry the X-Twilio-Signature computed with TWILIO_AUTH_TOKEN over the callback URL
+// and the posted parameters.
+func TwilioStatusWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		provider, err := loadSMSProvider()
+		twilio, ok := provider.(twilioSMSProvider)
+		if err != nil || !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Twilio is not configured"})
+			return
+		}
+		if err := c.Request.ParseForm(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status callback"})
+			return
+		}
+
+		// Twilio signs the URL it was given, which is built from PUBLIC_BASE_URL
+		baseUrl := os.Getenv("PUBLIC_BASE_URL")
+		if baseUrl == "" {
+			baseUrl = "http://localhost:8000"
+		}
+		expected := twilioSignature(twilio.authToken, baseUrl+c.Request.URL.RequestURI(), c.Request.PostForm)
+		if !hmac.Equal([]byte(expected), []byte(c.GetHeader("X-Twilio-Signature"))) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid signature"})
+			return
+		}
+
+		messageSid, status := c.Request.PostForm.Get("MessageSid"), c.Request.PostForm.Get("MessageStatus")
+		if messageSid == "" || status == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "MessageSid and MessageStatus are required"})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		event := models.MessageStatusEvent{Status: status, Error_code: c.Request.PostForm.Get("ErrorCode"), Received_at: now}
+		filter := bson.M{"provider": "twilio", "provider_message_id": messageSid}
+		result, err := outboundMessageCollection.UpdateOne(ctx, filter, bson.D{{"$push", bson.D{{"status_events", event}}}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while recording the status"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "message was not found"})
+			return
+		}
+
+		// Callbacks can arrive out of order: the outcome is only recorded on messages still in flight
+		var set bson.D
+		switch status {
+		case "delivered", "read":
+			set = bson.D{{"status", "DELIVERED"}, {"delivered_at", now}}
+		case "undelivered", "failed":
+			reason := "Twilio reported the message " + status
+			if event.Error_code != "" {
+				reason += " (error " + event.Error_code + ")"
+			}
+			set = bson.D{{"status", "FAILED"}, {"error", reason}}
+		}
+		if set != nil {
+			filter["status"] = bson.M{"$in": bson.A{"SENDING", "SENT"}}
+			if _, err := outboundMessageCollection.UpdateOne(ctx, filter, bson.D{{"$set", set}}); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while recording the status"})
+				return
+			}
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// moneyLocale describes how a locale writes amounts
+type moneyLocale struct {
+	decimal      string
+	group        string
+	indian       bool // groups by two digits after the first thousand (1,23,456.50)
+	symbolAfter  bool
+	symbolSpaced bool
+}
+
+var moneyLocales = map[string]moneyLocale{
+	"en-US": {decimal: ".", group: ","},
+	"en-GB": {decimal: ".", group: ","},
+	"en-AU": {decimal: ".", group: ","},
+	"en-IN": {decimal: ".", group: ",", indian: true},
+	"hi-IN": {decimal: ".", group: ",", indian: true},
+	"ja-JP": {decimal: ".", group: ","},
+	"de-DE": {decimal: ",", group: ".", symbolAfter: true, symbolSpaced: true},
+	"es-ES": {decimal: ",", group: ".", symbolAfter: true, symbolSpaced: true},
+	"it-IT": {decimal: ",", group: ".", symbolAfter: true, symbolSpaced: true},
+	"nl-NL": {decimal: ",", group: ".", symbolSpaced: true},
+	"pt-BR": {decimal: ",", group: ".", symbolSpaced: true},
+	"fr-FR": {decimal: ",", group: " ", symbolAfter: true, symbolSpaced: true},
+}
+
+// moneyLanguages maps a language to the locale used when a region is not listed above
+var moneyLanguages = map[string]string{
+	"en": "en-US", "hi": "hi-IN", "ja": "ja-JP", "de": "de-DE", "es": "es-ES", "it": "it-IT", "nl": "nl-NL", "pt": "pt-BR", "fr": "fr-FR",
+}
+
+var currencySymbols = map[string]string{
+	"USD": "$", "AUD": "$", "CAD": "$", "EUR": "€", "GBP": "£", "INR": "₹", "JPY": "¥", "BRL": "R$",
+}
+
+// formatMoney formats an amount for display in the restaurant's currency and locale,
+// e.g. $1,234.50 (en-US), 1.234,50 € (de-DE) or ₹1,23,456.00 (en-IN)
+func formatMoney(amount models.Money, settings models.Settings) string {
+	locale := moneyLocales["en-US"]
+	if settings.Locale != nil {
+		if configured, ok := moneyLocales[*settings.Locale]; ok {
+			locale = configured
+		} else if configured, ok := moneyLocales[moneyLanguages[strings.SplitN(*settings.Locale, "-", 2)[0]]]; ok {
+			// Fall back on the language when the region is unknown ("de-AT" -> "de-DE")
+			locale = configured
+		}
+	}
+
+	currency := settingsCurrency(settings)
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency
+		locale.symbolSpaced = true
+	}
+
+	text := amount.String()
+	negative := strings.HasPrefix(text, "-")
+	text = strings.TrimPrefix(text, "-")
+	whole, fraction := text, ""
+	if i := strings.Index(text, "."); i >= 0 {
+		whole, fraction = text[:i], text[i+1:]
+	}
+
+	var groups []string
+	size := 3
+	for len(whole) > size {
+		groups = append([]string{whole[len(whole)-size:]}, groups...)
+		whole = whole[:len(whole)-size]
+		if locale.indian {
+			size = 2
+		}
+	}
+	groups = append([]string{whole}, groups...)
+
+	number := strings.Join(groups, locale.group)
+	if fraction != "" {
+		number += locale.decimal + fraction
+	}
+
+	space := ""
+	if locale.symbolSpaced {
+		space = " "
+	}
+	formatted := symbol + space + number
+	if locale.symbolAfter {
+		formatted = number + space + symbol
+	}
+	if negative {
+		formatted = "-" + formatted
+	}
+	return formatted
+}
+
+// moneyValue converts an amount read from an aggregation into Money, so it is written out in
+// major units like any other amount; missing values are left as they are
+func moneyValue(value interface{}) interface{} {
+	switch amount := value.(type) {
+	case int64:
+		return models.Money(amount)
+	case int32:
+		return models.Money(amount)
+	case float64:
+		return models.MoneyFromFloat(amount)
+	}
+	return value
+}
+
+// legacyMoneyFields are the amounts that used to be stored as floating point major units
+var legacyMoneyFields = map[*mongo.Collection][]string{
+	foodCollection:                {"price", "cost"},
+	orderItemCollection:           {"unit_price"},
+	invoiceCollection:             {"subtotal", "discount_total", "tax_total", "service_charge", "tip", "grand_total", "gift_card_total", "refunded_amount"},
+	creditNoteCollection:          {"subtotal", "discount_total", "tax_total", "service_charge", "tip", "total"},
+	giftCardCollection:            {"initial_balance", "balance"},
+	giftCardTransactionCollection: {"amount", "balance_after"},
+}
+
+// MigrateMoneyAmounts converts amounts stored as floating point major units (12.5) into
+// integer minor units (1250). Nested amounts such as tax lines are converted when read and
+// rewritten the next time the document is saved.
+func MigrateMoneyAmounts() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	if _, err := loadSettings(ctx); err != nil {
+		log.Println("failed to load settings before migrating amounts:", err)
+		return
+	}
+
+	for collection, fields := range legacyMoneyFields {
+		for _, field := range fields {
+			minorUnits := bson.D{{"$round", bson.A{bson.D{{"$multiply", bson.A{"$" + field, models.MinorUnits()}}}, 0}}}
+			update := mongo.Pipeline{{{"$set", bson.D{{field, bson.D{{"$toLong", minorUnits}}}}}}}
+			result, err := collection.UpdateMany(ctx, bson.M{field: bson.M{"$type": "double"}}, update)
+			if err != nil {
+				log.Printf("failed to migrate %s.%s to minor units: %v\n", collection.Name(), field, err)
+				continue
+			}
+			if result.ModifiedCount > 0 {
+				log.Printf("migrated %d %s.%s amounts to minor units\n", result.ModifiedCount, collection.Name(), field)
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var notificationCollection *mongo.Collection = database.OpenCollection(database.Client, "notification")
+
+// recipientFilter matches the notifications addressed to the current user: their own, and those stored
+// for their role while nobody had it
+func recipientFilter(c *gin.Context) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"recipient_id": c.GetString("uid")},
+		bson.M{"recipient_id": nil, "recipient_role": c.GetString("role")},
+	}}
+}
+
+// GetNotifications lists the current user's notifications
+func GetNotifications() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := recipientFilter(c)
+		if c.Query("unread") == "true" {
+			filter["read_at"] = nil
+		}
+
+		opts := options.Find().SetSort(bson.D{{"created_at", -1}})
+		result, err := notificationCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing notifications"})
+			return
+		}
+
+		var allNotifications []bson.M
+		if err = result.All(ctx, &allNotifications); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing notifications"})
+			return
+		}
+		c.JSON(http.StatusOK, allNotifications)
+	}
+}
+
+// MarkNotificationRead marks one of the current user's notifications as read
+func MarkNotificationRead() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		notificationId := c.Param("notification_id")
+		readAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		filter := recipientFilter(c)
+		filter["notification_id"] = notificationId
+		result, err := notificationCollection.UpdateOne(
+			ctx,
+			filter,
+			bson.D{{"$set", bson.D{{"read_at", readAt}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "notification update failed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "notification was not found"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// notifyRole sends a notification to every user with the given role, on the channels each of them
+// chose for its type in their notification preferences (in the app only, by default). While nobody has
+// the role, a single notification is stored for the role instead.
+// Failures are logged rather than returned so a notification problem never breaks the caller.
+func notifyRole(ctx context.Context, role string, notificationType string, title string, message string, referenceId string) {
+	var notification models.Notification
+
+	notification.ID = primitive.NewObjectID()
+	notification.Notification_id = notification.ID.Hex()
+	notification.Recipient_role = &role
+	notification.Type = notificationType
+	notification.Title = title
+	notification.Message = message
+	if referenceId != "" {
+		notification.Reference_id = &referenceId
+	}
+	notification.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	var users []models.User
+	cursor, err := userCollection.Find(ctx, bson.M{"role": role})
+	if err == nil {
+		err = cursor.All(ctx, &users)
+	}
+	if err != nil {
+		log.Println("failed to find the users to notify:", err)
+	}
+	if len(users) == 0 {
+		if _, err := notificationCollection.InsertOne(ctx, notification); err != nil {
+			log.Println("failed to store notification:", err)
+		}
+		return
+	}
+
+	userIds := []string{}
+	for _, user := range users {
+		userIds = append(userIds, user.User_id)
+	}
+	preferences, err := loadNotificationPreferences(ctx, userIds)
+	if err != nil {
+		log.Println("failed to load notification preferences, using the defaults:", err)
+	}
+	for _, user := range users {
+		dispatchNotification(ctx, user, preferences[user.User_id], notification)
+	}
+}
+
+func notifyManagers(ctx context.Context, notificationType string, title string, message string, referenceId string) {
+	notifyRole(ctx, "MANAGER", notificationType, title, message, referenceId)
+}
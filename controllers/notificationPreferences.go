@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var notificationPreferencesCollection *mongo.Collection = database.OpenCollection(database.Client, "notificationPreferences")
+
+// notificationTypes are the notifications raised for staff, which preferences can route
+var notificationTypes = []string{
+	"CASH_OVER_SHORT",
+	"DEPOSIT_REFUND",
+	"FOOD_MARGIN_LOW",
+	"INVOICE_OVERDUE",
+	"ORDER_ESCALATION",
+	"RESERVATION_NO_SHOW",
+	"RESERVATION_RELEASED",
+	"ROOM_CHARGE_REJECTED",
+	"STALE_ORDER",
+	"VENDOR_INVOICE_REVIEW",
+}
+
+// defaultNotificationChannels are the channels of users without preferences
+var defaultNotificationChannels = []string{"IN_APP"}
+
+type NotificationPreferencesRequest struct {
+	Default_channels []string            `json:"default_channels" validate:"dive,eq=IN_APP|eq=PUSH|eq=SMS|eq=EMAIL"`
+	Events           map[string][]string `json:"events" validate:"dive,dive,eq=IN_APP|eq=PUSH|eq=SMS|eq=EMAIL"`
+}
+
+// uniqueChannels drops repeated channels, keeping their order
+func uniqueChannels(channels []string) []string {
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, channel := range channels {
+		if !seen[channel] {
+			seen[channel] = true
+			unique = append(unique, channel)
+		}
+	}
+	return unique
+}
+
+// notificationChannels returns the channels a notification type is sent to for a user, nil preferences
+// meaning the user has none
+func notificationChannels(preferences *models.NotificationPreferences, notificationType string) []string {
+	if preferences == nil {
+		return defaultNotificationChannels
+	}
+	if channels, ok := preferences.Events[notificationType]; ok {
+		return channels
+	}
+	if preferences.Default_channels == nil {
+		return defaultNotificationChannels
+	}
+	return preferences.Default_channels
+}
+
+// loadNotificationPreferences returns the preferences of users, by user_id; users without preferences
+// are left out
+func loadNotificationPreferences(ctx context.Context, userIds []string) (map[string]*models.NotificationPreferences, error) {
+	cursor, err := notificationPreferencesCollection.Find(ctx, bson.M{"user_id": bson.M{"$in": userIds}})
+	if err != nil {
+		return nil, err
+	}
+	var found []models.NotificationPreferences
+	if err = cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	preferences := map[string]*models.NotificationPreferences{}
+	for i := range found {
+		preferences[found[i].User_id] = &found[i]
+	}
+	return preferences, nil
+}
+
+// dispatchNotification sends a user their copy of a notification on the channels they chose for its
+// type. A notification both stored and pushed has the same id, so apps can mark it read.
+func dispatchNotification(ctx context.Context, user models.User, preferences *models.NotificationPreferences, notification models.Notification) {
+	channels := notificationChannels(preferences, notification.Type)
+	if len(channels) == 0 {
+		return
+	}
+	notification.ID = primitive.NewObjectID()
+	notification.Notification_id = notification.ID.Hex()
+	notification.Recipient_id = &user.User_id
+
+	referenceId := ""
+	if notification.Reference_id != nil {
+		referenceId = *notification.Reference_id
+	}
+	for _, channel := range channels {
+		switch channel {
+		case "IN_APP":
+			if _, err := notificationCollection.InsertOne(ctx, notification); err != nil {
+				log.Println("failed to store notification:", err)
+			}
+		case "PUSH":
+			orderEvents.notify(user.User_id, notification)
+		case "SMS":
+			if user.Phone != nil && *user.Phone != "" {
+				queueMessage(ctx, "SMS", *user.Phone, "", notification.Title+": "+notification.Message, notification.Type, referenceId)
+			}
+		case "EMAIL":
+			if user.Email != nil && *user.Email != "" {
+				queueMessage(ctx, "EMAIL", *user.Email, notification.Title, notification.Message, notification.Type, referenceId)
+			}
+		}
+	}
+}
+
+// GetNotificationPreferences returns the current user's notification preferences, the defaults when
+// they have none, with the notification types they can route
+func GetNotificationPreferences() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		userId := c.GetString("uid")
+		var preferences models.NotificationPreferences
+		err := notificationPreferencesCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&preferences)
+		if err == mongo.ErrNoDocuments {
+			preferences = models.NotificationPreferences{User_id: userId, Default_channels: defaultNotificationChannels, Events: map[string][]string{}}
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the notification preferences"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"preferences": preferences, "notification_types": notificationTypes})
+	}
+}
+
+// UpdateNotificationPreferences replaces the current user's notification preferences
+func UpdateNotificationPreferences() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request NotificationPreferencesRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		events := map[string][]string{}
+		for notificationType, channels := range request.Events {
+			known := sort.SearchStrings(notificationTypes, notificationType)
+			if known == len(notificationTypes) || notificationTypes[known] != notificationType {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unknown notification type " + notificationType})
+				return
+			}
+			events[notificationType] = uniqueChannels(channels)
+		}
+		defaultChannels := defaultNotificationChannels
+		if request.Default_channels != nil {
+			defaultChannels = uniqueChannels(request.Default_channels)
+		}
+
+		userId := c.GetString("uid")
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		var preferences models.NotificationPreferences
+		err := notificationPreferencesCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"user_id": userId},
+			bson.D{
+				{"$set", bson.D{{"default_channels", defaultChannels}, {"events", events}, {"updated_at", updatedAt}}},
+				{"$setOnInsert", bson.D{{"_id", primitive.NewObjectID()}}},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&preferences)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "notification preferences could not be saved"})
+			return
+		}
+		c.JSON(http.StatusOK, preferences)
+	}
+}
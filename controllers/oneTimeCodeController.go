@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"fmt"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var oneTimeCodeCollection *mongo.Collection = database.OpenCollection(database.Client, "oneTimeCode")
+
+// oneTimeCodeMaxAttempts is how many times a code can be checked before a new one has to be requested
+const oneTimeCodeMaxAttempts = 5
+
+type OneTimeCodeRequest struct {
+	Phone   *string `json:"phone" validate:"required,e164"`
+	Purpose *string `json:"purpose" validate:"required,eq=ORDER|eq=RESERVATION|eq=WAITLIST|eq=CUSTOMER"`
+}
+
+type OneTimeCodeVerification struct {
+	Phone   *string `json:"phone" validate:"required,e164"`
+	Purpose *string `json:"purpose" validate:"required,eq=ORDER|eq=RESERVATION|eq=WAITLIST|eq=CUSTOMER"`
+	Code    *string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// oneTimeCodeHash hashes a code with its id, so equal codes sent to different guests hash differently
+func oneTimeCodeHash(codeId string, code string) string {
+	return sha256Hex([]byte(codeId + ":" + code))
+}
+
+// SendOneTimeCode texts a 6 digit verification code to a guest's phone, for staff to check the code the
+// guest reads back. A number gets at most OTP_MAX_PER_HOUR codes an hour (default 5) and an address can
+// request OTP_MAX_PER_IP_PER_HOUR (default 30); codes expire after OTP_TTL_MINUTES (default 10).
+func SendOneTimeCode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request OneTimeCodeRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if provider, err := loadSMSProvider(); err != nil || provider == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "text messages are not configured"})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		sent, err := oneTimeCodeCollection.CountDocuments(ctx, bson.M{"phone": *request.Phone, "created_at": bson.M{"$gt": now.Add(-time.Hour)}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while sending the code"})
+			return
+		}
+		if sent >= int64(envInt("OTP_MAX_PER_HOUR", 5)) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many codes were requested for this number, try again later"})
+			return
+		}
+		requested, err := oneTimeCodeCollection.CountDocuments(ctx, bson.M{"requested_ip": c.ClientIP(), "created_at": bson.M{"$gt": now.Add(-time.Hour)}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while sending the code"})
+			return
+		}
+		if requested >= int64(envInt("OTP_MAX_PER_IP_PER_HOUR", 30)) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many codes were requested, try again later"})
+			return
+		}
+
+		number, err := rand.Int(rand.Reader, big.NewInt(1000000))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while sending the code"})
+			return
+		}
+		code := fmt.Sprintf("%06d", number.Int64())
+		ttl := envInt("OTP_TTL_MINUTES", 10)
+
+		var oneTimeCode models.OneTimeCode
+		oneTimeCode.ID = primitive.NewObjectID()
+		oneTimeCode.Code_id = oneTimeCode.ID.Hex()
+		oneTimeCode.Phone = *request.Phone
+		oneTimeCode.Purpose = *request.Purpose
+		oneTimeCode.Requested_ip = c.ClientIP()
+		oneTimeCode.Code_hash = oneTimeCodeHash(oneTimeCode.Code_id, code)
+		oneTimeCode.Expires_at = now.Add(time.Duration(ttl) * time.Minute)
+		oneTimeCode.Created_at = now
+		if _, err := oneTimeCodeCollection.InsertOne(ctx, oneTimeCode); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while sending the code"})
+			return
+		}
+
+		body := fmt.Sprintf("Your verification code is %s. It expires in %d minutes.", code, ttl)
+		queueMessage(ctx, "SMS", oneTimeCode.Phone, "", body, "OTP", oneTimeCode.Code_id)
+		c.JSON(http.StatusAccepted, gin.H{"code_id": oneTimeCode.Code_id, "expires_at": oneTimeCode.Expires_at})
+	}
+}
+
+// VerifyOneTimeCode checks the code last texted to a phone for a purpose. Each code can be checked
+// oneTimeCodeMaxAttempts times and is only accepted once.
+func VerifyOneTimeCode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request OneTimeCodeVerification
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		var oneTimeCode models.OneTimeCode
+		opts := options.FindOne().SetSort(bson.D{{"created_at", -1}, {"_id", -1}})
+		err := oneTimeCodeCollection.FindOne(ctx, bson.M{
+			"phone":       *request.Phone,
+			"purpose":     *request.Purpose,
+			"verified_at": nil,
+			"expires_at":  bson.M{"$gt": now},
+		}, opts).Decode(&oneTimeCode)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the code has expired or was not requested, request a new one"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the code"})
+			return
+		}
+
+		// Attempts are counted before the check, so guesses sent at the same time cannot exceed the limit
+		result, err := oneTimeCodeCollection.UpdateOne(
+			ctx,
+			bson.M{"code_id": oneTimeCode.Code_id, "attempts": bson.M{"$lt": oneTimeCodeMaxAttempts}},
+			bson.D{{"$inc", bson.D{{"attempts", 1}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the code"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many attempts, request a new code"})
+			return
+		}
+		if !hmac.Equal([]byte(oneTimeCodeHash(oneTimeCode.Code_id, *request.Code)), []byte(oneTimeCode.Code_hash)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the code is incorrect"})
+			return
+		}
+
+		result, err = oneTimeCodeCollection.UpdateOne(
+			ctx,
+			bson.M{"code_id": oneTimeCode.Code_id, "verified_at": nil},
+			bson.D{{"$set", bson.D{{"verified_at", now}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the code"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the code was already used, request a new one"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"verified": true, "phone": oneTimeCode.Phone, "purpose": oneTimeCode.Purpose, "verified_at": now})
+	}
+}
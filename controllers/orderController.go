@@ -25,7 +25,11 @@ func GetOrders() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 
-		result, err := orderCollection.Find(context.TODO(), bson.M{})
+		filter := bson.M{}
+		if locationId := c.Query("location_id"); locationId != "" {
+			filter["location_id"] = locationId
+		}
+		result, err := orderCollection.Find(context.TODO(), filter)
 		defer cancel()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing order items"})
@@ -34,7 +38,7 @@ func GetOrders() gin.HandlerFunc {
 		if err = result.All(ctx, &allOrders); err != nil {
 			log.Fatal(err)
 		}
-		c.JSON(http.StatusOK, allOrders)
+		maskedJSON(c, http.StatusOK, allOrders)
 	}
 }
 
@@ -48,8 +52,13 @@ func GetOrder() gin.HandlerFunc {
 		defer cancel()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the orders"})
+			return
+		}
+		if err := checkTabletTable(ctx, c, order.Table_id); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
 		}
-		c.JSON(http.StatusOK, order)
+		maskedJSON(c, http.StatusOK, order)
 	}
 }
 
@@ -70,6 +79,16 @@ func CreateOrder() gin.HandlerFunc {
 			return
 		}
 
+		if order.Delivery_eta != nil && (order.Channel == nil || *order.Channel != "DELIVERY") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "delivery_eta can only be set on delivery orders"})
+			return
+		}
+
+		if err := checkTabletTable(ctx, c, order.Table_id); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
 		if order.Table_id != nil {
 			err := tableCollection.FindOne(ctx, bson.M{"table_id": order.Table_id}).Decode(&table)
 			defer cancel()
@@ -78,6 +97,40 @@ func CreateOrder() gin.HandlerFunc {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 				return
 			}
+			if err := resolveCombinedTable(ctx, &table); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			order.Table_id = &table.Table_id
+			if err := checkTableLocation(table, order.Location_id); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if order.Location_id == nil {
+				order.Location_id = table.Location_id
+			}
+			if tableStatus(table) == "OUT_OF_SERVICE" && (order.Channel == nil || *order.Channel == "DINE_IN") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "the table is out of service"})
+				return
+			}
+			if order.Server_id == nil && (order.Channel == nil || *order.Channel == "DINE_IN") {
+				order.Server_id = tableServer(ctx, table)
+			}
+		}
+
+		if order.Customer_id != nil {
+			if err := checkCustomer(ctx, *order.Customer_id); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		// Ordering for a reservation seats it, so its deposit is credited on the order's invoice
+		if order.Reservation_id != nil {
+			if err := seatReservation(ctx, *order.Reservation_id, order.Table_id); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 		}
 
 		order.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
@@ -85,6 +138,25 @@ func CreateOrder() gin.HandlerFunc {
 
 		order.ID = primitive.NewObjectID()
 		order.Order_id = order.ID.Hex()
+		status := "QUEUED"
+		order.Status = &status
+		order.Status_changed_at = &order.Created_at
+		if order.Channel == nil {
+			channel := "DINE_IN"
+			order.Channel = &channel
+		}
+		if err := assignTableSession(ctx, &order); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "table session could not be assigned"})
+			return
+		}
+		if err := applyBuffetBilling(ctx, &order); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := assignOrderNumber(ctx, &order); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order number could not be assigned"})
+			return
+		}
 
 		result, insertErr := orderCollection.InsertOne(ctx, order)
 
@@ -93,6 +165,8 @@ func CreateOrder() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			return
 		}
+		recordOrderRevisions(ctx, c.GetString("uid"), orderRevision{orderId: order.Order_id, action: "ORDER_CREATED", newValue: order})
+		seatTableForOrder(ctx, order)
 
 		defer cancel()
 		c.JSON(http.StatusOK, result)
@@ -103,8 +177,10 @@ func UpdateOrder() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var table models.Table
 		var order models.Order
+		var existingOrder models.Order
 
 		var updateObj primitive.D
+		var changes []orderRevision
 
 		orderId := c.Param("order_id")
 		if err := c.BindJSON(&order); err != nil {
@@ -112,15 +188,79 @@ func UpdateOrder() gin.HandlerFunc {
 			return
 		}
 
+		orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&existingOrder)
+
 		if order.Table_id != nil {
-			err := menuCollection.FindOne(ctx, bson.M{"tabled_id": order.Table_id}).Decode(&table)
+			err := tableCollection.FindOne(ctx, bson.M{"table_id": order.Table_id}).Decode(&table)
 			defer cancel()
 			if err != nil {
-				msg := fmt.Sprintf("message:Menu was not found")
+				msg := fmt.Sprintf("message:Table was not found")
 				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 				return
 			}
-			updateObj = append(updateObj, bson.E{"menu", order.Table_id})
+			if err := resolveCombinedTable(ctx, &table); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			order.Table_id = &table.Table_id
+			if err := checkTableLocation(table, existingOrder.Location_id); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if tableStatus(table) == "OUT_OF_SERVICE" && (existingOrder.Channel == nil || *existingOrder.Channel == "DINE_IN") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "the table is out of service"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"table_id", order.Table_id})
+			if existingOrder.Table_id == nil || *existingOrder.Table_id != *order.Table_id {
+				changes = append(changes, orderRevision{orderId: orderId, action: "ORDER_UPDATED", field: "table_id", oldValue: existingOrder.Table_id, newValue: *order.Table_id})
+			}
+		}
+
+		// The party size of a buffet order can change while it is open, e.g. when a guest joins late
+		if order.Buffet_guests != nil {
+			if existingOrder.Billing_mode == nil || *existingOrder.Billing_mode != "BUFFET" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "buffet_guests can only be set on buffet orders"})
+				return
+			}
+			if locked, err := orderItemsLocked(ctx, orderId); err != nil || locked {
+				c.JSON(http.StatusConflict, gin.H{"error": "the order's invoice has been finalized, the party size can no longer change"})
+				return
+			}
+			if validationErr := validate.Struct(order.Buffet_guests); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"buffet_guests", order.Buffet_guests})
+			changes = append(changes, orderRevision{orderId: orderId, action: "ORDER_UPDATED", field: "buffet_guests", oldValue: existingOrder.Buffet_guests, newValue: *order.Buffet_guests})
+		}
+
+		// A new delivery ETA (e.g. after the courier was delayed) can alert managers again once it passes
+		if order.Delivery_eta != nil {
+			if existingOrder.Channel == nil || *existingOrder.Channel != "DELIVERY" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "delivery_eta can only be set on delivery orders"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"delivery_eta", order.Delivery_eta})
+			if existingOrder.Delivery_eta == nil || !existingOrder.Delivery_eta.Equal(*order.Delivery_eta) {
+				changes = append(changes, orderRevision{orderId: orderId, action: "ORDER_UPDATED", field: "delivery_eta", oldValue: existingOrder.Delivery_eta, newValue: *order.Delivery_eta})
+				if err := clearEscalation(ctx, orderId, "DELIVERY_LATE"); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "order item update failed"})
+					return
+				}
+			}
+		}
+
+		// Orders can be linked to a customer after they were placed, e.g. when the guest is recognised
+		if order.Customer_id != nil {
+			if err := checkCustomer(ctx, *order.Customer_id); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"customer_id", order.Customer_id})
+			if existingOrder.Customer_id == nil || *existingOrder.Customer_id != *order.Customer_id {
+				changes = append(changes, orderRevision{orderId: orderId, action: "ORDER_UPDATED", field: "customer_id", oldValue: existingOrder.Customer_id, newValue: *order.Customer_id})
+			}
 		}
 
 		order.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
@@ -137,7 +277,7 @@ func UpdateOrder() gin.HandlerFunc {
 			ctx,
 			filter,
 			bson.D{
-				{"$st", updateObj},
+				{"$set", updateObj},
 			},
 			&opt,
 		)
@@ -148,20 +288,377 @@ func UpdateOrder() gin.HandlerFunc {
 			return
 		}
 
+		recordOrderRevisions(ctx, c.GetString("uid"), changes...)
+
+		// Guests are told when their delivery is expected at another time than they were told before
+		if order.Delivery_eta != nil && existingOrder.Delivery_eta != nil && !existingOrder.Delivery_eta.Equal(*order.Delivery_eta) {
+			updatedOrder := existingOrder
+			updatedOrder.Delivery_eta = order.Delivery_eta
+			sendDeliveryUpdate(ctx, updatedOrder, "DELIVERY_ETA_CHANGED")
+		}
+
+		// An open order moved to another table takes the party with it
+		if order.Table_id != nil && existingOrder.Closed_at == nil && (existingOrder.Table_id == nil || *existingOrder.Table_id != *order.Table_id) {
+			movedOrder := existingOrder
+			movedOrder.Table_id = order.Table_id
+			seatTableForOrder(ctx, movedOrder)
+			if existingOrder.Table_id != nil {
+				releaseTable(ctx, *existingOrder.Table_id)
+			}
+		}
+
 		defer cancel()
 		c.JSON(http.StatusOK, result)
 	}
 }
 
-func OrderItemOrderCreator(order models.Order) string {
+func OrderItemOrderCreator(order models.Order, changedBy string) string {
+	if order.Table_id != nil {
+		var table models.Table
+		if tableCollection.FindOne(ctx, bson.M{"table_id": *order.Table_id}).Decode(&table) == nil && resolveCombinedTable(ctx, &table) == nil {
+			order.Table_id = &table.Table_id
+			if order.Location_id == nil {
+				order.Location_id = table.Location_id
+			}
+			if order.Server_id == nil && (order.Channel == nil || *order.Channel == "DINE_IN") {
+				order.Server_id = tableServer(ctx, table)
+			}
+		}
+	}
 
 	order.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	order.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	order.ID = primitive.NewObjectID()
 	order.Order_id = order.ID.Hex()
+	status := "QUEUED"
+	order.Status = &status
+	order.Status_changed_at = &order.Created_at
+	if order.Channel == nil {
+		channel := "DINE_IN"
+		order.Channel = &channel
+	}
+	if err := assignOrderNumber(ctx, &order); err != nil {
+		log.Println("failed to assign order number:", err)
+	}
+	if err := assignTableSession(ctx, &order); err != nil {
+		log.Println("failed to assign table session:", err)
+	}
+	if err := applyBuffetBilling(ctx, &order); err != nil {
+		log.Println("failed to apply buffet billing:", err)
+	}
 
 	orderCollection.InsertOne(ctx, order)
+	recordOrderRevisions(ctx, changedBy, orderRevision{orderId: order.Order_id, action: "ORDER_CREATED", newValue: order})
+	seatTableForOrder(ctx, order)
 	defer cancel()
 
 	return order.Order_id
 }
+
+// DeriveOrderStatus computes an order's overall status from the statuses of its items.
+// Voided items are ignored unless every item is voided. An order with some items READY
+// (or already delivered) while others are still in the kitchen is PARTIALLY_READY.
+func DeriveOrderStatus(itemStatuses []string) string {
+	counts := map[string]int{}
+	active := 0
+	for _, s := range itemStatuses {
+		if s == "" {
+			s = "QUEUED"
+		}
+		counts[s]++
+		if s != "VOIDED" {
+			active++
+		}
+	}
+
+	switch {
+	case len(itemStatuses) == 0:
+		return "QUEUED"
+	case active == 0:
+		return "VOIDED"
+	case counts["DELIVERED"] == active:
+		return "DELIVERED"
+	case counts["READY"]+counts["DELIVERED"] == active:
+		return "READY"
+	case counts["READY"]+counts["DELIVERED"] > 0:
+		return "PARTIALLY_READY"
+	case counts["COOKING"] > 0:
+		return "PREPARING"
+	default:
+		return "QUEUED"
+	}
+}
+
+// RefreshOrderStatus recomputes and stores the derived status of an order from its items
+func RefreshOrderStatus(ctx context.Context, orderId string) error {
+	cursor, err := orderItemCollection.Find(ctx, bson.M{"order_id": orderId})
+	if err != nil {
+		return err
+	}
+
+	var orderItems []models.OrderItem
+	if err = cursor.All(ctx, &orderItems); err != nil {
+		return err
+	}
+
+	var statuses []string
+	for _, orderItem := range orderItems {
+		statuses = append(statuses, orderItemStatus(orderItem))
+	}
+
+	status := DeriveOrderStatus(statuses)
+	updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	// The time of the status change is only recorded when the status actually changes,
+	// so escalation rules can tell how long an order has been in its current status
+	result, err := orderCollection.UpdateOne(
+		ctx,
+		bson.M{"order_id": orderId, "status": bson.M{"$ne": status}},
+		bson.D{{"$set", bson.D{{"status", status}, {"status_changed_at", updatedAt}, {"updated_at", updatedAt}}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		field := "status"
+		publishOrderEvents(ctx, RealtimeEvent{Type: "ORDER_STATUS_CHANGED", Order_id: orderId, Field: &field, Value: status, Changed_by: "system", At: updatedAt})
+		sendDeliveryStatusUpdate(ctx, orderId, status)
+		return nil
+	}
+	_, err = orderCollection.UpdateOne(
+		ctx,
+		bson.M{"order_id": orderId},
+		bson.D{{"$set", bson.D{{"updated_at", updatedAt}}}},
+	)
+	return err
+}
+
+func CloseOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		orderId := c.Param("order_id")
+
+		closed, err := closeOrder(ctx, orderId, "MANUAL", c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order close failed"})
+			return
+		}
+		if !closed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "order was not found or is already closed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"order_id": orderId, "close_reason": "MANUAL"})
+	}
+}
+
+// PresentCheck records that the check was presented to the table, which starts the wait for payment
+func PresentCheck() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		orderId := c.Param("order_id")
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		result, err := orderCollection.UpdateOne(
+			ctx,
+			bson.M{"order_id": orderId, "closed_at": nil},
+			bson.D{
+				{"$set", bson.D{{"check_presented_at", now}, {"updated_at", now}}},
+				{"$pull", bson.D{{"escalations", "CHECK_WAITING"}}},
+			},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order update failed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "order was not found or is already closed"})
+			return
+		}
+
+		recordOrderRevisions(ctx, c.GetString("uid"), orderRevision{orderId: orderId, action: "ORDER_UPDATED", field: "check_presented_at", newValue: now})
+		c.JSON(http.StatusOK, gin.H{"order_id": orderId, "check_presented_at": now})
+	}
+}
+
+// closeOrder marks an open order as closed with the given reason; it reports false when
+// the order does not exist or was already closed
+func closeOrder(ctx context.Context, orderId string, reason string, changedBy string) (bool, error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	result, err := orderCollection.UpdateOne(
+		ctx,
+		bson.M{"order_id": orderId, "closed_at": nil},
+		bson.D{{"$set", bson.D{{"closed_at", now}, {"close_reason", reason}, {"updated_at", now}}}},
+	)
+	if err != nil {
+		return false, err
+	}
+	if result.ModifiedCount > 0 {
+		recordOrderRevisions(ctx, changedBy, orderRevision{orderId: orderId, action: "ORDER_CLOSED", field: "close_reason", newValue: reason})
+
+		var order models.Order
+		if err := orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order); err == nil && order.Table_id != nil {
+			releaseTable(ctx, *order.Table_id)
+		}
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+type ProfitabilityLine struct {
+	Order_item_id string        `json:"order_item_id"`
+	Food_id       string        `json:"food_id"`
+	Food_name     string        `json:"food_name"`
+	Revenue       models.Money  `json:"revenue"`
+	Cost          *models.Money `json:"cost"`
+	Margin        *models.Money `json:"margin"`
+}
+
+type OrderProfitability struct {
+	Order_id        string              `json:"order_id"`
+	Channel         string              `json:"channel"`
+	Revenue         models.Money        `json:"revenue"`
+	Buffet_revenue  models.Money        `json:"buffet_revenue"`
+	Discounts       models.Money        `json:"discounts"`
+	Net_revenue     models.Money        `json:"net_revenue"`
+	Food_cost       models.Money        `json:"food_cost"`
+	Commission_rate float64             `json:"commission_rate"`
+	Commission      models.Money        `json:"commission"`
+	Gross_margin    models.Money        `json:"gross_margin"`
+	Margin_percent  float64             `json:"margin_percent"`
+	Uncosted_items  int                 `json:"uncosted_items"`
+	Lines           []ProfitabilityLine `json:"lines"`
+}
+
+func GetOrderProfitability() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		orderId := c.Param("order_id")
+		var order models.Order
+
+		if err := orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order was not found"})
+			return
+		}
+
+		profitability, err := orderProfitability(ctx, order)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating order profitability"})
+			return
+		}
+		c.JSON(http.StatusOK, profitability)
+	}
+}
+
+// orderProfitability combines item revenue, food costs, invoice discounts and the channel
+// commission into a margin breakdown. Foods are costed from their recipe, or else their recorded
+// cost. Voided items are excluded. Items whose food has no cost are counted in Uncosted_items so a suspiciously high margin can be spotted.
+func orderProfitability(ctx context.Context, order models.Order) (OrderProfitability, error) {
+	var profitability OrderProfitability
+	profitability.Order_id = order.Order_id
+	profitability.Channel = "DINE_IN"
+	if order.Channel != nil {
+		profitability.Channel = *order.Channel
+	}
+
+	cursor, err := orderItemCollection.Find(ctx, bson.M{"order_id": order.Order_id})
+	if err != nil {
+		return profitability, err
+	}
+	var orderItems []models.OrderItem
+	if err = cursor.All(ctx, &orderItems); err != nil {
+		return profitability, err
+	}
+
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		return profitability, err
+	}
+
+	// Foods included in a buffet bring no revenue of their own; the per-head charges are added below
+	foods := map[string]models.Food{}
+	included, err := buffetIncludedItems(ctx, []models.Order{order}, orderItems, settings, foods)
+	if err != nil {
+		return profitability, err
+	}
+	var foodIds []string
+	for _, orderItem := range orderItems {
+		if orderItem.Food_id != nil {
+			foodIds = append(foodIds, *orderItem.Food_id)
+		}
+	}
+	costs, err := recipeCosts(ctx, foodIds)
+	if err != nil {
+		return profitability, err
+	}
+	for _, orderItem := range orderItems {
+		if orderItemStatus(orderItem) == "VOIDED" || orderItem.Food_id == nil {
+			continue
+		}
+
+		food, ok := foods[*orderItem.Food_id]
+		if !ok {
+			if err := foodCollection.FindOne(ctx, bson.M{"food_id": *orderItem.Food_id}).Decode(&food); err != nil && err != mongo.ErrNoDocuments {
+				return profitability, err
+			}
+			foods[*orderItem.Food_id] = food
+		}
+
+		line := ProfitabilityLine{
+			Order_item_id: orderItem.Order_item_id,
+			Food_id:       *orderItem.Food_id,
+		}
+		if food.Name != nil {
+			line.Food_name = *food.Name
+		}
+		if orderItem.Unit_price != nil && !included[orderItem.Order_item_id] {
+			line.Revenue = *orderItem.Unit_price
+		}
+		if costed := foodCost(food, costs); costed != nil {
+			cost := *costed
+			margin := line.Revenue - cost
+			line.Cost = &cost
+			line.Margin = &margin
+			profitability.Food_cost += cost
+		} else {
+			profitability.Uncosted_items++
+		}
+
+		profitability.Revenue += line.Revenue
+		profitability.Lines = append(profitability.Lines, line)
+	}
+
+	for _, buffetLine := range buffetLines(order, settings) {
+		profitability.Buffet_revenue += buffetLine.Amount
+	}
+	profitability.Revenue += profitability.Buffet_revenue
+
+	// Split parents are skipped, their children carry the discounts; voided invoices gave none
+	invoiceCursor, err := invoiceCollection.Find(ctx, bson.M{"order_id": order.Order_id, "payment_status": bson.M{"$nin": bson.A{"SPLIT", "VOID"}}})
+	if err != nil {
+		return profitability, err
+	}
+	var invoices []models.Invoice
+	if err = invoiceCursor.All(ctx, &invoices); err != nil {
+		return profitability, err
+	}
+	for _, invoice := range invoices {
+		profitability.Discounts += invoice.Discount_total
+	}
+
+	profitability.Commission_rate = settings.Channel_commissions[profitability.Channel]
+
+	profitability.Net_revenue = profitability.Revenue - profitability.Discounts
+	profitability.Commission = profitability.Net_revenue.Mul(profitability.Commission_rate)
+	profitability.Gross_margin = profitability.Net_revenue - profitability.Food_cost - profitability.Commission
+	if profitability.Net_revenue > 0 {
+		profitability.Margin_percent = toFixed(float64(profitability.Gross_margin)/float64(profitability.Net_revenue)*100, 2)
+	}
+
+	return profitability, nil
+}
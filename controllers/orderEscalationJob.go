@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"golang-restaurant-management/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// escalationTitles are the alert headings of each escalation rule
+var escalationTitles = map[string]string{
+	"ORDER_PREPARING": "Order held up in the kitchen",
+	"CHECK_WAITING":   "Table waiting to pay",
+	"DELIVERY_LATE":   "Delivery running late",
+}
+
+// StartOrderEscalationJob launches the background job that alerts managers about held up orders,
+// following the escalation_rules setting. Rules are read on every run, so changes apply right away.
+// It is configured through environment variables:
+//   - ESCALATION_CHECK_MINUTES: how often the job runs (default 1)
+//   - SLACK_WEBHOOK_URL: Slack incoming webhook alerts are posted to (SLACK alerts are skipped when unset)
+func StartOrderEscalationJob() {
+	interval := envInt("ESCALATION_CHECK_MINUTES", 1)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		defer ticker.Stop()
+		for {
+			runOrderEscalations()
+			<-ticker.C
+		}
+	}()
+}
+
+func runOrderEscalations() {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		log.Println("order escalation job: error occured while fetching the settings:", err)
+		return
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	for _, rule := range settings.Escalation_rules {
+		if !rule.Disabled {
+			escalateOrders(ctx, now, rule)
+		}
+	}
+}
+
+// escalationFilter selects the open orders a rule applies to that were not escalated for it yet
+func escalationFilter(now time.Time, rule models.EscalationRule) bson.M {
+	cutoff := now.Add(-time.Duration(rule.Threshold_minutes) * time.Minute)
+	filter := bson.M{"closed_at": nil, "escalations": bson.M{"$ne": rule.Type}}
+
+	switch rule.Type {
+	case "ORDER_PREPARING":
+		filter["status"] = "PREPARING"
+		filter["status_changed_at"] = bson.M{"$lte": cutoff}
+	case "CHECK_WAITING":
+		filter["check_presented_at"] = bson.M{"$lte": cutoff}
+	case "DELIVERY_LATE":
+		filter["channel"] = "DELIVERY"
+		filter["status"] = bson.M{"$nin": bson.A{"DELIVERED", "VOIDED"}}
+		filter["delivery_eta"] = bson.M{"$lte": cutoff}
+	}
+	return filter
+}
+
+// escalateOrders alerts managers about every order matching the rule. The order is marked as escalated
+// before the alert is sent, so two app instances running the job never alert about the same order twice.
+func escalateOrders(ctx context.Context, now time.Time, rule models.EscalationRule) {
+	cursor, err := orderCollection.Find(ctx, escalationFilter(now, rule))
+	if err != nil {
+		log.Println("order escalation job: error occured while listing orders:", err)
+		return
+	}
+	var orders []models.Order
+	if err = cursor.All(ctx, &orders); err != nil {
+		log.Println("order escalation job: error occured while decoding orders:", err)
+		return
+	}
+
+	for _, order := range orders {
+		result, err := orderCollection.UpdateOne(
+			ctx,
+			bson.M{"order_id": order.Order_id, "escalations": bson.M{"$ne": rule.Type}},
+			bson.D{{"$addToSet", bson.D{{"escalations", rule.Type}}}},
+		)
+		if err != nil {
+			log.Println("order escalation job: order update failed:", err)
+			continue
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+
+		recordOrderRevisions(ctx, "system", orderRevision{orderId: order.Order_id, action: "ORDER_UPDATED", field: "escalations", newValue: rule.Type})
+		sendEscalationAlert(ctx, now, rule, order)
+	}
+}
+
+// escalationMessage describes how long the order has been waiting
+func escalationMessage(now time.Time, rule models.EscalationRule, order models.Order) string {
+	since := func(t *time.Time) time.Duration {
+		if t == nil {
+			return 0
+		}
+		return now.Sub(*t).Round(time.Minute)
+	}
+
+	switch rule.Type {
+	case "ORDER_PREPARING":
+		return fmt.Sprintf("Order #%d has been preparing for %s", order.Order_number, since(order.Status_changed_at))
+	case "CHECK_WAITING":
+		return fmt.Sprintf("The table of order #%d has been waiting %s to pay since its check was presented", order.Order_number, since(order.Check_presented_at))
+	default:
+		return fmt.Sprintf("Delivery order #%d is %s past its ETA", order.Order_number, since(order.Delivery_eta))
+	}
+}
+
+// sendEscalationAlert sends the alert to the rule's channels. Failures are logged rather than returned.
+func sendEscalationAlert(ctx context.Context, now time.Time, rule models.EscalationRule, order models.Order) {
+	title := escalationTitles[rule.Type]
+	message := escalationMessage(now, rule, order)
+
+	channels := rule.Channels
+	if len(channels) == 0 {
+		channels = []string{"PUSH"}
+	}
+	for _, channel := range channels {
+		switch channel {
+		case "PUSH":
+			notifyManagers(ctx, "ORDER_ESCALATION", title, message, order.Order_id)
+		case "SLACK":
+			if err := postSlackAlert(ctx, title+": "+message); err != nil {
+				log.Println("order escalation job: Slack alert failed:", err)
+			}
+		}
+	}
+}
+
+// postSlackAlert posts a message to the Slack incoming webhook configured by SLACK_WEBHOOK_URL
+func postSlackAlert(ctx context.Context, text string) error {
+	url := os.Getenv("SLACK_WEBHOOK_URL")
+	if url == "" {
+		return fmt.Errorf("SLACK_WEBHOOK_URL is not set")
+	}
+
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("Slack answered %d", response.StatusCode)
+	}
+	return nil
+}
+
+// clearEscalation lets an order be escalated again for a rule, e.g. after its delivery ETA was moved
+func clearEscalation(ctx context.Context, orderId string, ruleType string) error {
+	_, err := orderCollection.UpdateOne(ctx, bson.M{"order_id": orderId}, bson.D{{"$pull", bson.D{{"escalations", ruleType}}}})
+	return err
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	"golang-restaurant-management/database"
 	"golang-restaurant-management/models"
 	"log"
@@ -17,6 +18,8 @@ import (
 
 type OrderItemPack struct {
 	Table_id    *string
+	Channel     *string
+	Location_id *string
 	Order_items []models.OrderItem
 }
 
@@ -33,7 +36,8 @@ func GetOrderItems() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing ordered items"})
 			return
 		}
-		var allOrderItems []bson.M
+		// Decoded into models.OrderItem so prices are returned in major units
+		var allOrderItems []models.OrderItem
 		if err = result.All(ctx, &allOrderItems); err != nil {
 			log.Fatal(err)
 			return
@@ -44,8 +48,18 @@ func GetOrderItems() gin.HandlerFunc {
 
 func GetOrderItemsByOrder() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
 		orderId := c.Param("order_id")
 
+		var order models.Order
+		orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order)
+		if err := checkTabletTable(ctx, c, order.Table_id); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
 		allOrderItems, err := ItemsByOrder(orderId)
 
 		if err != nil {
@@ -72,18 +86,29 @@ func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
 	projectStage := bson.D{
 		{"$project", bson.D{
 			{"id", 0},
-			{"amount", "$food.price"},
+			// Items are charged their unit price, which includes their size, weight and options;
+			// items from before unit prices were stored are charged the food's price
+			{"amount", bson.D{{"$ifNull", []interface{}{"$unit_price", "$food.price"}}}},
 			{"total_count", 1},
 			{"food_name", "$food.name"},
+			// Kitchen screens show the food's short kitchen name
+			{"kitchen_name", bson.D{{"$ifNull", []interface{}{"$food.kitchen_name", "$food.name"}}}},
+			{"sku", "$food.sku"},
 			{"food_image", "$food.food_image"},
 			{"table_number", "$table.table_number"},
 			{"table_id", "$table.table_id"},
 			{"order_id", "$order.order_id"},
+			{"order_number", "$order.order_number"},
 			{"price", "$food.price"},
 			{"quantity", 1},
+			{"weight", 1},
+			{"weight_unit", 1},
+			{"options", 1},
+			{"order_item_id", 1},
+			{"status", bson.D{{"$ifNull", []interface{}{"$status", "QUEUED"}}}},
 		}}}
 
-	groupStage := bson.D{{"$group", bson.D{{"_id", bson.D{{"order_id", "$order_id"}, {"table_id", "$table_id"}, {"table_number", "$table_number"}}}, {"payment_due", bson.D{{"$sum", "$amount"}}}, {"total_count", bson.D{{"$sum", 1}}}, {"order_items", bson.D{{"$push", "$$ROOT"}}}}}}
+	groupStage := bson.D{{"$group", bson.D{{"_id", bson.D{{"order_id", "$order_id"}, {"order_number", "$order_number"}, {"table_id", "$table_id"}, {"table_number", "$table_number"}}}, {"payment_due", bson.D{{"$sum", "$amount"}}}, {"total_count", bson.D{{"$sum", 1}}}, {"order_items", bson.D{{"$push", "$$ROOT"}}}}}}
 
 	projectStage2 := bson.D{
 		{"$project", bson.D{
@@ -92,6 +117,7 @@ func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
 			{"payment_due", 1},
 			{"total_count", 1},
 			{"table_number", "$_id.table_number"},
+			{"order_number", "$_id.order_number"},
 			{"order_items", 1},
 		}}}
 
@@ -115,6 +141,26 @@ func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
 		panic(err)
 	}
 
+	// Prices come out of the pipeline in minor units
+	for _, order := range OrderItems {
+		order["payment_due"] = moneyValue(order["payment_due"])
+		if items, ok := order["order_items"].(primitive.A); ok {
+			for _, item := range items {
+				if orderItem, ok := item.(primitive.M); ok {
+					orderItem["amount"] = moneyValue(orderItem["amount"])
+					orderItem["price"] = moneyValue(orderItem["price"])
+					if options, ok := orderItem["options"].(primitive.A); ok {
+						for _, option := range options {
+							if option, ok := option.(primitive.M); ok {
+								option["price"] = moneyValue(option["price"])
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
 	defer cancel()
 
 	return OrderItems, err
@@ -134,6 +180,12 @@ func GetOrderItem() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing ordered item"})
 			return
 		}
+		var order models.Order
+		orderCollection.FindOne(ctx, bson.M{"order_id": orderItem.Order_id}).Decode(&order)
+		if err := checkTabletTable(ctx, c, order.Table_id); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusOK, orderItem)
 	}
 }
@@ -143,23 +195,90 @@ func UpdateOrderItem() gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 
 		var orderItem models.OrderItem
+		var existingItem models.OrderItem
 
-		orderItemId := c.Param("order_item_id")
+		orderItemId := c.Param("orderItem_id")
+
+		if err := c.BindJSON(&orderItem); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			defer cancel()
+			return
+		}
 
 		filter := bson.M{"order_item_id": orderItemId}
 
-		var updateObj primitive.D
+		orderItemCollection.FindOne(ctx, filter).Decode(&existingItem)
 
-		if orderItem.Unit_price != nil {
-			updateObj = append(updateObj, bson.E{"unit_price", *&orderItem.Unit_price})
+		if locked, err := orderItemsLocked(ctx, existingItem.Order_id); err != nil || locked {
+			c.JSON(http.StatusConflict, gin.H{"error": "the order's invoice has been finalized, its items can no longer change"})
+			defer cancel()
+			return
 		}
 
+		var updateObj primitive.D
+		var changes []orderRevision
+
 		if orderItem.Quantity != nil {
 			updateObj = append(updateObj, bson.E{"quantity", *orderItem.Quantity})
+			if existingItem.Quantity == nil || *existingItem.Quantity != *orderItem.Quantity {
+				changes = append(changes, orderRevision{orderId: existingItem.Order_id, orderItemId: orderItemId, action: "ITEM_UPDATED", field: "quantity", oldValue: existingItem.Quantity, newValue: *orderItem.Quantity})
+			}
 		}
 
 		if orderItem.Food_id != nil {
 			updateObj = append(updateObj, bson.E{"food_id", *orderItem.Food_id})
+			if existingItem.Food_id == nil || *existingItem.Food_id != *orderItem.Food_id {
+				changes = append(changes, orderRevision{orderId: existingItem.Order_id, orderItemId: orderItemId, action: "ITEM_UPDATED", field: "food_id", oldValue: existingItem.Food_id, newValue: *orderItem.Food_id})
+			}
+		}
+
+		// A new size, food, weight or options re-price the item; unit prices sent by the client are ignored
+		if orderItem.Quantity != nil || orderItem.Food_id != nil || orderItem.Weight != nil || orderItem.Options != nil {
+			priced := models.OrderItem{Food_id: existingItem.Food_id, Quantity: existingItem.Quantity, Weight: orderItem.Weight, Weight_unit: orderItem.Weight_unit, Options: existingItem.Options}
+			if orderItem.Food_id != nil {
+				priced.Food_id = orderItem.Food_id
+			}
+			if orderItem.Quantity != nil {
+				priced.Quantity = orderItem.Quantity
+			}
+			if orderItem.Options != nil {
+				if validationErr := validate.Var(orderItem.Options, "max=50,dive"); validationErr != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+					defer cancel()
+					return
+				}
+				priced.Options = orderItem.Options
+			}
+			// The same food keeps its measured weight when only the size changes
+			if orderItem.Weight == nil && orderItem.Food_id == nil {
+				priced.Weight = existingItem.Weight
+				priced.Weight_unit = existingItem.Weight_unit
+			}
+			if err := priceOrderItem(ctx, &priced, c.GetString("device_id")); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				defer cancel()
+				return
+			}
+			updateObj = append(updateObj, bson.E{"unit_price", *priced.Unit_price}, bson.E{"options", priced.Options})
+			if orderItem.Options != nil && orderItemOptionNames(existingItem.Options) != orderItemOptionNames(priced.Options) {
+				changes = append(changes, orderRevision{orderId: existingItem.Order_id, orderItemId: orderItemId, action: "ITEM_UPDATED", field: "options", oldValue: orderItemOptionNames(existingItem.Options), newValue: orderItemOptionNames(priced.Options)})
+			}
+			if orderItem.Weight != nil {
+				updateObj = append(updateObj, bson.E{"weight", *priced.Weight}, bson.E{"weight_unit", *priced.Weight_unit}, bson.E{"weight_source", *priced.Weight_source}, bson.E{"scale_device_id", priced.Scale_device_id})
+				if existingItem.Weight == nil || *existingItem.Weight != *priced.Weight {
+					changes = append(changes, orderRevision{orderId: existingItem.Order_id, orderItemId: orderItemId, action: "ITEM_UPDATED", field: "weight", oldValue: existingItem.Weight, newValue: *priced.Weight})
+				}
+			} else if priced.Weight == nil && existingItem.Weight != nil {
+				updateObj = append(updateObj, bson.E{"weight", nil}, bson.E{"weight_unit", nil}, bson.E{"weight_source", nil}, bson.E{"scale_device_id", nil})
+			}
+			if existingItem.Unit_price == nil || *existingItem.Unit_price != *priced.Unit_price {
+				// Revisions keep prices in major units, as they are shown in the order history
+				var oldValue interface{}
+				if existingItem.Unit_price != nil {
+					oldValue = existingItem.Unit_price.Float()
+				}
+				changes = append(changes, orderRevision{orderId: existingItem.Order_id, orderItemId: orderItemId, action: "PRICE_CHANGED", field: "unit_price", oldValue: oldValue, newValue: priced.Unit_price.Float()})
+			}
 		}
 
 		orderItem.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
@@ -182,15 +301,64 @@ func UpdateOrderItem() gin.HandlerFunc {
 		if err != nil {
 			msg := "Order item update failed"
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			defer cancel()
 			return
 		}
 
+		if existingItem.Order_id != "" {
+			recordOrderRevisions(ctx, c.GetString("uid"), changes...)
+		}
+
 		defer cancel()
 
 		c.JSON(http.StatusOK, result)
 	}
 }
 
+func DeleteOrderItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var orderItem models.OrderItem
+		orderItemId := c.Param("orderItem_id")
+
+		err := orderItemCollection.FindOne(ctx, bson.M{"order_item_id": orderItemId}).Decode(&orderItem)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order item was not found"})
+			return
+		}
+
+		if locked, err := orderItemsLocked(ctx, orderItem.Order_id); err != nil || locked {
+			c.JSON(http.StatusConflict, gin.H{"error": "the order's invoice has been finalized, its items can no longer change"})
+			return
+		}
+
+		// Once the kitchen has started on an item it has to be voided instead, so the waste is visible
+		if orderItemStatus(orderItem) != "QUEUED" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only queued order items can be removed, void the item instead"})
+			return
+		}
+
+		result, err := orderItemCollection.DeleteOne(ctx, bson.M{"order_item_id": orderItemId, "status": bson.M{"$in": bson.A{"QUEUED", nil}}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order item could not be removed"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "order item status changed concurrently, please retry"})
+			return
+		}
+
+		recordOrderRevisions(ctx, c.GetString("uid"), orderRevision{orderId: orderItem.Order_id, orderItemId: orderItemId, action: "ITEM_REMOVED", oldValue: orderItem})
+
+		if err := RefreshOrderStatus(ctx, orderItem.Order_id); err != nil {
+			log.Println("failed to refresh order status:", err)
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
 func CreateOrderItem() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
@@ -203,11 +371,18 @@ func CreateOrderItem() gin.HandlerFunc {
 			return
 		}
 
+		if err := checkTabletTable(ctx, c, orderItemPack.Table_id); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
 		order.Order_Date, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 
 		orderItemsToBeInserted := []interface{}{}
 		order.Table_id = orderItemPack.Table_id
-		order_id := OrderItemOrderCreator(order)
+		order.Channel = orderItemPack.Channel
+		order.Location_id = orderItemPack.Location_id
+		order_id := OrderItemOrderCreator(order, c.GetString("uid"))
 
 		for _, orderItem := range orderItemPack.Order_items {
 			orderItem.Order_id = order_id
@@ -218,12 +393,17 @@ func CreateOrderItem() gin.HandlerFunc {
 				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
 				return
 			}
+			if err := priceOrderItem(ctx, &orderItem, c.GetString("device_id")); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			orderItem.ID = primitive.NewObjectID()
 			orderItem.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 			orderItem.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 			orderItem.Order_item_id = orderItem.ID.Hex()
-			var num = toFixed(*orderItem.Unit_price, 2)
-			orderItem.Unit_price = &num
+			queued := "QUEUED"
+			orderItem.Status = &queued
+			orderItem.Void_reason, orderItem.Voided_by, orderItem.Voided_at = nil, nil, nil
 			orderItemsToBeInserted = append(orderItemsToBeInserted, orderItem)
 		}
 
@@ -232,8 +412,228 @@ func CreateOrderItem() gin.HandlerFunc {
 		if err != nil {
 			log.Fatal(err)
 		}
+
+		var changes []orderRevision
+		for _, inserted := range orderItemsToBeInserted {
+			orderItem := inserted.(models.OrderItem)
+			changes = append(changes, orderRevision{orderId: order_id, orderItemId: orderItem.Order_item_id, action: "ITEM_ADDED", newValue: orderItem})
+		}
+		recordOrderRevisions(ctx, c.GetString("uid"), changes...)
 		defer cancel()
 
 		c.JSON(http.StatusOK, insertedOrderItems)
 	}
 }
+
+// orderItemTransitions lists, for every target status, the statuses an item may move from
+var orderItemTransitions = map[string][]string{
+	"COOKING":   {"QUEUED", "READY"},
+	"READY":     {"COOKING"},
+	"DELIVERED": {"READY"},
+	"VOIDED":    {"QUEUED", "COOKING", "READY"},
+}
+
+// nextBumpStatus is the status a kitchen bump moves an item to
+var nextBumpStatus = map[string]string{
+	"QUEUED":  "COOKING",
+	"COOKING": "READY",
+}
+
+func BumpOrderItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var orderItem models.OrderItem
+		orderItemId := c.Param("orderItem_id")
+
+		err := orderItemCollection.FindOne(ctx, bson.M{"order_item_id": orderItemId}).Decode(&orderItem)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order item was not found"})
+			return
+		}
+
+		next, ok := nextBumpStatus[orderItemStatus(orderItem)]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "order item cannot be bumped from status " + orderItemStatus(orderItem)})
+			return
+		}
+
+		updated, err := setOrderItemStatus(ctx, orderItem, next, c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+// RecallOrderItem brings an item bumped as READY back to the kitchen screens, e.g. when it was sent back
+func RecallOrderItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var orderItem models.OrderItem
+		orderItemId := c.Param("orderItem_id")
+
+		err := orderItemCollection.FindOne(ctx, bson.M{"order_item_id": orderItemId}).Decode(&orderItem)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order item was not found"})
+			return
+		}
+		if orderItemStatus(orderItem) != "READY" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only READY items can be recalled"})
+			return
+		}
+
+		updated, err := setOrderItemStatus(ctx, orderItem, "COOKING", c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+func ServeOrderItem() gin.HandlerFunc {
+	return orderItemStatusHandler("DELIVERED")
+}
+
+type VoidOrderItemRequest struct {
+	Reason *string `json:"reason" validate:"omitempty,max=250"`
+}
+
+// VoidOrderItem takes an item off the order, with an optional reason for the exceptions report
+func VoidOrderItem() gin.HandlerFunc {
+	return orderItemStatusHandler("VOIDED")
+}
+
+func orderItemStatusHandler(status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var orderItem models.OrderItem
+		orderItemId := c.Param("orderItem_id")
+
+		err := orderItemCollection.FindOne(ctx, bson.M{"order_item_id": orderItemId}).Decode(&orderItem)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order item was not found"})
+			return
+		}
+
+		// Voiding takes the item off the bill
+		if status == "VOIDED" {
+			if locked, err := orderItemsLocked(ctx, orderItem.Order_id); err != nil || locked {
+				c.JSON(http.StatusConflict, gin.H{"error": "the order's invoice has been finalized, its items can no longer change"})
+				return
+			}
+			// The reason is optional, so voids sent without a body keep working
+			var request VoidOrderItemRequest
+			if c.Request.ContentLength > 0 {
+				if err := c.BindJSON(&request); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				if validationErr := validate.Struct(request); validationErr != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+					return
+				}
+			}
+			orderItem.Void_reason = request.Reason
+		}
+
+		updated, err := setOrderItemStatus(ctx, orderItem, status, c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+// orderItemStatus returns the item's status, treating items created before statuses existed as QUEUED
+func orderItemStatus(orderItem models.OrderItem) string {
+	if orderItem.Status == nil || *orderItem.Status == "" {
+		return "QUEUED"
+	}
+	return *orderItem.Status
+}
+
+// setOrderItemStatus moves an order item to the given status and refreshes the parent order's derived status.
+// The update only matches while the item is still in the status it was read in,
+// so two kitchen screens bumping the same item cannot skip a step.
+func setOrderItemStatus(ctx context.Context, orderItem models.OrderItem, status string, changedBy string) (models.OrderItem, error) {
+	from := orderItemTransitions[status]
+	current := orderItemStatus(orderItem)
+
+	allowed := false
+	for _, s := range from {
+		if s == current {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return orderItem, fmt.Errorf("order item cannot move from %s to %s", current, status)
+	}
+
+	fromFilter := bson.A{current}
+	if current == "QUEUED" {
+		fromFilter = append(fromFilter, nil)
+	}
+
+	updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	filter := bson.M{"order_item_id": orderItem.Order_item_id, "status": bson.M{"$in": fromFilter}}
+	set := bson.D{{"status", status}, {"updated_at", updatedAt}}
+	if status == "VOIDED" {
+		orderItem.Voided_by, orderItem.Voided_at = &changedBy, &updatedAt
+		set = append(set, bson.E{"void_reason", orderItem.Void_reason}, bson.E{"voided_by", changedBy}, bson.E{"voided_at", updatedAt})
+	}
+	update := bson.D{{"$set", set}}
+
+	// Firing and voiding move stock, which is recorded in the same transaction as the status
+	movements, err := orderItemStockMovements(ctx, orderItem, current, status, changedBy)
+	if err != nil {
+		return orderItem, err
+	}
+	apply := func(ctx context.Context) error {
+		result, err := orderItemCollection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return fmt.Errorf("order item status changed concurrently, please retry")
+		}
+		for i := range movements {
+			if err := recordInventoryMovement(ctx, &movements[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(movements) > 0 {
+		err = runInTransaction(ctx, apply)
+	} else {
+		err = apply(ctx)
+	}
+	if err != nil {
+		return orderItem, err
+	}
+
+	action := "STATUS_CHANGED"
+	if status == "VOIDED" {
+		action = "ITEM_VOIDED"
+	} else if current == "READY" && status == "COOKING" {
+		action = "ITEM_RECALLED"
+	}
+	recordOrderRevisions(ctx, changedBy, orderRevision{orderId: orderItem.Order_id, orderItemId: orderItem.Order_item_id, action: action, field: "status", oldValue: current, newValue: status})
+
+	orderItem.Status = &status
+	orderItem.Updated_at = updatedAt
+
+	if err := RefreshOrderStatus(ctx, orderItem.Order_id); err != nil {
+		return orderItem, err
+	}
+	return orderItem, nil
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/models"
+	"time"
+)
+
+// defaultBusinessDayStartHour is used when the settings do not configure business_day_start_hour
+const defaultBusinessDayStartHour = 4
+
+// businessDate returns the business day (YYYY-MM-DD) a moment belongs to. Before the configured
+// start hour it still belongs to the previous day.
+func businessDate(settings models.Settings, at time.Time) string {
+	startHour := defaultBusinessDayStartHour
+	if settings.Business_day_start_hour != nil {
+		startHour = *settings.Business_day_start_hour
+	}
+	return at.Add(-time.Duration(startHour) * time.Hour).Format("2006-01-02")
+}
+
+// assignOrderNumber gives a new order its short customer-facing number. Numbers come from a
+// counter per location and business day, so they restart every day and never repeat within one;
+// the unique order index guards against duplicates as well.
+func assignOrderNumber(ctx context.Context, order *models.Order) error {
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		return err
+	}
+
+	order.Business_date = businessDate(settings, time.Now())
+	location := "default"
+	if order.Location_id != nil {
+		location = *order.Location_id
+	}
+
+	value, err := nextCounter(ctx, fmt.Sprintf("order_number:%s:%s", location, order.Business_date))
+	if err != nil {
+		return err
+	}
+
+	start := 1
+	if settings.Order_number_start != nil {
+		start = *settings.Order_number_start
+	}
+	order.Order_number = start + int(value) - 1
+	return nil
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var orderRevisionCollection *mongo.Collection = database.OpenCollection(database.Client, "orderRevision")
+
+func GetOrderHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		orderId := c.Param("order_id")
+
+		opts := options.Find().SetSort(bson.D{{"created_at", 1}, {"_id", 1}})
+		result, err := orderRevisionCollection.Find(ctx, bson.M{"order_id": orderId}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the order history"})
+			return
+		}
+
+		var revisions []models.OrderRevision
+		if err = result.All(ctx, &revisions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the order history"})
+			return
+		}
+		maskedJSON(c, http.StatusOK, revisions)
+	}
+}
+
+// orderRevision describes a single change to be written to the order history
+type orderRevision struct {
+	orderId     string
+	orderItemId string
+	action      string
+	field       string
+	oldValue    interface{}
+	newValue    interface{}
+}
+
+// recordOrderRevisions appends entries to the order history. History is best effort:
+// a failure is logged but never fails the change that triggered it.
+func recordOrderRevisions(ctx context.Context, changedBy string, changes ...orderRevision) {
+	if len(changes) == 0 {
+		return
+	}
+	if changedBy == "" {
+		changedBy = "system"
+	}
+
+	createdAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	documents := []interface{}{}
+	for _, change := range changes {
+		var revision models.OrderRevision
+		revision.ID = primitive.NewObjectID()
+		revision.Revision_id = revision.ID.Hex()
+		revision.Order_id = change.orderId
+		if change.orderItemId != "" {
+			orderItemId := change.orderItemId
+			revision.Order_item_id = &orderItemId
+		}
+		revision.Action = change.action
+		if change.field != "" {
+			field := change.field
+			revision.Field = &field
+		}
+		revision.Old_value = change.oldValue
+		revision.New_value = change.newValue
+		revision.Changed_by = changedBy
+		revision.Created_at = createdAt
+		documents = append(documents, revision)
+	}
+
+	if _, err := orderRevisionCollection.InsertMany(ctx, documents); err != nil {
+		log.Println("failed to record order history:", err)
+	}
+	recordKitchenEvents(ctx, changedBy, createdAt, changes)
+
+	// Connected clients are told about every change that makes it into the history
+	events := []RealtimeEvent{}
+	for _, document := range documents {
+		revision := document.(models.OrderRevision)
+		events = append(events, RealtimeEvent{
+			Type:          revision.Action,
+			Order_id:      revision.Order_id,
+			Order_item_id: revision.Order_item_id,
+			Field:         revision.Field,
+			Value:         revision.New_value,
+			Changed_by:    changedBy,
+			At:            createdAt,
+		})
+	}
+	publishOrderEvents(ctx, events...)
+}
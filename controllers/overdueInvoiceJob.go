@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"golang-restaurant-management/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OverdueInvoice is an unpaid invoice past its due date, as listed for follow-up
+type OverdueInvoice struct {
+	Invoice_id        string       `json:"invoice_id"`
+	Invoice_number    string       `json:"invoice_number"`
+	Order_id          string       `json:"order_id"`
+	Payment_due_date  time.Time    `json:"payment_due_date"`
+	Days_overdue      int          `json:"days_overdue"`
+	Amount_due        models.Money `json:"amount_due"`
+	Overdue_reminders int          `json:"overdue_reminders"`
+	Last_reminder_at  *time.Time   `json:"last_reminder_at"`
+}
+
+// overdueFilter selects the unpaid invoices past their due date. Invoices being charged to a room
+// are left out, as they are paid once the PMS acknowledges the charge.
+func overdueFilter(now time.Time) bson.M {
+	return bson.M{
+		"payment_status":         "PENDING",
+		"payment_due_date":       bson.M{"$lt": now},
+		"room_charge_posting_id": nil,
+	}
+}
+
+// GetOverdueInvoices lists the unpaid invoices past their due date, the longest overdue first
+func GetOverdueInvoices() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		now := time.Now()
+		opts := options.Find().SetSort(bson.D{{"payment_due_date", 1}})
+		cursor, err := invoiceCollection.Find(ctx, overdueFilter(now), opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing overdue invoices"})
+			return
+		}
+		var invoices []models.Invoice
+		if err = cursor.All(ctx, &invoices); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing overdue invoices"})
+			return
+		}
+
+		overdue := []OverdueInvoice{}
+		var total models.Money
+		for _, invoice := range invoices {
+			amountDue := invoiceAmountDue(invoice)
+			total += amountDue
+			overdue = append(overdue, OverdueInvoice{
+				Invoice_id:        invoice.Invoice_id,
+				Invoice_number:    invoice.Invoice_number,
+				Order_id:          invoice.Order_id,
+				Payment_due_date:  invoice.Payment_due_date,
+				Days_overdue:      int(math.Floor(now.Sub(invoice.Payment_due_date).Hours() / 24)),
+				Amount_due:        amountDue,
+				Overdue_reminders: invoice.Overdue_reminders,
+				Last_reminder_at:  invoice.Last_reminder_at,
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"invoices": overdue, "count": len(overdue), "total_due": total})
+	}
+}
+
+// StartOverdueInvoiceJob launches the background job that flags unpaid invoices once they are past
+// their due date and sends payment reminders following the overdue_reminders setting.
+// It is configured through environment variables:
+//   - OVERDUE_INVOICE_CHECK_MINUTES: how often the job runs (default 60)
+func StartOverdueInvoiceJob() {
+	interval := envInt("OVERDUE_INVOICE_CHECK_MINUTES", 60)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		defer ticker.Stop()
+		for {
+			runOverdueInvoiceCheck()
+			<-ticker.C
+		}
+	}()
+}
+
+func runOverdueInvoiceCheck() {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	_, err := invoiceCollection.UpdateMany(
+		ctx,
+		bson.M{"$and": bson.A{overdueFilter(now), bson.M{"overdue_at": nil}}},
+		bson.D{{"$set", bson.D{{"overdue_at", now}, {"updated_at", now}}}},
+	)
+	if err != nil {
+		log.Println("overdue invoice job: invoice update failed:", err)
+		return
+	}
+
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		log.Println("overdue invoice job: error occured while fetching the settings:", err)
+		return
+	}
+	sendOverdueReminders(ctx, now, settings)
+}
+
+// overdueReminderSettings returns the configured reminder cadence, with defaults for what is not set
+func overdueReminderSettings(settings models.Settings) (time.Duration, int, []string) {
+	interval, maxReminders, recipients := 24, 3, []string{"MANAGERS"}
+	if reminders := settings.Overdue_reminders; reminders != nil {
+		if reminders.Interval_hours > 0 {
+			interval = reminders.Interval_hours
+		}
+		if reminders.Max_reminders != nil {
+			maxReminders = *reminders.Max_reminders
+		}
+		if len(reminders.Recipients) > 0 {
+			recipients = reminders.Recipients
+		}
+	}
+	return time.Duration(interval) * time.Hour, maxReminders, recipients
+}
+
+// sendOverdueReminders reminds about every overdue invoice whose last reminder is older than the
+// interval. The reminder is counted before it is sent, so that two app instances running the job
+// never send the same reminder twice.
+func sendOverdueReminders(ctx context.Context, now time.Time, settings models.Settings) {
+	interval, maxReminders, recipients := overdueReminderSettings(settings)
+	if maxReminders == 0 {
+		return
+	}
+
+	filter := overdueFilter(now)
+	filter["overdue_reminders"] = bson.M{"$not": bson.M{"$gte": maxReminders}}
+	filter["$or"] = bson.A{bson.M{"last_reminder_at": nil}, bson.M{"last_reminder_at": bson.M{"$lte": now.Add(-interval)}}}
+
+	cursor, err := invoiceCollection.Find(ctx, filter)
+	if err != nil {
+		log.Println("overdue invoice job: error occured while listing invoices:", err)
+		return
+	}
+	var invoices []models.Invoice
+	if err = cursor.All(ctx, &invoices); err != nil {
+		log.Println("overdue invoice job: error occured while decoding invoices:", err)
+		return
+	}
+
+	for _, invoice := range invoices {
+		var sent interface{} = invoice.Overdue_reminders
+		if invoice.Overdue_reminders == 0 {
+			sent = bson.M{"$in": bson.A{0, nil}}
+		}
+		result, err := invoiceCollection.UpdateOne(
+			ctx,
+			bson.M{"invoice_id": invoice.Invoice_id, "overdue_reminders": sent},
+			bson.D{
+				{"$set", bson.D{{"last_reminder_at", now}}},
+				{"$inc", bson.D{{"overdue_reminders", 1}}},
+			},
+		)
+		if err != nil {
+			log.Println("overdue invoice job: invoice update failed:", err)
+			continue
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+
+		amountDue := formatMoney(invoiceAmountDue(invoice), settings)
+		for _, recipient := range recipients {
+			switch recipient {
+			case "MANAGERS":
+				message := fmt.Sprintf("Invoice %s (%s) was due on %s and is still unpaid", invoice.Invoice_number, amountDue, invoice.Payment_due_date.Format("2006-01-02"))
+				notifyManagers(ctx, "INVOICE_OVERDUE", "Overdue invoice", message, invoice.Invoice_id)
+			case "CUSTOMER":
+				remindCustomer(ctx, invoice, amountDue)
+			}
+		}
+	}
+}
+
+// remindCustomer emails the guest a payment reminder, or texts them when only a phone number is known
+func remindCustomer(ctx context.Context, invoice models.Invoice, amountDue string) {
+	var order models.Order
+	orderCollection.FindOne(ctx, bson.M{"order_id": invoice.Order_id}).Decode(&order)
+
+	body := fmt.Sprintf("Friendly reminder: invoice %s for %s was due on %s. Please settle it at your earliest convenience.", invoice.Invoice_number, amountDue, invoice.Payment_due_date.Format("2006-01-02"))
+	switch {
+	case invoice.Customer_email != nil:
+		queueMessage(ctx, "EMAIL", *invoice.Customer_email, "Payment reminder for invoice "+invoice.Invoice_number, body, "INVOICE_OVERDUE", invoice.Invoice_id)
+	case order.Customer_email != nil:
+		queueMessage(ctx, "EMAIL", *order.Customer_email, "Payment reminder for invoice "+invoice.Invoice_number, body, "INVOICE_OVERDUE", invoice.Invoice_id)
+	case order.Customer_phone != nil:
+		queueMessage(ctx, "SMS", *order.Customer_phone, "", body, "INVOICE_OVERDUE", invoice.Invoice_id)
+	}
+}
@@ -0,0 +1,288 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// parquetKind is the type of a Parquet column
+type parquetKind int
+
+const (
+	parquetString parquetKind = iota
+	parquetInt64
+	parquetDouble
+	parquetBoolean
+	parquetTimestamp
+)
+
+// parquetColumn is an optional column of a Parquet file
+type parquetColumn struct {
+	name string
+	kind parquetKind
+}
+
+// Parquet physical types, converted types and encodings, as numbered in the format's Thrift definitions
+const (
+	parquetTypeBoolean   = 0
+	parquetTypeInt64     = 2
+	parquetTypeDouble    = 5
+	parquetTypeByteArray = 6
+
+	parquetConvertedUTF8            = 0
+	parquetConvertedTimestampMillis = 9
+
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+)
+
+// thriftWriter encodes the Parquet page headers and footer with the Thrift compact protocol
+type thriftWriter struct {
+	buf bytes.Buffer
+	// last holds the id of the last field written of every struct being written, as field ids are
+	// encoded as the difference to the previous one
+	last []int16
+}
+
+// Thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{last: []int16{0}}
+}
+
+func (w *thriftWriter) varint(value uint64) {
+	for value >= 0x80 {
+		w.buf.WriteByte(byte(value) | 0x80)
+		value >>= 7
+	}
+	w.buf.WriteByte(byte(value))
+}
+
+func (w *thriftWriter) zigzag(value int64) {
+	w.varint(uint64((value << 1) ^ (value >> 63)))
+}
+
+func (w *thriftWriter) field(id int16, kind byte) {
+	last := w.last[len(w.last)-1]
+	if delta := id - last; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | kind)
+	} else {
+		w.buf.WriteByte(kind)
+		w.zigzag(int64(id))
+	}
+	w.last[len(w.last)-1] = id
+}
+
+func (w *thriftWriter) i32(id int16, value int32) {
+	w.field(id, thriftI32)
+	w.zigzag(int64(value))
+}
+
+func (w *thriftWriter) i64(id int16, value int64) {
+	w.field(id, thriftI64)
+	w.zigzag(value)
+}
+
+func (w *thriftWriter) binary(id int16, value string) {
+	w.field(id, thriftBinary)
+	w.str(value)
+}
+
+// str writes a string list element
+func (w *thriftWriter) str(value string) {
+	w.varint(uint64(len(value)))
+	w.buf.WriteString(value)
+}
+
+func (w *thriftWriter) list(id int16, kind byte, size int) {
+	w.field(id, thriftList)
+	if size < 15 {
+		w.buf.WriteByte(byte(size)<<4 | kind)
+	} else {
+		w.buf.WriteByte(0xf0 | kind)
+		w.varint(uint64(size))
+	}
+}
+
+// begin starts a struct field; list elements that are structs are started with begin(0)
+func (w *thriftWriter) begin(id int16) {
+	if id != 0 {
+		w.field(id, thriftStruct)
+	}
+	w.last = append(w.last, 0)
+}
+
+// end ends the struct being written
+func (w *thriftWriter) end() {
+	w.buf.WriteByte(0)
+	w.last = w.last[:len(w.last)-1]
+}
+
+// parquetChunk is a column written to the file, for the footer
+type parquetChunk struct {
+	column parquetColumn
+	offset int64
+	size   int64
+}
+
+// writeParquet writes rows as an uncompressed Parquet file with a single row group. Every column is
+// optional: a row's value for a column is nil or of the column's kind (string, int64, float64, bool or
+// time.Time).
+func writeParquet(columns []parquetColumn, rows [][]interface{}) []byte {
+	var file bytes.Buffer
+	file.WriteString("PAR1")
+
+	chunks := []parquetChunk{}
+	for i, column := range columns {
+		// Definition levels say which rows have a value: runs of 1s and 0s, RLE encoded with a bit width of 1
+		var levels, values bytes.Buffer
+		var booleans []bool
+		run, runLevel := 0, byte(0)
+		flush := func() {
+			if run > 0 {
+				writeUvarint(&levels, uint64(run)<<1)
+				levels.WriteByte(runLevel)
+			}
+		}
+		for _, row := range rows {
+			level := byte(0)
+			if row[i] != nil {
+				level = 1
+				switch value := row[i].(type) {
+				case string:
+					binary.Write(&values, binary.LittleEndian, uint32(len(value)))
+					values.WriteString(value)
+				case int64:
+					binary.Write(&values, binary.LittleEndian, value)
+				case float64:
+					binary.Write(&values, binary.LittleEndian, math.Float64bits(value))
+				case time.Time:
+					binary.Write(&values, binary.LittleEndian, value.UnixNano()/int64(time.Millisecond))
+				case bool:
+					booleans = append(booleans, value)
+				}
+			}
+			if level != runLevel && run > 0 {
+				flush()
+				run = 0
+			}
+			runLevel = level
+			run++
+		}
+		flush()
+		// Booleans are bit-packed, the first value in the lowest bit
+		for start := 0; start < len(booleans); start += 8 {
+			var packed byte
+			for bit := 0; bit < 8 && start+bit < len(booleans); bit++ {
+				if booleans[start+bit] {
+					packed |= 1 << uint(bit)
+				}
+			}
+			values.WriteByte(packed)
+		}
+
+		var page bytes.Buffer
+		binary.Write(&page, binary.LittleEndian, uint32(levels.Len()))
+		page.Write(levels.Bytes())
+		page.Write(values.Bytes())
+
+		header := newThriftWriter()
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(page.Len()))
+		header.i32(3, int32(page.Len()))
+		header.begin(5)
+		header.i32(1, int32(len(rows)))
+		header.i32(2, parquetEncodingPlain)
+		header.i32(3, parquetEncodingRLE)
+		header.i32(4, parquetEncodingRLE)
+		header.end()
+		header.end()
+
+		chunk := parquetChunk{column: column, offset: int64(file.Len()), size: int64(header.buf.Len() + page.Len())}
+		file.Write(header.buf.Bytes())
+		file.Write(page.Bytes())
+		chunks = append(chunks, chunk)
+	}
+
+	footer := newThriftWriter()
+	footer.i32(1, 1)
+	footer.list(2, thriftStruct, len(columns)+1)
+	footer.begin(0)
+	footer.binary(4, "schema")
+	footer.i32(5, int32(len(columns)))
+	footer.end()
+	for _, column := range columns {
+		footer.begin(0)
+		footer.i32(1, parquetPhysicalType(column.kind))
+		footer.i32(3, 1) // OPTIONAL
+		footer.binary(4, column.name)
+		switch column.kind {
+		case parquetString:
+			footer.i32(6, parquetConvertedUTF8)
+		case parquetTimestamp:
+			footer.i32(6, parquetConvertedTimestampMillis)
+		}
+		footer.end()
+	}
+	footer.i64(3, int64(len(rows)))
+	footer.list(4, thriftStruct, 1)
+	footer.begin(0)
+	footer.list(1, thriftStruct, len(chunks))
+	var total int64
+	for _, chunk := range chunks {
+		footer.begin(0)
+		footer.i64(2, chunk.offset)
+		footer.begin(3)
+		footer.i32(1, parquetPhysicalType(chunk.column.kind))
+		footer.list(2, thriftI32, 2)
+		footer.zigzag(parquetEncodingPlain)
+		footer.zigzag(parquetEncodingRLE)
+		footer.list(3, thriftBinary, 1)
+		footer.str(chunk.column.name)
+		footer.i32(4, 0) // UNCOMPRESSED
+		footer.i64(5, int64(len(rows)))
+		footer.i64(6, chunk.size)
+		footer.i64(7, chunk.size)
+		footer.i64(9, chunk.offset)
+		footer.end()
+		footer.end()
+		total += chunk.size
+	}
+	footer.i64(2, total)
+	footer.i64(3, int64(len(rows)))
+	footer.end()
+	footer.binary(6, "golang-restaurant-management")
+	footer.end()
+
+	file.Write(footer.buf.Bytes())
+	binary.Write(&file, binary.LittleEndian, uint32(footer.buf.Len()))
+	file.WriteString("PAR1")
+	return file.Bytes()
+}
+
+func parquetPhysicalType(kind parquetKind) int32 {
+	switch kind {
+	case parquetInt64, parquetTimestamp:
+		return parquetTypeInt64
+	case parquetDouble:
+		return parquetTypeDouble
+	case parquetBoolean:
+		return parquetTypeBoolean
+	default:
+		return parquetTypeByteArray
+	}
+}
+
+func writeUvarint(buf *bytes.Buffer, value uint64) {
+	var encoded [binary.MaxVarintLen64]byte
+	buf.Write(encoded[:binary.PutUvarint(encoded[:], value)])
+}
@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/database"
+	helper "golang-restaurant-management/helpers"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var passwordResetCollection *mongo.Collection = database.OpenCollection(database.Client, "passwordReset")
+
+type PasswordResetRequest struct {
+	Email *string `json:"email" validate:"required,email"`
+}
+
+type PasswordResetConfirmation struct {
+	Token    *string `json:"token" validate:"required"`
+	Password *string `json:"password" validate:"required,min=6"`
+}
+
+// sendWelcomeEmail emails a new user. Emails are best effort: a failure is logged and the signup stands.
+func sendWelcomeEmail(ctx context.Context, user models.User) {
+	if user.Email == nil {
+		return
+	}
+	view := welcomeEmailView{First_name: *user.First_name}
+	if _, err := queueTemplatedEmail(ctx, *user.Email, "welcome", view, "WELCOME", user.User_id); err != nil {
+		log.Println("failed to queue the welcome email:", err)
+	}
+}
+
+// passwordResetLink returns the link a user resets their password with: PASSWORD_RESET_URL (the page
+// of the staff app asking for the new password, default PUBLIC_BASE_URL/reset-password) with the token
+func passwordResetLink(token string) string {
+	resetUrl := os.Getenv("PASSWORD_RESET_URL")
+	if resetUrl == "" {
+		baseUrl := os.Getenv("PUBLIC_BASE_URL")
+		if baseUrl == "" {
+			baseUrl = "http://localhost:8000"
+		}
+		resetUrl = baseUrl + "/reset-password"
+	}
+	return resetUrl + "?token=" + url.QueryEscape(token)
+}
+
+// RequestPasswordReset emails a password reset link to a user. The answer is the same whether or not
+// the address belongs to a user, so the endpoint cannot be used to find accounts. A user gets at most
+// 3 links an hour; links expire after PASSWORD_RESET_TTL_MINUTES (default 60).
+func RequestPasswordReset() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request PasswordResetRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		accepted := gin.H{"message": "if the address belongs to an account, a reset link has been sent to it"}
+
+		var user models.User
+		err := userCollection.FindOne(ctx, bson.M{"email": *request.Email}).Decode(&user)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusAccepted, accepted)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while requesting the reset"})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		recent, err := passwordResetCollection.CountDocuments(ctx, bson.M{"user_id": user.User_id, "created_at": bson.M{"$gt": now.Add(-time.Hour)}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while requesting the reset"})
+			return
+		}
+		if recent >= 3 {
+			c.JSON(http.StatusAccepted, accepted)
+			return
+		}
+
+		token, err := helper.RandomToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while requesting the reset"})
+			return
+		}
+		ttl := envInt("PASSWORD_RESET_TTL_MINUTES", 60)
+
+		var reset models.PasswordReset
+		reset.ID = primitive.NewObjectID()
+		reset.Reset_id = reset.ID.Hex()
+		reset.User_id = user.User_id
+		reset.Token_hash = sha256Hex([]byte(token))
+		reset.Expires_at = now.Add(time.Duration(ttl) * time.Minute)
+		reset.Created_at = now
+		if _, err := passwordResetCollection.InsertOne(ctx, reset); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while requesting the reset"})
+			return
+		}
+
+		view := passwordResetEmailView{First_name: *user.First_name, Reset_url: passwordResetLink(token), Expires_minutes: ttl}
+		if _, err := queueTemplatedEmail(ctx, *user.Email, "password_reset", view, "PASSWORD_RESET", reset.Reset_id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while sending the reset link"})
+			return
+		}
+		c.JSON(http.StatusAccepted, accepted)
+	}
+}
+
+// ResetPassword sets a new password with the token of a reset link. The token can only be used once,
+// and the user's other reset links stop working.
+func ResetPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request PasswordResetConfirmation
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		// Marking the reset used is the check, so a token cannot be used twice at the same time
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		var reset models.PasswordReset
+		err := passwordResetCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"token_hash": sha256Hex([]byte(*request.Token)), "used_at": nil, "expires_at": bson.M{"$gt": now}},
+			bson.D{{"$set", bson.D{{"used_at", now}}}},
+		).Decode(&reset)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the reset link is invalid or has expired, request a new one"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while resetting the password"})
+			return
+		}
+
+		password := HashPassword(*request.Password)
+		result, err := userCollection.UpdateOne(
+			ctx,
+			bson.M{"user_id": reset.User_id},
+			bson.D{{"$set", bson.D{{"password", password}, {"updated_at", now}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while resetting the password"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the reset link is invalid or has expired, request a new one"})
+			return
+		}
+
+		if _, err := passwordResetCollection.UpdateMany(ctx, bson.M{"user_id": reset.User_id, "used_at": nil}, bson.D{{"$set", bson.D{{"used_at", now}}}}); err != nil {
+			log.Println("failed to expire the other password reset links:", err)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "the password has been reset, sign in with the new password"})
+	}
+}
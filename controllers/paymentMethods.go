@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultPaymentMethods are offered until payment methods are configured in the settings
+var defaultPaymentMethods = []models.PaymentMethod{
+	{Code: "CARD", Name: "Card", Type: "CARD"},
+	{Code: "CASH", Name: "Cash", Type: "CASH"},
+}
+
+// systemPaymentMethods are recorded by their own endpoints (gift card redemption, room charges)
+// and are always valid on invoices, whatever the configured methods
+var systemPaymentMethods = map[string]bool{
+	"GIFT_CARD":   true,
+	"ROOM_CHARGE": true,
+}
+
+// settingsPaymentMethods returns the configured payment methods, or the defaults
+func settingsPaymentMethods(settings models.Settings) []models.PaymentMethod {
+	if len(settings.Payment_methods) == 0 {
+		return defaultPaymentMethods
+	}
+	return settings.Payment_methods
+}
+
+// paymentDetail returns the payment detail with the given name, or nil when it was not recorded
+func paymentDetail(details *models.PaymentDetails, name string) *string {
+	if details == nil {
+		return nil
+	}
+	switch name {
+	case "transaction_id":
+		return details.Transaction_id
+	case "card_last_four":
+		return details.Card_last_four
+	case "provider":
+		return details.Provider
+	case "account_reference":
+		return details.Account_reference
+	}
+	return nil
+}
+
+// checkPaymentMethod verifies that an invoice's payment method is one of the restaurant's enabled
+// payment methods and that the details it requires were recorded. An empty method is accepted.
+func checkPaymentMethod(ctx context.Context, method *string, details *models.PaymentDetails) error {
+	if details != nil {
+		if err := validate.Struct(details); err != nil {
+			return err
+		}
+	}
+	if method == nil || *method == "" || systemPaymentMethods[*method] {
+		return nil
+	}
+
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		return err
+	}
+	for _, paymentMethod := range settingsPaymentMethods(settings) {
+		if paymentMethod.Code != *method {
+			continue
+		}
+		if paymentMethod.Disabled {
+			return fmt.Errorf("payment method %s is disabled", *method)
+		}
+		var missing []string
+		for _, name := range paymentMethod.Required_details {
+			if value := paymentDetail(details, name); value == nil || strings.TrimSpace(*value) == "" {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("payment method %s requires payment_details %s", *method, strings.Join(missing, ", "))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown payment method %s", *method)
+}
+
+// GetPaymentMethods lists the payment methods that can be chosen when paying an invoice
+func GetPaymentMethods() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		settings, err := loadSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the settings"})
+			return
+		}
+
+		enabled := []models.PaymentMethod{}
+		for _, paymentMethod := range settingsPaymentMethods(settings) {
+			if !paymentMethod.Disabled {
+				enabled = append(enabled, paymentMethod)
+			}
+		}
+		c.JSON(http.StatusOK, enabled)
+	}
+}
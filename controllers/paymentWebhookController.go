@@ -0,0 +1,363 @@
+package controller
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var paymentEventCollection *mongo.Collection = database.OpenCollection(database.Client, "paymentEvent")
+
+// paymentWebhookTolerance is how old a signed webhook timestamp may be before the request is
+// rejected, protecting against replayed deliveries
+const paymentWebhookTolerance = 5 * time.Minute
+
+type paymentWebhookEvent struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Invoice_id    string       `json:"invoice_id"`
+		Prepayment_id string       `json:"prepayment_id"`
+		Charge_id     string       `json:"charge_id"`
+		Refund_id     string       `json:"refund_id"`
+		Amount        models.Money `json:"amount"`
+	} `json:"data"`
+}
+
+// PaymentWebhook receives asynchronous payment notifications from the payment provider.
+// Requests must carry an X-Payment-Signature header of the form "t=<unix time>,v1=<hex>",
+// where v1 is the HMAC-SHA256 of "<unix time>.<raw body>" keyed with PAYMENT_WEBHOOK_SECRET.
+func PaymentWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "could not read request body"})
+			return
+		}
+
+		if err := verifyPaymentSignature(c.GetHeader("X-Payment-Signature"), body, time.Now()); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		var event paymentWebhookEvent
+		if err := json.Unmarshal(body, &event); err != nil || event.Id == "" || event.Type == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event payload"})
+			return
+		}
+
+		var stored models.PaymentEvent
+		stored.ID = primitive.NewObjectID()
+		stored.Event_id = event.Id
+		stored.Type = event.Type
+		stored.Invoice_id = event.Data.Invoice_id
+		stored.Prepayment_id = event.Data.Prepayment_id
+		stored.Payload = string(body)
+		stored.Status = "RECEIVED"
+		stored.Received_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		// The unique index on event_id makes the insert the idempotency check: a redelivered
+		// event is only processed again when the previous attempt failed
+		if _, err := paymentEventCollection.InsertOne(ctx, stored); err != nil {
+			if !mongo.IsDuplicateKeyError(err) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "event could not be stored"})
+				return
+			}
+			var existing models.PaymentEvent
+			filter := bson.M{"event_id": event.Id, "status": "FAILED"}
+			update := bson.D{{"$set", bson.D{{"status", "RECEIVED"}}}}
+			if err := paymentEventCollection.FindOneAndUpdate(ctx, filter, update).Decode(&existing); err != nil {
+				c.JSON(http.StatusOK, gin.H{"event_id": event.Id, "status": "DUPLICATE"})
+				return
+			}
+		}
+
+		status, processErr := processPaymentEvent(ctx, event)
+
+		processedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		set := bson.D{{"status", status}, {"processed_at", processedAt}, {"error", nil}}
+		if processErr != nil {
+			message := processErr.Error()
+			set = bson.D{{"status", status}, {"processed_at", processedAt}, {"error", message}}
+		}
+		if _, err := paymentEventCollection.UpdateOne(ctx, bson.M{"event_id": event.Id}, bson.D{{"$set", set}}); err != nil {
+			log.Println("failed to update payment event:", err)
+		}
+
+		if processErr != nil {
+			// A non-2xx answer makes the provider retry the delivery later
+			c.JSON(http.StatusInternalServerError, gin.H{"error": processErr.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"event_id": event.Id, "status": status})
+	}
+}
+
+// verifyPaymentSignature checks the provider's signature header against the raw request body
+func verifyPaymentSignature(header string, body []byte, now time.Time) error {
+	secret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if secret == "" {
+		return errors.New("payment webhooks are not configured")
+	}
+	return verifyWebhookSignature(secret, header, body, now)
+}
+
+// verifyWebhookSignature checks a "t=<unix time>,v1=<hex>" signature header, where v1 is the
+// HMAC-SHA256 of "<unix time>.<raw body>" keyed with secret
+func verifyWebhookSignature(secret string, header string, body []byte, now time.Time) error {
+
+	var timestamp, signature string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signature = kv[1]
+		}
+	}
+	if timestamp == "" || signature == "" {
+		return errors.New("missing webhook signature")
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || math.Abs(now.Sub(time.Unix(unix, 0)).Seconds()) > paymentWebhookTolerance.Seconds() {
+		return errors.New("webhook signature timestamp is outside the allowed tolerance")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("invalid webhook signature")
+	}
+	return nil
+}
+
+// processPaymentEvent applies a webhook event to its invoice, or to its reservation deposit, and returns
+// the event's final status
+func processPaymentEvent(ctx context.Context, event paymentWebhookEvent) (string, error) {
+	if event.Type != "charge.succeeded" && event.Type != "charge.refunded" {
+		return "IGNORED", nil
+	}
+	if event.Data.Prepayment_id != "" {
+		return processDepositPaymentEvent(ctx, event)
+	}
+
+	var invoice models.Invoice
+	if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": event.Data.Invoice_id}).Decode(&invoice); err != nil {
+		return "FAILED", errors.New("invoice was not found")
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	switch event.Type {
+	case "charge.succeeded":
+		return processInvoiceCharge(ctx, invoice, event, now)
+	case "charge.refunded":
+		return processInvoiceRefund(ctx, invoice, event)
+	}
+	return "PROCESSED", nil
+}
+
+// processInvoiceCharge records a card charge on a PENDING invoice and settles the invoice once the
+// charges cover the amount due; a charge short of it is recorded without settling. Charges for invoices
+// that were paid otherwise, split, refunded or voided have to be refunded by hand; their events are kept
+// as FAILED for follow-up.
+func processInvoiceCharge(ctx context.Context, invoice models.Invoice, event paymentWebhookEvent, now time.Time) (string, error) {
+	status := invoicePaymentStatus(invoice)
+	if status == "PAID" && invoice.Payment_reference != nil && *invoice.Payment_reference == event.Data.Charge_id {
+		return "PROCESSED", nil
+	}
+	if status != "PENDING" {
+		return "FAILED", fmt.Errorf("a charge was received for a %s invoice", status)
+	}
+	if event.Data.Charge_id == "" || event.Data.Amount <= 0 {
+		return "FAILED", errors.New("the charge has no id or amount")
+	}
+
+	// The charge id condition records a redelivered charge only once
+	charge := models.CardCharge{Charge_id: event.Data.Charge_id, Amount: event.Data.Amount, Charged_at: now}
+	err := invoiceCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"invoice_id": invoice.Invoice_id, "payment_status": "PENDING", "card_charges.charge_id": bson.M{"$ne": charge.Charge_id}},
+		bson.D{
+			{"$push", bson.D{{"card_charges", charge}}},
+			{"$inc", bson.D{{"charged_amount", charge.Amount}}},
+			{"$set", bson.D{{"updated_at", now}}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&invoice)
+	if err == mongo.ErrNoDocuments {
+		if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoice.Invoice_id}).Decode(&invoice); err != nil {
+			return "FAILED", err
+		}
+		if invoicePaymentStatus(invoice) != "PENDING" {
+			return "FAILED", fmt.Errorf("a charge was received for a %s invoice", invoicePaymentStatus(invoice))
+		}
+	} else if err != nil {
+		return "FAILED", err
+	}
+
+	if invoice.Charged_amount < invoiceAmountDue(invoice) {
+		log.Println("invoice", invoice.Invoice_id, "was charged", invoice.Charged_amount, "of", invoiceAmountDue(invoice), "due")
+		return "PROCESSED", nil
+	}
+	result, err := invoiceCollection.UpdateOne(
+		ctx,
+		bson.M{"invoice_id": invoice.Invoice_id, "payment_status": "PENDING"},
+		bson.D{{"$set", bson.D{
+			{"payment_status", "PAID"},
+			{"payment_method", "CARD"},
+			{"payment_reference", charge.Charge_id},
+			{"paid_at", now},
+			{"invoice_status", "FINALIZED"},
+			{"updated_at", now},
+		}}},
+	)
+	if err != nil {
+		return "FAILED", err
+	}
+	if result.MatchedCount > 0 {
+		closeInvoiceOrdersIfSettled(ctx, invoice, "system")
+	}
+	return "PROCESSED", nil
+}
+
+// processInvoiceRefund issues a credit note for a refund made at the payment provider, capped at what is
+// left to refund, unless the refund was already credited: a credit note with its refund id, or one issued
+// from the API for the same amount without a refund id, which is then matched to it.
+func processInvoiceRefund(ctx context.Context, invoice models.Invoice, event paymentWebhookEvent) (string, error) {
+	refundId := event.Data.Refund_id
+	if refundId == "" {
+		refundId = event.Id
+	}
+	if creditNoteCollection.FindOne(ctx, bson.M{"provider_refund_id": refundId}).Err() == nil {
+		return "PROCESSED", nil
+	}
+
+	remaining := invoice.Grand_total - invoice.Refunded_amount
+	amount := event.Data.Amount
+	if amount <= 0 || amount > remaining {
+		amount = remaining
+	}
+	matched, err := creditNoteCollection.UpdateOne(
+		ctx,
+		bson.M{"invoice_id": invoice.Invoice_id, "provider_refund_id": nil, "total": bson.M{"$in": bson.A{event.Data.Amount, amount}}},
+		bson.D{{"$set", bson.D{{"provider_refund_id", refundId}}}},
+	)
+	if err != nil {
+		return "FAILED", err
+	}
+	if matched.ModifiedCount > 0 {
+		return "PROCESSED", nil
+	}
+
+	if invoicePaymentStatus(invoice) != "PAID" || amount <= 0 {
+		return "FAILED", fmt.Errorf("a refund was received for a %s invoice with %s left to refund", invoicePaymentStatus(invoice), remaining)
+	}
+
+	var creditNote models.CreditNote
+	reason := "refunded at the payment provider"
+	if amount == remaining {
+		creditNote, err = buildCreditNote(ctx, invoice, RefundRequest{Type: "FULL", Reason: reason})
+		if err != nil {
+			return "FAILED", err
+		}
+	} else {
+		creditNote = amountCreditNote(invoice, amount, reason)
+	}
+	creditNote.Provider_refund_id = &refundId
+	creditNote.Authorized_by = "system"
+
+	// A conflict fails the event, so the provider delivers it again and it is based on the new balance
+	if err := issueCreditNote(ctx, invoice, &creditNote); err != nil {
+		return "FAILED", err
+	}
+	return "PROCESSED", nil
+}
+
+// processDepositPaymentEvent applies a webhook event to a reservation deposit paid online: a successful
+// charge makes the PENDING deposit HELD, a refund records the amount given back
+func processDepositPaymentEvent(ctx context.Context, event paymentWebhookEvent) (string, error) {
+	var prepayment models.Prepayment
+	if err := prepaymentCollection.FindOne(ctx, bson.M{"prepayment_id": event.Data.Prepayment_id}).Decode(&prepayment); err != nil {
+		return "FAILED", errors.New("prepayment was not found")
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	switch event.Type {
+	case "charge.succeeded":
+		if prepayment.Status != "PENDING" && prepayment.Status != "CANCELLED" {
+			return "PROCESSED", nil
+		}
+		// A charge for a reservation that already ended has to be refunded by hand; the event is kept as FAILED for follow-up
+		if prepayment.Status == "CANCELLED" {
+			return "FAILED", errors.New("the reservation of the deposit has ended")
+		}
+		_, err := prepaymentCollection.UpdateOne(
+			ctx,
+			bson.M{"prepayment_id": prepayment.Prepayment_id, "status": "PENDING"},
+			bson.D{{"$set", bson.D{
+				{"status", "HELD"},
+				{"payment_reference", event.Data.Charge_id},
+				{"paid_at", now},
+				{"updated_at", now},
+			}}},
+		)
+		if err != nil {
+			return "FAILED", err
+		}
+
+	case "charge.refunded":
+		// Refunds owed by the deposit policy were recorded when the deposit was settled
+		if prepayment.Status == "REFUNDED" || (prepayment.Status == "FORFEITED" && prepayment.Refunded_amount > 0) {
+			return "PROCESSED", nil
+		}
+		refundable := prepayment.Amount - prepayment.Applied_amount - prepayment.Refunded_amount
+		amount := event.Data.Amount
+		if amount <= 0 || amount > refundable {
+			amount = refundable
+		}
+
+		// As with refunds made from the API, an applied deposit stays APPLIED
+		set := bson.D{{"refunded_amount", prepayment.Refunded_amount + amount}, {"updated_at", now}}
+		if prepayment.Status != "APPLIED" {
+			set = append(set, bson.E{"status", "REFUNDED"}, bson.E{"settled_by", "system"}, bson.E{"settled_at", now})
+		}
+		_, err := prepaymentCollection.UpdateOne(ctx, bson.M{"prepayment_id": prepayment.Prepayment_id}, bson.D{{"$set", set}})
+		if err != nil {
+			return "FAILED", err
+		}
+	}
+	return "PROCESSED", nil
+}
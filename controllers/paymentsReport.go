@@ -0,0 +1,313 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// reportPaymentMethods name the payment methods that are not configured in the settings: the system methods,
+// reservation deposits credited on invoices and paid invoices without a recorded method
+var reportPaymentMethods = map[string]models.PaymentMethod{
+	"GIFT_CARD":   {Code: "GIFT_CARD", Name: "Gift card", Type: "OTHER"},
+	"ROOM_CHARGE": {Code: "ROOM_CHARGE", Name: "Room charge", Type: "HOUSE_ACCOUNT"},
+	"DEPOSIT":     {Code: "DEPOSIT", Name: "Reservation deposit", Type: "OTHER"},
+	"UNSPECIFIED": {Code: "UNSPECIFIED", Name: "Not recorded", Type: "OTHER"},
+}
+
+type PaymentMethodTotal struct {
+	Method    string       `json:"method"`
+	Name      string       `json:"name"`
+	Type      string       `json:"type"`
+	Payments  int          `json:"payments"`
+	Collected models.Money `json:"collected"`
+	Refunds   int          `json:"refunds"`
+	Refunded  models.Money `json:"refunded"`
+	Net       models.Money `json:"net"`
+}
+
+// add adds the figures of another day or method
+func (total *PaymentMethodTotal) add(other PaymentMethodTotal) {
+	total.Payments += other.Payments
+	total.Collected += other.Collected
+	total.Refunds += other.Refunds
+	total.Refunded += other.Refunded
+	total.Net = total.Collected - total.Refunded
+}
+
+// CashClose reconciles the cash collected on a day against the drawers closed that day
+type CashClose struct {
+	Cash_collected    models.Money `json:"cash_collected" bson:"-"`
+	Sessions_closed   int          `json:"sessions_closed" bson:"sessions_closed"`
+	Sessions_open     int          `json:"sessions_open" bson:"sessions_open"`
+	Drawer_cash_sales models.Money `json:"drawer_cash_sales" bson:"drawer_cash_sales"`
+	Expected_cash     models.Money `json:"expected_cash" bson:"expected_cash"`
+	Counted_cash      models.Money `json:"counted_cash" bson:"counted_cash"`
+	Over_short        models.Money `json:"over_short" bson:"over_short"`
+	Unreconciled      models.Money `json:"unreconciled" bson:"-"`
+}
+
+// add adds the figures of another day
+func (cashClose *CashClose) add(other CashClose) {
+	cashClose.Cash_collected += other.Cash_collected
+	cashClose.Sessions_closed += other.Sessions_closed
+	cashClose.Sessions_open += other.Sessions_open
+	cashClose.Drawer_cash_sales += other.Drawer_cash_sales
+	cashClose.Expected_cash += other.Expected_cash
+	cashClose.Counted_cash += other.Counted_cash
+	cashClose.Over_short += other.Over_short
+	cashClose.Unreconciled = cashClose.Cash_collected - cashClose.Drawer_cash_sales
+}
+
+type PaymentDay struct {
+	Day        string               `json:"day"`
+	Collected  models.Money         `json:"collected"`
+	Refunded   models.Money         `json:"refunded"`
+	Net        models.Money         `json:"net"`
+	Methods    []PaymentMethodTotal `json:"methods"`
+	Cash_close CashClose            `json:"cash_close"`
+}
+
+type PaymentsReport struct {
+	From        time.Time            `json:"from"`
+	To          time.Time            `json:"to"`
+	Location_id *string              `json:"location_id"`
+	Collected   models.Money         `json:"collected"`
+	Refunded    models.Money         `json:"refunded"`
+	Net         models.Money         `json:"net"`
+	Methods     []PaymentMethodTotal `json:"methods"`
+	Cash_close  CashClose            `json:"cash_close"`
+	Days        []PaymentDay         `json:"days"`
+}
+
+// paymentRow is the output of the pipelines grouping payments and refunds by business day and method
+type paymentRow struct {
+	Id struct {
+		Day    string  `bson:"day"`
+		Method *string `bson:"method"`
+	} `bson:"_id"`
+	Payments           int          `bson:"payments"`
+	Collected          models.Money `bson:"collected"`
+	Gift_card_payments int          `bson:"gift_card_payments"`
+	Gift_cards         models.Money `bson:"gift_cards"`
+	Deposit_payments   int          `bson:"deposit_payments"`
+	Deposits           models.Money `bson:"deposits"`
+	Refunds            int          `bson:"refunds"`
+	Refunded           models.Money `bson:"refunded"`
+}
+
+// aggregatePaymentRows runs a pipeline whose output are payment rows
+func aggregatePaymentRows(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline) ([]paymentRow, error) {
+	result, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rows []paymentRow
+	err = result.All(ctx, &rows)
+	return rows, err
+}
+
+// GetPaymentsReport reports the amounts collected and refunded per payment method and business day over
+// a period: the optional from/to query parameters (RFC3339), by default the last 30 days, optionally of one
+// location. Invoices count for the day they were paid, for their amount due under their payment method and
+// for the gift cards and deposits credited on them; refunds count for the day of their credit note, under
+// the payment method of the refunded invoice. Each day's cash payments are reconciled against the cash
+// drawers closed that day: unreconciled is the cash collected less the cash sales counted by the drawers.
+func GetPaymentsReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		from, to, err := reportPeriod(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		settings, err := loadSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the settings"})
+			return
+		}
+		startHour := defaultBusinessDayStartHour
+		if settings.Business_day_start_hour != nil {
+			startHour = *settings.Business_day_start_hour
+		}
+		now := time.Now()
+		format := salesPeriodFormats["day"]
+
+		report := PaymentsReport{From: from, To: to, Methods: []PaymentMethodTotal{}, Days: []PaymentDay{}}
+		period := bson.D{{"$gte", from}, {"$lt", to}}
+		invoiceMatch := bson.D{{"paid_at", period}, {"payment_status", bson.D{{"$in", bson.A{"PAID", "REFUNDED"}}}}}
+		refundPipeline := mongo.Pipeline{
+			bson.D{{"$match", bson.D{{"created_at", period}}}},
+			bson.D{{"$lookup", bson.D{{"from", "invoice"}, {"localField", "invoice_id"}, {"foreignField", "invoice_id"}, {"as", "invoice"}}}},
+		}
+		sessionMatch := bson.D{{"$or", bson.A{
+			bson.D{{"status", "CLOSED"}, {"closed_at", period}},
+			bson.D{{"status", "OPEN"}, {"opened_at", period}},
+		}}}
+		if locationId := c.Query("location_id"); locationId != "" {
+			report.Location_id = &locationId
+			invoiceMatch = append(invoiceMatch, bson.E{"location_id", locationId})
+			// Credit notes have no location of their own, so they are filtered by their invoice's
+			refundPipeline = append(refundPipeline, bson.D{{"$match", bson.D{{"invoice.location_id", locationId}}}})
+			sessionMatch = append(sessionMatch, bson.E{"location_id", locationId})
+		}
+
+		amountDue := bson.D{{"$subtract", bson.A{"$grand_total", bson.D{{"$add", bson.A{
+			bson.D{{"$ifNull", bson.A{"$gift_card_total", 0}}},
+			bson.D{{"$ifNull", bson.A{"$deposit_total", 0}}},
+		}}}}}}
+		countPositive := func(value interface{}) bson.D {
+			return bson.D{{"$sum", bson.D{{"$cond", bson.A{bson.D{{"$gt", bson.A{value, 0}}}, 1, 0}}}}}
+		}
+		payments, err := aggregatePaymentRows(ctx, invoiceCollection, mongo.Pipeline{
+			bson.D{{"$match", invoiceMatch}},
+			bson.D{{"$group", bson.D{
+				{"_id", bson.D{{"day", salesPeriodKey("paid_at", format, startHour, now)}, {"method", "$payment_method"}}},
+				{"payments", countPositive(amountDue)},
+				{"collected", bson.D{{"$sum", amountDue}}},
+				{"gift_card_payments", countPositive(bson.D{{"$ifNull", bson.A{"$gift_card_total", 0}}})},
+				{"gift_cards", bson.D{{"$sum", bson.D{{"$ifNull", bson.A{"$gift_card_total", 0}}}}}},
+				{"deposit_payments", countPositive(bson.D{{"$ifNull", bson.A{"$deposit_total", 0}}})},
+				{"deposits", bson.D{{"$sum", bson.D{{"$ifNull", bson.A{"$deposit_total", 0}}}}}},
+			}}},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating payments"})
+			return
+		}
+
+		refundPipeline = append(refundPipeline, bson.D{{"$group", bson.D{
+			{"_id", bson.D{
+				{"day", salesPeriodKey("created_at", format, startHour, now)},
+				{"method", bson.D{{"$arrayElemAt", bson.A{"$invoice.payment_method", 0}}}},
+			}},
+			{"refunds", bson.D{{"$sum", 1}}},
+			{"refunded", bson.D{{"$sum", "$total"}}},
+		}}})
+		refunds, err := aggregatePaymentRows(ctx, creditNoteCollection, refundPipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating refunds"})
+			return
+		}
+
+		// Open drawers count for the day they were opened, closed ones for the day they were closed
+		result, err := cashSessionCollection.Aggregate(ctx, mongo.Pipeline{
+			bson.D{{"$match", sessionMatch}},
+			bson.D{{"$addFields", bson.D{{"day_at", bson.D{{"$ifNull", bson.A{"$closed_at", "$opened_at"}}}}}}},
+			bson.D{{"$group", bson.D{
+				{"_id", salesPeriodKey("day_at", format, startHour, now)},
+				{"sessions_closed", bson.D{{"$sum", bson.D{{"$cond", bson.A{bson.D{{"$eq", bson.A{"$status", "CLOSED"}}}, 1, 0}}}}}},
+				{"sessions_open", bson.D{{"$sum", bson.D{{"$cond", bson.A{bson.D{{"$eq", bson.A{"$status", "OPEN"}}}, 1, 0}}}}}},
+				{"drawer_cash_sales", bson.D{{"$sum", "$cash_sales"}}},
+				{"expected_cash", bson.D{{"$sum", "$expected_cash"}}},
+				{"counted_cash", bson.D{{"$sum", bson.D{{"$ifNull", bson.A{"$counted_cash", 0}}}}}},
+				{"over_short", bson.D{{"$sum", "$over_short"}}},
+			}}},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while reconciling the cash drawers"})
+			return
+		}
+		var closes []struct {
+			Day       string `bson:"_id"`
+			CashClose `bson:",inline"`
+		}
+		if err = result.All(ctx, &closes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while reconciling the cash drawers"})
+			return
+		}
+
+		methods := map[string]models.PaymentMethod{}
+		for code, method := range reportPaymentMethods {
+			methods[code] = method
+		}
+		for _, method := range settingsPaymentMethods(settings) {
+			methods[method.Code] = method
+		}
+
+		days := map[string]*PaymentDay{}
+		dayOf := func(key string) *PaymentDay {
+			day, ok := days[key]
+			if !ok {
+				day = &PaymentDay{Day: key, Methods: []PaymentMethodTotal{}}
+				days[key] = day
+			}
+			return day
+		}
+		record := func(key string, code string, figures PaymentMethodTotal) {
+			if figures.Payments == 0 && figures.Refunds == 0 {
+				return
+			}
+			method, ok := methods[code]
+			if !ok {
+				method = models.PaymentMethod{Code: code, Name: code, Type: "OTHER"}
+			}
+			figures.Method, figures.Name, figures.Type = method.Code, method.Name, method.Type
+			figures.Net = figures.Collected - figures.Refunded
+
+			day := dayOf(key)
+			found := false
+			for i := range day.Methods {
+				if day.Methods[i].Method == figures.Method {
+					day.Methods[i].add(figures)
+					found = true
+					break
+				}
+			}
+			if !found {
+				day.Methods = append(day.Methods, figures)
+			}
+			day.Collected += figures.Collected
+			day.Refunded += figures.Refunded
+			day.Net = day.Collected - day.Refunded
+			if isCashPayment(settings, figures.Method) {
+				day.Cash_close.Cash_collected += figures.Collected
+			}
+		}
+		for _, row := range append(payments, refunds...) {
+			code := "UNSPECIFIED"
+			if row.Id.Method != nil && *row.Id.Method != "" {
+				code = *row.Id.Method
+			}
+			record(row.Id.Day, code, PaymentMethodTotal{Payments: row.Payments, Collected: row.Collected, Refunds: row.Refunds, Refunded: row.Refunded})
+			record(row.Id.Day, "GIFT_CARD", PaymentMethodTotal{Payments: row.Gift_card_payments, Collected: row.Gift_cards})
+			record(row.Id.Day, "DEPOSIT", PaymentMethodTotal{Payments: row.Deposit_payments, Collected: row.Deposits})
+		}
+		for _, row := range closes {
+			day := dayOf(row.Day)
+			row.CashClose.Cash_collected = day.Cash_close.Cash_collected
+			day.Cash_close = row.CashClose
+		}
+
+		totals := map[string]int{}
+		for _, day := range days {
+			day.Cash_close.Unreconciled = day.Cash_close.Cash_collected - day.Cash_close.Drawer_cash_sales
+			sort.Slice(day.Methods, func(i, j int) bool { return day.Methods[i].Collected > day.Methods[j].Collected })
+			for _, method := range day.Methods {
+				if i, ok := totals[method.Method]; ok {
+					report.Methods[i].add(method)
+				} else {
+					totals[method.Method] = len(report.Methods)
+					report.Methods = append(report.Methods, method)
+				}
+			}
+			report.Collected += day.Collected
+			report.Refunded += day.Refunded
+			report.Cash_close.add(day.Cash_close)
+			report.Days = append(report.Days, *day)
+		}
+		report.Net = report.Collected - report.Refunded
+		sort.Slice(report.Methods, func(i, j int) bool { return report.Methods[i].Collected > report.Methods[j].Collected })
+		sort.Slice(report.Days, func(i, j int) bool { return report.Days[i].Day < report.Days[j].Day })
+
+		c.JSON(http.StatusOK, report)
+	}
+}
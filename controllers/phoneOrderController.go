@@ -0,0 +1,395 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var providerMenuMappingCollection *mongo.Collection = database.OpenCollection(database.Client, "providerMenuMapping")
+
+type PhoneOrderPayload struct {
+	Provider          string `json:"provider" validate:"required,max=64"`
+	External_order_id string `json:"external_order_id" validate:"required,max=128"`
+	Customer          struct {
+		Name  *string `json:"name" validate:"omitempty,max=100"`
+		Phone *string `json:"phone" validate:"omitempty,max=32"`
+	} `json:"customer"`
+	Items []struct {
+		Provider_item_id string  `json:"provider_item_id" validate:"required"`
+		Count            int     `json:"count" validate:"omitempty,min=1,max=50"`
+		Quantity         *string `json:"quantity" validate:"omitempty,eq=S|eq=M|eq=L"`
+	} `json:"items" validate:"required,min=1,max=100,dive"`
+	Sms_confirmation bool `json:"sms_confirmation"`
+}
+
+type PhoneOrderConfirmationItem struct {
+	Order_item_id string       `json:"order_item_id"`
+	Food_id       string       `json:"food_id"`
+	Name          string       `json:"name"`
+	Quantity      string       `json:"quantity"`
+	Unit_price    models.Money `json:"unit_price"`
+}
+
+type PhoneOrderConfirmation struct {
+	Status            string                       `json:"status"`
+	Order_id          string                       `json:"order_id"`
+	Order_number      int                          `json:"order_number"`
+	External_order_id string                       `json:"external_order_id"`
+	Items             []PhoneOrderConfirmationItem `json:"items"`
+	Estimated_total   models.Money                 `json:"estimated_total"`
+}
+
+// phoneOrderSecret returns the shared secret of an ordering provider, from PHONE_ORDER_SECRET_<PROVIDER>
+// with the provider name in upper case and other characters than letters and digits as underscores
+func phoneOrderSecret(provider string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(provider))
+	return os.Getenv("PHONE_ORDER_SECRET_" + name)
+}
+
+// CreatePhoneOrder accepts an order taken by an IVR/SMS ordering provider and creates it with the
+// PHONE channel. Provider item ids are translated with the provider menu mappings; if any item is
+// not mapped nothing is created and the unmapped ids are returned. Repeated requests for the same
+// provider order return the original confirmation.
+// Providers call it without a staff token: requests must carry an X-Phone-Order-Signature header signed
+// like payment webhooks, keyed with the secret of the provider named in the payload.
+func CreatePhoneOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var payload PhoneOrderPayload
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "could not read request body"})
+			return
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		validationErr := validate.Struct(payload)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		// The signature proves the request comes from the provider it names
+		secret := phoneOrderSecret(payload.Provider)
+		if secret == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "phone orders from this provider are not configured"})
+			return
+		}
+		if err := verifyWebhookSignature(secret, c.GetHeader("X-Phone-Order-Signature"), body, time.Now()); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		reference := payload.Provider + ":" + payload.External_order_id
+		var existing models.Order
+		if err := orderCollection.FindOne(ctx, bson.M{"external_reference": reference}).Decode(&existing); err == nil {
+			confirmation, err := phoneOrderConfirmation(ctx, existing, payload.External_order_id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the order"})
+				return
+			}
+			c.JSON(http.StatusOK, confirmation)
+			return
+		}
+
+		// Translate the provider's item ids to foods
+		var providerItemIds []string
+		for _, item := range payload.Items {
+			providerItemIds = append(providerItemIds, item.Provider_item_id)
+		}
+		mappings, err := providerMappings(ctx, payload.Provider, providerItemIds)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the menu mappings"})
+			return
+		}
+
+		foods := map[string]models.Food{}
+		unmapped := []string{}
+		for _, item := range payload.Items {
+			mapping, ok := mappings[item.Provider_item_id]
+			if !ok {
+				unmapped = append(unmapped, item.Provider_item_id)
+				continue
+			}
+			var food models.Food
+			if err := foodCollection.FindOne(ctx, bson.M{"food_id": *mapping.Food_id}).Decode(&food); err != nil || food.Price == nil || food.Deleted_at != nil {
+				unmapped = append(unmapped, item.Provider_item_id)
+				continue
+			}
+			foods[food.Food_id] = food
+		}
+		if len(unmapped) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "some provider items are not mapped to the menu", "unmapped_items": unmapped})
+			return
+		}
+
+		var order models.Order
+		channel := "PHONE"
+		status := "QUEUED"
+		order.ID = primitive.NewObjectID()
+		order.Order_id = order.ID.Hex()
+		order.Order_Date, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		order.Created_at = order.Order_Date
+		order.Updated_at = order.Order_Date
+		order.Channel = &channel
+		order.Status = &status
+		order.Customer_name = payload.Customer.Name
+		order.Customer_phone = payload.Customer.Phone
+		order.External_reference = &reference
+		if err := assignOrderNumber(ctx, &order); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order number could not be assigned"})
+			return
+		}
+
+		orderItems := []interface{}{}
+		for _, item := range payload.Items {
+			mapping := mappings[item.Provider_item_id]
+			food := foods[*mapping.Food_id]
+
+			quantity := "M"
+			if mapping.Quantity != nil {
+				quantity = *mapping.Quantity
+			}
+			if item.Quantity != nil {
+				quantity = *item.Quantity
+			}
+			count := item.Count
+			if count == 0 {
+				count = 1
+			}
+
+			for i := 0; i < count; i++ {
+				var orderItem models.OrderItem
+				orderItem.ID = primitive.NewObjectID()
+				orderItem.Order_item_id = orderItem.ID.Hex()
+				orderItem.Order_id = order.Order_id
+				orderItem.Food_id = &food.Food_id
+				orderItem.Quantity = &quantity
+				price, err := foodSizePrice(food, quantity)
+				if err != nil {
+					c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+					return
+				}
+				orderItem.Unit_price = &price
+				queued := "QUEUED"
+				orderItem.Status = &queued
+				orderItem.Created_at = order.Created_at
+				orderItem.Updated_at = order.Created_at
+				orderItems = append(orderItems, orderItem)
+			}
+		}
+
+		if _, err := orderCollection.InsertOne(ctx, order); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "this order is already being created, please retry"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order was not created"})
+			return
+		}
+		if _, err := orderItemCollection.InsertMany(ctx, orderItems); err != nil {
+			orderCollection.DeleteOne(ctx, bson.M{"order_id": order.Order_id})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order was not created"})
+			return
+		}
+
+		changedBy := "provider:" + payload.Provider
+		changes := []orderRevision{{orderId: order.Order_id, action: "ORDER_CREATED", newValue: order}}
+		for _, inserted := range orderItems {
+			orderItem := inserted.(models.OrderItem)
+			changes = append(changes, orderRevision{orderId: order.Order_id, orderItemId: orderItem.Order_item_id, action: "ITEM_ADDED", newValue: orderItem})
+		}
+		recordOrderRevisions(ctx, changedBy, changes...)
+
+		confirmation, err := phoneOrderConfirmation(ctx, order, payload.External_order_id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the order"})
+			return
+		}
+		if payload.Sms_confirmation && order.Customer_phone != nil {
+			// The confirmation is best effort, default formatting is used if the settings cannot be read
+			settings, err := loadSettings(ctx)
+			if err != nil {
+				log.Println("failed to load settings for the order confirmation:", err)
+			}
+			queueMessage(ctx, "SMS", *order.Customer_phone, "",
+				fmt.Sprintf("Thanks for your order! Your order number is #%d, estimated total %s.", order.Order_number, formatMoney(confirmation.Estimated_total, settings)),
+				"PHONE_ORDER_CONFIRMATION", order.Order_id)
+		}
+		c.JSON(http.StatusOK, confirmation)
+	}
+}
+
+// phoneOrderConfirmation describes a created order in the form returned to the ordering provider
+func phoneOrderConfirmation(ctx context.Context, order models.Order, externalOrderId string) (PhoneOrderConfirmation, error) {
+	confirmation := PhoneOrderConfirmation{
+		Status:            "ACCEPTED",
+		Order_id:          order.Order_id,
+		Order_number:      order.Order_number,
+		External_order_id: externalOrderId,
+		Items:             []PhoneOrderConfirmationItem{},
+	}
+
+	cursor, err := orderItemCollection.Find(ctx, bson.M{"order_id": order.Order_id})
+	if err != nil {
+		return confirmation, err
+	}
+	var orderItems []models.OrderItem
+	if err = cursor.All(ctx, &orderItems); err != nil {
+		return confirmation, err
+	}
+
+	for _, orderItem := range orderItems {
+		if orderItemStatus(orderItem) == "VOIDED" {
+			continue
+		}
+		item := PhoneOrderConfirmationItem{Order_item_id: orderItem.Order_item_id}
+		if orderItem.Food_id != nil {
+			item.Food_id = *orderItem.Food_id
+			var food models.Food
+			if err := foodCollection.FindOne(ctx, bson.M{"food_id": *orderItem.Food_id}).Decode(&food); err == nil && food.Name != nil {
+				item.Name = *food.Name
+			}
+		}
+		if orderItem.Quantity != nil {
+			item.Quantity = *orderItem.Quantity
+		}
+		if orderItem.Unit_price != nil {
+			item.Unit_price = *orderItem.Unit_price
+		}
+		confirmation.Estimated_total += item.Unit_price
+		confirmation.Items = append(confirmation.Items, item)
+	}
+	return confirmation, nil
+}
+
+// providerMappings loads a provider's menu mappings for the given provider item ids, by provider item id
+func providerMappings(ctx context.Context, provider string, providerItemIds []string) (map[string]models.ProviderMenuMapping, error) {
+	mappings := map[string]models.ProviderMenuMapping{}
+
+	cursor, err := providerMenuMappingCollection.Find(ctx, bson.M{"provider": provider, "provider_item_id": bson.M{"$in": providerItemIds}})
+	if err != nil {
+		return mappings, err
+	}
+	var found []models.ProviderMenuMapping
+	if err = cursor.All(ctx, &found); err != nil {
+		return mappings, err
+	}
+	for _, mapping := range found {
+		mappings[*mapping.Provider_item_id] = mapping
+	}
+	return mappings, nil
+}
+
+func GetProviderMenuMappings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if provider := c.Query("provider"); provider != "" {
+			filter["provider"] = provider
+		}
+
+		result, err := providerMenuMappingCollection.Find(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing menu mappings"})
+			return
+		}
+		mappings := []models.ProviderMenuMapping{}
+		if err = result.All(ctx, &mappings); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing menu mappings"})
+			return
+		}
+		c.JSON(http.StatusOK, mappings)
+	}
+}
+
+// SaveProviderMenuMapping creates the mapping for a provider item, or points an existing one at a new food
+func SaveProviderMenuMapping() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var mapping models.ProviderMenuMapping
+		var food models.Food
+
+		if err := c.BindJSON(&mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		validationErr := validate.Struct(mapping)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": mapping.Food_id}).Decode(&food); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "food was not found"})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		id := primitive.NewObjectID()
+		upsert := true
+		_, err := providerMenuMappingCollection.UpdateOne(
+			ctx,
+			bson.M{"provider": mapping.Provider, "provider_item_id": mapping.Provider_item_id},
+			bson.D{
+				{"$set", bson.D{{"food_id", mapping.Food_id}, {"quantity", mapping.Quantity}, {"updated_at", now}}},
+				{"$setOnInsert", bson.D{{"_id", id}, {"mapping_id", id.Hex()}, {"created_at", now}}},
+			},
+			&options.UpdateOptions{Upsert: &upsert},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu mapping was not saved"})
+			return
+		}
+
+		var saved models.ProviderMenuMapping
+		providerMenuMappingCollection.FindOne(ctx, bson.M{"provider": mapping.Provider, "provider_item_id": mapping.Provider_item_id}).Decode(&saved)
+		c.JSON(http.StatusOK, saved)
+	}
+}
+
+func DeleteProviderMenuMapping() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := providerMenuMappingCollection.DeleteOne(ctx, bson.M{"mapping_id": c.Param("mapping_id")})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "menu mapping could not be deleted"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu mapping was not found"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
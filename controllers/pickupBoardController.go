@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PickupBoard is what lobby screens show: customer-facing order numbers only, no guest details
+type PickupBoard struct {
+	Preparing []int `json:"preparing"`
+	Ready     []int `json:"ready"`
+}
+
+// pickupBoardStatuses maps derived order statuses to the board column they are shown in
+var pickupBoardStatuses = map[string]string{
+	"QUEUED":          "PREPARING",
+	"PREPARING":       "PREPARING",
+	"PARTIALLY_READY": "PREPARING",
+	"READY":           "READY",
+}
+
+// pickupBoardSignal wakes the pickup board streams when change streams see an order change, so boards
+// do not wait for their next check
+var pickupBoardSignal = struct {
+	sync.Mutex
+	changed chan struct{}
+}{changed: make(chan struct{})}
+
+// pickupBoardChanged returns a channel closed the next time an order changes
+func pickupBoardChanged() <-chan struct{} {
+	pickupBoardSignal.Lock()
+	defer pickupBoardSignal.Unlock()
+	return pickupBoardSignal.changed
+}
+
+func notifyPickupBoards() {
+	pickupBoardSignal.Lock()
+	defer pickupBoardSignal.Unlock()
+	close(pickupBoardSignal.changed)
+	pickupBoardSignal.changed = make(chan struct{})
+}
+
+// pickupBoard lists today's non dine-in orders that are still being prepared or waiting to be collected
+func pickupBoard(ctx context.Context, locationId string) (PickupBoard, error) {
+	board := PickupBoard{Preparing: []int{}, Ready: []int{}}
+
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		return board, err
+	}
+
+	filter := bson.M{
+		"business_date": businessDate(settings, time.Now()),
+		"order_number":  bson.M{"$gt": 0},
+		"channel":       bson.M{"$ne": "DINE_IN"},
+		"status":        bson.M{"$in": bson.A{"QUEUED", "PREPARING", "PARTIALLY_READY", "READY"}},
+	}
+	if locationId != "" {
+		filter["location_id"] = locationId
+	}
+
+	opts := options.Find().SetProjection(bson.M{"_id": 0, "order_number": 1, "status": 1})
+	cursor, err := orderCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return board, err
+	}
+
+	var orders []struct {
+		Order_number int    `bson:"order_number"`
+		Status       string `bson:"status"`
+	}
+	if err = cursor.All(ctx, &orders); err != nil {
+		return board, err
+	}
+
+	for _, order := range orders {
+		if pickupBoardStatuses[order.Status] == "READY" {
+			board.Ready = append(board.Ready, order.Order_number)
+		} else {
+			board.Preparing = append(board.Preparing, order.Order_number)
+		}
+	}
+	sort.Ints(board.Preparing)
+	sort.Ints(board.Ready)
+	return board, nil
+}
+
+// StreamPickupBoard streams the pickup board as server-sent events. A "board" event is sent on
+// connect and whenever the board changes; the board is checked every PICKUP_BOARD_POLL_SECONDS, and as
+// soon as an order changes when change streams are running.
+func StreamPickupBoard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		locationId := c.Query("location_id")
+		poll := time.Duration(envInt("PICKUP_BOARD_POLL_SECONDS", 3)) * time.Second
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+
+		ticker := time.NewTicker(poll)
+		defer ticker.Stop()
+
+		var lastSent string
+		idle := 0
+		first := true
+
+		c.Stream(func(w io.Writer) bool {
+			if !first {
+				select {
+				case <-c.Request.Context().Done():
+					return false
+				case <-ticker.C:
+				case <-pickupBoardChanged():
+				}
+			}
+			first = false
+
+			var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+			board, err := pickupBoard(ctx, locationId)
+			cancel()
+			if err != nil {
+				c.SSEvent("error", gin.H{"error": "pickup board is temporarily unavailable"})
+				return true
+			}
+
+			encoded, _ := json.Marshal(board)
+			if string(encoded) != lastSent {
+				lastSent = string(encoded)
+				idle = 0
+				c.SSEvent("board", board)
+				return true
+			}
+
+			// Keep idle connections open through proxies with a comment line about every 30 seconds
+			idle++
+			if time.Duration(idle)*poll >= 30*time.Second {
+				idle = 0
+				io.WriteString(w, ": keep-alive\n\n")
+			}
+			return true
+		})
+	}
+}
+
+// GetPickupBoard returns the current pickup board once, for screens that cannot use SSE
+func GetPickupBoard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		board, err := pickupBoard(ctx, c.Query("location_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the pickup board"})
+			return
+		}
+		c.JSON(http.StatusOK, board)
+	}
+}
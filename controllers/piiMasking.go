@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultPiiFieldRules says how sensitive response fields are shown to callers without full PII access.
+// Rules are PHONE (last digits only), EMAIL (first letter and domain), NAME (first name and initial),
+// OMIT (field removed) or CONTACT (PHONE or EMAIL depending on the value). Fields marked SECRET are
+// removed for every caller. The settings' pii_field_rules override these per field name.
+var defaultPiiFieldRules = map[string]string{
+	"customer_phone":     "PHONE",
+	"phone":              "PHONE",
+	"customer_email":     "EMAIL",
+	"email":              "EMAIL",
+	"customer_name":      "NAME",
+	"address":            "OMIT",
+	"delivery_address":   "OMIT",
+	"to":                 "CONTACT",
+	"password":           "SECRET",
+	"token":              "SECRET",
+	"refresh_token":      "SECRET",
+	"confirmation_token": "SECRET",
+}
+
+// defaultPiiFullAccessRoles are the roles that receive PII unmasked unless the settings say otherwise
+var defaultPiiFullAccessRoles = []string{"ADMIN", "MANAGER"}
+
+// maskedJSON writes a JSON response with personal data masked according to the caller's role.
+// Handlers returning customer or staff details use it instead of c.JSON.
+func maskedJSON(c *gin.Context, status int, value interface{}) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rules := defaultPiiFieldRules
+	fullAccessRoles := defaultPiiFullAccessRoles
+	if settings, err := loadSettings(ctx); err == nil {
+		if len(settings.Pii_full_access_roles) > 0 {
+			fullAccessRoles = settings.Pii_full_access_roles
+		}
+		if len(settings.Pii_field_rules) > 0 {
+			rules = map[string]string{}
+			for field, rule := range defaultPiiFieldRules {
+				rules[field] = rule
+			}
+			// SECRET fields are removed for everyone, the settings cannot change that
+			for field, rule := range settings.Pii_field_rules {
+				field = strings.ToLower(field)
+				if defaultPiiFieldRules[field] != "SECRET" {
+					rules[field] = rule
+				}
+			}
+		}
+	}
+
+	// Device tokens never get full access, whatever roles are configured
+	fullAccess := false
+	if c.GetString("device_id") == "" {
+		for _, role := range fullAccessRoles {
+			if c.GetString("role") == role {
+				fullAccess = true
+			}
+		}
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		c.JSON(status, value)
+		return
+	}
+	var document interface{}
+	if err := json.Unmarshal(encoded, &document); err != nil {
+		c.JSON(status, value)
+		return
+	}
+	c.JSON(status, maskValue(document, rules, fullAccess))
+}
+
+// maskValue walks a decoded JSON document and applies the masking rules to every matching field
+func maskValue(value interface{}, rules map[string]string, fullAccess bool) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for field, fieldValue := range typed {
+			rule, ok := rules[strings.ToLower(field)]
+			if !ok || rule == "NONE" || (fullAccess && rule != "SECRET") {
+				typed[field] = maskValue(fieldValue, rules, fullAccess)
+				continue
+			}
+			if rule == "OMIT" || rule == "SECRET" {
+				delete(typed, field)
+				continue
+			}
+			if text, ok := fieldValue.(string); ok {
+				typed[field] = maskText(text, rule)
+			}
+		}
+		return typed
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = maskValue(item, rules, fullAccess)
+		}
+		return typed
+	default:
+		return value
+	}
+}
+
+func maskText(text string, rule string) string {
+	if text == "" {
+		return text
+	}
+	if rule == "CONTACT" {
+		rule = "PHONE"
+		if strings.Contains(text, "@") {
+			rule = "EMAIL"
+		}
+	}
+
+	switch rule {
+	case "PHONE":
+		digits := []rune(text)
+		if len(digits) <= 4 {
+			return strings.Repeat("*", len(digits))
+		}
+		return strings.Repeat("*", len(digits)-4) + string(digits[len(digits)-4:])
+	case "EMAIL":
+		at := strings.LastIndex(text, "@")
+		if at < 1 {
+			return "***"
+		}
+		return text[:1] + "***" + text[at:]
+	case "NAME":
+		parts := strings.Fields(text)
+		if len(parts) == 0 {
+			return ""
+		}
+		if len(parts) < 2 {
+			return parts[0]
+		}
+		return parts[0] + " " + string([]rune(parts[len(parts)-1])[:1]) + "."
+	default:
+		return "***"
+	}
+}
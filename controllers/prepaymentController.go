@@ -0,0 +1,321 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var prepaymentCollection *mongo.Collection = database.OpenCollection(database.Client, "prepayment")
+
+type RefundPrepaymentRequest struct {
+	Reason string `json:"reason" validate:"required,max=250"`
+}
+
+func GetPrepayments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		if reservationId := c.Query("reservation_id"); reservationId != "" {
+			filter["reservation_id"] = reservationId
+		}
+
+		opts := options.Find().SetSort(bson.D{{"created_at", -1}})
+		cursor, err := prepaymentCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing prepayments"})
+			return
+		}
+		prepayments := []models.Prepayment{}
+		if err = cursor.All(ctx, &prepayments); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing prepayments"})
+			return
+		}
+		c.JSON(http.StatusOK, prepayments)
+	}
+}
+
+func GetPrepayment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var prepayment models.Prepayment
+		if err := prepaymentCollection.FindOne(ctx, bson.M{"prepayment_id": c.Param("prepayment_id")}).Decode(&prepayment); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "prepayment was not found"})
+			return
+		}
+		c.JSON(http.StatusOK, prepayment)
+	}
+}
+
+// RefundPrepayment gives back what is left of a prepayment, whatever the deposit policy says: the whole
+// deposit when it is still held or was forfeited, or the part an invoice did not use up
+func RefundPrepayment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request RefundPrepaymentRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var prepayment models.Prepayment
+		if err := prepaymentCollection.FindOne(ctx, bson.M{"prepayment_id": c.Param("prepayment_id")}).Decode(&prepayment); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "prepayment was not found"})
+			return
+		}
+		if prepayment.Status == "PENDING" || prepayment.Status == "CANCELLED" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the deposit was not paid"})
+			return
+		}
+		refundable := prepayment.Amount - prepayment.Applied_amount - prepayment.Refunded_amount
+		if prepayment.Status == "REFUNDED" || refundable <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "nothing is left to refund on this prepayment"})
+			return
+		}
+
+		// An applied prepayment stays APPLIED, only its unused part is given back
+		status := prepayment.Status
+		if status != "APPLIED" {
+			status = "REFUNDED"
+		}
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		refundedBy := c.GetString("uid")
+		result, err := prepaymentCollection.UpdateOne(
+			ctx,
+			bson.M{"prepayment_id": prepayment.Prepayment_id, "status": prepayment.Status, "refunded_amount": prepayment.Refunded_amount},
+			bson.D{{"$set", bson.D{
+				{"status", status},
+				{"refunded_amount", prepayment.Refunded_amount + refundable},
+				{"refund_reason", request.Reason},
+				{"settled_by", refundedBy},
+				{"settled_at", now},
+				{"updated_at", now},
+			}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "prepayment could not be refunded"})
+			return
+		}
+		if result.ModifiedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "prepayment was changed concurrently, please retry"})
+			return
+		}
+
+		prepayment.Status = status
+		prepayment.Refunded_amount += refundable
+		prepayment.Refund_reason = &request.Reason
+		prepayment.Settled_by = &refundedBy
+		prepayment.Settled_at = &now
+		prepayment.Updated_at = now
+		c.JSON(http.StatusOK, prepayment)
+	}
+}
+
+// createDepositPrepayment records the deposit of a new reservation as a HELD prepayment, or as a PENDING
+// one when the guest pays it online
+func createDepositPrepayment(ctx context.Context, reservation *models.Reservation) error {
+	var prepayment models.Prepayment
+	prepayment.ID = primitive.NewObjectID()
+	prepayment.Prepayment_id = prepayment.ID.Hex()
+	prepayment.Reservation_id = reservation.Reservation_id
+	prepayment.Amount = *reservation.Deposit
+	prepayment.Status = "HELD"
+	if reservation.Deposit_method != nil && *reservation.Deposit_method == "ONLINE" {
+		prepayment.Status = "PENDING"
+	}
+	prepayment.Created_at = reservation.Created_at
+	prepayment.Updated_at = reservation.Created_at
+
+	if _, err := prepaymentCollection.InsertOne(ctx, prepayment); err != nil {
+		return err
+	}
+	reservation.Prepayment_id = &prepayment.Prepayment_id
+	return nil
+}
+
+// applyReservationDeposits credits the held deposits of the orders' reservations on a new invoice, up to
+// the amount due. Each prepayment is claimed atomically, so a deposit is never credited twice.
+func applyReservationDeposits(ctx context.Context, invoice *models.Invoice, orders []models.Order) error {
+	seen := map[string]bool{}
+	for _, order := range orders {
+		if order.Reservation_id == nil || seen[*order.Reservation_id] {
+			continue
+		}
+		seen[*order.Reservation_id] = true
+
+		var prepayment models.Prepayment
+		err := prepaymentCollection.FindOne(ctx, bson.M{"reservation_id": *order.Reservation_id, "status": "HELD"}).Decode(&prepayment)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		amount := prepayment.Amount
+		if due := invoiceAmountDue(*invoice); due < amount {
+			amount = due
+		}
+		if amount <= 0 {
+			break
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		result, err := prepaymentCollection.UpdateOne(
+			ctx,
+			bson.M{"prepayment_id": prepayment.Prepayment_id, "status": "HELD"},
+			bson.D{{"$set", bson.D{
+				{"status", "APPLIED"},
+				{"invoice_id", invoice.Invoice_id},
+				{"applied_amount", amount},
+				{"applied_at", now},
+				{"updated_at", now},
+			}}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		invoice.Deposit_payments = append(invoice.Deposit_payments, models.DepositPayment{
+			Prepayment_id:  prepayment.Prepayment_id,
+			Reservation_id: prepayment.Reservation_id,
+			Amount:         amount,
+		})
+		invoice.Deposit_total += amount
+	}
+	return nil
+}
+
+// releaseDepositPayments makes the deposits credited on an invoice that was not saved or was voided
+// available again, so they are credited on the invoice that replaces it
+func releaseDepositPayments(ctx context.Context, invoice models.Invoice) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	for _, payment := range invoice.Deposit_payments {
+		_, err := prepaymentCollection.UpdateOne(
+			ctx,
+			bson.M{"prepayment_id": payment.Prepayment_id, "status": "APPLIED", "invoice_id": invoice.Invoice_id},
+			bson.D{
+				{"$set", bson.D{{"status", "HELD"}, {"invoice_id", nil}, {"applied_amount", 0}, {"applied_at", nil}, {"updated_at", now}}},
+			},
+		)
+		if err != nil {
+			log.Println("failed to release deposit", payment.Prepayment_id, ":", err)
+		}
+	}
+}
+
+// depositFee works out the fee kept from a deposit of a reservation that was cancelled or not honoured.
+// A cancellation at least the deposit policy's refund_cutoff_hours (default 24) before the reservation
+// time costs nothing; later cancellations and no-shows cost late_cancellation_fee_percent and
+// no_show_fee_percent of the deposit (default 100).
+func depositFee(policy *models.DepositPolicy, reservation models.Reservation, status string, amount models.Money, now time.Time) models.Money {
+	cutoff, percent := 24, 100
+	if policy != nil && policy.Refund_cutoff_hours != nil {
+		cutoff = *policy.Refund_cutoff_hours
+	}
+	if status == "NO_SHOW" {
+		if policy != nil && policy.No_show_fee_percent != nil {
+			percent = *policy.No_show_fee_percent
+		}
+	} else {
+		if reservation.Reservation_time != nil && !now.After(reservation.Reservation_time.Add(-time.Duration(cutoff)*time.Hour)) {
+			return 0
+		}
+		if policy != nil && policy.Late_cancellation_fee_percent != nil {
+			percent = *policy.Late_cancellation_fee_percent
+		}
+	}
+	return models.Money(math.Round(float64(amount) * float64(percent) / 100))
+}
+
+// settleReservationDeposit refunds or forfeits the deposit of a reservation that was cancelled or not
+// honoured, keeping the fee of the deposit policy (see depositFee). Managers are notified of refunds,
+// which they pay back to the guest. A deposit that was not paid yet is cancelled.
+func settleReservationDeposit(ctx context.Context, reservation models.Reservation, status string, settledBy string) {
+	if reservation.Prepayment_id == nil || (status != "CANCELLED" && status != "NO_SHOW") {
+		return
+	}
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		log.Println("failed to load settings for the deposit policy:", err)
+		return
+	}
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	if settledBy == "" {
+		settledBy = "system"
+	}
+
+	_, err = prepaymentCollection.UpdateOne(
+		ctx,
+		bson.M{"prepayment_id": *reservation.Prepayment_id, "status": "PENDING"},
+		bson.D{{"$set", bson.D{{"status", "CANCELLED"}, {"settled_by", settledBy}, {"settled_at", now}, {"updated_at", now}}}},
+	)
+	if err != nil {
+		log.Println("failed to cancel the deposit of reservation", reservation.Reservation_id, ":", err)
+		return
+	}
+
+	var prepayment models.Prepayment
+	err = prepaymentCollection.FindOne(ctx, bson.M{"prepayment_id": *reservation.Prepayment_id, "status": "HELD"}).Decode(&prepayment)
+	if err == mongo.ErrNoDocuments {
+		return
+	}
+	if err != nil {
+		log.Println("failed to find the deposit of reservation", reservation.Reservation_id, ":", err)
+		return
+	}
+
+	fee := depositFee(settings.Deposit_policy, reservation, status, prepayment.Amount, now)
+	refund := prepayment.Amount - fee
+	set := bson.D{{"status", "FORFEITED"}, {"fee_amount", fee}, {"settled_by", settledBy}, {"settled_at", now}, {"updated_at", now}}
+	if fee == 0 {
+		set = bson.D{{"status", "REFUNDED"}, {"settled_by", settledBy}, {"settled_at", now}, {"updated_at", now}}
+	}
+	if refund > 0 {
+		reason := "reservation cancelled within the deposit policy"
+		if fee > 0 && status == "NO_SHOW" {
+			reason = "deposit less the no-show fee"
+		} else if fee > 0 {
+			reason = "deposit less the late cancellation fee"
+		}
+		set = append(set, bson.E{"refunded_amount", refund}, bson.E{"refund_reason", reason})
+	}
+	result, err := prepaymentCollection.UpdateOne(ctx, bson.M{"prepayment_id": prepayment.Prepayment_id, "status": "HELD"}, bson.D{{"$set", set}})
+	if err != nil {
+		log.Println("failed to settle the deposit of reservation", reservation.Reservation_id, ":", err)
+		return
+	}
+
+	if refund > 0 && result.ModifiedCount > 0 {
+		message := "The reservation for " + *reservation.Customer_name + " was cancelled in time, refund the deposit of " + formatMoney(prepayment.Amount, settings)
+		if fee > 0 {
+			message = "Refund " + formatMoney(refund, settings) + " of the deposit of the reservation for " + *reservation.Customer_name + ", a fee of " + formatMoney(fee, settings) + " was kept"
+		}
+		notifyManagers(ctx, "DEPOSIT_REFUND", "Reservation deposit to refund", message, prepayment.Prepayment_id)
+	}
+}
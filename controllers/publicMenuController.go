@@ -0,0 +1,236 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"golang-restaurant-management/models"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type PublicMenuImage struct {
+	Url           string  `json:"url"`
+	Thumbnail_url *string `json:"thumbnail_url"`
+	Alt_text      *string `json:"alt_text"`
+}
+
+type PublicMenuFood struct {
+	Food_id         string                   `json:"food_id"`
+	Name            string                   `json:"name"`
+	Price           models.Money             `json:"price"`
+	Formatted_price string                   `json:"formatted_price"`
+	Image           *PublicMenuImage         `json:"image"`
+	Description     *models.FoodDescription  `json:"description"`
+	Allergens       []string                 `json:"allergens"`
+	Dietary_flags   []string                 `json:"dietary_flags"`
+	Option_groups   []models.FoodOptionGroup `json:"option_groups"`
+}
+
+type PublicMenuSection struct {
+	Menu_id  string           `json:"menu_id"`
+	Name     string           `json:"name"`
+	Category string           `json:"category"`
+	Foods    []PublicMenuFood `json:"foods"`
+}
+
+// publicMenu builds the customer-facing menu: published menus that are currently served,
+// with only the food fields guests need (no costs or internal data) and only the foods matching foodFilter,
+// translated into the first of the accepted languages they have a translation for
+func publicMenu(ctx context.Context, foodFilter bson.D, accepted []string) ([]PublicMenuSection, error) {
+	sections := []PublicMenuSection{}
+	now := time.Now()
+
+	filter := availableMenuFilter(now)
+	filter["published_at"] = bson.M{"$ne": nil}
+	filter["deleted_at"] = nil
+	cursor, err := menuCollection.Find(ctx, filter)
+	if err != nil {
+		return sections, err
+	}
+	var menus []models.Menu
+	if err = cursor.All(ctx, &menus); err != nil {
+		return sections, err
+	}
+
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		return sections, err
+	}
+
+	base := baseLanguage(settings)
+	for _, menu := range menus {
+		if !menuServedAt(menu, now) {
+			continue
+		}
+		localizeMenu(&menu, accepted, base)
+		section := PublicMenuSection{Menu_id: menu.Menu_id, Name: menu.Name, Category: menu.Category, Foods: []PublicMenuFood{}}
+
+		foodCursor, err := foodCollection.Find(ctx, append(bson.D{{"menu_id", menu.Menu_id}, notArchived}, foodFilter...))
+		if err != nil {
+			return sections, err
+		}
+		var foods []models.Food
+		if err = foodCursor.All(ctx, &foods); err != nil {
+			return sections, err
+		}
+		sortFoodsByPosition(foods)
+
+		for _, food := range foods {
+			if food.Name == nil || food.Price == nil {
+				continue
+			}
+			localizeFood(&food, accepted, base)
+			publicFood := PublicMenuFood{Food_id: food.Food_id, Name: *food.Name, Price: *food.Price, Formatted_price: formatMoney(*food.Price, settings), Description: food.Description}
+			publicFood.Allergens = food.Allergens
+			publicFood.Dietary_flags = food.Dietary_flags
+			publicFood.Option_groups = food.Option_groups
+			if food.Food_image != nil && *food.Food_image != "" {
+				publicFood.Image = &PublicMenuImage{Url: *food.Food_image, Thumbnail_url: food.Thumbnail_image, Alt_text: food.Image_alt_text}
+			}
+			section.Foods = append(section.Foods, publicFood)
+		}
+		sections = append(sections, section)
+	}
+	return sections, nil
+}
+
+// publicMenuSchemaVersion is the version of the public menu's JSON schema. Fields are only ever added
+// within a version; renaming or removing one means a new version.
+const publicMenuSchemaVersion = 1
+
+// publicMenuCacheTTL bounds how long a cached public menu is served. Menu and food writes bump the
+// menu version and invalidate the cache at once, but dayparts and menu dates open and close without any write.
+const publicMenuCacheTTL = time.Minute
+
+// publicMenuVersionCheckInterval is how often a cached public menu checks the menu version, so menu
+// boards polling every few seconds are served from memory and see changes made on other instances
+// within a few seconds
+const publicMenuVersionCheckInterval = 5 * time.Second
+
+// maxPublicMenuCacheEntries bounds the number of filter combinations cached
+const maxPublicMenuCacheEntries = 100
+
+type publicMenuCacheEntry struct {
+	version      int64
+	checked      time.Time
+	expires      time.Time
+	lastModified time.Time
+	body         []byte
+	etag         string
+}
+
+// publicMenuCache keeps the rendered public menu per filter combination. Entries are only served
+// while the menu version they were built at is current, so every instance of the API drops them
+// as soon as any instance changes a menu or food.
+var publicMenuCache = struct {
+	sync.Mutex
+	entries map[string]publicMenuCacheEntry
+}{entries: map[string]publicMenuCacheEntry{}}
+
+// invalidatePublicMenuCache drops the cached public menus, for changes that do not bump the menu version
+func invalidatePublicMenuCache() {
+	publicMenuCache.Lock()
+	defer publicMenuCache.Unlock()
+	publicMenuCache.entries = map[string]publicMenuCacheEntry{}
+}
+
+// publicMenuNotModified reports whether a conditional request already has the current menu. If-None-Match
+// takes precedence; If-Modified-Since is only used by clients that send no ETag.
+func publicMenuNotModified(c *gin.Context, entry publicMenuCacheEntry) bool {
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		for _, etag := range strings.Split(ifNoneMatch, ",") {
+			etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+			if etag == entry.etag || etag == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	if ifModifiedSince := c.GetHeader("If-Modified-Since"); ifModifiedSince != "" {
+		since, err := http.ParseTime(ifModifiedSince)
+		return err == nil && !entry.lastModified.After(since)
+	}
+	return false
+}
+
+// GetPublicMenu returns the customer-facing menu, including image alt text, structured descriptions,
+// allergens and dietary flags. Guests can filter it with the dietary and allergen_free parameters.
+// Names and descriptions are translated following the lang parameter or the Accept-Language header.
+// The menu is cached in memory and served with an ETag and Last-Modified date, so menu boards,
+// browsers and CDNs can revalidate it cheaply.
+func GetPublicMenu() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		foodFilter, err := foodAttributeFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		accepted := acceptedLanguages(c)
+		key := strings.ToUpper(c.Query("dietary")) + "|" + strings.ToUpper(c.Query("allergen_free")) + "|" + strings.Join(accepted, ",")
+		now := time.Now()
+		publicMenuCache.Lock()
+		entry, ok := publicMenuCache.entries[key]
+		publicMenuCache.Unlock()
+
+		if !ok || now.After(entry.expires) || now.Sub(entry.checked) >= publicMenuVersionCheckInterval {
+			version, err := currentCounter(ctx, menuVersionCounter)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the menu"})
+				return
+			}
+
+			if ok && entry.version == version && !now.After(entry.expires) {
+				entry.checked = now
+			} else {
+				sections, err := publicMenu(ctx, foodFilter, accepted)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the menu"})
+					return
+				}
+				body, err := json.Marshal(gin.H{"schema_version": publicMenuSchemaVersion, "menus": sections})
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the menu"})
+					return
+				}
+				sum := sha256.Sum256(body)
+				etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+				// A menu rebuilt unchanged keeps its date, so clients revalidating by date still get a 304
+				lastModified := now.UTC().Truncate(time.Second)
+				if ok && entry.etag == etag {
+					lastModified = entry.lastModified
+				}
+				entry = publicMenuCacheEntry{version: version, checked: now, expires: now.Add(publicMenuCacheTTL), lastModified: lastModified, body: body, etag: etag}
+			}
+
+			publicMenuCache.Lock()
+			if len(publicMenuCache.entries) >= maxPublicMenuCacheEntries {
+				publicMenuCache.entries = map[string]publicMenuCacheEntry{}
+			}
+			publicMenuCache.entries[key] = entry
+			publicMenuCache.Unlock()
+		}
+
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(publicMenuCacheTTL.Seconds())))
+		c.Header("ETag", entry.etag)
+		c.Header("Last-Modified", entry.lastModified.Format(http.TimeFormat))
+		c.Header("Vary", "Accept-Language")
+		if publicMenuNotModified(c, entry) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		c.Data(http.StatusOK, "application/json; charset=utf-8", entry.body)
+	}
+}
@@ -0,0 +1,492 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// qrBlockLayout is how the codewords of a QR code version are split into Reed-Solomon blocks at error
+// correction level M: each block has its data codewords followed by eccPerBlock error correction codewords
+type qrBlockLayout struct {
+	eccPerBlock  int
+	group1Blocks int
+	group1Data   int
+	group2Blocks int
+	group2Data   int
+}
+
+// qrLayouts are the block layouts of versions 1 to 10 at level M, which hold up to 213 bytes; enough
+// for the links printed on tables
+var qrLayouts = []qrBlockLayout{
+	{10, 1, 16, 0, 0},
+	{16, 1, 28, 0, 0},
+	{26, 1, 44, 0, 0},
+	{18, 2, 32, 0, 0},
+	{24, 2, 43, 0, 0},
+	{16, 4, 27, 0, 0},
+	{18, 4, 31, 0, 0},
+	{22, 2, 38, 2, 39},
+	{22, 3, 36, 2, 37},
+	{26, 4, 43, 1, 44},
+}
+
+// qrAlignmentPositions are the row and column centers of the alignment patterns of each version
+var qrAlignmentPositions = [][]int{
+	{},
+	{6, 18},
+	{6, 22},
+	{6, 26},
+	{6, 30},
+	{6, 34},
+	{6, 22, 38},
+	{6, 24, 42},
+	{6, 26, 46},
+	{6, 28, 50},
+}
+
+// qrQuietZone is the light border around a QR code, in modules
+const qrQuietZone = 4
+
+func (layout qrBlockLayout) dataCodewords() int {
+	return layout.group1Blocks*layout.group1Data + layout.group2Blocks*layout.group2Data
+}
+
+// encodeQRCode encodes data as a QR code in byte mode with error correction level M, using the smallest
+// version it fits in. It returns the modules row by row, true for dark.
+func encodeQRCode(data []byte) ([][]bool, error) {
+	version := 0
+	for i, layout := range qrLayouts {
+		countBits := 8
+		if i+1 >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+len(data)*8 <= layout.dataCodewords()*8 {
+			version = i + 1
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("the QR code content is too long (%d bytes)", len(data))
+	}
+	layout := qrLayouts[version-1]
+
+	// Byte mode indicator, character count, data, terminator and padding
+	var bits qrBitBuffer
+	bits.append(0x4, 4)
+	if version >= 10 {
+		bits.append(len(data), 16)
+	} else {
+		bits.append(len(data), 8)
+	}
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := layout.dataCodewords() * 8
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	codewords := qrInterleave(bits.bytes(), layout)
+
+	size := 17 + 4*version
+	code := qrMatrix{size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for y := range code.modules {
+		code.modules[y] = make([]bool, size)
+		code.function[y] = make([]bool, size)
+	}
+	code.drawFunctionPatterns(version)
+	code.drawCodewords(codewords)
+
+	// The mask giving the lowest penalty makes the code easiest to scan
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		code.applyMask(mask)
+		code.drawFormatBits(mask)
+		if penalty := code.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		code.applyMask(mask)
+	}
+	code.applyMask(bestMask)
+	code.drawFormatBits(bestMask)
+	return code.modules, nil
+}
+
+type qrBitBuffer []bool
+
+func (buffer *qrBitBuffer) append(value int, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*buffer = append(*buffer, (value>>uint(i))&1 == 1)
+	}
+}
+
+func (buffer qrBitBuffer) bytes() []byte {
+	result := make([]byte, len(buffer)/8)
+	for i, bit := range buffer {
+		if bit {
+			result[i/8] |= 1 << uint(7-i%8)
+		}
+	}
+	return result
+}
+
+// qrInterleave splits the data codewords into blocks, adds each block's error correction codewords and
+// interleaves them: the blocks' data codewords column by column, then their error correction codewords
+func qrInterleave(data []byte, layout qrBlockLayout) []byte {
+	var blocks, eccBlocks [][]byte
+	divisor := qrReedSolomonDivisor(layout.eccPerBlock)
+	offset := 0
+	for i := 0; i < layout.group1Blocks+layout.group2Blocks; i++ {
+		length := layout.group1Data
+		if i >= layout.group1Blocks {
+			length = layout.group2Data
+		}
+		block := data[offset : offset+length]
+		offset += length
+		blocks = append(blocks, block)
+		eccBlocks = append(eccBlocks, qrReedSolomonRemainder(block, divisor))
+	}
+
+	var result []byte
+	for column := 0; column < layout.group1Data || column < layout.group2Data; column++ {
+		for _, block := range blocks {
+			if column < len(block) {
+				result = append(result, block[column])
+			}
+		}
+	}
+	for column := 0; column < layout.eccPerBlock; column++ {
+		for _, block := range eccBlocks {
+			result = append(result, block[column])
+		}
+	}
+	return result
+}
+
+// qrMultiply multiplies two elements of GF(2^8) modulo the QR code polynomial x^8+x^4+x^3+x^2+1
+func qrMultiply(x byte, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+// qrReedSolomonDivisor returns the coefficients of the generator polynomial of the given degree,
+// highest power first, without the leading 1
+func qrReedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = qrMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = qrMultiply(root, 0x02)
+	}
+	return result
+}
+
+// qrReedSolomonRemainder returns the error correction codewords of a block
+func qrReedSolomonRemainder(data []byte, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= qrMultiply(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+type qrMatrix struct {
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+func (code *qrMatrix) setFunction(x int, y int, dark bool) {
+	code.modules[y][x] = dark
+	code.function[y][x] = true
+}
+
+// drawFunctionPatterns draws the finder, timing and alignment patterns and the version information, and
+// reserves the format information areas
+func (code *qrMatrix) drawFunctionPatterns(version int) {
+	for i := 0; i < code.size; i++ {
+		code.setFunction(6, i, i%2 == 0)
+		code.setFunction(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns with their light separators
+	for _, center := range [][2]int{{3, 3}, {code.size - 4, 3}, {3, code.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x < 0 || x >= code.size || y < 0 || y >= code.size {
+					continue
+				}
+				distance := qrMax(qrAbs(dx), qrAbs(dy))
+				code.setFunction(x, y, distance != 2 && distance != 4)
+			}
+		}
+	}
+
+	// Alignment patterns, except where they would overlap the finder patterns
+	positions := qrAlignmentPositions[version-1]
+	last := len(positions) - 1
+	for i, y := range positions {
+		for j, x := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					code.setFunction(x+dx, y+dy, qrMax(qrAbs(dx), qrAbs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	code.drawFormatBits(0)
+
+	// Versions 7 and up carry their version number, protected by a (18, 6) BCH code
+	if version >= 7 {
+		remainder := version
+		for i := 0; i < 12; i++ {
+			remainder = (remainder << 1) ^ ((remainder >> 11) * 0x1F25)
+		}
+		bits := version<<12 | remainder
+		for i := 0; i < 18; i++ {
+			dark := (bits>>uint(i))&1 == 1
+			a, b := code.size-11+i%3, i/3
+			code.setFunction(a, b, dark)
+			code.setFunction(b, a, dark)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the format information for level M and the given mask, and the
+// dark module
+func (code *qrMatrix) drawFormatBits(mask int) {
+	data := 0<<3 | mask
+	remainder := data
+	for i := 0; i < 10; i++ {
+		remainder = (remainder << 1) ^ ((remainder >> 9) * 0x537)
+	}
+	bits := (data<<10 | remainder) ^ 0x5412
+	bit := func(i int) bool { return (bits>>uint(i))&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		code.setFunction(8, i, bit(i))
+	}
+	code.setFunction(8, 7, bit(6))
+	code.setFunction(8, 8, bit(7))
+	code.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		code.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		code.setFunction(code.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		code.setFunction(8, code.size-15+i, bit(i))
+	}
+	code.setFunction(8, code.size-8, true)
+}
+
+// drawCodewords places the codewords in the two module wide columns zigzagging up and down from the
+// bottom right corner, skipping the function patterns. Modules left over stay light.
+func (code *qrMatrix) drawCodewords(codewords []byte) {
+	i := 0
+	for right := code.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vertical := 0; vertical < code.size; vertical++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vertical
+				if (right+1)&2 == 0 {
+					y = code.size - 1 - vertical
+				}
+				if !code.function[y][x] && i < len(codewords)*8 {
+					code.modules[y][x] = (codewords[i/8]>>uint(7-i%8))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask flips the data modules selected by a mask pattern; applying it twice undoes it
+func (code *qrMatrix) applyMask(mask int) {
+	for y := 0; y < code.size; y++ {
+		for x := 0; x < code.size; x++ {
+			var flip bool
+			switch mask {
+			case 0:
+				flip = (x+y)%2 == 0
+			case 1:
+				flip = y%2 == 0
+			case 2:
+				flip = x%3 == 0
+			case 3:
+				flip = (x+y)%3 == 0
+			case 4:
+				flip = (x/3+y/2)%2 == 0
+			case 5:
+				flip = x*y%2+x*y%3 == 0
+			case 6:
+				flip = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				flip = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if flip && !code.function[y][x] {
+				code.modules[y][x] = !code.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the code is to scan: long runs of one color, 2x2 blocks of one color,
+// patterns looking like finder patterns and an unbalanced share of dark modules
+func (code *qrMatrix) penalty() int {
+	size := code.size
+	at := func(x int, y int, transposed bool) bool {
+		if transposed {
+			return code.modules[x][y]
+		}
+		return code.modules[y][x]
+	}
+
+	penalty := 0
+	finderLike := [][]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+	for _, transposed := range []bool{false, true} {
+		for y := 0; y < size; y++ {
+			run := 1
+			for x := 1; x <= size; x++ {
+				if x < size && at(x, y, transposed) == at(x-1, y, transposed) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += run - 2
+				}
+				run = 1
+			}
+			for x := 0; x+11 <= size; x++ {
+				for _, pattern := range finderLike {
+					matches := true
+					for k, dark := range pattern {
+						if at(x+k, y, transposed) != dark {
+							matches = false
+							break
+						}
+					}
+					if matches {
+						penalty += 40
+					}
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if code.modules[y][x] {
+				dark++
+			}
+			if x+1 < size && y+1 < size {
+				color := code.modules[y][x]
+				if code.modules[y][x+1] == color && code.modules[y+1][x] == color && code.modules[y+1][x+1] == color {
+					penalty += 3
+				}
+			}
+		}
+	}
+	percent := dark * 100 / (size * size)
+	penalty += qrAbs(percent-50) / 5 * 10
+	return penalty
+}
+
+func qrAbs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+func qrMax(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// qrCodePNG renders QR code modules as a black on white PNG with scale pixels per module
+func qrCodePNG(modules [][]bool, scale int) ([]byte, error) {
+	if len(modules) == 0 {
+		return nil, errors.New("the QR code is empty")
+	}
+	width := (len(modules) + 2*qrQuietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, width, width))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray((x+qrQuietZone)*scale+dx, (y+qrQuietZone)*scale+dy, color.Gray{Y: 0})
+				}
+			}
+		}
+	}
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// qrCodeSVG renders QR code modules as a black on white SVG image, scale pixels per module wide
+func qrCodeSVG(modules [][]bool, scale int) []byte {
+	width := len(modules) + 2*qrQuietZone
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, width*scale, width*scale, width, width)
+	buffer.WriteString(`<rect width="100%" height="100%" fill="#ffffff"/><path fill="#000000" d="`)
+	for y, row := range modules {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&buffer, "M%d,%dh1v1h-1z", x+qrQuietZone, y+qrQuietZone)
+			}
+		}
+	}
+	buffer.WriteString(`"/></svg>`)
+	return buffer.Bytes()
+}
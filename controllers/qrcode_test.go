@@ -0,0 +1,370 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// qrFormatStringsM are the format information strings of error correction level M for masks 0 to 7,
+// as listed in ISO/IEC 18004 table C.1, bit 14 first
+var qrFormatStringsM = []string{
+	"101010000010010",
+	"101000100100101",
+	"101111001111100",
+	"101101101001011",
+	"100010111111001",
+	"100000011001110",
+	"100111110010111",
+	"100101010100000",
+}
+
+func TestQRMultiply(t *testing.T) {
+	cases := []struct{ x, y, product byte }{
+		{0x00, 0x53, 0x00},
+		{0x01, 0x53, 0x53},
+		{0x02, 0x80, 0x1D},
+		{0x80, 0x80, 0x13},
+	}
+	for _, c := range cases {
+		if product := qrMultiply(c.x, c.y); product != c.product {
+			t.Errorf("qrMultiply(%#x, %#x) = %#x, want %#x", c.x, c.y, product, c.product)
+		}
+	}
+	// α generates the multiplicative group, of order 255
+	if qrPower(255) != 1 || qrPower(51) == 1 || qrPower(85) == 1 || qrPower(15) == 1 {
+		t.Error("0x02 is not a primitive element")
+	}
+}
+
+// The data and error correction codewords of "HELLO WORLD" as version 1-M, a widely published example
+func TestQRReedSolomonKnownVector(t *testing.T) {
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	if ecc := qrReedSolomonRemainder(data, qrReedSolomonDivisor(10)); !bytes.Equal(ecc, want) {
+		t.Errorf("error correction codewords = %v, want %v", ecc, want)
+	}
+}
+
+func TestQRReedSolomonDivisorKnownVector(t *testing.T) {
+	// x^7 + α^87 x^6 + α^229 x^5 + α^146 x^4 + α^149 x^3 + α^238 x^2 + α^102 x + α^21
+	want := []byte{qrPower(87), qrPower(229), qrPower(146), qrPower(149), qrPower(238), qrPower(102), qrPower(21)}
+	if divisor := qrReedSolomonDivisor(7); !bytes.Equal(divisor, want) {
+		t.Errorf("generator polynomial of degree 7 = %v, want %v", divisor, want)
+	}
+}
+
+func TestQRFormatBits(t *testing.T) {
+	for mask, want := range qrFormatStringsM {
+		code := newTestQRMatrix(1)
+		code.drawFormatBits(mask)
+		first, second := qrReadFormatBits(code.modules)
+		if first != want || second != want {
+			t.Errorf("format bits of mask %d = %s and %s, want %s", mask, first, second, want)
+		}
+	}
+}
+
+func TestQRVersionInformation(t *testing.T) {
+	// The version information of version 7 from ISO/IEC 18004 table D.1
+	want := "000111110010010100"
+	code := newTestQRMatrix(7)
+	code.drawFunctionPatterns(7)
+
+	var topRight, bottomLeft strings.Builder
+	for i := 17; i >= 0; i-- {
+		a, b := code.size-11+i%3, i/3
+		topRight.WriteString(qrBit(code.modules[b][a]))
+		bottomLeft.WriteString(qrBit(code.modules[a][b]))
+	}
+	if topRight.String() != want || bottomLeft.String() != want {
+		t.Errorf("version information = %s and %s, want %s", topRight.String(), bottomLeft.String(), want)
+	}
+}
+
+func TestEncodeQRCodeVersions(t *testing.T) {
+	cases := []struct{ length, version int }{
+		{0, 1}, {14, 1}, {15, 2}, {26, 2}, {27, 3}, {42, 3}, {43, 4}, {62, 4}, {63, 5}, {84, 5},
+		{85, 6}, {106, 6}, {107, 7}, {122, 7}, {123, 8}, {152, 8}, {153, 9}, {180, 9}, {181, 10}, {213, 10},
+	}
+	for _, c := range cases {
+		modules, err := encodeQRCode(bytes.Repeat([]byte{'a'}, c.length))
+		if err != nil {
+			t.Fatalf("encoding %d bytes failed: %v", c.length, err)
+		}
+		if size := 17 + 4*c.version; len(modules) != size || len(modules[0]) != size {
+			t.Errorf("%d bytes gave %dx%d modules, want version %d (%dx%d)", c.length, len(modules), len(modules[0]), c.version, size, size)
+		}
+	}
+
+	if _, err := encodeQRCode(bytes.Repeat([]byte{'a'}, 214)); err == nil {
+		t.Error("encoding 214 bytes should fail")
+	}
+}
+
+func TestEncodeQRCodeFinderPatterns(t *testing.T) {
+	modules, err := encodeQRCode([]byte("https://example.com/t/42"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := len(modules)
+	want := []string{
+		"11111110",
+		"10000010",
+		"10111010",
+		"10111010",
+		"10111010",
+		"10000010",
+		"11111110",
+		"00000000",
+	}
+	for y, row := range want {
+		for x, module := range row {
+			dark := module == '1'
+			if modules[y][x] != dark || modules[y][size-1-x] != dark || modules[size-1-y][x] != dark {
+				t.Fatalf("finder pattern module (%d, %d) is not %c", x, y, module)
+			}
+		}
+	}
+}
+
+// Decoding the encoded codes back checks the placement, the masking and the interleaving together
+func TestEncodeQRCodeRoundTrip(t *testing.T) {
+	contents := []string{
+		"",
+		"a",
+		"HELLO WORLD",
+		"https://example.com/tables/6512bd43d9caa6e02c990b0a82652dca/order?token=c4ca4238a0b923820dcc509a6f75849b",
+		"Café ñ 日本語 \x00\xff",
+		strings.Repeat("0123456789", 12),
+		strings.Repeat("xyz", 60),
+		strings.Repeat("#", 213),
+	}
+	for _, content := range contents {
+		modules, err := encodeQRCode([]byte(content))
+		if err != nil {
+			t.Fatalf("encoding %q failed: %v", content, err)
+		}
+		decoded, err := decodeTestQRCode(modules)
+		if err != nil {
+			t.Fatalf("decoding %q failed: %v", content, err)
+		}
+		if string(decoded) != content {
+			t.Errorf("decoded %q, want %q", decoded, content)
+		}
+	}
+}
+
+func TestQRCodeImages(t *testing.T) {
+	modules, err := encodeQRCode([]byte("https://example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, err := qrCodePNG(modules, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(image, []byte("\x89PNG\r\n\x1a\n")) {
+		t.Error("qrCodePNG did not return a PNG image")
+	}
+	if svg := qrCodeSVG(modules, 4); !bytes.HasPrefix(svg, []byte("<svg")) {
+		t.Error("qrCodeSVG did not return an SVG image")
+	}
+}
+
+// qrPower returns α^exponent in GF(2^8)
+func qrPower(exponent int) byte {
+	result := byte(1)
+	for i := 0; i < exponent; i++ {
+		result = qrMultiply(result, 0x02)
+	}
+	return result
+}
+
+func qrBit(dark bool) string {
+	if dark {
+		return "1"
+	}
+	return "0"
+}
+
+func newTestQRMatrix(version int) *qrMatrix {
+	size := 17 + 4*version
+	code := &qrMatrix{size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for y := range code.modules {
+		code.modules[y] = make([]bool, size)
+		code.function[y] = make([]bool, size)
+	}
+	return code
+}
+
+// qrReadFormatBits reads both copies of the format information, bit 14 first
+func qrReadFormatBits(modules [][]bool) (string, string) {
+	size := len(modules)
+	// Positions of bits 0 to 14 as (x, y) around the top left finder pattern, then along the other two
+	var first, second [15][2]int
+	for i := 0; i <= 5; i++ {
+		first[i] = [2]int{8, i}
+	}
+	first[6] = [2]int{8, 7}
+	first[7] = [2]int{8, 8}
+	first[8] = [2]int{7, 8}
+	for i := 9; i < 15; i++ {
+		first[i] = [2]int{14 - i, 8}
+	}
+	for i := 0; i < 8; i++ {
+		second[i] = [2]int{size - 1 - i, 8}
+	}
+	for i := 8; i < 15; i++ {
+		second[i] = [2]int{8, size - 15 + i}
+	}
+
+	var a, b strings.Builder
+	for i := 14; i >= 0; i-- {
+		a.WriteString(qrBit(modules[first[i][1]][first[i][0]]))
+		b.WriteString(qrBit(modules[second[i][1]][second[i][0]]))
+	}
+	return a.String(), b.String()
+}
+
+// decodeTestQRCode decodes a level M byte mode QR code without errors, checking that every block is a
+// valid Reed-Solomon code word
+func decodeTestQRCode(modules [][]bool) ([]byte, error) {
+	size := len(modules)
+	version := (size - 17) / 4
+	if version < 1 || version > len(qrLayouts) || size != 17+4*version {
+		return nil, fmt.Errorf("unexpected size %d", size)
+	}
+
+	first, second := qrReadFormatBits(modules)
+	if first != second {
+		return nil, fmt.Errorf("format copies differ: %s and %s", first, second)
+	}
+	mask := -1
+	for i, format := range qrFormatStringsM {
+		if format == first {
+			mask = i
+		}
+	}
+	if mask < 0 {
+		return nil, fmt.Errorf("format %s is not level M", first)
+	}
+	if !modules[size-8][8] {
+		return nil, fmt.Errorf("the dark module is light")
+	}
+
+	// Unmask a copy and read the data modules in placement order
+	code := newTestQRMatrix(version)
+	code.drawFunctionPatterns(version)
+	for y := range modules {
+		copy(code.modules[y], modules[y])
+	}
+	code.applyMask(mask)
+
+	var bits []bool
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := ((size-1-right)/2)%2 == 0
+		if right < 6 {
+			upward = ((size-1-(right+1))/2)%2 == 0
+		}
+		for vertical := 0; vertical < size; vertical++ {
+			y := vertical
+			if upward {
+				y = size - 1 - vertical
+			}
+			for _, x := range []int{right, right - 1} {
+				if !code.function[y][x] {
+					bits = append(bits, code.modules[y][x])
+				}
+			}
+		}
+	}
+
+	layout := qrLayouts[version-1]
+	blockCount := layout.group1Blocks + layout.group2Blocks
+	total := layout.dataCodewords() + blockCount*layout.eccPerBlock
+	if len(bits) < total*8 {
+		return nil, fmt.Errorf("only %d data modules for %d codewords", len(bits), total)
+	}
+	codewords := qrBitBuffer(bits[:total*8]).bytes()
+
+	// Deinterleave: data codewords column by column across the blocks, then error correction codewords
+	blocks := make([][]byte, blockCount)
+	next := 0
+	for column := 0; column < layout.group1Data || column < layout.group2Data; column++ {
+		for i := range blocks {
+			length := layout.group1Data
+			if i >= layout.group1Blocks {
+				length = layout.group2Data
+			}
+			if column < length {
+				blocks[i] = append(blocks[i], codewords[next])
+				next++
+			}
+		}
+	}
+	dataLengths := make([]int, blockCount)
+	for i := range blocks {
+		dataLengths[i] = len(blocks[i])
+	}
+	for column := 0; column < layout.eccPerBlock; column++ {
+		for i := range blocks {
+			blocks[i] = append(blocks[i], codewords[next])
+			next++
+		}
+	}
+
+	var data []byte
+	for i, block := range blocks {
+		// A valid code word is divisible by the generator polynomial: it is zero at α^0 to α^(ecc-1)
+		for j := 0; j < layout.eccPerBlock; j++ {
+			root := qrPower(j)
+			var value byte
+			for _, codeword := range block {
+				value = qrMultiply(value, root) ^ codeword
+			}
+			if value != 0 {
+				return nil, fmt.Errorf("block %d has a non-zero syndrome %d", i, j)
+			}
+		}
+		data = append(data, block[:dataLengths[i]]...)
+	}
+
+	// Byte mode segment
+	var stream qrBitBuffer
+	for _, b := range data {
+		stream.append(int(b), 8)
+	}
+	read := func(length int) int {
+		value := 0
+		for i := 0; i < length; i++ {
+			value <<= 1
+			if stream[0] {
+				value |= 1
+			}
+			stream = stream[1:]
+		}
+		return value
+	}
+	if mode := read(4); mode != 0x4 {
+		return nil, fmt.Errorf("mode %#x is not byte mode", mode)
+	}
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	count := read(countBits)
+	if 4+countBits+count*8 > len(data)*8 {
+		return nil, fmt.Errorf("character count %d does not fit", count)
+	}
+	decoded := make([]byte, count)
+	for i := range decoded {
+		decoded[i] = byte(read(8))
+	}
+	return decoded, nil
+}
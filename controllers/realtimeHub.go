@@ -0,0 +1,342 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// realtimeTopics are what realtime clients can subscribe to: changes to orders, to their items and to
+// tables, and the notifications of the connected user sent to the PUSH channel
+var realtimeTopics = []string{"orders", "order_items", "tables", "notifications"}
+
+// RealtimeEvent is a change to an order, an order item or a table pushed to the connected clients. Type
+// is the action of the change as recorded in the order history (ORDER_CREATED, ITEM_ADDED, STATUS_CHANGED,
+// ITEM_VOIDED, ORDER_CLOSED...), ORDER_STATUS_CHANGED when the status derived from the items changed, or
+// TABLE_CREATED, TABLE_UPDATED, TABLE_STATUS_CHANGED or TABLE_DELETED for tables. Changes seen through
+// change streams do not say who made them.
+type RealtimeEvent struct {
+	Type          string      `json:"type"`
+	Topic         string      `json:"topic"`
+	Order_id      string      `json:"order_id,omitempty"`
+	Order_item_id *string     `json:"order_item_id,omitempty"`
+	Order_number  int         `json:"order_number,omitempty"`
+	Location_id   *string     `json:"location_id"`
+	Table_id      *string     `json:"table_id"`
+	Field         *string     `json:"field,omitempty"`
+	Value         interface{} `json:"value,omitempty"`
+	Changed_by    string      `json:"changed_by,omitempty"`
+	At            time.Time   `json:"at"`
+}
+
+// RealtimeSubscription says which events a client receives: the events of its topics, optionally only
+// those of a location, a table or an order
+type RealtimeSubscription struct {
+	Topics      []string `json:"topics"`
+	Location_id string   `json:"location_id,omitempty"`
+	Table_id    string   `json:"table_id,omitempty"`
+	Order_id    string   `json:"order_id,omitempty"`
+}
+
+// hasTopic reports whether the subscription includes a topic
+func (subscription RealtimeSubscription) hasTopic(topic string) bool {
+	for _, name := range subscription.Topics {
+		if name == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// wants reports whether an event matches the subscription
+func (subscription RealtimeSubscription) wants(event RealtimeEvent) bool {
+	switch {
+	case !subscription.hasTopic(event.Topic):
+		return false
+	case subscription.Location_id != "" && (event.Location_id == nil || *event.Location_id != subscription.Location_id):
+		return false
+	case subscription.Table_id != "" && (event.Table_id == nil || *event.Table_id != subscription.Table_id):
+		return false
+	case subscription.Order_id != "" && event.Order_id != subscription.Order_id:
+		return false
+	}
+	return true
+}
+
+// realtimeClient is a connected POS, KDS or host stand
+type realtimeClient struct {
+	// userId is the user (or paired device) the client connected as
+	userId string
+	// send holds the encoded messages waiting to be written; the hub closes it to disconnect the client
+	send         chan []byte
+	subscription RealtimeSubscription
+}
+
+// realtimeHub fans events out to the connected clients of this instance
+type realtimeHub struct {
+	lock    sync.RWMutex
+	clients map[*realtimeClient]bool
+}
+
+var orderEvents = &realtimeHub{clients: map[*realtimeClient]bool{}}
+
+func (hub *realtimeHub) register(client *realtimeClient) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	hub.clients[client] = true
+}
+
+// unregister disconnects a client, once
+func (hub *realtimeHub) unregister(client *realtimeClient) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	if hub.clients[client] {
+		delete(hub.clients, client)
+		close(client.send)
+	}
+}
+
+// subscribe replaces the subscription of a client
+func (hub *realtimeHub) subscribe(client *realtimeClient, subscription RealtimeSubscription) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	client.subscription = subscription
+}
+
+// connected reports whether any client is connected, so events are only built when someone listens
+func (hub *realtimeHub) connected() bool {
+	hub.lock.RLock()
+	defer hub.lock.RUnlock()
+	return len(hub.clients) > 0
+}
+
+// publish sends an event to the clients subscribed to it. Clients too slow to keep up are disconnected
+// rather than holding up the others; they reconnect and reload what they missed.
+func (hub *realtimeHub) publish(event RealtimeEvent) {
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	for client := range hub.clients {
+		if !client.subscription.wants(event) {
+			continue
+		}
+		select {
+		case client.send <- encoded:
+		default:
+			delete(hub.clients, client)
+			close(client.send)
+		}
+	}
+}
+
+// notify sends a notification to the clients of a user subscribed to notifications. Like events,
+// notifications are not queued for clients too slow to take them.
+func (hub *realtimeHub) notify(userId string, notification models.Notification) {
+	encoded, err := json.Marshal(gin.H{"type": "NOTIFICATION", "topic": "notifications", "notification": notification})
+	if err != nil {
+		return
+	}
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	for client := range hub.clients {
+		if client.userId != userId || !client.subscription.hasTopic("notifications") {
+			continue
+		}
+		select {
+		case client.send <- encoded:
+		default:
+			delete(hub.clients, client)
+			close(client.send)
+		}
+	}
+}
+
+// publishOrderEvents publishes the changes this instance makes, unless change streams already bring
+// them to the clients of every instance
+func publishOrderEvents(ctx context.Context, events ...RealtimeEvent) {
+	if changeStreamsActive() {
+		return
+	}
+	broadcastOrderEvents(ctx, events...)
+}
+
+// broadcastOrderEvents completes events with their order's number, location and table and publishes them.
+// Values of fields with personal data are left out.
+func broadcastOrderEvents(ctx context.Context, events ...RealtimeEvent) {
+	if len(events) == 0 || !orderEvents.connected() {
+		return
+	}
+	orderIds := []string{}
+	for _, event := range events {
+		orderIds = append(orderIds, event.Order_id)
+	}
+	cursor, err := orderCollection.Find(ctx, bson.M{"order_id": bson.M{"$in": orderIds}})
+	if err != nil {
+		log.Println("failed to load the orders of realtime events:", err)
+		return
+	}
+	var orders []models.Order
+	if err = cursor.All(ctx, &orders); err != nil {
+		log.Println("failed to load the orders of realtime events:", err)
+		return
+	}
+	byId := map[string]models.Order{}
+	for _, order := range orders {
+		byId[order.Order_id] = order
+	}
+	for _, event := range events {
+		order := byId[event.Order_id]
+		event.Order_number = order.Order_number
+		event.Location_id = order.Location_id
+		event.Table_id = order.Table_id
+		event.Topic = "orders"
+		if event.Order_item_id != nil {
+			event.Topic = "order_items"
+		}
+		if event.Field != nil && realtimePiiField(*event.Field) {
+			event.Value = nil
+		}
+		orderEvents.publish(event)
+	}
+}
+
+// realtimePiiField reports whether a changed field, or any field it is nested in, holds personal data
+func realtimePiiField(field string) bool {
+	for _, name := range strings.Split(field, ".") {
+		if _, ok := defaultPiiFieldRules[strings.ToLower(name)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRealtimeSubscription reads a subscription, subscribing to every topic when none is given
+func parseRealtimeSubscription(subscription RealtimeSubscription) (RealtimeSubscription, bool) {
+	if len(subscription.Topics) == 0 {
+		subscription.Topics = realtimeTopics
+	}
+	for _, name := range subscription.Topics {
+		known := false
+		for _, topic := range realtimeTopics {
+			known = known || name == topic
+		}
+		if !known {
+			return subscription, false
+		}
+	}
+	return subscription, true
+}
+
+// realtimeCommand is a message clients send to change their subscription
+type realtimeCommand struct {
+	Action string `json:"action"`
+	RealtimeSubscription
+}
+
+// ServeRealtime opens a WebSocket connection pushing order, order item and table changes as they happen,
+// so POS, KDS and host stand clients do not need to poll, and the user's notifications sent to PUSH. The
+// subscription is given as query parameters (topics, a comma separated list of orders, order_items, tables
+// and notifications, by default all; location_id, table_id and order_id) and can be changed by sending
+// {"action":"subscribe","topics":["order_items"],"location_id":"..."}.
+// Browsers cannot set headers on WebSocket requests, so the token can also be given as the token query
+// parameter; pages may only connect from the origins websocketOriginAllowed allows. The server pings every
+// 30 seconds and drops clients that stop answering.
+func ServeRealtime() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isWebsocketUpgrade(c.Request) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "this endpoint only accepts websocket connections"})
+			return
+		}
+		var topics []string
+		if value := c.Query("topics"); value != "" {
+			topics = strings.Split(value, ",")
+		}
+		subscription, ok := parseRealtimeSubscription(RealtimeSubscription{
+			Topics:      topics,
+			Location_id: c.Query("location_id"),
+			Table_id:    c.Query("table_id"),
+			Order_id:    c.Query("order_id"),
+		})
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "topics must be orders, order_items, tables or notifications"})
+			return
+		}
+		if !websocketOriginAllowed(c.Request) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "websocket connections are not allowed from this origin"})
+			return
+		}
+		ws, err := upgradeWebsocket(c.Writer, c.Request)
+		if err != nil {
+			log.Println("websocket upgrade failed:", err)
+			return
+		}
+		defer ws.Close()
+
+		client := &realtimeClient{userId: c.GetString("uid"), send: make(chan []byte, 64), subscription: subscription}
+		orderEvents.register(client)
+		defer orderEvents.unregister(client)
+
+		reply := func(message interface{}) {
+			encoded, _ := json.Marshal(message)
+			ws.WriteMessage(websocketText, encoded)
+		}
+		reply(gin.H{"type": "SUBSCRIBED", "subscription": subscription})
+
+		// Events are written by their own goroutine, which also pings the client
+		go func() {
+			ping := time.NewTicker(30 * time.Second)
+			defer ping.Stop()
+			for {
+				select {
+				case message, ok := <-client.send:
+					if !ok {
+						ws.WriteMessage(websocketClose, nil)
+						ws.Close()
+						return
+					}
+					if err := ws.WriteMessage(websocketText, message); err != nil {
+						ws.Close()
+						return
+					}
+				case <-ping.C:
+					if err := ws.WriteMessage(websocketPing, nil); err != nil {
+						ws.Close()
+						return
+					}
+				}
+			}
+		}()
+
+		for {
+			// Any frame, pongs included, shows the client is still there
+			ws.SetReadDeadline(time.Now().Add(70 * time.Second))
+			_, message, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var command realtimeCommand
+			if err := json.Unmarshal(message, &command); err != nil || command.Action != "subscribe" {
+				reply(gin.H{"type": "ERROR", "error": `messages must be {"action":"subscribe",...}`})
+				continue
+			}
+			subscription, ok := parseRealtimeSubscription(command.RealtimeSubscription)
+			if !ok {
+				reply(gin.H{"type": "ERROR", "error": "topics must be orders, order_items, tables or notifications"})
+				continue
+			}
+			orderEvents.subscribe(client, subscription)
+			reply(gin.H{"type": "SUBSCRIBED", "subscription": subscription})
+		}
+	}
+}
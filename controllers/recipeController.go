@@ -0,0 +1,222 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var recipeCollection *mongo.Collection = database.OpenCollection(database.Client, "recipe")
+
+type RecipeIngredientView struct {
+	Inventory_item_id string        `json:"inventory_item_id"`
+	Name              string        `json:"name"`
+	Unit              string        `json:"unit"`
+	Quantity          float64       `json:"quantity"`
+	Unit_cost         *float64      `json:"unit_cost"`
+	Cost              *models.Money `json:"cost"`
+}
+
+type RecipeView struct {
+	Recipe_id            string                 `json:"recipe_id"`
+	Food_id              string                 `json:"food_id"`
+	Ingredients          []RecipeIngredientView `json:"ingredients"`
+	Ingredient_cost      models.Money           `json:"ingredient_cost"`
+	Uncosted_ingredients int                    `json:"uncosted_ingredients"`
+	Food_cost            *models.Money          `json:"food_cost"`
+	Updated_by           string                 `json:"updated_by"`
+	Updated_at           time.Time              `json:"updated_at"`
+}
+
+// checkRecipeIngredients checks that the inventory items a recipe uses exist and are listed once
+func checkRecipeIngredients(ctx context.Context, ingredients []models.RecipeIngredient) error {
+	ids := []string{}
+	for _, ingredient := range ingredients {
+		ids = append(ids, *ingredient.Inventory_item_id)
+	}
+	cursor, err := inventoryItemCollection.Find(ctx, bson.M{"inventory_item_id": bson.M{"$in": ids}})
+	if err != nil {
+		return err
+	}
+	var items []models.InventoryItem
+	if err = cursor.All(ctx, &items); err != nil {
+		return err
+	}
+	itemsById := map[string]models.InventoryItem{}
+	for _, item := range items {
+		itemsById[item.Inventory_item_id] = item
+	}
+
+	listed := map[string]bool{}
+	for _, id := range ids {
+		if _, ok := itemsById[id]; !ok {
+			return fmt.Errorf("inventory item %s was not found", id)
+		}
+		if listed[id] {
+			return fmt.Errorf("inventory item %s is listed twice", *itemsById[id].Name)
+		}
+		listed[id] = true
+	}
+	return nil
+}
+
+// recipeView costs a recipe from the latest unit costs of its inventory items. Ingredients whose item
+// has no unit cost yet are counted in Uncosted_ingredients, so an incomplete cost can be spotted.
+func recipeView(ctx context.Context, recipe models.Recipe, food models.Food) (RecipeView, error) {
+	view := RecipeView{Recipe_id: recipe.Recipe_id, Food_id: recipe.Food_id, Ingredients: []RecipeIngredientView{}, Food_cost: food.Cost, Updated_by: recipe.Updated_by, Updated_at: recipe.Updated_at}
+
+	// Items deleted since the recipe was written are shown by id, without a cost
+	ids := []string{}
+	for _, ingredient := range recipe.Ingredients {
+		ids = append(ids, *ingredient.Inventory_item_id)
+	}
+	cursor, err := inventoryItemCollection.Find(ctx, bson.M{"inventory_item_id": bson.M{"$in": ids}})
+	if err != nil {
+		return view, err
+	}
+	var items []models.InventoryItem
+	if err = cursor.All(ctx, &items); err != nil {
+		return view, err
+	}
+	itemsById := map[string]models.InventoryItem{}
+	for _, item := range items {
+		itemsById[item.Inventory_item_id] = item
+	}
+
+	var total float64
+	for _, ingredient := range recipe.Ingredients {
+		line := RecipeIngredientView{Inventory_item_id: *ingredient.Inventory_item_id, Quantity: *ingredient.Quantity}
+		if item, ok := itemsById[line.Inventory_item_id]; ok {
+			line.Name = *item.Name
+			line.Unit = *item.Unit
+			line.Unit_cost = item.Unit_cost
+		}
+		if line.Unit_cost != nil {
+			cost := models.MoneyFromFloat(line.Quantity * *line.Unit_cost)
+			line.Cost = &cost
+			total += line.Quantity * *line.Unit_cost
+		} else {
+			view.Uncosted_ingredients++
+		}
+		view.Ingredients = append(view.Ingredients, line)
+	}
+	view.Ingredient_cost = models.MoneyFromFloat(total)
+	return view, nil
+}
+
+// GetFoodRecipe returns a food's recipe with the cost of its ingredients, next to the food's own cost
+func GetFoodRecipe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		foodId := c.Param("food_id")
+		var food models.Food
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
+		var recipe models.Recipe
+		if err := recipeCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&recipe); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "the food has no recipe"})
+			return
+		}
+
+		view, err := recipeView(ctx, recipe, food)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while costing the recipe"})
+			return
+		}
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+// SetFoodRecipe creates or replaces a food's recipe
+func SetFoodRecipe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var recipe models.Recipe
+		if err := c.BindJSON(&recipe); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(recipe); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		foodId := c.Param("food_id")
+		var food models.Food
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
+		if err := checkRecipeIngredients(ctx, recipe.Ingredients); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// A replaced recipe keeps its id and creation date
+		var existing models.Recipe
+		err := recipeCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&existing)
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		if err == nil {
+			recipe.ID = existing.ID
+			recipe.Created_at = existing.Created_at
+		} else if err == mongo.ErrNoDocuments {
+			recipe.ID = primitive.NewObjectID()
+			recipe.Created_at = now
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the recipe"})
+			return
+		}
+		recipe.Recipe_id = recipe.ID.Hex()
+		recipe.Food_id = foodId
+		recipe.Updated_by = c.GetString("uid")
+		recipe.Updated_at = now
+
+		upsert := true
+		opt := options.ReplaceOptions{Upsert: &upsert}
+		if _, err := recipeCollection.ReplaceOne(ctx, bson.M{"food_id": foodId}, recipe, &opt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "recipe was not saved"})
+			return
+		}
+
+		view, err := recipeView(ctx, recipe, food)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while costing the recipe"})
+			return
+		}
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+// DeleteFoodRecipe removes a food's recipe
+func DeleteFoodRecipe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := recipeCollection.DeleteOne(ctx, bson.M{"food_id": c.Param("food_id")})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "recipe could not be deleted"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "the food has no recipe"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
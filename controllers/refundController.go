@@ -0,0 +1,431 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var creditNoteCollection *mongo.Collection = database.OpenCollection(database.Client, "creditNote")
+
+type RefundRequest struct {
+	Type           string   `json:"type" validate:"required,eq=FULL|eq=PARTIAL"`
+	Order_item_ids []string `json:"order_item_ids"`
+	Reason         string   `json:"reason" validate:"required,max=500"`
+	// Provider_refund_id is the payment provider's id of the refund, when it was made there too
+	Provider_refund_id *string `json:"provider_refund_id" validate:"omitempty,max=100"`
+}
+
+// RefundInvoice refunds a paid invoice, either everything still refundable (FULL) or selected
+// order items (PARTIAL), and issues a credit note linked to the invoice. Partial refunds
+// reverse each item's share of the taxes and service charge; the tip is only refunded with FULL.
+func RefundInvoice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request RefundRequest
+		var invoice models.Invoice
+
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		invoiceId := c.Param("invoice_id")
+		if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoiceId}).Decode(&invoice); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
+		if invoice.Payment_status == nil || *invoice.Payment_status != "PAID" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only paid invoices can be refunded"})
+			return
+		}
+
+		creditNote, err := buildCreditNote(ctx, invoice, request)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		creditNote.Authorized_by = c.GetString("uid")
+		creditNote.Provider_refund_id = request.Provider_refund_id
+
+		err = issueCreditNote(ctx, invoice, &creditNote)
+		if err == errRefundConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "credit note was not created"})
+			return
+		}
+
+		refunded := invoice.Refunded_amount + creditNote.Total
+		recordOrderRevisions(ctx, creditNote.Authorized_by, orderRevision{orderId: invoice.Order_id, action: "INVOICE_REFUNDED", field: "refunded_amount", oldValue: invoice.Refunded_amount.Float(), newValue: refunded.Float()})
+		c.JSON(http.StatusOK, creditNote)
+	}
+}
+
+var errRefundConflict = errors.New("invoice was changed concurrently, please retry")
+
+// issueCreditNote records a credit note's refund on its paid invoice and stores the credit note with its
+// number. The invoice is written first on the condition that its refunded_amount is still the one read,
+// so two concurrent refunds cannot both be based on the same remaining balance; errRefundConflict is
+// returned when it changed. The invoice change is undone when the credit note cannot be stored.
+func issueCreditNote(ctx context.Context, invoice models.Invoice, creditNote *models.CreditNote) error {
+	refunded := invoice.Refunded_amount + creditNote.Total
+	set := bson.D{{"refunded_amount", refunded}, {"updated_at", creditNote.Created_at}}
+	if refunded >= invoice.Grand_total {
+		set = append(set, bson.E{"payment_status", "REFUNDED"})
+	}
+	update := bson.D{{"$set", set}}
+	var lineIds []string
+	for _, line := range creditNote.Lines {
+		lineIds = append(lineIds, line.Order_item_id)
+	}
+	if len(lineIds) > 0 {
+		update = append(update, bson.E{"$addToSet", bson.D{{"refunded_items", bson.D{{"$each", lineIds}}}}})
+	}
+
+	result, err := invoiceCollection.UpdateOne(
+		ctx,
+		bson.M{"invoice_id": invoice.Invoice_id, "payment_status": "PAID", "refunded_amount": invoice.Refunded_amount},
+		update,
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return errRefundConflict
+	}
+
+	number, err := nextCounter(ctx, "credit_note")
+	if err == nil {
+		creditNote.Credit_note_number = fmt.Sprintf("CN-%06d", number)
+		_, err = creditNoteCollection.InsertOne(ctx, creditNote)
+	}
+	if err != nil {
+		// Undo the invoice change so the refund can be retried, leaving any refund recorded meanwhile;
+		// with this refund taken back the invoice is no longer fully refunded
+		undo := bson.D{
+			{"$inc", bson.D{{"refunded_amount", -creditNote.Total}}},
+			{"$set", bson.D{{"payment_status", "PAID"}}},
+		}
+		if len(lineIds) > 0 {
+			undo = append(undo, bson.E{"$pullAll", bson.D{{"refunded_items", lineIds}}})
+		}
+		if _, undoErr := invoiceCollection.UpdateOne(ctx, bson.M{"invoice_id": invoice.Invoice_id}, undo); undoErr != nil {
+			log.Println("failed to undo the refund of invoice", invoice.Invoice_id, ":", undoErr)
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return errRefundConflict
+		}
+		return err
+	}
+	return nil
+}
+
+// amountCreditNote is the credit note of an amount refunded at the payment provider rather than of
+// selected items: it reverses that share of every amount of the invoice
+func amountCreditNote(invoice models.Invoice, amount models.Money, reason string) models.CreditNote {
+	var creditNote models.CreditNote
+	creditNote.ID = primitive.NewObjectID()
+	creditNote.Credit_note_id = creditNote.ID.Hex()
+	creditNote.Invoice_id = invoice.Invoice_id
+	creditNote.Order_id = invoice.Order_id
+	creditNote.Type = "PARTIAL"
+	creditNote.Reason = reason
+	creditNote.Lines = []models.CreditNoteLine{}
+	creditNote.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	share := 0.0
+	if invoice.Grand_total > 0 {
+		share = float64(amount) / float64(invoice.Grand_total)
+	}
+	creditNote.Subtotal = invoice.Subtotal.Mul(share)
+	creditNote.Discount_total = invoice.Discount_total.Mul(share)
+	creditNote.Service_charge = invoice.Service_charge.Mul(share)
+	if invoice.Tip != nil {
+		creditNote.Tip = invoice.Tip.Mul(share)
+	}
+	creditNote.Tax_lines = []models.InvoiceTaxLine{}
+	for _, line := range invoice.Tax_lines {
+		creditNote.Tax_lines = append(creditNote.Tax_lines, models.InvoiceTaxLine{
+			Name:           line.Name,
+			Tax_class:      line.Tax_class,
+			Rate:           line.Rate,
+			Taxable_amount: creditNote.Subtotal - creditNote.Discount_total,
+			Amount:         line.Amount.Mul(share),
+		})
+		creditNote.Tax_total += line.Amount.Mul(share)
+	}
+
+	// Rounding differences go on the subtotal, so the credit note adds up to the amount refunded
+	total := creditNote.Subtotal - creditNote.Discount_total + creditNote.Service_charge + creditNote.Tip
+	if !invoice.Prices_include_tax {
+		total += creditNote.Tax_total
+	}
+	creditNote.Subtotal += amount - total
+	creditNote.Total = amount
+	return creditNote
+}
+
+// buildCreditNote works out what a refund request gives back. A FULL refund reverses whatever is left
+// of the invoice after earlier credit notes, so all credit notes together never exceed the invoice.
+func buildCreditNote(ctx context.Context, invoice models.Invoice, request RefundRequest) (models.CreditNote, error) {
+	var creditNote models.CreditNote
+
+	remaining := invoice.Grand_total - invoice.Refunded_amount
+	if remaining <= 0 {
+		return creditNote, fmt.Errorf("invoice has already been refunded in full")
+	}
+
+	refundable, err := refundableItems(ctx, invoice)
+	if err != nil {
+		return creditNote, err
+	}
+
+	creditNote.ID = primitive.NewObjectID()
+	creditNote.Credit_note_id = creditNote.ID.Hex()
+	creditNote.Invoice_id = invoice.Invoice_id
+	creditNote.Order_id = invoice.Order_id
+	creditNote.Type = request.Type
+	creditNote.Reason = request.Reason
+	creditNote.Lines = []models.CreditNoteLine{}
+	creditNote.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	if request.Type == "FULL" {
+		for _, orderItem := range refundable {
+			creditNote.Lines = append(creditNote.Lines, creditNoteLine(orderItem))
+		}
+
+		previous, err := invoiceCreditNotes(ctx, invoice.Invoice_id)
+		if err != nil {
+			return creditNote, err
+		}
+
+		var tip models.Money
+		if invoice.Tip != nil {
+			tip = *invoice.Tip
+		}
+		creditNote.Subtotal = invoice.Subtotal
+		creditNote.Discount_total = invoice.Discount_total
+		creditNote.Service_charge = invoice.Service_charge
+		creditNote.Tip = tip
+		taxes := map[string]models.Money{}
+		for _, note := range previous {
+			creditNote.Subtotal -= note.Subtotal
+			creditNote.Discount_total -= note.Discount_total
+			creditNote.Service_charge -= note.Service_charge
+			creditNote.Tip -= note.Tip
+			for _, line := range note.Tax_lines {
+				taxes[line.Tax_class+"/"+line.Name] += line.Amount
+			}
+		}
+		creditNote.Tax_lines = []models.InvoiceTaxLine{}
+		for _, line := range invoice.Tax_lines {
+			creditNote.Tax_lines = append(creditNote.Tax_lines, models.InvoiceTaxLine{
+				Name:           line.Name,
+				Tax_class:      line.Tax_class,
+				Rate:           line.Rate,
+				Taxable_amount: creditNote.Subtotal - creditNote.Discount_total,
+				Amount:         line.Amount - taxes[line.Tax_class+"/"+line.Name],
+			})
+		}
+	} else {
+		if invoice.Split_type != nil && *invoice.Split_type == "EVEN" {
+			return creditNote, fmt.Errorf("evenly split invoices can only be refunded in full")
+		}
+		if len(request.Order_item_ids) == 0 {
+			return creditNote, fmt.Errorf("order_item_ids are required for a partial refund")
+		}
+
+		selected := map[string]bool{}
+		for _, orderItemId := range request.Order_item_ids {
+			orderItem, ok := refundable[orderItemId]
+			if !ok {
+				return creditNote, fmt.Errorf("order item %s is not refundable on this invoice", orderItemId)
+			}
+			if selected[orderItemId] {
+				continue
+			}
+			selected[orderItemId] = true
+			creditNote.Lines = append(creditNote.Lines, creditNoteLine(orderItem))
+			creditNote.Subtotal += *orderItem.Unit_price
+		}
+
+		// Each item carries its proportional share of the invoice's discounts, taxes and service charge
+		share := 0.0
+		if invoice.Subtotal > 0 {
+			share = float64(creditNote.Subtotal) / float64(invoice.Subtotal)
+		}
+		creditNote.Discount_total = invoice.Discount_total.Mul(share)
+		creditNote.Service_charge = invoice.Service_charge.Mul(share)
+		creditNote.Tax_lines = []models.InvoiceTaxLine{}
+		for _, line := range invoice.Tax_lines {
+			creditNote.Tax_lines = append(creditNote.Tax_lines, models.InvoiceTaxLine{
+				Name:           line.Name,
+				Tax_class:      line.Tax_class,
+				Rate:           line.Rate,
+				Taxable_amount: creditNote.Subtotal - creditNote.Discount_total,
+				Amount:         line.Amount.Mul(share),
+			})
+		}
+	}
+
+	creditNote.Tax_total = 0
+	for _, line := range creditNote.Tax_lines {
+		creditNote.Tax_total += line.Amount
+	}
+	creditNote.Total = creditNote.Subtotal - creditNote.Discount_total + creditNote.Service_charge + creditNote.Tip
+	if !invoice.Prices_include_tax {
+		creditNote.Total += creditNote.Tax_total
+	}
+
+	if creditNote.Total <= 0 {
+		return creditNote, fmt.Errorf("nothing left to refund")
+	}
+	if creditNote.Total > remaining {
+		return creditNote, fmt.Errorf("refund of %s exceeds the remaining refundable amount of %s", creditNote.Total, remaining)
+	}
+	return creditNote, nil
+}
+
+// refundableItems returns the order items billed on an invoice that have not been refunded yet, by id
+func refundableItems(ctx context.Context, invoice models.Invoice) (map[string]models.OrderItem, error) {
+	refundable := map[string]models.OrderItem{}
+
+	cursor, err := orderItemCollection.Find(ctx, bson.M{"order_id": bson.M{"$in": invoiceOrderIds(invoice)}})
+	if err != nil {
+		return refundable, err
+	}
+	var orderItems []models.OrderItem
+	if err = cursor.All(ctx, &orderItems); err != nil {
+		return refundable, err
+	}
+
+	// Evenly split invoices bill a share of the order rather than individual items
+	if invoice.Split_type != nil && *invoice.Split_type == "EVEN" {
+		return refundable, nil
+	}
+
+	billed := map[string]bool{}
+	for _, orderItemId := range invoice.Split_items {
+		billed[orderItemId] = true
+	}
+	refunded := map[string]bool{}
+	for _, orderItemId := range invoice.Refunded_items {
+		refunded[orderItemId] = true
+	}
+
+	for _, orderItem := range orderItems {
+		if orderItemStatus(orderItem) == "VOIDED" || orderItem.Unit_price == nil || refunded[orderItem.Order_item_id] {
+			continue
+		}
+		if len(billed) > 0 && !billed[orderItem.Order_item_id] {
+			continue
+		}
+		refundable[orderItem.Order_item_id] = orderItem
+	}
+	return refundable, nil
+}
+
+func creditNoteLine(orderItem models.OrderItem) models.CreditNoteLine {
+	line := models.CreditNoteLine{Order_item_id: orderItem.Order_item_id, Amount: *orderItem.Unit_price}
+	if orderItem.Food_id != nil {
+		line.Food_id = *orderItem.Food_id
+	}
+	return line
+}
+
+func invoiceCreditNotes(ctx context.Context, invoiceId string) ([]models.CreditNote, error) {
+	creditNotes := []models.CreditNote{}
+
+	opts := options.Find().SetSort(bson.D{{"created_at", 1}})
+	cursor, err := creditNoteCollection.Find(ctx, bson.M{"invoice_id": invoiceId}, opts)
+	if err != nil {
+		return creditNotes, err
+	}
+	err = cursor.All(ctx, &creditNotes)
+	return creditNotes, err
+}
+
+func GetInvoiceCreditNotes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		creditNotes, err := invoiceCreditNotes(ctx, c.Param("invoice_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing credit notes"})
+			return
+		}
+		c.JSON(http.StatusOK, creditNotes)
+	}
+}
+
+// GetCreditNotes lists credit notes issued in a period (from/to as RFC3339), newest first
+func GetCreditNotes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		createdAt := bson.M{}
+		for param, operator := range map[string]string{"from": "$gte", "to": "$lt"} {
+			if value := c.Query(param); value != "" {
+				parsed, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an RFC3339 timestamp"})
+					return
+				}
+				createdAt[operator] = parsed
+			}
+		}
+		filter := bson.M{}
+		if len(createdAt) > 0 {
+			filter["created_at"] = createdAt
+		}
+
+		opts := options.Find().SetSort(bson.D{{"created_at", -1}})
+		cursor, err := creditNoteCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing credit notes"})
+			return
+		}
+		creditNotes := []models.CreditNote{}
+		if err = cursor.All(ctx, &creditNotes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing credit notes"})
+			return
+		}
+		c.JSON(http.StatusOK, creditNotes)
+	}
+}
+
+func GetCreditNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var creditNote models.CreditNote
+		if err := creditNoteCollection.FindOne(ctx, bson.M{"credit_note_id": c.Param("credit_note_id")}).Decode(&creditNote); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "credit note was not found"})
+			return
+		}
+		c.JSON(http.StatusOK, creditNote)
+	}
+}
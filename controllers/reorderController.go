@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultLeadTimeDays is the lead time of suppliers that have not set one
+const defaultLeadTimeDays = 1
+
+// ReorderLine is a suggested quantity of an inventory item to order
+type ReorderLine struct {
+	Inventory_item_id string   `json:"inventory_item_id"`
+	Name              string   `json:"name"`
+	Unit              string   `json:"unit"`
+	On_hand           float64  `json:"on_hand"`
+	Usage_per_day     float64  `json:"usage_per_day"`
+	Reorder_point     float64  `json:"reorder_point"`
+	Par_level         float64  `json:"par_level"`
+	Quantity          float64  `json:"quantity"`
+	Unit_cost         *float64 `json:"unit_cost"`
+	Cost              *float64 `json:"cost"`
+}
+
+// ReorderSuggestion is what to order from a supplier; Supplier_id is empty for items no supplier sells
+type ReorderSuggestion struct {
+	Supplier_id    string        `json:"supplier_id"`
+	Name           string        `json:"name"`
+	Lead_time_days int           `json:"lead_time_days"`
+	Lines          []ReorderLine `json:"lines"`
+	Total_cost     float64       `json:"total_cost"`
+}
+
+// usageRates returns how much of each inventory item is used per day, from the depletions and waste of
+// the last days, at a location or, when locationId is empty, at all locations together
+func usageRates(ctx context.Context, inventoryItemIds []string, locationId string, days int) (map[string]float64, error) {
+	rates := map[string]float64{}
+	since := time.Now().AddDate(0, 0, -days)
+
+	match := bson.D{
+		{"inventory_item_id", bson.D{{"$in", inventoryItemIds}}},
+		{"type", bson.D{{"$in", bson.A{"DEPLETION", "WASTE"}}}},
+		{"created_at", bson.D{{"$gte", since}}},
+	}
+	if locationId != "" {
+		match = append(match, bson.E{"location_id", locationId})
+	}
+	matchStage := bson.D{{"$match", match}}
+	groupStage := bson.D{{"$group", bson.D{{"_id", "$inventory_item_id"}, {"used", bson.D{{"$sum", "$quantity"}}}}}}
+
+	result, err := inventoryMovementCollection.Aggregate(ctx, mongo.Pipeline{matchStage, groupStage})
+	if err != nil {
+		return rates, err
+	}
+	var rows []struct {
+		Id   string  `bson:"_id"`
+		Used float64 `bson:"used"`
+	}
+	if err = result.All(ctx, &rows); err != nil {
+		return rates, err
+	}
+	for _, row := range rows {
+		// Depletions and waste are recorded as negative quantities
+		rates[row.Id] = -row.Used / float64(days)
+	}
+	return rates, nil
+}
+
+// GetReorderSuggestions proposes what to order from each supplier. An item is reordered once its stock
+// falls to its reorder point, which defaults to what is used during the cheapest supplier's lead time, and
+// the quantity brings it back up to its par level by the time the delivery arrives.
+func GetReorderSuggestions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		days := 28
+		if c.Query("days") != "" {
+			value, err := strconv.Atoi(c.Query("days"))
+			if err != nil || value < 1 || value > 365 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 365"})
+				return
+			}
+			days = value
+		}
+		locationId := c.Query("location_id")
+
+		result, err := inventoryItemCollection.Find(ctx, bson.M{"par_level": bson.M{"$ne": nil}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing inventory items"})
+			return
+		}
+		var items []models.InventoryItem
+		if err = result.All(ctx, &items); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing inventory items"})
+			return
+		}
+		ids := []string{}
+		for _, item := range items {
+			ids = append(ids, item.Inventory_item_id)
+		}
+
+		levels, err := stockLevels(ctx, ids, locationId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while computing stock levels"})
+			return
+		}
+		rates, err := usageRates(ctx, ids, locationId, days)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while computing usage"})
+			return
+		}
+		offers, err := supplierOffers(ctx, ids)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing suppliers"})
+			return
+		}
+
+		suggestions := map[string]*ReorderSuggestion{}
+		for _, item := range items {
+			leadTime := defaultLeadTimeDays
+			var offer *SupplierOffer
+			if len(offers[item.Inventory_item_id]) > 0 {
+				offer = &offers[item.Inventory_item_id][0]
+				if offer.Lead_time_days != nil {
+					leadTime = *offer.Lead_time_days
+				}
+			}
+
+			onHand := levels[item.Inventory_item_id]
+			usage := rates[item.Inventory_item_id]
+			leadTimeUsage := usage * float64(leadTime)
+			reorderPoint := leadTimeUsage
+			if item.Reorder_point != nil {
+				reorderPoint = *item.Reorder_point
+			}
+			if onHand > reorderPoint {
+				continue
+			}
+			quantity := *item.Par_level + leadTimeUsage - onHand
+			if quantity <= 0 {
+				continue
+			}
+
+			line := ReorderLine{
+				Inventory_item_id: item.Inventory_item_id,
+				Name:              *item.Name,
+				Unit:              *item.Unit,
+				On_hand:           toFixed(onHand, 3),
+				Usage_per_day:     toFixed(usage, 3),
+				Reorder_point:     toFixed(reorderPoint, 3),
+				Par_level:         *item.Par_level,
+				Unit_cost:         item.Unit_cost,
+			}
+			key := ""
+			if offer != nil {
+				key = offer.Supplier_id
+				if offer.Min_order_quantity != nil && *offer.Min_order_quantity > 0 {
+					// Suppliers deliver in multiples of their minimum order quantity
+					quantity = math.Ceil(quantity / *offer.Min_order_quantity) * *offer.Min_order_quantity
+				}
+				unitCost := offer.Unit_cost
+				line.Unit_cost = &unitCost
+			}
+			line.Quantity = toFixed(quantity, 3)
+			if line.Unit_cost != nil {
+				cost := toFixed(line.Quantity**line.Unit_cost, 2)
+				line.Cost = &cost
+			}
+
+			suggestion, ok := suggestions[key]
+			if !ok {
+				suggestion = &ReorderSuggestion{Lead_time_days: leadTime, Lines: []ReorderLine{}}
+				if offer != nil {
+					suggestion.Supplier_id, suggestion.Name = offer.Supplier_id, offer.Name
+				}
+				suggestions[key] = suggestion
+			}
+			suggestion.Lines = append(suggestion.Lines, line)
+			if line.Cost != nil {
+				suggestion.Total_cost = toFixed(suggestion.Total_cost+*line.Cost, 2)
+			}
+		}
+
+		response := []ReorderSuggestion{}
+		for _, suggestion := range suggestions {
+			sort.Slice(suggestion.Lines, func(i, j int) bool { return suggestion.Lines[i].Name < suggestion.Lines[j].Name })
+			response = append(response, *suggestion)
+		}
+		// Items no supplier sells come last
+		sort.Slice(response, func(i, j int) bool {
+			if (response[i].Supplier_id == "") != (response[j].Supplier_id == "") {
+				return response[j].Supplier_id == ""
+			}
+			return response[i].Name < response[j].Name
+		})
+		c.JSON(http.StatusOK, response)
+	}
+}
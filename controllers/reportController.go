@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"golang-restaurant-management/models"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// menuEngineeringPopularityFactor is the share of an even sales mix a food must reach to count as
+// popular; the usual 70% rule
+const menuEngineeringPopularityFactor = 0.7
+
+type MenuEngineeringFood struct {
+	Food_id        string        `json:"food_id"`
+	Name           string        `json:"name"`
+	Menu_id        *string       `json:"menu_id"`
+	Sold           int           `json:"sold"`
+	Revenue        models.Money  `json:"revenue"`
+	Cost           *models.Money `json:"cost"`
+	Average_price  models.Money  `json:"average_price"`
+	Unit_margin    models.Money  `json:"unit_margin"`
+	Total_margin   models.Money  `json:"total_margin"`
+	Menu_mix       float64       `json:"menu_mix"`
+	Classification string        `json:"classification"`
+}
+
+type MenuEngineeringReport struct {
+	From                 time.Time             `json:"from"`
+	To                   time.Time             `json:"to"`
+	Menu_id              *string               `json:"menu_id"`
+	Items_sold           int                   `json:"items_sold"`
+	Popularity_threshold float64               `json:"popularity_threshold"`
+	Average_margin       models.Money          `json:"average_margin"`
+	Foods                []MenuEngineeringFood `json:"foods"`
+	Missing_cost         []MenuEngineeringFood `json:"missing_cost"`
+}
+
+// foodSales are the order items sold of a food in a period
+type foodSales struct {
+	Food_id string       `bson:"_id"`
+	Sold    int          `bson:"sold"`
+	Revenue models.Money `bson:"revenue"`
+}
+
+// reportPeriod reads the period of a report from the optional from/to query parameters (RFC3339), by
+// default the last 30 days
+func reportPeriod(c *gin.Context) (time.Time, time.Time, error) {
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, errors.New("from must be an RFC3339 timestamp")
+		}
+		from = parsed
+	}
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, errors.New("to must be an RFC3339 timestamp")
+		}
+		to = parsed
+	}
+	if !from.Before(to) {
+		return from, to, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
+
+// menuEngineeringClass places a food in the menu engineering matrix: popular foods are STARS when their
+// margin is above average and PLOWHORSES otherwise, unpopular ones PUZZLES and DOGS
+func menuEngineeringClass(sold int, unitMargin models.Money, popularityThreshold float64, averageMargin models.Money) string {
+	popular := float64(sold) >= popularityThreshold
+	profitable := unitMargin >= averageMargin
+	switch {
+	case popular && profitable:
+		return "STAR"
+	case popular:
+		return "PLOWHORSE"
+	case profitable:
+		return "PUZZLE"
+	default:
+		return "DOG"
+	}
+}
+
+// GetMenuEngineering classifies foods by sales volume and contribution margin (price less cost) over a
+// period: the optional from/to query parameters (RFC3339), by default the last 30 days. With menu_id only
+// that menu's foods are compared. Voided items are not counted. Foods without a cost cannot be placed and
+// are listed under missing_cost; foods that did not sell at all are included, as they are the likeliest dogs.
+func GetMenuEngineering() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		from, to, err := reportPeriod(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		report := MenuEngineeringReport{From: from, To: to, Foods: []MenuEngineeringFood{}, Missing_cost: []MenuEngineeringFood{}}
+		foodFilter := bson.M{}
+		if menuId := c.Query("menu_id"); menuId != "" {
+			report.Menu_id = &menuId
+			foodFilter["menu_id"] = menuId
+		}
+		cursor, err := foodCollection.Find(ctx, foodFilter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing food items"})
+			return
+		}
+		var foods []models.Food
+		if err = cursor.All(ctx, &foods); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing food items"})
+			return
+		}
+
+		matchStage := bson.D{{"$match", bson.D{
+			{"created_at", bson.D{{"$gte", from}, {"$lt", to}}},
+			{"status", bson.D{{"$ne", "VOIDED"}}},
+			{"unit_price", bson.D{{"$ne", nil}}},
+		}}}
+		groupStage := bson.D{{"$group", bson.D{
+			{"_id", "$food_id"},
+			{"sold", bson.D{{"$sum", 1}}},
+			{"revenue", bson.D{{"$sum", "$unit_price"}}},
+		}}}
+		result, err := orderItemCollection.Aggregate(ctx, mongo.Pipeline{matchStage, groupStage})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating food sales"})
+			return
+		}
+		var sales []foodSales
+		if err = result.All(ctx, &sales); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating food sales"})
+			return
+		}
+		var foodIds []string
+		for _, food := range foods {
+			foodIds = append(foodIds, food.Food_id)
+		}
+		costs, err := recipeCosts(ctx, foodIds)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating food costs"})
+			return
+		}
+
+		salesByFood := map[string]foodSales{}
+		for _, sale := range sales {
+			salesByFood[sale.Food_id] = sale
+		}
+
+		// Archived foods only count for the periods they sold in
+		var totalMargin models.Money
+		for _, food := range foods {
+			sale, sold := salesByFood[food.Food_id]
+			if food.Deleted_at != nil && !sold {
+				continue
+			}
+			cost := foodCost(food, costs)
+			line := MenuEngineeringFood{Food_id: food.Food_id, Name: foodName(food), Menu_id: food.Menu_id, Sold: sale.Sold, Revenue: sale.Revenue, Cost: cost}
+			if line.Sold > 0 {
+				line.Average_price = models.Money(math.Round(float64(line.Revenue) / float64(line.Sold)))
+			} else if food.Price != nil {
+				line.Average_price = *food.Price
+			}
+			if cost == nil {
+				report.Missing_cost = append(report.Missing_cost, line)
+				continue
+			}
+			line.Unit_margin = line.Average_price - *cost
+			line.Total_margin = line.Revenue - *cost*models.Money(line.Sold)
+			report.Items_sold += line.Sold
+			totalMargin += line.Total_margin
+			report.Foods = append(report.Foods, line)
+		}
+
+		if len(report.Foods) > 0 {
+			report.Popularity_threshold = toFixed(float64(report.Items_sold)/float64(len(report.Foods))*menuEngineeringPopularityFactor, 2)
+		}
+		if report.Items_sold > 0 {
+			report.Average_margin = models.Money(math.Round(float64(totalMargin) / float64(report.Items_sold)))
+		}
+		for i := range report.Foods {
+			line := &report.Foods[i]
+			if report.Items_sold > 0 {
+				line.Menu_mix = toFixed(float64(line.Sold)/float64(report.Items_sold)*100, 2)
+			}
+			line.Classification = menuEngineeringClass(line.Sold, line.Unit_margin, report.Popularity_threshold, report.Average_margin)
+		}
+		sort.SliceStable(report.Foods, func(i, j int) bool { return report.Foods[i].Total_margin > report.Foods[j].Total_margin })
+
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,410 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/models"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Kinds of the fields a report query can use
+const (
+	queryString = "string"
+	queryNumber = "number"
+	queryMoney  = "money"
+	queryTime   = "time"
+)
+
+// reportQuerySource is a collection report queries can read, with the fields they may filter, group and
+// aggregate by. Fields starting with "order." are read from the document's order.
+type reportQuerySource struct {
+	collection *mongo.Collection
+	fields     map[string]string
+}
+
+var reportQuerySources = map[string]reportQuerySource{
+	"orders": {orderCollection, map[string]string{
+		"order_id": queryString, "order_number": queryNumber, "business_date": queryString, "location_id": queryString,
+		"table_id": queryString, "session_id": queryString, "channel": queryString, "status": queryString,
+		"server_id": queryString, "customer_id": queryString, "reservation_id": queryString, "billing_mode": queryString,
+		"close_reason": queryString, "created_at": queryTime, "closed_at": queryTime, "check_presented_at": queryTime,
+	}},
+	"order_items": {orderItemCollection, map[string]string{
+		"order_item_id": queryString, "order_id": queryString, "food_id": queryString, "status": queryString,
+		"unit_price": queryMoney, "weight": queryNumber, "void_reason": queryString, "voided_by": queryString,
+		"created_at": queryTime, "voided_at": queryTime, "order.location_id": queryString, "order.channel": queryString,
+		"order.server_id": queryString, "order.customer_id": queryString,
+	}},
+	"invoices": {invoiceCollection, map[string]string{
+		"invoice_id": queryString, "order_id": queryString, "location_id": queryString, "payment_method": queryString,
+		"payment_status": queryString, "invoice_status": queryString, "split_type": queryString, "voided_by": queryString,
+		"finalized_by": queryString, "subtotal": queryMoney, "discount_total": queryMoney, "tax_total": queryMoney,
+		"service_charge": queryMoney, "tip": queryMoney, "grand_total": queryMoney, "refunded_amount": queryMoney,
+		"gift_card_total": queryMoney, "deposit_total": queryMoney, "guests": queryNumber, "created_at": queryTime,
+		"paid_at": queryTime, "voided_at": queryTime,
+	}},
+}
+
+// reportQueryMaxDays is the longest period a report query may cover
+const reportQueryMaxDays = 366
+
+// reportQueryColumnName is what metric names may look like, so they cannot be read as operators or paths
+var reportQueryColumnName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+type ReportQueryFilter struct {
+	Field string `json:"field" validate:"required"`
+	// Op is how the field is compared to the value; exists matches the documents where the field is set
+	// (value true) or not (value false)
+	Op string `json:"op" validate:"required,oneof=eq ne in nin gt gte lt lte exists"`
+	// Value is a string, a number (amounts in major units), an RFC3339 timestamp for times, a list of them
+	// for in and nin, or a boolean for exists
+	Value interface{} `json:"value"`
+}
+
+type ReportQueryGroup struct {
+	Field string `json:"field" validate:"required"`
+	// Period buckets a time field by hour, or by business day, week or month
+	Period *string `json:"period" validate:"omitempty,oneof=hour day week month"`
+}
+
+type ReportQueryMetric struct {
+	Op    string  `json:"op" validate:"required,oneof=count count_distinct sum avg min max"`
+	Field *string `json:"field"`
+	// As names the metric's column, by default the op and field, e.g. sum_grand_total
+	As *string `json:"as" validate:"omitempty,max=50"`
+}
+
+// ReportQuery is an ad hoc report: the documents of a collection created in a period (from/to, by default
+// the last 30 days, at most a year) matching filters, grouped by some fields and summarised by metrics
+type ReportQuery struct {
+	Collection string              `json:"collection" validate:"required,oneof=orders order_items invoices"`
+	From       *time.Time          `json:"from"`
+	To         *time.Time          `json:"to"`
+	Filters    []ReportQueryFilter `json:"filters" validate:"omitempty,max=20,dive"`
+	Group_by   []ReportQueryGroup  `json:"group_by" validate:"omitempty,max=3,dive"`
+	Metrics    []ReportQueryMetric `json:"metrics" validate:"required,min=1,max=10,dive"`
+	// Sort is the column rows are sorted by, by default the group columns
+	Sort       *string `json:"sort"`
+	Descending bool    `json:"descending"`
+	Limit      int     `json:"limit" validate:"omitempty,min=1,max=1000"`
+}
+
+type ReportQueryResult struct {
+	Collection string                   `json:"collection"`
+	From       time.Time                `json:"from"`
+	To         time.Time                `json:"to"`
+	Columns    []string                 `json:"columns"`
+	Rows       []map[string]interface{} `json:"rows"`
+	// Truncated is true when there were more rows than the limit
+	Truncated bool `json:"truncated"`
+}
+
+// reportQueryValue converts a filter value to what the field holds in MongoDB
+func reportQueryValue(field string, kind string, value interface{}) (interface{}, error) {
+	switch kind {
+	case queryString:
+		if text, ok := value.(string); ok {
+			return text, nil
+		}
+	case queryNumber:
+		if number, ok := value.(float64); ok {
+			return number, nil
+		}
+	case queryMoney:
+		if number, ok := value.(float64); ok {
+			return models.MoneyFromFloat(number), nil
+		}
+	case queryTime:
+		if text, ok := value.(string); ok {
+			if parsed, err := time.Parse(time.RFC3339, text); err == nil {
+				return parsed, nil
+			}
+			return nil, fmt.Errorf("%s must be compared to an RFC3339 timestamp", field)
+		}
+	}
+	return nil, fmt.Errorf("%s must be compared to a %s", field, kind)
+}
+
+// reportQueryColumn names the column of a group or metric
+func reportQueryColumn(parts ...string) string {
+	return strings.ReplaceAll(strings.Join(parts, "_"), ".", "_")
+}
+
+// compileReportQuery turns a report query into an aggregation pipeline, checking every field against the
+// collection's whitelist so queries can only read what they are meant to. It returns the pipeline, the
+// columns of its rows and the kind of each column.
+func compileReportQuery(query ReportQuery, from time.Time, to time.Time, settings models.Settings) (mongo.Pipeline, []string, map[string]string, error) {
+	source := reportQuerySources[query.Collection]
+	joinOrder := false
+	fieldKind := func(field string) (string, error) {
+		kind, ok := source.fields[field]
+		if !ok {
+			return "", fmt.Errorf("%s is not a field of %s that reports can use", field, query.Collection)
+		}
+		if strings.HasPrefix(field, "order.") {
+			joinOrder = true
+		}
+		return kind, nil
+	}
+
+	period := bson.D{{"created_at", bson.D{{"$gte", from}, {"$lt", to}}}}
+	// Filters are combined with $and, so a field can be filtered more than once, e.g. between two values
+	conditions := bson.A{period}
+	for _, filter := range query.Filters {
+		kind, err := fieldKind(filter.Field)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		var condition interface{}
+		switch filter.Op {
+		case "exists":
+			set, ok := filter.Value.(bool)
+			if !ok {
+				return nil, nil, nil, fmt.Errorf("exists filters on %s need a value of true or false", filter.Field)
+			}
+			condition = bson.D{{"$eq", nil}}
+			if set {
+				condition = bson.D{{"$ne", nil}}
+			}
+		case "in", "nin":
+			values, ok := filter.Value.([]interface{})
+			if !ok || len(values) == 0 || len(values) > 100 {
+				return nil, nil, nil, fmt.Errorf("%s filters on %s need a list of 1 to 100 values", filter.Op, filter.Field)
+			}
+			converted := bson.A{}
+			for _, value := range values {
+				value, err := reportQueryValue(filter.Field, kind, value)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				converted = append(converted, value)
+			}
+			condition = bson.D{{"$" + filter.Op, converted}}
+		default:
+			value, err := reportQueryValue(filter.Field, kind, filter.Value)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			condition = bson.D{{"$" + filter.Op, value}}
+		}
+		conditions = append(conditions, bson.D{{filter.Field, condition}})
+	}
+
+	startHour := defaultBusinessDayStartHour
+	if settings.Business_day_start_hour != nil {
+		startHour = *settings.Business_day_start_hour
+	}
+	now := time.Now()
+	columns := []string{}
+	kinds := map[string]string{}
+	groupId := bson.D{}
+	for _, group := range query.Group_by {
+		kind, err := fieldKind(group.Field)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		column := reportQueryColumn(group.Field)
+		var key interface{} = "$" + group.Field
+		if group.Period != nil {
+			if kind != queryTime {
+				return nil, nil, nil, fmt.Errorf("%s is not a time and cannot be grouped by %s", group.Field, *group.Period)
+			}
+			column = reportQueryColumn(group.Field, *group.Period)
+			kind = queryString
+			if *group.Period == "hour" {
+				key = bson.D{{"$dateToString", bson.D{{"format", "%Y-%m-%dT%H:00"}, {"date", "$" + group.Field}, {"timezone", now.Format("-07:00")}}}}
+			} else {
+				key = salesPeriodKey(group.Field, salesPeriodFormats[*group.Period], startHour, now)
+			}
+		}
+		if _, ok := kinds[column]; ok {
+			return nil, nil, nil, fmt.Errorf("%s is grouped by twice", column)
+		}
+		columns = append(columns, column)
+		kinds[column] = kind
+		groupId = append(groupId, bson.E{column, key})
+	}
+
+	accumulators := bson.D{}
+	project := bson.D{{"_id", 0}}
+	for _, group := range groupId {
+		project = append(project, bson.E{group.Key, "$_id." + group.Key})
+	}
+	for _, metric := range query.Metrics {
+		column, kind := "count", queryNumber
+		if metric.Op != "count" {
+			if metric.Field == nil {
+				return nil, nil, nil, fmt.Errorf("%s metrics need a field", metric.Op)
+			}
+			fieldKind, err := fieldKind(*metric.Field)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			column, kind = reportQueryColumn(metric.Op, *metric.Field), fieldKind
+			numeric := kind == queryNumber || kind == queryMoney
+			if (metric.Op == "sum" || metric.Op == "avg") && !numeric || (metric.Op == "min" || metric.Op == "max") && !numeric && kind != queryTime {
+				return nil, nil, nil, fmt.Errorf("%s is not a number and has no %s", *metric.Field, metric.Op)
+			}
+			if metric.Op == "count_distinct" {
+				kind = queryNumber
+			}
+		}
+		if metric.As != nil {
+			if !reportQueryColumnName.MatchString(*metric.As) {
+				return nil, nil, nil, fmt.Errorf("%s is not a valid column name: use letters, digits and underscores", *metric.As)
+			}
+			column = *metric.As
+		}
+		if _, ok := kinds[column]; ok {
+			return nil, nil, nil, fmt.Errorf("there are two columns named %s", column)
+		}
+		columns = append(columns, column)
+		kinds[column] = kind
+
+		switch metric.Op {
+		case "count":
+			accumulators = append(accumulators, bson.E{column, bson.D{{"$sum", 1}}})
+			project = append(project, bson.E{column, 1})
+		case "count_distinct":
+			accumulators = append(accumulators, bson.E{column, bson.D{{"$addToSet", "$" + *metric.Field}}})
+			project = append(project, bson.E{column, bson.D{{"$size", "$" + column}}})
+		default:
+			accumulators = append(accumulators, bson.E{column, bson.D{{"$" + metric.Op, "$" + *metric.Field}}})
+			project = append(project, bson.E{column, 1})
+		}
+	}
+
+	sortBy := bson.D{}
+	if query.Sort != nil {
+		if _, ok := kinds[*query.Sort]; !ok {
+			return nil, nil, nil, fmt.Errorf("sort must be one of the columns: %s", strings.Join(columns, ", "))
+		}
+		sortBy = append(sortBy, bson.E{*query.Sort, 1})
+	} else {
+		for _, group := range groupId {
+			sortBy = append(sortBy, bson.E{group.Key, 1})
+		}
+	}
+	if query.Descending {
+		for i := range sortBy {
+			sortBy[i].Value = -1
+		}
+	}
+
+	pipeline := mongo.Pipeline{}
+	if joinOrder {
+		pipeline = append(pipeline,
+			bson.D{{"$match", period}},
+			bson.D{{"$lookup", bson.D{{"from", "order"}, {"localField", "order_id"}, {"foreignField", "order_id"}, {"as", "order"}}}},
+			bson.D{{"$addFields", bson.D{{"order", bson.D{{"$arrayElemAt", bson.A{"$order", 0}}}}}}},
+		)
+	}
+	var id interface{} = groupId
+	if len(groupId) == 0 {
+		id = nil
+	}
+	pipeline = append(pipeline,
+		bson.D{{"$match", bson.D{{"$and", conditions}}}},
+		bson.D{{"$group", append(bson.D{{"_id", id}}, accumulators...)}},
+		bson.D{{"$project", project}},
+	)
+	if len(sortBy) > 0 {
+		pipeline = append(pipeline, bson.D{{"$sort", sortBy}})
+	}
+	return pipeline, columns, kinds, nil
+}
+
+// RunReportQuery answers an ad hoc report query (see ReportQuery), so analysts can build reports without
+// a new endpoint for every question, e.g. the average check per channel and business week:
+// {"collection":"invoices","filters":[{"field":"payment_status","op":"eq","value":"PAID"}],
+// "group_by":[{"field":"created_at","period":"week"}],"metrics":[{"op":"avg","field":"grand_total"}]}.
+// Queries are compiled to an aggregation pipeline from whitelisted fields and operators only. Amounts are
+// given and returned in major units.
+func RunReportQuery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var query ReportQuery
+		if err := c.BindJSON(&query); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(query); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		to := time.Now()
+		if query.To != nil {
+			to = *query.To
+		}
+		from := to.AddDate(0, 0, -30)
+		if query.From != nil {
+			from = *query.From
+		}
+		if !from.Before(to) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+			return
+		}
+		if to.Sub(from) > reportQueryMaxDays*24*time.Hour {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("a query can cover at most %d days", reportQueryMaxDays)})
+			return
+		}
+		limit := query.Limit
+		if limit == 0 {
+			limit = 100
+		}
+		settings, err := loadSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the settings"})
+			return
+		}
+
+		pipeline, columns, kinds, err := compileReportQuery(query, from, to, settings)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// One row more than the limit tells whether rows were left out
+		pipeline = append(pipeline, bson.D{{"$limit", limit + 1}})
+		result, err := reportQuerySources[query.Collection].collection.Aggregate(ctx, pipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while running the query"})
+			return
+		}
+		var rows []bson.M
+		if err = result.All(ctx, &rows); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while running the query"})
+			return
+		}
+
+		report := ReportQueryResult{Collection: query.Collection, From: from, To: to, Columns: columns, Rows: []map[string]interface{}{}}
+		if len(rows) > limit {
+			rows = rows[:limit]
+			report.Truncated = true
+		}
+		for _, row := range rows {
+			for column, value := range row {
+				if kinds[column] != queryMoney {
+					continue
+				}
+				// Averages of amounts come back as fractions of a minor unit
+				if average, ok := value.(float64); ok {
+					value = int64(math.Round(average))
+				}
+				row[column] = moneyValue(value)
+			}
+			report.Rows = append(report.Rows, row)
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
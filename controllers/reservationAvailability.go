@@ -0,0 +1,237 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type ReservationSlot struct {
+	Time time.Time `json:"time"`
+
+	// Available is set when a table is left for the party; Tables is the number of tables left
+	Available bool `json:"available"`
+	Tables    int  `json:"tables"`
+}
+
+// tableBooking is a time a table is taken by a reservation or a seated party
+type tableBooking struct {
+	from time.Time
+	to   time.Time
+}
+
+// reservationTurn returns how long a party keeps its table: the turn time of the smallest party size
+// the party fits in, the largest one for parties larger than all of them, or TABLE_TURN_MINUTES
+// (default 90) when no turn times are configured
+func reservationTurn(slots *models.ReservationSlots, partySize int) time.Duration {
+	minutes := envInt("TABLE_TURN_MINUTES", 90)
+	if slots != nil && len(slots.Turn_times) > 0 {
+		turnTimes := append([]models.ReservationTurnTime{}, slots.Turn_times...)
+		sort.Slice(turnTimes, func(i, j int) bool { return turnTimes[i].Max_party_size < turnTimes[j].Max_party_size })
+		minutes = turnTimes[len(turnTimes)-1].Minutes
+		for _, turnTime := range turnTimes {
+			if partySize <= turnTime.Max_party_size {
+				minutes = turnTime.Minutes
+				break
+			}
+		}
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// reservationSlotTimes returns the times reservations can start on a day, every Interval_minutes
+// (default 15) within the seatings of that weekday (default 12:00 to 21:00 every day)
+func reservationSlotTimes(slots *models.ReservationSlots, day time.Time) []time.Time {
+	seatings := []models.MenuDaypart{{Start: "12:00", End: "21:00"}}
+	interval := 15
+	if slots != nil && len(slots.Seatings) > 0 {
+		seatings = slots.Seatings
+	}
+	if slots != nil && slots.Interval_minutes != nil {
+		interval = *slots.Interval_minutes
+	}
+
+	weekday := strings.ToUpper(day.Weekday().String()[:3])
+	seen := map[int64]bool{}
+	var times []time.Time
+	for _, seating := range seatings {
+		if len(seating.Days) > 0 && !containsString(seating.Days, weekday) {
+			continue
+		}
+		start, end := minutesOfDay(seating.Start), minutesOfDay(seating.End)
+		if start < 0 || end < 0 {
+			continue
+		}
+		// A seating whose End is before its Start runs past midnight
+		if end <= start {
+			end += 24 * 60
+		}
+		for minute := start; minute < end; minute += interval {
+			at := day.Add(time.Duration(minute) * time.Minute)
+			if !seen[at.Unix()] {
+				seen[at.Unix()] = true
+				times = append(times, at)
+			}
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times
+}
+
+// containsString reports whether a value is in a list
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// GetReservationAvailability lists the times a party of party_size can book on a date (YYYY-MM-DD) for
+// online booking widgets. A slot is available when a table seating the party is free for the party's
+// turn time: not out of service, not booked by an overlapping reservation and not still taken by a
+// seated party. Reservations without a table take one of the free tables.
+func GetReservationAvailability() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		now := time.Now()
+		day, err := time.ParseInLocation("2006-01-02", c.Query("date"), now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be in YYYY-MM-DD format"})
+			return
+		}
+		partySize, err := strconv.Atoi(c.Query("party_size"))
+		if err != nil || partySize < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "party_size must be at least 1"})
+			return
+		}
+
+		settings, err := loadSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the settings"})
+			return
+		}
+		turn := reservationTurn(settings.Reservation_slots, partySize)
+		slots := []ReservationSlot{}
+		var times []time.Time
+		for _, at := range reservationSlotTimes(settings.Reservation_slots, day) {
+			if at.After(now) {
+				times = append(times, at)
+			}
+		}
+		if len(times) == 0 {
+			c.JSON(http.StatusOK, gin.H{"date": c.Query("date"), "party_size": partySize, "turn_minutes": turn.Minutes(), "slots": slots})
+			return
+		}
+
+		cursor, err := tableCollection.Find(ctx, bson.M{"split_at": nil})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing tables"})
+			return
+		}
+		var tables []models.Table
+		if err = cursor.All(ctx, &tables); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing tables"})
+			return
+		}
+		combinedTables := map[string][]string{}
+		var fitting []models.Table
+		for _, table := range tables {
+			if isCombinedTable(table) {
+				combinedTables[table.Table_id] = table.Combined_table_ids
+				continue
+			}
+			if tableStatus(table) == "OUT_OF_SERVICE" || checkTableCapacity(table, partySize) != nil {
+				continue
+			}
+			fitting = append(fitting, table)
+		}
+
+		// Parties seated now keep their table for at least their turn time
+		bookings := map[string][]tableBooking{}
+		cursor, err = seatingCollection.Find(ctx, bson.M{"cleared_at": nil})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing seated parties"})
+			return
+		}
+		var seatings []models.Seating
+		if err = cursor.All(ctx, &seatings); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing seated parties"})
+			return
+		}
+		for _, seating := range seatings {
+			booking := tableBooking{from: seating.Seated_at, to: seating.Seated_at.Add(reservationTurn(settings.Reservation_slots, seating.Guests))}
+			if booking.to.Before(now) {
+				booking.to = now
+			}
+			tableIds := []string{seating.Table_id}
+			if ids, ok := combinedTables[seating.Table_id]; ok {
+				tableIds = ids
+			}
+			for _, tableId := range tableIds {
+				bookings[tableId] = append(bookings[tableId], booking)
+			}
+		}
+
+		cursor, err = reservationCollection.Find(ctx, bson.M{
+			"status":           bson.M{"$in": bson.A{"BOOKED", "CONFIRMED"}},
+			"reservation_time": bson.M{"$gt": times[0].Add(-24 * time.Hour), "$lt": times[len(times)-1].Add(turn)},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing reservations"})
+			return
+		}
+		var reservations []models.Reservation
+		if err = cursor.All(ctx, &reservations); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing reservations"})
+			return
+		}
+		var unassigned []tableBooking
+		for _, reservation := range reservations {
+			booking := tableBooking{from: *reservation.Reservation_time, to: reservation.Reservation_time.Add(reservationTurn(settings.Reservation_slots, *reservation.Party_size))}
+			if reservation.Table_id == nil {
+				unassigned = append(unassigned, booking)
+				continue
+			}
+			bookings[*reservation.Table_id] = append(bookings[*reservation.Table_id], booking)
+		}
+
+		for _, at := range times {
+			end := at.Add(turn)
+			free := 0
+			for _, table := range fitting {
+				taken := false
+				for _, booking := range bookings[table.Table_id] {
+					if booking.from.Before(end) && booking.to.After(at) {
+						taken = true
+						break
+					}
+				}
+				if !taken {
+					free++
+				}
+			}
+			for _, booking := range unassigned {
+				if booking.from.Before(end) && booking.to.After(at) {
+					free--
+				}
+			}
+			if free < 0 {
+				free = 0
+			}
+			slots = append(slots, ReservationSlot{Time: at, Available: free > 0, Tables: free})
+		}
+
+		c.JSON(http.StatusOK, gin.H{"date": c.Query("date"), "party_size": partySize, "turn_minutes": turn.Minutes(), "slots": slots})
+	}
+}
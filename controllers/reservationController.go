@@ -0,0 +1,474 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"golang-restaurant-management/database"
+	helper "golang-restaurant-management/helpers"
+	"golang-restaurant-management/models"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var reservationCollection *mongo.Collection = database.OpenCollection(database.Client, "reservation")
+
+func GetReservations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		if date := c.Query("date"); date != "" {
+			day, err := time.Parse("2006-01-02", date)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "date must be formatted as YYYY-MM-DD"})
+				return
+			}
+			filter["reservation_time"] = bson.M{"$gte": day, "$lt": day.AddDate(0, 0, 1)}
+		}
+
+		opts := options.Find().SetSort(bson.D{{"reservation_time", 1}})
+		result, err := reservationCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing reservations"})
+			return
+		}
+
+		var reservations []models.Reservation
+		if err = result.All(ctx, &reservations); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing reservations"})
+			return
+		}
+		maskedJSON(c, http.StatusOK, reservations)
+	}
+}
+
+func GetReservation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		reservationId := c.Param("reservation_id")
+		var reservation models.Reservation
+
+		if err := reservationCollection.FindOne(ctx, bson.M{"reservation_id": reservationId}).Decode(&reservation); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "reservation was not found"})
+			return
+		}
+		maskedJSON(c, http.StatusOK, reservation)
+	}
+}
+
+func CreateReservation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var reservation models.Reservation
+
+		if err := c.BindJSON(&reservation); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(reservation)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		if reservation.Reservation_time.Before(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reservation time must be in the future"})
+			return
+		}
+
+		if reservation.Table_id != nil {
+			var table models.Table
+			if err := tableCollection.FindOne(ctx, bson.M{"table_id": reservation.Table_id, "deleted_at": nil}).Decode(&table); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "table was not found"})
+				return
+			}
+			if err := checkTableCapacity(table, *reservation.Party_size); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		token, err := helper.RandomToken(16)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "reservation was not created"})
+			return
+		}
+
+		status := "BOOKED"
+		reservation.Status = &status
+		reservation.Confirmation_token = token
+		reservation.Reminder_24h_sent_at = nil
+		reservation.Reminder_2h_sent_at = nil
+		reservation.Confirmed_at = nil
+		reservation.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		reservation.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		reservation.ID = primitive.NewObjectID()
+		reservation.Reservation_id = reservation.ID.Hex()
+
+		// The deposit is held as a prepayment until it is credited on the guests' invoice
+		reservation.Prepayment_id = nil
+		if reservation.Deposit != nil {
+			if err := createDepositPrepayment(ctx, &reservation); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "reservation deposit could not be recorded"})
+				return
+			}
+		}
+
+		result, insertErr := reservationCollection.InsertOne(ctx, reservation)
+		if insertErr != nil {
+			if reservation.Prepayment_id != nil {
+				prepaymentCollection.DeleteOne(ctx, bson.M{"prepayment_id": *reservation.Prepayment_id})
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "reservation was not created"})
+			return
+		}
+		sendReservationConfirmation(ctx, reservation)
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// reservationTransitions lists, for every status a reservation can be given with PATCH, the statuses it
+// may move from. Released, cancelled and no-show reservations are final.
+var reservationTransitions = map[string][]string{
+	"BOOKED":    {"CONFIRMED"},
+	"CONFIRMED": {"BOOKED"},
+	"CANCELLED": {"BOOKED", "CONFIRMED"},
+	"NO_SHOW":   {"BOOKED", "CONFIRMED"},
+	"SEATED":    {"BOOKED", "CONFIRMED", "SEATED"},
+}
+
+func UpdateReservation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var reservation models.Reservation
+		var existingReservation models.Reservation
+		reservationId := c.Param("reservation_id")
+
+		if err := c.BindJSON(&reservation); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := reservationCollection.FindOne(ctx, bson.M{"reservation_id": reservationId}).Decode(&existingReservation); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "reservation was not found"})
+			return
+		}
+
+		var updateObj primitive.D
+
+		if reservation.Customer_name != nil {
+			updateObj = append(updateObj, bson.E{"customer_name", reservation.Customer_name})
+		}
+		if reservation.Customer_phone != nil {
+			updateObj = append(updateObj, bson.E{"customer_phone", reservation.Customer_phone})
+		}
+		if reservation.Customer_email != nil {
+			updateObj = append(updateObj, bson.E{"customer_email", reservation.Customer_email})
+		}
+		if reservation.Party_size != nil {
+			if *reservation.Party_size < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "party size must be at least 1"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"party_size", reservation.Party_size})
+		}
+		currentStatus := ""
+		if existingReservation.Status != nil {
+			currentStatus = *existingReservation.Status
+		}
+		if reservation.Reservation_time != nil && (existingReservation.Reservation_time == nil || !reservation.Reservation_time.Equal(*existingReservation.Reservation_time)) {
+			if currentStatus != "BOOKED" && currentStatus != "CONFIRMED" {
+				c.JSON(http.StatusConflict, gin.H{"error": "only booked or confirmed reservations can be moved to another time"})
+				return
+			}
+			if reservation.Status != nil && *reservation.Status != "BOOKED" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "a reservation moved to another time is BOOKED until the guest confirms it again"})
+				return
+			}
+			// A new time means the guest has to be reminded (and confirm) again
+			updateObj = append(updateObj, bson.E{"reservation_time", reservation.Reservation_time}, bson.E{"status", "BOOKED"})
+			updateObj = append(updateObj, bson.E{"reminder_24h_sent_at", nil}, bson.E{"reminder_2h_sent_at", nil})
+			reservation.Status = nil
+		}
+		if reservation.Table_id != nil {
+			updateObj = append(updateObj, bson.E{"table_id", reservation.Table_id})
+		}
+
+		// The party has to fit at its table, whether the table or the party size changes
+		tableId, partySize := existingReservation.Table_id, existingReservation.Party_size
+		if reservation.Table_id != nil {
+			tableId = reservation.Table_id
+		}
+		if reservation.Party_size != nil {
+			partySize = reservation.Party_size
+		}
+		if tableId != nil && partySize != nil && (reservation.Table_id != nil || reservation.Party_size != nil) {
+			var table models.Table
+			if err := tableCollection.FindOne(ctx, bson.M{"table_id": *tableId}).Decode(&table); err != nil || (reservation.Table_id != nil && table.Deleted_at != nil) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "table was not found"})
+				return
+			}
+			if err := checkTableCapacity(table, *partySize); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if reservation.Notes != nil {
+			updateObj = append(updateObj, bson.E{"notes", reservation.Notes})
+		}
+		if reservation.Status != nil && *reservation.Status != currentStatus {
+			from, ok := reservationTransitions[*reservation.Status]
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reservation status"})
+				return
+			}
+			if !containsString(from, currentStatus) {
+				c.JSON(http.StatusConflict, gin.H{"error": "a " + currentStatus + " reservation cannot become " + *reservation.Status})
+				return
+			}
+			// Seating goes through seatReservation below, like seating from an order
+			if *reservation.Status != "SEATED" {
+				updateObj = append(updateObj, bson.E{"status", reservation.Status})
+			}
+		}
+
+		reservation.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{"updated_at", reservation.Updated_at})
+
+		// The status condition keeps a concurrent change (a reminder job, the guest's link) from being overwritten
+		result, err := reservationCollection.UpdateOne(
+			ctx,
+			bson.M{"reservation_id": reservationId, "status": existingReservation.Status},
+			bson.D{{"$set", updateObj}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "reservation update failed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "reservation was changed meanwhile, please retry"})
+			return
+		}
+		if reservation.Status != nil && *reservation.Status == "SEATED" && currentStatus != "SEATED" {
+			if err := seatReservation(ctx, reservationId, tableId); err != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		// The deposit is refunded or forfeited as of the reservation time the guest had booked
+		if reservation.Status != nil && (existingReservation.Status == nil || *existingReservation.Status != *reservation.Status) {
+			settleReservationDeposit(ctx, existingReservation, *reservation.Status, c.GetString("uid"))
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// reservationLinkPage is what reservation links open. Links in emails and texts are often fetched by
+// mail scanners and link previews, so opening one only shows the reservation; it is confirmed or
+// cancelled when the guest presses the button, which posts back to the same address.
+var reservationLinkPage = template.Must(template.New("reservation").Parse(`<!DOCTYPE html>
+<html>
+<head><meta name="viewport" content="width=device-width, initial-scale=1"><title>Your reservation</title></head>
+<body style="font-family: sans-serif; color: #222;">
+{{if not .Valid}}<p>This reservation link is no longer valid.</p>
+{{else if .Done}}<p>{{if .Confirm}}Your reservation is confirmed.{{else}}Your reservation has been cancelled.{{end}}</p>
+{{else}}<p>Table for {{.Party_size}} on <strong>{{.When}}</strong></p>
+<form method="post"><button type="submit">{{if .Confirm}}Confirm my reservation{{else}}Cancel my reservation{{end}}</button></form>
+{{end}}</body>
+</html>
+`))
+
+type reservationLinkView struct {
+	Valid      bool
+	Done       bool
+	Confirm    bool
+	Party_size int
+	When       string
+}
+
+func renderReservationLinkPage(c *gin.Context, status int, view reservationLinkView) {
+	var page bytes.Buffer
+	if err := reservationLinkPage.Execute(&page, view); err != nil {
+		c.String(http.StatusInternalServerError, "the page could not be shown")
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", page.Bytes())
+}
+
+// reservationLinkFilter matches the reservation of a link while it can still be confirmed or cancelled:
+// upcoming and still active
+func reservationLinkFilter(token string, now time.Time) bson.M {
+	return bson.M{
+		"confirmation_token": token,
+		"status":             bson.M{"$in": bson.A{"BOOKED", "CONFIRMED"}},
+		"reservation_time":   bson.M{"$gt": now},
+	}
+}
+
+// ConfirmReservationPage is the page of the one-tap confirmation link sent in reminders
+func ConfirmReservationPage() gin.HandlerFunc {
+	return reservationLinkPageHandler("CONFIRMED")
+}
+
+// CancelReservationPage is the page of the one-tap cancellation link sent in reminders
+func CancelReservationPage() gin.HandlerFunc {
+	return reservationLinkPageHandler("CANCELLED")
+}
+
+func reservationLinkPageHandler(status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		view := reservationLinkView{Confirm: status == "CONFIRMED"}
+
+		var reservation models.Reservation
+		if err := reservationCollection.FindOne(ctx, reservationLinkFilter(c.Param("token"), now)).Decode(&reservation); err != nil {
+			renderReservationLinkPage(c, http.StatusNotFound, view)
+			return
+		}
+		view.Valid = true
+		view.Party_size = *reservation.Party_size
+		view.When = reservation.Reservation_time.Format("Mon 2 Jan 15:04")
+		renderReservationLinkPage(c, http.StatusOK, view)
+	}
+}
+
+// ConfirmReservationByToken confirms a reservation from its link's page
+func ConfirmReservationByToken() gin.HandlerFunc {
+	return reservationTokenHandler("CONFIRMED")
+}
+
+// CancelReservationByToken cancels a reservation from its link's page
+func CancelReservationByToken() gin.HandlerFunc {
+	return reservationTokenHandler("CANCELLED")
+}
+
+// reservationTokenHandler answers the page's form with a page, and other callers with JSON
+func reservationTokenHandler(status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		token := c.Param("token")
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		page := c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML
+
+		set := bson.D{{"status", status}, {"updated_at", now}}
+		if status == "CONFIRMED" {
+			set = append(set, bson.E{"confirmed_at", now})
+		}
+
+		var reservation models.Reservation
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		err := reservationCollection.FindOneAndUpdate(ctx, reservationLinkFilter(token, now), bson.D{{"$set", set}}, opts).Decode(&reservation)
+		if err != nil {
+			if page {
+				renderReservationLinkPage(c, http.StatusNotFound, reservationLinkView{})
+				return
+			}
+			c.JSON(http.StatusNotFound, gin.H{"error": "this reservation link is no longer valid"})
+			return
+		}
+		settleReservationDeposit(ctx, reservation, status, "guest")
+
+		if page {
+			renderReservationLinkPage(c, http.StatusOK, reservationLinkView{Valid: true, Done: true, Confirm: status == "CONFIRMED"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"reservation_id":   reservation.Reservation_id,
+			"status":           reservation.Status,
+			"reservation_time": reservation.Reservation_time,
+			"party_size":       reservation.Party_size,
+		})
+	}
+}
+
+// seatReservation marks an active reservation as SEATED at the given table. Reservations already seated
+// can be ordered for again, e.g. for the next round.
+func seatReservation(ctx context.Context, reservationId string, tableId *string) error {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	set := bson.D{{"status", "SEATED"}, {"updated_at", now}}
+	if tableId != nil {
+		set = append(set, bson.E{"table_id", *tableId})
+	}
+	result, err := reservationCollection.UpdateOne(
+		ctx,
+		bson.M{"reservation_id": reservationId, "status": bson.M{"$in": bson.A{"BOOKED", "CONFIRMED", "SEATED"}}},
+		bson.D{{"$set", set}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("reservation was not found or is no longer active")
+	}
+	return nil
+}
+
+// reservationLinks returns the one-tap confirm and cancel links for a reservation.
+// The base URL is taken from PUBLIC_BASE_URL (default http://localhost:8000).
+func reservationLinks(reservation models.Reservation) (string, string) {
+	baseUrl := os.Getenv("PUBLIC_BASE_URL")
+	if baseUrl == "" {
+		baseUrl = "http://localhost:8000"
+	}
+	confirm := fmt.Sprintf("%s/public/reservations/%s/confirm", baseUrl, reservation.Confirmation_token)
+	cancel := fmt.Sprintf("%s/public/reservations/%s/cancel", baseUrl, reservation.Confirmation_token)
+	return confirm, cancel
+}
+
+// sendReservationConfirmation emails the booking to the guest when they left an address
+func sendReservationConfirmation(ctx context.Context, reservation models.Reservation) {
+	if reservation.Customer_email == nil || *reservation.Customer_email == "" {
+		return
+	}
+	confirm, cancel := reservationLinks(reservation)
+	view := reservationEmailView{
+		Customer_name: *reservation.Customer_name,
+		Party_size:    *reservation.Party_size,
+		When:          reservation.Reservation_time.Format("Mon 2 Jan 15:04"),
+		Confirm_url:   confirm,
+		Cancel_url:    cancel,
+	}
+	if _, err := queueTemplatedEmail(ctx, *reservation.Customer_email, "reservation_confirmation", view, "RESERVATION_CONFIRMATION", reservation.Reservation_id); err != nil {
+		log.Println("failed to queue the reservation confirmation:", err)
+	}
+}
+
+// sendReservationReminder queues the reminder by SMS, and by email when the guest left an address
+func sendReservationReminder(ctx context.Context, reservation models.Reservation, when string) {
+	confirm, cancel := reservationLinks(reservation)
+	body := fmt.Sprintf("Hi %s, this is a reminder of your table for %d %s at %s. Confirm: %s Cancel: %s",
+		*reservation.Customer_name, *reservation.Party_size, when, reservation.Reservation_time.Format("Mon 2 Jan 15:04"), confirm, cancel)
+
+	queueMessage(ctx, "SMS", *reservation.Customer_phone, "", body, "RESERVATION_REMINDER", reservation.Reservation_id)
+	if reservation.Customer_email != nil && *reservation.Customer_email != "" {
+		queueMessage(ctx, "EMAIL", *reservation.Customer_email, "Your reservation "+when, body, "RESERVATION_REMINDER", reservation.Reservation_id)
+	}
+}
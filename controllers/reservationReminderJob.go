@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"golang-restaurant-management/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// StartReservationReminderJob launches the background job that reminds guests of their
+// reservation 24 hours and 2 hours ahead, releases reservations that were still not
+// confirmed once the grace period after the last reminder has passed, and marks
+// reservations whose guests did not turn up as NO_SHOW.
+// It is configured through environment variables:
+//   - RESERVATION_CONFIRM_GRACE_MINUTES: minutes a guest has to confirm after the last reminder (default 60)
+//   - RESERVATION_NO_SHOW_GRACE_MINUTES: minutes after the reservation time a party that was not
+//     seated is a no-show (default 30)
+//   - RESERVATION_REMINDER_CHECK_MINUTES: how often the job runs (default 5)
+func StartReservationReminderJob() {
+	grace := envInt("RESERVATION_CONFIRM_GRACE_MINUTES", 60)
+	noShowGrace := envInt("RESERVATION_NO_SHOW_GRACE_MINUTES", 30)
+	interval := envInt("RESERVATION_REMINDER_CHECK_MINUTES", 5)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		defer ticker.Stop()
+		for {
+			runReservationReminders(time.Duration(grace)*time.Minute, time.Duration(noShowGrace)*time.Minute)
+			<-ticker.C
+		}
+	}()
+}
+
+func runReservationReminders(grace time.Duration, noShowGrace time.Duration) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	sendDueReminders(ctx, now, 24*time.Hour, "reminder_24h_sent_at", "tomorrow")
+	sendDueReminders(ctx, now, 2*time.Hour, "reminder_2h_sent_at", "today")
+	releaseUnconfirmedReservations(ctx, now, grace)
+	markNoShows(ctx, now, noShowGrace)
+}
+
+// sendDueReminders reminds every active reservation starting within the window that has
+// not yet received this reminder. The sent marker is set before the message is queued so
+// that two app instances running the job never remind the same guest twice.
+func sendDueReminders(ctx context.Context, now time.Time, window time.Duration, sentField string, when string) {
+	filter := bson.M{
+		"status":           bson.M{"$in": bson.A{"BOOKED", "CONFIRMED"}},
+		"reservation_time": bson.M{"$gt": now, "$lte": now.Add(window)},
+		sentField:          nil,
+	}
+
+	cursor, err := reservationCollection.Find(ctx, filter)
+	if err != nil {
+		log.Println("reservation reminder job: error occured while listing reservations:", err)
+		return
+	}
+	var reservations []models.Reservation
+	if err = cursor.All(ctx, &reservations); err != nil {
+		log.Println("reservation reminder job: error occured while decoding reservations:", err)
+		return
+	}
+
+	for _, reservation := range reservations {
+		// The day-before reminder is pointless once the two-hour reminder is due
+		if sentField == "reminder_24h_sent_at" && reservation.Reservation_time.Sub(now) <= 2*time.Hour {
+			continue
+		}
+
+		result, err := reservationCollection.UpdateOne(
+			ctx,
+			bson.M{"reservation_id": reservation.Reservation_id, sentField: nil},
+			bson.D{{"$set", bson.D{{sentField, now}, {"updated_at", now}}}},
+		)
+		if err != nil || result.ModifiedCount == 0 {
+			continue
+		}
+		sendReservationReminder(ctx, reservation, when)
+	}
+}
+
+// releaseUnconfirmedReservations frees the tables of BOOKED reservations whose guests did not
+// confirm within the grace period after their last reminder, the one two hours ahead, so guests
+// have had the whole day since the first reminder to confirm. Reservations secured with a deposit
+// are kept.
+func releaseUnconfirmedReservations(ctx context.Context, now time.Time, grace time.Duration) {
+	filter := bson.M{
+		"status":              "BOOKED",
+		"prepayment_id":       nil,
+		"reminder_2h_sent_at": bson.M{"$lte": now.Add(-grace)},
+	}
+
+	cursor, err := reservationCollection.Find(ctx, filter)
+	if err != nil {
+		log.Println("reservation reminder job: error occured while listing unconfirmed reservations:", err)
+		return
+	}
+	var reservations []models.Reservation
+	if err = cursor.All(ctx, &reservations); err != nil {
+		log.Println("reservation reminder job: error occured while decoding reservations:", err)
+		return
+	}
+
+	for _, reservation := range reservations {
+		result, err := reservationCollection.UpdateOne(
+			ctx,
+			bson.M{"reservation_id": reservation.Reservation_id, "status": "BOOKED"},
+			bson.D{{"$set", bson.D{{"status", "RELEASED"}, {"updated_at", now}}}},
+		)
+		if err != nil || result.ModifiedCount == 0 {
+			continue
+		}
+		notifyManagers(ctx, "RESERVATION_RELEASED", "Unconfirmed reservation released",
+			"The reservation for "+*reservation.Customer_name+" at "+reservation.Reservation_time.Format("15:04")+" was not confirmed and has been released",
+			reservation.Reservation_id)
+	}
+}
+
+// markNoShows marks the active reservations whose party was still not seated after the grace period
+// past the reservation time as NO_SHOW. Their deposit is settled by the deposit policy, a table held
+// RESERVED for them is freed and managers are notified.
+func markNoShows(ctx context.Context, now time.Time, grace time.Duration) {
+	filter := bson.M{
+		"status":           bson.M{"$in": bson.A{"BOOKED", "CONFIRMED"}},
+		"reservation_time": bson.M{"$lte": now.Add(-grace)},
+	}
+
+	cursor, err := reservationCollection.Find(ctx, filter)
+	if err != nil {
+		log.Println("reservation reminder job: error occured while listing overdue reservations:", err)
+		return
+	}
+	var reservations []models.Reservation
+	if err = cursor.All(ctx, &reservations); err != nil {
+		log.Println("reservation reminder job: error occured while decoding reservations:", err)
+		return
+	}
+
+	for _, reservation := range reservations {
+		result, err := reservationCollection.UpdateOne(
+			ctx,
+			bson.M{"reservation_id": reservation.Reservation_id, "status": bson.M{"$in": bson.A{"BOOKED", "CONFIRMED"}}},
+			bson.D{{"$set", bson.D{{"status", "NO_SHOW"}, {"no_show_at", now}, {"updated_at", now}}}},
+		)
+		if err != nil || result.ModifiedCount == 0 {
+			continue
+		}
+		settleReservationDeposit(ctx, reservation, "NO_SHOW", "system")
+		if reservation.Table_id != nil {
+			if _, err := setTableStatus(ctx, *reservation.Table_id, []string{"RESERVED"}, "AVAILABLE", nil); err != nil {
+				log.Println("reservation reminder job: failed to free table", *reservation.Table_id, ":", err)
+			}
+		}
+		notifyManagers(ctx, "RESERVATION_NO_SHOW", "Reservation no-show",
+			"The party of "+strconv.Itoa(*reservation.Party_size)+" for "+*reservation.Customer_name+" at "+reservation.Reservation_time.Format("15:04")+" did not show up",
+			reservation.Reservation_id)
+	}
+}
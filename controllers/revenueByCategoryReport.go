@@ -0,0 +1,227 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type RevenueGroup struct {
+	Id       *string      `json:"id"`
+	Name     string       `json:"name"`
+	Category *string      `json:"category,omitempty"`
+	Quantity int          `json:"quantity"`
+	Revenue  models.Money `json:"revenue"`
+	Share    float64      `json:"share"`
+}
+
+type RevenuePeriod struct {
+	Period  string         `json:"period"`
+	Revenue models.Money   `json:"revenue"`
+	Groups  []RevenueGroup `json:"groups"`
+}
+
+type RevenueByCategoryReport struct {
+	From        time.Time       `json:"from"`
+	To          time.Time       `json:"to"`
+	By          string          `json:"by"`
+	Group_by    *string         `json:"group_by"`
+	Location_id *string         `json:"location_id"`
+	Revenue     models.Money    `json:"revenue"`
+	Groups      []RevenueGroup  `json:"groups"`
+	Periods     []RevenuePeriod `json:"periods"`
+}
+
+// revenueGroupNames returns the names of the categories or menus revenue is broken down by, and for
+// menus their own category
+func revenueGroupNames(ctx context.Context, by string, ids []string) (map[string]RevenueGroup, error) {
+	names := map[string]RevenueGroup{}
+	if by == "menu" {
+		result, err := menuCollection.Find(ctx, bson.M{"menu_id": bson.M{"$in": ids}})
+		if err != nil {
+			return nil, err
+		}
+		var menus []models.Menu
+		if err = result.All(ctx, &menus); err != nil {
+			return nil, err
+		}
+		for _, menu := range menus {
+			category := menu.Category
+			names[menu.Menu_id] = RevenueGroup{Name: menu.Name, Category: &category}
+		}
+		return names, nil
+	}
+	result, err := categoryCollection.Find(ctx, bson.M{"category_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var categories []models.Category
+	if err = result.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+	for _, category := range categories {
+		names[category.Category_id] = RevenueGroup{Name: *category.Name}
+	}
+	return names, nil
+}
+
+// sortRevenueGroups orders groups by revenue and sets their share of the total
+func sortRevenueGroups(groups []RevenueGroup, total models.Money) {
+	for i := range groups {
+		if total > 0 {
+			groups[i].Share = toFixed(float64(groups[i].Revenue)/float64(total)*100, 2)
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Revenue != groups[j].Revenue {
+			return groups[i].Revenue > groups[j].Revenue
+		}
+		return groups[i].Name < groups[j].Name
+	})
+}
+
+// GetRevenueByCategory breaks the revenue of the non-voided items sold over a period down by food category
+// or, with by=menu, by menu: the optional from/to query parameters (RFC3339), by default the last 30 days,
+// optionally of one location_id. With group_by (day, week or month) the mix is also given per period.
+// Foods without a category or menu are grouped together without an id.
+func GetRevenueByCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		from, to, err := reportPeriod(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		by := c.DefaultQuery("by", "category")
+		if by != "category" && by != "menu" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "by must be category or menu"})
+			return
+		}
+		report := RevenueByCategoryReport{From: from, To: to, By: by, Groups: []RevenueGroup{}, Periods: []RevenuePeriod{}}
+
+		groupKey := bson.D{{"group", "$food." + by + "_id"}}
+		if groupBy := c.Query("group_by"); groupBy != "" {
+			format, ok := salesPeriodFormats[groupBy]
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be day, week or month"})
+				return
+			}
+			settings, err := loadSettings(ctx)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the settings"})
+				return
+			}
+			startHour := defaultBusinessDayStartHour
+			if settings.Business_day_start_hour != nil {
+				startHour = *settings.Business_day_start_hour
+			}
+			report.Group_by = &groupBy
+			groupKey = append(groupKey, bson.E{"period", salesPeriodKey("created_at", format, startHour, time.Now())})
+		}
+
+		pipeline := mongo.Pipeline{bson.D{{"$match", bson.D{
+			{"created_at", bson.D{{"$gte", from}, {"$lt", to}}},
+			{"status", bson.D{{"$ne", "VOIDED"}}},
+			{"unit_price", bson.D{{"$ne", nil}}},
+		}}}}
+		// Order items have no location of their own, so they are filtered by their order's
+		if locationId := c.Query("location_id"); locationId != "" {
+			report.Location_id = &locationId
+			pipeline = append(pipeline,
+				bson.D{{"$lookup", bson.D{{"from", "order"}, {"localField", "order_id"}, {"foreignField", "order_id"}, {"as", "order"}}}},
+				bson.D{{"$match", bson.D{{"order.location_id", locationId}}}},
+			)
+		}
+		pipeline = append(pipeline,
+			bson.D{{"$lookup", bson.D{{"from", "food"}, {"localField", "food_id"}, {"foreignField", "food_id"}, {"as", "food"}}}},
+			bson.D{{"$unwind", bson.D{{"path", "$food"}, {"preserveNullAndEmptyArrays", true}}}},
+			bson.D{{"$group", bson.D{
+				{"_id", groupKey},
+				{"quantity", bson.D{{"$sum", 1}}},
+				{"revenue", bson.D{{"$sum", "$unit_price"}}},
+			}}},
+		)
+		result, err := orderItemCollection.Aggregate(ctx, pipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating revenue"})
+			return
+		}
+		var rows []struct {
+			Id struct {
+				Group  *string `bson:"group"`
+				Period string  `bson:"period"`
+			} `bson:"_id"`
+			Quantity int          `bson:"quantity"`
+			Revenue  models.Money `bson:"revenue"`
+		}
+		if err = result.All(ctx, &rows); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating revenue"})
+			return
+		}
+
+		ids := []string{}
+		for _, row := range rows {
+			if row.Id.Group != nil {
+				ids = append(ids, *row.Id.Group)
+			}
+		}
+		names, err := revenueGroupNames(ctx, by, ids)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the " + by + " names"})
+			return
+		}
+
+		totals := map[string]int{}
+		periods := map[string]int{}
+		for _, row := range rows {
+			group := RevenueGroup{Id: row.Id.Group, Name: "Uncategorized", Quantity: row.Quantity, Revenue: row.Revenue}
+			if by == "menu" {
+				group.Name = "No menu"
+			}
+			key := ""
+			if row.Id.Group != nil {
+				key = *row.Id.Group
+				if named, ok := names[key]; ok {
+					group.Name, group.Category = named.Name, named.Category
+				}
+			}
+
+			if i, ok := totals[key]; ok {
+				report.Groups[i].Quantity += group.Quantity
+				report.Groups[i].Revenue += group.Revenue
+			} else {
+				totals[key] = len(report.Groups)
+				report.Groups = append(report.Groups, group)
+			}
+			report.Revenue += group.Revenue
+
+			if report.Group_by == nil {
+				continue
+			}
+			i, ok := periods[row.Id.Period]
+			if !ok {
+				i = len(report.Periods)
+				periods[row.Id.Period] = i
+				report.Periods = append(report.Periods, RevenuePeriod{Period: row.Id.Period, Groups: []RevenueGroup{}})
+			}
+			report.Periods[i].Groups = append(report.Periods[i].Groups, group)
+			report.Periods[i].Revenue += group.Revenue
+		}
+
+		sortRevenueGroups(report.Groups, report.Revenue)
+		for i := range report.Periods {
+			sortRevenueGroups(report.Periods[i].Groups, report.Periods[i].Revenue)
+		}
+		sort.Slice(report.Periods, func(i, j int) bool { return report.Periods[i].Period < report.Periods[j].Period })
+
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,526 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var roomChargePostingCollection *mongo.Collection = database.OpenCollection(database.Client, "roomChargePosting")
+
+type RoomChargeRequest struct {
+	Room_number     string  `json:"room_number" validate:"required,max=20"`
+	Guest_name      *string `json:"guest_name" validate:"omitempty,max=100"`
+	Folio_reference *string `json:"folio_reference" validate:"omitempty,max=64"`
+}
+
+// pmsAcknowledgment is the PMS's answer to a posting, returned synchronously or sent later to the PMS webhook
+type pmsAcknowledgment struct {
+	Posting_id      string  `json:"posting_id"`
+	Status          string  `json:"status"`
+	Reference       *string `json:"reference"`
+	Folio_reference *string `json:"folio_reference"`
+	Reason          *string `json:"reason"`
+}
+
+// roomChargePoster sends a posting to the hotel's property management system. An error means the
+// PMS could not be reached or failed, and the posting can be retried.
+type roomChargePoster interface {
+	PostCharge(ctx context.Context, posting models.RoomChargePosting) (pmsAcknowledgment, error)
+}
+
+// httpRoomChargePoster posts charges to a PMS interface over HTTP
+type httpRoomChargePoster struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// newRoomChargePoster returns the PMS configured by PMS_POSTING_URL and PMS_API_KEY
+func newRoomChargePoster() (roomChargePoster, error) {
+	url := os.Getenv("PMS_POSTING_URL")
+	if url == "" {
+		return nil, errors.New("room charges are not configured")
+	}
+	return httpRoomChargePoster{url: url, apiKey: os.Getenv("PMS_API_KEY"), client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// PostCharge sends the posting with its posting_id as the idempotency key, so a retry of a charge
+// the PMS already received is not charged twice. A 4xx answer is a rejection of the charge.
+func (p httpRoomChargePoster) PostCharge(ctx context.Context, posting models.RoomChargePosting) (pmsAcknowledgment, error) {
+	var ack pmsAcknowledgment
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		return ack, err
+	}
+
+	body, err := json.Marshal(gin.H{
+		"posting_id":      posting.Posting_id,
+		"invoice_number":  posting.Invoice_number,
+		"room_number":     posting.Room_number,
+		"guest_name":      posting.Guest_name,
+		"folio_reference": posting.Folio_reference,
+		"amount":          posting.Amount,
+		"currency":        settingsCurrency(settings),
+	})
+	if err != nil {
+		return ack, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return ack, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Idempotency-Key", posting.Posting_id)
+	if p.apiKey != "" {
+		request.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return ack, err
+	}
+	defer response.Body.Close()
+	answer, _ := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+
+	if response.StatusCode >= 500 {
+		return ack, fmt.Errorf("PMS answered %d", response.StatusCode)
+	}
+	if response.StatusCode >= 400 {
+		reason := fmt.Sprintf("PMS answered %d", response.StatusCode)
+		if json.Unmarshal(answer, &ack) == nil && ack.Reason != nil {
+			reason = *ack.Reason
+		}
+		return pmsAcknowledgment{Status: "REJECTED", Reason: &reason}, nil
+	}
+
+	// A PMS that processes postings asynchronously answers PENDING and acknowledges through the webhook
+	if err := json.Unmarshal(answer, &ack); err != nil || (ack.Status != "POSTED" && ack.Status != "PENDING" && ack.Status != "REJECTED") {
+		return ack, errors.New("PMS answer could not be read")
+	}
+	return ack, nil
+}
+
+// ChargeToRoom bills a pending invoice to a hotel guest's room. The invoice totals are finalized,
+// the amount due is posted to the PMS, and the invoice is paid once the PMS acknowledges the charge.
+// While the posting is in progress the invoice cannot be paid in any other way.
+func ChargeToRoom() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request RoomChargeRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		poster, err := newRoomChargePoster()
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+
+		var invoice models.Invoice
+		if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": c.Param("invoice_id")}).Decode(&invoice); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
+		if invoice.Room_charge_posting_id != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice has already been charged to a room", "posting_id": *invoice.Room_charge_posting_id})
+			return
+		}
+		pending := invoice.Payment_status != nil && *invoice.Payment_status == "PENDING"
+		if !invoiceRecalculable(invoice) && !(pending && invoiceFinalized(invoice)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only pending invoices can be charged to a room"})
+			return
+		}
+
+		// The PMS is sent the final amount, so the totals of a draft are settled before posting
+		if invoiceRecalculable(invoice) {
+			if err := saveInvoiceTotals(ctx, &invoice, bson.M{"room_charge_posting_id": nil}); err != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": "invoice totals could not be finalized, please retry"})
+				return
+			}
+		}
+		amount := invoiceAmountDue(invoice)
+		if amount <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invoice has nothing left to pay"})
+			return
+		}
+
+		var posting models.RoomChargePosting
+		posting.ID = primitive.NewObjectID()
+		posting.Posting_id = posting.ID.Hex()
+		posting.Invoice_id = invoice.Invoice_id
+		posting.Invoice_number = invoice.Invoice_number
+		posting.Room_number = request.Room_number
+		posting.Guest_name = request.Guest_name
+		posting.Folio_reference = request.Folio_reference
+		posting.Amount = amount
+		posting.Status = "PENDING"
+		posting.Posted_by = c.GetString("uid")
+		posting.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		posting.Updated_at = posting.Created_at
+
+		if _, err := roomChargePostingCollection.InsertOne(ctx, posting); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "room charge was not created"})
+			return
+		}
+
+		// Claiming the invoice makes sure two concurrent requests cannot both charge it
+		result, err := invoiceCollection.UpdateOne(
+			ctx,
+			bson.M{"invoice_id": invoice.Invoice_id, "payment_status": "PENDING", "room_charge_posting_id": nil},
+			bson.D{{"$set", bson.D{
+				{"room_charge_posting_id", posting.Posting_id},
+				{"payment_method", "ROOM_CHARGE"},
+				{"invoice_status", "FINALIZED"},
+				{"updated_at", posting.Created_at},
+			}}},
+		)
+		if err != nil || result.MatchedCount == 0 {
+			roomChargePostingCollection.DeleteOne(ctx, bson.M{"posting_id": posting.Posting_id})
+			c.JSON(http.StatusConflict, gin.H{"error": "invoice is no longer pending"})
+			return
+		}
+
+		posting, err = sendRoomCharge(ctx, poster, posting, posting.Posted_by)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "room charge could not be updated"})
+			return
+		}
+		c.JSON(http.StatusOK, posting)
+	}
+}
+
+// sendRoomCharge sends a posting to the PMS and applies its answer. A PMS that could not be
+// reached leaves the posting FAILED so it can be retried.
+func sendRoomCharge(ctx context.Context, poster roomChargePoster, posting models.RoomChargePosting, changedBy string) (models.RoomChargePosting, error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	if _, err := roomChargePostingCollection.UpdateOne(ctx, bson.M{"posting_id": posting.Posting_id}, bson.D{
+		{"$set", bson.D{{"status", "PENDING"}, {"updated_at", now}}},
+		{"$inc", bson.D{{"attempts", 1}}},
+	}); err != nil {
+		return posting, err
+	}
+
+	ack, postErr := poster.PostCharge(ctx, posting)
+	if postErr != nil {
+		log.Println("failed to post room charge", posting.Posting_id, ":", postErr)
+		message := postErr.Error()
+		_, err := roomChargePostingCollection.UpdateOne(ctx, bson.M{"posting_id": posting.Posting_id, "status": "PENDING"}, bson.D{
+			{"$set", bson.D{{"status", "FAILED"}, {"error", message}, {"updated_at", now}}},
+		})
+		if err != nil {
+			return posting, err
+		}
+	} else if ack.Status != "PENDING" {
+		if err := applyRoomChargeAcknowledgment(ctx, posting, ack, changedBy); err != nil {
+			return posting, err
+		}
+	}
+
+	var updated models.RoomChargePosting
+	err := roomChargePostingCollection.FindOne(ctx, bson.M{"posting_id": posting.Posting_id}).Decode(&updated)
+	return updated, err
+}
+
+// applyRoomChargeAcknowledgment records the PMS's POSTED or REJECTED answer. A posted charge pays
+// the invoice; a rejected one releases it so it can be paid another way. Acknowledgments for a
+// posting that is already final are ignored, so redelivered webhooks are harmless.
+func applyRoomChargeAcknowledgment(ctx context.Context, posting models.RoomChargePosting, ack pmsAcknowledgment, changedBy string) error {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	set := bson.D{{"status", ack.Status}, {"acknowledged_at", now}, {"updated_at", now}, {"error", ack.Reason}}
+	if ack.Reference != nil {
+		set = append(set, bson.E{"pms_reference", ack.Reference})
+	}
+	if ack.Folio_reference != nil {
+		set = append(set, bson.E{"folio_reference", ack.Folio_reference})
+	}
+	result, err := roomChargePostingCollection.UpdateOne(
+		ctx,
+		bson.M{"posting_id": posting.Posting_id, "status": bson.M{"$in": bson.A{"PENDING", "FAILED"}}},
+		bson.D{{"$set", set}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return nil
+	}
+
+	filter := bson.M{"invoice_id": posting.Invoice_id, "room_charge_posting_id": posting.Posting_id, "payment_status": "PENDING"}
+	switch ack.Status {
+	case "POSTED":
+		reference := posting.Posting_id
+		if ack.Reference != nil {
+			reference = *ack.Reference
+		}
+		_, err = invoiceCollection.UpdateOne(ctx, filter, bson.D{{"$set", bson.D{
+			{"payment_status", "PAID"},
+			{"payment_method", "ROOM_CHARGE"},
+			{"payment_reference", reference},
+			{"paid_at", now},
+			{"updated_at", now},
+		}}})
+		if err != nil {
+			return err
+		}
+		var invoice models.Invoice
+		if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": posting.Invoice_id}).Decode(&invoice); err == nil {
+			closeInvoiceOrdersIfSettled(ctx, invoice, changedBy)
+		}
+
+	case "REJECTED":
+		err = releaseRoomChargeInvoice(ctx, posting, now)
+		if err == nil {
+			notifyManagers(ctx, "ROOM_CHARGE_REJECTED", "Room charge rejected", fmt.Sprintf("Invoice %s could not be charged to room %s", posting.Invoice_number, posting.Room_number), posting.Invoice_id)
+		}
+	}
+	return err
+}
+
+// releaseRoomChargeInvoice detaches a posting that did not go through from its invoice
+func releaseRoomChargeInvoice(ctx context.Context, posting models.RoomChargePosting, now time.Time) error {
+	_, err := invoiceCollection.UpdateOne(
+		ctx,
+		bson.M{"invoice_id": posting.Invoice_id, "room_charge_posting_id": posting.Posting_id},
+		bson.D{{"$set", bson.D{{"room_charge_posting_id", nil}, {"payment_method", nil}, {"updated_at", now}}}},
+	)
+	return err
+}
+
+// RetryRoomCharge sends a FAILED posting to the PMS again, with the same idempotency key
+func RetryRoomCharge() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		poster, err := newRoomChargePoster()
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+
+		var posting models.RoomChargePosting
+		if err := roomChargePostingCollection.FindOne(ctx, bson.M{"posting_id": c.Param("posting_id")}).Decode(&posting); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "room charge was not found"})
+			return
+		}
+		if posting.Status != "FAILED" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only failed room charges can be retried"})
+			return
+		}
+
+		posting, err = sendRoomCharge(ctx, poster, posting, c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "room charge could not be updated"})
+			return
+		}
+		c.JSON(http.StatusOK, posting)
+	}
+}
+
+// CancelRoomCharge gives up on a FAILED posting and releases its invoice so it can be paid another way.
+// Only failed postings can be cancelled, since a pending one may still be posted by the PMS.
+func CancelRoomCharge() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var posting models.RoomChargePosting
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		err := roomChargePostingCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"posting_id": c.Param("posting_id"), "status": "FAILED"},
+			bson.D{{"$set", bson.D{{"status", "CANCELLED"}, {"updated_at", now}}}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&posting)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only failed room charges can be cancelled"})
+			return
+		}
+
+		if err := releaseRoomChargeInvoice(ctx, posting, now); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "invoice could not be released"})
+			return
+		}
+		c.JSON(http.StatusOK, posting)
+	}
+}
+
+// PMSWebhook receives asynchronous acknowledgments of room charges from the PMS. Requests are
+// signed like payment webhooks, in an X-PMS-Signature header keyed with PMS_WEBHOOK_SECRET.
+func PMSWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "could not read request body"})
+			return
+		}
+
+		secret := os.Getenv("PMS_WEBHOOK_SECRET")
+		if secret == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "PMS webhooks are not configured"})
+			return
+		}
+		if err := verifyWebhookSignature(secret, c.GetHeader("X-PMS-Signature"), body, time.Now()); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		var ack pmsAcknowledgment
+		if err := json.Unmarshal(body, &ack); err != nil || ack.Posting_id == "" || (ack.Status != "POSTED" && ack.Status != "REJECTED") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid acknowledgment payload"})
+			return
+		}
+
+		var posting models.RoomChargePosting
+		if err := roomChargePostingCollection.FindOne(ctx, bson.M{"posting_id": ack.Posting_id}).Decode(&posting); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "room charge was not found"})
+			return
+		}
+
+		if err := applyRoomChargeAcknowledgment(ctx, posting, ack, "system"); err != nil {
+			// A non-2xx answer makes the PMS retry the delivery later
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"posting_id": posting.Posting_id, "status": ack.Status})
+	}
+}
+
+// GetRoomCharges is the reconciliation report of room charges, to be matched against the PMS's
+// records. It lists the postings created between from and to, totals them by status and flags
+// exceptions: failed postings, postings the PMS has not acknowledged after PMS_ACK_TIMEOUT_MINUTES,
+// and posted charges whose invoice is not paid.
+func GetRoomCharges() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		createdAt := bson.M{}
+		for param, operator := range map[string]string{"from": "$gte", "to": "$lt"} {
+			if value := c.Query(param); value != "" {
+				parsed, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an RFC3339 timestamp"})
+					return
+				}
+				createdAt[operator] = parsed
+			}
+		}
+		filter := bson.M{}
+		if len(createdAt) > 0 {
+			filter["created_at"] = createdAt
+		}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+
+		settings, err := loadSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading settings"})
+			return
+		}
+
+		cursor, err := roomChargePostingCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{"created_at", 1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing room charges"})
+			return
+		}
+		postings := []models.RoomChargePosting{}
+		if err = cursor.All(ctx, &postings); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing room charges"})
+			return
+		}
+
+		type statusSummary struct {
+			Count  int          `json:"count"`
+			Amount models.Money `json:"amount"`
+		}
+		summary := map[string]*statusSummary{}
+		var postedInvoiceIds []string
+		for _, posting := range postings {
+			if summary[posting.Status] == nil {
+				summary[posting.Status] = &statusSummary{}
+			}
+			summary[posting.Status].Count++
+			summary[posting.Status].Amount += posting.Amount
+			if posting.Status == "POSTED" {
+				postedInvoiceIds = append(postedInvoiceIds, posting.Invoice_id)
+			}
+		}
+
+		unpaid := map[string]bool{}
+		if len(postedInvoiceIds) > 0 {
+			invoices, err := invoiceCollection.Find(ctx, bson.M{"invoice_id": bson.M{"$in": postedInvoiceIds}, "payment_status": bson.M{"$ne": "PAID"}})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking invoices"})
+				return
+			}
+			var unpaidInvoices []models.Invoice
+			if err = invoices.All(ctx, &unpaidInvoices); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking invoices"})
+				return
+			}
+			for _, invoice := range unpaidInvoices {
+				unpaid[invoice.Invoice_id] = true
+			}
+		}
+
+		stale := time.Now().Add(-time.Duration(envInt("PMS_ACK_TIMEOUT_MINUTES", 30)) * time.Minute)
+		exceptions := []gin.H{}
+		for _, posting := range postings {
+			reason := ""
+			switch {
+			case posting.Status == "FAILED":
+				reason = "posting failed and has not been retried"
+			case posting.Status == "PENDING" && posting.Created_at.Before(stale):
+				reason = "PMS has not acknowledged the posting"
+			case posting.Status == "POSTED" && unpaid[posting.Invoice_id]:
+				reason = "charge was posted but the invoice is not paid"
+			}
+			if reason != "" {
+				exceptions = append(exceptions, gin.H{"posting_id": posting.Posting_id, "invoice_id": posting.Invoice_id, "status": posting.Status, "reason": reason})
+			}
+		}
+
+		var postedTotal models.Money
+		if posted := summary["POSTED"]; posted != nil {
+			postedTotal = posted.Amount
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"postings":               postings,
+			"summary":                summary,
+			"posted_total":           postedTotal,
+			"formatted_posted_total": formatMoney(postedTotal, settings),
+			"exceptions":             exceptions,
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type SalesHour struct {
+	Weekday string       `json:"weekday"`
+	Hour    int          `json:"hour"`
+	Orders  int          `json:"orders"`
+	Revenue models.Money `json:"revenue"`
+}
+
+type SalesByHourReport struct {
+	From        time.Time   `json:"from"`
+	To          time.Time   `json:"to"`
+	Location_id *string     `json:"location_id"`
+	Hours       []SalesHour `json:"hours"`
+	Busiest     *SalesHour  `json:"busiest"`
+}
+
+// salesHourRow is the output of the pipelines bucketing by weekday (1 for Sunday to 7 for Saturday) and hour
+type salesHourRow struct {
+	Id struct {
+		Weekday int `bson:"weekday"`
+		Hour    int `bson:"hour"`
+	} `bson:"_id"`
+	Orders  int          `bson:"orders"`
+	Revenue models.Money `bson:"revenue"`
+}
+
+// salesHourKey buckets a timestamp field by weekday and hour in the server's time zone
+func salesHourKey(field string, now time.Time) bson.D {
+	date := bson.D{{"date", "$" + field}, {"timezone", now.Format("-07:00")}}
+	return bson.D{
+		{"weekday", bson.D{{"$dayOfWeek", date}}},
+		{"hour", bson.D{{"$hour", date}}},
+	}
+}
+
+// GetSalesByHour reports the orders placed and the revenue of the non-voided items ordered in each hour of
+// each weekday over a period, a heatmap to plan staffing from: the optional from/to query parameters
+// (RFC3339), by default the last 30 days, optionally of one location. Hours run Monday 00:00 to Sunday
+// 23:00 in the server's time zone, and hours without sales are included.
+func GetSalesByHour() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		from, to, err := reportPeriod(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		now := time.Now()
+
+		report := SalesByHourReport{From: from, To: to, Hours: []SalesHour{}}
+		match := bson.D{{"created_at", bson.D{{"$gte", from}, {"$lt", to}}}}
+		if locationId := c.Query("location_id"); locationId != "" {
+			report.Location_id = &locationId
+			match = append(match, bson.E{"location_id", locationId})
+		}
+
+		result, err := orderCollection.Aggregate(ctx, mongo.Pipeline{
+			bson.D{{"$match", match}},
+			bson.D{{"$group", bson.D{{"_id", salesHourKey("created_at", now)}, {"orders", bson.D{{"$sum", 1}}}}}},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while counting orders"})
+			return
+		}
+		var orders []salesHourRow
+		if err = result.All(ctx, &orders); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while counting orders"})
+			return
+		}
+
+		// Order items have no location of their own, so they are filtered by their order's
+		itemPipeline := mongo.Pipeline{bson.D{{"$match", bson.D{
+			{"created_at", bson.D{{"$gte", from}, {"$lt", to}}},
+			{"status", bson.D{{"$ne", "VOIDED"}}},
+			{"unit_price", bson.D{{"$ne", nil}}},
+		}}}}
+		if report.Location_id != nil {
+			itemPipeline = append(itemPipeline,
+				bson.D{{"$lookup", bson.D{{"from", "order"}, {"localField", "order_id"}, {"foreignField", "order_id"}, {"as", "order"}}}},
+				bson.D{{"$match", bson.D{{"order.location_id", *report.Location_id}}}},
+			)
+		}
+		itemPipeline = append(itemPipeline, bson.D{{"$group", bson.D{{"_id", salesHourKey("created_at", now)}, {"revenue", bson.D{{"$sum", "$unit_price"}}}}}})
+		result, err = orderItemCollection.Aggregate(ctx, itemPipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating revenue"})
+			return
+		}
+		var revenue []salesHourRow
+		if err = result.All(ctx, &revenue); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating revenue"})
+			return
+		}
+
+		// $dayOfWeek counts from 1 for Sunday; the report starts on Monday
+		for day := 0; day < 7; day++ {
+			for hour := 0; hour < 24; hour++ {
+				report.Hours = append(report.Hours, SalesHour{Weekday: time.Weekday((day + 1) % 7).String(), Hour: hour})
+			}
+		}
+		index := func(row salesHourRow) int {
+			return ((row.Id.Weekday+5)%7)*24 + row.Id.Hour
+		}
+		for _, row := range orders {
+			report.Hours[index(row)].Orders += row.Orders
+		}
+		for _, row := range revenue {
+			report.Hours[index(row)].Revenue += row.Revenue
+		}
+		for i := range report.Hours {
+			if report.Hours[i].Revenue > 0 && (report.Busiest == nil || report.Hours[i].Revenue > report.Busiest.Revenue) {
+				report.Busiest = &report.Hours[i]
+			}
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
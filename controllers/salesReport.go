@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// salesPeriodFormats are the $dateToString formats naming the periods a sales report groups by
+var salesPeriodFormats = map[string]string{
+	"day":   "%Y-%m-%d",
+	"week":  "%G-W%V",
+	"month": "%Y-%m",
+}
+
+type SalesFigures struct {
+	Orders          int          `json:"orders" bson:"orders"`
+	Voided_orders   int          `json:"voided_orders" bson:"voided_orders"`
+	Invoices        int          `json:"invoices" bson:"invoices"`
+	Gross_sales     models.Money `json:"gross_sales" bson:"gross_sales"`
+	Discounts       models.Money `json:"discounts" bson:"discounts"`
+	Refunds         models.Money `json:"refunds" bson:"refunds"`
+	Net_sales       models.Money `json:"net_sales" bson:"net_sales"`
+	Tax             models.Money `json:"tax" bson:"tax"`
+	Service_charges models.Money `json:"service_charges" bson:"service_charges"`
+	Tips            models.Money `json:"tips" bson:"tips"`
+	Void_invoices   int          `json:"void_invoices" bson:"void_invoices"`
+	Voided_items    int          `json:"voided_items" bson:"voided_items"`
+	Voided_amount   models.Money `json:"voided_amount" bson:"voided_amount"`
+}
+
+// add adds the figures of another period
+func (figures *SalesFigures) add(other SalesFigures) {
+	figures.Orders += other.Orders
+	figures.Voided_orders += other.Voided_orders
+	figures.Invoices += other.Invoices
+	figures.Gross_sales += other.Gross_sales
+	figures.Discounts += other.Discounts
+	figures.Refunds += other.Refunds
+	figures.Net_sales += other.Net_sales
+	figures.Tax += other.Tax
+	figures.Service_charges += other.Service_charges
+	figures.Tips += other.Tips
+	figures.Void_invoices += other.Void_invoices
+	figures.Voided_items += other.Voided_items
+	figures.Voided_amount += other.Voided_amount
+}
+
+type SalesPeriod struct {
+	Period       string `json:"period" bson:"_id"`
+	SalesFigures `bson:",inline"`
+}
+
+type SalesReport struct {
+	From        time.Time     `json:"from"`
+	To          time.Time     `json:"to"`
+	Group_by    string        `json:"group_by"`
+	Location_id *string       `json:"location_id"`
+	Totals      SalesFigures  `json:"totals"`
+	Periods     []SalesPeriod `json:"periods"`
+}
+
+// salesPeriodKey names the period a timestamp field falls in. Timestamps are shifted back by the business
+// day start hour, so sales after midnight count for the day before, and read in the server's time zone.
+func salesPeriodKey(field string, format string, startHour int, now time.Time) bson.D {
+	return bson.D{{"$dateToString", bson.D{
+		{"format", format},
+		{"date", bson.D{{"$subtract", bson.A{"$" + field, int64(startHour) * int64(time.Hour/time.Millisecond)}}}},
+		{"timezone", now.Format("-07:00")},
+	}}}
+}
+
+// aggregateSalesPeriods runs a pipeline whose output are sales figures per period
+func aggregateSalesPeriods(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline) ([]SalesPeriod, error) {
+	result, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var periods []SalesPeriod
+	err = result.All(ctx, &periods)
+	return periods, err
+}
+
+// GetSalesReport reports the sales of a period per day, week or month (group_by, default day): the
+// optional from/to query parameters (RFC3339), by default the last 30 days, optionally of one location.
+// Invoices count for the period they were created in; split invoices count through their parts and void
+// invoices only as void_invoices. Net sales are gross sales (subtotals) less discounts, refunds and the tax
+// included in tax inclusive prices. Orders and voided order items count for the period they were placed in.
+func GetSalesReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		from, to, err := reportPeriod(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		groupBy := c.DefaultQuery("group_by", "day")
+		format, ok := salesPeriodFormats[groupBy]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be day, week or month"})
+			return
+		}
+		settings, err := loadSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the settings"})
+			return
+		}
+		startHour := defaultBusinessDayStartHour
+		if settings.Business_day_start_hour != nil {
+			startHour = *settings.Business_day_start_hour
+		}
+		now := time.Now()
+
+		report := SalesReport{From: from, To: to, Group_by: groupBy, Periods: []SalesPeriod{}}
+		match := bson.D{{"created_at", bson.D{{"$gte", from}, {"$lt", to}}}}
+		if locationId := c.Query("location_id"); locationId != "" {
+			report.Location_id = &locationId
+			match = append(match, bson.E{"location_id", locationId})
+		}
+
+		billed := bson.D{{"$in", bson.A{"$payment_status", bson.A{"PENDING", "PAID", "REFUNDED"}}}}
+		sumBilled := func(value interface{}) bson.D {
+			return bson.D{{"$sum", bson.D{{"$cond", bson.A{billed, value, 0}}}}}
+		}
+		invoices, err := aggregateSalesPeriods(ctx, invoiceCollection, mongo.Pipeline{
+			bson.D{{"$match", match}},
+			bson.D{{"$group", bson.D{
+				{"_id", salesPeriodKey("created_at", format, startHour, now)},
+				{"invoices", sumBilled(1)},
+				{"gross_sales", sumBilled("$subtotal")},
+				{"discounts", sumBilled("$discount_total")},
+				{"refunds", sumBilled(bson.D{{"$ifNull", bson.A{"$refunded_amount", 0}}})},
+				{"tax", sumBilled("$tax_total")},
+				{"included_tax", sumBilled(bson.D{{"$cond", bson.A{"$prices_include_tax", "$tax_total", 0}}})},
+				{"service_charges", sumBilled("$service_charge")},
+				{"tips", sumBilled(bson.D{{"$ifNull", bson.A{"$tip", 0}}})},
+				{"void_invoices", bson.D{{"$sum", bson.D{{"$cond", bson.A{bson.D{{"$eq", bson.A{"$payment_status", "VOID"}}}, 1, 0}}}}}},
+			}}},
+			bson.D{{"$addFields", bson.D{
+				{"net_sales", bson.D{{"$subtract", bson.A{"$gross_sales", bson.D{{"$add", bson.A{"$discounts", "$refunds", "$included_tax"}}}}}}},
+			}}},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating invoice totals"})
+			return
+		}
+
+		orders, err := aggregateSalesPeriods(ctx, orderCollection, mongo.Pipeline{
+			bson.D{{"$match", match}},
+			bson.D{{"$group", bson.D{
+				{"_id", salesPeriodKey("created_at", format, startHour, now)},
+				{"orders", bson.D{{"$sum", 1}}},
+				{"voided_orders", bson.D{{"$sum", bson.D{{"$cond", bson.A{bson.D{{"$eq", bson.A{"$status", "VOIDED"}}}, 1, 0}}}}}},
+			}}},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while counting orders"})
+			return
+		}
+
+		// Order items have no location of their own, so they are filtered by their order's
+		voidPipeline := mongo.Pipeline{bson.D{{"$match", bson.D{{"created_at", bson.D{{"$gte", from}, {"$lt", to}}}, {"status", "VOIDED"}}}}}
+		if report.Location_id != nil {
+			voidPipeline = append(voidPipeline,
+				bson.D{{"$lookup", bson.D{{"from", "order"}, {"localField", "order_id"}, {"foreignField", "order_id"}, {"as", "order"}}}},
+				bson.D{{"$match", bson.D{{"order.location_id", *report.Location_id}}}},
+			)
+		}
+		voidPipeline = append(voidPipeline, bson.D{{"$group", bson.D{
+			{"_id", salesPeriodKey("created_at", format, startHour, now)},
+			{"voided_items", bson.D{{"$sum", 1}}},
+			{"voided_amount", bson.D{{"$sum", bson.D{{"$ifNull", bson.A{"$unit_price", 0}}}}}},
+		}}})
+		voids, err := aggregateSalesPeriods(ctx, orderItemCollection, voidPipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating voids"})
+			return
+		}
+
+		periods := map[string]*SalesPeriod{}
+		for _, rows := range [][]SalesPeriod{invoices, orders, voids} {
+			for _, row := range rows {
+				period, ok := periods[row.Period]
+				if !ok {
+					period = &SalesPeriod{Period: row.Period}
+					periods[row.Period] = period
+				}
+				period.add(row.SalesFigures)
+				report.Totals.add(row.SalesFigures)
+			}
+		}
+		for _, period := range periods {
+			report.Periods = append(report.Periods, *period)
+		}
+		sort.Slice(report.Periods, func(i, j int) bool { return report.Periods[i].Period < report.Periods[j].Period })
+
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"golang-restaurant-management/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// StartScheduledPriceJob launches the background job that applies scheduled food prices once their
+// date has passed. SCHEDULED_PRICE_CHECK_MINUTES sets how often it runs (default 1).
+func StartScheduledPriceJob() {
+	interval := envInt("SCHEDULED_PRICE_CHECK_MINUTES", 1)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		defer ticker.Stop()
+		for {
+			runScheduledPrices()
+			<-ticker.C
+		}
+	}()
+}
+
+func runScheduledPrices() {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	cursor, err := foodCollection.Find(ctx, bson.D{{"scheduled_price.effective_at", bson.M{"$lte": time.Now()}}, notArchived})
+	if err != nil {
+		log.Println("scheduled price job: error occured while listing scheduled prices:", err)
+		return
+	}
+	var foods []models.Food
+	if err = cursor.All(ctx, &foods); err != nil {
+		log.Println("scheduled price job: error occured while decoding foods:", err)
+		return
+	}
+
+	for _, food := range foods {
+		scheduledPrice := food.Scheduled_price
+		version, err := nextMenuVersion(ctx)
+		if err != nil {
+			log.Println("scheduled price job: error occured while applying the price of food", food.Food_id, ":", err)
+			return
+		}
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		// The price is only applied if it was not rescheduled or cancelled in the meantime
+		result, err := foodCollection.UpdateOne(
+			ctx,
+			bson.M{"food_id": food.Food_id, "scheduled_price.effective_at": scheduledPrice.Effective_at},
+			bson.D{{"$set", bson.D{{"price", scheduledPrice.Price}, {"scheduled_price", nil}, {"version", version}, {"updated_at", updatedAt}}}},
+		)
+		if err != nil {
+			log.Println("scheduled price job: error occured while applying the price of food", food.Food_id, ":", err)
+			continue
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+
+		updated := food
+		updated.Price = scheduledPrice.Price
+		recordFoodPriceChanges(ctx, "SCHEDULED", scheduledPrice.Scheduled_by, foodPriceChanges(food, updated))
+	}
+}
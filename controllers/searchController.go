@@ -0,0 +1,227 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// searchLimit is the most foods and menus a search returns
+const searchLimit = 50
+
+type FoodSearchResult struct {
+	Food  models.Food `json:"food"`
+	Score float64     `json:"score"`
+}
+
+type MenuSearchResult struct {
+	Menu_id  string  `json:"menu_id"`
+	Name     string  `json:"name"`
+	Category string  `json:"category"`
+	Score    float64 `json:"score"`
+}
+
+type CategoryFacet struct {
+	Category_id *string `json:"category_id"`
+	Slug        *string `json:"slug"`
+	Name        *string `json:"name"`
+	Count       int     `json:"count"`
+}
+
+type SearchResults struct {
+	Query      string             `json:"query"`
+	Foods      []FoodSearchResult `json:"foods"`
+	Menus      []MenuSearchResult `json:"menus"`
+	Categories []CategoryFacet    `json:"categories"`
+}
+
+// scoredFood is a food found by a text search, with its relevance
+type scoredFood struct {
+	models.Food `bson:",inline"`
+	Score       float64 `bson:"score"`
+}
+
+// namePrefixScore ranks a food whose name starts with the query, or has a word starting with it,
+// so partly typed words find foods before the text index, which matches whole words only, can
+func namePrefixScore(name string, query string) float64 {
+	name, query = strings.ToLower(name), strings.ToLower(query)
+	if strings.HasPrefix(name, query) {
+		return 2
+	}
+	for _, word := range strings.Fields(name) {
+		if strings.HasPrefix(word, query) {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Search finds foods and menus by name, description, ingredients and tags. Foods are ranked by the
+// text index relevance, with a boost for names starting with the query, and counted per category.
+// The results can be narrowed to a category (slug or category_id).
+func Search() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		query := strings.TrimSpace(c.Query("q"))
+		if query == "" || len(query) > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "q must be between 1 and 100 characters"})
+			return
+		}
+
+		foodFilter := bson.M{"deleted_at": nil}
+		if value := c.Query("category"); value != "" {
+			var category models.Category
+			categoryCollection.FindOne(ctx, bson.M{"$or": bson.A{bson.M{"slug": categorySlug(value)}, bson.M{"category_id": value}}}).Decode(&category)
+			if category.Category_id != "" {
+				value = category.Category_id
+			}
+			foodFilter["category_id"] = value
+		}
+
+		scores := map[string]float64{}
+		foods := map[string]models.Food{}
+
+		textFilter := bson.M{"$text": bson.M{"$search": query}}
+		for key, value := range foodFilter {
+			textFilter[key] = value
+		}
+		textOptions := options.Find().
+			SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+			SetSort(bson.M{"score": bson.M{"$meta": "textScore"}}).
+			SetLimit(searchLimit)
+		cursor, err := foodCollection.Find(ctx, textFilter, textOptions)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while searching foods"})
+			return
+		}
+		var textMatches []scoredFood
+		if err = cursor.All(ctx, &textMatches); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while searching foods"})
+			return
+		}
+		for _, match := range textMatches {
+			foods[match.Food_id] = match.Food
+			scores[match.Food_id] += match.Score
+		}
+
+		// Names starting with a partly typed word
+		prefixFilter := bson.M{"name": bson.M{"$regex": "(^|\\s)" + regexp.QuoteMeta(query), "$options": "i"}}
+		for key, value := range foodFilter {
+			prefixFilter[key] = value
+		}
+		cursor, err = foodCollection.Find(ctx, prefixFilter, options.Find().SetLimit(searchLimit))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while searching foods"})
+			return
+		}
+		var prefixMatches []models.Food
+		if err = cursor.All(ctx, &prefixMatches); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while searching foods"})
+			return
+		}
+		for _, food := range prefixMatches {
+			foods[food.Food_id] = food
+		}
+		for foodId, food := range foods {
+			if food.Name != nil {
+				scores[foodId] += namePrefixScore(*food.Name, query)
+			}
+		}
+
+		accepted, base, err := requestLanguages(ctx, c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while searching foods"})
+			return
+		}
+		results := SearchResults{Query: query, Foods: []FoodSearchResult{}, Menus: []MenuSearchResult{}, Categories: []CategoryFacet{}}
+		for foodId, food := range foods {
+			localizeFood(&food, accepted, base)
+			results.Foods = append(results.Foods, FoodSearchResult{Food: food, Score: scores[foodId]})
+		}
+		sort.SliceStable(results.Foods, func(i, j int) bool {
+			if results.Foods[i].Score != results.Foods[j].Score {
+				return results.Foods[i].Score > results.Foods[j].Score
+			}
+			return results.Foods[i].Food.Food_id < results.Foods[j].Food.Food_id
+		})
+		if len(results.Foods) > searchLimit {
+			results.Foods = results.Foods[:searchLimit]
+		}
+
+		results.Categories, err = searchCategoryFacets(ctx, results.Foods)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while counting categories"})
+			return
+		}
+
+		menuOptions := options.Find().
+			SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}, "menu_id": 1, "name": 1, "category": 1}).
+			SetSort(bson.M{"score": bson.M{"$meta": "textScore"}}).
+			SetLimit(searchLimit)
+		cursor, err = menuCollection.Find(ctx, bson.M{"$text": bson.M{"$search": query}, "deleted_at": nil}, menuOptions)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while searching menus"})
+			return
+		}
+		if err = cursor.All(ctx, &results.Menus); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while searching menus"})
+			return
+		}
+
+		c.JSON(http.StatusOK, results)
+	}
+}
+
+// searchCategoryFacets counts the foods found per category, most foods first. Foods without a
+// category are counted under a facet without category_id.
+func searchCategoryFacets(ctx context.Context, foods []FoodSearchResult) ([]CategoryFacet, error) {
+	facets := []CategoryFacet{}
+	index := map[string]int{}
+	var categoryIds []string
+	for _, result := range foods {
+		key := ""
+		if result.Food.Category_id != nil {
+			key = *result.Food.Category_id
+		}
+		if i, ok := index[key]; ok {
+			facets[i].Count++
+			continue
+		}
+		index[key] = len(facets)
+		facet := CategoryFacet{Count: 1}
+		if key != "" {
+			facet.Category_id = result.Food.Category_id
+			categoryIds = append(categoryIds, key)
+		}
+		facets = append(facets, facet)
+	}
+
+	if len(categoryIds) > 0 {
+		cursor, err := categoryCollection.Find(ctx, bson.M{"category_id": bson.M{"$in": categoryIds}})
+		if err != nil {
+			return facets, err
+		}
+		var categories []models.Category
+		if err = cursor.All(ctx, &categories); err != nil {
+			return facets, err
+		}
+		for _, category := range categories {
+			facet := &facets[index[category.Category_id]]
+			facet.Slug = category.Slug
+			facet.Name = category.Name
+		}
+	}
+
+	sort.SliceStable(facets, func(i, j int) bool { return facets[i].Count > facets[j].Count })
+	return facets, nil
+}
@@ -0,0 +1,304 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var sectionAssignmentCollection *mongo.Collection = database.OpenCollection(database.Client, "sectionAssignment")
+
+var seatingCollection *mongo.Collection = database.OpenCollection(database.Client, "seating")
+
+// maxShiftLength bounds how long a section assignment can last
+const maxShiftLength = 24 * time.Hour
+
+type ServerRotationEntry struct {
+	Server_id   string  `json:"server_id"`
+	Server_name string  `json:"server_name"`
+	Section     string  `json:"section"`
+	Shift       *string `json:"shift"`
+
+	// Covers is the number of guests seated with the server since the start of the shift
+	Covers int `json:"covers"`
+
+	// Open_tables is the number of the server's tables still seated
+	Open_tables int `json:"open_tables"`
+
+	// Last_seated_at is when the server last got a party during the shift
+	Last_seated_at *time.Time `json:"last_seated_at"`
+}
+
+// serverRotation returns the servers on shift at the given time, in a section or in all sections, in the
+// order they should take the next party: fewest covers this shift first, then fewest open tables, then
+// the longest since their last party
+func serverRotation(ctx context.Context, section string, at time.Time) ([]ServerRotationEntry, error) {
+	filter := bson.M{"starts_at": bson.M{"$lte": at}, "ends_at": bson.M{"$gt": at}}
+	if section != "" {
+		filter["section"] = section
+	}
+	cursor, err := sectionAssignmentCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var assignments []models.SectionAssignment
+	if err = cursor.All(ctx, &assignments); err != nil {
+		return nil, err
+	}
+
+	entries := []ServerRotationEntry{}
+	for _, assignment := range assignments {
+		entry := ServerRotationEntry{Server_id: *assignment.Server_id, Server_name: assignment.Server_name, Section: *assignment.Section, Shift: assignment.Shift}
+
+		cursor, err := seatingCollection.Find(ctx, bson.M{"server_id": *assignment.Server_id, "seated_at": bson.M{"$gte": *assignment.Starts_at}})
+		if err != nil {
+			return nil, err
+		}
+		var seatings []models.Seating
+		if err = cursor.All(ctx, &seatings); err != nil {
+			return nil, err
+		}
+		for _, seating := range seatings {
+			entry.Covers += seating.Guests
+			if seating.Cleared_at == nil {
+				entry.Open_tables++
+			}
+			if entry.Last_seated_at == nil || seating.Seated_at.After(*entry.Last_seated_at) {
+				seatedAt := seating.Seated_at
+				entry.Last_seated_at = &seatedAt
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Covers != b.Covers {
+			return a.Covers < b.Covers
+		}
+		if a.Open_tables != b.Open_tables {
+			return a.Open_tables < b.Open_tables
+		}
+		if (a.Last_seated_at == nil) != (b.Last_seated_at == nil) {
+			return a.Last_seated_at == nil
+		}
+		if a.Last_seated_at != nil && !a.Last_seated_at.Equal(*b.Last_seated_at) {
+			return a.Last_seated_at.Before(*b.Last_seated_at)
+		}
+		return a.Server_name < b.Server_name
+	})
+	return entries, nil
+}
+
+// tableServer returns the server looking after a table: the server of the party seated at it, or else
+// the next server in the rotation of the table's section. It returns nil when nobody is on shift there.
+func tableServer(ctx context.Context, table models.Table) *string {
+	var seating models.Seating
+	err := seatingCollection.FindOne(ctx, bson.M{"table_id": table.Table_id, "cleared_at": nil}).Decode(&seating)
+	if err == nil {
+		return seating.Server_id
+	}
+	if table.Section == nil {
+		return nil
+	}
+	rotation, err := serverRotation(ctx, *table.Section, time.Now())
+	if err != nil || len(rotation) == 0 {
+		return nil
+	}
+	return &rotation[0].Server_id
+}
+
+// recordSeating records a party seated at a table. Without a server, the next server in the rotation of
+// the table's section takes the party. Failures are logged, since the party is seated either way.
+func recordSeating(ctx context.Context, table models.Table, serverId *string, guests int, source string) {
+	if serverId == nil {
+		serverId = tableServer(ctx, table)
+	}
+	var seating models.Seating
+	seating.ID = primitive.NewObjectID()
+	seating.Seating_id = seating.ID.Hex()
+	seating.Table_id = table.Table_id
+	seating.Table_number = table.Table_number
+	seating.Section = table.Section
+	seating.Server_id = serverId
+	seating.Guests = guests
+	seating.Source = source
+	seating.Party_source = "WALK_IN"
+	seating.Seated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	if _, err := seatingCollection.InsertOne(ctx, seating); err != nil {
+		log.Println("failed to record seating at table", table.Table_id, ":", err)
+	}
+}
+
+// linkSeatingOrder links the party seated at an order's table to the table session of the order and,
+// for an order placed for a reservation, to the reservation
+func linkSeatingOrder(ctx context.Context, order models.Order) {
+	filter := bson.M{"table_id": *order.Table_id, "cleared_at": nil}
+	if order.Session_id != nil {
+		filter["session_id"] = nil
+		_, err := seatingCollection.UpdateOne(ctx, filter, bson.D{{"$set", bson.D{{"session_id", *order.Session_id}}}})
+		if err != nil {
+			log.Println("failed to link seating at table", *order.Table_id, "to its session:", err)
+		}
+		delete(filter, "session_id")
+	}
+	if order.Reservation_id != nil {
+		filter["reservation_id"] = nil
+		_, err := seatingCollection.UpdateOne(ctx, filter, bson.D{{"$set", bson.D{{"reservation_id", *order.Reservation_id}, {"party_source", "RESERVATION"}}}})
+		if err != nil {
+			log.Println("failed to link seating at table", *order.Table_id, "to its reservation:", err)
+		}
+	}
+}
+
+// clearSeatings marks the party seated at a table as gone
+func clearSeatings(ctx context.Context, tableId string) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	_, err := seatingCollection.UpdateMany(ctx, bson.M{"table_id": tableId, "cleared_at": nil}, bson.D{{"$set", bson.D{{"cleared_at", now}}}})
+	if err != nil {
+		log.Println("failed to clear seatings at table", tableId, ":", err)
+	}
+}
+
+// GetSectionAssignments lists the section assignments of the shifts on a date (YYYY-MM-DD, default
+// today), optionally of a section or a server
+func GetSectionAssignments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		now := time.Now()
+		day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		if date := c.Query("date"); date != "" {
+			parsed, err := time.ParseInLocation("2006-01-02", date, now.Location())
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "date must be in YYYY-MM-DD format"})
+				return
+			}
+			day = parsed
+		}
+
+		filter := bson.M{"starts_at": bson.M{"$lt": day.AddDate(0, 0, 1)}, "ends_at": bson.M{"$gt": day}}
+		if section := c.Query("section"); section != "" {
+			filter["section"] = section
+		}
+		if serverId := c.Query("server_id"); serverId != "" {
+			filter["server_id"] = serverId
+		}
+		opts := options.Find().SetSort(bson.D{{"starts_at", 1}, {"section", 1}})
+		cursor, err := sectionAssignmentCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing section assignments"})
+			return
+		}
+		assignments := []models.SectionAssignment{}
+		if err = cursor.All(ctx, &assignments); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing section assignments"})
+			return
+		}
+		c.JSON(http.StatusOK, assignments)
+	}
+}
+
+// CreateSectionAssignment puts a server in charge of a section for a shift. A server works one section
+// at a time, so overlapping shifts of the same server are rejected.
+func CreateSectionAssignment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var assignment models.SectionAssignment
+		if err := c.BindJSON(&assignment); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(assignment); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if !assignment.Ends_at.After(*assignment.Starts_at) || assignment.Ends_at.Sub(*assignment.Starts_at) > maxShiftLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a shift must end after it starts and last at most 24 hours"})
+			return
+		}
+
+		var server models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": *assignment.Server_id}).Decode(&server); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "server was not found"})
+			return
+		}
+		overlapping, err := sectionAssignmentCollection.CountDocuments(ctx, bson.M{
+			"server_id": *assignment.Server_id,
+			"starts_at": bson.M{"$lt": *assignment.Ends_at},
+			"ends_at":   bson.M{"$gt": *assignment.Starts_at},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the server's shifts"})
+			return
+		}
+		if overlapping > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "the server already works a section during this shift"})
+			return
+		}
+
+		assignment.ID = primitive.NewObjectID()
+		assignment.Section_assignment_id = assignment.ID.Hex()
+		assignment.Server_name = *server.First_name + " " + *server.Last_name
+		assignment.Created_by = c.GetString("uid")
+		assignment.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		if _, err := sectionAssignmentCollection.InsertOne(ctx, assignment); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "section assignment was not created"})
+			return
+		}
+		c.JSON(http.StatusOK, assignment)
+	}
+}
+
+// DeleteSectionAssignment removes a server's section assignment, e.g. when they went home early
+func DeleteSectionAssignment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := sectionAssignmentCollection.DeleteOne(ctx, bson.M{"section_assignment_id": c.Param("section_assignment_id")})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "section assignment could not be deleted"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "section assignment was not found"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// GetServerRotation tells the host which server should take the next walk-in, in a section or in any
+// section, and lists the servers on shift in rotation order with their covers
+func GetServerRotation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		rotation, err := serverRotation(ctx, c.Query("section"), time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the rotation"})
+			return
+		}
+		var next *ServerRotationEntry
+		if len(rotation) > 0 {
+			next = &rotation[0]
+		}
+		c.JSON(http.StatusOK, gin.H{"next": next, "servers": rotation})
+	}
+}
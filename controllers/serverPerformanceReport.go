@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ServerPerformance struct {
+	Server_id         *string      `json:"server_id" bson:"_id"`
+	Name              string       `json:"name" bson:"-"`
+	Orders            int          `json:"orders" bson:"orders"`
+	Voided_orders     int          `json:"voided_orders" bson:"voided_orders"`
+	Covers            int          `json:"covers" bson:"covers"`
+	Net_sales         models.Money `json:"net_sales" bson:"net_sales"`
+	Average_check     models.Money `json:"average_check" bson:"-"`
+	Revenue_per_cover models.Money `json:"revenue_per_cover" bson:"-"`
+	Tips              models.Money `json:"tips" bson:"tips"`
+	Voided_items      int          `json:"voided_items" bson:"voided_items"`
+	Voided_amount     models.Money `json:"voided_amount" bson:"voided_amount"`
+}
+
+type ServerPerformanceReport struct {
+	From        time.Time           `json:"from"`
+	To          time.Time           `json:"to"`
+	Shift       *string             `json:"shift"`
+	Location_id *string             `json:"location_id"`
+	Servers     []ServerPerformance `json:"servers"`
+}
+
+// shiftPeriod returns the period of a shift on a date: from the start of the first section assignment with
+// the shift label to the end of the last one
+func shiftPeriod(ctx context.Context, shift string, day time.Time) (time.Time, time.Time, error) {
+	filter := bson.M{"shift": shift, "starts_at": bson.M{"$lt": day.AddDate(0, 0, 1)}, "ends_at": bson.M{"$gt": day}}
+	var first, last models.SectionAssignment
+	if err := sectionAssignmentCollection.FindOne(ctx, filter, options.FindOne().SetSort(bson.D{{"starts_at", 1}})).Decode(&first); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if err := sectionAssignmentCollection.FindOne(ctx, filter, options.FindOne().SetSort(bson.D{{"ends_at", -1}})).Decode(&last); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return *first.Starts_at, *last.Ends_at, nil
+}
+
+// aggregateServerPerformance runs a pipeline whose output are server figures per server_id
+func aggregateServerPerformance(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline) ([]ServerPerformance, error) {
+	result, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rows []ServerPerformance
+	err = result.All(ctx, &rows)
+	return rows, err
+}
+
+// GetServerPerformance summarises each server's orders, covers, net sales, average check, tips and voids,
+// for coaching and tip allocation. The period is a shift, given by its label and date (shift and date,
+// YYYY-MM-DD, default today) and running from the first section assignment of the shift to the end of the
+// last, or else the optional from/to query parameters (RFC3339), by default the last 30 days. Sales, tips
+// and voids count for the server of their order; orders without a server are listed without a server_id.
+func GetServerPerformance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		report := ServerPerformanceReport{Servers: []ServerPerformance{}}
+		var err error
+		if shift := c.Query("shift"); shift != "" {
+			now := time.Now()
+			day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+			if date := c.Query("date"); date != "" {
+				if day, err = time.ParseInLocation("2006-01-02", date, now.Location()); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "date must be in YYYY-MM-DD format"})
+					return
+				}
+			}
+			report.Shift = &shift
+			report.From, report.To, err = shiftPeriod(ctx, shift, day)
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "no section assignments were found for the shift"})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the shift"})
+				return
+			}
+		} else if report.From, report.To, err = reportPeriod(c); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		from, to := report.From, report.To
+
+		period := bson.D{{"$gte", from}, {"$lt", to}}
+		orderMatch := bson.D{{"created_at", period}}
+		byOrder := bson.D{}
+		if locationId := c.Query("location_id"); locationId != "" {
+			report.Location_id = &locationId
+			orderMatch = append(orderMatch, bson.E{"location_id", locationId})
+			byOrder = append(byOrder, bson.E{"order.location_id", locationId})
+		}
+		lookupOrder := bson.D{{"$lookup", bson.D{{"from", "order"}, {"localField", "order_id"}, {"foreignField", "order_id"}, {"as", "order"}}}}
+		orderServer := bson.D{{"$arrayElemAt", bson.A{"$order.server_id", 0}}}
+
+		orders, err := aggregateServerPerformance(ctx, orderCollection, mongo.Pipeline{
+			bson.D{{"$match", orderMatch}},
+			bson.D{{"$group", bson.D{
+				{"_id", "$server_id"},
+				{"orders", bson.D{{"$sum", 1}}},
+				{"voided_orders", bson.D{{"$sum", bson.D{{"$cond", bson.A{bson.D{{"$eq", bson.A{"$status", "VOIDED"}}}, 1, 0}}}}}},
+			}}},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while counting orders"})
+			return
+		}
+
+		invoices, err := aggregateServerPerformance(ctx, invoiceCollection, mongo.Pipeline{
+			bson.D{{"$match", bson.D{{"created_at", period}, {"payment_status", bson.D{{"$in", bson.A{"PENDING", "PAID", "REFUNDED"}}}}}}},
+			lookupOrder,
+			bson.D{{"$match", byOrder}},
+			bson.D{{"$group", bson.D{
+				{"_id", orderServer},
+				{"net_sales", bson.D{{"$sum", invoiceNetSales}}},
+				{"tips", bson.D{{"$sum", bson.D{{"$ifNull", bson.A{"$tip", 0}}}}}},
+			}}},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating invoice totals"})
+			return
+		}
+
+		voids, err := aggregateServerPerformance(ctx, orderItemCollection, mongo.Pipeline{
+			bson.D{{"$match", bson.D{{"created_at", period}, {"status", "VOIDED"}}}},
+			lookupOrder,
+			bson.D{{"$match", byOrder}},
+			bson.D{{"$group", bson.D{
+				{"_id", orderServer},
+				{"voided_items", bson.D{{"$sum", 1}}},
+				{"voided_amount", bson.D{{"$sum", bson.D{{"$ifNull", bson.A{"$unit_price", 0}}}}}},
+			}}},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating voids"})
+			return
+		}
+
+		// Seatings have no location of their own, so they are filtered by their table's
+		seatingPipeline := mongo.Pipeline{bson.D{{"$match", bson.D{{"seated_at", period}}}}}
+		if report.Location_id != nil {
+			seatingPipeline = append(seatingPipeline,
+				bson.D{{"$lookup", bson.D{{"from", "table"}, {"localField", "table_id"}, {"foreignField", "table_id"}, {"as", "table"}}}},
+				bson.D{{"$match", bson.D{{"table.location_id", *report.Location_id}}}},
+			)
+		}
+		seatingPipeline = append(seatingPipeline, bson.D{{"$group", bson.D{{"_id", "$server_id"}, {"covers", bson.D{{"$sum", "$guests"}}}}}})
+		seatings, err := aggregateServerPerformance(ctx, seatingCollection, seatingPipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while counting covers"})
+			return
+		}
+
+		servers := map[string]*ServerPerformance{}
+		var keys []string
+		for _, rows := range [][]ServerPerformance{orders, invoices, voids, seatings} {
+			for _, row := range rows {
+				key := ""
+				if row.Server_id != nil {
+					key = *row.Server_id
+				}
+				server, ok := servers[key]
+				if !ok {
+					server = &ServerPerformance{Server_id: row.Server_id}
+					servers[key] = server
+					keys = append(keys, key)
+				}
+				server.Orders += row.Orders
+				server.Voided_orders += row.Voided_orders
+				server.Covers += row.Covers
+				server.Net_sales += row.Net_sales
+				server.Tips += row.Tips
+				server.Voided_items += row.Voided_items
+				server.Voided_amount += row.Voided_amount
+			}
+		}
+
+		cursor, err := userCollection.Find(ctx, bson.M{"user_id": bson.M{"$in": keys}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing servers"})
+			return
+		}
+		var users []models.User
+		if err = cursor.All(ctx, &users); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing servers"})
+			return
+		}
+		for _, user := range users {
+			if server, ok := servers[user.User_id]; ok {
+				server.Name = *user.First_name + " " + *user.Last_name
+			}
+		}
+
+		for _, key := range keys {
+			server := servers[key]
+			if server.Orders > server.Voided_orders {
+				server.Average_check = models.Money(math.Round(float64(server.Net_sales) / float64(server.Orders-server.Voided_orders)))
+			}
+			if server.Covers > 0 {
+				server.Revenue_per_cover = models.Money(math.Round(float64(server.Net_sales) / float64(server.Covers)))
+			}
+			report.Servers = append(report.Servers, *server)
+		}
+		// The best sellers first; orders without a server come last
+		sort.SliceStable(report.Servers, func(i, j int) bool {
+			if (report.Servers[i].Server_id == nil) != (report.Servers[j].Server_id == nil) {
+				return report.Servers[j].Server_id == nil
+			}
+			return report.Servers[i].Net_sales > report.Servers[j].Net_sales
+		})
+
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// invoicePartySize returns the number of guests billed on an invoice: the buffet guests of buffet orders,
+// or else the guests seated at the order's table. Orders of a table session count as one party.
+func invoicePartySize(ctx context.Context, orders []models.Order) (int, error) {
+	guests := 0
+	tables := map[string]int{}
+	for _, order := range orders {
+		count := 0
+		if order.Buffet_guests != nil {
+			count = order.Buffet_guests.Adults + order.Buffet_guests.Children + order.Buffet_guests.Seniors
+		} else if order.Table_id != nil {
+			seated, ok := tables[*order.Table_id]
+			if !ok {
+				var table models.Table
+				err := tableCollection.FindOne(ctx, bson.M{"table_id": *order.Table_id}).Decode(&table)
+				if err != nil && err != mongo.ErrNoDocuments {
+					return 0, err
+				}
+				if table.Number_of_guests != nil {
+					seated = *table.Number_of_guests
+				}
+				tables[*order.Table_id] = seated
+			}
+			count = seated
+		}
+		if count > guests {
+			guests = count
+		}
+	}
+	return guests, nil
+}
+
+// serviceChargeRuleApplies reports whether a rule applies to a party of guests ordering through the
+// orders' channels
+func serviceChargeRuleApplies(rule models.ServiceChargeRule, orders []models.Order, guests int) bool {
+	if rule.Disabled || guests < rule.Min_guests {
+		return false
+	}
+	if len(rule.Channels) == 0 {
+		return true
+	}
+	for _, order := range orders {
+		channel := "DINE_IN"
+		if order.Channel != nil {
+			channel = *order.Channel
+		}
+		for _, ruleChannel := range rule.Channels {
+			if ruleChannel == channel {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// calculateServiceCharges applies the settings' service charge rules to the subtotal after discounts,
+// one line per rule that applies. Without rules, the flat service_charge_rate applies to every invoice.
+func calculateServiceCharges(settings models.Settings, orders []models.Order, guests int, taxable models.Money) ([]models.InvoiceServiceChargeLine, models.Money) {
+	if len(settings.Service_charge_rules) == 0 {
+		if settings.Service_charge_rate == nil {
+			return nil, 0
+		}
+		return nil, taxable.Mul(*settings.Service_charge_rate)
+	}
+
+	var lines []models.InvoiceServiceChargeLine
+	var total models.Money
+	for _, rule := range settings.Service_charge_rules {
+		if !serviceChargeRuleApplies(rule, orders, guests) {
+			continue
+		}
+		line := models.InvoiceServiceChargeLine{Name: rule.Name, Rate: rule.Rate, Amount: taxable.Mul(rule.Rate)}
+		lines = append(lines, line)
+		total += line.Amount
+	}
+	return lines, total
+}
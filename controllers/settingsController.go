@@ -0,0 +1,263 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var settingsCollection *mongo.Collection = database.OpenCollection(database.Client, "settings")
+
+const defaultSettingsId = "default"
+
+func GetSettings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		settings, err := loadSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the settings"})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	}
+}
+
+func UpdateSettings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var settings models.Settings
+
+		if err := c.BindJSON(&settings); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(settings)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var updateObj primitive.D
+
+		if settings.Channel_commissions != nil {
+			for channel, rate := range settings.Channel_commissions {
+				if rate < 0 || rate > 1 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "commission rate for " + channel + " must be between 0 and 1"})
+					return
+				}
+			}
+			updateObj = append(updateObj, bson.E{"channel_commissions", settings.Channel_commissions})
+		}
+
+		if settings.Tax_rates != nil {
+			updateObj = append(updateObj, bson.E{"tax_rates", settings.Tax_rates})
+		}
+
+		if settings.Tax_classes != nil {
+			codes := map[string]bool{}
+			for _, taxClass := range settings.Tax_classes {
+				if codes[taxClass.Code] {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "tax class " + taxClass.Code + " is listed twice"})
+					return
+				}
+				codes[taxClass.Code] = true
+			}
+			updateObj = append(updateObj, bson.E{"tax_classes", settings.Tax_classes})
+		}
+
+		if settings.Tax_mode != nil {
+			updateObj = append(updateObj, bson.E{"tax_mode", settings.Tax_mode})
+		}
+
+		if settings.Service_charge_rate != nil {
+			updateObj = append(updateObj, bson.E{"service_charge_rate", settings.Service_charge_rate})
+		}
+
+		if settings.Service_charge_rules != nil {
+			updateObj = append(updateObj, bson.E{"service_charge_rules", settings.Service_charge_rules})
+		}
+
+		if settings.Pii_full_access_roles != nil {
+			updateObj = append(updateObj, bson.E{"pii_full_access_roles", settings.Pii_full_access_roles})
+		}
+
+		if settings.Pii_field_rules != nil {
+			for field := range settings.Pii_field_rules {
+				if defaultPiiFieldRules[strings.ToLower(field)] == "SECRET" {
+					c.JSON(http.StatusBadRequest, gin.H{"error": field + " is never returned, its rule cannot be changed"})
+					return
+				}
+			}
+			updateObj = append(updateObj, bson.E{"pii_field_rules", settings.Pii_field_rules})
+		}
+
+		if settings.Business_day_start_hour != nil {
+			updateObj = append(updateObj, bson.E{"business_day_start_hour", settings.Business_day_start_hour})
+		}
+
+		if settings.Order_number_start != nil {
+			updateObj = append(updateObj, bson.E{"order_number_start", settings.Order_number_start})
+		}
+
+		if settings.Currency != nil {
+			// Amounts are stored in minor units, so switching to a currency with a different
+			// number of decimals would silently rescale every price already recorded
+			current, err := loadSettings(ctx)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the settings"})
+				return
+			}
+			if models.CurrencyExponent(*settings.Currency) != models.CurrencyExponent(settingsCurrency(current)) {
+				count, err := foodCollection.CountDocuments(ctx, bson.M{})
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking existing prices"})
+					return
+				}
+				if count > 0 {
+					c.JSON(http.StatusConflict, gin.H{"error": "the currency cannot be changed to one with a different number of decimals once prices have been entered"})
+					return
+				}
+			}
+			updateObj = append(updateObj, bson.E{"currency", settings.Currency})
+		}
+
+		if settings.Invoice_number_prefix != nil {
+			updateObj = append(updateObj, bson.E{"invoice_number_prefix", settings.Invoice_number_prefix})
+		}
+
+		if settings.Locale != nil {
+			updateObj = append(updateObj, bson.E{"locale", settings.Locale})
+		}
+
+		if settings.Buffet_plans != nil {
+			codes := map[string]bool{}
+			for _, plan := range settings.Buffet_plans {
+				if codes[plan.Code] {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "buffet plan " + plan.Code + " is listed twice"})
+					return
+				}
+				codes[plan.Code] = true
+			}
+			updateObj = append(updateObj, bson.E{"buffet_plans", settings.Buffet_plans})
+		}
+
+		if settings.Payment_methods != nil {
+			codes := map[string]bool{}
+			for _, paymentMethod := range settings.Payment_methods {
+				if codes[paymentMethod.Code] || systemPaymentMethods[paymentMethod.Code] {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "payment method " + paymentMethod.Code + " is listed twice or reserved"})
+					return
+				}
+				codes[paymentMethod.Code] = true
+			}
+			updateObj = append(updateObj, bson.E{"payment_methods", settings.Payment_methods})
+		}
+
+		if settings.Overdue_reminders != nil {
+			updateObj = append(updateObj, bson.E{"overdue_reminders", settings.Overdue_reminders})
+		}
+
+		if settings.Deposit_policy != nil {
+			updateObj = append(updateObj, bson.E{"deposit_policy", settings.Deposit_policy})
+		}
+
+		if settings.Reservation_slots != nil {
+			updateObj = append(updateObj, bson.E{"reservation_slots", settings.Reservation_slots})
+		}
+
+		if settings.Service_periods != nil {
+			names := map[string]bool{}
+			for _, period := range settings.Service_periods {
+				if names[period.Name] {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "service period " + period.Name + " is listed twice"})
+					return
+				}
+				names[period.Name] = true
+			}
+			updateObj = append(updateObj, bson.E{"service_periods", settings.Service_periods})
+		}
+
+		if settings.Min_food_margin_percent != nil {
+			updateObj = append(updateObj, bson.E{"min_food_margin_percent", settings.Min_food_margin_percent})
+		}
+
+		if settings.Escalation_rules != nil {
+			types := map[string]bool{}
+			for _, rule := range settings.Escalation_rules {
+				if types[rule.Type] {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "escalation rule " + rule.Type + " is listed twice"})
+					return
+				}
+				types[rule.Type] = true
+			}
+			updateObj = append(updateObj, bson.E{"escalation_rules", settings.Escalation_rules})
+		}
+
+		settings.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{"updated_at", settings.Updated_at})
+
+		upsert := true
+		opt := options.UpdateOptions{
+			Upsert: &upsert,
+		}
+
+		createdAt := settings.Updated_at
+		result, err := settingsCollection.UpdateOne(
+			ctx,
+			bson.M{"settings_id": defaultSettingsId},
+			bson.D{
+				{"$set", updateObj},
+				{"$setOnInsert", bson.D{{"_id", primitive.NewObjectID()}, {"created_at", createdAt}}},
+			},
+			&opt,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "settings update failed"})
+			return
+		}
+		if settings.Currency != nil {
+			models.SetCurrency(*settings.Currency)
+		}
+		// The public menu shows prices formatted with the settings
+		invalidatePublicMenuCache()
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// loadSettings returns the restaurant settings, or empty defaults when none have been saved yet.
+// The configured currency is applied on every load, so all instances pick up a change.
+func loadSettings(ctx context.Context) (models.Settings, error) {
+	var settings models.Settings
+
+	err := settingsCollection.FindOne(ctx, bson.M{"settings_id": defaultSettingsId}).Decode(&settings)
+	if err == mongo.ErrNoDocuments {
+		settings.Settings_id = defaultSettingsId
+		err = nil
+	}
+	if err == nil {
+		models.SetCurrency(settingsCurrency(settings))
+	}
+	return settings, err
+}
+
+// settingsCurrency returns the configured currency code, or the default one
+func settingsCurrency(settings models.Settings) string {
+	if settings.Currency == nil {
+		return models.DefaultCurrency
+	}
+	return *settings.Currency
+}
@@ -0,0 +1,22 @@
+package controller
+
+import (
+	"fmt"
+	"golang-restaurant-management/models"
+)
+
+// foodSizePrice returns the price of a food in a size (S, M or L). Foods without size prices cost
+// their price in every size; foods with size prices are only sold in the sizes they list.
+func foodSizePrice(food models.Food, size string) (models.Money, error) {
+	if len(food.Size_prices) == 0 {
+		if food.Price == nil {
+			return 0, fmt.Errorf("%s has no price", *food.Name)
+		}
+		return *food.Price, nil
+	}
+	price, ok := food.Size_prices[size]
+	if !ok {
+		return 0, fmt.Errorf("%s is not available in size %s", *food.Name, size)
+	}
+	return price, nil
+}
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// smsProvider sends text messages. The provider is chosen with SMS_PROVIDER.
+type smsProvider interface {
+	// Name identifies the provider on the messages it sent
+	Name() string
+	// Send hands a message to the provider and returns the provider's id for it. The provider reports
+	// the delivery status to statusCallback when it supports it.
+	Send(ctx context.Context, to string, body string, statusCallback string) (string, error)
+}
+
+// loadSMSProvider returns the configured SMS provider, or nil when SMS_PROVIDER is not set, in which
+// case text messages stay queued
+func loadSMSProvider() (smsProvider, error) {
+	switch provider := strings.ToLower(os.Getenv("SMS_PROVIDER")); provider {
+	case "":
+		return nil, nil
+	case "log":
+		return logSMSProvider{}, nil
+	case "twilio":
+		twilio := twilioSMSProvider{
+			accountSid:          os.Getenv("TWILIO_ACCOUNT_SID"),
+			authToken:           os.Getenv("TWILIO_AUTH_TOKEN"),
+			from:                os.Getenv("TWILIO_FROM_NUMBER"),
+			messagingServiceSid: os.Getenv("TWILIO_MESSAGING_SERVICE_SID"),
+			apiUrl:              os.Getenv("TWILIO_API_URL"),
+		}
+		if twilio.apiUrl == "" {
+			twilio.apiUrl = "https://api.twilio.com"
+		}
+		if twilio.accountSid == "" || twilio.authToken == "" {
+			return nil, errors.New("TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN are required")
+		}
+		if twilio.from == "" && twilio.messagingServiceSid == "" {
+			return nil, errors.New("TWILIO_FROM_NUMBER or TWILIO_MESSAGING_SERVICE_SID is required")
+		}
+		return twilio, nil
+	default:
+		return nil, fmt.Errorf("unknown SMS_PROVIDER %q, use twilio or log", provider)
+	}
+}
+
+// logSMSProvider writes messages to the log instead of sending them, for development
+type logSMSProvider struct{}
+
+func (logSMSProvider) Name() string {
+	return "log"
+}
+
+func (logSMSProvider) Send(ctx context.Context, to string, body string, statusCallback string) (string, error) {
+	log.Printf("sms to %s: %s", to, body)
+	return fmt.Sprintf("log-%d", time.Now().UnixNano()), nil
+}
+
+// twilioSMSProvider sends messages with the Twilio Messaging API
+type twilioSMSProvider struct {
+	accountSid          string
+	authToken           string
+	from                string
+	messagingServiceSid string
+	apiUrl              string
+}
+
+func (twilioSMSProvider) Name() string {
+	return "twilio"
+}
+
+func (twilio twilioSMSProvider) Send(ctx context.Context, to string, body string, statusCallback string) (string, error) {
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("Body", body)
+	if twilio.messagingServiceSid != "" {
+		form.Set("MessagingServiceSid", twilio.messagingServiceSid)
+	} else {
+		form.Set("From", twilio.from)
+	}
+	if statusCallback != "" {
+		form.Set("StatusCallback", statusCallback)
+	}
+
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", strings.TrimRight(twilio.apiUrl, "/"), url.PathEscape(twilio.accountSid))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.SetBasicAuth(twilio.accountSid, twilio.authToken)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	var result struct {
+		Sid     string `json:"sid"`
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil && response.StatusCode < 300 {
+		return "", fmt.Errorf("Twilio answered with an unreadable response: %v", err)
+	}
+	if response.StatusCode >= 300 {
+		return "", fmt.Errorf("Twilio answered %d: %d %s", response.StatusCode, result.Code, result.Message)
+	}
+	return result.Sid, nil
+}
+
+// twilioSignature computes the X-Twilio-Signature of a request: the base64 HMAC-SHA1, keyed with the
+// auth token, of the URL followed by every POST parameter name and value, sorted by name
+func twilioSignature(authToken string, requestUrl string, params url.Values) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var signed strings.Builder
+	signed.WriteString(requestUrl)
+	for _, name := range names {
+		for _, value := range params[name] {
+			signed.WriteString(name)
+			signed.WriteString(value)
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(signed.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxSpreadsheetPartBytes caps how much of a single XLSX part is decompressed
+const maxSpreadsheetPartBytes = 50 << 20
+
+// readSpreadsheet returns the rows of a CSV file or of the first sheet of an XLSX workbook. Row i of
+// the result is row i+1 of the file, so errors can point at the row staff see in their spreadsheet;
+// empty rows are kept as empty slices.
+func readSpreadsheet(data []byte, maxRows int) ([][]string, error) {
+	// XLSX workbooks are zip archives
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return readXLSX(data, maxRows)
+	}
+	return readCSV(data, maxRows)
+}
+
+func readCSV(data []byte, maxRows int) ([][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	var rows [][]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("the CSV file could not be read: %v", err)
+		}
+		if len(rows) >= maxRows {
+			return nil, fmt.Errorf("the file has more than %d rows", maxRows-1)
+		}
+		rows = append(rows, record)
+	}
+}
+
+type xlsxRichText struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxRichText) String() string {
+	if len(t.R) == 0 {
+		return t.T
+	}
+	var text strings.Builder
+	for _, run := range t.R {
+		text.WriteString(run.T)
+	}
+	return text.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxRichText `xml:"si"`
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Id string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		Id     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R      string       `xml:"r,attr"`
+			T      string       `xml:"t,attr"`
+			V      string       `xml:"v"`
+			Inline xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX reads the cell values of the first sheet. Numbers are returned as stored (e.g. 12.5)
+// and booleans as 0 or 1; formulas are read from their cached values.
+func readXLSX(data []byte, maxRows int) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("the XLSX file could not be read")
+	}
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+	readPart := func(name string, v interface{}) error {
+		file, ok := files[name]
+		if !ok {
+			return fmt.Errorf("the XLSX file has no %s", name)
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		return xml.NewDecoder(io.LimitReader(reader, maxSpreadsheetPartBytes)).Decode(v)
+	}
+
+	// The first sheet is found through the workbook's relationships; sheet1.xml is the usual name
+	sheetName := "xl/worksheets/sheet1.xml"
+	var workbook xlsxWorkbook
+	var relationships xlsxRelationships
+	if readPart("xl/workbook.xml", &workbook) == nil && readPart("xl/_rels/workbook.xml.rels", &relationships) == nil && len(workbook.Sheets) > 0 {
+		for _, relationship := range relationships.Relationships {
+			if relationship.Id != workbook.Sheets[0].Id {
+				continue
+			}
+			if strings.HasPrefix(relationship.Target, "/") {
+				sheetName = strings.TrimPrefix(relationship.Target, "/")
+			} else {
+				sheetName = path.Join("xl", relationship.Target)
+			}
+		}
+	}
+
+	var sharedStrings xlsxSharedStrings
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := readPart("xl/sharedStrings.xml", &sharedStrings); err != nil {
+			return nil, errors.New("the XLSX file could not be read")
+		}
+	}
+	var sheet xlsxWorksheet
+	if err := readPart(sheetName, &sheet); err != nil {
+		return nil, errors.New("the XLSX file could not be read")
+	}
+
+	var rows [][]string
+	for _, row := range sheet.Rows {
+		rowIndex := len(rows)
+		if row.R > 0 {
+			rowIndex = row.R - 1
+		}
+		if rowIndex >= maxRows {
+			return nil, fmt.Errorf("the file has more than %d rows", maxRows-1)
+		}
+		for len(rows) <= rowIndex {
+			rows = append(rows, []string{})
+		}
+		for i, cell := range row.Cells {
+			column := i
+			if cell.R != "" {
+				column = xlsxColumnIndex(cell.R)
+			}
+			if column < 0 || column > 1000 {
+				return nil, errors.New("the XLSX file could not be read")
+			}
+
+			value := cell.V
+			switch cell.T {
+			case "s":
+				index, err := strconv.Atoi(cell.V)
+				if err != nil || index < 0 || index >= len(sharedStrings.Items) {
+					return nil, errors.New("the XLSX file could not be read")
+				}
+				value = sharedStrings.Items[index].String()
+			case "inlineStr":
+				value = cell.Inline.String()
+			}
+
+			for len(rows[rowIndex]) <= column {
+				rows[rowIndex] = append(rows[rowIndex], "")
+			}
+			rows[rowIndex][column] = value
+		}
+	}
+	return rows, nil
+}
+
+// xlsxColumnIndex returns the zero-based column of a cell reference such as "C12"
+func xlsxColumnIndex(reference string) int {
+	column := 0
+	for _, letter := range reference {
+		if letter < 'A' || letter > 'Z' {
+			break
+		}
+		column = column*26 + int(letter-'A'+1)
+	}
+	return column - 1
+}
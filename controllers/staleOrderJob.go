@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"golang-restaurant-management/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// StartStaleOrderJob launches the background job that looks for orders left open too long.
+// It is configured through environment variables:
+//   - STALE_ORDER_HOURS: hours an order may stay open before it is considered stale (default 12)
+//   - STALE_ORDER_ACTION: "flag" to only mark and report stale orders, "close" to auto-close them (default flag)
+//   - STALE_ORDER_CHECK_MINUTES: how often the job runs (default 15)
+func StartStaleOrderJob() {
+	hours := envInt("STALE_ORDER_HOURS", 12)
+	interval := envInt("STALE_ORDER_CHECK_MINUTES", 15)
+	action := os.Getenv("STALE_ORDER_ACTION")
+	if action != "close" {
+		action = "flag"
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		defer ticker.Stop()
+		for {
+			runStaleOrderCheck(time.Duration(hours)*time.Hour, action)
+			<-ticker.C
+		}
+	}()
+}
+
+func runStaleOrderCheck(maxAge time.Duration, action string) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	cutoff := time.Now().Add(-maxAge)
+	filter := bson.M{
+		"closed_at":  nil,
+		"created_at": bson.M{"$lt": cutoff},
+	}
+	if action == "flag" {
+		filter["stale_flagged_at"] = nil
+	}
+
+	cursor, err := orderCollection.Find(ctx, filter)
+	if err != nil {
+		log.Println("stale order job: error occured while listing open orders:", err)
+		return
+	}
+
+	var staleOrders []models.Order
+	if err = cursor.All(ctx, &staleOrders); err != nil {
+		log.Println("stale order job: error occured while decoding orders:", err)
+		return
+	}
+	if len(staleOrders) == 0 {
+		return
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	var orderIds []string
+	for _, order := range staleOrders {
+		orderIds = append(orderIds, order.Order_id)
+	}
+
+	set := bson.D{{"stale_flagged_at", now}, {"updated_at", now}}
+	if action == "close" {
+		set = append(set, bson.E{"closed_at", now}, bson.E{"close_reason", "STALE"})
+	}
+
+	_, err = orderCollection.UpdateMany(ctx, bson.M{"order_id": bson.M{"$in": orderIds}}, bson.D{{"$set", set}})
+	if err != nil {
+		log.Println("stale order job: order update failed:", err)
+		return
+	}
+
+	var changes []orderRevision
+	for _, orderId := range orderIds {
+		if action == "close" {
+			changes = append(changes, orderRevision{orderId: orderId, action: "ORDER_CLOSED", field: "close_reason", newValue: "STALE"})
+		} else {
+			changes = append(changes, orderRevision{orderId: orderId, action: "ORDER_UPDATED", field: "stale_flagged_at", newValue: now})
+		}
+	}
+	recordOrderRevisions(ctx, "system", changes...)
+	if action == "close" {
+		for _, order := range staleOrders {
+			if order.Table_id != nil {
+				releaseTable(ctx, *order.Table_id)
+			}
+		}
+	}
+
+	verb := "flagged"
+	if action == "close" {
+		verb = "auto-closed"
+	}
+	for _, order := range staleOrders {
+		message := fmt.Sprintf("Order #%d was open for more than %s and was %s", order.Order_number, maxAge, verb)
+		notifyManagers(ctx, "STALE_ORDER", "Stale open order", message, order.Order_id)
+	}
+}
+
+// envInt reads a positive integer from the environment, falling back to def when unset or invalid
+func envInt(key string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 1 {
+		return def
+	}
+	return value
+}
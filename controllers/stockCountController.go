@@ -0,0 +1,326 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var stockCountCollection *mongo.Collection = database.OpenCollection(database.Client, "stockCount")
+
+type OpenStockCountRequest struct {
+	Location_id *string `json:"location_id"`
+	Note        *string `json:"note" validate:"omitempty,max=200"`
+
+	// Inventory_item_ids are the items to count, all items when empty
+	Inventory_item_ids []string `json:"inventory_item_ids" validate:"omitempty,max=1000"`
+}
+
+type StockCountEntry struct {
+	Inventory_item_id *string  `json:"inventory_item_id" validate:"required"`
+	Counted_quantity  *float64 `json:"counted_quantity" validate:"required,min=0"`
+}
+
+type RecordStockCountRequest struct {
+	Lines []StockCountEntry `json:"lines" validate:"required,min=1,max=1000,dive"`
+}
+
+func GetStockCounts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		if locationId := c.Query("location_id"); locationId != "" {
+			filter["location_id"] = locationId
+		}
+		result, err := stockCountCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{"opened_at", -1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing stock counts"})
+			return
+		}
+		counts := []models.StockCount{}
+		if err = result.All(ctx, &counts); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing stock counts"})
+			return
+		}
+		c.JSON(http.StatusOK, counts)
+	}
+}
+
+func GetStockCount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var count models.StockCount
+		if err := stockCountCollection.FindOne(ctx, bson.M{"stock_count_id": c.Param("stock_count_id")}).Decode(&count); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "stock count was not found"})
+			return
+		}
+		c.JSON(http.StatusOK, count)
+	}
+}
+
+// OpenStockCount starts a physical count of some or all inventory items at a location. One count can be
+// open at a time per location.
+func OpenStockCount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request OpenStockCountRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		filter := bson.M{}
+		if len(request.Inventory_item_ids) > 0 {
+			filter["inventory_item_id"] = bson.M{"$in": request.Inventory_item_ids}
+		}
+		result, err := inventoryItemCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{"name", 1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing inventory items"})
+			return
+		}
+		var items []models.InventoryItem
+		if err = result.All(ctx, &items); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing inventory items"})
+			return
+		}
+		if len(items) == 0 || (len(request.Inventory_item_ids) > 0 && len(items) != len(request.Inventory_item_ids)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "inventory item was not found"})
+			return
+		}
+
+		var count models.StockCount
+		count.ID = primitive.NewObjectID()
+		count.Stock_count_id = count.ID.Hex()
+		count.Status = "OPEN"
+		count.Location_id = request.Location_id
+		count.Note = request.Note
+		for _, item := range items {
+			count.Lines = append(count.Lines, models.StockCountLine{Inventory_item_id: item.Inventory_item_id, Name: *item.Name, Unit: *item.Unit})
+		}
+		count.Opened_by = c.GetString("uid")
+		count.Opened_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		_, err = stockCountCollection.InsertOne(ctx, count)
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "another stock count is open at the location, close or cancel it first"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "stock count was not opened"})
+			return
+		}
+		c.JSON(http.StatusOK, count)
+	}
+}
+
+// RecordStockCount records the quantities found of items of an open count. The expected quantity is the
+// ledger's on-hand quantity at that moment, so stock used while counting does not show as a variance.
+// An item counted again replaces its earlier count.
+func RecordStockCount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request RecordStockCountRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		stockCountId := c.Param("stock_count_id")
+		var count models.StockCount
+		if err := stockCountCollection.FindOne(ctx, bson.M{"stock_count_id": stockCountId}).Decode(&count); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "stock count was not found"})
+			return
+		}
+		if count.Status != "OPEN" {
+			c.JSON(http.StatusConflict, gin.H{"error": "the stock count is " + count.Status})
+			return
+		}
+		onCount := map[string]bool{}
+		for _, line := range count.Lines {
+			onCount[line.Inventory_item_id] = true
+		}
+		var ids []string
+		for _, entry := range request.Lines {
+			if !onCount[*entry.Inventory_item_id] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "inventory item " + *entry.Inventory_item_id + " is not part of the count"})
+				return
+			}
+			ids = append(ids, *entry.Inventory_item_id)
+		}
+
+		locationId := ""
+		if count.Location_id != nil {
+			locationId = *count.Location_id
+		}
+		levels, err := stockLevels(ctx, ids, locationId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating stock levels"})
+			return
+		}
+		countedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		countedBy := c.GetString("uid")
+		for _, entry := range request.Lines {
+			expected := levels[*entry.Inventory_item_id]
+			result, err := stockCountCollection.UpdateOne(
+				ctx,
+				bson.M{"stock_count_id": stockCountId, "status": "OPEN", "lines.inventory_item_id": *entry.Inventory_item_id},
+				bson.D{{"$set", bson.D{
+					{"lines.$.counted_quantity", *entry.Counted_quantity},
+					{"lines.$.expected_quantity", expected},
+					{"lines.$.counted_by", countedBy},
+					{"lines.$.counted_at", countedAt},
+				}}},
+			)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "the count could not be recorded"})
+				return
+			}
+			if result.MatchedCount == 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "the stock count was closed in the meantime"})
+				return
+			}
+		}
+
+		stockCountCollection.FindOne(ctx, bson.M{"stock_count_id": stockCountId}).Decode(&count)
+		c.JSON(http.StatusOK, count)
+	}
+}
+
+// CloseStockCount closes a count and returns its variance report. Every counted item whose count differs
+// from the expected quantity gets an ADJUSTMENT movement for the variance, valued at the item's unit
+// cost; items that were not counted are left as they are.
+func CloseStockCount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		stockCountId := c.Param("stock_count_id")
+		closedBy := c.GetString("uid")
+		closedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		// Closing is claimed first, so a count closed twice at once posts its adjustments once
+		var count models.StockCount
+		err := stockCountCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"stock_count_id": stockCountId, "status": "OPEN"},
+			bson.D{{"$set", bson.D{{"status", "CLOSED"}, {"closed_by", closedBy}, {"closed_at", closedAt}}}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&count)
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "stock count was not found or is not open"})
+			return
+		}
+
+		var ids []string
+		for _, line := range count.Lines {
+			ids = append(ids, line.Inventory_item_id)
+		}
+		costs := map[string]float64{}
+		cursor, err := inventoryItemCollection.Find(ctx, bson.M{"inventory_item_id": bson.M{"$in": ids}})
+		if err == nil {
+			var items []models.InventoryItem
+			if cursor.All(ctx, &items) == nil {
+				for _, item := range items {
+					if item.Unit_cost != nil {
+						costs[item.Inventory_item_id] = *item.Unit_cost
+					}
+				}
+			}
+		}
+
+		movementType := "ADJUSTMENT"
+		reason := "stock count " + count.Stock_count_id
+		for i := range count.Lines {
+			line := &count.Lines[i]
+			if line.Counted_quantity == nil {
+				continue
+			}
+			variance := toFixed(*line.Counted_quantity-*line.Expected_quantity, 3)
+			value := toFixed(variance*costs[line.Inventory_item_id], 2)
+			line.Variance = &variance
+			line.Variance_value = &value
+			if value < 0 {
+				count.Shrinkage_value -= value
+			} else {
+				count.Surplus_value += value
+			}
+			if variance == 0 {
+				continue
+			}
+			movement := models.InventoryMovement{
+				Inventory_item_id: &line.Inventory_item_id,
+				Type:              &movementType,
+				Quantity:          &variance,
+				Reason:            &reason,
+				Location_id:       count.Location_id,
+				Reference_id:      &count.Stock_count_id,
+				Created_by:        closedBy,
+			}
+			if err := recordInventoryMovement(ctx, &movement); err != nil {
+				log.Println("failed to post the stock count adjustment of item", line.Inventory_item_id, ":", err)
+				continue
+			}
+			line.Movement_id = &movement.Movement_id
+		}
+		count.Shrinkage_value = toFixed(count.Shrinkage_value, 2)
+		count.Surplus_value = toFixed(count.Surplus_value, 2)
+
+		_, err = stockCountCollection.UpdateOne(
+			ctx,
+			bson.M{"stock_count_id": stockCountId},
+			bson.D{{"$set", bson.D{{"lines", count.Lines}, {"shrinkage_value", count.Shrinkage_value}, {"surplus_value", count.Surplus_value}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the stock count's variances could not be saved"})
+			return
+		}
+		c.JSON(http.StatusOK, count)
+	}
+}
+
+// CancelStockCount drops an open count without posting anything
+func CancelStockCount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := stockCountCollection.DeleteOne(ctx, bson.M{"stock_count_id": c.Param("stock_count_id"), "status": "OPEN"})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "stock count could not be cancelled"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "stock count was not found or is not open"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
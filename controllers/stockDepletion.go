@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// orderItemStockMovements returns the stock movements an order item's status change causes. Firing an
+// item (QUEUED to COOKING) depletes one portion of its food's recipe; voiding a fired item credits back
+// what firing it depleted, so a recipe changed in the meantime does not skew the stock.
+func orderItemStockMovements(ctx context.Context, orderItem models.OrderItem, current string, status string, changedBy string) ([]models.InventoryMovement, error) {
+	var movements []models.InventoryMovement
+
+	// Recalled items go back to COOKING without being made again from scratch
+	if status == "COOKING" && current == "QUEUED" {
+		var recipe models.Recipe
+		err := recipeCollection.FindOne(ctx, bson.M{"food_id": *orderItem.Food_id}).Decode(&recipe)
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// The stock is taken at the order's location
+		var order models.Order
+		if err := orderCollection.FindOne(ctx, bson.M{"order_id": orderItem.Order_id}).Decode(&order); err != nil {
+			return nil, err
+		}
+		movementType := "DEPLETION"
+		for _, ingredient := range recipe.Ingredients {
+			movements = append(movements, models.InventoryMovement{
+				Inventory_item_id: ingredient.Inventory_item_id,
+				Location_id:       order.Location_id,
+				Type:              &movementType,
+				Quantity:          ingredient.Quantity,
+				Reference_id:      &orderItem.Order_item_id,
+				Created_by:        changedBy,
+			})
+		}
+		return movements, nil
+	}
+
+	if status != "VOIDED" || current == "QUEUED" {
+		return nil, nil
+	}
+	result, err := inventoryMovementCollection.Find(ctx, bson.M{"reference_id": orderItem.Order_item_id, "type": "DEPLETION"})
+	if err != nil {
+		return nil, err
+	}
+	var depletions []models.InventoryMovement
+	if err = result.All(ctx, &depletions); err != nil {
+		return nil, err
+	}
+
+	// One credit per item and location, given back to the batches the depletions took it from
+	type creditKey struct{ inventoryItemId, locationId string }
+	credits := map[creditKey]*models.InventoryMovement{}
+	var keys []creditKey
+	movementType := "ADJUSTMENT"
+	reason := "order item " + orderItem.Order_item_id + " was voided"
+	for _, depletion := range depletions {
+		key := creditKey{inventoryItemId: *depletion.Inventory_item_id}
+		if depletion.Location_id != nil {
+			key.locationId = *depletion.Location_id
+		}
+		credit, ok := credits[key]
+		if !ok {
+			quantity := 0.0
+			credit = &models.InventoryMovement{
+				Inventory_item_id: depletion.Inventory_item_id,
+				Location_id:       depletion.Location_id,
+				Type:              &movementType,
+				Quantity:          &quantity,
+				Reason:            &reason,
+				Reference_id:      &orderItem.Order_item_id,
+				Created_by:        changedBy,
+			}
+			credits[key] = credit
+			keys = append(keys, key)
+		}
+		*credit.Quantity -= *depletion.Quantity
+		for _, batch := range depletion.Batches {
+			credit.Batches = append(credit.Batches, models.MovementBatch{Inventory_batch_id: batch.Inventory_batch_id, Quantity: -batch.Quantity})
+		}
+	}
+	for _, key := range keys {
+		if *credits[key].Quantity != 0 {
+			movements = append(movements, *credits[key])
+		}
+	}
+	return movements, nil
+}
+
+// runInTransaction runs fn in a MongoDB transaction, which commits only if fn returns no error.
+// Transactions need MongoDB to run as a replica set.
+func runInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return database.Client.UseSession(ctx, func(session mongo.SessionContext) error {
+		_, err := session.WithTransaction(session, func(session mongo.SessionContext) (interface{}, error) {
+			return nil, fn(session)
+		})
+		return err
+	})
+}
@@ -0,0 +1,342 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var stockTransferCollection *mongo.Collection = database.OpenCollection(database.Client, "stockTransfer")
+
+type StockTransferReceipt struct {
+	Inventory_item_id *string  `json:"inventory_item_id" validate:"required"`
+	Received_quantity *float64 `json:"received_quantity" validate:"required,min=0"`
+}
+
+type ReceiveStockTransferRequest struct {
+	// Lines are the quantities that arrived; items not listed arrived in full
+	Lines []StockTransferReceipt `json:"lines" validate:"omitempty,max=200,dive"`
+}
+
+// errStockTransferNotInTransit is returned when a transfer was received or cancelled in the meantime
+var errStockTransferNotInTransit = errors.New("stock transfer was not found or is no longer in transit")
+
+// transferMovement is a TRANSFER movement of a line of a transfer at a location
+func transferMovement(transfer models.StockTransfer, inventoryItemId *string, locationId *string, quantity float64, createdBy string) models.InventoryMovement {
+	movementType := "TRANSFER"
+	reason := "stock transfer " + transfer.Stock_transfer_id
+	return models.InventoryMovement{
+		Inventory_item_id: inventoryItemId,
+		Location_id:       locationId,
+		Type:              &movementType,
+		Quantity:          &quantity,
+		Reason:            &reason,
+		Reference_id:      &transfer.Stock_transfer_id,
+		Created_by:        createdBy,
+	}
+}
+
+// receivedMovements are the TRANSFER movements that add a received line to the receiving location. Stock
+// sent from batches arrives as batches with the same expiry dates, the first to expire first.
+func receivedMovements(ctx context.Context, transfer models.StockTransfer, line models.StockTransferLine, receivedBy string) ([]models.InventoryMovement, error) {
+	var movements []models.InventoryMovement
+	remaining := *line.Received_quantity
+
+	sent, err := takenBatches(ctx, bson.M{"reference_id": transfer.Stock_transfer_id, "inventory_item_id": line.Inventory_item_id, "location_id": transfer.From_location_id})
+	if err != nil {
+		return nil, err
+	}
+	quantities := map[string]float64{}
+	ids := []string{}
+	for _, batch := range sent {
+		quantities[batch.Inventory_batch_id] += batch.Quantity
+		ids = append(ids, batch.Inventory_batch_id)
+	}
+	if len(ids) > 0 {
+		result, err := inventoryBatchCollection.Find(ctx, bson.M{"inventory_batch_id": bson.M{"$in": ids}}, options.Find().SetSort(bson.D{{"expires_at", 1}}))
+		if err != nil {
+			return nil, err
+		}
+		var batches []models.InventoryBatch
+		if err = result.All(ctx, &batches); err != nil {
+			return nil, err
+		}
+		for _, batch := range batches {
+			quantity := toFixed(math.Min(remaining, quantities[batch.Inventory_batch_id]), 3)
+			if quantity <= 0 {
+				continue
+			}
+			movement := transferMovement(transfer, line.Inventory_item_id, transfer.To_location_id, quantity, receivedBy)
+			expiresAt := batch.Expires_at
+			movement.Expires_at, movement.Lot_number = &expiresAt, batch.Lot_number
+			movements = append(movements, movement)
+			remaining -= quantity
+		}
+	}
+
+	if remaining = toFixed(remaining, 3); remaining > 0 {
+		movements = append(movements, transferMovement(transfer, line.Inventory_item_id, transfer.To_location_id, remaining, receivedBy))
+	}
+	return movements, nil
+}
+
+func GetStockTransfers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		if locationId := c.Query("location_id"); locationId != "" {
+			filter["$or"] = bson.A{bson.M{"from_location_id": locationId}, bson.M{"to_location_id": locationId}}
+		}
+		result, err := stockTransferCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{"created_at", -1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing stock transfers"})
+			return
+		}
+		transfers := []models.StockTransfer{}
+		if err = result.All(ctx, &transfers); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing stock transfers"})
+			return
+		}
+		c.JSON(http.StatusOK, transfers)
+	}
+}
+
+func GetStockTransfer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var transfer models.StockTransfer
+		if err := stockTransferCollection.FindOne(ctx, bson.M{"stock_transfer_id": c.Param("stock_transfer_id")}).Decode(&transfer); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "stock transfer was not found"})
+			return
+		}
+		c.JSON(http.StatusOK, transfer)
+	}
+}
+
+// CreateStockTransfer sends stock from one location to another. The stock leaves the sending location
+// at once and is in transit until the receiving location receives it.
+func CreateStockTransfer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var transfer models.StockTransfer
+		if err := c.BindJSON(&transfer); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(transfer); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		ids := []string{}
+		listed := map[string]bool{}
+		for i := range transfer.Lines {
+			id := *transfer.Lines[i].Inventory_item_id
+			if listed[id] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "inventory item " + id + " is listed twice"})
+				return
+			}
+			listed[id] = true
+			ids = append(ids, id)
+			transfer.Lines[i].Received_quantity = nil
+		}
+		count, err := inventoryItemCollection.CountDocuments(ctx, bson.M{"inventory_item_id": bson.M{"$in": ids}})
+		if err != nil || int(count) != len(ids) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "inventory item was not found"})
+			return
+		}
+
+		transfer.ID = primitive.NewObjectID()
+		transfer.Stock_transfer_id = transfer.ID.Hex()
+		transfer.Status = "IN_TRANSIT"
+		transfer.Created_by = c.GetString("uid")
+		transfer.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		transfer.Received_by, transfer.Received_at = nil, nil
+		transfer.Cancelled_by, transfer.Cancelled_at = nil, nil
+
+		err = runInTransaction(ctx, func(ctx context.Context) error {
+			if _, err := stockTransferCollection.InsertOne(ctx, transfer); err != nil {
+				return err
+			}
+			for _, line := range transfer.Lines {
+				movement := transferMovement(transfer, line.Inventory_item_id, transfer.From_location_id, -*line.Quantity, transfer.Created_by)
+				if err := recordInventoryMovement(ctx, &movement); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "stock transfer was not created"})
+			return
+		}
+		c.JSON(http.StatusOK, transfer)
+	}
+}
+
+// ReceiveStockTransfer confirms a transfer arrived and adds the stock to the receiving location. Quantities
+// that did not arrive are not added anywhere, so they show as lost on the transfer.
+func ReceiveStockTransfer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request ReceiveStockTransferRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		stockTransferId := c.Param("stock_transfer_id")
+		var transfer models.StockTransfer
+		if err := stockTransferCollection.FindOne(ctx, bson.M{"stock_transfer_id": stockTransferId}).Decode(&transfer); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "stock transfer was not found"})
+			return
+		}
+		received := map[string]float64{}
+		for _, receipt := range request.Lines {
+			received[*receipt.Inventory_item_id] = *receipt.Received_quantity
+		}
+		for i := range transfer.Lines {
+			line := &transfer.Lines[i]
+			quantity := *line.Quantity
+			if value, ok := received[*line.Inventory_item_id]; ok {
+				if value > quantity {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "more of inventory item " + *line.Inventory_item_id + " was received than was sent"})
+					return
+				}
+				quantity = value
+				delete(received, *line.Inventory_item_id)
+			}
+			line.Received_quantity = &quantity
+		}
+		for id := range received {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "inventory item " + id + " is not part of the transfer"})
+			return
+		}
+
+		receivedBy := c.GetString("uid")
+		receivedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		err := runInTransaction(ctx, func(ctx context.Context) error {
+			result, err := stockTransferCollection.UpdateOne(
+				ctx,
+				bson.M{"stock_transfer_id": stockTransferId, "status": "IN_TRANSIT"},
+				bson.D{{"$set", bson.D{{"status", "RECEIVED"}, {"lines", transfer.Lines}, {"received_by", receivedBy}, {"received_at", receivedAt}}}},
+			)
+			if err != nil {
+				return err
+			}
+			if result.MatchedCount == 0 {
+				return errStockTransferNotInTransit
+			}
+			for _, line := range transfer.Lines {
+				if *line.Received_quantity == 0 {
+					continue
+				}
+				movements, err := receivedMovements(ctx, transfer, line, receivedBy)
+				if err != nil {
+					return err
+				}
+				for i := range movements {
+					if err := recordInventoryMovement(ctx, &movements[i]); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err == errStockTransferNotInTransit {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "stock transfer could not be received"})
+			return
+		}
+
+		transfer.Status = "RECEIVED"
+		transfer.Received_by = &receivedBy
+		transfer.Received_at = &receivedAt
+		c.JSON(http.StatusOK, transfer)
+	}
+}
+
+// CancelStockTransfer cancels a transfer still in transit and returns its stock to the sending location and
+// the batches it was sent from
+func CancelStockTransfer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		stockTransferId := c.Param("stock_transfer_id")
+		var transfer models.StockTransfer
+		if err := stockTransferCollection.FindOne(ctx, bson.M{"stock_transfer_id": stockTransferId}).Decode(&transfer); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "stock transfer was not found"})
+			return
+		}
+
+		cancelledBy := c.GetString("uid")
+		cancelledAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		err := runInTransaction(ctx, func(ctx context.Context) error {
+			result, err := stockTransferCollection.UpdateOne(
+				ctx,
+				bson.M{"stock_transfer_id": stockTransferId, "status": "IN_TRANSIT"},
+				bson.D{{"$set", bson.D{{"status", "CANCELLED"}, {"cancelled_by", cancelledBy}, {"cancelled_at", cancelledAt}}}},
+			)
+			if err != nil {
+				return err
+			}
+			if result.MatchedCount == 0 {
+				return errStockTransferNotInTransit
+			}
+			for _, line := range transfer.Lines {
+				movement := transferMovement(transfer, line.Inventory_item_id, transfer.From_location_id, *line.Quantity, cancelledBy)
+				// The stock goes back to the batches it was sent from
+				movement.Batches, err = takenBatches(ctx, bson.M{"reference_id": transfer.Stock_transfer_id, "inventory_item_id": line.Inventory_item_id, "location_id": transfer.From_location_id})
+				if err != nil {
+					return err
+				}
+				if err := recordInventoryMovement(ctx, &movement); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err == errStockTransferNotInTransit {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "stock transfer could not be cancelled"})
+			return
+		}
+
+		transfer.Status = "CANCELLED"
+		transfer.Cancelled_by = &cancelledBy
+		transfer.Cancelled_at = &cancelledAt
+		c.JSON(http.StatusOK, transfer)
+	}
+}
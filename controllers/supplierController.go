@@ -0,0 +1,346 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var supplierCollection *mongo.Collection = database.OpenCollection(database.Client, "supplier")
+
+// SupplierOffer is what a supplier charges for an inventory item
+type SupplierOffer struct {
+	Supplier_id        string    `json:"supplier_id"`
+	Name               string    `json:"name"`
+	Unit_cost          float64   `json:"unit_cost"`
+	Min_order_quantity *float64  `json:"min_order_quantity"`
+	Payment_terms_days *int      `json:"payment_terms_days"`
+	Lead_time_days     *int      `json:"lead_time_days"`
+	Updated_at         time.Time `json:"updated_at"`
+}
+
+// supplierNamePattern matches a supplier name exactly, ignoring case
+func supplierNamePattern(name string) bson.M {
+	return bson.M{"$regex": "^" + regexp.QuoteMeta(name) + "$", "$options": "i"}
+}
+
+// checkSupplierName checks that no other supplier has the name, ignoring case, so vendor invoices can
+// be linked to their supplier by name
+func checkSupplierName(ctx context.Context, name string, supplierId string) error {
+	count, err := supplierCollection.CountDocuments(ctx, bson.M{"name": supplierNamePattern(name), "supplier_id": bson.M{"$ne": supplierId}})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("supplier %s already exists", name)
+	}
+	return nil
+}
+
+// checkSupplierPrices checks that the inventory items of a price list exist and are listed once, and
+// stamps the prices with the time they were set
+func checkSupplierPrices(ctx context.Context, prices []models.SupplierPrice, now time.Time) error {
+	ids := []string{}
+	for _, price := range prices {
+		ids = append(ids, *price.Inventory_item_id)
+	}
+	count, err := inventoryItemCollection.CountDocuments(ctx, bson.M{"inventory_item_id": bson.M{"$in": ids}})
+	if err != nil {
+		return err
+	}
+	listed := map[string]bool{}
+	for i := range prices {
+		id := *prices[i].Inventory_item_id
+		if listed[id] {
+			return fmt.Errorf("inventory item %s is listed twice", id)
+		}
+		listed[id] = true
+		prices[i].Updated_at = now
+	}
+	if int(count) != len(listed) {
+		return fmt.Errorf("inventory item was not found")
+	}
+	return nil
+}
+
+func GetSuppliers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if inventoryItemId := c.Query("inventory_item_id"); inventoryItemId != "" {
+			filter["prices.inventory_item_id"] = inventoryItemId
+		}
+		result, err := supplierCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{"name", 1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing suppliers"})
+			return
+		}
+		suppliers := []models.Supplier{}
+		if err = result.All(ctx, &suppliers); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing suppliers"})
+			return
+		}
+		c.JSON(http.StatusOK, suppliers)
+	}
+}
+
+func GetSupplier() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var supplier models.Supplier
+		if err := supplierCollection.FindOne(ctx, bson.M{"supplier_id": c.Param("supplier_id")}).Decode(&supplier); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "supplier was not found"})
+			return
+		}
+		c.JSON(http.StatusOK, supplier)
+	}
+}
+
+func CreateSupplier() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var supplier models.Supplier
+		if err := c.BindJSON(&supplier); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(supplier); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		supplier.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		supplier.Updated_at = supplier.Created_at
+		if err := checkSupplierName(ctx, *supplier.Name, ""); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if supplier.Prices == nil {
+			supplier.Prices = []models.SupplierPrice{}
+		}
+		if err := checkSupplierPrices(ctx, supplier.Prices, supplier.Created_at); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		supplier.ID = primitive.NewObjectID()
+		supplier.Supplier_id = supplier.ID.Hex()
+
+		if _, err := supplierCollection.InsertOne(ctx, supplier); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "supplier was not created"})
+			return
+		}
+		c.JSON(http.StatusOK, supplier)
+	}
+}
+
+// UpdateSupplier changes a supplier's name, contacts, payment terms, lead time or price list. Contacts and prices
+// are replaced as a whole.
+func UpdateSupplier() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var supplier models.Supplier
+		supplierId := c.Param("supplier_id")
+		if err := c.BindJSON(&supplier); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		var updateObj primitive.D
+
+		if supplier.Name != nil {
+			if validationErr := validate.Var(*supplier.Name, "min=2,max=100"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "name must be between 2 and 100 characters"})
+				return
+			}
+			if err := checkSupplierName(ctx, *supplier.Name, supplierId); err != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"name", supplier.Name})
+		}
+
+		if supplier.Contacts != nil {
+			if validationErr := validate.Var(supplier.Contacts, "max=10,dive"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"contacts", supplier.Contacts})
+		}
+
+		if supplier.Payment_terms_days != nil {
+			if *supplier.Payment_terms_days < 0 || *supplier.Payment_terms_days > 180 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "payment_terms_days must be between 0 and 180"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"payment_terms_days", supplier.Payment_terms_days})
+		}
+
+		if supplier.Lead_time_days != nil {
+			if *supplier.Lead_time_days < 0 || *supplier.Lead_time_days > 90 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "lead_time_days must be between 0 and 90"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"lead_time_days", supplier.Lead_time_days})
+		}
+
+		if supplier.Prices != nil {
+			if validationErr := validate.Var(supplier.Prices, "max=500,dive"); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+				return
+			}
+			if err := checkSupplierPrices(ctx, supplier.Prices, updatedAt); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"prices", supplier.Prices})
+		}
+
+		updateObj = append(updateObj, bson.E{"updated_at", updatedAt})
+
+		result, err := supplierCollection.UpdateOne(ctx, bson.M{"supplier_id": supplierId}, bson.D{{"$set", updateObj}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "supplier update failed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "supplier was not found"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// DeleteSupplier removes a supplier; its vendor invoices keep the supplier's name
+func DeleteSupplier() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := supplierCollection.DeleteOne(ctx, bson.M{"supplier_id": c.Param("supplier_id")})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "supplier could not be deleted"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "supplier was not found"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// GetInventoryItemSuppliers lists the suppliers selling an inventory item, the cheapest first, to pick
+// who to reorder from
+func GetInventoryItemSuppliers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		inventoryItemId := c.Param("inventory_item_id")
+		count, err := inventoryItemCollection.CountDocuments(ctx, bson.M{"inventory_item_id": inventoryItemId})
+		if err != nil || count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "inventory item was not found"})
+			return
+		}
+
+		offers, err := supplierOffers(ctx, []string{inventoryItemId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing suppliers"})
+			return
+		}
+		if offers[inventoryItemId] == nil {
+			offers[inventoryItemId] = []SupplierOffer{}
+		}
+
+		var cheapest *SupplierOffer
+		if len(offers[inventoryItemId]) > 0 {
+			cheapest = &offers[inventoryItemId][0]
+		}
+		c.JSON(http.StatusOK, gin.H{"cheapest": cheapest, "suppliers": offers[inventoryItemId]})
+	}
+}
+
+// supplierOffers returns what the suppliers charge for each of the given inventory items, the cheapest
+// offer first
+func supplierOffers(ctx context.Context, inventoryItemIds []string) (map[string][]SupplierOffer, error) {
+	result, err := supplierCollection.Find(ctx, bson.M{"prices.inventory_item_id": bson.M{"$in": inventoryItemIds}})
+	if err != nil {
+		return nil, err
+	}
+	var suppliers []models.Supplier
+	if err = result.All(ctx, &suppliers); err != nil {
+		return nil, err
+	}
+
+	wanted := map[string]bool{}
+	for _, id := range inventoryItemIds {
+		wanted[id] = true
+	}
+	offers := map[string][]SupplierOffer{}
+	for _, supplier := range suppliers {
+		for _, price := range supplier.Prices {
+			if !wanted[*price.Inventory_item_id] {
+				continue
+			}
+			offers[*price.Inventory_item_id] = append(offers[*price.Inventory_item_id], SupplierOffer{
+				Supplier_id:        supplier.Supplier_id,
+				Name:               *supplier.Name,
+				Unit_cost:          *price.Unit_cost,
+				Min_order_quantity: price.Min_order_quantity,
+				Payment_terms_days: supplier.Payment_terms_days,
+				Lead_time_days:     supplier.Lead_time_days,
+				Updated_at:         price.Updated_at,
+			})
+		}
+	}
+	for _, itemOffers := range offers {
+		sort.SliceStable(itemOffers, func(i, j int) bool {
+			if itemOffers[i].Unit_cost != itemOffers[j].Unit_cost {
+				return itemOffers[i].Unit_cost < itemOffers[j].Unit_cost
+			}
+			return itemOffers[i].Name < itemOffers[j].Name
+		})
+	}
+	return offers, nil
+}
+
+// updateSupplierPrice sets the price a supplier charges for an inventory item, adding the item to the
+// supplier's price list when it is not on it yet
+func updateSupplierPrice(ctx context.Context, supplierId string, inventoryItemId string, unitCost float64) error {
+	updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	result, err := supplierCollection.UpdateOne(
+		ctx,
+		bson.M{"supplier_id": supplierId, "prices.inventory_item_id": inventoryItemId},
+		bson.D{{"$set", bson.D{{"prices.$.unit_cost", unitCost}, {"prices.$.updated_at", updatedAt}, {"updated_at", updatedAt}}}},
+	)
+	if err != nil || result.MatchedCount > 0 {
+		return err
+	}
+	price := models.SupplierPrice{Inventory_item_id: &inventoryItemId, Unit_cost: &unitCost, Updated_at: updatedAt}
+	_, err = supplierCollection.UpdateOne(
+		ctx,
+		bson.M{"supplier_id": supplierId},
+		bson.D{{"$push", bson.D{{"prices", price}}}, {"$set", bson.D{{"updated_at", updatedAt}}}},
+	)
+	return err
+}
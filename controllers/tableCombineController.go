@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang-restaurant-management/models"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CombineTablesRequest struct {
+	Table_ids        []string `json:"table_ids" validate:"required,min=2,max=10,dive,required"`
+	Number_of_guests *int     `json:"number_of_guests" validate:"required,min=1"`
+}
+
+// isCombinedTable reports whether a table is a temporary table made of other tables
+func isCombinedTable(table models.Table) bool {
+	return len(table.Combined_table_ids) > 0
+}
+
+// resolveCombinedTable replaces a table that is part of a combined table with the combined table, so
+// orders and parties placed on any of its tables go to the combined table
+func resolveCombinedTable(ctx context.Context, table *models.Table) error {
+	if table.Split_at != nil {
+		return errors.New("the table was split back into its tables")
+	}
+	if table.Combined_into == nil {
+		return nil
+	}
+	var combined models.Table
+	if err := tableCollection.FindOne(ctx, bson.M{"table_id": *table.Combined_into}).Decode(&combined); err != nil {
+		return errors.New("the table's combined table was not found")
+	}
+	*table = combined
+	return nil
+}
+
+// splitCombinedTable restores the tables of a combined table. They are DIRTY when a party was seated at
+// the combined table and AVAILABLE otherwise. It reports false when the table was already split.
+func splitCombinedTable(ctx context.Context, table models.Table) (bool, error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	status := "AVAILABLE"
+	if current := tableStatus(table); current == "SEATED" || current == "DIRTY" {
+		status = "DIRTY"
+	}
+
+	result, err := tableCollection.UpdateOne(
+		ctx,
+		bson.M{"table_id": table.Table_id, "split_at": nil},
+		bson.D{{"$set", bson.D{{"split_at", now}, {"status", status}, {"status_changed_at", now}, {"updated_at", now}}}},
+	)
+	if err != nil || result.MatchedCount == 0 {
+		return false, err
+	}
+	_, err = tableCollection.UpdateMany(
+		ctx,
+		bson.M{"table_id": bson.M{"$in": table.Combined_table_ids}, "combined_into": table.Table_id},
+		bson.D{{"$set", bson.D{{"combined_into", nil}, {"status", status}, {"status_changed_at", now}, {"updated_at", now}}}},
+	)
+	if err != nil {
+		return false, err
+	}
+	clearSeatings(ctx, table.Table_id)
+	return true, nil
+}
+
+// CombineTables pushes tables together for a large party. A temporary table is created with the
+// summed capacity and the lowest table number; orders placed on any of the tables go to it until it is
+// split. Only AVAILABLE or RESERVED tables without open orders can be combined.
+func CombineTables() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request CombineTablesRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		listed := map[string]bool{}
+		for _, tableId := range request.Table_ids {
+			if listed[tableId] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "table " + tableId + " is listed twice"})
+				return
+			}
+			listed[tableId] = true
+		}
+
+		cursor, err := tableCollection.Find(ctx, bson.M{"table_id": bson.M{"$in": request.Table_ids}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the tables"})
+			return
+		}
+		var tables []models.Table
+		if err = cursor.All(ctx, &tables); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the tables"})
+			return
+		}
+		if len(tables) != len(request.Table_ids) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "table was not found"})
+			return
+		}
+		sort.Slice(tables, func(i, j int) bool { return *tables[i].Table_number < *tables[j].Table_number })
+
+		status := "AVAILABLE"
+		capacity := 0
+		for _, table := range tables {
+			if isCombinedTable(table) || table.Combined_into != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": "combined tables cannot be combined again"})
+				return
+			}
+			if (table.Location_id == nil) != (tables[0].Location_id == nil) || (table.Location_id != nil && *table.Location_id != *tables[0].Location_id) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "only tables at the same location can be combined"})
+				return
+			}
+			current := tableStatus(table)
+			if current != "AVAILABLE" && current != "RESERVED" {
+				c.JSON(http.StatusConflict, gin.H{"error": "only AVAILABLE or RESERVED tables can be combined"})
+				return
+			}
+			if current == "RESERVED" {
+				status = "RESERVED"
+			}
+			open, err := tableHasOpenOrders(ctx, table.Table_id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the tables' orders"})
+				return
+			}
+			if open {
+				c.JSON(http.StatusConflict, gin.H{"error": "tables with open orders cannot be combined"})
+				return
+			}
+			if capacity >= 0 && table.Capacity != nil {
+				capacity += *table.Capacity
+			} else {
+				capacity = -1
+			}
+		}
+
+		if capacity > 0 && *request.Number_of_guests > capacity {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("the tables seat %d guests, a party of %d does not fit", capacity, *request.Number_of_guests)})
+			return
+		}
+
+		var combined models.Table
+		combined.ID = primitive.NewObjectID()
+		combined.Table_id = combined.ID.Hex()
+		combined.Table_number = tables[0].Table_number
+		combined.Section = tables[0].Section
+		combined.Location_id = tables[0].Location_id
+		combined.Number_of_guests = request.Number_of_guests
+		if capacity > 0 {
+			combined.Capacity = &capacity
+		}
+		for _, table := range tables {
+			combined.Combined_table_ids = append(combined.Combined_table_ids, table.Table_id)
+		}
+		combined.Status = &status
+		combined.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		combined.Updated_at = combined.Created_at
+		combined.Status_changed_at = &combined.Created_at
+
+		if _, err := tableCollection.InsertOne(ctx, combined); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the tables could not be combined"})
+			return
+		}
+
+		// Tables taken by another party in the meantime undo the combination
+		result, err := tableCollection.UpdateMany(
+			ctx,
+			bson.M{"table_id": bson.M{"$in": combined.Combined_table_ids}, "combined_into": nil, "status": tableStatusIn("AVAILABLE", "RESERVED")},
+			bson.D{{"$set", bson.D{{"combined_into", combined.Table_id}, {"updated_at", combined.Created_at}}}},
+		)
+		if err != nil || int(result.MatchedCount) != len(tables) {
+			tableCollection.UpdateMany(ctx, bson.M{"combined_into": combined.Table_id}, bson.D{{"$set", bson.D{{"combined_into", nil}}}})
+			tableCollection.DeleteOne(ctx, bson.M{"table_id": combined.Table_id})
+			c.JSON(http.StatusConflict, gin.H{"error": "the tables changed in the meantime, please try again"})
+			return
+		}
+
+		c.JSON(http.StatusOK, combined)
+	}
+}
+
+// SplitTable splits a combined table back into its tables before its party left, e.g. when it was
+// combined by mistake. Combined tables are split automatically once their last open order is closed.
+func SplitTable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			Table_id *string `json:"table_id" validate:"required"`
+		}
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		var table models.Table
+		if err := tableCollection.FindOne(ctx, bson.M{"table_id": *request.Table_id}).Decode(&table); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "table was not found"})
+			return
+		}
+		if !isCombinedTable(table) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the table is not a combined table"})
+			return
+		}
+		open, err := tableHasOpenOrders(ctx, table.Table_id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the table's orders"})
+			return
+		}
+		if open {
+			c.JSON(http.StatusConflict, gin.H{"error": "the table still has open orders"})
+			return
+		}
+
+		split, err := splitCombinedTable(ctx, table)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the table could not be split"})
+			return
+		}
+		if !split {
+			c.JSON(http.StatusConflict, gin.H{"error": "the table was already split"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"table_id": table.Table_id, "table_ids": table.Combined_table_ids})
+	}
+}
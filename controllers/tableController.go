@@ -18,14 +18,29 @@ import (
 
 var tableCollection *mongo.Collection = database.OpenCollection(database.Client, "table")
 
+// GetTables lists the tables, optionally only those in the given status (e.g. AVAILABLE for the host stand).
+// Combined tables that were split again are left out, and so are the tables of a combined table when
+// filtering by status. Deleted tables are listed with include_deleted=true.
 func GetTables() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 
-		result, err := orderCollection.Find(context.TODO(), bson.M{})
+		filter := bson.M{"split_at": nil}
+		if c.Query("include_deleted") != "true" {
+			filter["deleted_at"] = nil
+		}
+		if locationId := c.Query("location_id"); locationId != "" {
+			filter["location_id"] = locationId
+		}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = tableStatusIn(status)
+			filter["combined_into"] = nil
+		}
+		result, err := tableCollection.Find(context.TODO(), filter)
 		defer cancel()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing table items"})
+			return
 		}
 		var allTables []bson.M
 		if err = result.All(ctx, &allTables); err != nil {
@@ -68,14 +83,34 @@ func CreateTable() gin.HandlerFunc {
 			return
 		}
 
+		if err := checkTableCapacity(table, *table.Number_of_guests); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkTableNumber(ctx, table.Location_id, *table.Table_number, ""); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
 		table.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		table.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 
 		table.ID = primitive.NewObjectID()
 		table.Table_id = table.ID.Hex()
+		if table.Status == nil {
+			status := "AVAILABLE"
+			table.Status = &status
+		}
+		table.Status_changed_at = &table.Created_at
+		table.Active_table_number = table.Table_number
+		table.Deleted_at = nil
 
 		result, insertErr := tableCollection.InsertOne(ctx, table)
 
+		if mongo.IsDuplicateKeyError(insertErr) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("table %d already exists", *table.Table_number)})
+			return
+		}
 		if insertErr != nil {
 			msg := fmt.Sprintf("Table item was not created")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
@@ -107,8 +142,57 @@ func UpdateTable() gin.HandlerFunc {
 			updateObj = append(updateObj, bson.E{"number_of_guests", table.Number_of_guests})
 		}
 
+		var existingTable models.Table
+		if err := tableCollection.FindOne(ctx, bson.M{"table_id": tableId}).Decode(&existingTable); err == nil && existingTable.Deleted_at != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "the table was deleted, restore it first"})
+			return
+		}
+
 		if table.Table_number != nil {
+			if *table.Table_number < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "table number must be at least 1"})
+				return
+			}
 			updateObj = append(updateObj, bson.E{"table_number", table.Table_number})
+			if !isCombinedTable(existingTable) {
+				if err := checkTableNumber(ctx, existingTable.Location_id, *table.Table_number, tableId); err != nil {
+					c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+					return
+				}
+				updateObj = append(updateObj, bson.E{"active_table_number", table.Table_number})
+			}
+		}
+
+		if table.Section != nil {
+			if len(*table.Section) > 50 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "section must be at most 50 characters"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"section", table.Section})
+		}
+
+		if table.Capacity != nil {
+			if *table.Capacity < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "capacity must be at least 1"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"capacity", table.Capacity})
+		}
+
+		// The guests seated have to fit at the table, whichever of the two changes
+		if existingTable.Table_id != "" && (table.Number_of_guests != nil || table.Capacity != nil) {
+			if table.Number_of_guests != nil {
+				existingTable.Number_of_guests = table.Number_of_guests
+			}
+			if table.Capacity != nil {
+				existingTable.Capacity = table.Capacity
+			}
+			if existingTable.Number_of_guests != nil && existingTable.Table_number != nil {
+				if err := checkTableCapacity(existingTable, *existingTable.Number_of_guests); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+			}
 		}
 
 		table.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
@@ -129,6 +213,10 @@ func UpdateTable() gin.HandlerFunc {
 			&opt,
 		)
 
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("table %d already exists", *table.Table_number)})
+			return
+		}
 		if err != nil {
 			msg := fmt.Sprintf("table item update failed")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
@@ -139,3 +227,130 @@ func UpdateTable() gin.HandlerFunc {
 		c.JSON(http.StatusOK, result)
 	}
 }
+
+// checkTableCapacity checks that a party fits at a table. Tables without a capacity are not checked.
+func checkTableCapacity(table models.Table, guests int) error {
+	if table.Capacity != nil && guests > *table.Capacity {
+		return fmt.Errorf("table %d seats %d guests, a party of %d does not fit", *table.Table_number, *table.Capacity, guests)
+	}
+	return nil
+}
+
+// checkTableNumber checks that no other table of the location that is not deleted has the number
+func checkTableNumber(ctx context.Context, locationId *string, tableNumber int, tableId string) error {
+	count, err := tableCollection.CountDocuments(ctx, bson.M{
+		"location_id":         locationId,
+		"active_table_number": tableNumber,
+		"table_id":            bson.M{"$ne": tableId},
+	})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("table %d already exists", tableNumber)
+	}
+	return nil
+}
+
+// checkTableLocation checks that a table is at the location of an order; either location may be unset
+func checkTableLocation(table models.Table, locationId *string) error {
+	if table.Location_id != nil && locationId != nil && *table.Location_id != *locationId {
+		return fmt.Errorf("table %d is at another location", *table.Table_number)
+	}
+	return nil
+}
+
+// DeleteTable retires a table. It is kept for the orders, seatings and reports that reference it, but it
+// is OUT_OF_SERVICE, left out of listings, and its number can be given to a new table. Only tables without
+// a party or open orders can be deleted; combined tables are split instead.
+func DeleteTable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		tableId := c.Param("table_id")
+		var table models.Table
+		if err := tableCollection.FindOne(ctx, bson.M{"table_id": tableId}).Decode(&table); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "table was not found"})
+			return
+		}
+		if table.Deleted_at != nil {
+			c.JSON(http.StatusOK, gin.H{"table_id": tableId, "deleted_at": table.Deleted_at})
+			return
+		}
+		if isCombinedTable(table) || table.Combined_into != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "combined tables cannot be deleted, split them first"})
+			return
+		}
+		if tableStatus(table) == "SEATED" {
+			c.JSON(http.StatusConflict, gin.H{"error": "a party is seated at the table"})
+			return
+		}
+		open, err := tableHasOpenOrders(ctx, tableId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the table's orders"})
+			return
+		}
+		if open {
+			c.JSON(http.StatusConflict, gin.H{"error": "the table still has open orders"})
+			return
+		}
+
+		deletedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		deleted, err := setTableStatus(ctx, tableId, []string{"AVAILABLE", "RESERVED", "DIRTY", "OUT_OF_SERVICE"}, "OUT_OF_SERVICE", bson.D{{"deleted_at", deletedAt}, {"active_table_number", nil}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "table could not be deleted"})
+			return
+		}
+		if !deleted {
+			c.JSON(http.StatusConflict, gin.H{"error": "the table's status changed in the meantime, please try again"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"table_id": tableId, "deleted_at": deletedAt})
+	}
+}
+
+// RestoreTable puts a deleted table back into service as AVAILABLE, unless another table took its number
+func RestoreTable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		tableId := c.Param("table_id")
+		var table models.Table
+		if err := tableCollection.FindOne(ctx, bson.M{"table_id": tableId}).Decode(&table); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "table was not found"})
+			return
+		}
+		if table.Deleted_at == nil {
+			c.JSON(http.StatusOK, gin.H{"table_id": tableId, "deleted_at": nil})
+			return
+		}
+		if err := checkTableNumber(ctx, table.Location_id, *table.Table_number, tableId); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error() + ", renumber or delete the other table first"})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		_, err := tableCollection.UpdateOne(
+			ctx,
+			bson.M{"table_id": tableId, "deleted_at": table.Deleted_at},
+			bson.D{{"$set", bson.D{
+				{"deleted_at", nil},
+				{"active_table_number", *table.Table_number},
+				{"status", "AVAILABLE"},
+				{"status_changed_at", now},
+				{"updated_at", now},
+			}}},
+		)
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("table %d already exists", *table.Table_number)})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "table could not be restored"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"table_id": tableId, "deleted_at": nil})
+	}
+}
@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang-restaurant-management/models"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	helper "golang-restaurant-management/helpers"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// tableQrSignature signs a table's id with its QR code secret, so links cannot be made up for other
+// tables and stop working once the secret is replaced
+func tableQrSignature(table models.Table) string {
+	mac := hmac.New(sha256.New, []byte(helper.SECRET_KEY))
+	mac.Write([]byte(table.Table_id + ":" + table.Qr_code_secret))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// tableOrderLink returns the self-ordering link printed on a table as a QR code.
+// The base URL is taken from PUBLIC_BASE_URL (default http://localhost:8000).
+func tableOrderLink(table models.Table) string {
+	baseUrl := os.Getenv("PUBLIC_BASE_URL")
+	if baseUrl == "" {
+		baseUrl = "http://localhost:8000"
+	}
+	return fmt.Sprintf("%s/order?table=%s&sig=%s", baseUrl, table.Table_id, tableQrSignature(table))
+}
+
+// ensureTableQrSecret gives a table its QR code secret the first time its code is printed
+func ensureTableQrSecret(ctx context.Context, table *models.Table) error {
+	if table.Qr_code_secret != "" {
+		return nil
+	}
+	secret, err := helper.RandomToken(16)
+	if err != nil {
+		return err
+	}
+	_, err = tableCollection.UpdateOne(
+		ctx,
+		bson.M{"table_id": table.Table_id, "qr_code_secret": bson.M{"$in": bson.A{nil, ""}}},
+		bson.D{{"$set", bson.D{{"qr_code_secret", secret}}}},
+	)
+	if err != nil {
+		return err
+	}
+	// Another request may have set the secret first
+	return tableCollection.FindOne(ctx, bson.M{"table_id": table.Table_id}).Decode(table)
+}
+
+// loadQrCodeTable loads a table QR codes can be printed for; combined tables only exist while a party
+// is seated, so their own tables' codes are used instead
+func loadQrCodeTable(ctx context.Context, tableId string, table *models.Table) (int, error) {
+	if err := tableCollection.FindOne(ctx, bson.M{"table_id": tableId}).Decode(table); err != nil {
+		return http.StatusNotFound, errors.New("table was not found")
+	}
+	if isCombinedTable(*table) {
+		return http.StatusBadRequest, errors.New("combined tables have no QR code, the codes of their tables can be used")
+	}
+	return http.StatusOK, nil
+}
+
+// GetTableQrCode returns the QR code with the table's self-ordering link, as a PNG image or with
+// format=svg as an SVG image. scale is the size of a module in pixels (default 8).
+func GetTableQrCode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		format := c.DefaultQuery("format", "png")
+		if format != "png" && format != "svg" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be png or svg"})
+			return
+		}
+		scale, err := strconv.Atoi(c.DefaultQuery("scale", "8"))
+		if err != nil || scale < 1 || scale > 40 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "scale must be between 1 and 40"})
+			return
+		}
+
+		var table models.Table
+		if status, err := loadQrCodeTable(ctx, c.Param("table_id"), &table); err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		if err := ensureTableQrSecret(ctx, &table); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the table's QR code could not be created"})
+			return
+		}
+
+		modules, err := encodeQRCode([]byte(tableOrderLink(table)))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Codes change when they are rotated, so they are not cached
+		c.Header("Cache-Control", "no-store")
+		c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="table-%d-qrcode.%s"`, *table.Table_number, format))
+		if format == "svg" {
+			c.Data(http.StatusOK, "image/svg+xml", qrCodeSVG(modules, scale))
+			return
+		}
+		image, err := qrCodePNG(modules, scale)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the table's QR code could not be created"})
+			return
+		}
+		c.Data(http.StatusOK, "image/png", image)
+	}
+}
+
+// RotateTableQrCode replaces a table's QR code, e.g. when a photo of it was shared. Codes printed
+// before stop working, so the new code has to be printed.
+func RotateTableQrCode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var table models.Table
+		if status, err := loadQrCodeTable(ctx, c.Param("table_id"), &table); err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		secret, err := helper.RandomToken(16)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the table's QR code could not be replaced"})
+			return
+		}
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		_, err = tableCollection.UpdateOne(
+			ctx,
+			bson.M{"table_id": table.Table_id},
+			bson.D{{"$set", bson.D{{"qr_code_secret", secret}, {"qr_code_rotated_at", now}, {"updated_at", now}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the table's QR code could not be replaced"})
+			return
+		}
+		table.Qr_code_secret = secret
+		c.JSON(http.StatusOK, gin.H{"table_id": table.Table_id, "link": tableOrderLink(table), "qr_code_rotated_at": now})
+	}
+}
+
+// VerifyTableQrCode checks a table's QR code link for the self-ordering flow and returns the table
+// orders from it are placed on. Links of replaced codes are rejected.
+func VerifyTableQrCode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var table models.Table
+		err := tableCollection.FindOne(ctx, bson.M{"table_id": c.Param("table_id")}).Decode(&table)
+		if err != nil || table.Qr_code_secret == "" || !hmac.Equal([]byte(tableQrSignature(table)), []byte(c.Query("sig"))) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "this table code is no longer valid, please ask a member of staff"})
+			return
+		}
+		if tableStatus(table) == "OUT_OF_SERVICE" {
+			c.JSON(http.StatusConflict, gin.H{"error": "the table is out of service"})
+			return
+		}
+
+		// Orders placed on a table that is part of a combined table go to the combined table
+		orderTable := table
+		if err := resolveCombinedTable(ctx, &orderTable); err != nil {
+			orderTable = table
+		}
+		c.JSON(http.StatusOK, gin.H{"table_id": table.Table_id, "table_number": table.Table_number, "order_table_id": orderTable.Table_id})
+	}
+}
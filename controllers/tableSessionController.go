@@ -0,0 +1,218 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SessionInvoiceRequest struct {
+	Session_id      *string                `json:"session_id"`
+	Table_id        *string                `json:"table_id"`
+	Payment_method  *string                `json:"payment_method" validate:"omitempty,max=30"`
+	Payment_details *models.PaymentDetails `json:"payment_details"`
+	Tip             *models.Money          `json:"tip" validate:"omitempty,min=0"`
+}
+
+// assignTableSession puts a dine-in order in its table's current session: the session of the
+// table's open orders, or a new one when the table has none. A session_id sent by the client is kept.
+func assignTableSession(ctx context.Context, order *models.Order) error {
+	if order.Session_id != nil || order.Table_id == nil || (order.Channel != nil && *order.Channel != "DINE_IN") {
+		return nil
+	}
+
+	var open models.Order
+	opts := options.FindOne().SetSort(bson.D{{"created_at", -1}})
+	err := orderCollection.FindOne(ctx, bson.M{
+		"table_id":   *order.Table_id,
+		"closed_at":  nil,
+		"session_id": bson.M{"$ne": nil},
+	}, opts).Decode(&open)
+	if err == nil {
+		order.Session_id = open.Session_id
+		return nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	sessionId := primitive.NewObjectID().Hex()
+	order.Session_id = &sessionId
+	return nil
+}
+
+// invoiceOrderIds returns the orders billed by an invoice
+func invoiceOrderIds(invoice models.Invoice) []string {
+	if len(invoice.Order_ids) > 0 {
+		return invoice.Order_ids
+	}
+	return []string{invoice.Order_id}
+}
+
+// closeInvoiceOrdersIfSettled closes every order billed by a paid invoice once nothing is left to pay on it
+func closeInvoiceOrdersIfSettled(ctx context.Context, invoice models.Invoice, changedBy string) {
+	for _, orderId := range invoiceOrderIds(invoice) {
+		if err := closeOrderIfSettled(ctx, orderId, changedBy); err != nil {
+			log.Println("failed to close paid order:", err)
+		}
+	}
+}
+
+// CreateSessionInvoice bills every order of a table session on one invoice. The subtotal covers all
+// the session's items, and taxes and the service charge are calculated once on the combined amount.
+// The session is given by session_id, or by table_id for the table's current session.
+func CreateSessionInvoice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request SessionInvoiceRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if err := checkPaymentMethod(ctx, request.Payment_method, request.Payment_details); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := bson.M{}
+		switch {
+		case request.Session_id != nil:
+			filter["session_id"] = *request.Session_id
+		case request.Table_id != nil:
+			// The table's current session is the one of its open orders
+			var open models.Order
+			err := orderCollection.FindOne(ctx, bson.M{"table_id": *request.Table_id, "closed_at": nil, "session_id": bson.M{"$ne": nil}}).Decode(&open)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "table has no open session"})
+				return
+			}
+			filter["session_id"] = *open.Session_id
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "session_id or table_id is required"})
+			return
+		}
+
+		cursor, err := orderCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{"created_at", 1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the session's orders"})
+			return
+		}
+		var orders []models.Order
+		if err = cursor.All(ctx, &orders); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the session's orders"})
+			return
+		}
+		if len(orders) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session was not found"})
+			return
+		}
+
+		var orderIds []string
+		for _, order := range orders {
+			orderIds = append(orderIds, order.Order_id)
+		}
+
+		sessionId := filter["session_id"].(string)
+
+		// A create call retried by the POS returns the invoice of the first call
+		key, err := idempotencyKey(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if existing, found, err := invoiceByIdempotencyKey(ctx, key); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking existing invoices"})
+			return
+		} else if found {
+			if existing.Session_id == nil || *existing.Session_id != sessionId {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for another invoice"})
+				return
+			}
+			maskedJSON(c, http.StatusOK, existing)
+			return
+		}
+
+		// An order can only be billed once, either on its own or on the session invoice. Creating the
+		// session invoice again returns the existing one
+		existingInvoices, err := activeInvoices(ctx, orderIds)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking existing invoices"})
+			return
+		}
+		if len(existingInvoices) == 1 && existingInvoices[0].Session_id != nil && *existingInvoices[0].Session_id == sessionId {
+			maskedJSON(c, http.StatusOK, existingInvoices[0])
+			return
+		}
+		var billed []string
+		for _, invoice := range existingInvoices {
+			billed = append(billed, invoice.Invoice_id)
+		}
+		if len(billed) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "some of the session's orders have already been invoiced", "invoice_ids": billed})
+			return
+		}
+
+		var invoice models.Invoice
+		status := "PENDING"
+		invoice.ID = primitive.NewObjectID()
+		invoice.Invoice_id = invoice.ID.Hex()
+		invoice.Order_id = orderIds[0]
+		invoice.Order_ids = orderIds
+		invoice.Active_order_ids = orderIds
+		invoice.Idempotency_key = key
+		draft := "DRAFT"
+		invoice.Invoice_status = &draft
+		invoice.Session_id = &sessionId
+		invoice.Payment_method = request.Payment_method
+		invoice.Payment_details = request.Payment_details
+		invoice.Payment_status = &status
+		invoice.Tip = request.Tip
+		invoice.Payment_due_date, _ = time.Parse(time.RFC3339, time.Now().AddDate(0, 0, 1).Format(time.RFC3339))
+		invoice.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		invoice.Updated_at = invoice.Created_at
+
+		if err := calculateInvoiceTotals(ctx, &invoice); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating invoice totals"})
+			return
+		}
+
+		if err := applyReservationDeposits(ctx, &invoice, orders); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while applying the reservation deposit"})
+			return
+		}
+
+		invoice.Location_id = orders[0].Location_id
+		if err := assignInvoiceNumber(ctx, &invoice); err != nil {
+			releaseDepositPayments(ctx, invoice)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "invoice number could not be assigned"})
+			return
+		}
+
+		if _, err := invoiceCollection.InsertOne(ctx, invoice); err != nil {
+			releaseDepositPayments(ctx, invoice)
+			if mongo.IsDuplicateKeyError(err) {
+				recordInvoiceNumberGap(ctx, invoice, "invoice was created concurrently")
+				c.JSON(http.StatusConflict, gin.H{"error": "some of the session's orders have already been invoiced"})
+				return
+			}
+			recordInvoiceNumberGap(ctx, invoice, "invoice could not be saved")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "invoice was not created"})
+			return
+		}
+		maskedJSON(c, http.StatusOK, invoice)
+	}
+}
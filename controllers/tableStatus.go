@@ -0,0 +1,193 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// tableStatusTransitions lists the statuses a table can be moved to by staff from each status.
+// Tables are also SEATED and DIRTY automatically as dine-in orders are opened and closed on them.
+var tableStatusTransitions = map[string][]string{
+	"AVAILABLE":      {"SEATED", "RESERVED", "DIRTY", "OUT_OF_SERVICE"},
+	"RESERVED":       {"AVAILABLE", "SEATED", "OUT_OF_SERVICE"},
+	"SEATED":         {"AVAILABLE", "DIRTY"},
+	"DIRTY":          {"AVAILABLE", "SEATED", "OUT_OF_SERVICE"},
+	"OUT_OF_SERVICE": {"AVAILABLE"},
+}
+
+// tableStatus returns a table's status; tables saved before statuses existed are AVAILABLE
+func tableStatus(table models.Table) string {
+	if table.Status == nil {
+		return "AVAILABLE"
+	}
+	return *table.Status
+}
+
+// tableStatusIn matches tables in any of the given statuses, counting tables without a status as AVAILABLE
+func tableStatusIn(statuses ...string) bson.M {
+	values := bson.A{}
+	for _, status := range statuses {
+		values = append(values, status)
+		if status == "AVAILABLE" {
+			values = append(values, nil)
+		}
+	}
+	return bson.M{"$in": values}
+}
+
+// setTableStatus moves a table to a new status if it is in one of the from statuses, with the extra
+// fields given. It reports false when the table was not found in those statuses.
+func setTableStatus(ctx context.Context, tableId string, from []string, status string, set bson.D) (bool, error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	set = append(bson.D{{"status", status}, {"status_changed_at", now}, {"updated_at", now}}, set...)
+	result, err := tableCollection.UpdateOne(
+		ctx,
+		bson.M{"table_id": tableId, "status": tableStatusIn(from...), "deleted_at": nil},
+		bson.D{{"$set", set}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// tableHasOpenOrders reports whether dine-in orders are still open on a table
+func tableHasOpenOrders(ctx context.Context, tableId string) (bool, error) {
+	count, err := orderCollection.CountDocuments(ctx, bson.M{"table_id": tableId, "closed_at": nil, "channel": bson.M{"$in": bson.A{nil, "DINE_IN"}}})
+	return count > 0, err
+}
+
+// seatTableForOrder marks the table of a new dine-in order as SEATED and records the party seated with
+// the order's server, session and reservation. Failures are logged, since the order itself was placed.
+func seatTableForOrder(ctx context.Context, order models.Order) {
+	if order.Table_id == nil || (order.Channel != nil && *order.Channel != "DINE_IN") {
+		return
+	}
+	seated, err := setTableStatus(ctx, *order.Table_id, []string{"AVAILABLE", "RESERVED", "DIRTY"}, "SEATED", nil)
+	if err != nil {
+		log.Println("failed to seat table", *order.Table_id, ":", err)
+		return
+	}
+	var table models.Table
+	if seated && tableCollection.FindOne(ctx, bson.M{"table_id": *order.Table_id}).Decode(&table) == nil {
+		guests := 0
+		if order.Buffet_guests != nil {
+			guests = order.Buffet_guests.Adults + order.Buffet_guests.Children + order.Buffet_guests.Seniors
+		} else if table.Number_of_guests != nil {
+			guests = *table.Number_of_guests
+		}
+		recordSeating(ctx, table, order.Server_id, guests, "ORDER")
+	}
+	linkSeatingOrder(ctx, order)
+}
+
+// releaseTable marks a SEATED table as DIRTY once its last open dine-in order was closed or moved away.
+// A combined table is split back into its tables, which are then DIRTY.
+func releaseTable(ctx context.Context, tableId string) {
+	open, err := tableHasOpenOrders(ctx, tableId)
+	if err == nil && !open {
+		var table models.Table
+		if err = tableCollection.FindOne(ctx, bson.M{"table_id": tableId}).Decode(&table); err == nil {
+			if isCombinedTable(table) {
+				_, err = splitCombinedTable(ctx, table)
+			} else if _, err = setTableStatus(ctx, tableId, []string{"SEATED"}, "DIRTY", nil); err == nil {
+				clearSeatings(ctx, tableId)
+			}
+		}
+	}
+	if err != nil {
+		log.Println("failed to release table", tableId, ":", err)
+	}
+}
+
+// SetTableStatus moves a table to a new status, e.g. DIRTY to AVAILABLE once it was cleaned. Only the
+// transitions in tableStatusTransitions are allowed, and a SEATED table can only be cleared once its
+// orders are closed.
+func SetTableStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			Status *string `json:"status" validate:"required,eq=AVAILABLE|eq=SEATED|eq=RESERVED|eq=DIRTY|eq=OUT_OF_SERVICE"`
+		}
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		tableId := c.Param("table_id")
+		var table models.Table
+		if err := tableCollection.FindOne(ctx, bson.M{"table_id": tableId}).Decode(&table); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "table was not found"})
+			return
+		}
+
+		if table.Split_at != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "the table was split back into its tables"})
+			return
+		}
+		if table.Deleted_at != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "the table was deleted"})
+			return
+		}
+		if table.Combined_into != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "the table is part of a combined table, change the combined table's status instead"})
+			return
+		}
+
+		current := tableStatus(table)
+		allowed := false
+		for _, status := range tableStatusTransitions[current] {
+			if status == *request.Status {
+				allowed = true
+			}
+		}
+		if !allowed {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("a %s table cannot be set to %s", current, *request.Status)})
+			return
+		}
+		if current == "SEATED" {
+			open, err := tableHasOpenOrders(ctx, tableId)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the table's orders"})
+				return
+			}
+			if open {
+				c.JSON(http.StatusConflict, gin.H{"error": "the table still has open orders"})
+				return
+			}
+		}
+
+		updated, err := setTableStatus(ctx, tableId, []string{current}, *request.Status, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "table status update failed"})
+			return
+		}
+		if !updated {
+			c.JSON(http.StatusConflict, gin.H{"error": "the table's status changed in the meantime, please try again"})
+			return
+		}
+		if *request.Status == "SEATED" {
+			guests := 0
+			if table.Number_of_guests != nil {
+				guests = *table.Number_of_guests
+			}
+			recordSeating(ctx, table, nil, guests, "MANUAL")
+		} else if current == "SEATED" {
+			clearSeatings(ctx, tableId)
+		}
+		c.JSON(http.StatusOK, gin.H{"table_id": tableId, "previous_status": current, "status": *request.Status})
+	}
+}
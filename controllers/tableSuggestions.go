@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// seatNowWindow is how close to now a requested time is treated as seating the party right away, when
+// only AVAILABLE tables can be suggested
+const seatNowWindow = 15 * time.Minute
+
+type TableSuggestion struct {
+	Table_id     string  `json:"table_id"`
+	Table_number *int    `json:"table_number"`
+	Section      *string `json:"section"`
+	Status       string  `json:"status"`
+	Capacity     *int    `json:"capacity"`
+
+	// Empty_seats is the number of seats left free by the party, unknown for tables without a capacity
+	Empty_seats *int `json:"empty_seats"`
+
+	// Section_covers is the number of guests currently seated in the table's section
+	Section_covers int `json:"section_covers"`
+
+	// Next_reservation_at is the table's next reservation after the party would have left, within a day
+	Next_reservation_at *time.Time `json:"next_reservation_at"`
+}
+
+// tableReservationTimes returns the times of the active reservations on the given tables between from and to
+func tableReservationTimes(ctx context.Context, tableIds []string, from time.Time, to time.Time) (map[string][]time.Time, error) {
+	cursor, err := reservationCollection.Find(ctx, bson.M{
+		"table_id":         bson.M{"$in": tableIds},
+		"status":           bson.M{"$in": bson.A{"BOOKED", "CONFIRMED"}},
+		"reservation_time": bson.M{"$gt": from, "$lt": to},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var reservations []models.Reservation
+	if err = cursor.All(ctx, &reservations); err != nil {
+		return nil, err
+	}
+	times := map[string][]time.Time{}
+	for _, reservation := range reservations {
+		times[*reservation.Table_id] = append(times[*reservation.Table_id], *reservation.Reservation_time)
+	}
+	return times, nil
+}
+
+// SuggestTables ranks the tables a party of party_size can be seated at, at time (RFC3339, default now).
+// Tables too small for the party, out of service or reserved within TABLE_TURN_MINUTES (default 90) of
+// the time are left out; parties seated now only get AVAILABLE tables. The best fitting tables come
+// first, then those in the least busy sections, then those whose next reservation is furthest away.
+func SuggestTables() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		partySize, err := strconv.Atoi(c.Query("party_size"))
+		if err != nil || partySize < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "party_size must be at least 1"})
+			return
+		}
+		at := time.Now()
+		if value := c.Query("time"); value != "" {
+			if at, err = time.Parse(time.RFC3339, value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "time must be an RFC3339 timestamp"})
+				return
+			}
+		}
+		limit := 5
+		if value := c.Query("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > 20 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 20"})
+				return
+			}
+			limit = parsed
+		}
+		seatNow := at.Sub(time.Now()) < seatNowWindow
+
+		// Tables that are part of a combined table are seated through the combined table
+		filter := bson.M{"split_at": nil, "combined_into": nil}
+		if locationId := c.Query("location_id"); locationId != "" {
+			filter["location_id"] = locationId
+		}
+		cursor, err := tableCollection.Find(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing tables"})
+			return
+		}
+		var tables []models.Table
+		if err = cursor.All(ctx, &tables); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing tables"})
+			return
+		}
+
+		sectionCovers := map[string]int{}
+		var candidates []models.Table
+		var candidateIds []string
+		for _, table := range tables {
+			status := tableStatus(table)
+			if status == "SEATED" && table.Section != nil && table.Number_of_guests != nil {
+				sectionCovers[*table.Section] += *table.Number_of_guests
+			}
+			if status == "OUT_OF_SERVICE" || (seatNow && status != "AVAILABLE") {
+				continue
+			}
+			if table.Capacity != nil && *table.Capacity < partySize {
+				continue
+			}
+			candidates = append(candidates, table)
+			candidateIds = append(candidateIds, table.Table_id)
+		}
+
+		turn := time.Duration(envInt("TABLE_TURN_MINUTES", 90)) * time.Minute
+		reservationTimes, err := tableReservationTimes(ctx, candidateIds, at.Add(-turn), at.Add(24*time.Hour))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking reservations"})
+			return
+		}
+
+		suggestions := []TableSuggestion{}
+		for _, table := range candidates {
+			suggestion := TableSuggestion{Table_id: table.Table_id, Table_number: table.Table_number, Section: table.Section, Status: tableStatus(table), Capacity: table.Capacity}
+			if table.Capacity != nil {
+				emptySeats := *table.Capacity - partySize
+				suggestion.Empty_seats = &emptySeats
+			}
+			if table.Section != nil {
+				suggestion.Section_covers = sectionCovers[*table.Section]
+			}
+
+			// A reservation within a turn of the time means the table is taken by, or needed for, other guests
+			reserved := false
+			for _, reservationTime := range reservationTimes[table.Table_id] {
+				if reservationTime.Before(at.Add(turn)) {
+					reserved = true
+					break
+				}
+				if suggestion.Next_reservation_at == nil || reservationTime.Before(*suggestion.Next_reservation_at) {
+					next := reservationTime
+					suggestion.Next_reservation_at = &next
+				}
+			}
+			if !reserved {
+				suggestions = append(suggestions, suggestion)
+			}
+		}
+
+		sort.SliceStable(suggestions, func(i, j int) bool {
+			a, b := suggestions[i], suggestions[j]
+			if (a.Empty_seats == nil) != (b.Empty_seats == nil) {
+				return a.Empty_seats != nil
+			}
+			if a.Empty_seats != nil && *a.Empty_seats != *b.Empty_seats {
+				return *a.Empty_seats < *b.Empty_seats
+			}
+			if a.Section_covers != b.Section_covers {
+				return a.Section_covers < b.Section_covers
+			}
+			if (a.Next_reservation_at == nil) != (b.Next_reservation_at == nil) {
+				return a.Next_reservation_at == nil
+			}
+			if a.Next_reservation_at != nil && !a.Next_reservation_at.Equal(*b.Next_reservation_at) {
+				return a.Next_reservation_at.After(*b.Next_reservation_at)
+			}
+			return *a.Table_number < *b.Table_number
+		})
+		if len(suggestions) > limit {
+			suggestions = suggestions[:limit]
+		}
+
+		c.JSON(http.StatusOK, gin.H{"party_size": partySize, "time": at, "suggestions": suggestions})
+	}
+}
@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type TableTurns struct {
+	Table_id     string  `json:"table_id"`
+	Table_number *int    `json:"table_number"`
+	Section      *string `json:"section"`
+
+	// Parties and Covers are the parties seated at the table in the period and their guests
+	Parties int `json:"parties"`
+	Covers  int `json:"covers"`
+
+	// Average_turn_minutes is how long the parties that left stayed, from seated to cleared
+	Average_turn_minutes float64 `json:"average_turn_minutes"`
+
+	// Occupancy is the share of the period (up to now) the table was seated, in percent
+	Occupied_minutes float64 `json:"occupied_minutes"`
+	Occupancy        float64 `json:"occupancy"`
+
+	// Revenue is the value of the non-voided items ordered at the table in the period
+	Revenue           models.Money `json:"revenue"`
+	Revenue_per_cover models.Money `json:"revenue_per_cover"`
+
+	turns       int
+	turnMinutes float64
+}
+
+type TableTurnsReport struct {
+	From                 time.Time    `json:"from"`
+	To                   time.Time    `json:"to"`
+	Parties              int          `json:"parties"`
+	Covers               int          `json:"covers"`
+	Average_turn_minutes float64      `json:"average_turn_minutes"`
+	Occupancy            float64      `json:"occupancy"`
+	Revenue              models.Money `json:"revenue"`
+	Tables               []TableTurns `json:"tables"`
+}
+
+// orderRevenue are the non-voided item prices of an order
+type orderRevenue struct {
+	Order_id string       `bson:"_id"`
+	Revenue  models.Money `bson:"revenue"`
+}
+
+// tableOrderRevenue returns the value of the non-voided items of the dine-in orders placed on the given
+// tables in a period, by table
+func tableOrderRevenue(ctx context.Context, tableIds []string, from time.Time, to time.Time) (map[string]models.Money, error) {
+	cursor, err := orderCollection.Find(ctx, bson.M{
+		"table_id":   bson.M{"$in": tableIds},
+		"created_at": bson.M{"$gte": from, "$lt": to},
+		"channel":    bson.M{"$in": bson.A{nil, "DINE_IN"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var orders []models.Order
+	if err = cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	orderTables := map[string]string{}
+	var orderIds []string
+	for _, order := range orders {
+		orderTables[order.Order_id] = *order.Table_id
+		orderIds = append(orderIds, order.Order_id)
+	}
+	revenue := map[string]models.Money{}
+	if len(orderIds) == 0 {
+		return revenue, nil
+	}
+
+	matchStage := bson.D{{"$match", bson.D{
+		{"order_id", bson.D{{"$in", orderIds}}},
+		{"status", bson.D{{"$ne", "VOIDED"}}},
+		{"unit_price", bson.D{{"$ne", nil}}},
+	}}}
+	groupStage := bson.D{{"$group", bson.D{
+		{"_id", "$order_id"},
+		{"revenue", bson.D{{"$sum", "$unit_price"}}},
+	}}}
+	result, err := orderItemCollection.Aggregate(ctx, mongo.Pipeline{matchStage, groupStage})
+	if err != nil {
+		return nil, err
+	}
+	var sales []orderRevenue
+	if err = result.All(ctx, &sales); err != nil {
+		return nil, err
+	}
+	for _, sale := range sales {
+		revenue[orderTables[sale.Order_id]] += sale.Revenue
+	}
+	return revenue, nil
+}
+
+// GetTableTurns reports per table how many parties were seated over a period (from/to, RFC3339, by
+// default the last 30 days), how long they stayed, the share of the period the table was occupied and the
+// revenue of its orders, optionally of one location. A combined table counts for the lowest numbered of
+// its tables.
+func GetTableTurns() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		from, to, err := reportPeriod(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := bson.M{}
+		if locationId := c.Query("location_id"); locationId != "" {
+			filter["location_id"] = locationId
+		}
+		cursor, err := tableCollection.Find(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing tables"})
+			return
+		}
+		var tables []models.Table
+		if err = cursor.All(ctx, &tables); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing tables"})
+			return
+		}
+
+		// Seatings and orders of a combined table go to its first (lowest numbered) table
+		rowTable := map[string]string{}
+		var tableIds []string
+		rows := map[string]*TableTurns{}
+		for _, table := range tables {
+			tableIds = append(tableIds, table.Table_id)
+			if isCombinedTable(table) {
+				rowTable[table.Table_id] = table.Combined_table_ids[0]
+				continue
+			}
+			rowTable[table.Table_id] = table.Table_id
+			rows[table.Table_id] = &TableTurns{Table_id: table.Table_id, Table_number: table.Table_number, Section: table.Section}
+		}
+
+		// Seatings still open count as occupied up to now
+		end := to
+		if now := time.Now(); now.Before(end) {
+			end = now
+		}
+		cursor, err = seatingCollection.Find(ctx, bson.M{
+			"seated_at": bson.M{"$lt": to},
+			"$or":       bson.A{bson.M{"cleared_at": nil}, bson.M{"cleared_at": bson.M{"$gt": from}}},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing seatings"})
+			return
+		}
+		var seatings []models.Seating
+		if err = cursor.All(ctx, &seatings); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing seatings"})
+			return
+		}
+		for _, seating := range seatings {
+			row, ok := rows[rowTable[seating.Table_id]]
+			if !ok {
+				continue
+			}
+			start, stop := seating.Seated_at, end
+			if seating.Cleared_at != nil && seating.Cleared_at.Before(stop) {
+				stop = *seating.Cleared_at
+			}
+			if start.Before(from) {
+				start = from
+			}
+			if stop.After(start) {
+				row.Occupied_minutes += stop.Sub(start).Minutes()
+			}
+			if seating.Seated_at.Before(from) {
+				continue
+			}
+			row.Parties++
+			row.Covers += seating.Guests
+			if seating.Cleared_at != nil {
+				row.turns++
+				row.turnMinutes += seating.Cleared_at.Sub(seating.Seated_at).Minutes()
+			}
+		}
+
+		revenue, err := tableOrderRevenue(ctx, tableIds, from, to)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating table revenue"})
+			return
+		}
+		for tableId, amount := range revenue {
+			if row, ok := rows[rowTable[tableId]]; ok {
+				row.Revenue += amount
+			}
+		}
+
+		report := TableTurnsReport{From: from, To: to, Tables: []TableTurns{}}
+		periodMinutes := end.Sub(from).Minutes()
+		var turns int
+		var turnMinutes, occupiedMinutes float64
+		for _, row := range rows {
+			if row.turns > 0 {
+				row.Average_turn_minutes = toFixed(row.turnMinutes/float64(row.turns), 1)
+			}
+			if periodMinutes > 0 {
+				row.Occupancy = toFixed(row.Occupied_minutes/periodMinutes*100, 2)
+			}
+			if row.Covers > 0 {
+				row.Revenue_per_cover = models.Money(math.Round(float64(row.Revenue) / float64(row.Covers)))
+			}
+			row.Occupied_minutes = toFixed(row.Occupied_minutes, 1)
+
+			report.Parties += row.Parties
+			report.Covers += row.Covers
+			report.Revenue += row.Revenue
+			turns += row.turns
+			turnMinutes += row.turnMinutes
+			occupiedMinutes += row.Occupied_minutes
+			report.Tables = append(report.Tables, *row)
+		}
+		if turns > 0 {
+			report.Average_turn_minutes = toFixed(turnMinutes/float64(turns), 1)
+		}
+		if periodMinutes > 0 && len(rows) > 0 {
+			report.Occupancy = toFixed(occupiedMinutes/(periodMinutes*float64(len(rows)))*100, 2)
+		}
+		sort.Slice(report.Tables, func(i, j int) bool { return *report.Tables[i].Table_number < *report.Tables[j].Table_number })
+
+		c.JSON(http.StatusOK, report)
+	}
+}
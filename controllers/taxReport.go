@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"golang-restaurant-management/models"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type TaxFigures struct {
+	Documents        int          `json:"documents" bson:"documents"`
+	Taxable_sales    models.Money `json:"taxable_sales" bson:"taxable_sales"`
+	Tax_collected    models.Money `json:"tax_collected" bson:"tax_collected"`
+	Refunded_taxable models.Money `json:"refunded_taxable" bson:"refunded_taxable"`
+	Refunded_tax     models.Money `json:"refunded_tax" bson:"refunded_tax"`
+	Net_taxable      models.Money `json:"net_taxable" bson:"-"`
+	Net_tax          models.Money `json:"net_tax" bson:"-"`
+}
+
+// add adds the figures of another rate or document type
+func (figures *TaxFigures) add(other TaxFigures) {
+	figures.Documents += other.Documents
+	figures.Taxable_sales += other.Taxable_sales
+	figures.Tax_collected += other.Tax_collected
+	figures.Refunded_taxable += other.Refunded_taxable
+	figures.Refunded_tax += other.Refunded_tax
+	figures.Net_taxable = figures.Taxable_sales - figures.Refunded_taxable
+	figures.Net_tax = figures.Tax_collected - figures.Refunded_tax
+}
+
+type TaxRateSummary struct {
+	Name       string  `json:"name" bson:"name"`
+	Tax_class  string  `json:"tax_class" bson:"tax_class"`
+	Rate       float64 `json:"rate" bson:"rate"`
+	TaxFigures `bson:",inline"`
+}
+
+type TaxReport struct {
+	From        time.Time        `json:"from"`
+	To          time.Time        `json:"to"`
+	Location_id *string          `json:"location_id"`
+	Totals      TaxFigures       `json:"totals"`
+	Rates       []TaxRateSummary `json:"rates"`
+}
+
+// aggregateTaxRates runs a pipeline whose output are tax rate summaries
+func aggregateTaxRates(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline) ([]TaxRateSummary, error) {
+	result, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rates []TaxRateSummary
+	err = result.All(ctx, &rates)
+	return rates, err
+}
+
+// taxLineGroup groups the unwound tax lines of invoices or credit notes by tax, class and rate
+func taxLineGroup(taxable string, tax string) bson.D {
+	return bson.D{{"$group", bson.D{
+		{"_id", bson.D{{"name", "$tax_lines.name"}, {"tax_class", "$tax_lines.tax_class"}, {"rate", "$tax_lines.rate"}}},
+		{"name", bson.D{{"$first", "$tax_lines.name"}}},
+		{"tax_class", bson.D{{"$first", "$tax_lines.tax_class"}}},
+		{"rate", bson.D{{"$first", "$tax_lines.rate"}}},
+		{"documents", bson.D{{"$sum", 1}}},
+		{taxable, bson.D{{"$sum", "$tax_lines.taxable_amount"}}},
+		{tax, bson.D{{"$sum", "$tax_lines.amount"}}},
+	}}}
+}
+
+// taxReportCSV writes the tax report as a CSV file, one line per rate and a line with the totals
+func taxReportCSV(report TaxReport) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writer.Write([]string{"tax", "tax_class", "rate", "documents", "taxable_sales", "tax_collected", "refunded_taxable", "refunded_tax", "net_taxable", "net_tax"})
+	row := func(name string, taxClass string, rate string, summary TaxFigures) {
+		writer.Write([]string{
+			name, taxClass, rate, strconv.Itoa(summary.Documents),
+			summary.Taxable_sales.String(), summary.Tax_collected.String(), summary.Refunded_taxable.String(),
+			summary.Refunded_tax.String(), summary.Net_taxable.String(), summary.Net_tax.String(),
+		})
+	}
+	for _, rate := range report.Rates {
+		row(rate.Name, rate.Tax_class, strconv.FormatFloat(rate.Rate, 'f', -1, 64), rate.TaxFigures)
+	}
+	row("Total", "", "", report.Totals)
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+// GetTaxReport summarises the taxable sales and the tax collected per tax rate over a filing period, from
+// the tax lines of the invoices billed and the credit notes issued in it: the optional from/to query
+// parameters (RFC3339), by default the last 30 days, optionally of one location. Refunds reduce the
+// period's net figures. With format=csv the report is downloaded as a CSV file.
+func GetTaxReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		from, to, err := reportPeriod(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "csv" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+			return
+		}
+
+		report := TaxReport{From: from, To: to, Rates: []TaxRateSummary{}}
+		period := bson.D{{"$gte", from}, {"$lt", to}}
+		// Split invoices are taxed through their parts and void invoices were never billed
+		invoiceMatch := bson.D{{"created_at", period}, {"payment_status", bson.D{{"$in", bson.A{"PENDING", "PAID", "REFUNDED"}}}}}
+		refundPipeline := mongo.Pipeline{bson.D{{"$match", bson.D{{"created_at", period}}}}}
+		if locationId := c.Query("location_id"); locationId != "" {
+			report.Location_id = &locationId
+			invoiceMatch = append(invoiceMatch, bson.E{"location_id", locationId})
+			// Credit notes have no location of their own, so they are filtered by their invoice's
+			refundPipeline = append(refundPipeline,
+				bson.D{{"$lookup", bson.D{{"from", "invoice"}, {"localField", "invoice_id"}, {"foreignField", "invoice_id"}, {"as", "invoice"}}}},
+				bson.D{{"$match", bson.D{{"invoice.location_id", locationId}}}},
+			)
+		}
+
+		invoices, err := aggregateTaxRates(ctx, invoiceCollection, mongo.Pipeline{
+			bson.D{{"$match", invoiceMatch}},
+			bson.D{{"$unwind", "$tax_lines"}},
+			taxLineGroup("taxable_sales", "tax_collected"),
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating the tax collected"})
+			return
+		}
+		refundPipeline = append(refundPipeline, bson.D{{"$unwind", "$tax_lines"}}, taxLineGroup("refunded_taxable", "refunded_tax"))
+		refunds, err := aggregateTaxRates(ctx, creditNoteCollection, refundPipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating the tax refunded"})
+			return
+		}
+
+		rates := map[string]int{}
+		for _, row := range append(invoices, refunds...) {
+			key := fmt.Sprintf("%s|%s|%v", row.Name, row.Tax_class, row.Rate)
+			i, ok := rates[key]
+			if !ok {
+				i = len(report.Rates)
+				rates[key] = i
+				report.Rates = append(report.Rates, TaxRateSummary{Name: row.Name, Tax_class: row.Tax_class, Rate: row.Rate})
+			}
+			report.Rates[i].add(row.TaxFigures)
+			report.Totals.add(row.TaxFigures)
+		}
+		sort.Slice(report.Rates, func(i, j int) bool {
+			if report.Rates[i].Name != report.Rates[j].Name {
+				return report.Rates[i].Name < report.Rates[j].Name
+			}
+			if report.Rates[i].Tax_class != report.Rates[j].Tax_class {
+				return report.Rates[i].Tax_class < report.Rates[j].Tax_class
+			}
+			return report.Rates[i].Rate < report.Rates[j].Rate
+		})
+
+		if format == "csv" {
+			data, err := taxReportCSV(report)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "the tax report could not be exported"})
+				return
+			}
+			c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="tax-report-%s-%s.csv"`, from.Format("2006-01-02"), to.Format("2006-01-02")))
+			c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// pricesIncludeTax reports whether the restaurant's prices already include their taxes
+func pricesIncludeTax(settings models.Settings) bool {
+	return settings.Tax_mode != nil && *settings.Tax_mode == "INCLUSIVE"
+}
+
+// findTaxClass returns the settings' tax class with the given code
+func findTaxClass(settings models.Settings, code string) (models.TaxClass, bool) {
+	for _, taxClass := range settings.Tax_classes {
+		if taxClass.Code == code {
+			return taxClass, true
+		}
+	}
+	return models.TaxClass{}, false
+}
+
+// validateTaxClass checks that a food's tax class is configured in the settings
+func validateTaxClass(ctx context.Context, code *string) error {
+	if code == nil || *code == "" {
+		return nil
+	}
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := findTaxClass(settings, *code); !ok {
+		return fmt.Errorf("tax class %s is not configured", *code)
+	}
+	return nil
+}
+
+// orderItemTaxClass returns the tax class of an order item's food, or "" for the default tax rates.
+// Foods are looked up once and kept in the foods cache.
+func orderItemTaxClass(ctx context.Context, orderItem models.OrderItem, foods map[string]models.Food) (string, error) {
+	if orderItem.Food_id == nil {
+		return "", nil
+	}
+	food, ok := foods[*orderItem.Food_id]
+	if !ok {
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": *orderItem.Food_id}).Decode(&food); err != nil && err != mongo.ErrNoDocuments {
+			return "", err
+		}
+		foods[*orderItem.Food_id] = food
+	}
+	if food.Tax_class == nil {
+		return "", nil
+	}
+	return *food.Tax_class, nil
+}
+
+// calculateTaxLines breaks the taxes of an invoice down per tax class and rate. classAmounts are the
+// billed amounts per tax class ("" for the default rates); the discount is shared between the classes
+// in proportion to their amounts. Classes that are no longer configured fall back to the default rates.
+func calculateTaxLines(settings models.Settings, classAmounts map[string]models.Money, discount models.Money) ([]models.InvoiceTaxLine, models.Money) {
+	// Classes are taxed in the order they are configured, after the default rates
+	codes := []string{""}
+	for _, taxClass := range settings.Tax_classes {
+		codes = append(codes, taxClass.Code)
+	}
+
+	rates := map[string][]models.TaxRate{"": settings.Tax_rates}
+	amounts := map[string]models.Money{}
+	var total models.Money
+	for class, amount := range classAmounts {
+		if taxClass, ok := findTaxClass(settings, class); ok {
+			rates[class] = taxClass.Rates
+		} else {
+			class = ""
+		}
+		amounts[class] += amount
+		total += amount
+	}
+
+	lines := []models.InvoiceTaxLine{}
+	var taxTotal models.Money
+	remainingDiscount := discount
+	remainingAmount := total
+	for _, class := range codes {
+		amount := amounts[class]
+		if amount == 0 {
+			continue
+		}
+
+		// The last class takes whatever is left of the discount, so the shares add up exactly
+		share := remainingDiscount
+		if amount < remainingAmount {
+			share = remainingDiscount.Mul(float64(amount) / float64(remainingAmount))
+		}
+		remainingDiscount -= share
+		remainingAmount -= amount
+		base := amount - share
+
+		classLines, classTax := taxLinesForClass(class, rates[class], base, pricesIncludeTax(settings))
+		lines = append(lines, classLines...)
+		taxTotal += classTax
+	}
+	return lines, taxTotal
+}
+
+// taxLinesForClass calculates one line per tax rate on base. With tax inclusive prices the base already
+// contains the taxes: the net amount is worked out first and the taxes are what separates it from the
+// base, with any rounding difference put on the last rate.
+func taxLinesForClass(class string, rates []models.TaxRate, base models.Money, inclusive bool) ([]models.InvoiceTaxLine, models.Money) {
+	taxable := base
+	if inclusive {
+		combined := 0.0
+		for _, taxRate := range rates {
+			combined += taxRate.Rate
+		}
+		taxable = base.Mul(1 / (1 + combined))
+	}
+
+	var lines []models.InvoiceTaxLine
+	var total models.Money
+	for i, taxRate := range rates {
+		line := models.InvoiceTaxLine{
+			Name:           taxRate.Name,
+			Tax_class:      class,
+			Rate:           taxRate.Rate,
+			Taxable_amount: taxable,
+			Amount:         taxable.Mul(taxRate.Rate),
+		}
+		if inclusive && i == len(rates)-1 {
+			line.Amount = base - taxable - total
+		}
+		lines = append(lines, line)
+		total += line.Amount
+	}
+	return lines, total
+}
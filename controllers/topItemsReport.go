@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type TopItem struct {
+	Food_id     string       `json:"food_id" bson:"_id"`
+	Name        string       `json:"name" bson:"name"`
+	Category_id *string      `json:"category_id" bson:"category_id"`
+	Quantity    int          `json:"quantity" bson:"quantity"`
+	Revenue     models.Money `json:"revenue" bson:"revenue"`
+	Orders      int          `json:"orders" bson:"orders"`
+	Attach_rate float64      `json:"attach_rate" bson:"-"`
+}
+
+type TopItemsReport struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Category_id *string   `json:"category_id"`
+	Daypart     *string   `json:"daypart"`
+	Location_id *string   `json:"location_id"`
+	Orders      int       `json:"orders"`
+	Items       []TopItem `json:"items"`
+}
+
+// servicePeriodMatch is an $expr condition matching the documents whose timestamp field falls in a service
+// period, in the server's time zone
+func servicePeriodMatch(field string, period models.ServicePeriod, now time.Time) bson.D {
+	date := bson.D{{"date", "$" + field}, {"timezone", now.Format("-07:00")}}
+	minute := bson.D{{"$add", bson.A{bson.D{{"$multiply", bson.A{bson.D{{"$hour", date}}, 60}}}, bson.D{{"$minute", date}}}}}
+	start, end := minutesOfDay(period.Start), minutesOfDay(period.End)
+	after := bson.D{{"$gte", bson.A{minute, start}}}
+	before := bson.D{{"$lt", bson.A{minute, end}}}
+	if start < end {
+		return bson.D{{"$expr", bson.D{{"$and", bson.A{after, before}}}}}
+	}
+	return bson.D{{"$expr", bson.D{{"$or", bson.A{after, before}}}}}
+}
+
+// findServicePeriod returns the configured service period with a name, ignoring case
+func findServicePeriod(ctx context.Context, name string) (*models.ServicePeriod, error) {
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	periods := settings.Service_periods
+	if len(periods) == 0 {
+		periods = defaultServicePeriods
+	}
+	for i := range periods {
+		if strings.EqualFold(periods[i].Name, name) {
+			return &periods[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// GetTopItems ranks the foods sold over a period by quantity, then revenue: the optional from/to query
+// parameters (RFC3339), by default the last 30 days. Optional filters are category (slug or category_id),
+// daypart (a service period such as LUNCH) and location_id; limit is the number of foods, default 20.
+// The attach rate of a food is the percentage of the period's orders, in the same daypart and location,
+// that included it. Voided items are not counted.
+func GetTopItems() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		from, to, err := reportPeriod(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		limit := 20
+		if c.Query("limit") != "" {
+			value, err := strconv.Atoi(c.Query("limit"))
+			if err != nil || value < 1 || value > 200 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+				return
+			}
+			limit = value
+		}
+		now := time.Now()
+		report := TopItemsReport{From: from, To: to, Items: []TopItem{}}
+
+		itemPipeline := mongo.Pipeline{bson.D{{"$match", bson.D{
+			{"created_at", bson.D{{"$gte", from}, {"$lt", to}}},
+			{"status", bson.D{{"$ne", "VOIDED"}}},
+			{"food_id", bson.D{{"$ne", nil}}},
+		}}}}
+		orderFilter := bson.D{{"created_at", bson.D{{"$gte", from}, {"$lt", to}}}}
+
+		if value := c.Query("daypart"); value != "" {
+			period, err := findServicePeriod(ctx, value)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the settings"})
+				return
+			}
+			if period == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "daypart must be one of the service periods"})
+				return
+			}
+			report.Daypart = &period.Name
+			itemPipeline = append(itemPipeline, bson.D{{"$match", servicePeriodMatch("created_at", *period, now)}})
+			orderFilter = append(orderFilter, servicePeriodMatch("created_at", *period, now)...)
+		}
+
+		// Order items have no location of their own, so they are filtered by their order's
+		if locationId := c.Query("location_id"); locationId != "" {
+			report.Location_id = &locationId
+			itemPipeline = append(itemPipeline,
+				bson.D{{"$lookup", bson.D{{"from", "order"}, {"localField", "order_id"}, {"foreignField", "order_id"}, {"as", "order"}}}},
+				bson.D{{"$match", bson.D{{"order.location_id", locationId}}}},
+			)
+			orderFilter = append(orderFilter, bson.E{"location_id", locationId})
+		}
+
+		itemPipeline = append(itemPipeline,
+			bson.D{{"$lookup", bson.D{{"from", "food"}, {"localField", "food_id"}, {"foreignField", "food_id"}, {"as", "food"}}}},
+			bson.D{{"$unwind", "$food"}},
+		)
+		if value := c.Query("category"); value != "" {
+			var category models.Category
+			err := categoryCollection.FindOne(ctx, bson.M{"$or": bson.A{bson.M{"slug": categorySlug(value)}, bson.M{"category_id": value}}}).Decode(&category)
+			if err != nil && err != mongo.ErrNoDocuments {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the category"})
+				return
+			}
+			if category.Category_id != "" {
+				value = category.Category_id
+			}
+			report.Category_id = &value
+			itemPipeline = append(itemPipeline, bson.D{{"$match", bson.D{{"food.category_id", value}}}})
+		}
+
+		itemPipeline = append(itemPipeline,
+			bson.D{{"$group", bson.D{
+				{"_id", "$food_id"},
+				{"name", bson.D{{"$first", "$food.name"}}},
+				{"category_id", bson.D{{"$first", "$food.category_id"}}},
+				{"quantity", bson.D{{"$sum", 1}}},
+				{"revenue", bson.D{{"$sum", bson.D{{"$ifNull", bson.A{"$unit_price", 0}}}}}},
+				{"orders", bson.D{{"$addToSet", "$order_id"}}},
+			}}},
+			bson.D{{"$addFields", bson.D{{"orders", bson.D{{"$size", "$orders"}}}}}},
+			bson.D{{"$sort", bson.D{{"quantity", -1}, {"revenue", -1}, {"name", 1}}}},
+			bson.D{{"$limit", limit}},
+		)
+		result, err := orderItemCollection.Aggregate(ctx, itemPipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating food sales"})
+			return
+		}
+		if err = result.All(ctx, &report.Items); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while calculating food sales"})
+			return
+		}
+
+		orders, err := orderCollection.CountDocuments(ctx, orderFilter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while counting orders"})
+			return
+		}
+		report.Orders = int(orders)
+		for i := range report.Items {
+			if orders > 0 {
+				report.Items[i].Attach_rate = toFixed(float64(report.Items[i].Orders)/float64(orders)*100, 2)
+			}
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
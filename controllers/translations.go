@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-management/models"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// acceptedLanguages returns the languages a client asked for, most preferred first, as ISO 639-1 codes.
+// The lang query parameter overrides the Accept-Language header.
+func acceptedLanguages(c *gin.Context) []string {
+	if lang := strings.ToLower(strings.TrimSpace(c.Query("lang"))); lang != "" {
+		return []string{strings.SplitN(lang, "-", 2)[0]}
+	}
+
+	type weighted struct {
+		language string
+		q        float64
+	}
+	var ranges []weighted
+	for _, part := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		language := strings.ToLower(strings.SplitN(strings.TrimSpace(fields[0]), "-", 2)[0])
+		if language == "" || language == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, weighted{language, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	languages := []string{}
+	seen := map[string]bool{}
+	for _, r := range ranges {
+		if !seen[r.language] {
+			seen[r.language] = true
+			languages = append(languages, r.language)
+		}
+	}
+	return languages
+}
+
+// requestLanguages returns the languages a client accepts and the language foods and menus are written in.
+// The settings are only loaded when the client asked for a language.
+func requestLanguages(ctx context.Context, c *gin.Context) ([]string, string, error) {
+	accepted := acceptedLanguages(c)
+	if len(accepted) == 0 {
+		return accepted, "", nil
+	}
+	settings, err := loadSettings(ctx)
+	if err != nil {
+		return accepted, "", err
+	}
+	return accepted, baseLanguage(settings), nil
+}
+
+// baseLanguage is the language foods and menus are written in: the language of the settings' locale, by default English
+func baseLanguage(settings models.Settings) string {
+	if settings.Locale != nil && *settings.Locale != "" {
+		return strings.ToLower(strings.SplitN(strings.ReplaceAll(*settings.Locale, "_", "-"), "-", 2)[0])
+	}
+	return "en"
+}
+
+// pickLanguage returns the first accepted language that is the base language or has a translation.
+// Without a match the base language is used.
+func pickLanguage(accepted []string, base string, translated func(string) bool) string {
+	for _, language := range accepted {
+		if language == base || translated(language) {
+			return language
+		}
+	}
+	return base
+}
+
+// localizeFood replaces a food's name and description with their translation in the client's language
+func localizeFood(food *models.Food, accepted []string, base string) {
+	language := pickLanguage(accepted, base, func(language string) bool {
+		_, ok := food.Translations[language]
+		return ok
+	})
+	translation, ok := food.Translations[language]
+	if !ok {
+		return
+	}
+	if translation.Name != nil {
+		food.Name = translation.Name
+	}
+	if translation.Description != nil {
+		food.Description = translation.Description
+	}
+}
+
+// localizeMenu replaces a menu's name and category with their translation in the client's language
+func localizeMenu(menu *models.Menu, accepted []string, base string) {
+	language := pickLanguage(accepted, base, func(language string) bool {
+		_, ok := menu.Translations[language]
+		return ok
+	})
+	translation, ok := menu.Translations[language]
+	if !ok {
+		return
+	}
+	if translation.Name != nil {
+		menu.Name = *translation.Name
+	}
+	if translation.Category != nil {
+		menu.Category = *translation.Category
+	}
+}
+
+// validateFoodTranslations checks the language codes and each translation, which the validator does
+// not descend into
+func validateFoodTranslations(translations map[string]models.FoodTranslation) error {
+	if err := validate.Var(translations, "omitempty,max=20,dive,keys,len=2,lowercase,alpha,endkeys"); err != nil {
+		return err
+	}
+	for _, translation := range translations {
+		if err := validate.Struct(translation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateMenuTranslations checks the language codes and each translation of a menu
+func validateMenuTranslations(translations map[string]models.MenuTranslation) error {
+	if err := validate.Var(translations, "omitempty,max=20,dive,keys,len=2,lowercase,alpha,endkeys"); err != nil {
+		return err
+	}
+	for _, translation := range translations {
+		if err := validate.Struct(translation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
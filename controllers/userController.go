@@ -80,7 +80,7 @@ func GetUsers() gin.HandlerFunc {
 			log.Fatal(err)
 		}
 		// Return the first (and only) result from the aggregation
-		c.JSON(http.StatusOK, allUsers[0])
+		maskedJSON(c, http.StatusOK, allUsers[0])
 
 	}
 }
@@ -107,7 +107,7 @@ func GetUser() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing user items"})
 		}
 		// Return the user data as JSON
-		c.JSON(http.StatusOK, user)
+		maskedJSON(c, http.StatusOK, user)
 	}
 }
 
@@ -175,9 +175,19 @@ func SignUp() gin.HandlerFunc {
 		user.ID = primitive.NewObjectID()
 		user.User_id = user.ID.Hex()
 
+		// Assign the staff role - roles are never taken from the signup request
+		// The very first account becomes ADMIN so the restaurant can be set up,
+		// every later account starts as WAITER until a manager changes its role
+		role := "WAITER"
+		userCount, err := userCollection.CountDocuments(ctx, bson.M{})
+		if err == nil && userCount == 0 {
+			role = "ADMIN"
+		}
+		user.Role = &role
+
 		// Generate JWT access and refresh tokens for the new user
 		// This allows immediate login after registration
-		token, refreshToken, _ := helper.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, user.User_id)
+		token, refreshToken, _ := helper.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, user.User_id, role)
 		user.Token = &token
 		user.Refresh_Token = &refreshToken
 
@@ -190,6 +200,10 @@ func SignUp() gin.HandlerFunc {
 		}
 		defer cancel()
 
+		// Send the welcome email to the new user
+		// Delivery is best effort and never fails the signup
+		sendWelcomeEmail(ctx, user)
+
 		// Return success response with the insertion result
 		c.JSON(http.StatusOK, resultInsertionNumber)
 	}
@@ -233,7 +247,12 @@ func Login() gin.HandlerFunc {
 
 		// Generate new JWT access and refresh tokens for the authenticated user
 		// This creates fresh tokens for the session
-		token, refreshToken, _ := helper.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, foundUser.User_id)
+		// Accounts created before roles existed are treated as WAITER
+		role := "WAITER"
+		if foundUser.Role != nil {
+			role = *foundUser.Role
+		}
+		token, refreshToken, _ := helper.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, foundUser.User_id, role)
 
 		// Update the user's tokens in the database
 		// This ensures the latest tokens are stored for future validation
@@ -244,6 +263,81 @@ func Login() gin.HandlerFunc {
 	}
 }
 
+// roleRanks orders the staff roles; users cannot change the role of someone ranking above them
+var roleRanks = map[string]int{"ADMIN": 3, "MANAGER": 2, "WAITER": 1, "KITCHEN": 1, "HOST": 1}
+
+// UpdateUserRole returns a gin handler function that changes a user's staff role
+// Only managers and admins may call it (enforced by the route), only admins may grant ADMIN,
+// and only admins may change the role of an admin
+// Parameters: user_id (URL parameter) - the user whose role is changed
+// Request body: {"role": "MANAGER"}
+// Returns: JSON object with the update result
+func UpdateUserRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Set up context with timeout for the database operation
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		userId := c.Param("user_id")
+		var body struct {
+			Role *string `json:"role" validate:"required,eq=ADMIN|eq=MANAGER|eq=WAITER|eq=KITCHEN|eq=HOST"`
+		}
+
+		// Parse and validate the requested role
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		// Managers may not promote anyone (including themselves) to ADMIN
+		if *body.Role == "ADMIN" && c.GetString("role") != "ADMIN" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only an admin can grant the ADMIN role"})
+			return
+		}
+
+		// Nobody may change the role of a user ranking above them, e.g. a manager demoting an admin
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "user was not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the user"})
+			return
+		}
+		currentRole := "WAITER"
+		if user.Role != nil {
+			currentRole = *user.Role
+		}
+		if roleRanks[currentRole] > roleRanks[c.GetString("role")] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only an admin can change the role of an admin"})
+			return
+		}
+
+		// Store the new role - it takes effect the next time the user logs in. The role read above is
+		// part of the filter, so a concurrent promotion is not overwritten.
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		result, err := userCollection.UpdateOne(
+			ctx,
+			bson.M{"user_id": userId, "role": user.Role},
+			bson.D{{"$set", bson.D{{"role", body.Role}, {"updated_at", updatedAt}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user role update failed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "the user's role was changed meanwhile, please retry"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
 // HashPassword takes a plain text password and returns a bcrypt hash
 // Parameters: password (string) - the plain text password to hash
 // Returns: string - the bcrypt hashed password
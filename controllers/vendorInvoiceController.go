@@ -0,0 +1,344 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var vendorInvoiceCollection *mongo.Collection = database.OpenCollection(database.Client, "vendorInvoice")
+
+// vendorMatchThreshold is the minimum OCR match confidence for a line to be booked without review.
+// It can be changed with the OCR_MATCH_THRESHOLD environment variable (default 0.85).
+func vendorMatchThreshold() float64 {
+	threshold, err := strconv.ParseFloat(os.Getenv("OCR_MATCH_THRESHOLD"), 64)
+	if err != nil || threshold <= 0 || threshold > 1 {
+		return 0.85
+	}
+	return threshold
+}
+
+func GetVendorInvoices() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+
+		result, err := vendorInvoiceCollection.Find(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing vendor invoices"})
+			return
+		}
+
+		var vendorInvoices []models.VendorInvoice
+		if err = result.All(ctx, &vendorInvoices); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing vendor invoices"})
+			return
+		}
+		c.JSON(http.StatusOK, vendorInvoices)
+	}
+}
+
+func CreateVendorInvoice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var vendorInvoice models.VendorInvoice
+
+		if err := c.BindJSON(&vendorInvoice); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(vendorInvoice)
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		// The supplier and invoice number identify a submission: a resubmitted invoice returns the stored one
+		existingFilter := bson.M{"supplier_name": vendorInvoice.Supplier_name, "invoice_number": vendorInvoice.Invoice_number}
+		var existing models.VendorInvoice
+		err := vendorInvoiceCollection.FindOne(ctx, existingFilter).Decode(&existing)
+		if err == nil {
+			c.JSON(http.StatusOK, existing)
+			return
+		}
+
+		var supplier models.Supplier
+		if vendorInvoice.Supplier_id != nil {
+			if err := supplierCollection.FindOne(ctx, bson.M{"supplier_id": *vendorInvoice.Supplier_id}).Decode(&supplier); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "supplier was not found"})
+				return
+			}
+		} else if supplierCollection.FindOne(ctx, bson.M{"name": supplierNamePattern(*vendorInvoice.Supplier_name)}).Decode(&supplier) == nil {
+			vendorInvoice.Supplier_id = &supplier.Supplier_id
+		}
+
+		vendorInvoice.ID = primitive.NewObjectID()
+		vendorInvoice.Vendor_invoice_id = vendorInvoice.ID.Hex()
+		vendorInvoice.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		vendorInvoice.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		threshold := vendorMatchThreshold()
+		for i := range vendorInvoice.Lines {
+			line := &vendorInvoice.Lines[i]
+			line.Status = "PENDING_REVIEW"
+			line.Movement_id = nil
+
+			if line.Inventory_item_id == nil {
+				// Fall back to an exact (case-insensitive) name match when the OCR service did not match the line
+				var item models.InventoryItem
+				pattern := "^" + regexp.QuoteMeta(line.Description) + "$"
+				if err := inventoryItemCollection.FindOne(ctx, bson.M{"name": bson.M{"$regex": pattern, "$options": "i"}}).Decode(&item); err == nil {
+					line.Inventory_item_id = &item.Inventory_item_id
+					line.Match_confidence = 1
+				}
+			}
+
+		}
+		vendorInvoice.Status = vendorInvoiceStatus(vendorInvoice)
+
+		// Store the invoice before booking any line, so the unique index lets only one of two concurrent
+		// submissions of the same invoice book its receipts
+		if _, err := vendorInvoiceCollection.InsertOne(ctx, vendorInvoice); err != nil {
+			if mongo.IsDuplicateKeyError(err) && vendorInvoiceCollection.FindOne(ctx, existingFilter).Decode(&existing) == nil {
+				c.JSON(http.StatusOK, existing)
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "vendor invoice was not stored"})
+			return
+		}
+
+		booked := false
+		for i := range vendorInvoice.Lines {
+			line := &vendorInvoice.Lines[i]
+			if line.Inventory_item_id == nil || line.Match_confidence < threshold {
+				continue
+			}
+			if err := reviewVendorInvoiceLine(ctx, vendorInvoice, i, "APPLIED", c.GetString("uid")); err != nil {
+				log.Println("failed to book line", i, "of vendor invoice", vendorInvoice.Vendor_invoice_id, ":", err)
+				continue
+			}
+			booked = true
+		}
+		if booked {
+			if err := refreshVendorInvoiceStatus(ctx, &vendorInvoice); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "vendor invoice update failed"})
+				return
+			}
+		}
+		if vendorInvoice.Status == "NEEDS_REVIEW" {
+			notifyManagers(ctx, "VENDOR_INVOICE_REVIEW", "Vendor invoice needs review",
+				"Some lines of invoice "+*vendorInvoice.Invoice_number+" from "+*vendorInvoice.Supplier_name+" could not be matched confidently",
+				vendorInvoice.Vendor_invoice_id)
+		}
+		c.JSON(http.StatusOK, vendorInvoice)
+	}
+}
+
+type VendorInvoiceLineReview struct {
+	Action            string  `json:"action" validate:"required,eq=APPROVE|eq=REJECT"`
+	Inventory_item_id *string `json:"inventory_item_id"`
+}
+
+func ReviewVendorInvoiceLine() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var review VendorInvoiceLineReview
+		var vendorInvoice models.VendorInvoice
+
+		if err := c.BindJSON(&review); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(review); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		vendorInvoiceId := c.Param("vendor_invoice_id")
+		if err := vendorInvoiceCollection.FindOne(ctx, bson.M{"vendor_invoice_id": vendorInvoiceId}).Decode(&vendorInvoice); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "vendor invoice was not found"})
+			return
+		}
+
+		index, err := strconv.Atoi(c.Param("line"))
+		if err != nil || index < 0 || index >= len(vendorInvoice.Lines) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "vendor invoice line was not found"})
+			return
+		}
+		line := &vendorInvoice.Lines[index]
+		if line.Status != "PENDING_REVIEW" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "vendor invoice line was already " + line.Status})
+			return
+		}
+		if review.Action == "APPROVE" {
+			if review.Inventory_item_id != nil {
+				line.Inventory_item_id = review.Inventory_item_id
+			}
+			if line.Inventory_item_id == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "an inventory_item_id is required to approve the line"})
+				return
+			}
+		}
+
+		status := "REJECTED"
+		if review.Action == "APPROVE" {
+			status = "APPLIED"
+		}
+		err = reviewVendorInvoiceLine(ctx, vendorInvoice, index, status, c.GetString("uid"))
+		if err == errVendorInvoiceLineReviewed {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := refreshVendorInvoiceStatus(ctx, &vendorInvoice); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "vendor invoice update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, vendorInvoice)
+	}
+}
+
+var errVendorInvoiceLineReviewed = errors.New("vendor invoice line was reviewed meanwhile")
+
+// reviewVendorInvoiceLine moves a line waiting for review to status, APPLIED booking it as a receipt
+// and REJECTED leaving it out. The line is claimed first, so a line is booked at most once even when
+// reviews race with each other or with the intake; errVendorInvoiceLineReviewed is returned when it no
+// longer waits for review. A line that fails to book waits for review again.
+func reviewVendorInvoiceLine(ctx context.Context, vendorInvoice models.VendorInvoice, index int, status string, reviewedBy string) error {
+	line := &vendorInvoice.Lines[index]
+	linePath := "lines." + strconv.Itoa(index)
+	updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	claim, err := vendorInvoiceCollection.UpdateOne(
+		ctx,
+		bson.M{"vendor_invoice_id": vendorInvoice.Vendor_invoice_id, linePath + ".status": "PENDING_REVIEW"},
+		bson.D{{"$set", bson.D{{linePath + ".status", status}, {linePath + ".inventory_item_id", line.Inventory_item_id}, {"updated_at", updatedAt}}}},
+	)
+	if err != nil {
+		return err
+	}
+	if claim.MatchedCount == 0 {
+		return errVendorInvoiceLineReviewed
+	}
+	if status != "APPLIED" {
+		return nil
+	}
+
+	if err := applyVendorInvoiceLine(ctx, vendorInvoice, line, reviewedBy); err != nil {
+		_, rollbackErr := vendorInvoiceCollection.UpdateOne(
+			ctx,
+			bson.M{"vendor_invoice_id": vendorInvoice.Vendor_invoice_id, linePath + ".status": "APPLIED"},
+			bson.D{{"$set", bson.D{{linePath + ".status", "PENDING_REVIEW"}}}},
+		)
+		if rollbackErr != nil {
+			log.Println("failed to put line", index, "of vendor invoice", vendorInvoice.Vendor_invoice_id, "back in review:", rollbackErr)
+		}
+		return err
+	}
+	_, err = vendorInvoiceCollection.UpdateOne(
+		ctx,
+		bson.M{"vendor_invoice_id": vendorInvoice.Vendor_invoice_id},
+		bson.D{{"$set", bson.D{{linePath + ".movement_id", line.Movement_id}}}},
+	)
+	return err
+}
+
+// refreshVendorInvoiceStatus sets the invoice status from its lines as stored, other lines may have been
+// reviewed meanwhile, and loads the updated invoice
+func refreshVendorInvoiceStatus(ctx context.Context, vendorInvoice *models.VendorInvoice) error {
+	return vendorInvoiceCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"vendor_invoice_id": vendorInvoice.Vendor_invoice_id},
+		mongo.Pipeline{{{"$set", bson.D{{"status", bson.D{{"$cond", bson.A{
+			bson.D{{"$in", bson.A{"PENDING_REVIEW", "$lines.status"}}}, "NEEDS_REVIEW", "PROCESSED",
+		}}}}}}}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(vendorInvoice)
+}
+
+// applyVendorInvoiceLine books a line as an inventory receipt and updates the item's unit cost
+func applyVendorInvoiceLine(ctx context.Context, vendorInvoice models.VendorInvoice, line *models.VendorInvoiceLine, createdBy string) error {
+	var item models.InventoryItem
+	if err := inventoryItemCollection.FindOne(ctx, bson.M{"inventory_item_id": line.Inventory_item_id}).Decode(&item); err != nil {
+		return err
+	}
+
+	movementType := "RECEIPT"
+	reason := "vendor invoice " + *vendorInvoice.Invoice_number + " from " + *vendorInvoice.Supplier_name
+	quantity := *line.Quantity
+	unitCost := toFixed(*line.Unit_cost, 2)
+	movement := models.InventoryMovement{
+		Inventory_item_id: line.Inventory_item_id,
+		Type:              &movementType,
+		Quantity:          &quantity,
+		Unit_cost:         &unitCost,
+		Reason:            &reason,
+		Reference_id:      &vendorInvoice.Vendor_invoice_id,
+		Expires_at:        line.Expires_at,
+		Lot_number:        line.Lot_number,
+		Created_by:        createdBy,
+	}
+	if err := recordInventoryMovement(ctx, &movement); err != nil {
+		return err
+	}
+
+	updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	_, err := inventoryItemCollection.UpdateOne(
+		ctx,
+		bson.M{"inventory_item_id": item.Inventory_item_id},
+		bson.D{{"$set", bson.D{{"unit_cost", unitCost}, {"updated_at", updatedAt}}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := checkFoodMargins(ctx, item, item.Unit_cost, unitCost); err != nil {
+		log.Println("failed to check the food margins after the cost of", item.Inventory_item_id, "changed:", err)
+	}
+
+	// The supplier's price list follows what it invoices
+	if vendorInvoice.Supplier_id != nil {
+		if err := updateSupplierPrice(ctx, *vendorInvoice.Supplier_id, item.Inventory_item_id, unitCost); err != nil {
+			log.Println("failed to update the price of supplier", *vendorInvoice.Supplier_id, ":", err)
+		}
+	}
+
+	line.Status = "APPLIED"
+	line.Movement_id = &movement.Movement_id
+	return nil
+}
+
+func vendorInvoiceStatus(vendorInvoice models.VendorInvoice) string {
+	for _, line := range vendorInvoice.Lines {
+		if line.Status == "PENDING_REVIEW" {
+			return "NEEDS_REVIEW"
+		}
+	}
+	return "PROCESSED"
+}
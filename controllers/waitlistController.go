@@ -0,0 +1,396 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/database"
+	helper "golang-restaurant-management/helpers"
+	"golang-restaurant-management/models"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var waitlistCollection *mongo.Collection = database.OpenCollection(database.Client, "waitlist")
+
+// activeWaitlistStatuses are the statuses of parties still waiting for a table
+var activeWaitlistStatuses = bson.A{"WAITING", "NOTIFIED"}
+
+type WaitlistEntryView struct {
+	models.WaitlistEntry `bson:",inline"`
+
+	// Position is the party's place in line, 1 for the next party; 0 once it left the list
+	Position int `json:"position"`
+}
+
+// waitlistStatusLink returns the link a party checks its place in line with.
+// The base URL is taken from PUBLIC_BASE_URL (default http://localhost:8000).
+func waitlistStatusLink(entry models.WaitlistEntry) string {
+	baseUrl := os.Getenv("PUBLIC_BASE_URL")
+	if baseUrl == "" {
+		baseUrl = "http://localhost:8000"
+	}
+	return fmt.Sprintf("%s/public/waitlist/%s", baseUrl, entry.Status_token)
+}
+
+// waitlistPosition returns a party's place in line: the number of active parties that joined before it, plus one
+func waitlistPosition(ctx context.Context, entry models.WaitlistEntry) (int, error) {
+	if entry.Status != "WAITING" && entry.Status != "NOTIFIED" {
+		return 0, nil
+	}
+	// Parties that joined in the same second are in line in the order of their ids, as in GetWaitlist
+	ahead, err := waitlistCollection.CountDocuments(ctx, bson.M{
+		"status": bson.M{"$in": activeWaitlistStatuses},
+		"$or": bson.A{
+			bson.M{"created_at": bson.M{"$lt": entry.Created_at}},
+			bson.M{"created_at": entry.Created_at, "_id": bson.M{"$lt": entry.ID}},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(ahead) + 1, nil
+}
+
+// GetWaitlist lists the parties waiting for a table in the order they joined, with their place in line.
+// With status, parties that left the list can be listed too.
+func GetWaitlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{"status": bson.M{"$in": activeWaitlistStatuses}}
+		if status := c.Query("status"); status != "" {
+			filter = bson.M{"status": status}
+		}
+		opts := options.Find().SetSort(bson.D{{"created_at", 1}, {"_id", 1}})
+		cursor, err := waitlistCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the waitlist"})
+			return
+		}
+		var entries []models.WaitlistEntry
+		if err = cursor.All(ctx, &entries); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the waitlist"})
+			return
+		}
+
+		views := []WaitlistEntryView{}
+		position := 0
+		for _, entry := range entries {
+			view := WaitlistEntryView{WaitlistEntry: entry}
+			if entry.Status == "WAITING" || entry.Status == "NOTIFIED" {
+				position++
+				view.Position = position
+			}
+			views = append(views, view)
+		}
+		maskedJSON(c, http.StatusOK, views)
+	}
+}
+
+// JoinWaitlist adds a party to the waitlist and texts it the quoted wait with a link to check its place
+// in line. Without a quoted wait from the host, WAITLIST_MINUTES_PER_PARTY (default 10) minutes are
+// quoted for every party ahead and the party itself.
+func JoinWaitlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var entry models.WaitlistEntry
+		if err := c.BindJSON(&entry); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(entry); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		token, err := helper.RandomToken(16)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the party could not be added to the waitlist"})
+			return
+		}
+		entry.ID = primitive.NewObjectID()
+		entry.Waitlist_entry_id = entry.ID.Hex()
+		entry.Status = "WAITING"
+		entry.Status_token = token
+		entry.Table_id = nil
+		entry.Notified_at = nil
+		entry.Seated_at = nil
+		entry.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		entry.Updated_at = entry.Created_at
+
+		position, err := waitlistPosition(ctx, entry)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the waitlist"})
+			return
+		}
+		if entry.Quoted_wait_minutes == nil {
+			quote := position * envInt("WAITLIST_MINUTES_PER_PARTY", 10)
+			entry.Quoted_wait_minutes = &quote
+		}
+
+		if _, err := waitlistCollection.InsertOne(ctx, entry); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the party could not be added to the waitlist"})
+			return
+		}
+
+		body := fmt.Sprintf("Hi %s, you're on the waitlist for %d, number %d in line. Expected wait: about %d minutes. We'll text you when your table is ready. Check your place: %s",
+			*entry.Customer_name, *entry.Party_size, position, *entry.Quoted_wait_minutes, waitlistStatusLink(entry))
+		queueMessage(ctx, "SMS", *entry.Customer_phone, "", body, "WAITLIST_JOINED", entry.Waitlist_entry_id)
+
+		maskedJSON(c, http.StatusOK, WaitlistEntryView{WaitlistEntry: entry, Position: position})
+	}
+}
+
+// UpdateWaitlistEntry changes a waiting party's name, phone, size, quoted wait or notes
+func UpdateWaitlistEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var entry models.WaitlistEntry
+		if err := c.BindJSON(&entry); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var updateObj primitive.D
+		if entry.Customer_name != nil {
+			updateObj = append(updateObj, bson.E{"customer_name", entry.Customer_name})
+		}
+		if entry.Customer_phone != nil {
+			updateObj = append(updateObj, bson.E{"customer_phone", entry.Customer_phone})
+		}
+		if entry.Party_size != nil {
+			updateObj = append(updateObj, bson.E{"party_size", entry.Party_size})
+		}
+		if entry.Quoted_wait_minutes != nil {
+			updateObj = append(updateObj, bson.E{"quoted_wait_minutes", entry.Quoted_wait_minutes})
+		}
+		if entry.Notes != nil {
+			updateObj = append(updateObj, bson.E{"notes", entry.Notes})
+		}
+		if entry.Customer_name != nil && validate.Var(*entry.Customer_name, "min=2,max=100") != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "customer_name must be 2 to 100 characters"})
+			return
+		}
+		if entry.Party_size != nil && *entry.Party_size < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "party size must be at least 1"})
+			return
+		}
+		if entry.Quoted_wait_minutes != nil && (*entry.Quoted_wait_minutes < 0 || *entry.Quoted_wait_minutes > 600) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "quoted_wait_minutes must be between 0 and 600"})
+			return
+		}
+		if entry.Notes != nil && len(*entry.Notes) > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "notes must be at most 500 characters"})
+			return
+		}
+
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{"updated_at", updatedAt})
+
+		result, err := waitlistCollection.UpdateOne(
+			ctx,
+			bson.M{"waitlist_entry_id": c.Param("waitlist_entry_id"), "status": bson.M{"$in": activeWaitlistStatuses}},
+			bson.D{{"$set", updateObj}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "waitlist entry update failed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "the party was not found on the waitlist"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// setWaitlistStatus moves an active waitlist entry to a new status, with the extra fields given
+func setWaitlistStatus(ctx context.Context, entryId string, status string, set bson.D) (models.WaitlistEntry, error) {
+	var entry models.WaitlistEntry
+	updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	set = append(bson.D{{"status", status}, {"updated_at", updatedAt}}, set...)
+	err := waitlistCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"waitlist_entry_id": entryId, "status": bson.M{"$in": activeWaitlistStatuses}},
+		bson.D{{"$set", set}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&entry)
+	return entry, err
+}
+
+// NotifyWaitlistEntry texts a party that its table is ready. Parties can be notified again.
+func NotifyWaitlistEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		entry, err := setWaitlistStatus(ctx, c.Param("waitlist_entry_id"), "NOTIFIED", bson.D{{"notified_at", now}})
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "the party was not found on the waitlist"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the party could not be notified"})
+			return
+		}
+
+		body := fmt.Sprintf("Hi %s, your table for %d is ready! Please come to the host stand.", *entry.Customer_name, *entry.Party_size)
+		queueMessage(ctx, "SMS", *entry.Customer_phone, "", body, "WAITLIST_TABLE_READY", entry.Waitlist_entry_id)
+		maskedJSON(c, http.StatusOK, entry)
+	}
+}
+
+// SeatWaitlistEntry seats a party at an AVAILABLE or RESERVED table: it leaves the waitlist and the
+// table is SEATED with its guests
+func SeatWaitlistEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			Table_id  *string `json:"table_id" validate:"required"`
+			Server_id *string `json:"server_id"`
+		}
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		entryId := c.Param("waitlist_entry_id")
+		var entry models.WaitlistEntry
+		if err := waitlistCollection.FindOne(ctx, bson.M{"waitlist_entry_id": entryId, "status": bson.M{"$in": activeWaitlistStatuses}}).Decode(&entry); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "the party was not found on the waitlist"})
+			return
+		}
+		var table models.Table
+		if err := tableCollection.FindOne(ctx, bson.M{"table_id": *request.Table_id}).Decode(&table); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "table was not found"})
+			return
+		}
+		if err := resolveCombinedTable(ctx, &table); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := checkTableCapacity(table, *entry.Party_size); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Parties are seated at free tables only; a DIRTY table has to be cleaned first
+		seated, err := setTableStatus(ctx, table.Table_id, []string{"AVAILABLE", "RESERVED"}, "SEATED", bson.D{{"number_of_guests", *entry.Party_size}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the party could not be seated"})
+			return
+		}
+		if !seated {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("the table is %s", tableStatus(table))})
+			return
+		}
+		recordSeating(ctx, table, request.Server_id, *entry.Party_size, "WAITLIST")
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		entry, err = setWaitlistStatus(ctx, entryId, "SEATED", bson.D{{"table_id", table.Table_id}, {"seated_at", now}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the table was seated, but the party could not be taken off the waitlist"})
+			return
+		}
+		maskedJSON(c, http.StatusOK, entry)
+	}
+}
+
+// MarkWaitlistNoShow takes a party that did not come back when called off the waitlist
+func MarkWaitlistNoShow() gin.HandlerFunc {
+	return waitlistRemovalHandler("NO_SHOW")
+}
+
+// CancelWaitlistEntry takes a party that left off the waitlist
+func CancelWaitlistEntry() gin.HandlerFunc {
+	return waitlistRemovalHandler("CANCELLED")
+}
+
+func waitlistRemovalHandler(status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		entry, err := setWaitlistStatus(ctx, c.Param("waitlist_entry_id"), status, nil)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "the party was not found on the waitlist"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "waitlist entry update failed"})
+			return
+		}
+		maskedJSON(c, http.StatusOK, entry)
+	}
+}
+
+// GetWaitlistStatusByToken is the public link parties check their place in line with. It shows no
+// personal details.
+func GetWaitlistStatusByToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var entry models.WaitlistEntry
+		if err := waitlistCollection.FindOne(ctx, bson.M{"status_token": c.Param("token")}).Decode(&entry); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "this waitlist link is no longer valid"})
+			return
+		}
+		position, err := waitlistPosition(ctx, entry)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the waitlist"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":              entry.Status,
+			"position":            position,
+			"party_size":          entry.Party_size,
+			"quoted_wait_minutes": entry.Quoted_wait_minutes,
+			"joined_at":           entry.Created_at,
+		})
+	}
+}
+
+// LeaveWaitlistByToken lets a party take itself off the waitlist from its link. It only answers POST
+// requests, so a link preview fetching the address cannot take the party off the list.
+func LeaveWaitlistByToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		result, err := waitlistCollection.UpdateOne(
+			ctx,
+			bson.M{"status_token": c.Param("token"), "status": bson.M{"$in": activeWaitlistStatuses}},
+			bson.D{{"$set", bson.D{{"status", "CANCELLED"}, {"updated_at", updatedAt}}}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "you could not be taken off the waitlist, please tell the host"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "this waitlist link is no longer valid"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "CANCELLED"})
+	}
+}
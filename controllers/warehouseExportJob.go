@@ -0,0 +1,464 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var exportWatermarkCollection *mongo.Collection = database.OpenCollection(database.Client, "exportWatermark")
+
+// errExportRunning is returned when an export is started while another one is still running
+var errExportRunning = errors.New("an export is already running")
+
+// exportLock lets a single export run at a time, so scheduled and manual runs do not write the same documents twice
+var exportLock = make(chan struct{}, 1)
+
+// exportSettleTime keeps the last minute out of an export run: documents being written when it starts can
+// still get an updated_at just before it, and are exported by the next run instead of being missed
+const exportSettleTime = time.Minute
+
+// exportSource is a collection exported to the warehouse. The Parquet files have a column per field of
+// columns and a document column holding the whole document as JSON, so nothing is lost; omit lists the
+// fields with guests' personal data, which are left out of exports.
+type exportSource struct {
+	name       string
+	collection *mongo.Collection
+	columns    []parquetColumn
+	omit       []string
+}
+
+var exportSources = []exportSource{
+	{
+		name:       "orders",
+		collection: orderCollection,
+		columns: []parquetColumn{
+			{"order_id", parquetString}, {"order_number", parquetInt64}, {"business_date", parquetString},
+			{"location_id", parquetString}, {"table_id", parquetString}, {"session_id", parquetString},
+			{"channel", parquetString}, {"status", parquetString}, {"server_id", parquetString},
+			{"customer_id", parquetString}, {"reservation_id", parquetString}, {"close_reason", parquetString},
+			{"created_at", parquetTimestamp}, {"updated_at", parquetTimestamp}, {"closed_at", parquetTimestamp},
+		},
+		omit: []string{"customer_name", "customer_phone", "customer_email"},
+	},
+	{
+		name:       "order_items",
+		collection: orderItemCollection,
+		columns: []parquetColumn{
+			{"order_item_id", parquetString}, {"order_id", parquetString}, {"food_id", parquetString},
+			{"quantity", parquetString}, {"unit_price", parquetInt64}, {"weight", parquetDouble},
+			{"status", parquetString}, {"void_reason", parquetString}, {"voided_by", parquetString},
+			{"created_at", parquetTimestamp}, {"updated_at", parquetTimestamp}, {"voided_at", parquetTimestamp},
+		},
+	},
+	{
+		name:       "invoices",
+		collection: invoiceCollection,
+		columns: []parquetColumn{
+			{"invoice_id", parquetString}, {"invoice_number", parquetString}, {"order_id", parquetString},
+			{"location_id", parquetString}, {"session_id", parquetString}, {"parent_invoice_id", parquetString},
+			{"payment_method", parquetString}, {"payment_status", parquetString}, {"invoice_status", parquetString},
+			{"subtotal", parquetInt64}, {"discount_total", parquetInt64}, {"tax_total", parquetInt64},
+			{"service_charge", parquetInt64}, {"tip", parquetInt64}, {"grand_total", parquetInt64},
+			{"refunded_amount", parquetInt64}, {"guests", parquetInt64},
+			{"created_at", parquetTimestamp}, {"updated_at", parquetTimestamp}, {"paid_at", parquetTimestamp},
+			{"voided_at", parquetTimestamp},
+		},
+		omit: []string{"customer_email", "email_deliveries"},
+	},
+}
+
+// exportDestination is where export files are written
+type exportDestination interface {
+	Put(ctx context.Context, key string, data []byte) error
+}
+
+type exportConfig struct {
+	destination exportDestination
+	// prefix is prepended to the keys of the files, without a trailing slash
+	prefix    string
+	format    string
+	batchSize int
+}
+
+// loadExportConfig reads the export configuration from the environment:
+//   - EXPORT_DESTINATION: s3://bucket/prefix, gs://bucket/prefix or file:///directory
+//   - EXPORT_FORMAT: "ndjson" for newline delimited JSON (default) or "parquet"
+//   - EXPORT_BATCH_SIZE: the most documents written to one file (default 50000)
+//
+// S3 is accessed with AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, the optional AWS_SESSION_TOKEN and
+// AWS_REGION (default us-east-1); EXPORT_S3_ENDPOINT points to another storage speaking the S3 API.
+// Google Cloud Storage is accessed through its S3 compatible API with the HMAC key GCS_HMAC_ACCESS_ID
+// and GCS_HMAC_SECRET.
+func loadExportConfig() (exportConfig, error) {
+	config := exportConfig{format: os.Getenv("EXPORT_FORMAT"), batchSize: envInt("EXPORT_BATCH_SIZE", 50000)}
+	if config.format == "" {
+		config.format = "ndjson"
+	}
+	if config.format != "ndjson" && config.format != "parquet" {
+		return config, fmt.Errorf("unknown export format %s", config.format)
+	}
+	if os.Getenv("EXPORT_DESTINATION") == "" {
+		return config, errors.New("EXPORT_DESTINATION is not configured")
+	}
+	destination, err := url.Parse(os.Getenv("EXPORT_DESTINATION"))
+	if err != nil {
+		return config, err
+	}
+	config.prefix = strings.Trim(destination.Path, "/")
+	client := &http.Client{Timeout: 5 * time.Minute}
+
+	switch destination.Scheme {
+	case "s3":
+		storage := s3ObjectStorage{
+			endpoint:     os.Getenv("EXPORT_S3_ENDPOINT"),
+			bucket:       destination.Host,
+			region:       os.Getenv("AWS_REGION"),
+			accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+			client:       client,
+		}
+		if storage.region == "" {
+			storage.region = "us-east-1"
+		}
+		if storage.endpoint == "" {
+			storage.endpoint = "https://s3." + storage.region + ".amazonaws.com"
+		} else {
+			storage.pathStyle = true
+		}
+		config.destination = storage
+	case "gs":
+		config.destination = s3ObjectStorage{
+			endpoint:  "https://storage.googleapis.com",
+			bucket:    destination.Host,
+			region:    "auto",
+			accessKey: os.Getenv("GCS_HMAC_ACCESS_ID"),
+			secretKey: os.Getenv("GCS_HMAC_SECRET"),
+			client:    client,
+		}
+	case "file":
+		config.destination = localFileStorage{dir: destination.Path}
+		config.prefix = ""
+	default:
+		return config, fmt.Errorf("unknown export destination %s", destination.Scheme)
+	}
+	if storage, ok := config.destination.(s3ObjectStorage); ok {
+		if storage.bucket == "" || storage.accessKey == "" || storage.secretKey == "" {
+			return config, fmt.Errorf("the %s export destination needs a bucket and access keys", destination.Scheme)
+		}
+	}
+	return config, nil
+}
+
+// StartWarehouseExportJob launches the background job that exports the orders, order items and invoices
+// changed since its previous run to the data warehouse's storage, for BI tools. The job only runs when
+// EXPORT_DESTINATION is set (see loadExportConfig); EXPORT_INTERVAL_MINUTES is how often it runs (default 60).
+func StartWarehouseExportJob() {
+	if os.Getenv("EXPORT_DESTINATION") == "" {
+		return
+	}
+	config, err := loadExportConfig()
+	if err != nil {
+		log.Println("warehouse export job:", err)
+		return
+	}
+	interval := time.Duration(envInt("EXPORT_INTERVAL_MINUTES", 60)) * time.Minute
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			// A run may take as long as the interval; the next run picks up where it stopped
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			watermarks, err := runWarehouseExport(ctx, config, exportSources, nil)
+			cancel()
+			if err != nil {
+				log.Println("warehouse export job:", err)
+			}
+			for _, watermark := range watermarks {
+				if watermark.Last_error != nil {
+					log.Printf("warehouse export job: error occured while exporting %s: %s", watermark.Collection, *watermark.Last_error)
+				}
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// runWarehouseExport exports the sources one after another and returns their watermarks. With from, the
+// documents updated since then are exported whatever the watermarks, to backfill the warehouse.
+func runWarehouseExport(ctx context.Context, config exportConfig, sources []exportSource, from *time.Time) ([]models.ExportWatermark, error) {
+	select {
+	case exportLock <- struct{}{}:
+		defer func() { <-exportLock }()
+	default:
+		return nil, errExportRunning
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	until := now.Add(-exportSettleTime)
+	watermarks := []models.ExportWatermark{}
+	for _, source := range sources {
+		watermark, err := exportCollection(ctx, config, source, from, until)
+		if err != nil {
+			message := err.Error()
+			watermark.Last_error = &message
+		}
+		watermark.Last_run_at = &now
+		watermark.Updated_at = now
+		set := bson.D{{"last_run_at", now}, {"last_error", watermark.Last_error}, {"updated_at", now}}
+		if err == nil {
+			set = append(set, bson.E{"exported_until", watermark.Exported_until}, bson.E{"last_documents", watermark.Last_documents}, bson.E{"last_files", watermark.Last_files})
+		}
+		_, updateErr := exportWatermarkCollection.UpdateOne(
+			ctx,
+			bson.M{"collection": source.name},
+			bson.D{{"$set", set}, {"$setOnInsert", bson.D{{"_id", primitive.NewObjectID()}}}},
+			options.Update().SetUpsert(true),
+		)
+		if updateErr != nil {
+			return watermarks, updateErr
+		}
+		watermarks = append(watermarks, watermark)
+	}
+	return watermarks, nil
+}
+
+// exportCollection writes the documents of a source updated after its watermark (or from) and up to until,
+// in files of at most the batch size, and returns its watermark moved to until. Files of a run that fails are written
+// again by the next run, so the warehouse may hold a document more than once and should keep its latest
+// updated_at.
+func exportCollection(ctx context.Context, config exportConfig, source exportSource, from *time.Time, until time.Time) (models.ExportWatermark, error) {
+	var watermark models.ExportWatermark
+	err := exportWatermarkCollection.FindOne(ctx, bson.M{"collection": source.name}).Decode(&watermark)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return watermark, err
+	}
+	watermark.Collection = source.name
+	// The first run exports everything
+	since := watermark.Exported_until
+	if from != nil {
+		since = *from
+	}
+	filter := bson.D{{"updated_at", bson.D{{"$gt", since}, {"$lte", until}}}}
+	columns := append(append([]parquetColumn{}, source.columns...), parquetColumn{"document", parquetString})
+
+	findOptions := options.Find().SetSort(bson.D{{"updated_at", 1}, {"_id", 1}})
+	if len(source.omit) > 0 {
+		projection := bson.D{}
+		for _, field := range source.omit {
+			projection = append(projection, bson.E{field, 0})
+		}
+		findOptions.SetProjection(projection)
+	}
+	cursor, err := source.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return watermark, err
+	}
+	defer cursor.Close(ctx)
+
+	files := []string{}
+	documents := 0
+	var lines bytes.Buffer
+	var rows [][]interface{}
+	count := 0
+	flush := func() error {
+		if count == 0 {
+			return nil
+		}
+		key := fmt.Sprintf("%s/dt=%s/%s-%s-%03d.%s", source.name, until.Format("2006-01-02"), source.name, until.UTC().Format("20060102T150405Z"), len(files)+1, config.format)
+		if config.prefix != "" {
+			key = config.prefix + "/" + key
+		}
+		data := lines.Bytes()
+		if config.format == "parquet" {
+			data = writeParquet(columns, rows)
+		}
+		if err := config.destination.Put(ctx, key, data); err != nil {
+			return err
+		}
+		files = append(files, key)
+		documents += count
+		lines.Reset()
+		rows = nil
+		count = 0
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		document, err := bson.MarshalExtJSON(cursor.Current, false, false)
+		if err != nil {
+			return watermark, err
+		}
+		if config.format == "parquet" {
+			row := make([]interface{}, 0, len(source.columns)+1)
+			for _, column := range source.columns {
+				row = append(row, exportValue(column.kind, cursor.Current.Lookup(column.name)))
+			}
+			rows = append(rows, append(row, string(document)))
+		} else {
+			lines.Write(document)
+			lines.WriteByte('\n')
+		}
+		count++
+		if count == config.batchSize {
+			if err := flush(); err != nil {
+				return watermark, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return watermark, err
+	}
+	if err := flush(); err != nil {
+		return watermark, err
+	}
+
+	watermark.Exported_until = until
+	watermark.Last_documents = documents
+	watermark.Last_files = files
+	watermark.Last_error = nil
+	return watermark, nil
+}
+
+// exportValue converts a field of a document to a Parquet value of a column's kind, nil when the field is
+// missing, null or of another type
+func exportValue(kind parquetKind, value bson.RawValue) interface{} {
+	switch value.Type {
+	case bsontype.String:
+		if kind == parquetString {
+			return value.StringValue()
+		}
+	case bsontype.Int32:
+		if kind == parquetInt64 {
+			return int64(value.Int32())
+		}
+		if kind == parquetDouble {
+			return float64(value.Int32())
+		}
+	case bsontype.Int64:
+		if kind == parquetInt64 {
+			return value.Int64()
+		}
+		if kind == parquetDouble {
+			return float64(value.Int64())
+		}
+	case bsontype.Double:
+		if kind == parquetDouble {
+			return value.Double()
+		}
+	case bsontype.Boolean:
+		if kind == parquetBoolean {
+			return value.Boolean()
+		}
+	case bsontype.DateTime:
+		if kind == parquetTimestamp {
+			return time.Unix(0, value.DateTime()*int64(time.Millisecond)).UTC()
+		}
+	}
+	return nil
+}
+
+// GetWarehouseExports lists how far every collection has been exported to the data warehouse
+func GetWarehouseExports() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		cursor, err := exportWatermarkCollection.Find(ctx, bson.M{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the exports"})
+			return
+		}
+		var found []models.ExportWatermark
+		if err = cursor.All(ctx, &found); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the exports"})
+			return
+		}
+		watermarks := []models.ExportWatermark{}
+		for _, source := range exportSources {
+			watermark := models.ExportWatermark{Collection: source.name, Last_files: []string{}}
+			for _, existing := range found {
+				if existing.Collection == source.name {
+					watermark = existing
+				}
+			}
+			watermarks = append(watermarks, watermark)
+		}
+		c.JSON(http.StatusOK, gin.H{"destination": os.Getenv("EXPORT_DESTINATION"), "exports": watermarks})
+	}
+}
+
+// RunWarehouseExportRequest picks what a manual export writes
+type RunWarehouseExportRequest struct {
+	// Collections are the collections to export, all of them when empty
+	Collections []string `json:"collections"`
+	// From exports the documents updated since then again, to backfill the warehouse
+	From *time.Time `json:"from"`
+}
+
+// RunWarehouseExport exports the changes since the last export right away instead of waiting for the
+// scheduled run, optionally for some collections only or again from an earlier time to backfill the
+// warehouse. It answers with the collections' watermarks once their files are written.
+func RunWarehouseExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Exports can write many files, so they get longer than other requests
+		var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		var request RunWarehouseExportRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.BindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		config, err := loadExportConfig()
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "the warehouse export is not configured: " + err.Error()})
+			return
+		}
+		sources := []exportSource{}
+		for _, source := range exportSources {
+			wanted := len(request.Collections) == 0
+			for _, name := range request.Collections {
+				wanted = wanted || name == source.name
+			}
+			if wanted {
+				sources = append(sources, source)
+			}
+		}
+		if len(sources) != len(request.Collections) && len(request.Collections) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "collections must be orders, order_items or invoices"})
+			return
+		}
+
+		watermarks, err := runWarehouseExport(ctx, config, sources, request.From)
+		if err == errExportRunning {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while recording the export"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"exports": watermarks})
+	}
+}
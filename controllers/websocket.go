@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// websocketGUID is appended to the client's key to compute the handshake's accept key (RFC 6455)
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket frame opcodes
+const (
+	websocketContinuation = 0
+	websocketText         = 1
+	websocketBinary       = 2
+	websocketClose        = 8
+	websocketPing         = 9
+	websocketPong         = 10
+)
+
+// websocketMaxMessage is the largest message accepted from clients, which only send small commands
+const websocketMaxMessage = 64 * 1024
+
+// errWebsocketClosed is returned by ReadMessage once the client closed the connection
+var errWebsocketClosed = errors.New("websocket closed")
+
+// websocketConn is the server side of a WebSocket connection over a hijacked HTTP connection
+type websocketConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	// writeLock keeps frames written by different goroutines from interleaving
+	writeLock sync.Mutex
+}
+
+// headerContains reports whether a comma separated header has a token, ignoring case
+func headerContains(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isWebsocketUpgrade reports whether a request asks to open a WebSocket connection
+func isWebsocketUpgrade(request *http.Request) bool {
+	return request.Method == http.MethodGet && headerContains(request.Header, "Connection", "upgrade") &&
+		headerContains(request.Header, "Upgrade", "websocket") && request.Header.Get("Sec-WebSocket-Key") != ""
+}
+
+// websocketOriginAllowed reports whether a browser on the request's Origin may open a WebSocket: pages
+// served from the API's own host, and the origins listed in WEBSOCKET_ALLOWED_ORIGINS (comma separated,
+// e.g. https://pos.example.com, or * for any). Requests without an Origin do not come from a browser page.
+func websocketOriginAllowed(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(parsed.Host, request.Host) {
+		return true
+	}
+	for _, allowed := range strings.Split(os.Getenv("WEBSOCKET_ALLOWED_ORIGINS"), ",") {
+		allowed = strings.TrimRight(strings.TrimSpace(allowed), "/")
+		if allowed == "*" || (allowed != "" && strings.EqualFold(allowed, origin)) {
+			return true
+		}
+	}
+	return false
+}
+
+// upgradeWebsocket completes the WebSocket handshake of a request checked with isWebsocketUpgrade and
+// takes over its connection
+func upgradeWebsocket(writer http.ResponseWriter, request *http.Request) (*websocketConn, error) {
+	if request.Header.Get("Sec-WebSocket-Version") != "13" {
+		writer.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(writer, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+	hijacker, ok := writer.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("the connection cannot be upgraded")
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(request.Header.Get("Sec-WebSocket-Key") + websocketGUID))
+	buffered.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	buffered.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := buffered.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &websocketConn{conn: conn, reader: buffered.Reader}, nil
+}
+
+// WriteMessage sends a message in a single frame; servers do not mask their frames
+func (ws *websocketConn) WriteMessage(opcode byte, payload []byte) error {
+	ws.writeLock.Lock()
+	defer ws.writeLock.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+	}
+	ws.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := ws.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadMessage returns the next text or binary message, joining fragmented messages. Pings are answered
+// on the way; errWebsocketClosed is returned once the client closes the connection.
+func (ws *websocketConn) ReadMessage() (byte, []byte, error) {
+	var opcode byte
+	var message []byte
+	for {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(ws.reader, header); err != nil {
+			return 0, nil, err
+		}
+		final, frameOpcode := header[0]&0x80 != 0, header[0]&0x0f
+		if header[0]&0x70 != 0 {
+			return 0, nil, errors.New("no websocket extension was negotiated")
+		}
+		if header[1]&0x80 == 0 {
+			return 0, nil, errors.New("client frames must be masked")
+		}
+		length := uint64(header[1] & 0x7f)
+		// Control frames fit in one frame of at most 125 bytes and may come between the frames of a message
+		if frameOpcode >= websocketClose && (!final || length > 125) {
+			return 0, nil, errors.New("websocket control frames must not be fragmented or longer than 125 bytes")
+		}
+		switch length {
+		case 126:
+			extended := make([]byte, 2)
+			if _, err := io.ReadFull(ws.reader, extended); err != nil {
+				return 0, nil, err
+			}
+			length = uint64(binary.BigEndian.Uint16(extended))
+		case 127:
+			extended := make([]byte, 8)
+			if _, err := io.ReadFull(ws.reader, extended); err != nil {
+				return 0, nil, err
+			}
+			length = binary.BigEndian.Uint64(extended)
+		}
+		if length+uint64(len(message)) > websocketMaxMessage {
+			return 0, nil, errors.New("websocket message too large")
+		}
+		mask := make([]byte, 4)
+		if _, err := io.ReadFull(ws.reader, mask); err != nil {
+			return 0, nil, err
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(ws.reader, payload); err != nil {
+			return 0, nil, err
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+
+		switch frameOpcode {
+		case websocketPing:
+			if err := ws.WriteMessage(websocketPong, payload); err != nil {
+				return 0, nil, err
+			}
+		case websocketPong:
+		case websocketClose:
+			ws.WriteMessage(websocketClose, payload)
+			return 0, nil, errWebsocketClosed
+		case websocketText, websocketBinary, websocketContinuation:
+			if (frameOpcode == websocketContinuation) != (opcode != 0) {
+				return 0, nil, errors.New("websocket message fragments out of order")
+			}
+			if frameOpcode != websocketContinuation {
+				opcode = frameOpcode
+			}
+			message = append(message, payload...)
+			if final {
+				return opcode, message, nil
+			}
+		default:
+			return 0, nil, errors.New("unknown websocket opcode")
+		}
+	}
+}
+
+// SetReadDeadline closes idle connections: reads fail once the deadline has passed
+func (ws *websocketConn) SetReadDeadline(deadline time.Time) error {
+	return ws.conn.SetReadDeadline(deadline)
+}
+
+func (ws *websocketConn) Close() error {
+	return ws.conn.Close()
+}
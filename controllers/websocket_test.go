@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestWebsocket returns the server side of a WebSocket over an in-memory connection, and the client side
+func newTestWebsocket(t *testing.T) (*websocketConn, net.Conn) {
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	server.SetDeadline(deadline)
+	client.SetDeadline(deadline)
+	return &websocketConn{conn: server, reader: bufio.NewReader(server)}, client
+}
+
+// clientFrame encodes a masked frame like clients send them; first is the first header byte
+func clientFrame(first byte, payload []byte) []byte {
+	frame := []byte{first}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, 0x80|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, 0x80|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	default:
+		frame = append(frame, 0x80|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(payload)))
+	}
+	mask := []byte{0x37, 0xfa, 0x21, 0x3d}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// readServerFrame reads an unmasked frame written by the server
+func readServerFrame(t *testing.T, conn net.Conn) (byte, []byte) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatal(err)
+	}
+	if header[1]&0x80 != 0 {
+		t.Fatal("server frames must not be masked")
+	}
+	length := uint64(header[1])
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		io.ReadFull(conn, extended)
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		io.ReadFull(conn, extended)
+		length = binary.BigEndian.Uint64(extended)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0], payload
+}
+
+// sendFrames writes frames from the client side while the server reads them
+func sendFrames(client net.Conn, frames ...[]byte) {
+	go func() {
+		for _, frame := range frames {
+			if _, err := client.Write(frame); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func TestWebsocketReadMessage(t *testing.T) {
+	ws, client := newTestWebsocket(t)
+	sendFrames(client, clientFrame(0x80|websocketText, []byte(`{"action":"subscribe"}`)))
+
+	opcode, message, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opcode != websocketText || string(message) != `{"action":"subscribe"}` {
+		t.Errorf("got opcode %d and %q", opcode, message)
+	}
+}
+
+func TestWebsocketReadExtendedLengths(t *testing.T) {
+	for _, length := range []int{125, 126, 0xffff, 0x10000} {
+		ws, client := newTestWebsocket(t)
+		payload := bytes.Repeat([]byte{'x'}, length)
+		sendFrames(client, clientFrame(0x80|websocketBinary, payload))
+
+		opcode, message, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("%d bytes: %v", len(payload), err)
+		}
+		if opcode != websocketBinary || !bytes.Equal(message, payload) {
+			t.Errorf("%d bytes: got opcode %d and %d bytes", len(payload), opcode, len(message))
+		}
+	}
+}
+
+// A fragmented message is joined, and a ping between its fragments is answered on the way
+func TestWebsocketFragmentedMessageWithPing(t *testing.T) {
+	ws, client := newTestWebsocket(t)
+	sendFrames(client,
+		clientFrame(websocketText, []byte("Hel")),
+		clientFrame(0x80|websocketPing, []byte("are you there")),
+		clientFrame(websocketContinuation, []byte("lo ")),
+		clientFrame(0x80|websocketContinuation, []byte("world")),
+	)
+
+	pong := make(chan []byte, 1)
+	go func() {
+		first, payload := readServerFrame(t, client)
+		if first != 0x80|websocketPong {
+			t.Errorf("the ping was answered with %#x", first)
+		}
+		pong <- payload
+	}()
+
+	opcode, message, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opcode != websocketText || string(message) != "Hello world" {
+		t.Errorf("got opcode %d and %q", opcode, message)
+	}
+	if payload := <-pong; string(payload) != "are you there" {
+		t.Errorf("the pong carries %q", payload)
+	}
+}
+
+func TestWebsocketClose(t *testing.T) {
+	ws, client := newTestWebsocket(t)
+	sendFrames(client, clientFrame(0x80|websocketClose, []byte{0x03, 0xe8}))
+
+	echoed := make(chan []byte, 1)
+	go func() {
+		first, payload := readServerFrame(t, client)
+		if first != 0x80|websocketClose {
+			t.Errorf("the close was answered with %#x", first)
+		}
+		echoed <- payload
+	}()
+
+	if _, _, err := ws.ReadMessage(); err != errWebsocketClosed {
+		t.Fatalf("got %v, want errWebsocketClosed", err)
+	}
+	if payload := <-echoed; !bytes.Equal(payload, []byte{0x03, 0xe8}) {
+		t.Errorf("the close carries %v", payload)
+	}
+}
+
+func TestWebsocketRejectsInvalidFrames(t *testing.T) {
+	unmasked := clientFrame(0x80|websocketText, []byte("hi"))
+	unmasked[1] &^= 0x80
+	unmasked = append(unmasked[:2], []byte("hi")...)
+
+	cases := []struct {
+		name   string
+		frames [][]byte
+	}{
+		{"unmasked frame", [][]byte{unmasked}},
+		{"reserved bits", [][]byte{clientFrame(0x80|0x40|websocketText, []byte("hi"))}},
+		{"unknown opcode", [][]byte{clientFrame(0x80|0x3, []byte("hi"))}},
+		{"ping over 125 bytes", [][]byte{clientFrame(0x80|websocketPing, bytes.Repeat([]byte{'p'}, 126))}},
+		{"close over 125 bytes", [][]byte{clientFrame(0x80|websocketClose, bytes.Repeat([]byte{'c'}, 126))}},
+		{"fragmented ping", [][]byte{clientFrame(websocketPing, []byte("a")), clientFrame(0x80|websocketContinuation, []byte("b"))}},
+		{"fragmented close", [][]byte{clientFrame(websocketClose, nil)}},
+		{"continuation without a message", [][]byte{clientFrame(0x80|websocketContinuation, []byte("hi"))}},
+		{"new message inside a message", [][]byte{clientFrame(websocketText, []byte("a")), clientFrame(0x80|websocketText, []byte("b"))}},
+		{"message too large", [][]byte{clientFrame(websocketBinary, make([]byte, websocketMaxMessage)), clientFrame(0x80|websocketContinuation, []byte("!"))}},
+	}
+	for _, c := range cases {
+		ws, client := newTestWebsocket(t)
+		sendFrames(client, c.frames...)
+		if _, _, err := ws.ReadMessage(); err == nil || err == errWebsocketClosed {
+			t.Errorf("%s: got %v, want an error", c.name, err)
+		}
+	}
+}
+
+func TestWebsocketWriteMessage(t *testing.T) {
+	cases := []struct {
+		length int
+		header []byte
+	}{
+		{0, []byte{0x81, 0}},
+		{125, []byte{0x81, 125}},
+		{126, []byte{0x81, 126, 0x00, 0x7e}},
+		{0xffff, []byte{0x81, 126, 0xff, 0xff}},
+		{0x10000, []byte{0x81, 127, 0, 0, 0, 0, 0, 0x01, 0x00, 0x00}},
+	}
+	for _, c := range cases {
+		ws, client := newTestWebsocket(t)
+		payload := bytes.Repeat([]byte{'y'}, c.length)
+		go ws.WriteMessage(websocketText, payload)
+
+		frame := make([]byte, len(c.header)+c.length)
+		if _, err := io.ReadFull(client, frame); err != nil {
+			t.Fatalf("%d bytes: %v", c.length, err)
+		}
+		if !bytes.Equal(frame[:len(c.header)], c.header) || !bytes.Equal(frame[len(c.header):], payload) {
+			t.Errorf("%d bytes: header %v, want %v", c.length, frame[:len(c.header)], c.header)
+		}
+	}
+}
+
+func TestWebsocketOriginAllowed(t *testing.T) {
+	defer os.Setenv("WEBSOCKET_ALLOWED_ORIGINS", os.Getenv("WEBSOCKET_ALLOWED_ORIGINS"))
+	os.Setenv("WEBSOCKET_ALLOWED_ORIGINS", "https://pos.example.com, https://kds.example.com/")
+
+	cases := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"", true},
+		{"https://api.example.com", true},
+		{"https://pos.example.com", true},
+		{"https://KDS.example.com", true},
+		{"https://evil.example.com", false},
+		{"https://pos.example.com.evil.com", false},
+		{"null", false},
+	}
+	for _, c := range cases {
+		request, _ := http.NewRequest(http.MethodGet, "https://api.example.com/ws", nil)
+		if c.origin != "" {
+			request.Header.Set("Origin", c.origin)
+		}
+		if allowed := websocketOriginAllowed(request); allowed != c.allowed {
+			t.Errorf("origin %q: allowed %v, want %v", c.origin, allowed, c.allowed)
+		}
+	}
+
+	os.Setenv("WEBSOCKET_ALLOWED_ORIGINS", "*")
+	request, _ := http.NewRequest(http.MethodGet, "https://api.example.com/ws", nil)
+	request.Header.Set("Origin", "https://anywhere.example.org")
+	if !websocketOriginAllowed(request) {
+		t.Error("* should allow any origin")
+	}
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-management/models"
+	"math"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// weightUnitGrams is the weight of one unit of measure in grams
+var weightUnitGrams = map[string]float64{
+	"KG": 1000,
+	"G":  1,
+	"LB": 453.59237,
+	"OZ": 28.349523125,
+}
+
+// soldByWeight reports whether a food is charged by its measured weight
+func soldByWeight(food models.Food) bool {
+	return food.Unit_of_measure != nil && *food.Unit_of_measure != "EACH"
+}
+
+// validateFoodPricing checks that a food sold by weight has a price per unit
+func validateFoodPricing(food models.Food) error {
+	if soldByWeight(food) && food.Price_per_unit == nil {
+		return fmt.Errorf("price_per_unit is required for foods sold by %s", *food.Unit_of_measure)
+	}
+	return nil
+}
+
+// priceOrderItem sets the unit price of an order item from its food, whatever price the client sent.
+// Items sold by weight are charged for their measured weight, converted to the food's unit of measure;
+// weights sent by a paired scale are marked as such, so manual entries can be told apart. Other items
+// are charged the price of their size. The options chosen are checked against the food's option groups
+// and their prices added.
+func priceOrderItem(ctx context.Context, orderItem *models.OrderItem, deviceId string) error {
+	if orderItem.Food_id == nil {
+		return nil
+	}
+	var food models.Food
+	if err := foodCollection.FindOne(ctx, bson.M{"food_id": *orderItem.Food_id}).Decode(&food); err != nil {
+		return fmt.Errorf("food was not found")
+	}
+	if food.Deleted_at != nil {
+		return fmt.Errorf("%s is no longer sold", *food.Name)
+	}
+	options, optionsPrice, err := selectFoodOptions(food, orderItem.Options)
+	if err != nil {
+		return err
+	}
+	orderItem.Options = options
+
+	if !soldByWeight(food) {
+		if orderItem.Weight != nil {
+			return fmt.Errorf("%s is not sold by weight", *food.Name)
+		}
+		size := ""
+		if orderItem.Quantity != nil {
+			size = *orderItem.Quantity
+		}
+		price, err := foodSizePrice(food, size)
+		if err != nil {
+			return err
+		}
+		price += optionsPrice
+		orderItem.Unit_price = &price
+		return nil
+	}
+	if orderItem.Weight == nil || *orderItem.Weight <= 0 {
+		return fmt.Errorf("a weight is required for %s, which is sold by %s", *food.Name, *food.Unit_of_measure)
+	}
+	if food.Price_per_unit == nil {
+		return fmt.Errorf("%s has no price per unit", *food.Name)
+	}
+
+	unit := *food.Unit_of_measure
+	measuredUnit := unit
+	if orderItem.Weight_unit != nil {
+		measuredUnit = *orderItem.Weight_unit
+	}
+	grams, ok := weightUnitGrams[measuredUnit]
+	if !ok {
+		return fmt.Errorf("unknown weight unit %s", measuredUnit)
+	}
+
+	// Weights are kept to the gram (or a thousandth of a pound or ounce), as precise as a scale reads
+	weight := math.Round(*orderItem.Weight*grams/weightUnitGrams[unit]*1000) / 1000
+	price := food.Price_per_unit.Mul(weight) + optionsPrice
+
+	source := "MANUAL"
+	orderItem.Scale_device_id = nil
+	if deviceId != "" {
+		var device models.Device
+		if err := deviceCollection.FindOne(ctx, bson.M{"device_id": deviceId}).Decode(&device); err == nil && device.Device_type == "SCALE" {
+			source = "SCALE"
+			orderItem.Scale_device_id = &deviceId
+		}
+	}
+
+	orderItem.Weight = &weight
+	orderItem.Weight_unit = &unit
+	orderItem.Weight_source = &source
+	orderItem.Unit_price = &price
+	return nil
+}
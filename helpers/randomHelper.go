@@ -0,0 +1,38 @@
+package helper
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// RandomToken returns a cryptographically random, hex encoded token
+// Used for secrets embedded in links sent to guests and devices
+// Parameters:
+//   - size: number of random bytes (the returned string is twice as long)
+// Returns: the hex encoded token and any error from the random source
+func RandomToken(size int) (string, error) {
+	bytes := make([]byte, size)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// RandomCode returns a random code of the given length drawn from alphabet
+// Used for short codes people read off a screen and type in, so the alphabet should avoid look-alike characters
+// Parameters:
+//   - length: number of characters in the code
+//   - alphabet: characters the code may contain
+// Returns: the code and any error from the random source
+func RandomCode(length int, alphabet string) (string, error) {
+	bytes := make([]byte, length)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, length)
+	for i, b := range bytes {
+		code[i] = alphabet[int(b)%len(alphabet)]
+	}
+	return string(code), nil
+}
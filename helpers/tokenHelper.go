@@ -29,6 +29,12 @@ type SignedDetails struct {
 	Last_name string
 	// Uid is the user's unique identifier stored in the token
 	Uid string
+	// Role is the user's staff role (ADMIN, MANAGER, WAITER, KITCHEN, HOST) or DEVICE for paired devices
+	Role string
+	// Device_id identifies a paired device; empty for user tokens
+	Device_id string
+	// Scopes lists the requests a device token may make, e.g. "GET /foods/*"; empty for user tokens
+	Scopes []string
 	// StandardClaims provides standard JWT fields like expiration time
 	jwt.StandardClaims
 }
@@ -37,6 +43,10 @@ type SignedDetails struct {
 // Used for updating user tokens in the database
 var userCollection *mongo.Collection = database.OpenCollection(database.Client, "user")
 
+// deviceCollection is a global reference to the MongoDB "device" collection
+// Used to check that a paired device has not been revoked
+var deviceCollection *mongo.Collection = database.OpenCollection(database.Client, "device")
+
 // SECRET_KEY is the JWT signing key retrieved from environment variables
 // This key is used to sign and validate all JWT tokens
 var SECRET_KEY string = os.Getenv("SECRET_KEY")
@@ -47,8 +57,9 @@ var SECRET_KEY string = os.Getenv("SECRET_KEY")
 //   - firstName: user's first name
 //   - lastName: user's last name  
 //   - uid: user's unique identifier
+//   - role: user's staff role
 // Returns: access token, refresh token, and any error
-func GenerateAllTokens(email string, firstName string, lastName string, uid string) (signedToken string, signedRefreshToken string, err error) {
+func GenerateAllTokens(email string, firstName string, lastName string, uid string, role string) (signedToken string, signedRefreshToken string, err error) {
 	// Create claims for the access token (expires in 24 hours)
 	// Contains user information for API authorization
 	claims := &SignedDetails{
@@ -56,6 +67,7 @@ func GenerateAllTokens(email string, firstName string, lastName string, uid stri
 		First_name: firstName,
 		Last_name:  lastName,
 		Uid:        uid,
+		Role:       role,
 		StandardClaims: jwt.StandardClaims{
 			// Access token expires in 24 hours
 			ExpiresAt: time.Now().Local().Add(time.Hour * time.Duration(24)).Unix(),
@@ -84,6 +96,27 @@ func GenerateAllTokens(email string, firstName string, lastName string, uid stri
 	return token, refreshToken, err
 }
 
+// GenerateDeviceToken creates an access token for a paired kiosk device
+// Device tokens carry no user information and are limited to the given route scopes
+// Parameters:
+//   - deviceId: the paired device's unique identifier
+//   - scopes: requests the device may make, as "METHOD /path" patterns
+//   - validFor: how long the token stays valid
+// Returns: the signed device token and any error
+func GenerateDeviceToken(deviceId string, scopes []string, validFor time.Duration) (string, error) {
+	claims := &SignedDetails{
+		Uid:       "device:" + deviceId,
+		Role:      "DEVICE",
+		Device_id: deviceId,
+		Scopes:    scopes,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Local().Add(validFor).Unix(),
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(SECRET_KEY))
+}
+
 // UpdateAllTokens updates both access and refresh tokens for a user in the database
 // This function is called after login or token refresh to store new tokens
 // Parameters:
@@ -177,3 +210,17 @@ func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
 	// Token is valid - return claims with no error message
 	return claims, msg
 }
+
+// DeviceTokenActive reports whether a paired device may still use its token
+// A device token stops working as soon as the device is revoked, even before it expires
+// Parameters:
+//   - deviceId: the paired device's unique identifier from the token claims
+// Returns: true if the device exists and has not been revoked
+func DeviceTokenActive(deviceId string) bool {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Only count devices that have not been revoked
+	count, err := deviceCollection.CountDocuments(ctx, bson.M{"device_id": deviceId, "revoked_at": nil})
+	return err == nil && count > 0
+}
@@ -6,6 +6,7 @@ package main
 import (
 	"os"
 
+	controller "golang-restaurant-management/controllers"
 	"golang-restaurant-management/database"
 
 	middleware "golang-restaurant-management/middleware"
@@ -34,27 +35,80 @@ func main() {
 	// Create a new Gin router instance
 	// Gin is a HTTP web framework for Go that provides fast routing and middleware support
 	router := gin.New()
-	
+
+	// Make sure the indexes backing uniqueness checks exist before serving requests
+	controller.EnsureIndexes()
+
+	// Convert amounts saved as floating point major units to integer minor units
+	controller.MigrateMoneyAmounts()
+
 	// Add logging middleware to log HTTP requests
 	// This helps with debugging and monitoring API usage
+	// Tokens passed in the URL are moved out of it first, so they are never logged
+	router.Use(middleware.TokenFromQuery())
 	router.Use(gin.Logger())
-	
+
 	// Set up user routes (login, signup) - these don't require authentication
 	// User routes are public endpoints for registration and authentication
 	routes.UserRoutes(router)
-	
+
+	// Set up public guest-facing routes (menu, reservation and waitlist links, device pairing, pickup board)
+	routes.PublicRoutes(router)
+
+	// Set up provider webhooks - these verify request signatures instead of JWT tokens
+	routes.WebhookRoutes(router)
+
 	// Apply authentication middleware to all subsequent routes
 	// This ensures that all routes below this line require a valid JWT token
 	router.Use(middleware.Authentication())
 
 	// Set up protected routes that require authentication
 	// These routes handle the core restaurant management functionality
-	routes.FoodRoutes(router)        // CRUD operations for food items
-	routes.MenuRoutes(router)        // Menu management endpoints
-	routes.TableRoutes(router)       // Table management for restaurant seating
-	routes.OrderRoutes(router)       // Order processing and management
-	routes.OrderItemRoutes(router)   // Individual order item management
-	routes.InvoiceRoutes(router)     // Invoice generation and management
+	routes.FoodRoutes(router)         // CRUD operations for food items
+	routes.MenuRoutes(router)         // Menu management endpoints
+	routes.CategoryRoutes(router)     // Food categories used to classify and filter foods
+	routes.SearchRoutes(router)       // Full-text search across foods and menus
+	routes.TableRoutes(router)        // Table management for restaurant seating
+	routes.OrderRoutes(router)        // Order processing and management
+	routes.OrderItemRoutes(router)    // Individual order item management
+	routes.InvoiceRoutes(router)      // Invoice generation and management
+	routes.DiscountRoutes(router)     // Discounts and coupons applied to invoices
+	routes.GiftCardRoutes(router)     // Gift card issuance, reloads and redemption
+	routes.CashSessionRoutes(router)  // Cash drawer sessions, floats and over/short on close
+	routes.NotificationRoutes(router) // Staff notifications raised by background jobs
+	routes.SettingsRoutes(router)     // Restaurant-wide configuration
+	routes.InventoryRoutes(router)    // Inventory items, the stock movement ledger and suppliers
+	routes.IntegrationRoutes(router)  // Hooks for external services (vendor invoice OCR, phone ordering)
+	routes.ReservationRoutes(router)  // Table reservations
+	routes.CustomerRoutes(router)     // Customer profiles, visit and spend history
+	routes.WaitlistRoutes(router)     // Walk-in waitlist, SMS updates and seating
+	routes.SectionRoutes(router)      // Server section assignments and seating rotation
+	routes.MessageRoutes(router)      // Outbound guest messages (SMS/email)
+	routes.DeviceRoutes(router)       // Paired kiosk devices (KDS, table tablets)
+	routes.RealtimeRoutes(router)     // WebSocket push of order and order item changes
+	routes.KitchenRoutes(router)      // Server-sent kitchen ticket stream per station
+	routes.UserAdminRoutes(router)    // Staff role management
+	routes.AnalyticsRoutes(router)    // Client usage telemetry and UX metrics
+	routes.ReportRoutes(router)       // Sales reports for managers
+	routes.ExportRoutes(router)       // Data warehouse exports for BI tools
+
+	// Start background jobs
+	// The stale order job flags (or auto-closes) orders that were left open for too long
+	controller.StartStaleOrderJob()
+	// The reservation reminder job reminds guests and releases unconfirmed reservations
+	controller.StartReservationReminderJob()
+	// The order escalation job alerts managers about orders held up longer than the configured thresholds
+	controller.StartOrderEscalationJob()
+	// The overdue invoice job flags unpaid invoices past their due date and sends payment reminders
+	controller.StartOverdueInvoiceJob()
+	// The scheduled price job applies food prices scheduled for a future date once it has come
+	controller.StartScheduledPriceJob()
+	// The warehouse export job writes the orders, order items and invoices changed since its last run to S3 or GCS
+	controller.StartWarehouseExportJob()
+	// The message delivery job sends the text messages that could not be sent when they were queued
+	controller.StartMessageDeliveryJob()
+	// Change streams push the order, order item and table changes made by any instance to the realtime clients
+	controller.StartChangeStreams()
 
 	// Start the HTTP server on the specified port
 	// The server will listen for incoming HTTP requests and route them appropriately
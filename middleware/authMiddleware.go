@@ -6,6 +6,7 @@ import (
 	"fmt"
 	helper "golang-restaurant-management/helpers"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,6 +19,7 @@ func Authentication() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Extract the JWT token from the "token" header
 		// Client should send: headers: { "token": "jwt_token_here" }
+		// WebSocket requests passing it in the URL have it moved there by TokenFromQuery
 		clientToken := c.Request.Header.Get("token")
 		
 		// Check if token is provided
@@ -42,8 +44,85 @@ func Authentication() gin.HandlerFunc {
 		c.Set("first_name", claims.First_name) // User's first name
 		c.Set("last_name", claims.Last_name)   // User's last name
 		c.Set("uid", claims.Uid)             // User's unique identifier
+		c.Set("role", claims.Role)           // User's staff role, or DEVICE for paired devices
+
+		// Device tokens are limited to the requests they were issued for
+		if claims.Device_id != "" {
+			if !helper.DeviceTokenActive(claims.Device_id) || !requestInScopes(c.Request.Method, c.Request.URL.Path, claims.Scopes) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "this device is not allowed to access this resource"})
+				c.Abort()
+				return
+			}
+			c.Set("device_id", claims.Device_id) // Paired device's unique identifier
+		}
 
 		// Continue to the next handler in the chain
 		c.Next()
 	}
 }
+
+// TokenFromQuery returns a Gin middleware function that takes the token out of the URL
+// Browsers cannot set headers when opening a WebSocket, so those requests may pass the token as the token
+// query parameter; it is moved to the "token" header for Authentication. It runs before the request logger,
+// so tokens never end up in access logs, and drops the parameter from other requests for the same reason.
+func TokenFromQuery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := c.Request.URL.Query()
+		if token := query.Get("token"); token != "" {
+			if c.Request.Header.Get("token") == "" && strings.EqualFold(c.Request.Header.Get("Upgrade"), "websocket") {
+				c.Request.Header.Set("token", token)
+			}
+			query.Del("token")
+			c.Request.URL.RawQuery = query.Encode()
+		}
+		c.Next()
+	}
+}
+
+// RequireRole returns a Gin middleware function that only lets users with one of the given roles through
+// It must run after Authentication, which stores the caller's role in the Gin context
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "you are not allowed to perform this action"})
+		c.Abort()
+	}
+}
+
+// requestInScopes reports whether a request matches one of a device token's scopes. Scopes are
+// "METHOD /path" patterns where ":name" matches any one segment and a trailing "*" the rest of the path.
+// Tokens issued before scopes had methods only list route prefixes; they are only allowed to read.
+func requestInScopes(method string, path string, scopes []string) bool {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, scope := range scopes {
+		scopeMethod, pattern := http.MethodGet, scope
+		if space := strings.Index(scope, " "); space >= 0 {
+			scopeMethod, pattern = scope[:space], scope[space+1:]
+		} else {
+			pattern = strings.TrimSuffix(scope, "/") + "/*"
+		}
+		if method == scopeMethod && pathMatches(segments, strings.Split(strings.Trim(pattern, "/"), "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathMatches reports whether the segments of a path match those of a scope pattern
+func pathMatches(segments []string, pattern []string) bool {
+	for i, part := range pattern {
+		if part == "*" && i == len(pattern)-1 {
+			return true
+		}
+		if i >= len(segments) || (part != segments[i] && !strings.HasPrefix(part, ":")) {
+			return false
+		}
+	}
+	return len(segments) == len(pattern)
+}
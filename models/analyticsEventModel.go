@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AnalyticsEvent is a single piece of usage telemetry sent by a client (POS, KDS, tablet)
+// This struct defines the structure of analytics event documents stored in MongoDB
+// Events are kept for a limited time only, see ANALYTICS_RETENTION_DAYS
+type AnalyticsEvent struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the event document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Event_id is the string representation of the MongoDB ObjectID
+	Event_id string `json:"event_id"`
+
+	// Name is what happened, e.g. SCREEN_OPENED or ORDER_SENT (required)
+	Name string `json:"name" validate:"required,max=64"`
+
+	// Screen is the client screen the event happened on, if any
+	Screen *string `json:"screen" validate:"omitempty,max=64"`
+
+	// Duration_ms is the measured time for timing events
+	// For ORDER_SENT it is the time from opening the order until it was sent to the kitchen
+	Duration_ms *int64 `json:"duration_ms" validate:"omitempty,min=0"`
+
+	// Session_id groups the events of one client session
+	Session_id *string `json:"session_id" validate:"omitempty,max=64"`
+
+	// Properties holds any additional event attributes sent by the client
+	Properties map[string]interface{} `json:"properties"`
+
+	// User_id is the signed in staff member who sent the event (taken from the token)
+	User_id string `json:"user_id"`
+
+	// Device_id is set when the event was sent by a paired device
+	Device_id *string `json:"device_id"`
+
+	// Occurred_at is when the event happened on the client (defaults to Received_at)
+	Occurred_at time.Time `json:"occurred_at"`
+
+	// Received_at is when the server stored the event; the retention TTL is based on it
+	Received_at time.Time `json:"received_at"`
+}
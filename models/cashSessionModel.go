@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CashSession is a cashier's shift on a cash drawer, from opening with a float to closing with a count
+// This struct defines the structure of cash session documents stored in MongoDB
+// Invoices paid in cash during the shift are linked to the session through their Cash_session_id
+type CashSession struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the cash session document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Cash_session_id is the string representation of the MongoDB ObjectID
+	Cash_session_id string `json:"cash_session_id"`
+
+	// Location_id is the restaurant location of the drawer (optional for single-site setups)
+	Location_id *string `json:"location_id"`
+
+	// Drawer_name identifies the drawer at the location (e.g. "Front counter")
+	Drawer_name *string `json:"drawer_name" validate:"omitempty,max=50"`
+
+	// Status is OPEN while the shift is running and CLOSED once the cash has been counted
+	Status string `json:"status"`
+
+	// Opening_float is the change put in the drawer when it was opened
+	Opening_float *Money `json:"opening_float" validate:"required,min=0"`
+
+	// Movements are the cash put into (PAID_IN) or taken out of (PAID_OUT) the drawer other than sales
+	Movements []CashMovement `json:"movements"`
+
+	// Opened_by is the user_id of the cashier who opened the drawer; their cash payments go to this session
+	Opened_by string    `json:"opened_by"`
+	Opened_at time.Time `json:"opened_at"`
+
+	// The amounts below are calculated when the session is closed
+
+	// Cash_sales is the amount of the invoices paid in cash during the session
+	Cash_sales Money `json:"cash_sales"`
+
+	// Cash_refunds is the amount refunded on those invoices, which was handed back from the drawer
+	Cash_refunds Money `json:"cash_refunds"`
+
+	// Paid_in_total and Paid_out_total are the sums of the session's movements
+	Paid_in_total  Money `json:"paid_in_total"`
+	Paid_out_total Money `json:"paid_out_total"`
+
+	// Expected_cash is the opening float plus cash sales and paid-ins, minus cash refunds and paid-outs
+	Expected_cash Money `json:"expected_cash"`
+
+	// Counted_cash is the cash counted in the drawer at closing
+	Counted_cash *Money `json:"counted_cash"`
+
+	// Over_short is Counted_cash minus Expected_cash: positive when the drawer is over, negative when short
+	Over_short Money `json:"over_short"`
+
+	// Closing_notes explains a difference found when closing (optional)
+	Closing_notes *string `json:"closing_notes"`
+
+	// Closed_by is the user_id of the staff member who counted and closed the drawer
+	Closed_by *string    `json:"closed_by"`
+	Closed_at *time.Time `json:"closed_at"`
+}
+
+// CashMovement is cash put into or taken out of a drawer for a reason other than a sale,
+// e.g. extra change (PAID_IN) or paying a supplier delivery (PAID_OUT)
+type CashMovement struct {
+	// Type is PAID_IN or PAID_OUT
+	Type string `json:"type" validate:"required,eq=PAID_IN|eq=PAID_OUT"`
+
+	// Amount is the cash moved
+	Amount Money `json:"amount" validate:"gt=0"`
+
+	// Reason explains the movement (required)
+	Reason string `json:"reason" validate:"required,max=250"`
+
+	// Recorded_by is the user_id of the staff member who moved the cash
+	Recorded_by string    `json:"recorded_by"`
+	Recorded_at time.Time `json:"recorded_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Category groups foods within and across menus, e.g. starters, mains or drinks
+// Foods reference their category by Category_id; listings are filtered by its Slug
+type Category struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the category document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Category_id is the string representation of the MongoDB ObjectID
+	Category_id string `json:"category_id"`
+
+	// Name is the category's display name (required)
+	Name *string `json:"name" validate:"required,min=2,max=50"`
+
+	// Slug is the unique lower case identifier used in food filters, e.g. "starters"
+	// Derived from the name when it is not given
+	Slug *string `json:"slug" validate:"omitempty,min=2,max=50"`
+
+	// Description is shown with the category on menus (optional)
+	Description *string `json:"description" validate:"omitempty,max=250"`
+
+	// Sort_order orders the categories on menus, lowest first (default 0)
+	Sort_order *int `json:"sort_order" validate:"omitempty,min=0"`
+
+	// Created_at is the timestamp when the category was created
+	Created_at time.Time `json:"created_at"`
+
+	// Updated_at is the timestamp when the category was last modified
+	Updated_at time.Time `json:"updated_at"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreditNote is the document issued when (part of) a paid invoice is refunded
+// This struct defines the structure of credit note documents stored in MongoDB
+// Credit notes are never changed once issued; sales reports subtract them as reversals
+type CreditNote struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the credit note document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Credit_note_id is the string representation of the MongoDB ObjectID
+	Credit_note_id string `json:"credit_note_id"`
+
+	// Credit_note_number is the sequential, human readable number printed on the document (e.g. CN-000042)
+	Credit_note_number string `json:"credit_note_number"`
+
+	// Invoice_id is the original invoice being (partially) refunded
+	Invoice_id string `json:"invoice_id"`
+
+	// Order_id is the order billed by the original invoice
+	Order_id string `json:"order_id"`
+
+	// Type is FULL for a refund of everything still refundable on the invoice, PARTIAL for selected lines
+	// or for an amount refunded at the payment provider
+	Type string `json:"type"`
+
+	// Lines are the refunded order items
+	Lines []CreditNoteLine `json:"lines"`
+
+	// Subtotal, Discount_total, Tax_lines, Tax_total, Service_charge and Tip are the reversed invoice amounts
+	Subtotal       Money            `json:"subtotal"`
+	Discount_total Money            `json:"discount_total"`
+	Tax_lines      []InvoiceTaxLine `json:"tax_lines"`
+	Tax_total      Money            `json:"tax_total"`
+	Service_charge Money            `json:"service_charge"`
+	Tip            Money            `json:"tip"`
+
+	// Total is the amount refunded to the guest
+	Total Money `json:"total"`
+
+	// Reason explains the refund (required)
+	Reason string `json:"reason"`
+
+	// Provider_refund_id is the payment provider's id of the refund, which matches its refund events to
+	// the credit note so a refund is only counted once
+	Provider_refund_id *string `json:"provider_refund_id"`
+
+	// Authorized_by is the user_id of the manager who approved the refund
+	Authorized_by string `json:"authorized_by"`
+
+	// Created_at is when the credit note was issued
+	Created_at time.Time `json:"created_at"`
+}
+
+// CreditNoteLine is a single refunded order item on a credit note
+type CreditNoteLine struct {
+	// Order_item_id is the refunded order item
+	Order_item_id string `json:"order_item_id"`
+
+	// Food_id is the food item that was ordered
+	Food_id string `json:"food_id"`
+
+	// Amount is the refunded item price before tax and service charge
+	Amount Money `json:"amount"`
+}
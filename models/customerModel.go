@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Customer is a guest profile that orders can be linked to, to follow their visits and spend
+// This struct defines the structure of customer documents stored in MongoDB
+// Orders are linked through their Customer_id; visits and spend are calculated from the linked orders
+type Customer struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the customer document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Customer_id is the string representation of the MongoDB ObjectID
+	Customer_id string `json:"customer_id"`
+
+	// Customer_name is the guest's name (required)
+	Customer_name *string `json:"customer_name" validate:"required,min=2,max=100"`
+
+	// Customer_phone identifies the guest; a phone number belongs to one customer (optional)
+	Customer_phone *string `json:"customer_phone" validate:"omitempty,max=30"`
+
+	// Customer_email is where offers can be sent (optional)
+	Customer_email *string `json:"customer_email" validate:"omitempty,email"`
+
+	// Notes are preferences or allergies staff should know about (optional)
+	Notes *string `json:"notes" validate:"omitempty,max=500"`
+
+	// Created_at is the timestamp when the customer was created
+	Created_at time.Time `json:"created_at"`
+
+	// Updated_at is the timestamp when the customer was last modified
+	Updated_at time.Time `json:"updated_at"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Device represents a paired kiosk device such as a kitchen display or a table tablet
+// This struct defines the structure of device documents stored in MongoDB
+// Devices authenticate with a scoped token issued when a manager confirms their pairing code
+type Device struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the device document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Device_id is the string representation of the MongoDB ObjectID
+	Device_id string `json:"device_id"`
+
+	// Device_type is the kind of device: KDS, TABLE_TABLET or SCALE
+	// The type decides which routes the device token may access
+	Device_type string `json:"device_type"`
+
+	// Name is the label given by the manager, e.g. "Grill station"
+	Name string `json:"name"`
+
+	// Table_id is the table a table tablet is placed on
+	Table_id *string `json:"table_id"`
+
+	// Paired_by is the user_id of the manager who confirmed the pairing
+	Paired_by string `json:"paired_by"`
+
+	// Revoked_at is set when the device is unpaired; its token stops working immediately
+	Revoked_at *time.Time `json:"revoked_at"`
+
+	// Created_at is the timestamp when the device was paired
+	Created_at time.Time `json:"created_at"`
+}
+
+// DevicePairing is a pending request from a device to be paired
+// The device shows Code on screen and polls until a manager confirms it
+type DevicePairing struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the pairing document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Pairing_id is the string representation of the MongoDB ObjectID
+	Pairing_id string `json:"pairing_id"`
+
+	// Code is the short code displayed by the device and typed in by the manager
+	Code string `json:"code"`
+
+	// Poll_secret is known only to the requesting device and is needed to collect the token
+	Poll_secret string `json:"-"`
+
+	// Device_type is the kind of device requesting pairing (required: KDS, TABLE_TABLET or SCALE)
+	Device_type *string `json:"device_type" validate:"required,eq=KDS|eq=TABLE_TABLET|eq=SCALE"`
+
+	// Status is PENDING, CONFIRMED or CLAIMED (the device has collected its token)
+	Status string `json:"status"`
+
+	// Device_id is the paired device, set once a manager confirms the code
+	Device_id *string `json:"device_id"`
+
+	// Expires_at is when the code stops being accepted
+	Expires_at time.Time `json:"expires_at"`
+
+	// Created_at is the timestamp when the pairing was requested
+	Created_at time.Time `json:"created_at"`
+}
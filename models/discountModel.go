@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Discount represents a discount or coupon that can be applied to invoices
+// This struct defines the structure of discount documents stored in MongoDB
+// Discounts with a Code are coupons entered by guests; without one they are applied by staff
+type Discount struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the discount document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Discount_id is the string representation of the MongoDB ObjectID
+	Discount_id string `json:"discount_id"`
+
+	// Name is the label printed on invoices (required)
+	Name *string `json:"name" validate:"required,min=2,max=100"`
+
+	// Code is the coupon code guests enter (optional, stored upper case)
+	Code *string `json:"code" validate:"omitempty,min=3,max=32,alphanum"`
+
+	// Type is PERCENTAGE (Value is a fraction, 0.1 = 10%) or FIXED (Value is an amount)
+	Type *string `json:"type" validate:"required,eq=PERCENTAGE|eq=FIXED"`
+
+	// Value is the discount rate or amount, depending on Type (required)
+	Value *float64 `json:"value" validate:"required,gt=0"`
+
+	// Scope is ORDER for a discount on the whole bill or ITEM for the foods listed in Food_ids
+	// A FIXED item discount is taken off every matching item
+	Scope *string `json:"scope" validate:"required,eq=ORDER|eq=ITEM"`
+
+	// Food_ids are the foods an ITEM discount applies to
+	Food_ids []string `json:"food_ids"`
+
+	// Valid_from and Valid_until limit when the discount can be applied (optional)
+	Valid_from  *time.Time `json:"valid_from"`
+	Valid_until *time.Time `json:"valid_until"`
+
+	// Usage_limit is how many invoices the discount may be applied to in total (optional)
+	Usage_limit *int `json:"usage_limit" validate:"omitempty,min=1"`
+
+	// Usage_count is how many invoices the discount is currently applied to
+	Usage_count int `json:"usage_count"`
+
+	// Active allows a discount to be switched off without deleting it
+	Active *bool `json:"active"`
+
+	// Created_by is the user_id of the manager who created the discount
+	Created_by string `json:"created_by"`
+
+	// Created_at is the timestamp when the discount was created
+	Created_at time.Time `json:"created_at"`
+
+	// Updated_at is the timestamp when the discount was last modified
+	Updated_at time.Time `json:"updated_at"`
+}
+
+// AppliedDiscount records a discount applied to an invoice and who applied it
+type AppliedDiscount struct {
+	// Discount_id is the applied discount
+	Discount_id string `json:"discount_id"`
+
+	// Name and Code are copied from the discount for printing
+	Name string  `json:"name"`
+	Code *string `json:"code"`
+
+	// Amount is the amount taken off the invoice, recalculated with the invoice totals
+	Amount Money `json:"amount"`
+
+	// Applied_by is the user_id of the staff member who applied the discount
+	Applied_by string `json:"applied_by"`
+
+	// Applied_at is when the discount was applied
+	Applied_at time.Time `json:"applied_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ExportWatermark tracks how far a collection has been exported to the data warehouse, so every
+// export run only writes the documents changed since the previous one
+type ExportWatermark struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the watermark document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Collection is the exported collection: orders, order_items or invoices
+	Collection string `json:"collection"`
+
+	// Exported_until is the time the documents updated up to have been exported; later changes are
+	// written by the next run
+	Exported_until time.Time `json:"exported_until"`
+
+	// Last_run_at is when the collection was last exported, successfully or not
+	Last_run_at *time.Time `json:"last_run_at"`
+
+	// Last_documents is the number of documents the last successful run wrote
+	Last_documents int `json:"last_documents"`
+
+	// Last_files are the keys of the files the last successful run wrote
+	Last_files []string `json:"last_files"`
+
+	// Last_error is why the last run failed, nil when it succeeded
+	Last_error *string `json:"last_error"`
+
+	// Updated_at is the timestamp when the watermark was last modified
+	Updated_at time.Time `json:"updated_at"`
+}
@@ -18,12 +18,15 @@ type Food struct {
 	Name *string `json:"name" validate:"required,min=2,max=100"`
 	
 	// Price is the cost of the food item (required)
-	// Stored as float64 to handle decimal currency values
-	Price *float64 `json:"price" validate:"required"`
+	// Stored as Money (integer minor units) so prices add up without rounding errors
+	Price *Money `json:"price" validate:"required,min=0"`
 	
-	// Food_image is the URL or path to the food item's image (required)
-	// Used for displaying the food item visually in menus and orders
-	Food_image *string `json:"food_image" validate:"required"`
+	// Food_image is the URL of the food item's image (optional)
+	// Set by uploading the image to POST /foods/:food_id/image; used for displaying the food item in menus and orders
+	Food_image *string `json:"food_image"`
+
+	// Thumbnail_image is the URL of a small version of the uploaded image, for lists and order screens
+	Thumbnail_image *string `json:"thumbnail_image"`
 	
 	// Created_at is the timestamp when the food item was added
 	Created_at time.Time `json:"created_at"`
@@ -38,4 +41,154 @@ type Food struct {
 	// Menu_id is the reference to the menu this food item belongs to (required)
 	// This creates a relationship between food items and their parent menu
 	Menu_id *string `json:"menu_id" validate:"required"`
+
+	// Sku is the internal SKU/PLU code staff key in or scan at the POS (optional, unique)
+	// Stored trimmed and upper case; it is not shown on the public menu
+	Sku *string `json:"sku" validate:"omitempty,min=1,max=30,excludesall=0x20"`
+
+	// Kitchen_name is the short name printed on kitchen tickets and shown on the KDS (optional)
+	// Foods without one are shown by their name
+	Kitchen_name *string `json:"kitchen_name" validate:"omitempty,max=30"`
+
+	// Scheduled_price is a price change set to take effect at a future date (optional)
+	// It is applied by the scheduled price job and recorded in the food's price history
+	Scheduled_price *ScheduledPrice `json:"scheduled_price"`
+
+	// Cost is the estimated cost to produce one portion of the food item (optional)
+	// Used for profitability and margin reporting
+	Cost *Money `json:"cost" validate:"omitempty,min=0"`
+
+	// Theoretical_cost is the cost of one portion from the food's recipe at the latest ingredient costs,
+	// unknown while an ingredient has no cost. Margin and Margin_percent are what the price leaves after
+	// it, or after Cost for foods without a recipe; Low_margin is set below the settings' minimum.
+	// They are calculated when the food is read and never stored
+	Theoretical_cost *Money   `json:"theoretical_cost" bson:"-"`
+	Margin           *Money   `json:"margin" bson:"-"`
+	Margin_percent   *float64 `json:"margin_percent" bson:"-"`
+	Low_margin       bool     `json:"low_margin" bson:"-"`
+
+	// Image_alt_text describes the food image for screen readers on customer-facing apps
+	// Menus can be published without it, but publishing reports a warning
+	Image_alt_text *string `json:"image_alt_text" validate:"omitempty,max=250"`
+
+	// Unit_of_measure is how the food is sold: EACH (default) or by weight in KG, G, LB or OZ.
+	// Foods sold by weight are charged Price_per_unit times the weight measured for each order item;
+	// their Price is the price of a typical portion, shown for reference
+	Unit_of_measure *string `json:"unit_of_measure" validate:"omitempty,eq=EACH|eq=KG|eq=G|eq=LB|eq=OZ"`
+
+	// Price_per_unit is the price of one Unit_of_measure (required for foods sold by weight)
+	Price_per_unit *Money `json:"price_per_unit" validate:"omitempty,min=0"`
+
+	// Size_prices maps the order item sizes (S, M, L) to their price (optional)
+	// A food with size prices is only sold in those sizes; without them every size costs Price
+	Size_prices map[string]Money `json:"size_prices" validate:"omitempty,dive,keys,eq=S|eq=M|eq=L,endkeys,min=0"`
+
+	// Related_items are the food_ids of foods suggested with this one, e.g. a drink paired with a dish
+	// They are shown first among the food's suggestions (see GET /foods/:food_id/suggestions)
+	Related_items []string `json:"related_items" validate:"omitempty,max=10,dive,required"`
+
+	// Option_groups are the choices made when the food is ordered, e.g. spice level or choice of side (optional)
+	Option_groups []FoodOptionGroup `json:"option_groups" validate:"omitempty,max=20,dive"`
+
+	// Tax_class is the code of the settings' tax class the food is taxed with
+	// Foods without a tax class are taxed with the default tax rates
+	Tax_class *string `json:"tax_class" validate:"omitempty,max=30"`
+
+	// Station is the kitchen station that prepares the food, e.g. GRILL or BAR; its tickets are shown
+	// on that station's screens. Stored trimmed and upper case (optional)
+	Station *string `json:"station" validate:"omitempty,max=30"`
+
+	// Description is the structured description shown on the public menu (optional)
+	Description *FoodDescription `json:"description"`
+
+	// Category_id is the reference to the category this food item belongs to (optional)
+	Category_id *string `json:"category_id"`
+
+	// Tags are free-form labels used to filter foods, e.g. "vegan" or "chef-special"
+	// Stored trimmed and lower case
+	Tags []string `json:"tags" validate:"omitempty,max=20,dive,min=1,max=30"`
+
+	// Allergens lists the allergens the food contains, stored upper case
+	// An empty list declares the food free of all of them; a food without the list has not been checked
+	Allergens []string `json:"allergens" validate:"omitempty,dive,oneof=GLUTEN CRUSTACEANS EGGS FISH PEANUTS NUTS SOY DAIRY CELERY MUSTARD SESAME SULPHITES LUPIN MOLLUSCS"`
+
+	// Dietary_flags lists the diets the food is suitable for, stored upper case
+	// Unlike the description's free-form dietary labels, these are checked and used in filters
+	Dietary_flags []string `json:"dietary_flags" validate:"omitempty,dive,oneof=VEGAN VEGETARIAN HALAL KOSHER GLUTEN_FREE DAIRY_FREE"`
+
+	// Sort_order is the food's display position within its menu, lowest first
+	// Foods without a position are shown after the others (see PATCH /menus/:menu_id/reorder)
+	Sort_order *int `json:"sort_order" validate:"omitempty,min=0"`
+
+	// Translations holds the food's name and description in other languages, keyed by ISO 639-1
+	// language code (e.g. "fr"); the Name and Description fields are in the settings' locale
+	Translations map[string]FoodTranslation `json:"translations" validate:"omitempty,max=20,dive,keys,len=2,lowercase,alpha,endkeys"`
+
+	// Deleted_at is set when the food is archived (DELETE /foods/:food_id)
+	// Archived foods are left out of listings and can no longer be ordered, but stay available
+	// to the orders and invoices that reference them
+	Deleted_at *time.Time `json:"deleted_at"`
+
+	// Version is the menu version at which this food item last changed
+	// Clients use it to fetch only what changed since their cached copy (see GET /menus/snapshot)
+	Version int64 `json:"version"`
+}
+
+// FoodDescription is a structured food description, so customer-facing apps can present
+// (and read out) each part separately instead of parsing free text
+type FoodDescription struct {
+	// Summary is a short plain-language description of the dish
+	Summary *string `json:"summary" validate:"omitempty,max=500"`
+
+	// Ingredients lists the main ingredients
+	Ingredients []string `json:"ingredients" validate:"omitempty,max=50,dive,max=100"`
+
+	// Dietary lists dietary labels such as VEGETARIAN, VEGAN or GLUTEN_FREE
+	Dietary []string `json:"dietary" validate:"omitempty,max=20,dive,max=50"`
+
+	// Spice_level is how spicy the dish is, from 0 (not spicy) to 3 (very spicy)
+	Spice_level *int `json:"spice_level" validate:"omitempty,min=0,max=3"`
+}
+
+// FoodOptionGroup is a choice made when ordering a food, such as its spice level or side
+// Between Min_select and Max_select of its options must be chosen; a group with a Min_select is required
+type FoodOptionGroup struct {
+	// Name identifies the group within the food, e.g. "Spice level" (required)
+	Name string `json:"name" validate:"required,min=1,max=50"`
+
+	// Min_select is how many options must at least be chosen (0 for an optional group)
+	Min_select int `json:"min_select" validate:"min=0"`
+
+	// Max_select is how many options may at most be chosen (at least 1)
+	Max_select int `json:"max_select" validate:"min=1"`
+
+	// Options are the options to choose from (required)
+	Options []FoodOption `json:"options" validate:"required,min=1,max=30,dive"`
+}
+
+// FoodOption is one option of an option group
+type FoodOption struct {
+	// Name identifies the option within its group, e.g. "Medium rare" (required)
+	Name string `json:"name" validate:"required,min=1,max=50"`
+
+	// Price is added to the item's price when the option is chosen (0 for none)
+	Price Money `json:"price" validate:"min=0"`
+}
+
+// FoodTranslation is a food's name and description in one language; missing fields fall back to the food's own
+type FoodTranslation struct {
+	Name        *string          `json:"name" validate:"omitempty,min=2,max=100"`
+	Description *FoodDescription `json:"description"`
+}
+
+// ScheduledPrice is a future price of a food
+type ScheduledPrice struct {
+	// Price is the food's price from Effective_at on (required)
+	Price *Money `json:"price" validate:"required,min=0"`
+
+	// Effective_at is when the price takes effect (required, in the future)
+	Effective_at *time.Time `json:"effective_at" validate:"required"`
+
+	// Scheduled_by is the user_id of the staff member who scheduled the price
+	Scheduled_by string `json:"scheduled_by"`
 }
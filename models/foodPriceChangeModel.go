@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FoodPriceChange is one entry in the price history of a food
+// This struct defines the structure of food price change documents stored in MongoDB
+// Entries are append-only: one is written for every price of a food that changes
+type FoodPriceChange struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the price change document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Price_change_id is the string representation of the MongoDB ObjectID
+	Price_change_id string `json:"price_change_id"`
+
+	// Food_id is the food whose price changed
+	Food_id string `json:"food_id"`
+
+	// Menu_id is the menu the food belonged to when its price changed
+	Menu_id *string `json:"menu_id"`
+
+	// Field is the price that changed: price, price_per_unit or size_prices.S, .M or .L
+	Field string `json:"field"`
+
+	// Old_price is the price before the change, null when the food had none
+	Old_price *Money `json:"old_price"`
+
+	// New_price is the price after the change, null when it was removed
+	New_price *Money `json:"new_price"`
+
+	// Source is how the price was changed: UPDATE (PATCH /foods/:food_id), DRAFT_PUBLISHED
+	// (a published menu draft) or SCHEDULED (a scheduled price taking effect)
+	Source string `json:"source"`
+
+	// Changed_by is the user_id of the staff member who made (or scheduled) the change
+	Changed_by string `json:"changed_by"`
+
+	// Created_at is the timestamp when the new price took effect
+	Created_at time.Time `json:"created_at"`
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GiftCard represents a prepaid gift card that can be used to pay invoices
+// This struct defines the structure of gift card documents stored in MongoDB
+// Every balance change is also recorded as a GiftCardTransaction
+type GiftCard struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the gift card document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Gift_card_id is the string representation of the MongoDB ObjectID
+	Gift_card_id string `json:"gift_card_id"`
+
+	// Code is the unique code printed on the card and entered to redeem it
+	Code string `json:"code"`
+
+	// Initial_balance is the amount the card was issued with
+	Initial_balance Money `json:"initial_balance"`
+
+	// Balance is the amount still available on the card
+	Balance Money `json:"balance"`
+
+	// Status is ACTIVE or DISABLED; disabled cards cannot be redeemed or reloaded
+	Status string `json:"status"`
+
+	// Expires_at is when the card stops being redeemable (optional)
+	Expires_at *time.Time `json:"expires_at"`
+
+	// Issued_by is the user_id of the staff member who issued the card
+	Issued_by string `json:"issued_by"`
+
+	// Created_at is the timestamp when the card was issued
+	Created_at time.Time `json:"created_at"`
+
+	// Updated_at is the timestamp when the card's balance or status last changed
+	Updated_at time.Time `json:"updated_at"`
+}
+
+// GiftCardTransaction is a single change to a gift card's balance
+type GiftCardTransaction struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the transaction document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Transaction_id is the string representation of the MongoDB ObjectID
+	Transaction_id string `json:"transaction_id"`
+
+	// Gift_card_id is the card whose balance changed
+	Gift_card_id string `json:"gift_card_id"`
+
+	// Type is ISSUE, RELOAD, REDEEM or REVERSAL (a redemption given back)
+	Type string `json:"type"`
+
+	// Amount is the signed balance change: positive for ISSUE, RELOAD and REVERSAL, negative for REDEEM
+	Amount Money `json:"amount"`
+
+	// Balance_after is the card's balance after the change
+	Balance_after Money `json:"balance_after"`
+
+	// Invoice_id is the invoice paid with a REDEEM (or REVERSAL) transaction
+	Invoice_id *string `json:"invoice_id"`
+
+	// Created_by is the user_id of the staff member who made the change
+	Created_by string `json:"created_by"`
+
+	// Created_at is when the change was made
+	Created_at time.Time `json:"created_at"`
+}
+
+// GiftCardPayment is a gift card redemption recorded on an invoice
+type GiftCardPayment struct {
+	// Gift_card_id is the redeemed card
+	Gift_card_id string `json:"gift_card_id"`
+
+	// Transaction_id is the card's REDEEM transaction
+	Transaction_id string `json:"transaction_id"`
+
+	// Amount is the amount paid with the card
+	Amount Money `json:"amount"`
+}
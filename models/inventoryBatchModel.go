@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InventoryBatch is a delivered lot of a perishable inventory item with its expiry date
+// This struct defines the structure of inventory batch documents stored in MongoDB
+// Batches are created by movements that bring in stock with an expiry date and are used up first-expired
+// first-out by the movements that take stock away; the ledger remains the source of the on-hand quantity
+type InventoryBatch struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the batch document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Inventory_batch_id is the string representation of the MongoDB ObjectID
+	Inventory_batch_id string `json:"inventory_batch_id"`
+
+	// Inventory_item_id is the inventory item of the batch
+	Inventory_item_id string `json:"inventory_item_id"`
+
+	// Location_id is the restaurant location holding the batch (empty for single-site setups)
+	Location_id *string `json:"location_id"`
+
+	// Lot_number is the supplier's lot or batch number, to trace recalls (optional)
+	Lot_number *string `json:"lot_number"`
+
+	// Expires_at is the use-by date of the batch
+	Expires_at time.Time `json:"expires_at"`
+
+	// Received_quantity is the quantity the batch came in with, in the item's unit
+	Received_quantity float64 `json:"received_quantity"`
+
+	// Remaining_quantity is what is left of the batch; it is used up once it reaches 0
+	Remaining_quantity float64 `json:"remaining_quantity"`
+
+	// Movement_id is the movement that brought the batch in
+	Movement_id string `json:"movement_id"`
+
+	// Created_at is the timestamp when the batch was received
+	Created_at time.Time `json:"created_at"`
+}
+
+// MovementBatch is the quantity a movement took from or added to a batch
+type MovementBatch struct {
+	Inventory_batch_id string  `json:"inventory_batch_id"`
+	Quantity           float64 `json:"quantity"`
+}
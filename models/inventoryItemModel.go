@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InventoryItem represents an ingredient or supply that the restaurant keeps in stock
+// This struct defines the structure of inventory item documents stored in MongoDB
+// The on-hand quantity is never stored here: it is derived from the inventory movement ledger
+type InventoryItem struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the inventory item document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Inventory_item_id is the string representation of the MongoDB ObjectID
+	// Used for easier referencing in other collections and API responses
+	Inventory_item_id string `json:"inventory_item_id"`
+
+	// Name is the ingredient's name (required, 2-100 characters)
+	Name *string `json:"name" validate:"required,min=2,max=100"`
+
+	// Unit is the unit of measure quantities are recorded in (required)
+	// Examples: "kg", "g", "l", "ml", "each"
+	Unit *string `json:"unit" validate:"required"`
+
+	// Unit_cost is the latest purchase cost per unit (optional)
+	// Updated automatically when vendor invoices are received
+	Unit_cost *float64 `json:"unit_cost" validate:"omitempty,min=0"`
+
+	// Barcodes are the codes printed on the item's packaging, unique across items (optional)
+	Barcodes []InventoryBarcode `json:"barcodes" validate:"omitempty,max=20,dive"`
+
+	// Perishable items are received in batches with an expiry date and used up first-expired first-out
+	Perishable *bool `json:"perishable"`
+
+	// Par_level is the stock to bring the item back up to when it is reordered (optional)
+	// Items without one get no reorder suggestions
+	Par_level *float64 `json:"par_level" validate:"omitempty,min=0"`
+
+	// Reorder_point is the on-hand quantity at which the item is reordered (optional)
+	// Without one it is the stock used during the supplier's lead time
+	Reorder_point *float64 `json:"reorder_point" validate:"omitempty,min=0"`
+
+	// Created_at is the timestamp when the inventory item was added
+	Created_at time.Time `json:"created_at"`
+
+	// Updated_at is the timestamp when the inventory item was last modified
+	Updated_at time.Time `json:"updated_at"`
+}
+
+// InventoryBarcode is a barcode of an inventory item and how much of the item one scan stands for
+type InventoryBarcode struct {
+	// Code is the scanned code, e.g. an EAN-13 (required)
+	Code string `json:"code" validate:"required,min=4,max=64"`
+
+	// Pack_quantity is the quantity of the item, in its unit, in the package carrying the code
+	// e.g. 12 for a case of 12 bottles (optional, defaults to 1)
+	Pack_quantity *float64 `json:"pack_quantity" validate:"omitempty,gt=0"`
+}
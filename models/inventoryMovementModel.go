@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InventoryMovement is an immutable entry in the stock ledger
+// This struct defines the structure of inventory movement documents stored in MongoDB
+// Current stock of an item is the sum of the quantities of all its movements;
+// mistakes are corrected with an ADJUSTMENT movement, never by editing a movement
+type InventoryMovement struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the movement document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Movement_id is the string representation of the MongoDB ObjectID
+	Movement_id string `json:"movement_id"`
+
+	// Inventory_item_id is the inventory item whose stock moved (required)
+	Inventory_item_id *string `json:"inventory_item_id" validate:"required"`
+
+	// Type is the kind of movement (required)
+	// RECEIPT adds stock, DEPLETION and WASTE remove it, TRANSFER and ADJUSTMENT may go either way
+	Type *string `json:"type" validate:"required,eq=RECEIPT|eq=DEPLETION|eq=WASTE|eq=TRANSFER|eq=ADJUSTMENT"`
+
+	// Quantity is the signed change in stock, in the item's unit (required)
+	// For RECEIPT, DEPLETION and WASTE the sign is applied by the server from the type
+	Quantity *float64 `json:"quantity" validate:"required"`
+
+	// Location_id is the restaurant location whose stock moved (optional for single-site setups)
+	Location_id *string `json:"location_id"`
+
+	// Unit_cost is the cost per unit for received stock (optional)
+	Unit_cost *float64 `json:"unit_cost" validate:"omitempty,min=0"`
+
+	// Expires_at is the use-by date of stock coming in; it makes the stock a batch (optional)
+	// Required to receive perishable items by hand
+	Expires_at *time.Time `json:"expires_at"`
+
+	// Lot_number is the supplier's lot number of a batch coming in (optional)
+	Lot_number *string `json:"lot_number" validate:"omitempty,max=50"`
+
+	// Batches are the batches the movement took stock from or added stock to, set by the server
+	Batches []MovementBatch `json:"batches"`
+
+	// Reason is a free-text explanation, required for WASTE and ADJUSTMENT movements
+	Reason *string `json:"reason"`
+
+	// Reference_id links the movement to its source document (order item, delivery, count, ...)
+	Reference_id *string `json:"reference_id"`
+
+	// Created_by is the user_id of the staff member who recorded the movement, or "system"
+	Created_by string `json:"created_by"`
+
+	// Created_at is the timestamp when the movement was recorded
+	Created_at time.Time `json:"created_at"`
+}
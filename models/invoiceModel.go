@@ -12,30 +12,267 @@ import (
 type Invoice struct {
 	// ID is the MongoDB ObjectID - the unique identifier for the invoice document
 	ID primitive.ObjectID `bson:"_id"`
-	
+
 	// Invoice_id is the string representation of the MongoDB ObjectID
 	// Used for easier referencing in other collections and API responses
 	Invoice_id string `json:"invoice_id"`
-	
+
+	// Invoice_number is the sequential number printed on the invoice, e.g. INV-2024-000123
+	// Numbers are assigned per location and year; unused numbers are recorded as gaps
+	Invoice_number string `json:"invoice_number"`
+
+	// Location_id is the location of the billed order, whose number sequence the invoice uses
+	Location_id *string `json:"location_id"`
+
 	// Order_id is the reference to the order this invoice is for
 	// This creates a relationship between invoices and orders
 	Order_id string `json:"order_id"`
-	
-	// Payment_method is how the customer will pay (CARD, CASH, or empty for not specified)
-	// The validation ensures only valid payment methods are accepted
-	Payment_method *string `json:"payment_method" validate:"eq=CARD|eq=CASH|eq="`
-	
-	// Payment_status tracks whether the invoice has been paid (required: PENDING or PAID)
+
+	// Session_id and Order_ids are set on a consolidated invoice billing every order of a table
+	// session at once; Order_id is then the session's first order
+	Session_id *string  `json:"session_id"`
+	Order_ids  []string `json:"order_ids"`
+
+	// Active_order_ids are the orders the invoice bills until it is voided; a unique index makes sure an
+	// order has only one active invoice. Split invoices leave it to their parent
+	Active_order_ids []string `json:"-"`
+
+	// Idempotency_key is the Idempotency-Key header the invoice was created with, so a retried create
+	// call returns this invoice instead of billing the order again
+	Idempotency_key *string `json:"idempotency_key"`
+
+	// Payment_method is how the customer will pay: the code of one of the settings' payment methods
+	// (default CARD or CASH), GIFT_CARD, ROOM_CHARGE, or empty for not specified
+	Payment_method *string `json:"payment_method" validate:"omitempty,max=30"`
+
+	// Payment_details is what was recorded about the payment, as required by the payment method
+	Payment_details *PaymentDetails `json:"payment_details"`
+
+	// Payment_status tracks whether the invoice has been paid (required: PENDING, PAID, REFUNDED, SPLIT or VOID)
+	// A SPLIT invoice has been replaced by child invoices that are paid individually
+	// A VOID invoice was cancelled before payment; it keeps its number and is no longer billed
 	// This is used for financial tracking and order completion
-	Payment_status *string `json:"payment_status" validate:"required,eq=PENDING|eq=PAID"`
-	
+	Payment_status *string `json:"payment_status" validate:"required,eq=PENDING|eq=PAID|eq=REFUNDED|eq=SPLIT|eq=VOID"`
+
+	// Void_reason explains why the invoice was voided, by Voided_by at Voided_at
+	Void_reason *string    `json:"void_reason"`
+	Voided_by   *string    `json:"voided_by"`
+	Voided_at   *time.Time `json:"voided_at"`
+
+	// Invoice_status is DRAFT while the bill can still change and a pre-check (pro forma) can be printed for
+	// the guest, and FINALIZED once it is settled for payment: its amounts are then fixed and the items of
+	// its orders can no longer change. Invoices are finalized by the finalize endpoint or when they are paid
+	Invoice_status *string    `json:"invoice_status"`
+	Finalized_by   *string    `json:"finalized_by"`
+	Finalized_at   *time.Time `json:"finalized_at"`
+
 	// Payment_due_date is when the payment is due
 	// Used for tracking overdue payments and follow-up
 	Payment_due_date time.Time `json:"Payment_due_date"`
-	
+
+	// Overdue_at is set by the overdue invoice job once an unpaid invoice is past its Payment_due_date
+	Overdue_at *time.Time `json:"overdue_at"`
+
+	// Overdue_reminders counts the payment reminders sent, the last one at Last_reminder_at
+	Overdue_reminders int        `json:"overdue_reminders"`
+	Last_reminder_at  *time.Time `json:"last_reminder_at"`
+
 	// Created_at is the timestamp when the invoice was generated
 	Created_at time.Time `json:"created_at"`
-	
+
 	// Updated_at is the timestamp when the invoice was last modified
 	Updated_at time.Time `json:"updated_at"`
+
+	// Subtotal is the sum of the order's non-voided item prices and buffet charges
+	// This and the other amounts below are always calculated by the server
+	Subtotal Money `json:"subtotal"`
+
+	// Buffet_lines are the per-head charges of buffet orders, one line per price tier; they are
+	// included in the subtotal, together with the à la carte extras
+	Buffet_lines []InvoiceBuffetLine `json:"buffet_lines"`
+	Buffet_total Money               `json:"buffet_total"`
+
+	// Applied_discounts are the discounts and coupons applied to the invoice
+	Applied_discounts []AppliedDiscount `json:"applied_discounts"`
+
+	// Discount_total is the sum of the applied discounts; taxes and service charge are
+	// calculated on the subtotal after discounts
+	Discount_total Money `json:"discount_total"`
+
+	// Tax_lines is the tax breakdown, one line per tax rate of every tax class billed
+	Tax_lines []InvoiceTaxLine `json:"tax_lines"`
+
+	// Tax_total is the sum of all tax lines
+	Tax_total Money `json:"tax_total"`
+
+	// Prices_include_tax is set when the invoice was calculated with tax inclusive prices: the taxes
+	// are then part of the subtotal and are not added to the grand total again
+	Prices_include_tax bool `json:"prices_include_tax"`
+
+	// Service_charge is the service charge calculated from the restaurant settings, the sum of
+	// Service_charge_lines when service charge rules are configured
+	Service_charge       Money                      `json:"service_charge"`
+	Service_charge_lines []InvoiceServiceChargeLine `json:"service_charge_lines"`
+
+	// Guests is the party size the service charge rules were applied for
+	Guests int `json:"guests"`
+
+	// Tip is the gratuity added by the guest (optional)
+	// This is the only amount accepted from the client
+	Tip *Money `json:"tip" validate:"omitempty,min=0"`
+
+	// Grand_total is the amount payable: subtotal - discounts + taxes + service charge + tip
+	// (taxes are not added when prices include them)
+	Grand_total Money `json:"grand_total"`
+
+	// Payment_reference is the payment provider's charge id, set when a card payment succeeds
+	Payment_reference *string `json:"payment_reference"`
+
+	// Card_charges are the charges the payment provider reported for this invoice while it was PENDING,
+	// and Charged_amount their total; the invoice is only PAID once they cover the amount due
+	Card_charges   []CardCharge `json:"card_charges"`
+	Charged_amount Money        `json:"charged_amount"`
+
+	// Paid_at is the timestamp when the invoice was paid
+	Paid_at *time.Time `json:"paid_at"`
+
+	// Cash_session_id is the cash drawer session that took the payment, for invoices paid in cash
+	Cash_session_id *string `json:"cash_session_id"`
+
+	// Gift_card_payments are the gift cards redeemed against this invoice
+	// The remaining amount due is Grand_total minus Gift_card_total and Deposit_total
+	Gift_card_payments []GiftCardPayment `json:"gift_card_payments"`
+	Gift_card_total    Money             `json:"gift_card_total"`
+
+	// Deposit_payments are the reservation deposits credited on this invoice
+	Deposit_payments []DepositPayment `json:"deposit_payments"`
+	Deposit_total    Money            `json:"deposit_total"`
+
+	// Refunded_amount is the total refunded to the guest so far
+	Refunded_amount Money `json:"refunded_amount"`
+
+	// Refunded_items are the order items already refunded through credit notes
+	Refunded_items []string `json:"refunded_items"`
+
+	// Room_charge_posting_id is the hotel PMS posting charging this invoice to a guest room;
+	// while it is set the invoice's payment can only change through the PMS acknowledgment
+	Room_charge_posting_id *string `json:"room_charge_posting_id"`
+
+	// Customer_email is the address the invoice was last emailed to, used when it is sent again
+	Customer_email *string `json:"customer_email"`
+
+	// Email_deliveries records every time the invoice or receipt was emailed, with the delivery status
+	Email_deliveries []InvoiceDelivery `json:"email_deliveries"`
+
+	// Parent_invoice_id is set on the child invoices created by splitting a bill
+	Parent_invoice_id *string `json:"parent_invoice_id"`
+
+	// Split_type is how a child invoice was split from its parent: ITEMS or EVEN
+	Split_type *string `json:"split_type"`
+
+	// Split_items are the order items billed on an ITEMS split child invoice
+	Split_items []string `json:"split_items"`
+
+	// Split_index and Split_count number the child invoices of a split, e.g. 2 of 3
+	Split_index int `json:"split_index"`
+	Split_count int `json:"split_count"`
+}
+
+// PaymentDetails is the metadata of a payment made on a local payment rail
+type PaymentDetails struct {
+	// Transaction_id is the reference of the payment, e.g. the UPI transaction id or a card approval code
+	Transaction_id *string `json:"transaction_id" validate:"omitempty,max=100"`
+
+	// Card_last_four are the last four digits of the card paid with
+	Card_last_four *string `json:"card_last_four" validate:"omitempty,len=4,numeric"`
+
+	// Provider is the wallet, UPI app or online gateway that processed the payment
+	Provider *string `json:"provider" validate:"omitempty,max=50"`
+
+	// Account_reference is the house account charged, e.g. a corporate customer's account number
+	Account_reference *string `json:"account_reference" validate:"omitempty,max=50"`
+}
+
+// InvoiceTaxLine is the amount of a single tax rate charged on an invoice
+type InvoiceTaxLine struct {
+	// Name is the tax's label (e.g. "VAT")
+	Name string `json:"name"`
+
+	// Tax_class is the tax class of the items taxed, or empty for the default tax rates
+	Tax_class string `json:"tax_class"`
+
+	// Rate is the tax rate as a fraction (0.05 = 5%)
+	Rate float64 `json:"rate"`
+
+	// Taxable_amount is the amount the rate was applied to, net of tax for tax inclusive prices
+	Taxable_amount Money `json:"taxable_amount"`
+
+	// Amount is the tax charged
+	Amount Money `json:"amount"`
+}
+
+// InvoiceServiceChargeLine is the amount of a single service charge rule applied to an invoice
+type InvoiceServiceChargeLine struct {
+	// Name is the rule's label (e.g. "Large party service")
+	Name string `json:"name"`
+
+	// Rate is the service charge rate as a fraction (0.10 = 10%)
+	Rate float64 `json:"rate"`
+
+	// Amount is the service charge on the subtotal after discounts
+	Amount Money `json:"amount"`
+}
+
+// InvoiceBuffetLine is the per-head charge for the guests of one price tier of a buffet order
+type InvoiceBuffetLine struct {
+	// Order_id is the buffet order charged
+	Order_id string `json:"order_id"`
+
+	// Plan and Plan_name identify the buffet plan
+	Plan      string `json:"plan"`
+	Plan_name string `json:"plan_name"`
+
+	// Tier is ADULT, CHILD or SENIOR
+	Tier string `json:"tier"`
+
+	// Guests is the number of guests charged at Unit_price
+	Guests     int   `json:"guests"`
+	Unit_price Money `json:"unit_price"`
+
+	// Amount is Guests times Unit_price
+	Amount Money `json:"amount"`
+}
+
+// CardCharge is a card charge reported by the payment provider
+type CardCharge struct {
+	// Charge_id is the payment provider's charge id
+	Charge_id string `json:"charge_id"`
+
+	// Amount is the amount charged
+	Amount Money `json:"amount"`
+
+	// Charged_at is when the charge was reported
+	Charged_at time.Time `json:"charged_at"`
+}
+
+// InvoiceDelivery is one email of an invoice or receipt to a customer
+type InvoiceDelivery struct {
+	// Message_id is the queued outbound message
+	Message_id string `json:"message_id"`
+
+	// To is the email address the invoice was sent to
+	To string `json:"to"`
+
+	// Kind is INVOICE for an unpaid invoice or RECEIPT for a paid one
+	Kind string `json:"kind"`
+
+	// Status is the message's delivery status: QUEUED, SENDING, SENT or FAILED
+	Status string `json:"status"`
+
+	// Sent_by is the user_id of the staff member who sent the invoice
+	Sent_by string `json:"sent_by"`
+
+	// Queued_at is when the email was queued, Sent_at when the provider delivered it
+	Queued_at time.Time  `json:"queued_at"`
+	Sent_at   *time.Time `json:"sent_at"`
 }
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InvoiceNumberGap records an invoice number that was drawn from the counter but never used,
+// so auditors can account for every number in the sequence
+type InvoiceNumberGap struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the gap document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Invoice_number is the skipped number, e.g. INV-2024-000123
+	Invoice_number string `json:"invoice_number"`
+
+	// Location_id is the location whose sequence the number belongs to
+	Location_id *string `json:"location_id"`
+
+	// Reason explains why the number was not used (e.g. the invoice could not be saved)
+	Reason string `json:"reason"`
+
+	// Created_at is when the gap was recorded
+	Created_at time.Time `json:"created_at"`
+}
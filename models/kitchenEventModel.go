@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// KitchenEvent is a change to a kitchen ticket (an order item) streamed to the kitchen screens.
+// Events are numbered in the order they happened, so screens can resume where they left off.
+type KitchenEvent struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the event document
+	ID primitive.ObjectID `bson:"_id" json:"-"`
+
+	// Sequence numbers the events; screens resume after the last sequence they received
+	Sequence int64 `json:"sequence"`
+
+	// Type is TICKET_NEW, TICKET_UPDATED, TICKET_BUMPED, TICKET_RECALLED, TICKET_SERVED, TICKET_VOIDED
+	// or TICKET_REMOVED
+	Type string `json:"type"`
+
+	// Order_item_id is the ticket's order item
+	Order_item_id string `json:"order_item_id"`
+
+	// Order_id, Order_number, Table_id and Location_id describe the ticket's order
+	Order_id     string  `json:"order_id"`
+	Order_number int     `json:"order_number"`
+	Table_id     *string `json:"table_id"`
+	Location_id  *string `json:"location_id"`
+
+	// Station is the kitchen station of the item's food; nil for foods without a station
+	Station *string `json:"station"`
+
+	// Food_id and Food_name are the food to prepare, with the quantity and options ordered
+	Food_id   *string           `json:"food_id"`
+	Food_name string            `json:"food_name"`
+	Quantity  *string           `json:"quantity"`
+	Options   []OrderItemOption `json:"options"`
+
+	// Status is the item's status after the change
+	Status string `json:"status"`
+
+	// Changed_by is the user who made the change, or "system"
+	Changed_by string `json:"changed_by"`
+
+	// Created_at is when the change happened; events are kept for KITCHEN_EVENT_RETENTION_HOURS
+	Created_at time.Time `json:"created_at"`
+}
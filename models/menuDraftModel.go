@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MenuDraft holds the pending changes to a menu and its foods. Waiters and guests keep seeing the
+// live menu until the draft is published; a menu has at most one draft.
+type MenuDraft struct {
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Menu_id is the menu the draft changes
+	Menu_id string `json:"menu_id"`
+
+	// Menu is the draft copy of the menu's own fields (name, category, dates and dayparts)
+	Menu Menu `json:"menu"`
+
+	// Foods are the foods the draft adds to the menu or changes, as they will be once published
+	Foods []Food `json:"foods"`
+
+	Created_by string    `json:"created_by"`
+	Created_at time.Time `json:"created_at"`
+	Updated_at time.Time `json:"updated_at"`
+}
+
+// MenuVersion is the snapshot of a menu and all its foods taken each time the menu is published
+type MenuVersion struct {
+	ID primitive.ObjectID `bson:"_id"`
+
+	Menu_version_id string `json:"menu_version_id"`
+	Menu_id         string `json:"menu_id"`
+
+	// Number counts the menu's publications, starting at 1
+	Number int `json:"number"`
+
+	Menu  Menu   `json:"menu"`
+	Foods []Food `json:"foods"`
+
+	Published_by string    `json:"published_by"`
+	Published_at time.Time `json:"published_at"`
+}
@@ -37,5 +37,47 @@ type Menu struct {
 	
 	// Menu_id is the string representation of the MongoDB ObjectID
 	// Used for easier referencing in other collections and API responses
-	Menu_id string `json:"food_id"`
+	Menu_id string `json:"menu_id"`
+
+	// Published_at is set when the menu is published; only published menus appear on the public menu
+	Published_at *time.Time `json:"published_at"`
+
+	// Status is DRAFT until the menu is first published, then PUBLISHED
+	Status string `json:"status"`
+
+	// Published_number is the number of the menu's latest published version (see GET /menus/:menu_id/versions)
+	Published_number int `json:"published_number"`
+
+	// Has_draft is set while pending changes to the menu wait in its draft
+	Has_draft bool `json:"has_draft"`
+
+	// Translations holds the menu's name and category in other languages, keyed by ISO 639-1 language code
+	Translations map[string]MenuTranslation `json:"translations" validate:"omitempty,max=20,dive,keys,len=2,lowercase,alpha,endkeys"`
+
+	// Deleted_at is set when the menu is archived (DELETE /menus/:menu_id), together with its foods
+	Deleted_at *time.Time `json:"deleted_at"`
+
+	// Version is the menu version at which this menu last changed
+	Version int64 `json:"version"`
+
+	// Dayparts are the times of day the menu is served, e.g. breakfast from 07:00 to 11:00 (optional)
+	// A menu without dayparts is served all day between its Start_Date and End_Date
+	Dayparts []MenuDaypart `json:"dayparts" validate:"omitempty,max=10,dive"`
+}
+
+// MenuDaypart is a daily window in which a menu is served, in the restaurant's local time
+type MenuDaypart struct {
+	// Start and End are the local times (HH:MM) the window opens and closes
+	// A window whose End is before its Start runs past midnight, e.g. 22:00 to 02:00
+	Start string `json:"start" validate:"required,datetime=15:04"`
+	End   string `json:"end" validate:"required,datetime=15:04,nefield=Start"`
+
+	// Days limits the window to some days of the week (MON to SUN); empty means every day
+	Days []string `json:"days" validate:"omitempty,max=7,dive,oneof=MON TUE WED THU FRI SAT SUN"`
+}
+
+// MenuTranslation is a menu's name and category in one language; missing fields fall back to the menu's own
+type MenuTranslation struct {
+	Name     *string `json:"name" validate:"omitempty,min=1,max=100"`
+	Category *string `json:"category" validate:"omitempty,min=1,max=100"`
 }
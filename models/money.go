@@ -0,0 +1,184 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// Money is an amount in the minor units of the restaurant's currency (cents for USD, paise
+// for INR, yen for JPY). Amounts are stored in MongoDB as 64-bit integers so totals add up
+// exactly, and are read and written in JSON as decimal numbers in major units (12.50).
+type Money int64
+
+// DefaultCurrency is used until a currency is configured in the settings
+const DefaultCurrency = "USD"
+
+// currencyExponents lists the ISO 4217 currencies whose minor unit is not a hundredth
+var currencyExponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// minorUnitExponent is the number of decimals of the configured currency
+var minorUnitExponent int32 = 2
+
+// CurrencyExponent returns the number of decimals of an ISO 4217 currency code
+func CurrencyExponent(code string) int {
+	if exponent, ok := currencyExponents[strings.ToUpper(code)]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// SetCurrency configures the currency amounts are expressed in. Changing the currency once
+// amounts have been recorded does not convert them, so it should be set before going live.
+func SetCurrency(code string) {
+	if code == "" {
+		code = DefaultCurrency
+	}
+	atomic.StoreInt32(&minorUnitExponent, int32(CurrencyExponent(code)))
+}
+
+// MinorUnits returns how many minor units make up one major unit of the configured currency
+func MinorUnits() int64 {
+	return int64(math.Pow10(int(atomic.LoadInt32(&minorUnitExponent))))
+}
+
+// MoneyFromFloat converts an amount in major units, rounding half away from zero
+func MoneyFromFloat(amount float64) Money {
+	return Money(math.Round(amount * float64(MinorUnits())))
+}
+
+// Float returns the amount in major units, for ratios and display only
+func (m Money) Float() float64 {
+	return float64(m) / float64(MinorUnits())
+}
+
+// Mul multiplies the amount by a rate (a tax rate, a share), rounding to the nearest minor unit
+func (m Money) Mul(rate float64) Money {
+	return Money(math.Round(float64(m) * rate))
+}
+
+// Allocate splits the amount into parts that add up exactly to it; the leftover minor units
+// go to the last part
+func (m Money) Allocate(parts int) []Money {
+	shares := make([]Money, parts)
+	each := m / Money(parts)
+	for i := range shares {
+		shares[i] = each
+	}
+	shares[parts-1] = m - each*Money(parts-1)
+	return shares
+}
+
+// AllocateByWeights splits the amount into parts proportional to weights that add up exactly to it;
+// the leftover minor units go to the last part. Weights adding up to zero split it equally.
+func (m Money) AllocateByWeights(weights []Money) []Money {
+	var total Money
+	for _, weight := range weights {
+		total += weight
+	}
+	if total == 0 {
+		return m.Allocate(len(weights))
+	}
+	shares := make([]Money, len(weights))
+	allocated := Money(0)
+	for i := 0; i < len(weights)-1; i++ {
+		shares[i] = m.Mul(float64(weights[i]) / float64(total))
+		allocated += shares[i]
+	}
+	shares[len(weights)-1] = m - allocated
+	return shares
+}
+
+// String formats the amount in major units with the currency's number of decimals
+func (m Money) String() string {
+	exponent := int(atomic.LoadInt32(&minorUnitExponent))
+	sign := ""
+	value := int64(m)
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	units := MinorUnits()
+	if exponent == 0 {
+		return sign + strconv.FormatInt(value, 10)
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, value/units, exponent, value%units)
+}
+
+// MarshalJSON writes the amount as a decimal number in major units
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads a decimal number (or a numeric string) in major units. Amounts with
+// more decimals than the currency allows are rounded to the nearest minor unit.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	if text == "null" {
+		return nil
+	}
+	amount, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return fmt.Errorf("invalid amount %s", string(data))
+	}
+	if math.Abs(amount) > float64(math.MaxInt64/MinorUnits()) {
+		return errors.New("amount is out of range")
+	}
+	*m = MoneyFromFloat(amount)
+	return nil
+}
+
+// MarshalBSONValue stores the amount as an int64 of minor units
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bsontype.Int64, bsoncore.AppendInt64(nil, int64(m)), nil
+}
+
+// UnmarshalBSONValue reads minor units. Doubles and decimals are amounts written before
+// the switch to minor units and are read as major units.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.Int64:
+		value, _, ok := bsoncore.ReadInt64(data)
+		if !ok {
+			return errors.New("invalid int64 amount")
+		}
+		*m = Money(value)
+	case bsontype.Int32:
+		value, _, ok := bsoncore.ReadInt32(data)
+		if !ok {
+			return errors.New("invalid int32 amount")
+		}
+		*m = Money(value)
+	case bsontype.Double:
+		value, _, ok := bsoncore.ReadDouble(data)
+		if !ok {
+			return errors.New("invalid double amount")
+		}
+		*m = MoneyFromFloat(value)
+	case bsontype.Decimal128:
+		value, _, ok := bsoncore.ReadDecimal128(data)
+		if !ok {
+			return errors.New("invalid decimal amount")
+		}
+		amount, err := strconv.ParseFloat(value.String(), 64)
+		if err != nil {
+			return err
+		}
+		*m = MoneyFromFloat(amount)
+	case bsontype.Null, bsontype.Undefined:
+		*m = 0
+	default:
+		return fmt.Errorf("cannot read %s as an amount", t)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Notification represents an in-app message raised by the system for staff
+// This struct defines the structure of notification documents stored in MongoDB
+// Notifications are addressed either to a single user or to every user with a role
+type Notification struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the notification document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Notification_id is the string representation of the MongoDB ObjectID
+	// Used for easier referencing in other collections and API responses
+	Notification_id string `json:"notification_id"`
+
+	// Recipient_role is the staff role the notification is addressed to (e.g. MANAGER)
+	Recipient_role *string `json:"recipient_role"`
+
+	// Recipient_id is the user_id of a single recipient, when not addressed to a role
+	Recipient_id *string `json:"recipient_id"`
+
+	// Type is a machine readable event name such as STALE_ORDER
+	Type string `json:"type" validate:"required"`
+
+	// Title is the short heading shown in the notification list
+	Title string `json:"title" validate:"required"`
+
+	// Message is the full notification text
+	Message string `json:"message"`
+
+	// Reference_id points at the document the notification is about (order_id, invoice_id, ...)
+	Reference_id *string `json:"reference_id"`
+
+	// Read_at is set once the notification has been acknowledged
+	Read_at *time.Time `json:"read_at"`
+
+	// Created_at is the timestamp when the notification was raised
+	Created_at time.Time `json:"created_at"`
+}
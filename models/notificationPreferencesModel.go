@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NotificationPreferences says which channels a user's notifications are sent to
+// Users without preferences get every notification in the app only
+type NotificationPreferences struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the preferences document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// User_id is the user the preferences belong to; a user has a single preferences document
+	User_id string `json:"user_id"`
+
+	// Default_channels are the channels of the notifications without an entry in Events:
+	// IN_APP, PUSH (sent to the user's connected apps), SMS or EMAIL
+	Default_channels []string `json:"default_channels" validate:"dive,eq=IN_APP|eq=PUSH|eq=SMS|eq=EMAIL"`
+
+	// Events lists the channels of notification types (e.g. STALE_ORDER, ORDER_ESCALATION);
+	// an empty list turns a type off
+	Events map[string][]string `json:"events" validate:"dive,dive,eq=IN_APP|eq=PUSH|eq=SMS|eq=EMAIL"`
+
+	// Updated_at is the timestamp when the preferences were last changed
+	Updated_at time.Time `json:"updated_at"`
+}
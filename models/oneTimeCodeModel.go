@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OneTimeCode is a verification code texted to a guest to prove they own a phone number
+// Only a hash of the code is stored; codes can be checked a few times before they expire
+type OneTimeCode struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the code document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Code_id is the string representation of the MongoDB ObjectID
+	Code_id string `json:"code_id"`
+
+	// Phone is the number the code was texted to, in E.164 format
+	Phone string `json:"phone"`
+
+	// Purpose is what the number is verified for: ORDER, RESERVATION, WAITLIST or CUSTOMER
+	Purpose string `json:"purpose"`
+
+	// Requested_ip is the address the code was requested from
+	Requested_ip string `json:"requested_ip"`
+
+	// Code_hash is the SHA-256 of the code id and the code
+	Code_hash string `json:"-"`
+
+	// Attempts counts the checks of the code, right or wrong
+	Attempts int `json:"attempts"`
+
+	// Expires_at is when the code stops being accepted
+	Expires_at time.Time `json:"expires_at"`
+
+	// Verified_at is set when the right code was given; a code is only accepted once
+	Verified_at *time.Time `json:"verified_at"`
+
+	// Created_at is the timestamp when the code was sent
+	Created_at time.Time `json:"created_at"`
+}
@@ -17,9 +17,9 @@ type OrderItem struct {
 	// Note: This appears to be for portion sizes rather than numeric quantity
 	Quantity *string `json:"quantity" validate:"required,eq=S|eq=M|eq=L"`
 	
-	// Unit_price is the price for this specific order item (required)
-	// This may differ from the base food price due to size or modifications
-	Unit_price *float64 `json:"unit_price" validate:"required"`
+	// Unit_price is the price for this specific order item
+	// It is set by the server from the food's price for the chosen size, or from the measured weight
+	Unit_price *Money `json:"unit_price"`
 	
 	// Created_at is the timestamp when the order item was added to the order
 	Created_at time.Time `json:"created_at"`
@@ -38,4 +38,40 @@ type OrderItem struct {
 	// Order_id is the reference to the parent order (required)
 	// This creates a relationship between order items and their parent order
 	Order_id string `json:"order_id" validate:"required"`
+
+	// Status is the kitchen fulfillment state of this item
+	// Items start QUEUED and are moved forward by the kitchen bump/serve endpoints
+	Status *string `json:"status" validate:"omitempty,eq=QUEUED|eq=COOKING|eq=READY|eq=DELIVERED|eq=VOIDED"`
+
+	// Void_reason explains why the item was voided, by Voided_by at Voided_at (set by the server)
+	Void_reason *string    `json:"void_reason"`
+	Voided_by   *string    `json:"voided_by"`
+	Voided_at   *time.Time `json:"voided_at"`
+
+	// Weight is the measured weight of an item sold by weight, in Weight_unit. It can be sent in any
+	// weight unit and is stored in the food's unit of measure; Unit_price is then calculated from it
+	Weight      *float64 `json:"weight" validate:"omitempty,gt=0"`
+	Weight_unit *string  `json:"weight_unit" validate:"omitempty,eq=KG|eq=G|eq=LB|eq=OZ"`
+
+	// Weight_source is SCALE when the weight was sent by a paired scale, MANUAL when entered by staff
+	Weight_source *string `json:"weight_source"`
+
+	// Scale_device_id is the paired scale that measured the weight
+	Scale_device_id *string `json:"scale_device_id"`
+
+	// Options are the options chosen from the food's option groups
+	// Their prices are set by the server and included in Unit_price
+	Options []OrderItemOption `json:"options" validate:"omitempty,max=50,dive"`
+}
+
+// OrderItemOption is an option chosen for an order item, as it was when ordered
+type OrderItemOption struct {
+	// Group is the name of the food's option group (required)
+	Group string `json:"group" validate:"required"`
+
+	// Option is the name of the chosen option (required)
+	Option string `json:"option" validate:"required"`
+
+	// Price is the option's surcharge
+	Price Money `json:"price"`
 }
@@ -30,4 +30,88 @@ type Order struct {
 	// Table_id is the reference to the table where this order was placed (required)
 	// This creates a relationship between orders and restaurant tables
 	Table_id *string `json:"table_id" validate:"required"`
+
+	// Channel is how the order was placed (defaults to DINE_IN)
+	// Third-party channels may charge a commission configured in the settings
+	Channel *string `json:"channel" validate:"omitempty,eq=DINE_IN|eq=TAKEAWAY|eq=DELIVERY|eq=ONLINE|eq=PHONE"`
+
+	// Status is the overall fulfillment state derived from the order's items
+	// One of QUEUED, PREPARING, PARTIALLY_READY, READY, DELIVERED or VOIDED
+	Status *string `json:"status"`
+
+	// Status_changed_at is when the order last moved to its current Status
+	Status_changed_at *time.Time `json:"status_changed_at"`
+
+	// Check_presented_at is set when the check is presented to the table, which then waits to pay
+	Check_presented_at *time.Time `json:"check_presented_at"`
+
+	// Delivery_eta is the time a DELIVERY order was promised to arrive at the customer (optional)
+	Delivery_eta *time.Time `json:"delivery_eta"`
+
+	// Escalations lists the escalation rules (e.g. DELIVERY_LATE) managers were already alerted about
+	Escalations []string `json:"escalations"`
+
+	// Closed_at is set when the order is closed (paid, closed manually or auto-closed as stale)
+	// Orders with no Closed_at are considered open
+	Closed_at *time.Time `json:"closed_at"`
+
+	// Close_reason records why the order was closed: PAID, MANUAL or STALE
+	Close_reason *string `json:"close_reason"`
+
+	// Stale_flagged_at is set by the stale order job when an order has been open too long
+	Stale_flagged_at *time.Time `json:"stale_flagged_at"`
+
+	// Location_id is the restaurant location the order was placed at (optional for single-site setups)
+	Location_id *string `json:"location_id"`
+
+	// Order_number is the short customer-facing number (e.g. 47) printed on receipts and shown
+	// on the KDS and pickup screen; it restarts every business day and is unique per location and day
+	Order_number int `json:"order_number"`
+
+	// Business_date is the business day (YYYY-MM-DD) the order number belongs to
+	Business_date string `json:"business_date"`
+
+	// Reservation_id is the reservation the guests were seated for (optional); its deposit is credited
+	// on the order's invoice
+	Reservation_id *string `json:"reservation_id"`
+
+	// Session_id groups the orders placed by one party at a table (e.g. several rounds of drinks),
+	// so they can be billed on a single invoice; orders at a table with open orders join their session
+	Session_id *string `json:"session_id"`
+
+	// Server_id is the user id of the server looking after a dine-in order (optional); when not given,
+	// it is the server of the party seated at the table or the next server in the section's rotation
+	Server_id *string `json:"server_id"`
+
+	// Customer_name and Customer_phone identify the guest for orders placed remotely (e.g. by phone)
+	Customer_name  *string `json:"customer_name"`
+	Customer_phone *string `json:"customer_phone"`
+
+	// Customer_email is where invoices and receipts for the order are emailed (optional)
+	Customer_email *string `json:"customer_email" validate:"omitempty,email"`
+
+	// Customer_id links the order to a customer profile, for the customer's visits and spend (optional)
+	Customer_id *string `json:"customer_id"`
+
+	// External_reference is "<provider>:<provider order id>" for orders created by an ordering provider
+	// It is unique, so a provider retrying a request does not create the order twice
+	External_reference *string `json:"external_reference"`
+
+	// Billing_mode is A_LA_CARTE (default: every item is charged at its price) or BUFFET
+	// (a fixed price per guest from the Buffet_plan, plus any à la carte extras)
+	Billing_mode *string `json:"billing_mode" validate:"omitempty,eq=A_LA_CARTE|eq=BUFFET"`
+
+	// Buffet_plan is the code of the settings' buffet plan a BUFFET order is billed with
+	Buffet_plan *string `json:"buffet_plan"`
+
+	// Buffet_guests is the number of guests charged per price tier; when not given, every guest
+	// seated at the table (Table.Number_of_guests) is charged as an adult
+	Buffet_guests *BuffetGuests `json:"buffet_guests"`
+}
+
+// BuffetGuests counts the guests of a buffet order per price tier
+type BuffetGuests struct {
+	Adults   int `json:"adults" validate:"min=0"`
+	Children int `json:"children" validate:"min=0"`
+	Seniors  int `json:"seniors" validate:"min=0"`
 }
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OrderRevision is one entry in the edit history of an order
+// This struct defines the structure of order revision documents stored in MongoDB
+// Revisions are append-only: they are written whenever an order or one of its items changes
+type OrderRevision struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the revision document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Revision_id is the string representation of the MongoDB ObjectID
+	Revision_id string `json:"revision_id"`
+
+	// Order_id is the order this revision belongs to
+	Order_id string `json:"order_id"`
+
+	// Order_item_id is set when the change concerns a single order item
+	Order_item_id *string `json:"order_item_id"`
+
+	// Action describes the change, e.g. ORDER_CREATED, ORDER_UPDATED, ORDER_CLOSED,
+	// ITEM_ADDED, ITEM_REMOVED, ITEM_UPDATED, PRICE_CHANGED, STATUS_CHANGED, ITEM_VOIDED or INVOICE_VOIDED
+	Action string `json:"action"`
+
+	// Field is the name of the changed field, for field-level changes
+	Field *string `json:"field"`
+
+	// Old_value is the value before the change
+	Old_value interface{} `json:"old_value"`
+
+	// New_value is the value after the change
+	New_value interface{} `json:"new_value"`
+
+	// Changed_by is the user_id of the staff member who made the change, or "system" for jobs
+	Changed_by string `json:"changed_by"`
+
+	// Created_at is the timestamp when the change was made
+	Created_at time.Time `json:"created_at"`
+}
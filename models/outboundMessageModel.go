@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OutboundMessage is a message to a guest waiting to be delivered by SMS or email
+// This struct defines the structure of outbound message documents stored in MongoDB
+// Messages are queued by the application and handed to the delivery provider
+type OutboundMessage struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the message document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Message_id is the string representation of the MongoDB ObjectID
+	Message_id string `json:"message_id"`
+
+	// Channel is the delivery channel: SMS or EMAIL
+	Channel string `json:"channel"`
+
+	// To is the phone number or email address of the recipient
+	To string `json:"to"`
+
+	// Subject is the email subject (unused for SMS)
+	Subject string `json:"subject"`
+
+	// Body is the message text
+	Body string `json:"body"`
+
+	// Html is the HTML version of an email, sent alongside the text body (optional)
+	Html string `json:"html"`
+
+	// Type is a machine readable message name, e.g. RESERVATION_REMINDER
+	Type string `json:"type"`
+
+	// Reference_id points at the document the message is about
+	Reference_id string `json:"reference_id"`
+
+	// Status is QUEUED until the message is handed to the provider (SENDING), then SENT, and
+	// DELIVERED or FAILED once the provider reports the outcome
+	Status string `json:"status"`
+
+	// Created_at is the timestamp when the message was queued
+	Created_at time.Time `json:"created_at"`
+
+	// Sent_at is the timestamp when the message was handed to the provider
+	Sent_at *time.Time `json:"sent_at"`
+
+	// Provider is the provider the message was sent with (e.g. twilio) and Provider_message_id its
+	// id there, which delivery status callbacks refer to
+	Provider            *string `json:"provider"`
+	Provider_message_id *string `json:"provider_message_id"`
+
+	// Attempts counts the times the message was handed to the provider; Error is the last failure
+	Attempts int     `json:"attempts"`
+	Error    *string `json:"error"`
+
+	// Next_attempt_at is when a message that failed to send is retried
+	Next_attempt_at *time.Time `json:"next_attempt_at"`
+
+	// Template is the email template the message was rendered from (e.g. welcome, invoice)
+	Template *string `json:"template"`
+
+	// Delivered_at is the timestamp when the provider reported the message delivered
+	Delivered_at *time.Time `json:"delivered_at"`
+
+	// Status_events lists the delivery statuses reported by the provider, in the order received
+	Status_events []MessageStatusEvent `json:"status_events"`
+}
+
+// MessageStatusEvent is a delivery status reported by the provider for a message
+type MessageStatusEvent struct {
+	// Status is the provider's status, e.g. sent, delivered, undelivered or failed
+	Status string `json:"status"`
+
+	// Error_code is the provider's error code for undelivered and failed messages
+	Error_code string `json:"error_code,omitempty"`
+
+	// Received_at is the timestamp when the status was received
+	Received_at time.Time `json:"received_at"`
+}
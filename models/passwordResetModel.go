@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PasswordReset is a request to reset a user's password, completed with the token emailed to the user
+// Only a hash of the token is stored; a token works once and expires
+type PasswordReset struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the reset document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Reset_id is the string representation of the MongoDB ObjectID
+	Reset_id string `json:"reset_id"`
+
+	// User_id is the user whose password is reset
+	User_id string `json:"user_id"`
+
+	// Token_hash is the SHA-256 of the token sent in the reset link
+	Token_hash string `json:"-"`
+
+	// Expires_at is when the token stops being accepted
+	Expires_at time.Time `json:"expires_at"`
+
+	// Used_at is set when the password was reset with the token, or when a later reset made it obsolete
+	Used_at *time.Time `json:"used_at"`
+
+	// Created_at is the timestamp when the reset was requested
+	Created_at time.Time `json:"created_at"`
+}
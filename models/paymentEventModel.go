@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PaymentEvent is a webhook event received from the payment provider
+// This struct defines the structure of payment event documents stored in MongoDB
+// Events are stored by their provider id so retried deliveries are processed only once
+type PaymentEvent struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the event document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Event_id is the provider's event id (unique)
+	Event_id string `json:"event_id"`
+
+	// Type is the provider event type, e.g. charge.succeeded or charge.refunded
+	Type string `json:"type"`
+
+	// Invoice_id is the invoice the event refers to, or Prepayment_id the reservation deposit
+	Invoice_id    string `json:"invoice_id"`
+	Prepayment_id string `json:"prepayment_id"`
+
+	// Payload is the raw event body as received
+	Payload string `json:"payload"`
+
+	// Status is RECEIVED while processing, then PROCESSED, IGNORED or FAILED
+	Status string `json:"status"`
+
+	// Error holds the processing error for FAILED events
+	Error *string `json:"error"`
+
+	// Received_at is the timestamp when the event was first received
+	Received_at time.Time `json:"received_at"`
+
+	// Processed_at is the timestamp when the event was processed
+	Processed_at *time.Time `json:"processed_at"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Prepayment is money a guest paid ahead of their visit, such as a reservation deposit
+// This struct defines the structure of prepayment documents stored in MongoDB
+// A prepayment is HELD until it is credited on an invoice (APPLIED), given back (REFUNDED)
+// or kept by the restaurant when the guest cancels late or does not show up (FORFEITED).
+// Deposits paid online are PENDING until the payment provider's charge succeeded, and CANCELLED
+// when the reservation ends before they were paid
+type Prepayment struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the prepayment document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Prepayment_id is the string representation of the MongoDB ObjectID
+	Prepayment_id string `json:"prepayment_id"`
+
+	// Reservation_id is the reservation the deposit secures
+	Reservation_id string `json:"reservation_id"`
+
+	// Amount is the amount prepaid
+	Amount Money `json:"amount"`
+
+	// Status is PENDING, HELD, APPLIED, REFUNDED, FORFEITED or CANCELLED
+	Status string `json:"status"`
+
+	// Payment_reference is the payment provider's charge id of a deposit paid online, paid at Paid_at
+	Payment_reference *string    `json:"payment_reference"`
+	Paid_at           *time.Time `json:"paid_at"`
+
+	// Invoice_id is the invoice the prepayment is credited on, and Applied_amount the amount credited;
+	// it is less than Amount when the invoice came to less than the deposit
+	Invoice_id     *string `json:"invoice_id"`
+	Applied_amount Money   `json:"applied_amount"`
+
+	// Refunded_amount is the amount given back to the guest, with the reason
+	Refunded_amount Money   `json:"refunded_amount"`
+	Refund_reason   *string `json:"refund_reason"`
+
+	// Fee_amount is the part of a FORFEITED deposit kept as the no-show or late cancellation fee; the
+	// rest of the deposit is refunded
+	Fee_amount Money `json:"fee_amount"`
+
+	// Settled_by is the user_id of the staff member who refunded or forfeited the prepayment ("system" for the policy)
+	Settled_by *string `json:"settled_by"`
+
+	Created_at time.Time  `json:"created_at"`
+	Applied_at *time.Time `json:"applied_at"`
+	Settled_at *time.Time `json:"settled_at"`
+	Updated_at time.Time  `json:"updated_at"`
+}
+
+// DepositPayment is a prepayment credited on an invoice
+type DepositPayment struct {
+	// Prepayment_id is the credited prepayment
+	Prepayment_id string `json:"prepayment_id"`
+
+	// Reservation_id is the reservation the deposit was paid for
+	Reservation_id string `json:"reservation_id"`
+
+	// Amount is the amount credited
+	Amount Money `json:"amount"`
+}
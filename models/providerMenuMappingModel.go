@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ProviderMenuMapping links an ordering provider's menu item id to one of our food items
+// This struct defines the structure of provider menu mapping documents stored in MongoDB
+// Phone/IVR/SMS ordering providers send their own item ids, which are translated with these mappings
+type ProviderMenuMapping struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the mapping document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Mapping_id is the string representation of the MongoDB ObjectID
+	Mapping_id string `json:"mapping_id"`
+
+	// Provider is the name of the ordering provider (required)
+	Provider *string `json:"provider" validate:"required,max=64"`
+
+	// Provider_item_id is the provider's id for the menu item (required, unique per provider)
+	Provider_item_id *string `json:"provider_item_id" validate:"required,max=128"`
+
+	// Food_id is the food item ordered when the provider item is sent (required)
+	Food_id *string `json:"food_id" validate:"required"`
+
+	// Quantity is the portion size used when the provider does not send one (S, M or L; default M)
+	Quantity *string `json:"quantity" validate:"omitempty,eq=S|eq=M|eq=L"`
+
+	// Created_at is the timestamp when the mapping was created
+	Created_at time.Time `json:"created_at"`
+
+	// Updated_at is the timestamp when the mapping was last modified
+	Updated_at time.Time `json:"updated_at"`
+}
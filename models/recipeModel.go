@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Recipe is the bill of materials of a food: the inventory items used to make one portion of it
+// This struct defines the structure of recipe documents stored in MongoDB
+// A food has at most one recipe; it is the basis for food costing and inventory depletion
+type Recipe struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the recipe document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Recipe_id is the string representation of the MongoDB ObjectID
+	Recipe_id string `json:"recipe_id"`
+
+	// Food_id is the food the recipe makes
+	Food_id string `json:"food_id"`
+
+	// Ingredients are the inventory items used for one portion (required, each item at most once)
+	Ingredients []RecipeIngredient `json:"ingredients" validate:"required,min=1,max=100,dive"`
+
+	// Updated_by is the user_id of the staff member who last changed the recipe
+	Updated_by string `json:"updated_by"`
+
+	// Created_at is the timestamp when the recipe was added
+	Created_at time.Time `json:"created_at"`
+
+	// Updated_at is the timestamp when the recipe was last changed
+	Updated_at time.Time `json:"updated_at"`
+}
+
+// RecipeIngredient is the quantity of an inventory item used for one portion of a food
+type RecipeIngredient struct {
+	// Inventory_item_id is the inventory item used (required)
+	Inventory_item_id *string `json:"inventory_item_id" validate:"required"`
+
+	// Quantity is the amount used, in the inventory item's unit (required)
+	Quantity *float64 `json:"quantity" validate:"required,gt=0"`
+}
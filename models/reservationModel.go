@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Reservation represents a table booking made by a guest
+// This struct defines the structure of reservation documents stored in MongoDB
+// Reservations are BOOKED until the guest confirms them from a reminder link
+type Reservation struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the reservation document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Reservation_id is the string representation of the MongoDB ObjectID
+	// Used for easier referencing in other collections and API responses
+	Reservation_id string `json:"reservation_id"`
+
+	// Customer_name is the name the booking is under (required)
+	Customer_name *string `json:"customer_name" validate:"required,min=2,max=100"`
+
+	// Customer_phone is used for SMS reminders (required)
+	Customer_phone *string `json:"customer_phone" validate:"required"`
+
+	// Customer_email is used for email reminders (optional)
+	Customer_email *string `json:"customer_email" validate:"omitempty,email"`
+
+	// Party_size is the number of guests (required)
+	Party_size *int `json:"party_size" validate:"required,min=1"`
+
+	// Reservation_time is when the guests are expected (required)
+	Reservation_time *time.Time `json:"reservation_time" validate:"required"`
+
+	// Table_id is the table assigned to the reservation (optional)
+	Table_id *string `json:"table_id"`
+
+	// Status is the reservation's state
+	// BOOKED, CONFIRMED, CANCELLED, RELEASED (unconfirmed after the grace period), SEATED or NO_SHOW
+	Status *string `json:"status" validate:"omitempty,eq=BOOKED|eq=CONFIRMED|eq=CANCELLED|eq=RELEASED|eq=SEATED|eq=NO_SHOW"`
+
+	// Confirmation_token is the secret used in the guest's one-tap confirm/cancel links
+	Confirmation_token string `json:"-"`
+
+	// Deposit is the amount the guest prepaid to secure the booking (optional). A prepayment is recorded
+	// for it when the reservation is made and credited on the invoice of the reservation's order
+	Deposit *Money `json:"deposit" validate:"omitempty,gt=0"`
+
+	// Deposit_method is how the deposit is paid: IN_PERSON (default), when it was taken by staff, or ONLINE,
+	// when the guest pays it through the payment provider and the prepayment is PENDING until the charge succeeds
+	Deposit_method *string `json:"deposit_method" validate:"omitempty,eq=IN_PERSON|eq=ONLINE"`
+
+	// Prepayment_id is the prepayment recorded for the deposit
+	Prepayment_id *string `json:"prepayment_id"`
+
+	// Notes are special requests from the guest (optional)
+	Notes *string `json:"notes"`
+
+	// Reminder_24h_sent_at is set when the day-before reminder was sent
+	Reminder_24h_sent_at *time.Time `json:"reminder_24h_sent_at"`
+
+	// Reminder_2h_sent_at is set when the two-hours-before reminder was sent
+	Reminder_2h_sent_at *time.Time `json:"reminder_2h_sent_at"`
+
+	// Confirmed_at is set when the guest confirmed the reservation
+	Confirmed_at *time.Time `json:"confirmed_at"`
+
+	// No_show_at is set when the reservation was marked NO_SHOW automatically, once the guests were
+	// still not seated after the no-show grace period
+	No_show_at *time.Time `json:"no_show_at"`
+
+	// Created_at is the timestamp when the reservation was made
+	Created_at time.Time `json:"created_at"`
+
+	// Updated_at is the timestamp when the reservation was last modified
+	Updated_at time.Time `json:"updated_at"`
+}
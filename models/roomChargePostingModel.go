@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RoomChargePosting is an invoice charged to a hotel guest's room folio through the hotel PMS
+type RoomChargePosting struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the posting document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Posting_id is the string representation of the MongoDB ObjectID, sent to the PMS as the
+	// idempotency key so a retried posting is never charged twice
+	Posting_id string `json:"posting_id"`
+
+	// Invoice_id and Invoice_number identify the charged invoice
+	Invoice_id     string `json:"invoice_id"`
+	Invoice_number string `json:"invoice_number"`
+
+	// Room_number is the guest's room (required)
+	Room_number string `json:"room_number" validate:"required,max=20"`
+
+	// Guest_name is checked by the PMS against the room's registered guest (optional)
+	Guest_name *string `json:"guest_name" validate:"omitempty,max=100"`
+
+	// Folio_reference is the guest folio the charge is posted to; sent by staff or returned by the PMS
+	Folio_reference *string `json:"folio_reference" validate:"omitempty,max=64"`
+
+	// Amount is the amount charged to the room
+	Amount Money `json:"amount"`
+
+	// Status is PENDING (sent, waiting for the PMS), POSTED (acknowledged), REJECTED (refused by
+	// the PMS, e.g. the guest has checked out), FAILED (the PMS could not be reached; can be retried)
+	// or CANCELLED (a failed posting staff gave up on)
+	Status string `json:"status"`
+
+	// Pms_reference is the PMS's id for the posted charge, from its acknowledgment
+	Pms_reference *string `json:"pms_reference"`
+
+	// Error is the PMS's rejection reason or the last delivery error
+	Error *string `json:"error"`
+
+	// Attempts counts how many times the posting was sent
+	Attempts int `json:"attempts"`
+
+	// Posted_by is the user_id of the staff member who charged the room
+	Posted_by string `json:"posted_by"`
+
+	// Created_at is when the room charge was requested
+	Created_at time.Time `json:"created_at"`
+
+	// Updated_at is when the posting last changed
+	Updated_at time.Time `json:"updated_at"`
+
+	// Acknowledged_at is when the PMS confirmed or rejected the posting
+	Acknowledged_at *time.Time `json:"acknowledged_at"`
+}
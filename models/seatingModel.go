@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Seating records a party seated at a table, from the moment the table was SEATED until it was cleared
+// This struct defines the structure of seating documents stored in MongoDB
+// Seatings are recorded automatically and tell how many covers each server took
+type Seating struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the seating document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Seating_id is the string representation of the MongoDB ObjectID
+	Seating_id string `json:"seating_id"`
+
+	// Table_id and Table_number are the table the party was seated at
+	Table_id     string `json:"table_id"`
+	Table_number *int   `json:"table_number"`
+
+	// Section is the table's section when the party was seated
+	Section *string `json:"section"`
+
+	// Server_id is the server looking after the party, if any
+	Server_id *string `json:"server_id"`
+
+	// Guests is the party size (covers)
+	Guests int `json:"guests"`
+
+	// Session_id is the table session of the party's orders, set once the party ordered
+	Session_id *string `json:"session_id"`
+
+	// Source is how the party was seated: ORDER, WAITLIST or MANUAL
+	Source string `json:"source"`
+
+	// Party_source is WALK_IN, or RESERVATION once an order for Reservation_id was placed at the table
+	Party_source   string  `json:"party_source"`
+	Reservation_id *string `json:"reservation_id"`
+
+	// Seated_at is the timestamp when the party was seated
+	Seated_at time.Time `json:"seated_at"`
+
+	// Cleared_at is set when the party left and the table was cleared
+	Cleared_at *time.Time `json:"cleared_at"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SectionAssignment puts a server in charge of a section of the floor for a shift
+// This struct defines the structure of section assignment documents stored in MongoDB
+// Parties seated in the section during the shift are shared among its servers by covers
+type SectionAssignment struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the assignment document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Section_assignment_id is the string representation of the MongoDB ObjectID
+	Section_assignment_id string `json:"section_assignment_id"`
+
+	// Server_id is the user id of the server (required)
+	Server_id *string `json:"server_id" validate:"required"`
+
+	// Server_name is the server's name, copied from the user when the assignment is made
+	Server_name string `json:"server_name"`
+
+	// Section is the section the server works, as set on the tables (required)
+	Section *string `json:"section" validate:"required,max=50"`
+
+	// Shift is a label for the shift, e.g. "DINNER" (optional)
+	Shift *string `json:"shift" validate:"omitempty,max=30"`
+
+	// Starts_at and Ends_at are when the shift starts and ends (required)
+	Starts_at *time.Time `json:"starts_at" validate:"required"`
+	Ends_at   *time.Time `json:"ends_at" validate:"required"`
+
+	// Created_by is the user id of the manager who made the assignment
+	Created_by string `json:"created_by"`
+
+	// Created_at is the timestamp when the assignment was made
+	Created_at time.Time `json:"created_at"`
+}
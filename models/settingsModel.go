@@ -0,0 +1,249 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Settings holds restaurant-wide configuration
+// This struct defines the structure of the single settings document stored in MongoDB
+// Values not set fall back to application defaults
+type Settings struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the settings document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Settings_id identifies the settings document; there is a single "default" document
+	Settings_id string `json:"settings_id"`
+
+	// Channel_commissions maps an order channel (DELIVERY, ONLINE, ...) to the commission
+	// rate charged by that channel, as a fraction of the order's net revenue (0.15 = 15%)
+	Channel_commissions map[string]float64 `json:"channel_commissions"`
+
+	// Tax_rates are the taxes applied to items without a tax class and to buffet charges,
+	// e.g. CGST 0.025 and SGST 0.025
+	Tax_rates []TaxRate `json:"tax_rates" validate:"omitempty,dive"`
+
+	// Tax_classes are the tax treatments foods can be assigned to, e.g. FOOD at 5% and ALCOHOL at 18%
+	Tax_classes []TaxClass `json:"tax_classes" validate:"omitempty,dive"`
+
+	// Tax_mode is EXCLUSIVE (default: taxes are added on top of prices) or INCLUSIVE
+	// (prices already include their taxes, which are broken out of them on invoices)
+	Tax_mode *string `json:"tax_mode" validate:"omitempty,eq=EXCLUSIVE|eq=INCLUSIVE"`
+
+	// Service_charge_rate is the service charge added to invoices as a fraction of the subtotal.
+	// It applies to every invoice when no Service_charge_rules are configured
+	Service_charge_rate *float64 `json:"service_charge_rate" validate:"omitempty,min=0,max=1"`
+
+	// Service_charge_rules add service charges to the invoices they apply to, each as its own line
+	Service_charge_rules []ServiceChargeRule `json:"service_charge_rules" validate:"omitempty,dive"`
+
+	// Business_day_start_hour is the local hour at which a new business day begins (default 4),
+	// so orders placed after midnight still count towards the previous night's service
+	Business_day_start_hour *int `json:"business_day_start_hour" validate:"omitempty,min=0,max=23"`
+
+	// Order_number_start is the first order number handed out each business day (default 1)
+	Order_number_start *int `json:"order_number_start" validate:"omitempty,min=1,max=100000"`
+
+	// Invoice_number_prefix starts every invoice number (default INV, giving INV-2024-000123)
+	Invoice_number_prefix *string `json:"invoice_number_prefix" validate:"omitempty,min=1,max=10,alphanum"`
+
+	// Pii_full_access_roles are the staff roles that see customer and staff personal data unmasked
+	// (default ADMIN and MANAGER); all other callers get masked values
+	Pii_full_access_roles []string `json:"pii_full_access_roles" validate:"omitempty,dive,eq=ADMIN|eq=MANAGER|eq=WAITER|eq=KITCHEN|eq=HOST"`
+
+	// Pii_field_rules overrides how a response field is masked: PHONE, EMAIL, NAME, CONTACT, OMIT,
+	// SECRET (removed for everyone) or NONE (never masked)
+	Pii_field_rules map[string]string `json:"pii_field_rules" validate:"omitempty,dive,eq=PHONE|eq=EMAIL|eq=NAME|eq=CONTACT|eq=OMIT|eq=SECRET|eq=NONE"`
+
+	// Currency is the ISO 4217 code all amounts are expressed in (default USD). Amounts are
+	// stored in the currency's minor units, so it should be chosen before any prices are entered
+	Currency *string `json:"currency" validate:"omitempty,len=3,uppercase,alpha"`
+
+	// Locale controls how amounts are formatted for display, e.g. en-US (1,234.50) or
+	// de-DE (1.234,50); defaults to en-US
+	Locale *string `json:"locale" validate:"omitempty,min=2,max=10"`
+
+	// Buffet_plans are the fixed-price per-head offers (e.g. lunch buffet) orders can be billed with
+	Buffet_plans []BuffetPlan `json:"buffet_plans" validate:"omitempty,dive"`
+
+	// Payment_methods are the ways invoices can be paid at the restaurant (default CARD and CASH).
+	// GIFT_CARD and ROOM_CHARGE are recorded by their own endpoints and are always available
+	Payment_methods []PaymentMethod `json:"payment_methods" validate:"omitempty,dive"`
+
+	// Overdue_reminders is how reminders about unpaid invoices past their due date are sent
+	Overdue_reminders *OverdueReminders `json:"overdue_reminders"`
+
+	// Escalation_rules alert managers when an order is held up; each rule type can be listed once
+	Escalation_rules []EscalationRule `json:"escalation_rules" validate:"omitempty,dive"`
+
+	// Deposit_policy is when the deposit of a cancelled reservation is refunded
+	Deposit_policy *DepositPolicy `json:"deposit_policy"`
+
+	// Reservation_slots are the times guests can book, offered by the availability search
+	Reservation_slots *ReservationSlots `json:"reservation_slots"`
+
+	// Service_periods split the business day for covers reporting (default LUNCH from 04:00 to 16:00
+	// and DINNER from 16:00 to 04:00)
+	Service_periods []ServicePeriod `json:"service_periods" validate:"omitempty,max=10,dive"`
+
+	// Min_food_margin_percent is the gross margin foods should make on their price (default 60); managers
+	// are alerted when an ingredient cost change takes a food below it
+	Min_food_margin_percent *float64 `json:"min_food_margin_percent" validate:"omitempty,min=0,max=100"`
+
+	// Created_at is the timestamp when the settings were first saved
+	Created_at time.Time `json:"created_at"`
+
+	// Updated_at is the timestamp when the settings were last modified
+	Updated_at time.Time `json:"updated_at"`
+}
+
+// TaxRate is a named tax applied to invoice subtotals
+type TaxRate struct {
+	// Name is the tax's label printed on invoices (e.g. "VAT", "CGST")
+	Name string `json:"name" validate:"required"`
+
+	// Rate is the tax rate as a fraction (0.05 = 5%)
+	Rate float64 `json:"rate" validate:"min=0,max=1"`
+}
+
+// TaxClass is a set of tax rates applied to the foods assigned to it
+type TaxClass struct {
+	// Code identifies the class on foods (e.g. "ALCOHOL")
+	Code string `json:"code" validate:"required,max=30,uppercase,excludesall=0x20"`
+
+	// Name is the class's label (e.g. "Alcoholic beverages")
+	Name string `json:"name" validate:"required,max=100"`
+
+	// Rates are the taxes charged on the class's foods; an empty list makes them tax exempt
+	Rates []TaxRate `json:"rates" validate:"omitempty,dive"`
+}
+
+// BuffetPlan is a fixed price per guest, with optional child and senior prices
+type BuffetPlan struct {
+	// Code identifies the plan on orders (e.g. "LUNCH")
+	Code string `json:"code" validate:"required,max=20,alphanum"`
+
+	// Name is the plan's label printed on invoices (e.g. "Lunch buffet")
+	Name string `json:"name" validate:"required,max=100"`
+
+	// Adult_price is charged per adult guest
+	Adult_price Money `json:"adult_price" validate:"min=0"`
+
+	// Child_price and Senior_price are charged per child and senior guest (default: the adult price)
+	Child_price  *Money `json:"child_price" validate:"omitempty,min=0"`
+	Senior_price *Money `json:"senior_price" validate:"omitempty,min=0"`
+
+	// Included_menu_ids are the menus served as part of the buffet; their foods are not charged.
+	// Anything else ordered is billed as an à la carte extra at its own price
+	Included_menu_ids []string `json:"included_menu_ids"`
+}
+
+// ServiceChargeRule is a service charge added automatically to the invoices it applies to
+type ServiceChargeRule struct {
+	// Name is the label of the invoice line (e.g. "Service charge for parties of 6 or more")
+	Name string `json:"name" validate:"required,max=50"`
+
+	// Rate is the service charge as a fraction of the subtotal after discounts (0.10 = 10%)
+	Rate float64 `json:"rate" validate:"gt=0,max=1"`
+
+	// Min_guests limits the rule to parties of at least this many guests (0 for any party)
+	Min_guests int `json:"min_guests" validate:"min=0,max=1000"`
+
+	// Channels limits the rule to orders placed through these channels (default every channel)
+	Channels []string `json:"channels" validate:"omitempty,dive,eq=DINE_IN|eq=TAKEAWAY|eq=DELIVERY|eq=ONLINE|eq=PHONE"`
+
+	// Disabled turns the rule off without losing its configuration
+	Disabled bool `json:"disabled"`
+}
+
+// EscalationRule alerts managers when an order has been waiting longer than a threshold
+type EscalationRule struct {
+	// Type is what is being waited for:
+	// ORDER_PREPARING - the order has been PREPARING for Threshold_minutes
+	// CHECK_WAITING - the table has not paid Threshold_minutes after its check was presented
+	// DELIVERY_LATE - a delivery order is Threshold_minutes past its Delivery_eta
+	Type string `json:"type" validate:"required,eq=ORDER_PREPARING|eq=CHECK_WAITING|eq=DELIVERY_LATE"`
+
+	// Threshold_minutes is how long to wait before alerting (0 for DELIVERY_LATE alerts as soon as the ETA passes)
+	Threshold_minutes int `json:"threshold_minutes" validate:"min=0,max=1440"`
+
+	// Channels are where the alert is sent: PUSH (manager notifications) and/or SLACK (default PUSH)
+	Channels []string `json:"channels" validate:"omitempty,dive,eq=PUSH|eq=SLACK"`
+
+	// Disabled turns the rule off without losing its threshold
+	Disabled bool `json:"disabled"`
+}
+
+// PaymentMethod is a way of paying invoices, e.g. a UPI rail, a wallet or a house account
+type PaymentMethod struct {
+	// Code is recorded on invoices as their payment method (e.g. "UPI", "PAYTM")
+	Code string `json:"code" validate:"required,max=30,uppercase,excludesall=0x20"`
+
+	// Name is the method's label shown on the POS and on receipts (e.g. "UPI")
+	Name string `json:"name" validate:"required,max=100"`
+
+	// Type is the kind of payment rail: CARD, CASH, UPI, WALLET, ONLINE, HOUSE_ACCOUNT or OTHER
+	Type string `json:"type" validate:"required,eq=CARD|eq=CASH|eq=UPI|eq=WALLET|eq=ONLINE|eq=HOUSE_ACCOUNT|eq=OTHER"`
+
+	// Required_details are the payment details that must be recorded with this method:
+	// transaction_id, card_last_four, provider and/or account_reference
+	Required_details []string `json:"required_details" validate:"omitempty,dive,eq=transaction_id|eq=card_last_four|eq=provider|eq=account_reference"`
+
+	// Disabled methods can no longer be chosen, but stay valid on invoices already paid with them
+	Disabled bool `json:"disabled"`
+}
+
+// OverdueReminders configures the reminders sent about overdue invoices
+type OverdueReminders struct {
+	// Interval_hours is the time between two reminders about the same invoice (default 24)
+	Interval_hours int `json:"interval_hours" validate:"omitempty,min=1,max=720"`
+
+	// Max_reminders is how many reminders are sent at most per invoice (default 3, 0 for none)
+	Max_reminders *int `json:"max_reminders" validate:"omitempty,min=0,max=50"`
+
+	// Recipients are MANAGERS (a notification) and/or CUSTOMER (an email or SMS to the guest); default MANAGERS
+	Recipients []string `json:"recipients" validate:"omitempty,dive,eq=MANAGERS|eq=CUSTOMER"`
+}
+
+// DepositPolicy configures the refund of reservation deposits
+type DepositPolicy struct {
+	// Refund_cutoff_hours is how long before the reservation time a guest can cancel and still get
+	// the deposit back (default 24); later cancellations and no-shows forfeit it
+	Refund_cutoff_hours *int `json:"refund_cutoff_hours" validate:"omitempty,min=0,max=720"`
+
+	// No_show_fee_percent and Late_cancellation_fee_percent are the shares of the deposit kept as a fee
+	// (default 100, the whole deposit); the rest is refunded, all of it with 0
+	No_show_fee_percent           *int `json:"no_show_fee_percent" validate:"omitempty,min=0,max=100"`
+	Late_cancellation_fee_percent *int `json:"late_cancellation_fee_percent" validate:"omitempty,min=0,max=100"`
+}
+
+// ReservationSlots configures the reservation times offered to guests
+type ReservationSlots struct {
+	// Seatings are the daily windows reservations can start in, e.g. 12:00 to 14:30 and 18:00 to 21:30
+	// (default 12:00 to 21:00 every day); the last slot starts before End
+	Seatings []MenuDaypart `json:"seatings" validate:"omitempty,max=10,dive"`
+
+	// Interval_minutes is the time between two slots (default 15)
+	Interval_minutes *int `json:"interval_minutes" validate:"omitempty,min=5,max=120"`
+
+	// Turn_times are how long parties keep their table, by party size (default TABLE_TURN_MINUTES)
+	Turn_times []ReservationTurnTime `json:"turn_times" validate:"omitempty,max=20,dive"`
+}
+
+// ReservationTurnTime is how long a party of up to Max_party_size guests keeps its table
+type ReservationTurnTime struct {
+	Max_party_size int `json:"max_party_size" validate:"required,min=1"`
+	Minutes        int `json:"minutes" validate:"required,min=15,max=600"`
+}
+
+// ServicePeriod is a named part of the business day, such as lunch or dinner, in local time
+type ServicePeriod struct {
+	// Name labels the period in reports (e.g. "LUNCH")
+	Name string `json:"name" validate:"required,max=30"`
+
+	// Start and End are the local times (HH:MM) the period begins and ends; a period whose End is
+	// before its Start runs past midnight
+	Start string `json:"start" validate:"required,datetime=15:04"`
+	End   string `json:"end" validate:"required,datetime=15:04,nefield=Start"`
+}
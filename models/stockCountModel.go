@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StockCount is a physical count of inventory items, e.g. at the end of a week
+// This struct defines the structure of stock count documents stored in MongoDB
+// Closing the count posts an ADJUSTMENT movement for every counted item that differs from the ledger
+type StockCount struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the stock count document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Stock_count_id is the string representation of the MongoDB ObjectID
+	Stock_count_id string `json:"stock_count_id"`
+
+	// Status is OPEN while items are being counted and CLOSED once the adjustments are posted
+	Status string `json:"status"`
+
+	// Location_id is the restaurant location counted (optional for single-site setups)
+	Location_id *string `json:"location_id"`
+
+	// Note describes the count, e.g. "Weekly count, dry store" (optional)
+	Note *string `json:"note"`
+
+	// Lines are the items to count, one per inventory item
+	Lines []StockCountLine `json:"lines"`
+
+	// Shrinkage_value is the cost of the stock found missing, Surplus_value that of the stock found in
+	// excess; both are set when the count is closed
+	Shrinkage_value float64 `json:"shrinkage_value"`
+	Surplus_value   float64 `json:"surplus_value"`
+
+	// Opened_by and Closed_by are the user_ids of the staff members who opened and closed the count
+	Opened_by string  `json:"opened_by"`
+	Closed_by *string `json:"closed_by"`
+
+	// Opened_at is the timestamp when the count was opened
+	Opened_at time.Time `json:"opened_at"`
+
+	// Closed_at is the timestamp when the count was closed
+	Closed_at *time.Time `json:"closed_at"`
+}
+
+// StockCountLine is the count of one inventory item
+type StockCountLine struct {
+	// Inventory_item_id is the inventory item counted
+	Inventory_item_id string `json:"inventory_item_id"`
+
+	// Name and Unit are the inventory item's, as they were when the count was opened
+	Name string `json:"name"`
+	Unit string `json:"unit"`
+
+	// Counted_quantity is the quantity found, in the item's unit; nil until the item is counted
+	Counted_quantity *float64 `json:"counted_quantity"`
+
+	// Expected_quantity is the on-hand quantity of the ledger when the item was counted
+	Expected_quantity *float64 `json:"expected_quantity"`
+
+	// Variance is the counted minus the expected quantity, Variance_value its cost at the item's unit cost
+	Variance       *float64 `json:"variance"`
+	Variance_value *float64 `json:"variance_value"`
+
+	// Counted_by is the user_id of the staff member who counted the item
+	Counted_by *string `json:"counted_by"`
+
+	// Counted_at is the timestamp when the item was counted
+	Counted_at *time.Time `json:"counted_at"`
+
+	// Movement_id is the ADJUSTMENT posted for the variance when the count was closed
+	Movement_id *string `json:"movement_id"`
+}
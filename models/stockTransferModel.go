@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StockTransfer moves inventory from one restaurant location to another
+// This struct defines the structure of stock transfer documents stored in MongoDB
+// The stock leaves the sending location when the transfer is created and reaches the receiving location
+// when it is received; in between it is IN_TRANSIT and counts at neither location
+type StockTransfer struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the stock transfer document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Stock_transfer_id is the string representation of the MongoDB ObjectID
+	Stock_transfer_id string `json:"stock_transfer_id"`
+
+	// From_location_id and To_location_id are the sending and receiving locations (required, different)
+	From_location_id *string `json:"from_location_id" validate:"required"`
+	To_location_id   *string `json:"to_location_id" validate:"required,nefield=From_location_id"`
+
+	// Lines are the inventory items sent (required, each item at most once)
+	Lines []StockTransferLine `json:"lines" validate:"required,min=1,max=200,dive"`
+
+	// Note is shown to the receiving location, e.g. "For Saturday's event" (optional)
+	Note *string `json:"note" validate:"omitempty,max=200"`
+
+	// Status is IN_TRANSIT until the transfer is RECEIVED or CANCELLED
+	Status string `json:"status"`
+
+	// Created_by, Received_by and Cancelled_by are the user_ids of the staff members who sent, received
+	// and cancelled the transfer
+	Created_by   string  `json:"created_by"`
+	Received_by  *string `json:"received_by"`
+	Cancelled_by *string `json:"cancelled_by"`
+
+	// Created_at is the timestamp when the stock was sent
+	Created_at time.Time `json:"created_at"`
+
+	// Received_at is the timestamp when the receiving location confirmed the delivery
+	Received_at *time.Time `json:"received_at"`
+
+	// Cancelled_at is the timestamp when the transfer was cancelled and the stock returned to the sender
+	Cancelled_at *time.Time `json:"cancelled_at"`
+}
+
+// StockTransferLine is the quantity of an inventory item sent in a transfer
+type StockTransferLine struct {
+	// Inventory_item_id is the inventory item sent (required)
+	Inventory_item_id *string `json:"inventory_item_id" validate:"required"`
+
+	// Quantity is the quantity sent, in the item's unit (required)
+	Quantity *float64 `json:"quantity" validate:"required,gt=0"`
+
+	// Received_quantity is the quantity that arrived; less than Quantity when some was lost or damaged
+	Received_quantity *float64 `json:"received_quantity"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Supplier is a company the restaurant buys inventory items from
+// This struct defines the structure of supplier documents stored in MongoDB
+// Its price list is used to suggest the cheapest supplier of an item when reordering
+type Supplier struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the supplier document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Supplier_id is the string representation of the MongoDB ObjectID
+	Supplier_id string `json:"supplier_id"`
+
+	// Name is the supplier's name (required, 2-100 characters)
+	// Vendor invoices are linked to the supplier whose name they carry
+	Name *string `json:"name" validate:"required,min=2,max=100"`
+
+	// Contacts are the people to order from or to call about deliveries (optional)
+	Contacts []SupplierContact `json:"contacts" validate:"omitempty,max=10,dive"`
+
+	// Payment_terms_days is the number of days the supplier gives to pay its invoices, 0 for cash on delivery
+	Payment_terms_days *int `json:"payment_terms_days" validate:"omitempty,min=0,max=180"`
+
+	// Lead_time_days is how many days the supplier takes to deliver an order (default 1)
+	Lead_time_days *int `json:"lead_time_days" validate:"omitempty,min=0,max=90"`
+
+	// Prices is the supplier's price list: what it charges per unit of each inventory item it sells
+	Prices []SupplierPrice `json:"prices" validate:"omitempty,max=500,dive"`
+
+	// Created_at is the timestamp when the supplier was added
+	Created_at time.Time `json:"created_at"`
+
+	// Updated_at is the timestamp when the supplier was last modified
+	Updated_at time.Time `json:"updated_at"`
+}
+
+// SupplierContact is a person at a supplier
+type SupplierContact struct {
+	// Name is the contact's name (required)
+	Name string `json:"name" validate:"required,max=100"`
+
+	// Role is what the contact handles, e.g. "orders" or "accounts" (optional)
+	Role *string `json:"role" validate:"omitempty,max=50"`
+
+	Email *string `json:"email" validate:"omitempty,email"`
+	Phone *string `json:"phone" validate:"omitempty,max=30"`
+}
+
+// SupplierPrice is the price a supplier charges for an inventory item
+type SupplierPrice struct {
+	// Inventory_item_id is the inventory item sold (required, each item at most once)
+	Inventory_item_id *string `json:"inventory_item_id" validate:"required"`
+
+	// Unit_cost is the price per unit of the inventory item's unit (required)
+	// Updated automatically when a vendor invoice of the supplier is applied
+	Unit_cost *float64 `json:"unit_cost" validate:"required,min=0"`
+
+	// Min_order_quantity is the smallest quantity the supplier delivers (optional)
+	Min_order_quantity *float64 `json:"min_order_quantity" validate:"omitempty,gt=0"`
+
+	// Updated_at is when the price was last set
+	Updated_at time.Time `json:"updated_at"`
+}
@@ -19,7 +19,17 @@ type Table struct {
 	
 	// Table_number is the unique table identifier used by restaurant staff (required)
 	// This is the physical table number displayed in the restaurant
-	Table_number *int `json:"table_number" validate:"required"`
+	Table_number *int `json:"table_number" validate:"required,min=1"`
+
+	// Location_id is the restaurant location the table is in (optional); table numbers are unique per location
+	Location_id *string `json:"location_id"`
+
+	// Active_table_number is the Table_number while the table is not deleted; a unique index makes sure
+	// two tables of a location never share a number. Combined tables reuse a number and have none
+	Active_table_number *int `json:"-"`
+
+	// Deleted_at is set when the table was retired; deleted tables are OUT_OF_SERVICE and left out of listings
+	Deleted_at *time.Time `json:"deleted_at"`
 	
 	// Created_at is the timestamp when the table record was created
 	Created_at time.Time `json:"created_at"`
@@ -30,4 +40,35 @@ type Table struct {
 	// Table_id is the string representation of the MongoDB ObjectID
 	// Used for easier referencing in other collections and API responses
 	Table_id string `json:"table_id"`
+
+	// Status is the table's floor state: AVAILABLE, SEATED, RESERVED, DIRTY or OUT_OF_SERVICE
+	// Tables are SEATED when a dine-in order is opened on them and DIRTY once their last open order is closed;
+	// tables saved before statuses existed are AVAILABLE
+	Status *string `json:"status" validate:"omitempty,eq=AVAILABLE|eq=SEATED|eq=RESERVED|eq=DIRTY|eq=OUT_OF_SERVICE"`
+
+	// Status_changed_at is the timestamp of the last status change
+	Status_changed_at *time.Time `json:"status_changed_at"`
+
+	// Section is the area of the floor the table is in, e.g. "PATIO" (optional)
+	Section *string `json:"section" validate:"omitempty,max=50"`
+
+	// Capacity is the most guests the table seats (optional), unlike Number_of_guests which is the party seated now
+	// Seatings, reservations and waitlist parties larger than the capacity are rejected
+	Capacity *int `json:"capacity" validate:"omitempty,min=1"`
+
+	// Combined_table_ids are the tables pushed together into this temporary table for a large party
+	// Temporary tables are created by combining tables and split back into them when the party leaves
+	Combined_table_ids []string `json:"combined_table_ids"`
+
+	// Combined_into is the temporary table this table is part of; orders placed on it go to that table
+	Combined_into *string `json:"combined_into"`
+
+	// Split_at is set when a temporary table was split back into its tables
+	Split_at *time.Time `json:"split_at"`
+
+	// Qr_code_secret is signed into the table's QR code link; replacing it invalidates printed codes
+	Qr_code_secret string `json:"-"`
+
+	// Qr_code_rotated_at is the timestamp when the table's QR code was last replaced
+	Qr_code_rotated_at *time.Time `json:"qr_code_rotated_at"`
 }
@@ -37,6 +37,10 @@ type User struct {
 	// This can be used for notifications and account verification
 	Phone *string `json:"phone" validate:"required"`
 	
+	// Role is the user's staff role, used for authorization (ADMIN, MANAGER, WAITER, KITCHEN or HOST)
+	// New accounts are created as WAITER; roles are changed by managers
+	Role *string `json:"role" validate:"omitempty,eq=ADMIN|eq=MANAGER|eq=WAITER|eq=KITCHEN|eq=HOST"`
+	
 	// Token is the JWT access token for authentication
 	// This is generated when the user logs in and used for API requests
 	Token *string `json:"token"`
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// VendorInvoice is a supplier invoice received from the external OCR service
+// This struct defines the structure of vendor invoice intake documents stored in MongoDB
+// Confidently matched lines are booked as inventory receipts; the rest wait in a review queue
+type VendorInvoice struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the intake document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Vendor_invoice_id is the string representation of the MongoDB ObjectID
+	Vendor_invoice_id string `json:"vendor_invoice_id"`
+
+	// Supplier_name is the supplier as read from the invoice (required)
+	Supplier_name *string `json:"supplier_name" validate:"required"`
+
+	// Supplier_id is the supplier the invoice is from; without it the invoice is linked to the supplier
+	// with the invoice's supplier name, if there is one
+	Supplier_id *string `json:"supplier_id"`
+
+	// Invoice_number is the supplier's own invoice number (required)
+	// Together with the supplier name it makes repeated submissions idempotent
+	Invoice_number *string `json:"invoice_number" validate:"required"`
+
+	// Invoice_date is the date printed on the supplier invoice
+	Invoice_date *time.Time `json:"invoice_date"`
+
+	// Lines are the parsed invoice lines (required, at least one)
+	Lines []VendorInvoiceLine `json:"lines" validate:"required,min=1,dive"`
+
+	// Status is PROCESSED when every line was applied or rejected, NEEDS_REVIEW otherwise
+	Status string `json:"status"`
+
+	// Created_at is the timestamp when the invoice was received
+	Created_at time.Time `json:"created_at"`
+
+	// Updated_at is the timestamp when the intake was last modified
+	Updated_at time.Time `json:"updated_at"`
+}
+
+// VendorInvoiceLine is a single parsed line of a supplier invoice
+type VendorInvoiceLine struct {
+	// Description is the line text as read by the OCR service (required)
+	Description string `json:"description" validate:"required"`
+
+	// Inventory_item_id is the inventory item the OCR service matched the line to (optional)
+	Inventory_item_id *string `json:"inventory_item_id"`
+
+	// Match_confidence is the OCR service's confidence in the match, from 0 to 1
+	Match_confidence float64 `json:"match_confidence" validate:"min=0,max=1"`
+
+	// Quantity is the delivered quantity in the inventory item's unit (required)
+	Quantity *float64 `json:"quantity" validate:"required,gt=0"`
+
+	// Unit_cost is the price per unit on the invoice (required)
+	Unit_cost *float64 `json:"unit_cost" validate:"required,min=0"`
+
+	// Expires_at and Lot_number are the use-by date and lot number printed for perishable goods (optional)
+	Expires_at *time.Time `json:"expires_at"`
+	Lot_number *string    `json:"lot_number"`
+
+	// Status is APPLIED once booked as a receipt, PENDING_REVIEW or REJECTED
+	Status string `json:"status"`
+
+	// Movement_id is the inventory receipt created for the line, once applied
+	Movement_id *string `json:"movement_id"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WaitlistEntry is a walk-in party waiting for a table
+// This struct defines the structure of waitlist entry documents stored in MongoDB
+// Parties are WAITING until the host texts them that their table is ready (NOTIFIED)
+// and then SEATED, or leave the list as CANCELLED or NO_SHOW
+type WaitlistEntry struct {
+	// ID is the MongoDB ObjectID - the unique identifier for the waitlist entry document
+	ID primitive.ObjectID `bson:"_id"`
+
+	// Waitlist_entry_id is the string representation of the MongoDB ObjectID
+	Waitlist_entry_id string `json:"waitlist_entry_id"`
+
+	// Customer_name is the name the party is called by (required)
+	Customer_name *string `json:"customer_name" validate:"required,min=2,max=100"`
+
+	// Customer_phone is texted when the party joins and when its table is ready (required)
+	Customer_phone *string `json:"customer_phone" validate:"required"`
+
+	// Party_size is the number of guests (required)
+	Party_size *int `json:"party_size" validate:"required,min=1"`
+
+	// Quoted_wait_minutes is the wait quoted to the party when it joined
+	// Set by the host, or estimated from the parties ahead when left out
+	Quoted_wait_minutes *int `json:"quoted_wait_minutes" validate:"omitempty,min=0,max=600"`
+
+	// Notes are seating preferences, e.g. "outside" or "high chair" (optional)
+	Notes *string `json:"notes" validate:"omitempty,max=500"`
+
+	// Status is WAITING, NOTIFIED, SEATED, CANCELLED or NO_SHOW
+	Status string `json:"status"`
+
+	// Table_id is the table the party was seated at
+	Table_id *string `json:"table_id"`
+
+	// Status_token is the secret in the link the party checks its place in line with
+	Status_token string `json:"-"`
+
+	// Notified_at is set when the party was texted that its table is ready
+	Notified_at *time.Time `json:"notified_at"`
+
+	// Seated_at is set when the party was seated
+	Seated_at *time.Time `json:"seated_at"`
+
+	// Created_at is the timestamp when the party joined the waitlist
+	Created_at time.Time `json:"created_at"`
+
+	// Updated_at is the timestamp when the entry was last modified
+	Updated_at time.Time `json:"updated_at"`
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func AnalyticsRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.POST("/analytics/events", controller.IngestAnalyticsEvents())
+	incomingRoutes.GET("/analytics/order-entry-times", middleware.RequireRole("MANAGER", "ADMIN"), controller.GetOrderEntryTimes())
+}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CashSessionRoutes(incomingRoutes *gin.Engine) {
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+
+	incomingRoutes.POST("/cash-sessions", controller.OpenCashSession())
+	incomingRoutes.GET("/cash-sessions", managers, controller.GetCashSessions())
+	incomingRoutes.GET("/cash-sessions/:cash_session_id", controller.GetCashSession())
+	incomingRoutes.POST("/cash-sessions/:cash_session_id/movements", managers, controller.RecordCashMovement())
+	incomingRoutes.POST("/cash-sessions/:cash_session_id/close", managers, controller.CloseCashSession())
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CategoryRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/categories", controller.GetCategories())
+	incomingRoutes.GET("/categories/:category_id", controller.GetCategory())
+	incomingRoutes.POST("/categories", controller.CreateCategory())
+	incomingRoutes.PATCH("/categories/:category_id", controller.UpdateCategory())
+	incomingRoutes.DELETE("/categories/:category_id", controller.DeleteCategory())
+}
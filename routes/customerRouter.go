@@ -0,0 +1,20 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CustomerRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/customers", controller.GetCustomers())
+	incomingRoutes.GET("/customers/:customer_id", controller.GetCustomer())
+	incomingRoutes.GET("/customers/:customer_id/history", controller.GetCustomerHistory())
+	incomingRoutes.POST("/customers", controller.CreateCustomer())
+	incomingRoutes.PATCH("/customers/:customer_id", controller.UpdateCustomer())
+
+	// Segments list the spend of every customer, for managers planning offers
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+	incomingRoutes.GET("/customers/segment", managers, controller.GetCustomerSegment())
+}
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func DeviceRoutes(incomingRoutes *gin.Engine) {
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+
+	incomingRoutes.GET("/devices", managers, controller.GetDevices())
+	incomingRoutes.POST("/devices/pair/confirm", managers, controller.ConfirmDevicePairing())
+	incomingRoutes.DELETE("/devices/:device_id", managers, controller.RevokeDevice())
+}
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func DiscountRoutes(incomingRoutes *gin.Engine) {
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+
+	incomingRoutes.GET("/discounts", controller.GetDiscounts())
+	incomingRoutes.GET("/discounts/:discount_id", controller.GetDiscount())
+	incomingRoutes.POST("/discounts", managers, controller.CreateDiscount())
+	incomingRoutes.PATCH("/discounts/:discount_id", managers, controller.UpdateDiscount())
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ExportRoutes(incomingRoutes *gin.Engine) {
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+
+	incomingRoutes.GET("/exports", managers, controller.GetWarehouseExports())
+	incomingRoutes.POST("/exports/run", managers, controller.RunWarehouseExport())
+}
@@ -2,13 +2,28 @@ package routes
 
 import (
 	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 func FoodRoutes(incomingRoutes *gin.Engine) {
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+
 	incomingRoutes.GET("/foods", controller.GetFoods())
 	incomingRoutes.GET("/foods/:food_id", controller.GetFood())
 	incomingRoutes.POST("/foods", controller.CreateFood())
+	incomingRoutes.POST("/foods/import", managers, controller.ImportFoods())
 	incomingRoutes.PATCH("/foods/:food_id", controller.UpdateFood())
+	incomingRoutes.POST("/foods/:food_id/image", managers, controller.UploadFoodImage())
+	incomingRoutes.GET("/foods/:food_id/suggestions", controller.GetFoodSuggestions())
+	incomingRoutes.GET("/foods/:food_id/recipe", controller.GetFoodRecipe())
+	incomingRoutes.PUT("/foods/:food_id/recipe", managers, controller.SetFoodRecipe())
+	incomingRoutes.DELETE("/foods/:food_id/recipe", managers, controller.DeleteFoodRecipe())
+	incomingRoutes.GET("/foods/:food_id/price-history", managers, controller.GetFoodPriceHistory())
+	incomingRoutes.PUT("/foods/:food_id/scheduled-price", managers, controller.ScheduleFoodPrice())
+	incomingRoutes.DELETE("/foods/:food_id/scheduled-price", managers, controller.CancelScheduledFoodPrice())
+	// Foods are archived rather than deleted, so past orders keep referencing them
+	incomingRoutes.DELETE("/foods/:food_id", managers, controller.ArchiveFood())
+	incomingRoutes.POST("/foods/:food_id/restore", managers, controller.RestoreFood())
 }
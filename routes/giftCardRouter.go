@@ -0,0 +1,18 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GiftCardRoutes(incomingRoutes *gin.Engine) {
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+
+	incomingRoutes.POST("/gift-cards", managers, controller.IssueGiftCard())
+	incomingRoutes.GET("/gift-cards/:code", controller.GetGiftCardBalance())
+	incomingRoutes.GET("/gift-cards/:code/transactions", managers, controller.GetGiftCardTransactions())
+	incomingRoutes.POST("/gift-cards/:code/reload", managers, controller.ReloadGiftCard())
+	incomingRoutes.POST("/invoices/:invoice_id/gift-card", controller.RedeemGiftCard())
+}
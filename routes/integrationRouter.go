@@ -0,0 +1,21 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func IntegrationRoutes(incomingRoutes *gin.Engine) {
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+
+	incomingRoutes.GET("/integrations/vendor-invoices", controller.GetVendorInvoices())
+	incomingRoutes.POST("/integrations/vendor-invoices", controller.CreateVendorInvoice())
+	incomingRoutes.POST("/integrations/vendor-invoices/:vendor_invoice_id/lines/:line/review", controller.ReviewVendorInvoiceLine())
+
+	// Phone orders themselves come in signed, see WebhookRoutes
+	incomingRoutes.GET("/integrations/phone-orders/mappings", controller.GetProviderMenuMappings())
+	incomingRoutes.PUT("/integrations/phone-orders/mappings", managers, controller.SaveProviderMenuMapping())
+	incomingRoutes.DELETE("/integrations/phone-orders/mappings/:mapping_id", managers, controller.DeleteProviderMenuMapping())
+}
@@ -0,0 +1,46 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InventoryRoutes(incomingRoutes *gin.Engine) {
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+
+	incomingRoutes.GET("/inventory/items", controller.GetInventoryItems())
+	incomingRoutes.GET("/inventory/items/:inventory_item_id", controller.GetInventoryItem())
+	incomingRoutes.POST("/inventory/items", controller.CreateInventoryItem())
+	incomingRoutes.PATCH("/inventory/items/:inventory_item_id", controller.UpdateInventoryItem())
+	incomingRoutes.GET("/inventory/items/:inventory_item_id/movements", controller.GetInventoryMovements())
+	incomingRoutes.GET("/inventory/items/:inventory_item_id/suppliers", controller.GetInventoryItemSuppliers())
+	incomingRoutes.GET("/inventory/items/:inventory_item_id/batches", controller.GetInventoryItemBatches())
+	incomingRoutes.GET("/inventory/batches/expiring", controller.GetExpiringBatches())
+	incomingRoutes.GET("/inventory/barcode/:code", controller.GetBarcode())
+	incomingRoutes.POST("/inventory/barcode/:code/receive", controller.ReceiveBarcode())
+	incomingRoutes.GET("/inventory/movements", controller.GetInventoryMovements())
+	incomingRoutes.POST("/inventory/movements", controller.CreateInventoryMovement())
+	incomingRoutes.GET("/inventory/reorder-suggestions", controller.GetReorderSuggestions())
+
+	incomingRoutes.GET("/inventory/counts", controller.GetStockCounts())
+	incomingRoutes.GET("/inventory/counts/:stock_count_id", controller.GetStockCount())
+	incomingRoutes.POST("/inventory/counts", controller.OpenStockCount())
+	incomingRoutes.PUT("/inventory/counts/:stock_count_id/lines", controller.RecordStockCount())
+	incomingRoutes.POST("/inventory/counts/:stock_count_id/scan", controller.ScanStockCount())
+	incomingRoutes.POST("/inventory/counts/:stock_count_id/close", managers, controller.CloseStockCount())
+	incomingRoutes.DELETE("/inventory/counts/:stock_count_id", managers, controller.CancelStockCount())
+
+	incomingRoutes.GET("/inventory/transfers", controller.GetStockTransfers())
+	incomingRoutes.GET("/inventory/transfers/:stock_transfer_id", controller.GetStockTransfer())
+	incomingRoutes.POST("/inventory/transfers", controller.CreateStockTransfer())
+	incomingRoutes.POST("/inventory/transfers/:stock_transfer_id/receive", controller.ReceiveStockTransfer())
+	incomingRoutes.POST("/inventory/transfers/:stock_transfer_id/cancel", managers, controller.CancelStockTransfer())
+
+	incomingRoutes.GET("/suppliers", controller.GetSuppliers())
+	incomingRoutes.GET("/suppliers/:supplier_id", controller.GetSupplier())
+	incomingRoutes.POST("/suppliers", managers, controller.CreateSupplier())
+	incomingRoutes.PATCH("/suppliers/:supplier_id", managers, controller.UpdateSupplier())
+	incomingRoutes.DELETE("/suppliers/:supplier_id", managers, controller.DeleteSupplier())
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -10,5 +11,28 @@ func InvoiceRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/invoices", controller.GetInvoices())
 	incomingRoutes.GET("/invoices/:invoice_id", controller.GetInvoice())
 	incomingRoutes.POST("/invoices", controller.CreateInvoice())
+	incomingRoutes.POST("/invoices/session", controller.CreateSessionInvoice())
 	incomingRoutes.PATCH("/invoices/:invoice_id", controller.UpdateInvoice())
+	incomingRoutes.GET("/invoices/:invoice_id/precheck", controller.GetInvoicePrecheck())
+	incomingRoutes.POST("/invoices/:invoice_id/finalize", controller.FinalizeInvoice())
+	incomingRoutes.POST("/invoices/:invoice_id/split", controller.SplitInvoice())
+	incomingRoutes.GET("/invoices/:invoice_id/splits", controller.GetInvoiceSplits())
+	incomingRoutes.POST("/invoices/:invoice_id/discounts", controller.ApplyDiscount())
+	incomingRoutes.DELETE("/invoices/:invoice_id/discounts/:discount_id", controller.RemoveDiscount())
+	incomingRoutes.POST("/invoices/:invoice_id/send", controller.SendInvoice())
+	incomingRoutes.GET("/invoices/:invoice_id/deliveries", controller.GetInvoiceDeliveries())
+	incomingRoutes.POST("/invoices/:invoice_id/room-charge", controller.ChargeToRoom())
+	incomingRoutes.POST("/room-charges/:posting_id/retry", controller.RetryRoomCharge())
+	incomingRoutes.POST("/room-charges/:posting_id/cancel", controller.CancelRoomCharge())
+
+	// Refunds and voids have to be authorized by a manager
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+	incomingRoutes.POST("/invoices/:invoice_id/refund", managers, controller.RefundInvoice())
+	incomingRoutes.POST("/invoices/:invoice_id/void", managers, controller.VoidInvoice())
+	incomingRoutes.GET("/invoices/:invoice_id/credit-notes", managers, controller.GetInvoiceCreditNotes())
+	incomingRoutes.GET("/credit-notes", managers, controller.GetCreditNotes())
+	incomingRoutes.GET("/invoice-number-gaps", managers, controller.GetInvoiceNumberGaps())
+	incomingRoutes.GET("/room-charges", managers, controller.GetRoomCharges())
+	incomingRoutes.GET("/invoices/overdue", managers, controller.GetOverdueInvoices())
+	incomingRoutes.GET("/credit-notes/:credit_note_id", managers, controller.GetCreditNote())
 }
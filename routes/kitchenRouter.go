@@ -0,0 +1,11 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func KitchenRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/kitchen/stream", controller.StreamKitchen())
+}
@@ -2,13 +2,34 @@ package routes
 
 import (
 	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 func MenuRoutes(incomingRoutes *gin.Engine) {
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+
 	incomingRoutes.GET("/menus", controller.GetMenus())
+	incomingRoutes.GET("/menus/snapshot", controller.GetMenuSnapshot())
 	incomingRoutes.GET("/menus/:menu_id", controller.GetMenu())
+	incomingRoutes.GET("/menus/:menu_id/foods", controller.GetMenuFoods())
 	incomingRoutes.POST("/menus", controller.CreateMenu())
 	incomingRoutes.PATCH("/menus/:menu_id", controller.UpdateMenu())
+	incomingRoutes.PATCH("/menus/:menu_id/reorder", controller.ReorderMenuFoods())
+	incomingRoutes.POST("/menus/:menu_id/clone", controller.CloneMenu())
+	incomingRoutes.DELETE("/menus/:menu_id", managers, controller.ArchiveMenu())
+	incomingRoutes.POST("/menus/:menu_id/restore", managers, controller.RestoreMenu())
+	incomingRoutes.POST("/menus/:menu_id/publish", managers, controller.PublishMenu())
+	incomingRoutes.GET("/menus/:menu_id/versions", controller.GetMenuVersions())
+	incomingRoutes.GET("/menus/:menu_id/versions/:number", controller.GetMenuVersion())
+
+	// Drafts are edited by managers and only affect the live menu once published
+	incomingRoutes.POST("/menus/:menu_id/draft", managers, controller.CreateMenuDraft())
+	incomingRoutes.GET("/menus/:menu_id/draft", managers, controller.GetMenuDraft())
+	incomingRoutes.PATCH("/menus/:menu_id/draft", managers, controller.UpdateMenuDraft())
+	incomingRoutes.DELETE("/menus/:menu_id/draft", managers, controller.DiscardMenuDraft())
+	incomingRoutes.POST("/menus/:menu_id/draft/foods", managers, controller.SaveMenuDraftFood())
+	incomingRoutes.PUT("/menus/:menu_id/draft/foods/:food_id", managers, controller.SaveMenuDraftFood())
+	incomingRoutes.DELETE("/menus/:menu_id/draft/foods/:food_id", managers, controller.RemoveMenuDraftFood())
 }
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func NotificationRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/notifications", controller.GetNotifications())
+	incomingRoutes.PATCH("/notifications/:notification_id/read", controller.MarkNotificationRead())
+	incomingRoutes.GET("/notification-preferences", controller.GetNotificationPreferences())
+	incomingRoutes.PUT("/notification-preferences", controller.UpdateNotificationPreferences())
+}
+
+func MessageRoutes(incomingRoutes *gin.Engine) {
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+
+	incomingRoutes.GET("/messages", controller.GetOutboundMessages())
+	incomingRoutes.POST("/messages/:message_id/retry", managers, controller.RetryOutboundMessage())
+	incomingRoutes.POST("/otp", controller.SendOneTimeCode())
+	incomingRoutes.POST("/otp/verify", controller.VerifyOneTimeCode())
+}
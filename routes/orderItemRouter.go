@@ -12,4 +12,9 @@ func OrderItemRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/orderItems-order/:order_id", controller.GetOrderItemsByOrder())
 	incomingRoutes.POST("/orderItems", controller.CreateOrderItem())
 	incomingRoutes.PATCH("/orderItems/:orderItem_id", controller.UpdateOrderItem())
+	incomingRoutes.DELETE("/orderItems/:orderItem_id", controller.DeleteOrderItem())
+	incomingRoutes.POST("/orderItems/:orderItem_id/bump", controller.BumpOrderItem())
+	incomingRoutes.POST("/orderItems/:orderItem_id/recall", controller.RecallOrderItem())
+	incomingRoutes.POST("/orderItems/:orderItem_id/serve", controller.ServeOrderItem())
+	incomingRoutes.POST("/orderItems/:orderItem_id/void", controller.VoidOrderItem())
 }
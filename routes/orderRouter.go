@@ -2,13 +2,20 @@ package routes
 
 import (
 	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 func OrderRoutes(incomingRoutes *gin.Engine) {
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+
 	incomingRoutes.GET("/orders", controller.GetOrders())
 	incomingRoutes.GET("/orders/:order_id", controller.GetOrder())
 	incomingRoutes.POST("/orders", controller.CreateOrder())
 	incomingRoutes.PATCH("/orders/:order_id", controller.UpdateOrder())
+	incomingRoutes.POST("/orders/:order_id/close", controller.CloseOrder())
+	incomingRoutes.POST("/orders/:order_id/present-check", controller.PresentCheck())
+	incomingRoutes.GET("/orders/:order_id/profitability", managers, controller.GetOrderProfitability())
+	incomingRoutes.GET("/orders/:order_id/history", controller.GetOrderHistory())
 }
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PublicRoutes sets up routes used by guests, which must not require a staff token
+func PublicRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/public/reservations/:token/confirm", controller.ConfirmReservationPage())
+	incomingRoutes.POST("/public/reservations/:token/confirm", controller.ConfirmReservationByToken())
+	incomingRoutes.GET("/public/reservations/:token/cancel", controller.CancelReservationPage())
+	incomingRoutes.POST("/public/reservations/:token/cancel", controller.CancelReservationByToken())
+	incomingRoutes.GET("/public/reservations/availability", controller.GetReservationAvailability())
+	incomingRoutes.GET("/public/waitlist/:token", controller.GetWaitlistStatusByToken())
+	incomingRoutes.POST("/public/waitlist/:token/cancel", controller.LeaveWaitlistByToken())
+	incomingRoutes.POST("/public/devices/pair", controller.RequestDevicePairing())
+	incomingRoutes.GET("/public/devices/pair/:pairing_id", controller.GetDevicePairing())
+	incomingRoutes.GET("/public/pickup-board", controller.StreamPickupBoard())
+	incomingRoutes.GET("/public/pickup-board/current", controller.GetPickupBoard())
+	incomingRoutes.GET("/public/menu", controller.GetPublicMenu())
+	incomingRoutes.GET("/public/tables/:table_id", controller.VerifyTableQrCode())
+	incomingRoutes.GET("/public/images/*key", controller.GetImage())
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ReportRoutes(incomingRoutes *gin.Engine) {
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+
+	incomingRoutes.GET("/reports/menu-engineering", managers, controller.GetMenuEngineering())
+	incomingRoutes.GET("/reports/price-changes", managers, controller.GetPriceChanges())
+	incomingRoutes.GET("/reports/table-turns", managers, controller.GetTableTurns())
+	incomingRoutes.GET("/reports/covers", managers, controller.GetCovers())
+	incomingRoutes.GET("/reports/sales", managers, controller.GetSalesReport())
+	incomingRoutes.GET("/reports/sales-by-hour", managers, controller.GetSalesByHour())
+	incomingRoutes.GET("/reports/top-items", managers, controller.GetTopItems())
+	incomingRoutes.GET("/reports/revenue-by-category", managers, controller.GetRevenueByCategory())
+	incomingRoutes.GET("/reports/average-check", managers, controller.GetAverageCheck())
+	incomingRoutes.GET("/reports/servers", managers, controller.GetServerPerformance())
+	incomingRoutes.GET("/reports/payments", managers, controller.GetPaymentsReport())
+	incomingRoutes.GET("/reports/tax", managers, controller.GetTaxReport())
+	incomingRoutes.GET("/reports/forecast", managers, controller.GetForecast())
+	incomingRoutes.GET("/reports/exceptions", managers, controller.GetExceptions())
+	incomingRoutes.POST("/reports/query", managers, controller.RunReportQuery())
+}
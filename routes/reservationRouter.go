@@ -0,0 +1,22 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ReservationRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/reservations", controller.GetReservations())
+	incomingRoutes.GET("/reservations/availability", controller.GetReservationAvailability())
+	incomingRoutes.GET("/reservations/:reservation_id", controller.GetReservation())
+	incomingRoutes.POST("/reservations", controller.CreateReservation())
+	incomingRoutes.PATCH("/reservations/:reservation_id", controller.UpdateReservation())
+
+	// Deposits are refunded by managers, whatever the deposit policy says
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+	incomingRoutes.GET("/prepayments", managers, controller.GetPrepayments())
+	incomingRoutes.GET("/prepayments/:prepayment_id", controller.GetPrepayment())
+	incomingRoutes.POST("/prepayments/:prepayment_id/refund", managers, controller.RefundPrepayment())
+}
@@ -0,0 +1,11 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SearchRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/search", controller.Search())
+}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SectionRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/sections/assignments", controller.GetSectionAssignments())
+	incomingRoutes.GET("/sections/rotation", controller.GetServerRotation())
+
+	// Servers are put on sections by managers
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+	incomingRoutes.POST("/sections/assignments", managers, controller.CreateSectionAssignment())
+	incomingRoutes.DELETE("/sections/assignments/:section_assignment_id", managers, controller.DeleteSectionAssignment())
+}
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SettingsRoutes(incomingRoutes *gin.Engine) {
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+
+	incomingRoutes.GET("/settings", controller.GetSettings())
+	incomingRoutes.PATCH("/settings", managers, controller.UpdateSettings())
+	incomingRoutes.GET("/payment-methods", controller.GetPaymentMethods())
+}
@@ -2,13 +2,27 @@ package routes
 
 import (
 	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 func TableRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/tables", controller.GetTables())
+	incomingRoutes.GET("/tables/suggest", controller.SuggestTables())
 	incomingRoutes.GET("/tables/:table_id", controller.GetTable())
 	incomingRoutes.POST("/tables", controller.CreateTable())
+	incomingRoutes.POST("/tables/combine", controller.CombineTables())
+	incomingRoutes.POST("/tables/split", controller.SplitTable())
 	incomingRoutes.PATCH("/tables/:table_id", controller.UpdateTable())
+	incomingRoutes.POST("/tables/:table_id/status", controller.SetTableStatus())
+	incomingRoutes.GET("/tables/:table_id/qrcode", controller.GetTableQrCode())
+
+	// Replacing a QR code invalidates the printed one, so only managers can do it
+	managers := middleware.RequireRole("MANAGER", "ADMIN")
+	incomingRoutes.POST("/tables/:table_id/qrcode/rotate", managers, controller.RotateTableQrCode())
+
+	// Retiring tables changes the floor plan, so only managers can do it
+	incomingRoutes.DELETE("/tables/:table_id", managers, controller.DeleteTable())
+	incomingRoutes.POST("/tables/:table_id/restore", managers, controller.RestoreTable())
 }
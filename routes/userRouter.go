@@ -4,6 +4,7 @@ package routes
 
 import (
 	controller "golang-restaurant-management/controllers"
+	middleware "golang-restaurant-management/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -28,4 +29,20 @@ func UserRoutes(incomingRoutes *gin.Engine) {
 	// POST /users/login - Authenticate user and receive JWT tokens
 	// Public route - no authentication required
 	incomingRoutes.POST("/users/login", controller.Login())
+	
+	// POST /users/password-reset - Email a password reset link
+	// Public route - no authentication required
+	incomingRoutes.POST("/users/password-reset", controller.RequestPasswordReset())
+	
+	// POST /users/password-reset/confirm - Set a new password with the token of a reset link
+	// Public route - no authentication required
+	incomingRoutes.POST("/users/password-reset/confirm", controller.ResetPassword())
+}
+
+// UserAdminRoutes sets up user management routes restricted to managers
+// These must be registered after the authentication middleware
+func UserAdminRoutes(incomingRoutes *gin.Engine) {
+	// PATCH /users/:user_id/role - Change a user's staff role
+	// Requires the MANAGER or ADMIN role
+	incomingRoutes.PATCH("/users/:user_id/role", middleware.RequireRole("MANAGER", "ADMIN"), controller.UpdateUserRole())
 }
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func WaitlistRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/waitlist", controller.GetWaitlist())
+	incomingRoutes.POST("/waitlist", controller.JoinWaitlist())
+	incomingRoutes.PATCH("/waitlist/:waitlist_entry_id", controller.UpdateWaitlistEntry())
+	incomingRoutes.POST("/waitlist/:waitlist_entry_id/notify", controller.NotifyWaitlistEntry())
+	incomingRoutes.POST("/waitlist/:waitlist_entry_id/seat", controller.SeatWaitlistEntry())
+	incomingRoutes.POST("/waitlist/:waitlist_entry_id/no-show", controller.MarkWaitlistNoShow())
+	incomingRoutes.DELETE("/waitlist/:waitlist_entry_id", controller.CancelWaitlistEntry())
+}
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	controller "golang-restaurant-management/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookRoutes sets up routes called by external providers
+// These are authenticated by request signatures instead of staff tokens
+func WebhookRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.POST("/webhooks/payments", controller.PaymentWebhook())
+	incomingRoutes.POST("/webhooks/pms", controller.PMSWebhook())
+	incomingRoutes.POST("/webhooks/sms/twilio", controller.TwilioStatusWebhook())
+	incomingRoutes.POST("/integrations/phone-orders", controller.CreatePhoneOrder())
+}